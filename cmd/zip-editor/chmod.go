@@ -0,0 +1,110 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// runChmod はエントリの属性（Unixのパーミッション・MS-DOSの属性・作成したOS）を表示・変更します
+func runChmod(args []string) error {
+	fs := flag.NewFlagSet("chmod", flag.ExitOnError)
+	list := fs.Bool("list", false, "変更せずに、エントリの属性を表示する")
+	mode := fs.String("mode", "", "Unixのパーミッション（chmodと同じ形式、例: 755、+x、go-w、a+rX）")
+	scripts := fs.Bool("scripts", false, "-mode を \"#!\" で始まるファイルだけに適用する")
+	dos := fs.String("dos", "", "MS-DOSの属性（R: 読み取り専用、H: 隠し、S: システム、A: アーカイブ、例: -RHS、+A）")
+	host := fs.String("host", "", "作成したOS（unix または fat）")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		return errors.New("ZIPファイルを指定してください")
+	}
+	zipPath := fs.Arg(0)
+
+	// パスを指定した場合は、そのエントリ（フォルダの場合は中のエントリを含む）だけを対象にする
+	var match func(name string) bool
+	if fs.NArg() > 1 {
+		match = zipfmt.SubtreeMatcher(fs.Args()[1:])
+	}
+	if *list {
+		return listAttrs(zipPath, match)
+	}
+
+	var edit zipfmt.AttrEdit
+	if *mode != "" {
+		perm, err := zipfmt.ParsePermEdit(*mode)
+		if err != nil {
+			return err
+		}
+		edit.Perm = perm
+		edit.ScriptsOnly = *scripts
+	}
+	if *dos != "" {
+		set, clear, err := zipfmt.ParseDOSEdit(*dos)
+		if err != nil {
+			return err
+		}
+		edit.DOSSet, edit.DOSClear = set, clear
+	}
+	switch strings.ToLower(*host) {
+	case "":
+	case "unix":
+		edit.Host = zipfmt.HostToUnix
+	case "fat", "dos":
+		edit.Host = zipfmt.HostToFAT
+	default:
+		return fmt.Errorf("作成したOSの指定が正しくありません: %s（unix または fat）", *host)
+	}
+	if edit.IsEmpty() {
+		return errors.New("-list、-mode、-dos、-host のいずれかを指定してください")
+	}
+
+	changed := 0
+	err := zipfmt.RewriteFile(zipPath, zipfmt.RewriteFileOptions{}, func(zw *zip.Writer, reader *zipfmt.ReadCloser) error {
+		for _, f := range reader.File {
+			header := f.FileHeader
+			if match == nil || match(common.AutoDetectEncoding(f.Name)) {
+				script := edit.NeedsScript() && zipfmt.IsScript(f)
+				if zipfmt.ApplyAttrEdit(&header, edit, script) {
+					changed++
+				}
+			}
+			if err := zipfmt.CopyRaw(zw, f, &header); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d件のエントリの属性を変更しました\n", changed)
+	return nil
+}
+
+// listAttrs はエントリのパーミッション、MS-DOSの属性と作成したOSを表示します
+func listAttrs(zipPath string, match func(name string) bool) error {
+	reader, err := zipfmt.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, f := range reader.File {
+		name := common.AutoDetectEncoding(f.Name)
+		if match != nil && !match(name) {
+			continue
+		}
+		if zipfmt.IsSymlink(&f.FileHeader) {
+			if target, err := zipfmt.ReadSymlink(f); err == nil {
+				name += " → " + common.AutoDetectEncoding(target)
+			}
+		}
+		fmt.Printf("%-11s %-12s %s\n", f.Mode(), zipfmt.AttrText(&f.FileHeader), name)
+	}
+	return nil
+}
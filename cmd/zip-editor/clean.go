@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"zip-editor/internal/common"
+)
+
+// runClean はプロファイル（macOS・Windowsの不要なファイルなど）のパターンに一致するエントリを、ZIPファイルから削除します
+// 複数のZIPファイルを指定した場合は順に処理し、失敗したファイルがあっても残りのファイルの処理を続けます
+func runClean(args []string) error {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	profile := fs.String("profile", "macos,windows", "使うプロファイルの名前（カンマ区切り、\"all\"ですべて）")
+	dryRun := fs.Bool("n", false, "削除せずに、一致するエントリと件数だけを表示する")
+	list := fs.Bool("list", false, "プロファイルの一覧とパターンを表示する")
+	fs.Parse(args)
+
+	profiles, err := common.LoadCleanProfiles()
+	if err != nil {
+		return err
+	}
+	if *list {
+		listCleanProfiles(profiles)
+		return nil
+	}
+
+	if fs.NArg() < 1 {
+		return errors.New("ZIPファイルを指定してください")
+	}
+	matcher, err := common.CleanProfileMatcher(profiles, strings.Split(*profile, ","))
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, zipPath := range fs.Args() {
+		if fs.NArg() > 1 {
+			fmt.Printf("== %s\n", zipPath)
+		}
+		if err := removeMatching(zipPath, matcher, *dryRun); err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %s: %v\n", zipPath, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d件のZIPファイルの処理に失敗しました", failed)
+	}
+	return nil
+}
+
+// listCleanProfiles はプロファイルの一覧と、設定ファイルの場所を表示します
+func listCleanProfiles(profiles []common.CleanProfile) {
+	for _, p := range profiles {
+		fmt.Printf("%s\t%s\n", p.Name, p.Desc)
+		fmt.Printf("\t%s\n", strings.Join(p.Patterns, " "))
+	}
+	if path, err := common.CleanProfilesPath(); err == nil {
+		fmt.Println()
+		fmt.Println("設定ファイル:", path)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command はサブコマンドの定義です
+type command struct {
+	usage string                    // 使い方（引数の説明）
+	desc  string                    // 説明
+	run   func(args []string) error // 実行する関数（引数はサブコマンド名より後ろ）
+}
+
+// commands はサブコマンドの一覧です
+var commands = map[string]command{
+	"convert": {
+		usage: "convert [-method 方式] [-level レベル] [-strict] 変換元 変換先",
+		desc:  "アーカイブの形式を変換します（変換先の形式は拡張子から判定）",
+		run:   runConvert,
+	},
+	"split": {
+		usage: "split [-size サイズ] 入力.zip 分割先.zip",
+		desc:  "ZIPファイルを指定したサイズのボリューム（.z01, .z02 …, .zip）に分割します",
+		run:   runSplit,
+	},
+	"join": {
+		usage: "join 分割.zip 結合先.zip",
+		desc:  "分割アーカイブ（最後のボリュームの .zip を指定）をひとつのZIPファイルに結合します",
+		run:   runJoin,
+	},
+	"info": {
+		usage: "info アーカイブ...",
+		desc:  "アーカイブの形式・エントリ数・先頭に付加されたデータ（自己解凍スタブなど）などの情報を表示します",
+		run:   runInfo,
+	},
+	"comment": {
+		usage: "comment [-entry パス] [-set コメント | -file ファイル | -clear] [-encoding utf-8|shift_jis] 入力.zip",
+		desc:  "ZIPファイル全体またはエントリのコメントを表示します。-set・-file（\"-\"で標準入力）・-clear を指定した場合は変更します",
+		run:   runComment,
+	},
+	"touch": {
+		usage: "touch [-list | -time 日時 | -now | -shift 時間 | -newest] 入力.zip [パス...]",
+		desc:  "エントリ（パスを指定した場合はそのファイル・フォルダ以下）の更新日時を変更します。拡張タイムスタンプ・NTFSのタイムスタンプも揃えて書き換えます",
+		run:   runTouch,
+	},
+	"chmod": {
+		usage: "chmod [-list | -mode パーミッション [-scripts] | -dos 属性 | -host unix|fat] 入力.zip [パス...]",
+		desc:  "エントリ（パスを指定した場合はそのファイル・フォルダ以下）のUnixのパーミッション・MS-DOSの属性・作成したOSを変更します",
+		run:   runChmod,
+	},
+	"normalize": {
+		usage: "normalize [-time 日時] [-level レベル] [-first パス,...] 入力.zip",
+		desc:  "同じ内容から常に同じバイト列になるように、エントリの並べ替え・日時とパーミッションの統一・拡張フィールドとコメントの削除・一定の圧縮レベルでの圧縮し直しを行います",
+		run:   runNormalize,
+	},
+	"order": {
+		usage: "order [-list | -by original|path|size [-desc] [-first パス,...] [-from ファイル] [-preset epub|jar]] 入力.zip",
+		desc:  "ZIPファイルのエントリの格納順を表示・変更します。-first・-from・-preset で指定したエントリを先頭に置き、残りを -by の順に並べます",
+		run:   runOrder,
+	},
+	"clean": {
+		usage: "clean [-profile 名前,...] [-n] [-list] 入力.zip...",
+		desc:  "プロファイル（macos、windows、vcs、build、editor、設定ファイルで追加したもの、all）のパターンに一致する不要なエントリを削除します。-list でプロファイルの一覧を表示します",
+		run:   runClean,
+	},
+	"find": {
+		usage: "find [-l | -c | -delete] アーカイブ 検索式...",
+		desc:  "検索式（例: 'size > 50MB and date < 2020'、'method = store'、'encrypted'、'mime ~ image/*'、'*.log'）に一致するエントリを表示します。-delete では一致したエントリを削除します",
+		run:   runFind,
+	},
+	"grep": {
+		usage: "grep [-E] [-i] [-C 行数] [-I] [-l | -c] [-j 並列数] [-include パターン,...] [-password パスワード] アーカイブ 文字列",
+		desc:  "アーカイブ内のファイルを展開しながら並行して内容を検索し、一致した行を表示します。エンコーディング（UTF-8・UTF-16・Shift-JIS など）は自動で判定します",
+		run:   runGrep,
+	},
+	"diff": {
+		usage: "diff [-json] [-stat] [-C 行数] [-max-text サイズ] [-password パスワード] 古いアーカイブ 新しいアーカイブ",
+		desc:  "2つのアーカイブを比較し、追加・削除・変更・名前の変更・パーミッションやメタデータだけの変更と、テキストファイルの差分（unified形式）を表示します",
+		run:   runDiff,
+	},
+	"mkpatch": {
+		usage: "mkpatch [-o パッチ] 古いアーカイブ 新しいアーカイブ",
+		desc:  "古いアーカイブを新しいアーカイブに更新するパッチを作成します。変わっていないエントリは古いアーカイブからコピーするため、パッチには変わった部分だけが入ります",
+		run:   runMkpatch,
+	},
+	"patch": {
+		usage: "patch [-o 出力先] 古いアーカイブ パッチ | patch -info パッチ",
+		desc:  "古いアーカイブにパッチを適用し、新しいアーカイブとバイト単位で同じファイルを作成します（適用の前後にファイル全体のSHA-256を確認）",
+		run:   runPatch,
+	},
+	"dupes": {
+		usage: "dupes [-min サイズ] [-include パターン,...] [-keep first|shortest] [-per-archive] [-delete] [-password パスワード] アーカイブ...",
+		desc:  "アーカイブ内・アーカイブの間で同じ内容のファイル（サイズ・CRC32で絞り込み、SHA-256で確認）を探し、減らせるサイズを表示します。-delete では残すもの以外を削除します",
+		run:   runDupes,
+	},
+	"rm": {
+		usage: "rm [-n] [-from ファイル] 入力.zip パターン...",
+		desc:  "パターンに一致するエントリを削除します（*.log、__MACOSX/、docs/**/*.tmp、re:正規表現、!除外）。-n では一致するエントリの表示だけを行います",
+		run:   runRm,
+	},
+	"stub": {
+		usage: "stub [-strip | -replace スタブ | -extract 書き出し先] [-o 出力先] 入力.zip",
+		desc:  "ZIPファイルの先頭に付加されたデータ（自己解凍スタブなど）を取り除く・置き換える・書き出します",
+		run:   runStub,
+	},
+}
+
+// printUsage はサブコマンドの一覧を表示します
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "使い方: zip-editor <サブコマンド> [オプション] 引数...")
+	fmt.Fprintln(os.Stderr)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n      %s\n", commands[name].usage, commands[name].desc)
+	}
+}
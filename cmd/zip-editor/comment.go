@@ -0,0 +1,119 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// runComment はZIPファイル全体またはエントリのコメントを表示・変更します
+func runComment(args []string) error {
+	fs := flag.NewFlagSet("comment", flag.ExitOnError)
+	entry := fs.String("entry", "", "対象のエントリのパス（省略した場合はアーカイブ全体のコメント）")
+	set := fs.String("set", "", "コメントをこの文字列に変更する")
+	file := fs.String("file", "", "コメントをこのファイルの内容に変更する（\"-\"で標準入力）")
+	clear := fs.Bool("clear", false, "コメントを削除する")
+	encoding := fs.String("encoding", "utf-8", "変更したコメントのエンコーディング（utf-8・shift_jis）")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("ZIPファイルを指定してください")
+	}
+	zipPath := fs.Arg(0)
+
+	enc, ok := common.ParseTextEncoding(*encoding)
+	if !ok {
+		return fmt.Errorf("不明なエンコーディングです: %s", *encoding)
+	}
+
+	var comment string
+	changed := 0
+	if *set != "" {
+		comment = *set
+		changed++
+	}
+	if *file != "" {
+		text, err := readTextFile(*file)
+		if err != nil {
+			return err
+		}
+		comment = text
+		changed++
+	}
+	if *clear {
+		changed++
+	}
+	switch changed {
+	case 0:
+		return printComment(zipPath, *entry)
+	case 1:
+		return writeComment(zipPath, *entry, comment, enc)
+	}
+	return errors.New("-set、-file、-clear は同時に指定できません")
+}
+
+// readTextFile はファイル（"-"の場合は標準入力）の内容を文字列として読み込みます
+func readTextFile(path string) (string, error) {
+	if path == "-" {
+		b, err := io.ReadAll(os.Stdin)
+		return string(b), err
+	}
+	b, err := os.ReadFile(path)
+	return string(b), err
+}
+
+// printComment はアーカイブ全体またはエントリのコメントを表示します
+func printComment(zipPath, entryPath string) error {
+	reader, err := zipfmt.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if entryPath == "" {
+		fmt.Print(common.AutoDetectEncoding(reader.Comment))
+		return nil
+	}
+	for _, f := range reader.File {
+		if common.AutoDetectEncoding(f.Name) == entryPath {
+			fmt.Print(common.AutoDetectEncoding(f.Comment))
+			return nil
+		}
+	}
+	return fmt.Errorf("エントリが見つかりません: %s", entryPath)
+}
+
+// writeComment はコメントを変更したZIPファイルを書き直し、元のファイルを置き換えます
+func writeComment(zipPath, entryPath, comment string, enc common.TextEncoding) error {
+	return zipfmt.RewriteFile(zipPath, zipfmt.RewriteFileOptions{}, func(zw *zip.Writer, reader *zipfmt.ReadCloser) error {
+		found := entryPath == ""
+		for _, f := range reader.File {
+			header := f.FileHeader
+			if entryPath != "" && common.AutoDetectEncoding(f.Name) == entryPath {
+				if err := zipfmt.SetEntryComment(&header, comment, enc); err != nil {
+					return err
+				}
+				found = true
+			}
+			if err := zipfmt.CopyRaw(zw, f, &header); err != nil {
+				return err
+			}
+		}
+		if !found {
+			return fmt.Errorf("エントリが見つかりません: %s", entryPath)
+		}
+		if entryPath != "" {
+			return nil
+		}
+		encoded, err := zipfmt.EncodeComment(comment, enc)
+		if err != nil {
+			return err
+		}
+		return zw.SetComment(encoded)
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"zip-editor/internal/archive"
+	"zip-editor/internal/zipfmt"
+)
+
+// runConvert はアーカイブの形式を変換します
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	method := fs.String("method", "deflate", "変換先がZIPの場合の圧縮方式（store・deflate・bzip2・lzma・zstandard・xz）")
+	level := fs.Int("level", zipfmt.LevelDefault, "圧縮レベル（1〜9、0で各方式の標準）")
+	strict := fs.Bool("strict", false, "変換先の形式で表現できない情報がある場合はエラーにする")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("変換元と変換先を指定してください")
+	}
+	src, dst := fs.Arg(0), fs.Arg(1)
+
+	format, comp, ok := archive.FormatFromName(dst)
+	if !ok {
+		return fmt.Errorf("変換先の拡張子から形式を判定できません: %s", dst)
+	}
+	m, ok := methodByName(*method)
+	if !ok {
+		return fmt.Errorf("不明な圧縮方式です: %s", *method)
+	}
+
+	result, err := archive.Convert(src, dst, archive.ConvertOptions{
+		Format:      format,
+		Compression: comp,
+		Method:      m,
+		Level:       *level,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Print(archive.FormatConvertReport(result))
+
+	if *strict && (len(result.Lossy) > 0 || len(result.Notes) > 0) {
+		os.Remove(dst)
+		return errors.New("表現できない情報があるため、変換結果を削除しました")
+	}
+	return nil
+}
+
+// methodByName は圧縮方式の名前（大文字・小文字を区別しない）から、書き込みに使用できる圧縮方式を返します
+func methodByName(name string) (uint16, bool) {
+	for _, m := range zipfmt.WritableMethods {
+		if strings.EqualFold(zipfmt.MethodName(m), name) {
+			return m, true
+		}
+	}
+	if strings.EqualFold(name, "zstd") {
+		return zipfmt.MethodZstd, true
+	}
+	return zip.Deflate, false
+}
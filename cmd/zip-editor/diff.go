@@ -0,0 +1,109 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"zip-editor/internal/archive"
+	"zip-editor/internal/zipfmt"
+)
+
+// jsonDiff は -json で出力する比較結果です
+type jsonDiff struct {
+	Old       string           `json:"old"`
+	New       string           `json:"new"`
+	Unchanged int              `json:"unchanged"`
+	Changes   []jsonDiffChange `json:"changes"`
+}
+
+// jsonDiffChange は -json で出力する変化したファイルひとつです
+type jsonDiffChange struct {
+	Kind    string   `json:"kind"` // added, removed, modified, renamed, permission, metadata
+	Path    string   `json:"path"`
+	OldPath string   `json:"old_path,omitempty"`
+	OldSize int64    `json:"old_size"`
+	NewSize int64    `json:"new_size"`
+	Details []string `json:"details,omitempty"`
+	Diff    string   `json:"diff,omitempty"`
+	Note    string   `json:"note,omitempty"`
+}
+
+// runDiff は2つのアーカイブのファイルを比較し、追加・削除・変更・名前の変更・パーミッションやメタデータだけの変更を表示します
+// 内容が変わったテキストファイルは unified diff も表示します
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "結果をJSONで出力する")
+	stat := fs.Bool("stat", false, "変化したファイルの一覧だけを表示する（テキストの差分を表示しない）")
+	context := fs.Int("C", 3, "テキストの差分で変更の前後に表示する行数")
+	maxText := fs.Int64("max-text", archive.DefaultMaxDiffTextSize, "テキストの差分を作るファイルの最大サイズ（バイト）")
+	password := fs.String("password", "", "暗号化されたエントリのパスワード（両方のアーカイブで共通）")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("古いアーカイブと新しいアーカイブを指定してください")
+	}
+
+	opts := archive.DiffOptions{TextDiff: !*stat, Context: max(*context, 0), MaxTextSize: *maxText}
+	if *password != "" {
+		opts.OpenEncrypted = func(_ string, f *zip.File) (io.ReadCloser, error) {
+			return zipfmt.OpenEncrypted(f, *password)
+		}
+	}
+	result, err := archive.DiffArchives(fs.Arg(0), fs.Arg(1), opts)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		out := jsonDiff{Old: result.OldPath, New: result.NewPath, Unchanged: result.Unchanged, Changes: []jsonDiffChange{}}
+		for _, c := range result.Changes {
+			jc := jsonDiffChange{
+				Kind:    c.Kind.Key(),
+				Path:    c.Path,
+				OldSize: c.OldSize,
+				NewSize: c.NewSize,
+				Details: c.Details,
+				Diff:    c.TextDiff,
+				Note:    c.Note,
+			}
+			if c.Kind != archive.DiffAdded {
+				jc.OldPath = c.OldPath
+			}
+			out.Changes = append(out.Changes, jc)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(out)
+	}
+
+	for _, c := range result.Changes {
+		switch c.Kind {
+		case archive.DiffRenamed:
+			fmt.Printf("%s\t%s → %s\n", c.Kind, c.OldPath, c.Path)
+		default:
+			fmt.Printf("%s\t%s\n", c.Kind, c.Path)
+		}
+		for _, d := range c.Details {
+			fmt.Printf("\t%s\n", d)
+		}
+		if c.Note != "" {
+			fmt.Printf("\t（%s）\n", c.Note)
+		}
+	}
+	if !*stat {
+		for _, c := range result.Changes {
+			if c.TextDiff != "" {
+				fmt.Println()
+				fmt.Print(c.TextDiff)
+			}
+		}
+	}
+	fmt.Println()
+	fmt.Println(result.Summary())
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"zip-editor/internal/archive"
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// runDupes はアーカイブ内（複数指定した場合はアーカイブの間も含む）で同じ内容のファイルを探して表示します
+// -delete を指定した場合は、各組で残すもの以外のファイルをZIPファイルから削除します
+func runDupes(args []string) error {
+	fs := flag.NewFlagSet("dupes", flag.ExitOnError)
+	minSize := fs.String("min", "1", "これより小さいファイルは調べない（例: 1K、10MB）")
+	include := fs.String("include", "", "調べるファイルのパターン（カンマ区切り、例: *.png,assets/）")
+	keepName := fs.String("keep", "first", "残すもの（first: 先にあるもの、shortest: パスが最も短いもの）")
+	perArchive := fs.Bool("per-archive", false, "アーカイブごとにひとつ残す（ほかのアーカイブにあるファイルは削除しない）")
+	remove := fs.Bool("delete", false, "残すもの以外のファイルを削除する（ZIPファイルのみ）")
+	password := fs.String("password", "", "暗号化されたエントリのパスワード")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		return errors.New("アーカイブを指定してください")
+	}
+
+	opts := archive.DuplicateOptions{}
+	size, err := common.ParseQuerySize(*minSize)
+	if err != nil {
+		return err
+	}
+	opts.MinSize = size
+	if *include != "" {
+		m, err := common.CompilePatterns(strings.Split(*include, ","))
+		if err != nil {
+			return err
+		}
+		opts.Include = m.Match
+	}
+	if *password != "" {
+		opts.OpenEncrypted = func(_ string, f *zip.File) (io.ReadCloser, error) {
+			return zipfmt.OpenEncrypted(f, *password)
+		}
+	}
+	var keep archive.DuplicateKeep
+	switch *keepName {
+	case "first":
+		keep = archive.KeepFirst
+	case "shortest":
+		keep = archive.KeepShortestPath
+	default:
+		return fmt.Errorf("残すものの指定 %q が正しくありません（first、shortest）", *keepName)
+	}
+
+	result, err := archive.FindDuplicates(fs.Args(), opts)
+	if err != nil {
+		return err
+	}
+	for _, skip := range result.Skipped {
+		if skip.Path == "" {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", skip.Archive, skip.Reason)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: %s: %s\n", skip.Archive, skip.Path, skip.Reason)
+		}
+	}
+
+	// 複数のアーカイブを指定した場合はアーカイブのパスも表示する
+	name := func(f archive.DuplicateFile) string {
+		if fs.NArg() > 1 {
+			return f.Archive + ": " + f.Path
+		}
+		return f.Path
+	}
+	files := 0
+	for i := range result.Groups {
+		g := &result.Groups[i]
+		files += len(g.Files)
+		redundant := make(map[archive.DuplicateFile]bool)
+		for _, f := range g.Redundant(keep, *perArchive) {
+			redundant[f] = true
+		}
+		fmt.Printf("%d件 × %d バイト（減らせるサイズ: %d バイト） sha256:%s\n", len(g.Files), g.Size, g.Wasted(), hex.EncodeToString(g.SHA256[:]))
+		for _, f := range g.Files {
+			mark := "残す"
+			if redundant[f] {
+				mark = "重複"
+			}
+			fmt.Printf("\t[%s] %s\n", mark, name(f))
+		}
+	}
+	fmt.Printf("同じ内容のファイル: %d組（%d件）／削除すると減らせるサイズ: %d バイト／調べたファイル: %d件\n",
+		len(result.Groups), files, result.Wasted(), result.Scanned)
+
+	if !*remove {
+		return nil
+	}
+	failed := 0
+	redundant := result.Redundant(keep, *perArchive)
+	for _, archivePath := range fs.Args() {
+		paths, ok := redundant[archivePath]
+		if !ok {
+			continue
+		}
+		if err := removeDuplicates(archivePath, paths); err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %s: %v\n", archivePath, err)
+			failed++
+		}
+		delete(redundant, archivePath)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d件のアーカイブの処理に失敗しました", failed)
+	}
+	return nil
+}
+
+// removeDuplicates はZIPファイルから paths のエントリを削除します
+func removeDuplicates(zipPath string, paths []string) error {
+	format, _, err := archive.Detect(zipPath)
+	if err != nil {
+		return err
+	}
+	if format != archive.FormatZip {
+		return errors.New("エントリを削除できるのはZIPファイルだけです")
+	}
+	remove := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		remove[p] = true
+	}
+
+	removed := 0
+	err = zipfmt.RewriteFile(zipPath, zipfmt.RewriteFileOptions{}, func(zw *zip.Writer, reader *zipfmt.ReadCloser) error {
+		for _, f := range reader.File {
+			if p := archive.CleanPath(f.Name, strings.HasSuffix(f.Name, "/")); remove[p] {
+				fmt.Printf("削除: %s: %s\n", zipPath, p)
+				removed++
+				continue
+			}
+			if err := zipfmt.CopyRaw(zw, f, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d件のエントリを削除しました\n", zipPath, removed)
+	return nil
+}
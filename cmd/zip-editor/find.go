@@ -0,0 +1,170 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"zip-editor/internal/archive"
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// runFind は検索式（サイズ・日時・圧縮方式・暗号化・MIMEタイプなど）に一致するエントリを表示・削除します
+// 検索式の書式は GUI の検索ボックスと同じです（common.ParseQuery）
+func runFind(args []string) error {
+	fs := flag.NewFlagSet("find", flag.ExitOnError)
+	long := fs.Bool("l", false, "サイズ・日時・圧縮方式・MIMEタイプも表示する")
+	count := fs.Bool("c", false, "一致したエントリの件数だけを表示する")
+	remove := fs.Bool("delete", false, "一致したエントリを削除する（ZIPファイルのみ）")
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		return errors.New("アーカイブと検索式を指定してください（例: find a.zip 'size > 50MB and date < 2020'）")
+	}
+	filePath := fs.Arg(0)
+	query, err := common.ParseQuery(strings.Join(fs.Args()[1:], " "))
+	if err != nil {
+		return err
+	}
+
+	format, comp, err := archive.Detect(filePath)
+	if err != nil {
+		return err
+	}
+	var mimeTypes map[string]string
+	if query.UsesField("mime") || *long {
+		if mimeTypes, err = archive.ReadMIMETypes(filePath, format); err != nil {
+			return err
+		}
+	}
+
+	if *remove {
+		if format != archive.FormatZip {
+			return errors.New("エントリを削除できるのはZIPファイルだけです")
+		}
+		removed := 0
+		err := zipfmt.RewriteFile(filePath, zipfmt.RewriteFileOptions{}, func(zw *zip.Writer, reader *zipfmt.ReadCloser) error {
+			for _, f := range reader.File {
+				if e := zipQueryEntry(f, mimeTypes); query.Match(e) {
+					fmt.Println("削除:", e.Path)
+					removed++
+					continue
+				}
+				if err := zipfmt.CopyRaw(zw, f, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d件のエントリを削除しました\n", removed)
+		return nil
+	}
+
+	entries, err := queryEntries(filePath, format, comp, mimeTypes)
+	if err != nil {
+		return err
+	}
+	matched := 0
+	for _, e := range entries {
+		if !query.Match(e) {
+			continue
+		}
+		matched++
+		switch {
+		case *count:
+		case *long:
+			date := ""
+			if !e.Modified.IsZero() {
+				date = e.Modified.Local().Format("2006-01-02 15:04:05")
+			}
+			method := e.Method
+			if e.Encryption != "" {
+				method += "（" + e.Encryption + "）"
+			}
+			mime := ""
+			if !strings.HasSuffix(e.Path, "/") {
+				mime = e.MIME()
+			}
+			fmt.Printf("%12d  %-19s  %-12s  %-24s  %s\n", e.Size, date, method, mime, e.Path)
+		default:
+			fmt.Println(e.Path)
+		}
+	}
+	if *count {
+		fmt.Println(matched)
+	}
+	return nil
+}
+
+// queryEntries はアーカイブのエントリを、検索式で調べる情報の一覧にします
+// GUI のツリーと同じく、ZIPは圧縮方式の表示名、ZIP以外は形式の名前を圧縮方式とします
+func queryEntries(filePath string, format archive.Format, comp archive.Compression, mimeTypes map[string]string) ([]*common.QueryEntry, error) {
+	if format == archive.FormatZip {
+		reader, err := zipfmt.OpenReader(filePath)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		entries := make([]*common.QueryEntry, 0, len(reader.File))
+		for _, f := range reader.File {
+			entries = append(entries, zipQueryEntry(f, mimeTypes))
+		}
+		return entries, nil
+	}
+
+	list, err := archive.ReadEntries(filePath, format)
+	if err != nil {
+		return nil, err
+	}
+	methodText := format.String()
+	if comp != archive.CompressionNone {
+		methodText += "（" + comp.String() + "）"
+	}
+	entries := make([]*common.QueryEntry, 0, len(list))
+	for _, e := range list {
+		entries = append(entries, &common.QueryEntry{
+			Path:     e.Path,
+			Size:     e.Size,
+			Modified: e.Modified,
+			Method:   methodText,
+			Mode:     e.Mode,
+			Owner:    e.Owner(),
+			Comment:  e.Comment,
+			MIME:     mimeFunc(e.Path, mimeTypes),
+		})
+	}
+	return entries, nil
+}
+
+// zipQueryEntry はZIPのエントリを、検索式で調べる情報にします
+func zipQueryEntry(f *zip.File, mimeTypes map[string]string) *common.QueryEntry {
+	name := common.AutoDetectEncoding(f.Name)
+	e := &common.QueryEntry{
+		Path:       name,
+		Size:       int64(f.UncompressedSize64),
+		Modified:   f.Modified,
+		Encryption: zipfmt.EncryptionName(&f.FileHeader),
+		Mode:       f.Mode(),
+		Comment:    common.AutoDetectEncoding(f.Comment),
+		MIME:       mimeFunc(archive.CleanPath(f.Name, strings.HasSuffix(f.Name, "/")), mimeTypes),
+	}
+	if !strings.HasSuffix(name, "/") {
+		e.Method = zipfmt.MethodName(zipfmt.ActualMethod(&f.FileHeader))
+	}
+	return e
+}
+
+// mimeFunc は判定済みのMIMEタイプを返す関数を作成します（判定していない場合は拡張子から判定します）
+func mimeFunc(path string, mimeTypes map[string]string) func() string {
+	return func() string {
+		if t, ok := mimeTypes[path]; ok {
+			return t
+		}
+		return archive.DetectMIMEType(path, nil)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"zip-editor/internal/archive"
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// runGrep はアーカイブ内のファイルの内容を検索し、一致した行を "パス:行番号:内容" の形式で表示します
+// 前後の行は "パス-行番号-内容" の形式で、離れた一致の間は "--" で区切ります（grep と同じ）
+func runGrep(args []string) error {
+	fs := flag.NewFlagSet("grep", flag.ExitOnError)
+	useRegexp := fs.Bool("E", false, "検索する文字列を正規表現として扱う")
+	ignoreCase := fs.Bool("i", false, "大文字・小文字を区別しない")
+	context := fs.Int("C", 0, "一致した行の前後に表示する行数")
+	skipBinary := fs.Bool("I", false, "バイナリファイルを検索しない")
+	filesOnly := fs.Bool("l", false, "一致したファイルのパスだけを表示する")
+	countOnly := fs.Bool("c", false, "ファイルごとに一致した行数だけを表示する")
+	workers := fs.Int("j", 0, "同時に展開・検索するファイルの数（0の場合はCPUの数）")
+	include := fs.String("include", "", "検索するファイルのパターン（カンマ区切り、例: *.txt,src/）")
+	password := fs.String("password", "", "暗号化されたエントリのパスワード")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("アーカイブと検索する文字列を指定してください")
+	}
+	filePath, pattern := fs.Arg(0), fs.Arg(1)
+
+	matcher, err := common.CompileContentSearch(common.ContentSearchOptions{
+		Pattern:    pattern,
+		Regexp:     *useRegexp,
+		IgnoreCase: *ignoreCase,
+		Context:    *context,
+	})
+	if err != nil {
+		return err
+	}
+	opts := archive.SearchOptions{Matcher: matcher, SkipBinary: *skipBinary, Workers: *workers}
+	if *include != "" {
+		m, err := common.CompilePatterns(strings.Split(*include, ","))
+		if err != nil {
+			return err
+		}
+		opts.Include = m.Match
+	}
+	if *password != "" {
+		opts.OpenEncrypted = func(f *zip.File) (io.ReadCloser, error) {
+			return zipfmt.OpenEncrypted(f, *password)
+		}
+	}
+
+	format, _, err := archive.Detect(filePath)
+	if err != nil {
+		return err
+	}
+	result, err := archive.SearchContent(filePath, format, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, hit := range result.Hits {
+		switch {
+		case *filesOnly:
+			fmt.Println(hit.Path)
+		case *countOnly:
+			fmt.Printf("%s:%d\n", hit.Path, len(hit.Matches))
+		case hit.Binary:
+			fmt.Printf("バイナリファイル %s が一致しました\n", hit.Path)
+		default:
+			printGrepHit(hit)
+		}
+	}
+	for _, skip := range result.Skipped {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", skip.Path, skip.Reason)
+	}
+	if len(result.Hits) == 0 {
+		// grep と同じく、一致しなかった場合は終了コードを1にする
+		return errors.New("一致するファイルはありませんでした")
+	}
+	return nil
+}
+
+// printGrepHit は一致したファイルの行を表示します
+func printGrepHit(hit archive.SearchHit) {
+	prev := 0
+	for _, m := range hit.Matches {
+		first := m.Line
+		if len(m.Before) > 0 {
+			first = m.Before[0].Line
+		}
+		if prev > 0 && first > prev+1 {
+			fmt.Println("--")
+		}
+		for _, l := range m.Before {
+			fmt.Printf("%s-%d-%s\n", hit.Path, l.Line, l.Text)
+		}
+		fmt.Printf("%s:%d:%s\n", hit.Path, m.Line, m.Text)
+		prev = m.Line
+		for _, l := range m.After {
+			fmt.Printf("%s-%d-%s\n", hit.Path, l.Line, l.Text)
+			prev = l.Line
+		}
+	}
+	if hit.Truncated {
+		fmt.Fprintf(os.Stderr, "%s: 一致した行が多いため、先頭の%d件だけを表示しました\n", hit.Path, common.MaxContentMatches)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runGUI はGUIを使えない環境（WalkはWindows専用）では、サブコマンドの一覧を表示して終了します
+func runGUI() {
+	fmt.Fprintln(os.Stderr, "GUIはWindowsでのみ使用できます")
+	fmt.Fprintln(os.Stderr)
+	printUsage()
+	os.Exit(2)
+}
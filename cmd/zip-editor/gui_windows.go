@@ -0,0 +1,10 @@
+package main
+
+import (
+	"zip-editor/internal/gui"
+)
+
+// runGUI はメインウィンドウを作成して表示します
+func runGUI() {
+	gui.CreateMainWindow()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"zip-editor/internal/archive"
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// runInfo はアーカイブの形式・エントリ数・先頭に付加されたデータなどの情報を表示します
+func runInfo(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("情報を表示するアーカイブを指定してください")
+	}
+	for i, path := range fs.Args() {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := printInfo(path); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// printInfo はひとつのアーカイブの情報を表示します
+func printInfo(path string) error {
+	format, comp, err := archive.Detect(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("ファイル: %s\n", path)
+	if format != archive.FormatZip {
+		entries, err := archive.ReadEntries(path, format)
+		if err != nil {
+			return err
+		}
+		if comp != archive.CompressionNone {
+			fmt.Printf("形式: %s（圧縮: %s）\n", format, comp)
+		} else {
+			fmt.Printf("形式: %s\n", format)
+		}
+		var files int
+		var size int64
+		for _, e := range entries {
+			if !e.IsDir() {
+				files++
+				size += e.Size
+			}
+		}
+		fmt.Printf("エントリ: %d件（ファイル %d件、展開後の合計 %d バイト）\n", len(entries), files, size)
+		return nil
+	}
+
+	reader, err := zipfmt.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	fmt.Println("形式: ZIP")
+	var files int
+	var size, compressed int64
+	for _, f := range reader.File {
+		if !strings.HasSuffix(f.Name, "/") {
+			files++
+			size += int64(f.UncompressedSize64)
+			compressed += int64(f.CompressedSize64)
+		}
+	}
+	fmt.Printf("エントリ: %d件（ファイル %d件、展開後の合計 %d バイト、圧縮後 %d バイト）\n", len(reader.File), files, size, compressed)
+	if reader.Volumes != nil {
+		fmt.Printf("分割アーカイブ: %dボリューム\n", len(reader.Volumes))
+	}
+
+	prefix, err := reader.Prefix()
+	if err != nil {
+		return err
+	}
+	if prefix.Size > 0 {
+		adjusted := "ZIPのデータ先頭から"
+		if prefix.Adjusted {
+			adjusted = "ファイル先頭から"
+		}
+		fmt.Printf("先頭のデータ: %d バイト（%s、エントリの位置は%s記録）\n", prefix.Size, prefix.Kind, adjusted)
+	}
+	if prefix.SigningBlockSize > 0 {
+		fmt.Printf("APK署名ブロック: %d バイト（書き直すと削除されます）\n", prefix.SigningBlockSize)
+	}
+	if reader.Comment != "" {
+		fmt.Printf("コメント: %s\n", common.AutoDetectEncoding(reader.Comment))
+	}
+	return nil
+}
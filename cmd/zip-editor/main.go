@@ -1,10 +1,49 @@
+// zip-editor はZIPファイルの中身を表示・編集するツールです。
+// 引数を付けずに実行するとGUI（Windowsのみ）を起動し、サブコマンドを付けて実行するとGUIと同じ機能の一部をコマンドラインから使えます。
+// コマンドラインの機能はGUIに依存しないため、スクリプトやWindows以外の環境からも実行できます。
+//
+// 使い方:
+//
+//	zip-editor <サブコマンド> [オプション] 引数...
+//	zip-editor convert [-method deflate] [-level 0] [-strict] 変換元 変換先
+//	zip-editor split [-size 100M] 入力.zip 分割先.zip
+//	zip-editor join 分割.zip 結合先.zip
+//	zip-editor info アーカイブ...
+//	zip-editor comment [-entry パス] [-set コメント | -file ファイル | -clear] [-encoding utf-8] 入力.zip
+//	zip-editor touch [-list | -time 日時 | -now | -shift 時間 | -newest] 入力.zip [パス...]
+//	zip-editor chmod [-list | -mode パーミッション [-scripts] | -dos 属性 | -host unix|fat] 入力.zip [パス...]
+//	zip-editor normalize [-time 日時] [-level 9] [-first パス,...] 入力.zip
+//	zip-editor order [-list | -by original|path|size [-desc] [-first パス,...] [-from ファイル] [-preset epub|jar]] 入力.zip
+//	zip-editor clean [-profile macos,windows] [-n] [-list] 入力.zip...
+//	zip-editor find [-l | -c | -delete] アーカイブ 検索式...
+//	zip-editor grep [-E] [-i] [-C 行数] [-I] [-l | -c] [-j 並列数] [-include パターン,...] [-password パスワード] アーカイブ 文字列
+//	zip-editor diff [-json] [-stat] [-C 行数] [-max-text サイズ] [-password パスワード] 古いアーカイブ 新しいアーカイブ
+//	zip-editor mkpatch [-o パッチ] 古いアーカイブ 新しいアーカイブ
+//	zip-editor patch [-o 出力先] 古いアーカイブ パッチ | patch -info パッチ
+//	zip-editor dupes [-min サイズ] [-include パターン,...] [-keep first|shortest] [-per-archive] [-delete] [-password パスワード] アーカイブ...
+//	zip-editor rm [-n] [-from ファイル] 入力.zip パターン...
+//	zip-editor stub [-strip | -replace スタブ | -extract 書き出し先] [-o 出力先] 入力.zip
 package main
 
 import (
-	"zip-editor/internal/gui"
+	"fmt"
+	"os"
 )
 
 func main() {
-	// メインウィンドウを作成して表示
-	gui.CreateMainWindow()
+	// サブコマンドを付けずに実行した場合はGUIを起動する
+	if len(os.Args) < 2 {
+		runGUI()
+		return
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "不明なサブコマンドです: %s\n\n", os.Args[1])
+		printUsage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "エラー:", err)
+		os.Exit(1)
+	}
 }
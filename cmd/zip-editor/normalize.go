@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"zip-editor/internal/zipfmt"
+)
+
+// runNormalize はZIPファイルを、同じ内容から常に同じバイト列になるように正規化します
+func runNormalize(args []string) error {
+	fs := flag.NewFlagSet("normalize", flag.ExitOnError)
+	timeText := fs.String("time", "", "すべてのエントリに設定する日時（省略時は SOURCE_DATE_EPOCH、未設定なら 1980-01-01 00:00:00 UTC）")
+	level := fs.Int("level", zipfmt.DefaultNormalizeLevel, "Deflateの圧縮レベル（1〜9）")
+	firstList := fs.String("first", "", "パスの順より前に置くエントリ（カンマ区切り、例: mimetype）")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("ZIPファイルをひとつ指定してください")
+	}
+	zipPath := fs.Arg(0)
+
+	opts := zipfmt.NormalizeOptions{Level: *level, First: zipfmt.ParseOrderList(*firstList)}
+	var err error
+	if *timeText != "" {
+		opts.Time, err = parseTime(*timeText)
+	} else {
+		opts.Time, err = zipfmt.SourceDateEpoch()
+	}
+	if err != nil {
+		return err
+	}
+
+	// 元のファイルを2回正規化して同じバイト列になった場合にだけ、元のファイルを置き換える
+	sum, entries, err := zipfmt.NormalizeFile(zipPath, opts, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("正規化したエントリ: %d件\n", entries)
+	fmt.Printf("SHA-256: %s\n", sum)
+	fmt.Println("2回正規化して同じ内容になることを確認しました")
+	return nil
+}
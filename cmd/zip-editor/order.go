@@ -0,0 +1,87 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// orderPresets はコマンドラインで指定できる、形式ごとの先頭に置くエントリの名前です（zipfmt.OrderPresets と同じ順）
+var orderPresets = []string{"epub", "jar"}
+
+// runOrder はZIPファイルのエントリの格納順を表示・変更します
+func runOrder(args []string) error {
+	fs := flag.NewFlagSet("order", flag.ExitOnError)
+	list := fs.Bool("list", false, "変更せずに、エントリを格納順に表示する")
+	by := fs.String("by", "original", "並べ方（original: 元の順序、path: パスの順、size: サイズの順）")
+	desc := fs.Bool("desc", false, "-by の順序を逆にする")
+	first := fs.String("first", "", "先頭に置くエントリのパス（カンマ区切り）")
+	from := fs.String("from", "", "先頭に置くエントリのパスを1行にひとつずつ書いたファイル（\"-\"で標準入力、手動の並べ替えに使う）")
+	preset := fs.String("preset", "", "形式の決まりに合わせる（"+strings.Join(orderPresets, "、")+"）")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("ZIPファイルをひとつ指定してください")
+	}
+	zipPath := fs.Arg(0)
+	if *list {
+		return listOrder(zipPath)
+	}
+
+	mode, err := zipfmt.ParseOrderMode(*by)
+	if err != nil {
+		return err
+	}
+	order := zipfmt.EntryOrder{Mode: mode, Descending: *desc}
+	if *preset != "" {
+		found := false
+		for i, name := range orderPresets {
+			if strings.EqualFold(*preset, name) {
+				order.First = append(order.First, zipfmt.OrderPresets[i].First...)
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("不明な形式です: %s（%s のいずれか）", *preset, strings.Join(orderPresets, "、"))
+		}
+	}
+	order.First = append(order.First, zipfmt.ParseOrderList(*first)...)
+	if *from != "" {
+		text, err := readTextFile(*from)
+		if err != nil {
+			return err
+		}
+		order.First = append(order.First, zipfmt.ParseOrderList(text)...)
+	}
+
+	err = zipfmt.RewriteFile(zipPath, zipfmt.RewriteFileOptions{}, func(zw *zip.Writer, reader *zipfmt.ReadCloser) error {
+		for _, f := range zipfmt.OrderFiles(reader.File, order) {
+			if err := zipfmt.CopyRaw(zw, f, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return listOrder(zipPath)
+}
+
+// listOrder はエントリを格納順に表示します
+func listOrder(zipPath string) error {
+	reader, err := zipfmt.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for i, f := range reader.File {
+		fmt.Printf("%5d  %12d  %s\n", i+1, f.UncompressedSize64, common.AutoDetectEncoding(f.Name))
+	}
+	return nil
+}
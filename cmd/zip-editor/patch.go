@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"zip-editor/internal/zipfmt"
+)
+
+// runMkpatch は古いアーカイブを新しいアーカイブに更新するパッチを作成します
+// 変わっていないエントリは古いアーカイブからコピーするため、パッチには変わった部分だけが入ります
+func runMkpatch(args []string) error {
+	fs := flag.NewFlagSet("mkpatch", flag.ExitOnError)
+	output := fs.String("o", "", "パッチの保存先（省略時は 新しいアーカイブ名.zpatch）")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("古いアーカイブと新しいアーカイブを指定してください")
+	}
+	oldPath, newPath := fs.Arg(0), fs.Arg(1)
+	patchPath := *output
+	if patchPath == "" {
+		patchPath = strings.TrimSuffix(newPath, filepath.Ext(newPath)) + ".zpatch"
+	}
+	for _, src := range []string{oldPath, newPath} {
+		if err := checkDifferentPaths(src, patchPath); err != nil {
+			return err
+		}
+	}
+
+	info, err := zipfmt.CreatePatchFile(oldPath, newPath, patchPath)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(patchPath)
+	if err != nil {
+		return err
+	}
+	printPatchInfo(info)
+	fmt.Printf("パッチ:   %s（%d バイト）\n", patchPath, fi.Size())
+	return nil
+}
+
+// runPatch は古いアーカイブにパッチを適用し、新しいアーカイブを作成します
+// 適用の前後にファイル全体のSHA-256を確かめ、一致しない場合は何も書き込みません
+func runPatch(args []string) error {
+	fs := flag.NewFlagSet("patch", flag.ExitOnError)
+	output := fs.String("o", "", "新しいアーカイブの保存先（省略時は古いアーカイブを置き換える）")
+	infoOnly := fs.Bool("info", false, "パッチの内容を表示するだけで適用しない（古いアーカイブは指定しない）")
+	fs.Parse(args)
+
+	if *infoOnly {
+		if fs.NArg() != 1 {
+			return errors.New("パッチを指定してください")
+		}
+		info, err := zipfmt.ReadPatchInfo(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		printPatchInfo(info)
+		return nil
+	}
+
+	if fs.NArg() != 2 {
+		return errors.New("古いアーカイブとパッチを指定してください")
+	}
+	oldPath, patchPath := fs.Arg(0), fs.Arg(1)
+	outPath := *output
+	if outPath == "" {
+		outPath = oldPath
+	}
+	if err := checkDifferentPaths(patchPath, outPath); err != nil {
+		return err
+	}
+
+	info, err := zipfmt.ApplyPatchFile(oldPath, patchPath, outPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("パッチを適用し、%s に書き込みました（%d バイト、SHA-256: %s）\n", outPath, info.NewSize, hex.EncodeToString(info.NewSHA256[:]))
+	return nil
+}
+
+// printPatchInfo はパッチの内容の概要を表示します
+func printPatchInfo(info *zipfmt.PatchInfo) {
+	fmt.Printf("古い版:   %d バイト  SHA-256: %s\n", info.OldSize, hex.EncodeToString(info.OldSHA256[:]))
+	fmt.Printf("新しい版: %d バイト  SHA-256: %s\n", info.NewSize, hex.EncodeToString(info.NewSHA256[:]))
+	fmt.Printf("古い版からコピー: %d バイト、パッチに含めた部分: %d バイト（操作 %d 個）\n", info.Copied, info.Inserted, info.Ops)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"flag"
+	"fmt"
+
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// runRm はパターンに一致するエントリをZIPファイルから削除します
+func runRm(args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ExitOnError)
+	dryRun := fs.Bool("n", false, "削除せずに、一致するエントリと件数だけを表示する")
+	from := fs.String("from", "", "パターンを1行にひとつずつ書いたファイル（\"-\"で標準入力）")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		return errors.New("ZIPファイルを指定してください")
+	}
+	zipPath := fs.Arg(0)
+
+	patterns := fs.Args()[1:]
+	if *from != "" {
+		text, err := readTextFile(*from)
+		if err != nil {
+			return err
+		}
+		patterns = append(patterns, common.ParsePatternList(text)...)
+	}
+	if len(patterns) == 0 {
+		return errors.New("削除するエントリのパターンを指定してください")
+	}
+	matcher, err := common.CompilePatterns(patterns)
+	if err != nil {
+		return err
+	}
+
+	return removeMatching(zipPath, matcher, *dryRun)
+}
+
+// removeMatching はパターンに一致するエントリをZIPファイルから削除します
+// dryRun の場合は削除せずに、一致するエントリと件数だけを表示します
+func removeMatching(zipPath string, matcher *common.PathMatcher, dryRun bool) error {
+	if dryRun {
+		reader, err := zipfmt.OpenReader(zipPath)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		count := 0
+		for _, f := range reader.File {
+			if name := common.AutoDetectEncoding(f.Name); matcher.Match(name) {
+				fmt.Println(name)
+				count++
+			}
+		}
+		fmt.Printf("%d件のエントリが一致しました（削除していません）\n", count)
+		return nil
+	}
+
+	removed := 0
+	err := zipfmt.RewriteFile(zipPath, zipfmt.RewriteFileOptions{}, func(zw *zip.Writer, reader *zipfmt.ReadCloser) error {
+		for _, f := range reader.File {
+			if name := common.AutoDetectEncoding(f.Name); matcher.Match(name) {
+				fmt.Println("削除:", name)
+				removed++
+				continue
+			}
+			if err := zipfmt.CopyRaw(zw, f, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d件のエントリを削除しました\n", removed)
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"zip-editor/internal/zipfmt"
+)
+
+// runSplit はZIPファイルを指定したサイズのボリュームに分割します
+func runSplit(args []string) error {
+	fs := flag.NewFlagSet("split", flag.ExitOnError)
+	sizeText := fs.String("size", "100M", "ボリュームのサイズ（例: 100M、650MB、1.5G）")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("分割するZIPファイルと分割先（最後のボリュームの .zip）を指定してください")
+	}
+	src, dst := fs.Arg(0), fs.Arg(1)
+	if err := checkDifferentPaths(src, dst); err != nil {
+		return err
+	}
+	volumeSize, err := zipfmt.ParseVolumeSize(*sizeText)
+	if err != nil {
+		return err
+	}
+
+	// 分割アーカイブを別のサイズで分割し直す場合は、ひとつのZIPファイルとして読み取る
+	r, size, closer, err := openLogical(src)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	volumes, err := zipfmt.WriteSplit(r, size, dst, volumeSize)
+	if err != nil {
+		return err
+	}
+	if len(volumes) == 1 {
+		fmt.Printf("ボリュームのサイズに収まるため、分割せずに %s に書き込みました\n", dst)
+		return nil
+	}
+	fmt.Printf("%d個のボリュームに分割しました:\n", len(volumes))
+	for _, v := range volumes {
+		fmt.Println("  " + v)
+	}
+	return nil
+}
+
+// runJoin は分割アーカイブをひとつのZIPファイルに結合します
+func runJoin(args []string) error {
+	fs := flag.NewFlagSet("join", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("分割アーカイブ（最後のボリュームの .zip）と結合先を指定してください")
+	}
+	src, dst := fs.Arg(0), fs.Arg(1)
+	if err := checkDifferentPaths(src, dst); err != nil {
+		return err
+	}
+
+	volumes, err := zipfmt.SplitVolumes(src)
+	if err != nil {
+		return err
+	}
+	if volumes == nil {
+		return fmt.Errorf("%s は分割アーカイブではありません", src)
+	}
+	if err := zipfmt.JoinSplit(volumes, dst); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	fmt.Printf("%d個のボリュームを %s に結合しました\n", len(volumes), dst)
+	return nil
+}
+
+// openLogical はZIPファイルを、分割アーカイブの場合はすべてのボリュームを連結したひとつのファイルとして開きます
+func openLogical(path string) (io.ReaderAt, int64, io.Closer, error) {
+	volumes, err := zipfmt.SplitVolumes(path)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if volumes != nil {
+		sr, err := zipfmt.OpenSplit(volumes)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		return sr, sr.Size(), sr, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, nil, err
+	}
+	return f, fi.Size(), f, nil
+}
+
+// checkDifferentPaths は入力と出力に同じファイルが指定されていないことを確認します
+func checkDifferentPaths(src, dst string) error {
+	absSrc, err1 := filepath.Abs(src)
+	absDst, err2 := filepath.Abs(dst)
+	if err1 == nil && err2 == nil && strings.EqualFold(absSrc, absDst) {
+		return errors.New("出力先に入力と同じファイルは指定できません")
+	}
+	return nil
+}
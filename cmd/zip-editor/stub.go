@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// runStub はZIPファイルの先頭に付加されたデータ（自己解凍スタブなど）を置き換える・取り除く・取り出します
+func runStub(args []string) error {
+	fs := flag.NewFlagSet("stub", flag.ExitOnError)
+	strip := fs.Bool("strip", false, "先頭のデータを取り除いて通常のZIPファイルにする")
+	replace := fs.String("replace", "", "先頭のデータをこのファイルの内容で置き換える")
+	extract := fs.String("extract", "", "先頭のデータをこのファイルに書き出す")
+	output := fs.String("o", "", "書き込み先（省略した場合は元のファイルを置き換える）")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("ZIPファイルを指定してください")
+	}
+	src := fs.Arg(0)
+
+	r, size, closer, err := openLogical(src)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	if *extract != "" {
+		if err := checkDifferentPaths(src, *extract); err != nil {
+			return err
+		}
+		return extractStub(r, size, *extract)
+	}
+
+	var stub io.Reader
+	switch {
+	case *strip && *replace != "":
+		return errors.New("-strip と -replace は同時に指定できません")
+	case *replace != "":
+		f, err := os.Open(*replace)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		stub = f
+	case !*strip:
+		return errors.New("-strip、-replace、-extract のいずれかを指定してください")
+	}
+
+	dst := *output
+	if dst == "" {
+		dst = src
+	}
+	// 元のファイルを置き換える場合に備えて、同じディレクトリの一時ファイルに書き込んでから名前を変更する
+	err = common.ReplaceFile(dst, func(tmp *os.File) error {
+		if err := zipfmt.WriteWithStub(tmp, r, size, stub); err != nil {
+			return err
+		}
+		return closer.Close()
+	})
+	if err != nil {
+		return err
+	}
+	if *strip {
+		fmt.Printf("先頭のデータを取り除いて %s に書き込みました\n", dst)
+	} else {
+		fmt.Printf("先頭のデータを %s の内容で置き換えて %s に書き込みました\n", *replace, dst)
+	}
+	return nil
+}
+
+// extractStub は先頭に付加されたデータをファイルに書き出します
+func extractStub(r io.ReaderAt, size int64, dst string) error {
+	prefix, err := zipfmt.ReadPrefix(r, size)
+	if err != nil {
+		return err
+	}
+	if prefix.Size == 0 {
+		return errors.New("先頭にデータは付加されていません")
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, io.NewSectionReader(r, 0, prefix.Size)); err != nil {
+		return err
+	}
+	fmt.Printf("先頭のデータ（%s、%d バイト）を %s に書き出しました\n", prefix.Kind, prefix.Size, dst)
+	return out.Close()
+}
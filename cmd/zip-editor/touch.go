@@ -0,0 +1,131 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// runTouch はエントリの更新日時を表示・変更します
+func runTouch(args []string) error {
+	fs := flag.NewFlagSet("touch", flag.ExitOnError)
+	list := fs.Bool("list", false, "変更せずに、エントリの更新日時と記録されている場所を表示する")
+	timeText := fs.String("time", "", "指定した日時にする（\"2006-01-02 15:04:05\"、RFC 3339、\"@Unix時刻\"）")
+	now := fs.Bool("now", false, "現在の日時にする")
+	shift := fs.String("shift", "", "指定した時間だけずらす（例: +9h、-1d、30m）")
+	newest := fs.Bool("newest", false, "フォルダを中の最も新しいファイルの日時にする")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		return errors.New("ZIPファイルを指定してください")
+	}
+	zipPath := fs.Arg(0)
+
+	// パスを指定した場合は、そのエントリ（フォルダの場合は中のエントリを含む）だけを対象にする
+	var match func(name string) bool
+	if fs.NArg() > 1 {
+		match = zipfmt.SubtreeMatcher(fs.Args()[1:])
+	}
+	if *list {
+		return listTimes(zipPath, match)
+	}
+
+	var edit zipfmt.TimeEdit
+	modes := 0
+	if *timeText != "" {
+		t, err := parseTime(*timeText)
+		if err != nil {
+			return err
+		}
+		edit = zipfmt.TimeEdit{Mode: zipfmt.TimeFixed, Time: t}
+		modes++
+	}
+	if *now {
+		edit = zipfmt.TimeEdit{Mode: zipfmt.TimeNow}
+		modes++
+	}
+	if *shift != "" {
+		offset, err := zipfmt.ParseTimeOffset(*shift)
+		if err != nil {
+			return err
+		}
+		edit = zipfmt.TimeEdit{Mode: zipfmt.TimeShift, Offset: offset}
+		modes++
+	}
+	if *newest {
+		edit = zipfmt.TimeEdit{Mode: zipfmt.TimeNewestChild}
+		modes++
+	}
+	if modes != 1 {
+		return errors.New("-list、-time、-now、-shift、-newest のいずれかひとつを指定してください")
+	}
+
+	changed := 0
+	err := zipfmt.RewriteFile(zipPath, zipfmt.RewriteFileOptions{}, func(zw *zip.Writer, reader *zipfmt.ReadCloser) error {
+		planned := zipfmt.PlanModTimes(reader.File, match, edit)
+		for _, f := range reader.File {
+			header := f.FileHeader
+			if t, ok := planned[f]; ok {
+				if err := zipfmt.SetModTime(&header, t); err != nil {
+					fmt.Printf("変更できません: %s: %v\n", common.AutoDetectEncoding(f.Name), err)
+				} else {
+					changed++
+				}
+			}
+			if err := zipfmt.CopyRaw(zw, f, &header); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d件のエントリの日時を変更しました\n", changed)
+	return nil
+}
+
+// parseTime は日時の指定を解釈します。タイムゾーンのない形式はローカルの日時として扱います
+func parseTime(s string) (time.Time, error) {
+	if unix, ok := strings.CutPrefix(s, "@"); ok {
+		n, err := strconv.ParseInt(unix, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Unix時刻の指定が正しくありません: %s", s)
+		}
+		return time.Unix(n, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006/01/02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("日時の指定が正しくありません: %s", s)
+}
+
+// listTimes はエントリの更新日時と、日時が記録されている場所を表示します
+func listTimes(zipPath string, match func(name string) bool) error {
+	reader, err := zipfmt.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, f := range reader.File {
+		name := common.AutoDetectEncoding(f.Name)
+		if match != nil && !match(name) {
+			continue
+		}
+		sources := strings.Join(zipfmt.TimeSources(&f.FileHeader), "・")
+		fmt.Printf("%s  %-14s %s\n", f.Modified.Format("2006-01-02 15:04:05 -07:00"), sources, name)
+	}
+	return nil
+}
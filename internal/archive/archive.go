@@ -0,0 +1,296 @@
+// Package archive はZIP以外を含むアーカイブ形式の判定と、形式に依存しないエントリの読み取りを扱います
+// ZIPの読み書きは zipfmt パッケージが担当し、このパッケージはそれ以外の形式（tar系、読み取り専用の7z・RAR）を扱います
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"zip-editor/internal/common"
+)
+
+// Format はアーカイブの形式です
+type Format int
+
+const (
+	FormatZip Format = iota
+	FormatTar
+	FormatSevenZip // 7z（読み取り専用）
+	FormatRar      // RAR（読み取り専用）
+)
+
+// String は形式の表示名を返します
+func (f Format) String() string {
+	switch f {
+	case FormatZip:
+		return "ZIP"
+	case FormatTar:
+		return "tar"
+	case FormatSevenZip:
+		return "7z"
+	case FormatRar:
+		return "RAR"
+	}
+	return "不明"
+}
+
+// Writable は削除フラグを反映して書き直すことのできる形式かどうかを返します
+func (f Format) Writable() bool {
+	return f == FormatZip || f == FormatTar
+}
+
+// Compression はアーカイブ全体にかかるストリームの圧縮方式です（tar.gz など）
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionBzip2
+	CompressionXZ
+	CompressionZstd
+)
+
+// String は圧縮方式の表示名を返します
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "なし"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionBzip2:
+		return "bzip2"
+	case CompressionXZ:
+		return "XZ"
+	case CompressionZstd:
+		return "Zstandard"
+	}
+	return "不明"
+}
+
+// ErrUnsupportedFormat は対応していない形式のアーカイブに対して操作を行おうとした場合のエラーです
+var ErrUnsupportedFormat = errors.New("この形式のアーカイブでは、この操作を行えません")
+
+// Entry はアーカイブ内のエントリの、形式に依存しない情報です
+type Entry struct {
+	Path     string      // UTF-8に変換して正規化したパス（ディレクトリは末尾が"/"）
+	Size     int64       // 展開後のサイズ
+	Modified time.Time   // 更新日時
+	Mode     fs.FileMode // 種類（ディレクトリ・シンボリックリンクなど）とパーミッション
+	Linkname string      // シンボリックリンク・ハードリンクの参照先
+	Hardlink bool        // ハードリンクかどうか
+	Uid      int
+	Gid      int
+	Uname    string
+	Gname    string
+	Comment  string // エントリのコメント（ZIPのみ）
+	// Encrypted は暗号化されているため内容を読み取れないことを示します（ZIP・RARのみ）
+	Encrypted bool
+	// Solid はソリッド圧縮されており、同じブロックの前のエントリから順に展開する必要があることを示します（7z・RARのみ）
+	Solid bool
+	Block int // ソリッドブロックの番号（Solid の場合のみ有効）
+
+	header *tar.Header // tarから読み込んだ場合の元のヘッダー（tarへの変換で引き継ぐ）
+}
+
+// IsDir はディレクトリかどうかを返します
+func (e *Entry) IsDir() bool {
+	return strings.HasSuffix(e.Path, "/")
+}
+
+// Owner は所有者の表示用の文字列（"ユーザー/グループ"）を返します
+// 名前が記録されていない場合はIDを使用します
+func (e *Entry) Owner() string {
+	user, group := e.Uname, e.Gname
+	if user == "" {
+		user = strconv.Itoa(e.Uid)
+	}
+	if group == "" {
+		group = strconv.Itoa(e.Gid)
+	}
+	return user + "/" + group
+}
+
+// 拡張子ごとの形式と圧縮方式（複数の拡張子からなるものを先に判定する）
+var formatExts = []struct {
+	ext    string
+	format Format
+	comp   Compression
+}{
+	{".tar.gz", FormatTar, CompressionGzip},
+	{".tar.bz2", FormatTar, CompressionBzip2},
+	{".tar.xz", FormatTar, CompressionXZ},
+	{".tar.zst", FormatTar, CompressionZstd},
+	{".tgz", FormatTar, CompressionGzip},
+	{".tbz", FormatTar, CompressionBzip2},
+	{".tbz2", FormatTar, CompressionBzip2},
+	{".txz", FormatTar, CompressionXZ},
+	{".tzst", FormatTar, CompressionZstd},
+	{".tar", FormatTar, CompressionNone},
+	{".zip", FormatZip, CompressionNone},
+	{".7z", FormatSevenZip, CompressionNone},
+	{".7z.001", FormatSevenZip, CompressionNone},
+	{".rar", FormatRar, CompressionNone},
+}
+
+// FormatFromName はファイル名の拡張子から、アーカイブの形式とストリームの圧縮方式を判定します
+// 対応していない拡張子の場合は ok がfalseになります
+func FormatFromName(name string) (format Format, comp Compression, ok bool) {
+	lower := strings.ToLower(name)
+	for _, fe := range formatExts {
+		if strings.HasSuffix(lower, fe.ext) {
+			return fe.format, fe.comp, true
+		}
+	}
+	return FormatZip, CompressionNone, false
+}
+
+// TrimExt はファイル名から、アーカイブの形式を示す拡張子（.tar.gz などを含む）を取り除きます
+func TrimExt(name string) string {
+	lower := strings.ToLower(name)
+	for _, fe := range formatExts {
+		if strings.HasSuffix(lower, fe.ext) && len(name) > len(fe.ext) {
+			return name[:len(name)-len(fe.ext)]
+		}
+	}
+	return name
+}
+
+// IsSupportedName はファイル名の拡張子が開くことのできるアーカイブを示すかどうかを返します
+func IsSupportedName(name string) bool {
+	_, _, ok := FormatFromName(name)
+	return ok
+}
+
+// Detect はファイルの先頭を調べてアーカイブの形式とストリームの圧縮方式を判定します
+// 7z・RAR・tarとして判定できない場合は、先頭に実行ファイルなどが付いたものも含めてZIPとして扱います
+func Detect(filePath string) (Format, Compression, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return FormatZip, CompressionNone, err
+	}
+	defer f.Close()
+
+	head := make([]byte, tarBlockSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return FormatZip, CompressionNone, err
+	}
+	head = head[:n]
+	if strings.HasPrefix(string(head), "PK") {
+		return FormatZip, CompressionNone, nil
+	}
+	if format, ok := detectSignature(head); ok {
+		return format, CompressionNone, nil
+	}
+
+	comp := detectCompression(head)
+	if comp == CompressionNone {
+		if isTarHeader(head) {
+			return FormatTar, CompressionNone, nil
+		}
+		return FormatZip, CompressionNone, nil
+	}
+
+	// 圧縮されている場合は、展開した先頭のブロックがtarのヘッダーかどうかを確認する
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return FormatZip, CompressionNone, err
+	}
+	rc, err := newDecompressor(f, comp)
+	if err != nil {
+		return FormatZip, CompressionNone, err
+	}
+	defer rc.Close()
+	block := make([]byte, tarBlockSize)
+	if _, err := io.ReadFull(rc, block); err != nil || !isTarHeader(block) {
+		return FormatZip, comp, errors.New("圧縮されたファイルの中身がtar形式ではありません")
+	}
+	return FormatTar, comp, nil
+}
+
+// 先頭のシグネチャで判定できる形式
+var formatSignatures = []struct {
+	magic  []byte
+	format Format
+}{
+	{[]byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}, FormatSevenZip},
+	{[]byte("Rar!\x1a\x07"), FormatRar}, // RAR 1.5〜4.x と RAR5 で共通の先頭部分
+}
+
+// detectSignature は先頭のバイト列から7z・RARの形式を判定します
+func detectSignature(head []byte) (Format, bool) {
+	for _, s := range formatSignatures {
+		if bytes.HasPrefix(head, s.magic) {
+			return s.format, true
+		}
+	}
+	return FormatZip, false
+}
+
+// Walk はアーカイブのエントリを先頭から順に fn に渡します
+// r はエントリのデータを読み取るリーダーで、fn から戻るまでの間だけ有効です
+// シンボリックリンクのデータ（参照先）は Entry.Linkname に読み込み済みのため、r からは読み取れません
+func Walk(filePath string, format Format, fn func(e *Entry, r io.Reader) error) error {
+	switch format {
+	case FormatZip:
+		return walkZip(filePath, fn)
+	case FormatTar:
+		return walkTar(filePath, fn)
+	case FormatSevenZip:
+		return walkSevenZip(filePath, fn)
+	case FormatRar:
+		return walkRar(filePath, fn)
+	}
+	return ErrUnsupportedFormat
+}
+
+// ReadEntries はZIP以外の形式のアーカイブのエントリ一覧を読み込みます
+func ReadEntries(filePath string, format Format) ([]*Entry, error) {
+	switch format {
+	case FormatTar:
+		return readTarEntries(filePath)
+	case FormatSevenZip:
+		return readSevenZipEntries(filePath)
+	case FormatRar:
+		return readRarEntries(filePath)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// OpenEntry はアーカイブ内のエントリを読み取るリーダーを返します
+// entryPath は Entry.Path と同じ正規化したパスです
+func OpenEntry(filePath string, format Format, entryPath string) (io.ReadCloser, error) {
+	switch format {
+	case FormatZip:
+		return openZipEntry(filePath, entryPath)
+	case FormatTar:
+		return openTarEntry(filePath, entryPath)
+	case FormatSevenZip:
+		return openSevenZipEntry(filePath, entryPath)
+	case FormatRar:
+		return openRarEntry(filePath, entryPath)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// CleanPath はアーカイブ内の名前をUTF-8に変換し、先頭の"./"や"/"を取り除いて正規化します
+// ディレクトリの場合は末尾を"/"にします。アーカイブのルートを示す名前の場合は空文字列を返します
+func CleanPath(name string, isDir bool) string {
+	name = common.AutoDetectEncoding(name)
+	name = path.Clean("/" + name)
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		return ""
+	}
+	if isDir {
+		name += "/"
+	}
+	return name
+}
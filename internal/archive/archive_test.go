@@ -0,0 +1,96 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testFile はテスト用のアーカイブに格納するファイルです
+type testFile struct {
+	name     string
+	data     string
+	mode     fs.FileMode // 0の場合は0644
+	modified time.Time   // ゼロ値の場合は testTime
+	method   uint16
+	comment  string
+}
+
+// testTime はテスト用のファイルの更新日時です
+var testTime = time.Date(2024, 5, 6, 7, 8, 10, 0, time.UTC)
+
+func (f testFile) fileMode() fs.FileMode {
+	if f.mode == 0 {
+		return 0644
+	}
+	return f.mode
+}
+
+func (f testFile) modTime() time.Time {
+	if f.modified.IsZero() {
+		return testTime
+	}
+	return f.modified
+}
+
+// writeTestZip は dir にファイルを格納したZIPファイルを作成し、そのパスを返します
+func writeTestZip(t *testing.T, dir, name string, files []testFile) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	zw := zip.NewWriter(out)
+	for _, f := range files {
+		fh := &zip.FileHeader{Name: f.name, Method: f.method, Modified: f.modTime(), Comment: f.comment}
+		fh.SetMode(f.fileMode())
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(f.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeTestTar は dir にファイルを格納したtarファイルを作成し、そのパスを返します
+func writeTestTar(t *testing.T, dir, name string, files []testFile) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	tw := tar.NewWriter(out)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: int64(f.fileMode().Perm()), Size: int64(len(f.data)), ModTime: f.modTime(), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,345 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"zip-editor/internal/zipfmt"
+)
+
+// ConvertOptions はアーカイブの形式を変換する際のオプションです
+type ConvertOptions struct {
+	Format      Format      // 変換先の形式
+	Compression Compression // 変換先がtarの場合のストリームの圧縮方式
+	Method      uint16      // 変換先がZIPの場合の圧縮方式（zipfmt.WritableMethods のいずれか）
+	Level       int         // 圧縮レベル（zipfmt.LevelDefault で各方式の標準、ZIPのみ）
+	// Keep がnilでない場合、falseを返したエントリは変換先に書き込みません
+	Keep func(e *Entry) bool
+}
+
+// LossyEntry は変換先の形式で表現できず、失われた情報があるエントリです
+type LossyEntry struct {
+	Path   string
+	Reason string
+}
+
+// ConvertResult はアーカイブの形式の変換結果です
+type ConvertResult struct {
+	Entries int          // 変換先に書き込んだエントリ数
+	Lossy   []LossyEntry // 表現できなかった情報があるエントリ（書き込まなかったものを含む）
+	Notes   []string     // エントリ単位ではない、失われた情報についての注意
+}
+
+// addLossy は表現できなかった情報を結果に追加します
+func (r *ConvertResult) addLossy(path, reason string) {
+	r.Lossy = append(r.Lossy, LossyEntry{Path: path, Reason: reason})
+}
+
+// addNote は注意を重複しないように結果に追加します
+func (r *ConvertResult) addNote(note string) {
+	for _, n := range r.Notes {
+		if n == note {
+			return
+		}
+	}
+	r.Notes = append(r.Notes, note)
+}
+
+// maxConvertReportLines は変換レポートに列挙するエントリの最大件数です
+const maxConvertReportLines = 20
+
+// Convert はアーカイブを別の形式に変換して dstPath に書き込みます
+// エントリは先頭から順に読み取りながら書き込むため、一時的にディスクへ展開することはありません
+// 変換先の形式で表現できない情報（ZIPのハードリンク、tarのコメントなど）は結果のレポートに記録します
+func Convert(srcPath, dstPath string, opts ConvertOptions) (result *ConvertResult, err error) {
+	if absSrc, err := filepath.Abs(srcPath); err == nil {
+		if absDst, err := filepath.Abs(dstPath); err == nil && strings.EqualFold(absSrc, absDst) {
+			return nil, errors.New("変換先に変換元と同じファイルは指定できません")
+		}
+	}
+	srcFormat, _, err := Detect(srcPath)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := os.Create(dstPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		out.Close()
+		if err != nil {
+			os.Remove(dstPath)
+		}
+	}()
+
+	var w entryWriter
+	switch opts.Format {
+	case FormatZip:
+		w, err = newZipEntryWriter(out, opts.Method, opts.Level)
+	case FormatTar:
+		w, err = newTarEntryWriter(out, opts.Compression)
+	default:
+		err = ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result = &ConvertResult{}
+	if srcFormat == FormatZip {
+		copyZipComment(srcPath, w, result)
+	}
+	// ZIPはハードリンクを表現できないため、参照先の内容を後から通常のファイルとして書き込む
+	var hardlinks []*Entry
+	err = Walk(srcPath, srcFormat, func(e *Entry, r io.Reader) error {
+		if opts.Keep != nil && !opts.Keep(e) {
+			return nil
+		}
+		if e.Encrypted {
+			result.addLossy(e.Path, "暗号化されているため変換できません")
+			return nil
+		}
+		if e.Hardlink && opts.Format == FormatZip {
+			hardlinks = append(hardlinks, e)
+			return nil
+		}
+		written, err := w.WriteEntry(e, r, result)
+		if written {
+			result.Entries++
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range hardlinks {
+		if err := copyHardlink(srcPath, srcFormat, e, w, result); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// copyHardlink はハードリンクの参照先の内容を、通常のファイルとして書き込みます
+func copyHardlink(srcPath string, srcFormat Format, e *Entry, w entryWriter, result *ConvertResult) error {
+	rc, err := OpenEntry(srcPath, srcFormat, e.Linkname)
+	if err != nil {
+		result.addLossy(e.Path, "ハードリンクの参照先 "+e.Linkname+" を読み取れないため変換できません")
+		return nil
+	}
+	defer rc.Close()
+
+	file := *e
+	file.Hardlink = false
+	file.Linkname = ""
+	file.header = nil
+	written, err := w.WriteEntry(&file, rc, result)
+	if written {
+		result.Entries++
+		result.addLossy(e.Path, "ハードリンクを通常のファイルとしてコピーしました（参照先: "+e.Linkname+"）")
+	}
+	return err
+}
+
+// entryWriter は変換先の形式にエントリを書き込みます
+type entryWriter interface {
+	// WriteEntry はエントリを書き込みます。表現できなかった情報は result に記録し、
+	// 書き込まなかった場合は written がfalseになります
+	WriteEntry(e *Entry, r io.Reader, result *ConvertResult) (written bool, err error)
+	Close() error
+}
+
+// isSpecialFile はデバイスファイル・名前付きパイプ・ソケットかどうかを返します
+func isSpecialFile(mode fs.FileMode) bool {
+	return mode&(fs.ModeDevice|fs.ModeCharDevice|fs.ModeNamedPipe|fs.ModeSocket) != 0
+}
+
+// zipEntryWriter はZIP形式でエントリを書き込みます
+type zipEntryWriter struct {
+	zw     *zip.Writer
+	method uint16
+}
+
+func newZipEntryWriter(w io.Writer, method uint16, level int) (*zipEntryWriter, error) {
+	comp := zipfmt.CompressorLevel(method, level)
+	if comp == nil {
+		return nil, fmt.Errorf("圧縮方式 %s での圧縮には対応していません", zipfmt.MethodName(method))
+	}
+	zw := zip.NewWriter(w)
+	zw.RegisterCompressor(method, comp)
+	return &zipEntryWriter{zw: zw, method: method}, nil
+}
+
+func (z *zipEntryWriter) WriteEntry(e *Entry, r io.Reader, result *ConvertResult) (bool, error) {
+	if isSpecialFile(e.Mode) {
+		result.addLossy(e.Path, "デバイスファイル・名前付きパイプはZIPに格納できません")
+		return false, nil
+	}
+
+	header := &zip.FileHeader{
+		Name:     e.Path,
+		Modified: e.Modified,
+		Comment:  e.Comment,
+	}
+	// Unixのパーミッションと種類を外部属性に記録する
+	header.SetMode(e.Mode)
+	if e.Uid != 0 || e.Gid != 0 {
+		header.Extra = zipfmt.BuildExtra([]zipfmt.ExtraField{zipfmt.BuildUnixOwner(e.Uid, e.Gid)})
+	}
+	if e.Uname != "" || e.Gname != "" {
+		result.addNote("所有者のユーザー名・グループ名はZIPに保存できないため、UID・GIDのみを記録しました")
+	}
+
+	switch {
+	case e.IsDir():
+		header.Method = zip.Store
+		_, err := z.zw.CreateHeader(header)
+		return true, err
+	case e.Mode&fs.ModeSymlink != 0:
+		// シンボリックリンクは参照先をデータとして格納する
+		header.Method = zip.Store
+		fw, err := z.zw.CreateHeader(header)
+		if err != nil {
+			return false, err
+		}
+		_, err = io.WriteString(fw, e.Linkname)
+		return true, err
+	}
+
+	zipfmt.SetMethod(header, z.method)
+	header.ReaderVersion = zipfmt.RequiredVersion(z.method)
+	fw, err := z.zw.CreateHeader(header)
+	if err != nil {
+		return false, err
+	}
+	_, err = io.Copy(fw, r)
+	return true, err
+}
+
+// copyZipComment はZIPファイル全体のコメントを変換先に引き継ぎます
+// 変換先がZIPでない場合は、失われる情報として結果に記録します
+func copyZipComment(srcPath string, w entryWriter, result *ConvertResult) {
+	reader, err := zipfmt.OpenReader(srcPath)
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+	if reader.Comment == "" {
+		return
+	}
+	if z, ok := w.(*zipEntryWriter); ok {
+		z.zw.SetComment(reader.Comment)
+		return
+	}
+	result.addNote("アーカイブのコメントは保存できません")
+}
+
+func (z *zipEntryWriter) Close() error {
+	return z.zw.Close()
+}
+
+// tarEntryWriter はtar形式でエントリを書き込みます
+type tarEntryWriter struct {
+	tw *tar.Writer
+	cw io.WriteCloser
+}
+
+func newTarEntryWriter(w io.Writer, comp Compression) (*tarEntryWriter, error) {
+	cw, err := newCompressor(w, comp)
+	if err != nil {
+		return nil, err
+	}
+	return &tarEntryWriter{tw: tar.NewWriter(cw), cw: cw}, nil
+}
+
+func (t *tarEntryWriter) WriteEntry(e *Entry, r io.Reader, result *ConvertResult) (bool, error) {
+	if e.Comment != "" {
+		result.addLossy(e.Path, "コメントはtarに保存できません")
+	}
+
+	// tarから読み込んだエントリは元のヘッダーをそのまま引き継ぐ
+	hdr := e.header
+	if hdr == nil {
+		var err error
+		hdr, err = tar.FileInfoHeader(entryFileInfo{e}, e.Linkname)
+		if err != nil {
+			result.addLossy(e.Path, err.Error())
+			return false, nil
+		}
+		hdr.Name = e.Path
+		hdr.Uid, hdr.Gid = e.Uid, e.Gid
+		hdr.Uname, hdr.Gname = e.Uname, e.Gname
+		if e.Hardlink {
+			hdr.Typeflag = tar.TypeLink
+			hdr.Size = 0
+		}
+	}
+
+	if err := writeTarHeader(t.tw, hdr); err != nil {
+		return false, fmt.Errorf("%s: %w", e.Path, err)
+	}
+	_, err := io.Copy(t.tw, r)
+	return true, err
+}
+
+func (t *tarEntryWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.cw.Close()
+}
+
+// entryFileInfo はエントリを fs.FileInfo として扱うためのラッパーです
+type entryFileInfo struct {
+	e *Entry
+}
+
+func (fi entryFileInfo) Name() string       { return filepath.Base(strings.TrimSuffix(fi.e.Path, "/")) }
+func (fi entryFileInfo) Size() int64        { return fi.e.Size }
+func (fi entryFileInfo) Mode() fs.FileMode  { return fi.e.Mode }
+func (fi entryFileInfo) ModTime() time.Time { return fi.e.Modified }
+func (fi entryFileInfo) IsDir() bool        { return fi.e.IsDir() }
+func (fi entryFileInfo) Sys() any           { return nil }
+
+// FormatConvertReport は変換結果を表示用の文字列にまとめます
+func FormatConvertReport(result *ConvertResult) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "変換したエントリ: %d件\n", result.Entries)
+	if len(result.Lossy) == 0 && len(result.Notes) == 0 {
+		sb.WriteString("失われた情報はありません。\n")
+		return sb.String()
+	}
+
+	for _, note := range result.Notes {
+		fmt.Fprintf(&sb, "注意: %s\n", note)
+	}
+	if len(result.Lossy) > 0 {
+		fmt.Fprintf(&sb, "表現できなかった情報があるエントリ: %d件\n", len(result.Lossy))
+		for i, l := range result.Lossy {
+			if i >= maxConvertReportLines {
+				fmt.Fprintf(&sb, "…ほか%d件\n", len(result.Lossy)-maxConvertReportLines)
+				break
+			}
+			fmt.Fprintf(&sb, "- %s: %s\n", l.Path, l.Reason)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,287 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zip-editor/internal/zipfmt"
+)
+
+// tarからZIPへの変換では、リンクとパーミッションを外部属性に残し、ハードリンクは内容をコピーする
+func TestConvertTarToZip(t *testing.T) {
+	entries := append(append([]tarTestEntry(nil), tarTestEntries...),
+		tarTestEntry{hdr: tar.Header{Name: "fifo", Typeflag: tar.TypeFifo, Mode: 0o644}})
+	for _, method := range []uint16{zip.Store, zip.Deflate, zipfmt.MethodZstd} {
+		t.Run(zipfmt.MethodName(method), func(t *testing.T) {
+			dir := t.TempDir()
+			src := writeTarEntries(t, dir, "a.tar.gz", CompressionGzip, entries)
+			dst := filepath.Join(dir, "a.zip")
+			result, err := Convert(src, dst, ConvertOptions{Format: FormatZip, Method: method, Level: zipfmt.LevelDefault})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Entries != len(tarTestEntries) {
+				t.Errorf("Entries = %d, want %d", result.Entries, len(tarTestEntries))
+			}
+			checkLossy(t, result, map[string]string{
+				"fifo": "デバイスファイル",
+				"hard": "ハードリンクを通常のファイルとしてコピーしました",
+			})
+			if len(result.Notes) != 1 || !strings.Contains(result.Notes[0], "ユーザー名・グループ名") {
+				t.Errorf("Notes = %q", result.Notes)
+			}
+
+			got, err := walkEntries(dst, FormatZip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []struct {
+				path     string
+				mode     fs.FileMode
+				linkname string
+				owner    string
+			}{
+				{path: "dir/", mode: fs.ModeDir | 0o755, owner: "0/0"},
+				{path: "dir/a.txt", mode: 0o640, owner: "1000/100"},
+				{path: "dir/run.sh", mode: 0o755, owner: "0/0"},
+				{path: "dir/link", mode: fs.ModeSymlink | 0o777, linkname: "a.txt", owner: "0/0"},
+				{path: longName, mode: 0o644, owner: "0/0"},
+				{path: "empty.txt", mode: 0o644, owner: "0/0"},
+				// ハードリンクは最後に通常のファイルとして書き込む
+				{path: "hard", mode: 0o640, owner: "0/0"},
+			}
+			if len(got) != len(want) {
+				t.Fatalf("エントリ数 = %d, want %d", len(got), len(want))
+			}
+			for i, e := range got {
+				w := want[i]
+				if e.Path != w.path || e.Mode != w.mode || e.Linkname != w.linkname || e.Owner() != w.owner || e.Hardlink {
+					t.Errorf("%d: %s %v 参照先 %q 所有者 %s, want %+v", i, e.Path, e.Mode, e.Linkname, e.Owner(), w)
+				}
+				if !e.Modified.Equal(testTime) {
+					t.Errorf("%s: 更新日時 = %v, want %v", e.Path, e.Modified, testTime)
+				}
+			}
+			checkEntryData(t, dst, FormatZip, map[string]string{
+				"dir/a.txt": "aの内容",
+				"hard":      "aの内容",
+				longName:    "長い名前",
+				"empty.txt": "",
+			})
+		})
+	}
+}
+
+// ZIPからtarへの変換では、コメントは失われた情報として記録する
+func TestConvertZipToTar(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.zip")
+	writeZipWithComment(t, src, "アーカイブのコメント", []testFile{
+		{name: "dir/", mode: fs.ModeDir | 0o750},
+		{name: "dir/a.txt", data: "aの内容", mode: 0o600, method: zip.Deflate, comment: "エントリのコメント"},
+		{name: "dir/link", data: "a.txt", mode: fs.ModeSymlink | 0o777},
+		{name: "b.txt", data: strings.Repeat("b", 1000), method: zip.Deflate},
+	})
+	for _, c := range tarCompressions {
+		t.Run(c.comp.String(), func(t *testing.T) {
+			dst := filepath.Join(t.TempDir(), "a"+c.ext)
+			result, err := Convert(src, dst, ConvertOptions{Format: FormatTar, Compression: c.comp})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Entries != 4 {
+				t.Errorf("Entries = %d, want 4", result.Entries)
+			}
+			checkLossy(t, result, map[string]string{"dir/a.txt": "コメント"})
+			if len(result.Notes) != 1 || !strings.Contains(result.Notes[0], "アーカイブのコメント") {
+				t.Errorf("Notes = %q", result.Notes)
+			}
+			if format, comp, err := Detect(dst); err != nil || format != FormatTar || comp != c.comp {
+				t.Errorf("Detect = %v, %v, %v, want tar, %v", format, comp, err, c.comp)
+			}
+
+			got, err := ReadEntries(dst, FormatTar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []struct {
+				path     string
+				mode     fs.FileMode
+				linkname string
+			}{
+				{path: "dir/", mode: fs.ModeDir | 0o750},
+				{path: "dir/a.txt", mode: 0o600},
+				{path: "dir/link", mode: fs.ModeSymlink | 0o777, linkname: "a.txt"},
+				{path: "b.txt", mode: 0o644},
+			}
+			if len(got) != len(want) {
+				t.Fatalf("エントリ数 = %d, want %d", len(got), len(want))
+			}
+			for i, e := range got {
+				if w := want[i]; e.Path != w.path || e.Mode != w.mode || e.Linkname != w.linkname {
+					t.Errorf("%d: %s %v 参照先 %q, want %+v", i, e.Path, e.Mode, e.Linkname, w)
+				}
+			}
+			checkEntryData(t, dst, FormatTar, map[string]string{
+				"dir/a.txt": "aの内容",
+				"dir/link":  "aの内容",
+				"b.txt":     strings.Repeat("b", 1000),
+			})
+		})
+	}
+}
+
+// ZIPからZIPへの変換では、アーカイブのコメントを引き継ぎ、Keep で選んだエントリだけを書き込む
+func TestConvertZipToZip(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.zip")
+	writeZipWithComment(t, src, "アーカイブのコメント", []testFile{
+		{name: "a.txt", data: strings.Repeat("a", 1000), comment: "エントリのコメント"},
+		{name: "b.txt", data: "b"},
+	})
+	dst := filepath.Join(dir, "b.zip")
+	result, err := Convert(src, dst, ConvertOptions{
+		Format: FormatZip,
+		Method: zipfmt.MethodXZ,
+		Level:  zipfmt.LevelBest,
+		Keep:   func(e *Entry) bool { return e.Path != "b.txt" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Entries != 1 || len(result.Lossy) != 0 || len(result.Notes) != 0 {
+		t.Errorf("result = %+v", result)
+	}
+
+	reader, err := zipfmt.OpenReader(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if reader.Comment != "アーカイブのコメント" {
+		t.Errorf("アーカイブのコメント = %q", reader.Comment)
+	}
+	if len(reader.File) != 1 {
+		t.Fatalf("エントリ数 = %d, want 1", len(reader.File))
+	}
+	f := reader.File[0]
+	if f.Name != "a.txt" || f.Method != zipfmt.MethodXZ || f.Comment != "エントリのコメント" {
+		t.Errorf("%s: 圧縮方式 %s コメント %q", f.Name, zipfmt.MethodName(f.Method), f.Comment)
+	}
+	checkEntryData(t, dst, FormatZip, map[string]string{"a.txt": strings.Repeat("a", 1000)})
+}
+
+func TestConvertErrors(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestZip(t, dir, "a.zip", []testFile{{name: "a.txt", data: "a"}})
+	tests := []struct {
+		name string
+		dst  string
+		opts ConvertOptions
+	}{
+		{name: "変換元と同じファイル", dst: src, opts: ConvertOptions{Format: FormatTar}},
+		{name: "圧縮に対応していない方式", dst: filepath.Join(dir, "b.zip"), opts: ConvertOptions{Format: FormatZip, Method: zipfmt.MethodDeflate64}},
+		{name: "書き込めない形式", dst: filepath.Join(dir, "b.7z"), opts: ConvertOptions{Format: FormatSevenZip}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Convert(src, tt.dst, tt.opts); err == nil {
+				t.Fatal("エラーになりませんでした")
+			}
+			if tt.dst == src {
+				if _, err := walkEntries(src, FormatZip); err != nil {
+					t.Errorf("変換元が壊れました: %v", err)
+				}
+				return
+			}
+			// 変換に失敗した場合は書きかけのファイルを残さない
+			if _, err := os.Stat(tt.dst); !os.IsNotExist(err) {
+				t.Errorf("変換先のファイルが残っています: %v", err)
+			}
+		})
+	}
+}
+
+func TestFormatConvertReport(t *testing.T) {
+	if got := FormatConvertReport(&ConvertResult{Entries: 3}); got != "変換したエントリ: 3件\n失われた情報はありません。\n" {
+		t.Errorf("失われた情報がない場合 = %q", got)
+	}
+
+	result := &ConvertResult{Entries: 30}
+	result.addNote("注意1")
+	result.addNote("注意1")
+	for i := range 25 {
+		result.addLossy(fmt.Sprintf("f%02d", i), "理由")
+	}
+	got := FormatConvertReport(result)
+	for _, want := range []string{"変換したエントリ: 30件\n", "注意: 注意1\n", "表現できなかった情報があるエントリ: 25件\n", "- f19: 理由\n", "…ほか5件\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("レポートに %q が含まれていません:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "注意1") != 1 || strings.Contains(got, "f20") {
+		t.Errorf("レポート:\n%s", got)
+	}
+}
+
+// checkLossy は失われた情報があるエントリが want（パスと理由に含まれる文字列）と一致するかどうかを確かめます
+func checkLossy(t *testing.T, result *ConvertResult, want map[string]string) {
+	t.Helper()
+	if len(result.Lossy) != len(want) {
+		t.Errorf("Lossy = %+v, want %v", result.Lossy, want)
+	}
+	for _, l := range result.Lossy {
+		if reason, ok := want[l.Path]; !ok || !strings.Contains(l.Reason, reason) {
+			t.Errorf("%s: 理由 %q, want %q", l.Path, l.Reason, reason)
+		}
+	}
+}
+
+// walkEntries はアーカイブのエントリ一覧を Walk で読み込みます（ZIPは ReadEntries で読み込めないため）
+func walkEntries(path string, format Format) ([]*Entry, error) {
+	var entries []*Entry
+	err := Walk(path, format, func(e *Entry, r io.Reader) error {
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// checkEntryData はアーカイブ内のエントリの内容が want と一致するかどうかを確かめます
+func checkEntryData(t *testing.T, path string, format Format, want map[string]string) {
+	t.Helper()
+	for name, data := range want {
+		rc, err := OpenEntry(path, format, name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(got) != data {
+			t.Errorf("%s = %q, %v, want %q", name, got, err, data)
+		}
+	}
+}
+
+// writeZipWithComment はアーカイブのコメントを付けたZIPファイルを作成します
+func writeZipWithComment(t *testing.T, path, comment string, files []testFile) {
+	t.Helper()
+	data, err := os.ReadFile(writeTestZip(t, t.TempDir(), "tmp.zip", files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// コメントのない終端レコードは末尾の22バイトで、最後の2バイトがコメントの長さ
+	data = append(data[:len(data)-2], byte(len(comment)), byte(len(comment)>>8))
+	data = append(data, comment...)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,551 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// DefaultMaxDiffTextSize はテキストの差分を作るファイルの最大サイズの既定値です
+const DefaultMaxDiffTextSize = 1 << 20
+
+// DiffKind は2つのアーカイブの間でのファイルの変化の種類です
+type DiffKind int
+
+const (
+	DiffAdded      DiffKind = iota // 新しいアーカイブだけにある
+	DiffRemoved                    // 古いアーカイブだけにある
+	DiffModified                   // 内容が変わった
+	DiffRenamed                    // 内容は同じで、パスが変わった
+	DiffPermission                 // 内容は同じで、パーミッション（ファイルの種類を含む）が変わった
+	DiffMetadata                   // 内容とパーミッションは同じで、更新日時・圧縮方式・コメントなどだけが変わった
+)
+
+// String は変化の種類の表示名を返します
+func (k DiffKind) String() string {
+	switch k {
+	case DiffAdded:
+		return "追加"
+	case DiffRemoved:
+		return "削除"
+	case DiffModified:
+		return "変更"
+	case DiffRenamed:
+		return "名前の変更"
+	case DiffPermission:
+		return "パーミッション"
+	case DiffMetadata:
+		return "メタデータのみ"
+	}
+	return "不明"
+}
+
+// Key は変化の種類を示す英字の名前（JSONなどの出力用）を返します
+func (k DiffKind) Key() string {
+	switch k {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffModified:
+		return "modified"
+	case DiffRenamed:
+		return "renamed"
+	case DiffPermission:
+		return "permission"
+	case DiffMetadata:
+		return "metadata"
+	}
+	return "unknown"
+}
+
+// DiffOptions は2つのアーカイブを比較する際のオプションです
+type DiffOptions struct {
+	TextDiff    bool  // 内容が変わったテキストファイルの unified diff を作る
+	Context     int   // unified diff で変更の前後に表示する行数
+	MaxTextSize int64 // これより大きいファイルは差分を作らない（0以下の場合は DefaultMaxDiffTextSize）
+	// OpenEncrypted は暗号化されたZIPのエントリを開く関数です（nilの場合、暗号化されたエントリはサイズとCRC32だけで比較します）
+	OpenEncrypted func(archivePath string, f *zip.File) (io.ReadCloser, error)
+}
+
+// DiffChange は変化したファイルひとつです
+type DiffChange struct {
+	Kind     DiffKind
+	Path     string   // 新しいアーカイブでのパス（削除の場合は古いアーカイブでのパス）
+	OldPath  string   // 古いアーカイブでのパス（追加の場合は空）
+	OldSize  int64    // 古いアーカイブでのサイズ（追加の場合は0）
+	NewSize  int64    // 新しいアーカイブでのサイズ（削除の場合は0）
+	Details  []string // 変わった項目（"更新日時: … → …" など）
+	TextDiff string   // テキストの変更の unified diff（DiffOptions.TextDiff を指定し、両方ともテキストと判定できた場合）
+	Note     string   // 差分を作らなかった理由など
+}
+
+// DiffResult は2つのアーカイブを比較した結果です
+type DiffResult struct {
+	OldPath   string
+	NewPath   string
+	Changes   []DiffChange // パスの順
+	Unchanged int          // 変化のなかったファイルの数
+}
+
+// Count は指定した種類の変化の数を返します
+func (r *DiffResult) Count(kind DiffKind) int {
+	n := 0
+	for _, c := range r.Changes {
+		if c.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// Summary は変化の種類ごとの数を "追加 2件、変更 1件" のような文字列にまとめます
+func (r *DiffResult) Summary() string {
+	var parts []string
+	for _, kind := range []DiffKind{DiffAdded, DiffRemoved, DiffModified, DiffRenamed, DiffPermission, DiffMetadata} {
+		if n := r.Count(kind); n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d件", kind, n))
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("違いはありません（%d件のファイルが同じです）", r.Unchanged)
+	}
+	return strings.Join(parts, "、") + fmt.Sprintf("／変化なし %d件", r.Unchanged)
+}
+
+// diffEntry は比較するファイルひとつです
+type diffEntry struct {
+	*Entry
+	key      string    // パスの照合に使うキー（Unicodeの正規化形式NFCにしたパス）
+	file     *zip.File // ZIPのエントリ（ZIP以外の形式ではnil）
+	crc      uint32
+	crcKnown bool   // CRC32が分かっているかどうか（AE-2で暗号化されたZIPのエントリは記録されない）
+	method   string // 圧縮方式（ZIPのみ）
+	sum      [sha256.Size]byte
+	hashed   bool
+	matched  bool // 名前の変更として対応付けたかどうか
+}
+
+// isFile は内容を比較する通常のファイルかどうかを返します
+func (e *diffEntry) isFile() bool {
+	return !e.IsDir() && e.Mode&fs.ModeSymlink == 0 && !e.Hardlink
+}
+
+// diffArchive は比較するアーカイブの片方です
+type diffArchive struct {
+	path    string
+	format  Format
+	zip     *zipfmt.ReadCloser // ZIPの場合に開いたままにしておくリーダー
+	entries []*diffEntry       // アーカイブ内の順（フォルダを除く）
+	byKey   map[string]*diffEntry
+	opts    *DiffOptions
+}
+
+// DiffArchives は2つのアーカイブのファイルを比較します
+// パスはUTF-8に変換・正規化（CleanPath）したうえでUnicodeの正規化形式NFCにそろえて照合し、
+// 内容はサイズとCRC32を比べ、一致する場合は展開したバイト列を比べます（ZIP以外の形式はSHA-256で比べます）
+// 古いアーカイブだけにあるファイルと新しいアーカイブだけにあるファイルのうち、内容が同じものは名前の変更とします
+// フォルダのエントリは比較しません
+func DiffArchives(oldPath, newPath string, opts DiffOptions) (*DiffResult, error) {
+	if opts.MaxTextSize <= 0 {
+		opts.MaxTextSize = DefaultMaxDiffTextSize
+	}
+	oldArc, err := openDiffArchive(oldPath, &opts)
+	if err != nil {
+		return nil, err
+	}
+	defer oldArc.close()
+	newArc, err := openDiffArchive(newPath, &opts)
+	if err != nil {
+		return nil, err
+	}
+	defer newArc.close()
+
+	result := &DiffResult{OldPath: oldPath, NewPath: newPath}
+	var removed, added []*diffEntry
+	for _, o := range oldArc.entries {
+		if _, ok := newArc.byKey[o.key]; !ok {
+			removed = append(removed, o)
+		}
+	}
+	for _, n := range newArc.entries {
+		o, ok := oldArc.byKey[n.key]
+		if !ok {
+			added = append(added, n)
+			continue
+		}
+		change, changed := diffEntries(oldArc, newArc, o, n)
+		if changed {
+			result.Changes = append(result.Changes, change)
+		} else {
+			result.Unchanged++
+		}
+	}
+
+	// 内容が同じものを名前の変更として対応付ける（同じファイル名のものを優先する）
+	bySize := make(map[int64][]*diffEntry)
+	for _, o := range removed {
+		if o.isFile() && o.Size > 0 {
+			bySize[o.Size] = append(bySize[o.Size], o)
+		}
+	}
+	for _, n := range added {
+		if !n.isFile() || n.Size <= 0 {
+			continue
+		}
+		candidates := bySize[n.Size]
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return path.Base(candidates[i].Path) == path.Base(n.Path) && path.Base(candidates[j].Path) != path.Base(n.Path)
+		})
+		for _, o := range candidates {
+			if o.matched {
+				continue
+			}
+			if same, _, err := sameContent(oldArc, newArc, o, n); err != nil || !same {
+				continue
+			}
+			o.matched, n.matched = true, true
+			result.Changes = append(result.Changes, DiffChange{
+				Kind:    DiffRenamed,
+				Path:    n.Path,
+				OldPath: o.Path,
+				OldSize: o.Size,
+				NewSize: n.Size,
+				Details: metadataDetails(oldArc, newArc, o, n),
+			})
+			break
+		}
+	}
+	for _, o := range removed {
+		if !o.matched {
+			result.Changes = append(result.Changes, DiffChange{Kind: DiffRemoved, Path: o.Path, OldPath: o.Path, OldSize: o.Size})
+		}
+	}
+	for _, n := range added {
+		if !n.matched {
+			result.Changes = append(result.Changes, DiffChange{Kind: DiffAdded, Path: n.Path, NewSize: n.Size})
+		}
+	}
+
+	sort.SliceStable(result.Changes, func(i, j int) bool {
+		return result.Changes[i].Path < result.Changes[j].Path
+	})
+	return result, nil
+}
+
+// diffEntries は同じパスにあるファイルを比較します。変化がない場合は changed がfalseになります
+func diffEntries(oldArc, newArc *diffArchive, o, n *diffEntry) (change DiffChange, changed bool) {
+	change = DiffChange{Path: n.Path, OldPath: o.Path, OldSize: o.Size, NewSize: n.Size}
+	details := metadataDetails(oldArc, newArc, o, n)
+
+	same, note, err := sameContent(oldArc, newArc, o, n)
+	switch {
+	case err != nil:
+		change.Kind = DiffModified
+		change.Note = "内容を比較できません: " + err.Error()
+	case !same:
+		change.Kind = DiffModified
+		if o.Size != n.Size {
+			details = append([]string{fmt.Sprintf("サイズ: %d → %d バイト", o.Size, n.Size)}, details...)
+		}
+		if o.Mode&fs.ModeSymlink != 0 || n.Mode&fs.ModeSymlink != 0 {
+			details = append([]string{fmt.Sprintf("リンク先: %s → %s", o.Linkname, n.Linkname)}, details...)
+		} else if oldArc.opts.TextDiff {
+			var encoding string
+			change.TextDiff, encoding, change.Note = textDiff(oldArc, newArc, o, n)
+			if encoding != "" {
+				details = append(details, encoding)
+			}
+		}
+	case o.Mode != n.Mode:
+		change.Kind = DiffPermission
+		change.Note = note
+	case len(details) > 0:
+		change.Kind = DiffMetadata
+		change.Note = note
+	default:
+		return change, false
+	}
+	change.Details = details
+	return change, true
+}
+
+// metadataDetails はファイルの内容以外に変わった項目を返します
+func metadataDetails(oldArc, newArc *diffArchive, o, n *diffEntry) []string {
+	var details []string
+	if o.Mode != n.Mode {
+		details = append(details, fmt.Sprintf("パーミッション: %s → %s", o.Mode, n.Mode))
+	}
+	if !o.Modified.Truncate(time.Second).Equal(n.Modified.Truncate(time.Second)) {
+		details = append(details, fmt.Sprintf("更新日時: %s → %s", diffTime(o.Modified), diffTime(n.Modified)))
+	}
+	if o.method != "" && n.method != "" && o.method != n.method {
+		details = append(details, fmt.Sprintf("圧縮方式: %s → %s", o.method, n.method))
+	}
+	if o.Encrypted != n.Encrypted {
+		details = append(details, fmt.Sprintf("暗号化: %s → %s", diffBool(o.Encrypted), diffBool(n.Encrypted)))
+	}
+	if o.Comment != n.Comment {
+		details = append(details, fmt.Sprintf("コメント: %q → %q", o.Comment, n.Comment))
+	}
+	// 所有者は形式によって記録のしかたが異なるため、同じ形式どうしの場合だけ比較する
+	if oldArc.format == newArc.format && o.Owner() != n.Owner() {
+		details = append(details, fmt.Sprintf("所有者: %s → %s", o.Owner(), n.Owner()))
+	}
+	return details
+}
+
+// diffTime は更新日時を表示用の文字列にします
+func diffTime(t time.Time) string {
+	if t.IsZero() {
+		return "（なし）"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// diffBool は有無を表示用の文字列にします
+func diffBool(b bool) string {
+	if b {
+		return "あり"
+	}
+	return "なし"
+}
+
+// sameContent は2つのファイルの内容が同じかどうかを返します
+// サイズとCRC32が一致する場合だけ内容を読み取って比較します。暗号化されていて読み取れない場合はサイズとCRC32の一致で同じとみなし、note に記録します
+func sameContent(oldArc, newArc *diffArchive, o, n *diffEntry) (same bool, note string, err error) {
+	if o.Mode&fs.ModeSymlink != 0 || n.Mode&fs.ModeSymlink != 0 {
+		return o.Mode&fs.ModeSymlink != 0 && n.Mode&fs.ModeSymlink != 0 && o.Linkname == n.Linkname, "", nil
+	}
+	if o.Hardlink || n.Hardlink {
+		return o.Hardlink && n.Hardlink && o.Linkname == n.Linkname, "", nil
+	}
+	if o.Size != n.Size {
+		return false, "", nil
+	}
+	if o.crcKnown && n.crcKnown && o.crc != n.crc {
+		return false, "", nil
+	}
+	if o.hashed && n.hashed {
+		return o.sum == n.sum, "", nil
+	}
+
+	// ZIPどうしはバイト列を直接比較し、片方がZIP以外の形式の場合はSHA-256で比較する
+	if !o.hashed && !n.hashed {
+		same, err = equalContent(oldArc, newArc, o, n)
+	} else {
+		if err = oldArc.hash(o); err == nil {
+			err = newArc.hash(n)
+		}
+		same = err == nil && o.sum == n.sum
+	}
+	if errors.Is(err, errEncryptedEntry) && o.crcKnown && n.crcKnown {
+		return true, "暗号化されているため、サイズとCRC32だけで比較しました", nil
+	}
+	return same, "", err
+}
+
+// equalContent はZIPの2つのエントリを展開し、バイト列を比較します
+func equalContent(oldArc, newArc *diffArchive, o, n *diffEntry) (bool, error) {
+	or, err := oldArc.open(o)
+	if err != nil {
+		return false, err
+	}
+	defer or.Close()
+	nr, err := newArc.open(n)
+	if err != nil {
+		return false, err
+	}
+	defer nr.Close()
+
+	ob := make([]byte, 64*1024)
+	nb := make([]byte, 64*1024)
+	for {
+		on, oerr := io.ReadFull(or, ob)
+		nn, nerr := io.ReadFull(nr, nb)
+		if !bytes.Equal(ob[:on], nb[:nn]) {
+			return false, nil
+		}
+		oEOF := oerr == io.EOF || oerr == io.ErrUnexpectedEOF
+		nEOF := nerr == io.EOF || nerr == io.ErrUnexpectedEOF
+		if oerr != nil && !oEOF {
+			return false, oerr
+		}
+		if nerr != nil && !nEOF {
+			return false, nerr
+		}
+		if oEOF || nEOF {
+			return oEOF == nEOF, nil
+		}
+	}
+}
+
+// textDiff は内容が変わったファイルの unified diff を作ります
+// 差分を作れない場合は note に理由を返し、エンコーディングが変わった場合は encoding に記録します
+func textDiff(oldArc, newArc *diffArchive, o, n *diffEntry) (diff, encoding, note string) {
+	if o.Size > oldArc.opts.MaxTextSize || n.Size > newArc.opts.MaxTextSize {
+		return "", "", "大きいファイルのため、テキストの差分を省略しました"
+	}
+	oldData, err := oldArc.readAll(o)
+	if err != nil {
+		return "", "", "テキストの差分を作れません: " + err.Error()
+	}
+	newData, err := newArc.readAll(n)
+	if err != nil {
+		return "", "", "テキストの差分を作れません: " + err.Error()
+	}
+	oldText, oldEnc, ok1 := common.DecodeText(oldData)
+	newText, newEnc, ok2 := common.DecodeText(newData)
+	if !ok1 || !ok2 {
+		return "", "", "バイナリファイル"
+	}
+	if oldEnc != newEnc {
+		encoding = fmt.Sprintf("エンコーディング: %s → %s", oldEnc, newEnc)
+	}
+	diff, ok := common.UnifiedDiff("a/"+o.Path, "b/"+n.Path, common.SplitLines(oldText), common.SplitLines(newText), oldArc.opts.Context)
+	if !ok {
+		return "", encoding, "変更が多いため、テキストの差分を省略しました"
+	}
+	if diff == "" {
+		note = "テキストとしては同じです（改行やエンコーディングだけが異なります）"
+	}
+	return diff, encoding, note
+}
+
+// openDiffArchive は比較するアーカイブのファイルの一覧を読み込みます
+// ZIPは中央ディレクトリのCRC32を使い、ZIP以外の形式はすべてのファイルを読み取ってCRC32とSHA-256を計算します
+func openDiffArchive(filePath string, opts *DiffOptions) (*diffArchive, error) {
+	format, _, err := Detect(filePath)
+	if err != nil {
+		return nil, err
+	}
+	a := &diffArchive{path: filePath, format: format, byKey: make(map[string]*diffEntry), opts: opts}
+	add := func(de *diffEntry) {
+		de.key = norm.NFC.String(de.Path)
+		if _, ok := a.byKey[de.key]; ok {
+			return
+		}
+		a.byKey[de.key] = de
+		a.entries = append(a.entries, de)
+	}
+
+	if format == FormatZip {
+		if a.zip, err = zipfmt.OpenReader(filePath); err != nil {
+			return nil, err
+		}
+		for _, f := range a.zip.File {
+			e := entryFromZip(f)
+			if e == nil || e.IsDir() {
+				continue
+			}
+			de := &diffEntry{
+				Entry:    e,
+				file:     f,
+				crc:      f.CRC32,
+				crcKnown: true,
+				method:   zipfmt.MethodName(zipfmt.ActualMethod(&f.FileHeader)),
+			}
+			// AE-2 はCRC32を0として記録する
+			if info, ok := zipfmt.ParseAESExtra(&f.FileHeader); ok && info.Version == 2 {
+				de.crcKnown = false
+			}
+			// シンボリックリンクは参照先を読み込んでおく
+			if e.Mode&fs.ModeSymlink != 0 && !e.Encrypted {
+				err := walkZipEntry(f, e, func(*Entry, io.Reader) error { return nil })
+				if err != nil {
+					a.close()
+					return nil, fmt.Errorf("%s: %w", e.Path, err)
+				}
+			}
+			add(de)
+		}
+		return a, nil
+	}
+
+	err = Walk(filePath, format, func(e *Entry, r io.Reader) error {
+		if e.IsDir() {
+			return nil
+		}
+		de := &diffEntry{Entry: e}
+		if !e.Encrypted && e.Mode&fs.ModeSymlink == 0 && !e.Hardlink {
+			crc := crc32.NewIEEE()
+			h := sha256.New()
+			if _, err := io.Copy(io.MultiWriter(crc, h), r); err != nil {
+				return err
+			}
+			de.crc, de.crcKnown = crc.Sum32(), true
+			h.Sum(de.sum[:0])
+			de.hashed = true
+		}
+		add(de)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// close は開いたままにしているZIPファイルを閉じます
+func (a *diffArchive) close() {
+	if a.zip != nil {
+		a.zip.Close()
+	}
+}
+
+// open はファイルの内容を読み取るリーダーを返します
+func (a *diffArchive) open(e *diffEntry) (io.ReadCloser, error) {
+	if e.file == nil {
+		return OpenEntry(a.path, a.format, e.Path)
+	}
+	if e.file.Flags&zipfmt.FlagEncrypted == 0 {
+		return zipfmt.OpenFile(e.file)
+	}
+	if a.opts.OpenEncrypted == nil {
+		return nil, errEncryptedEntry
+	}
+	return a.opts.OpenEncrypted(a.path, e.file)
+}
+
+// readAll はファイルの内容をすべて読み込みます
+func (a *diffArchive) readAll(e *diffEntry) ([]byte, error) {
+	rc, err := a.open(e)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// hash はファイルの内容のSHA-256を計算します（計算済みの場合は何もしない）
+func (a *diffArchive) hash(e *diffEntry) error {
+	if e.hashed {
+		return nil
+	}
+	rc, err := a.open(e)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return err
+	}
+	h.Sum(e.sum[:0])
+	e.hashed = true
+	return nil
+}
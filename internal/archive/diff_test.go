@@ -0,0 +1,114 @@
+package archive
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffArchives(t *testing.T) {
+	dir := t.TempDir()
+	renamed := strings.Repeat("名前を変えたファイル\n", 10)
+	oldPath := writeTestZip(t, dir, "old.zip", []testFile{
+		{name: "same.txt", data: "同じ内容\n"},
+		{name: "modified.txt", data: "a\nb\nc\n"},
+		{name: "removed.txt", data: "削除したファイル\n"},
+		{name: "old/name.bin", data: renamed},
+		{name: "perm.sh", data: "#!/bin/sh\n", mode: 0644},
+		{name: "meta.txt", data: "日時だけ変更\n", comment: "古いコメント"},
+		{name: "が.txt", data: "NFDのパス\n"}, // macOSで作成したZIPのように、濁点が分かれた形式
+	})
+	newPath := writeTestZip(t, dir, "new.zip", []testFile{
+		{name: "same.txt", data: "同じ内容\n"},
+		{name: "modified.txt", data: "a\nB\nc\n"},
+		{name: "added.txt", data: "追加したファイル\n"},
+		{name: "new/name.bin", data: renamed},
+		{name: "perm.sh", data: "#!/bin/sh\n", mode: 0755},
+		{name: "meta.txt", data: "日時だけ変更\n", modified: testTime.Add(time.Hour), method: 8, comment: "新しいコメント"},
+		{name: "が.txt", data: "NFDのパス\n"},
+	})
+
+	result, err := DiffArchives(oldPath, newPath, DiffOptions{TextDiff: true, Context: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		kind    DiffKind
+		path    string
+		oldPath string
+	}{
+		{DiffAdded, "added.txt", ""},
+		{DiffMetadata, "meta.txt", "meta.txt"},
+		{DiffModified, "modified.txt", "modified.txt"},
+		{DiffRenamed, "new/name.bin", "old/name.bin"},
+		{DiffPermission, "perm.sh", "perm.sh"},
+		{DiffRemoved, "removed.txt", "removed.txt"},
+	}
+	if len(result.Changes) != len(want) {
+		for _, c := range result.Changes {
+			t.Logf("%s %s (%s)", c.Kind, c.Path, c.OldPath)
+		}
+		t.Fatalf("変化したファイル = %d件, want %d件", len(result.Changes), len(want))
+	}
+	for i, w := range want {
+		c := result.Changes[i]
+		if c.Kind != w.kind || c.Path != w.path || c.OldPath != w.oldPath {
+			t.Errorf("変化 %d = %s %s (%s), want %s %s (%s)", i, c.Kind, c.Path, c.OldPath, w.kind, w.path, w.oldPath)
+		}
+	}
+	if result.Unchanged != 2 {
+		t.Errorf("変化なし = %d件, want 2件（同じファイルとNFC・NFDのパス）", result.Unchanged)
+	}
+
+	modified := result.Changes[2]
+	wantDiff := "--- a/modified.txt\n+++ b/modified.txt\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"
+	if modified.TextDiff != wantDiff {
+		t.Errorf("テキストの差分:\n%s\nwant:\n%s", modified.TextDiff, wantDiff)
+	}
+	meta := result.Changes[1]
+	if len(meta.Details) != 3 || !strings.HasPrefix(meta.Details[0], "更新日時: ") || !strings.HasPrefix(meta.Details[1], "圧縮方式: ") || !strings.HasPrefix(meta.Details[2], "コメント: ") {
+		t.Errorf("メタデータの変化 = %q", meta.Details)
+	}
+	if got := result.Summary(); got != "追加 1件、削除 1件、変更 1件、名前の変更 1件、パーミッション 1件、メタデータのみ 1件／変化なし 2件" {
+		t.Errorf("Summary = %q", got)
+	}
+}
+
+// 形式が違うアーカイブどうしは、内容をSHA-256で比較する
+func TestDiffArchivesAcrossFormats(t *testing.T) {
+	dir := t.TempDir()
+	files := []testFile{
+		{name: "a.txt", data: "同じ内容\n"},
+		{name: "dir/b.txt", data: "tarでもZIPでも同じ\n"},
+	}
+	zipPath := writeTestZip(t, dir, "a.zip", files)
+	files[1].data = "tarだけ変更\n"
+	tarPath := writeTestTar(t, dir, "a.tar", files)
+
+	result, err := DiffArchives(zipPath, tarPath, DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Changes) != 1 || result.Changes[0].Kind != DiffModified || result.Changes[0].Path != "dir/b.txt" {
+		t.Errorf("変化 = %+v, want dir/b.txt の変更のみ", result.Changes)
+	}
+	if result.Unchanged != 1 {
+		t.Errorf("変化なし = %d件, want 1件", result.Unchanged)
+	}
+}
+
+func TestDiffArchivesIdentical(t *testing.T) {
+	dir := t.TempDir()
+	files := []testFile{{name: "a.txt", data: "a"}, {name: "b/", mode: 0755 | 1<<31}}
+	a := writeTestZip(t, dir, "a.zip", files)
+	result, err := DiffArchives(a, a, DiffOptions{TextDiff: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Changes) != 0 || result.Unchanged != 1 {
+		t.Errorf("同じアーカイブの比較: 変化 %d件, 変化なし %d件", len(result.Changes), result.Unchanged)
+	}
+	if got := result.Summary(); got != "違いはありません（1件のファイルが同じです）" {
+		t.Errorf("Summary = %q", got)
+	}
+}
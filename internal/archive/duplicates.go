@@ -0,0 +1,372 @@
+package archive
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"zip-editor/internal/zipfmt"
+)
+
+// DuplicateOptions は同じ内容のファイルを探す際のオプションです
+type DuplicateOptions struct {
+	MinSize int64                  // これより小さいファイルは調べない（空のファイルは常に除く）
+	Include func(path string) bool // 調べるファイル（nilの場合はすべて）
+	// OpenEncrypted は暗号化されたZIPのエントリを開く関数です（nilの場合、暗号化されたエントリは内容を比較できないものとして記録します）
+	OpenEncrypted func(archivePath string, f *zip.File) (io.ReadCloser, error)
+	// Cancel を閉じると中止します（nilの場合は中止しない）
+	Cancel <-chan struct{}
+}
+
+// DuplicateFile は同じ内容のファイルのひとつです
+type DuplicateFile struct {
+	Archive string // アーカイブのパス
+	Path    string // UTF-8に変換して正規化したパス（Entry.Path と同じ）
+}
+
+// DuplicateGroup は同じ内容のファイルの組です
+type DuplicateGroup struct {
+	Size   int64
+	SHA256 [sha256.Size]byte
+	Files  []DuplicateFile // 指定したアーカイブの順、アーカイブ内の順
+}
+
+// Wasted はひとつを残して削除した場合に減らせるバイト数（展開後のサイズ）を返します
+func (g *DuplicateGroup) Wasted() int64 {
+	return g.Size * int64(len(g.Files)-1)
+}
+
+// CrossArchive は複数のアーカイブにまたがる組かどうかを返します
+func (g *DuplicateGroup) CrossArchive() bool {
+	for _, f := range g.Files[1:] {
+		if f.Archive != g.Files[0].Archive {
+			return true
+		}
+	}
+	return false
+}
+
+// DuplicateKeep は同じ内容のファイルのうち、どれを残すかの選び方です
+type DuplicateKeep int
+
+const (
+	KeepFirst        DuplicateKeep = iota // 先にあるもの（指定したアーカイブの順、アーカイブ内の順）
+	KeepShortestPath                      // パスが最も短いもの（同じ長さの場合は先にあるもの）
+)
+
+// Redundant は keep で選んだひとつを残し、それ以外のファイルを返します
+// perArchive の場合はアーカイブごとにひとつずつ残します（ほかのアーカイブにあるファイルは削除の対象にしません）
+func (g *DuplicateGroup) Redundant(keep DuplicateKeep, perArchive bool) []DuplicateFile {
+	kept := make(map[string]int) // アーカイブ（perArchive でない場合は空文字列）ごとに残すファイルの位置
+	for i, f := range g.Files {
+		key := ""
+		if perArchive {
+			key = f.Archive
+		}
+		k, ok := kept[key]
+		if !ok || (keep == KeepShortestPath && len(f.Path) < len(g.Files[k].Path)) {
+			kept[key] = i
+		}
+	}
+	var list []DuplicateFile
+	for i, f := range g.Files {
+		key := ""
+		if perArchive {
+			key = f.Archive
+		}
+		if kept[key] != i {
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+// DuplicateSkip は内容を比較できなかったファイル（Path が空の場合はアーカイブ全体）とその理由です
+type DuplicateSkip struct {
+	Archive string
+	Path    string
+	Reason  string
+}
+
+// DuplicateResult は同じ内容のファイルを探した結果です
+type DuplicateResult struct {
+	Groups  []DuplicateGroup // 減らせるバイト数の多い順
+	Scanned int              // 調べたファイルの数
+	Hashed  int              // サイズとCRC32が一致したため、SHA-256で内容を比較したファイルの数
+	Skipped []DuplicateSkip  // 読み取れなかったアーカイブ・ファイル（暗号化されたものなど）
+}
+
+// Wasted はすべての組でひとつを残して削除した場合に減らせるバイト数を返します
+func (r *DuplicateResult) Wasted() int64 {
+	var n int64
+	for i := range r.Groups {
+		n += r.Groups[i].Wasted()
+	}
+	return n
+}
+
+// Redundant はすべての組について、残すもの以外のファイルのパスをアーカイブごとに返します（DuplicateGroup.Redundant を参照）
+func (r *DuplicateResult) Redundant(keep DuplicateKeep, perArchive bool) map[string][]string {
+	paths := make(map[string][]string)
+	for i := range r.Groups {
+		for _, f := range r.Groups[i].Redundant(keep, perArchive) {
+			paths[f.Archive] = append(paths[f.Archive], f.Path)
+		}
+	}
+	return paths
+}
+
+// dupFile は重複を調べるファイルひとつです
+type dupFile struct {
+	archive  int // archives の位置
+	index    int // アーカイブ内の位置（ZIPは reader.File の位置）
+	path     string
+	size     int64
+	crc      uint32
+	crcKnown bool // CRC32が記録されているかどうか（AE-2で暗号化されたZIPのエントリは記録されない）
+	sum      [sha256.Size]byte
+	hashed   bool
+	err      error // 読み取れなかった場合のエラー
+}
+
+// FindDuplicates はアーカイブ内（複数指定した場合はアーカイブの間も含む）で同じ内容のファイルを探します
+// サイズとCRC32で候補を絞り込み、SHA-256が一致したものを同じ内容とみなします
+// ZIPは中央ディレクトリに記録されたCRC32を使い、候補になったエントリだけを展開します。ZIP以外の形式はすべてのファイルを読み取ります
+// 読み取れないアーカイブは Skipped に記録して続けます。中止された場合は、それまでの結果とともに ErrSearchCanceled を返します
+func FindDuplicates(archives []string, opts DuplicateOptions) (*DuplicateResult, error) {
+	result := &DuplicateResult{}
+	var files []*dupFile
+	for i, archivePath := range archives {
+		if canceled(opts.Cancel) {
+			return result, ErrSearchCanceled
+		}
+		format, _, err := Detect(archivePath)
+		var found []*dupFile
+		if err == nil {
+			if format == FormatZip {
+				found, err = scanZipDuplicates(archivePath, i, opts)
+			} else {
+				found, err = scanArchiveDuplicates(archivePath, i, format, opts)
+			}
+		}
+		if errors.Is(err, ErrSearchCanceled) {
+			return result, err
+		}
+		if err != nil {
+			result.Skipped = append(result.Skipped, DuplicateSkip{Archive: archivePath, Reason: err.Error()})
+			continue
+		}
+		files = append(files, found...)
+	}
+	result.Scanned = len(files)
+
+	// サイズ、CRC32の順に候補を絞り込む（CRC32が記録されていないファイルを含む場合はサイズだけで絞り込む）
+	bySize := make(map[int64][]*dupFile)
+	var sizes []int64
+	for _, f := range files {
+		if _, ok := bySize[f.size]; !ok {
+			sizes = append(sizes, f.size)
+		}
+		bySize[f.size] = append(bySize[f.size], f)
+	}
+	var candidates [][]*dupFile
+	for _, size := range sizes {
+		bucket := bySize[size]
+		if len(bucket) < 2 {
+			continue
+		}
+		known := true
+		for _, f := range bucket {
+			known = known && f.crcKnown
+		}
+		if !known {
+			candidates = append(candidates, bucket)
+			continue
+		}
+		candidates = append(candidates, groupDupFiles(bucket, func(f *dupFile) any { return f.crc })...)
+	}
+
+	// 候補になったZIPのエントリのSHA-256を計算する
+	need := make(map[int][]*dupFile)
+	for _, bucket := range candidates {
+		for _, f := range bucket {
+			if !f.hashed && f.err == nil {
+				need[f.archive] = append(need[f.archive], f)
+			}
+		}
+	}
+	for i, archivePath := range archives {
+		if len(need[i]) == 0 {
+			continue
+		}
+		if err := hashZipDuplicates(archivePath, need[i], opts); err != nil {
+			if errors.Is(err, ErrSearchCanceled) {
+				return result, err
+			}
+			for _, f := range need[i] {
+				f.err = err
+			}
+		}
+	}
+
+	for _, bucket := range candidates {
+		var hashed []*dupFile
+		for _, f := range bucket {
+			if f.err != nil {
+				result.Skipped = append(result.Skipped, DuplicateSkip{Archive: archives[f.archive], Path: f.path, Reason: f.err.Error()})
+				continue
+			}
+			hashed = append(hashed, f)
+			result.Hashed++
+		}
+		for _, same := range groupDupFiles(hashed, func(f *dupFile) any { return f.sum }) {
+			sort.Slice(same, func(a, b int) bool {
+				if same[a].archive != same[b].archive {
+					return same[a].archive < same[b].archive
+				}
+				return same[a].index < same[b].index
+			})
+			g := DuplicateGroup{Size: same[0].size, SHA256: same[0].sum}
+			for _, f := range same {
+				g.Files = append(g.Files, DuplicateFile{Archive: archives[f.archive], Path: f.path})
+			}
+			result.Groups = append(result.Groups, g)
+		}
+	}
+	sort.SliceStable(result.Groups, func(a, b int) bool {
+		return result.Groups[a].Wasted() > result.Groups[b].Wasted()
+	})
+	return result, nil
+}
+
+// groupDupFiles は key が同じファイルをまとめ、2つ以上ある組だけを最初に現れた順に返します
+func groupDupFiles(files []*dupFile, key func(f *dupFile) any) [][]*dupFile {
+	index := make(map[any]int)
+	var groups [][]*dupFile
+	for _, f := range files {
+		k := key(f)
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], f)
+	}
+	var list [][]*dupFile
+	for _, g := range groups {
+		if len(g) >= 2 {
+			list = append(list, g)
+		}
+	}
+	return list
+}
+
+// includeDuplicate は重複を調べる対象のファイルかどうかを返します
+func includeDuplicate(p string, size int64, opts DuplicateOptions) bool {
+	if size <= 0 || size < opts.MinSize {
+		return false
+	}
+	return opts.Include == nil || opts.Include(p)
+}
+
+// scanZipDuplicates はZIPファイルのエントリのサイズとCRC32を中央ディレクトリから読み取ります
+func scanZipDuplicates(filePath string, archiveIndex int, opts DuplicateOptions) ([]*dupFile, error) {
+	reader, err := zipfmt.OpenReader(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var files []*dupFile
+	for i, f := range reader.File {
+		p := CleanPath(f.Name, strings.HasSuffix(f.Name, "/"))
+		if p == "" || strings.HasSuffix(p, "/") || f.Mode()&fs.ModeSymlink != 0 {
+			continue
+		}
+		if !includeDuplicate(p, int64(f.UncompressedSize64), opts) {
+			continue
+		}
+		df := &dupFile{archive: archiveIndex, index: i, path: p, size: int64(f.UncompressedSize64), crc: f.CRC32, crcKnown: true}
+		// AE-2 はCRC32を0として記録する
+		if info, ok := zipfmt.ParseAESExtra(&f.FileHeader); ok && info.Version == 2 {
+			df.crcKnown = false
+		}
+		files = append(files, df)
+	}
+	return files, nil
+}
+
+// hashZipDuplicates はZIPファイルのエントリを展開してSHA-256を計算します
+// 読み取れなかったエントリは dupFile.err に記録します
+func hashZipDuplicates(filePath string, files []*dupFile, opts DuplicateOptions) error {
+	reader, err := zipfmt.OpenReader(filePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, df := range files {
+		if canceled(opts.Cancel) {
+			return ErrSearchCanceled
+		}
+		f := reader.File[df.index]
+		var rc io.ReadCloser
+		switch {
+		case f.Flags&zipfmt.FlagEncrypted == 0:
+			rc, df.err = zipfmt.OpenFile(f)
+		case opts.OpenEncrypted != nil:
+			rc, df.err = opts.OpenEncrypted(filePath, f)
+		default:
+			df.err = errEncryptedEntry
+		}
+		if df.err != nil {
+			continue
+		}
+		h := sha256.New()
+		_, df.err = io.Copy(h, rc)
+		rc.Close()
+		if df.err == nil {
+			h.Sum(df.sum[:0])
+			df.hashed = true
+		}
+	}
+	return nil
+}
+
+// scanArchiveDuplicates はZIP以外の形式のアーカイブのファイルを先頭から順に読み取り、CRC32とSHA-256を計算します
+func scanArchiveDuplicates(filePath string, archiveIndex int, format Format, opts DuplicateOptions) ([]*dupFile, error) {
+	var files []*dupFile
+	err := Walk(filePath, format, func(e *Entry, r io.Reader) error {
+		if canceled(opts.Cancel) {
+			return ErrSearchCanceled
+		}
+		if e.IsDir() || e.Mode&fs.ModeSymlink != 0 || e.Hardlink || !includeDuplicate(e.Path, e.Size, opts) {
+			return nil
+		}
+		df := &dupFile{archive: archiveIndex, index: len(files), path: e.Path, size: e.Size, crcKnown: !e.Encrypted}
+		files = append(files, df)
+		if e.Encrypted {
+			df.err = errEncryptedEntry
+			return nil
+		}
+		crc := crc32.NewIEEE()
+		h := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(crc, h), r); err != nil {
+			return err
+		}
+		df.crc = crc.Sum32()
+		h.Sum(df.sum[:0])
+		df.hashed = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
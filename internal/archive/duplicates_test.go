@@ -0,0 +1,203 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"zip-editor/internal/zipfmt"
+)
+
+var (
+	dupContentA = strings.Repeat("A", 1000)
+	dupContentB = strings.Repeat("B", 500)
+)
+
+// writeDuplicateArchives はアーカイブ内とアーカイブの間に同じ内容のファイルがあるZIPとtarを作成します
+func writeDuplicateArchives(t *testing.T, dir string) (zipPath, tarPath string) {
+	t.Helper()
+	zipPath = writeTestZip(t, dir, "a.zip", []testFile{
+		{name: "x/", mode: fs.ModeDir | 0o755},
+		{name: "x/1.txt", data: dupContentA, method: zip.Deflate},
+		{name: "y/copy-of-1.txt", data: dupContentA},
+		{name: "long/name/2.txt", data: dupContentB, method: zip.Deflate},
+		// サイズが同じでも内容が違うものは同じ内容とみなさない
+		{name: "same-size.txt", data: strings.Repeat("C", 500)},
+		{name: "small1", data: "ab"},
+		{name: "small2", data: "ab"},
+		{name: "empty1", data: ""},
+		{name: "empty2", data: ""},
+		{name: "x/link", data: "1.txt", mode: fs.ModeSymlink | 0o777},
+	})
+	tarPath = writeTarEntries(t, dir, "b.tar.gz", CompressionGzip, []tarTestEntry{
+		{hdr: tar.Header{Name: "z/1.txt", Typeflag: tar.TypeReg, Mode: 0o644}, data: dupContentA},
+		{hdr: tar.Header{Name: "3.txt", Typeflag: tar.TypeReg, Mode: 0o644}, data: dupContentB},
+		{hdr: tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "3.txt"}},
+		{hdr: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "3.txt"}},
+	})
+	return zipPath, tarPath
+}
+
+func TestFindDuplicates(t *testing.T) {
+	zipPath, tarPath := writeDuplicateArchives(t, t.TempDir())
+	result, err := FindDuplicates([]string{zipPath, tarPath}, DuplicateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 減らせるバイト数の多い順に並ぶ
+	want := []DuplicateGroup{
+		{Size: 1000, Files: []DuplicateFile{{zipPath, "x/1.txt"}, {zipPath, "y/copy-of-1.txt"}, {tarPath, "z/1.txt"}}},
+		{Size: 500, Files: []DuplicateFile{{zipPath, "long/name/2.txt"}, {tarPath, "3.txt"}}},
+		{Size: 2, Files: []DuplicateFile{{zipPath, "small1"}, {zipPath, "small2"}}},
+	}
+	checkDuplicateGroups(t, result.Groups, want)
+	// 空のファイル・リンク・ディレクトリは調べず、CRC32が異なる same-size.txt はSHA-256で比較しない
+	if result.Scanned != 8 || result.Hashed != 7 || len(result.Skipped) != 0 {
+		t.Errorf("調べた %d件 比較した %d件 読み取れない %v, want 8件 7件", result.Scanned, result.Hashed, result.Skipped)
+	}
+	if result.Wasted() != 2000+500+2 {
+		t.Errorf("Wasted = %d", result.Wasted())
+	}
+	if !result.Groups[0].CrossArchive() || result.Groups[2].CrossArchive() {
+		t.Error("CrossArchive の結果が正しくありません")
+	}
+
+	tests := []struct {
+		name       string
+		keep       DuplicateKeep
+		perArchive bool
+		want       map[string][]string
+	}{
+		{
+			name: "先にあるものを残す",
+			keep: KeepFirst,
+			want: map[string][]string{zipPath: {"y/copy-of-1.txt", "small2"}, tarPath: {"z/1.txt", "3.txt"}},
+		},
+		{
+			name: "パスが最も短いものを残す",
+			keep: KeepShortestPath,
+			want: map[string][]string{zipPath: {"y/copy-of-1.txt", "long/name/2.txt", "small2"}, tarPath: {"z/1.txt"}},
+		},
+		{
+			name:       "アーカイブごとに残す",
+			keep:       KeepFirst,
+			perArchive: true,
+			want:       map[string][]string{zipPath: {"y/copy-of-1.txt", "small2"}},
+		},
+	}
+	for _, tt := range tests {
+		if got := result.Redundant(tt.keep, tt.perArchive); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindDuplicatesOptions(t *testing.T) {
+	dir := t.TempDir()
+	zipPath, tarPath := writeDuplicateArchives(t, dir)
+	broken := filepath.Join(dir, "broken.zip")
+	if err := os.WriteFile(broken, []byte("PK\x03\x04壊れたファイル"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := FindDuplicates([]string{zipPath, broken, tarPath}, DuplicateOptions{
+		MinSize: 10,
+		Include: func(p string) bool { return !strings.HasPrefix(p, "y/") },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDuplicateGroups(t, result.Groups, []DuplicateGroup{
+		{Size: 1000, Files: []DuplicateFile{{zipPath, "x/1.txt"}, {tarPath, "z/1.txt"}}},
+		{Size: 500, Files: []DuplicateFile{{zipPath, "long/name/2.txt"}, {tarPath, "3.txt"}}},
+	})
+	// 読み取れないアーカイブは記録して続ける
+	if len(result.Skipped) != 1 || result.Skipped[0].Archive != broken || result.Skipped[0].Path != "" {
+		t.Errorf("読み取れない = %+v", result.Skipped)
+	}
+
+	cancel := make(chan struct{})
+	close(cancel)
+	if _, err := FindDuplicates([]string{zipPath, tarPath}, DuplicateOptions{Cancel: cancel}); !errors.Is(err, ErrSearchCanceled) {
+		t.Errorf("中止: err = %v, want %v", err, ErrSearchCanceled)
+	}
+}
+
+// 暗号化されたエントリは、開く関数がなければ内容を比較できないものとして記録する
+func TestFindDuplicatesEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	zipPath, _ := writeDuplicateArchives(t, dir)
+	encrypted := filepath.Join(dir, "c.zip")
+	out, err := os.Create(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "secret.txt",
+		Flags:              zipfmt.FlagEncrypted,
+		CRC32:              crc32.ChecksumIEEE([]byte(dupContentA)),
+		CompressedSize64:   12 + uint64(len(dupContentA)),
+		UncompressedSize64: uint64(len(dupContentA)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(make([]byte, 12+len(dupContentA))); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	archives := []string{zipPath, encrypted}
+	result, err := FindDuplicates(archives, DuplicateOptions{MinSize: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDuplicateGroups(t, result.Groups, []DuplicateGroup{
+		{Size: 1000, Files: []DuplicateFile{{zipPath, "x/1.txt"}, {zipPath, "y/copy-of-1.txt"}}},
+	})
+	if len(result.Skipped) != 1 || result.Skipped[0] != (DuplicateSkip{Archive: encrypted, Path: "secret.txt", Reason: errEncryptedEntry.Error()}) {
+		t.Errorf("読み取れない = %+v", result.Skipped)
+	}
+
+	result, err = FindDuplicates(archives, DuplicateOptions{
+		MinSize: 1000,
+		OpenEncrypted: func(archivePath string, f *zip.File) (io.ReadCloser, error) {
+			if archivePath != encrypted {
+				t.Errorf("暗号化されたエントリのアーカイブ = %s", archivePath)
+			}
+			return io.NopCloser(strings.NewReader(dupContentA)), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDuplicateGroups(t, result.Groups, []DuplicateGroup{
+		{Size: 1000, Files: []DuplicateFile{{zipPath, "x/1.txt"}, {zipPath, "y/copy-of-1.txt"}, {encrypted, "secret.txt"}}},
+	})
+}
+
+// checkDuplicateGroups は同じ内容のファイルの組が want（SHA-256以外）と一致するかどうかを確かめます
+func checkDuplicateGroups(t *testing.T, got, want []DuplicateGroup) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("組の数 = %d, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range got {
+		if got[i].Size != want[i].Size || !reflect.DeepEqual(got[i].Files, want[i].Files) {
+			t.Errorf("%d: サイズ %d %+v, want サイズ %d %+v", i, got[i].Size, got[i].Files, want[i].Size, want[i].Files)
+		}
+	}
+}
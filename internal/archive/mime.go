@@ -0,0 +1,69 @@
+package archive
+
+import (
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// mimeSniffLen は内容からMIMEタイプを判定するために読み取る先頭のバイト数です
+const mimeSniffLen = 512
+
+// genericMIMETypes は内容からは大まかにしか判定できないMIMEタイプです
+// この場合は拡張子から判定したMIMEタイプがあればそちらを使います（.docx はZIP、.csv はテキストと判定されるため）
+var genericMIMETypes = map[string]bool{
+	"application/octet-stream": true,
+	"text/plain":               true,
+	"application/zip":          true,
+	"application/x-gzip":       true,
+}
+
+// DetectMIMEType はエントリの名前と内容の先頭から、MIMEタイプ（"; charset=..." などの引数を除いたもの）を判定します
+// head が nil の場合（暗号化されていて読み取れないなど）は拡張子だけから判定します
+func DetectMIMEType(name string, head []byte) string {
+	sniffed := ""
+	if head != nil {
+		sniffed = baseMIMEType(http.DetectContentType(head))
+		if !genericMIMETypes[sniffed] {
+			return sniffed
+		}
+	}
+	if byExt := baseMIMEType(mime.TypeByExtension(strings.ToLower(path.Ext(name)))); byExt != "" {
+		return byExt
+	}
+	if sniffed != "" {
+		return sniffed
+	}
+	return "application/octet-stream"
+}
+
+// baseMIMEType はMIMEタイプから引数を取り除きます
+func baseMIMEType(t string) string {
+	t, _, _ = strings.Cut(t, ";")
+	return strings.ToLower(strings.TrimSpace(t))
+}
+
+// ReadMIMETypes はアーカイブのファイルのMIMEタイプを判定し、パス（Entry.Path）をキーにした一覧を返します
+// 内容を読み取れないエントリ（暗号化されたものなど）は拡張子だけから判定します
+func ReadMIMETypes(filePath string, format Format) (map[string]string, error) {
+	types := make(map[string]string)
+	err := Walk(filePath, format, func(e *Entry, r io.Reader) error {
+		if e.IsDir() {
+			return nil
+		}
+		var head []byte
+		if !e.Encrypted && e.Mode&fs.ModeSymlink == 0 {
+			buf := make([]byte, mimeSniffLen)
+			n, err := io.ReadFull(r, buf)
+			if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+				head = buf[:n]
+			}
+		}
+		types[e.Path] = DetectMIMEType(e.Path, head)
+		return nil
+	})
+	return types, err
+}
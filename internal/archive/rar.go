@@ -0,0 +1,187 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/nwaples/rardecode/v2"
+)
+
+// errRarEncrypted は暗号化されたRARのエントリを読み取ろうとした場合のエラーです
+var errRarEncrypted = errors.New("暗号化されたRARのエントリの展開には対応していません")
+
+// rarError はRARの読み取りエラーのうち、利用者に説明が必要なものを日本語のメッセージに置き換えます
+func rarError(err error) error {
+	switch {
+	case errors.Is(err, rardecode.ErrArchiveEncrypted):
+		return errors.New("ファイル名が暗号化されたRARアーカイブは開けません")
+	case errors.Is(err, rardecode.ErrArchivedFileEncrypted):
+		return errRarEncrypted
+	case errors.Is(err, rardecode.ErrMultiVolume):
+		return errors.New("分割されたRARアーカイブの続きのファイルが見つかりません")
+	}
+	return err
+}
+
+// entryFromRar はRARのファイルヘッダーからエントリの情報を作成します
+func entryFromRar(h *rardecode.FileHeader) *Entry {
+	e := &Entry{
+		Path:      CleanPath(h.Name, h.IsDir),
+		Size:      h.UnPackedSize,
+		Modified:  h.ModificationTime,
+		Mode:      h.Mode(),
+		Encrypted: h.Encrypted,
+	}
+	if e.Path == "" {
+		return nil
+	}
+	return e
+}
+
+// readRarEntries はRARアーカイブのエントリ一覧を読み込みます（データは展開しません）
+// RARのソリッド圧縮では、ソリッドのフラグが付いていないファイルから新しいブロックが始まり、
+// フラグが付いたファイルは直前のファイルの辞書を引き継ぎます
+func readRarEntries(filePath string) ([]*Entry, error) {
+	files, err := rardecode.List(filePath)
+	if err != nil {
+		return nil, rarError(err)
+	}
+
+	var entries []*Entry
+	blockSize := make(map[int]int)
+	block := -1
+	for _, f := range files {
+		if !f.IsDir && (!f.Solid || block < 0) {
+			block++
+		}
+		e := entryFromRar(&f.FileHeader)
+		if e == nil {
+			continue
+		}
+		if !f.IsDir {
+			e.Block = block
+			blockSize[block]++
+		}
+		entries = append(entries, e)
+	}
+	for _, e := range entries {
+		e.Solid = !e.IsDir() && blockSize[e.Block] > 1
+	}
+	return entries, nil
+}
+
+// walkRar はRARアーカイブのエントリを格納順に fn に渡します
+// ソリッド圧縮のアーカイブは先頭から順にしか展開できないため、すべてのエントリを順に読み進めます
+func walkRar(filePath string, fn func(e *Entry, r io.Reader) error) error {
+	// ソリッドブロックの情報はファイル一覧全体から求めるため、先にヘッダーだけを読み込む
+	entries, err := readRarEntries(filePath)
+	if err != nil {
+		return err
+	}
+	byPath := make(map[string]*Entry, len(entries))
+	for _, e := range entries {
+		byPath[e.Path] = e
+	}
+
+	reader, err := rardecode.OpenReader(filePath)
+	if err != nil {
+		return rarError(err)
+	}
+	defer reader.Close()
+
+	for {
+		h, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return rarError(err)
+		}
+		e := entryFromRar(h)
+		if e == nil {
+			continue
+		}
+		if listed, ok := byPath[e.Path]; ok {
+			e.Solid, e.Block = listed.Solid, listed.Block
+		}
+		if err := walkRarEntry(&reader.Reader, e, fn); err != nil {
+			return fmt.Errorf("%s: %w", e.Path, err)
+		}
+	}
+}
+
+// walkRarEntry はRARのエントリをひとつ fn に渡します
+func walkRarEntry(r *rardecode.Reader, e *Entry, fn func(e *Entry, r io.Reader) error) error {
+	switch {
+	case e.IsDir():
+		return fn(e, strings.NewReader(""))
+	case e.Encrypted:
+		return fn(e, errReader{errRarEncrypted})
+	case e.Mode&fs.ModeSymlink != 0:
+		// RAR 4.x以前のシンボリックリンクはデータに参照先が格納されている
+		target, err := io.ReadAll(io.LimitReader(r, maxSymlinkTarget))
+		if err != nil {
+			return rarError(err)
+		}
+		e.Linkname = string(target)
+		e.Size = 0
+		return fn(e, strings.NewReader(""))
+	}
+	return fn(e, rarReader{r})
+}
+
+// openRarEntry はRARアーカイブ内のエントリを読み取るリーダーを返します
+// ソリッド圧縮の場合は、先頭から目的のエントリまでを展開しながら読み進めます
+func openRarEntry(filePath, entryPath string) (io.ReadCloser, error) {
+	reader, err := rardecode.OpenReader(filePath)
+	if err != nil {
+		return nil, rarError(err)
+	}
+	for {
+		h, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			reader.Close()
+			return nil, rarError(err)
+		}
+		if CleanPath(h.Name, h.IsDir) != entryPath {
+			continue
+		}
+		if h.Encrypted {
+			reader.Close()
+			return nil, errRarEncrypted
+		}
+		return rarEntryReader{Reader: rarReader{&reader.Reader}, reader: reader}, nil
+	}
+	reader.Close()
+	return nil, os.ErrNotExist
+}
+
+// rarReader はRARのエントリの読み取りエラーを日本語のメッセージに置き換えるリーダーです
+type rarReader struct {
+	r *rardecode.Reader
+}
+
+func (r rarReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = rarError(err)
+	}
+	return n, err
+}
+
+// rarEntryReader はRARアーカイブ内のひとつのエントリを読み取り、閉じるとアーカイブも閉じるリーダーです
+type rarEntryReader struct {
+	io.Reader
+	reader *rardecode.ReadCloser
+}
+
+func (r rarEntryReader) Close() error {
+	return r.reader.Close()
+}
@@ -0,0 +1,234 @@
+package archive
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rarTestEntry はテスト用のRAR5アーカイブに無圧縮で格納するエントリです
+type rarTestEntry struct {
+	name      string
+	data      string
+	dir       bool
+	mode      uint64 // Unixの st_mode（0の場合は通常のファイルの0644）
+	solid     bool   // 直前のファイルの辞書を引き継ぐ（ソリッドのフラグ）
+	encrypted bool
+}
+
+// rarTestEntries はソリッドブロック・ディレクトリ・リンク・暗号化されたエントリを含むエントリです
+var rarTestEntries = []rarTestEntry{
+	{name: "dir", dir: true, mode: 0o40755},
+	{name: "dir/a.txt", data: "aの内容", mode: 0o100640},
+	{name: "dir/b.txt", data: "bの内容", solid: true},
+	{name: "dir/link", data: "a.txt", mode: 0o120777, solid: true},
+	{name: "c.txt", data: "cの内容"},
+	{name: "secret.txt", data: "暗号化された内容", encrypted: true},
+	{name: "d.txt", data: "dの内容"},
+}
+
+func TestReadRarEntries(t *testing.T) {
+	path := writeTestRar(t, t.TempDir(), "a.rar", rarTestEntries)
+	if format, comp, err := Detect(path); err != nil || format != FormatRar || comp != CompressionNone {
+		t.Errorf("Detect = %v, %v, %v, want rar", format, comp, err)
+	}
+
+	entries, err := ReadEntries(path, FormatRar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		path      string
+		mode      fs.FileMode
+		size      int64
+		solid     bool
+		block     int
+		encrypted bool
+	}{
+		{path: "dir/", mode: fs.ModeDir | 0o755},
+		// ソリッドのフラグが付いたファイルは、直前のファイルと同じブロックになる
+		{path: "dir/a.txt", mode: 0o640, size: int64(len("aの内容")), solid: true},
+		{path: "dir/b.txt", mode: 0o644, size: int64(len("bの内容")), solid: true},
+		{path: "dir/link", mode: fs.ModeSymlink | 0o777, size: 5, solid: true},
+		{path: "c.txt", mode: 0o644, size: int64(len("cの内容")), block: 1},
+		{path: "secret.txt", mode: 0o644, size: int64(len("暗号化された内容")), block: 2, encrypted: true},
+		{path: "d.txt", mode: 0o644, size: int64(len("dの内容")), block: 3},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("エントリ数 = %d, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		w := want[i]
+		if e.Path != w.path || e.Mode != w.mode || e.Size != w.size || e.Solid != w.solid || e.Block != w.block || e.Encrypted != w.encrypted {
+			t.Errorf("%d: %s %v サイズ %d ソリッド %v ブロック %d 暗号化 %v, want %+v", i, e.Path, e.Mode, e.Size, e.Solid, e.Block, e.Encrypted, w)
+		}
+		if !e.Modified.Equal(testTime) {
+			t.Errorf("%s: 更新日時 = %v, want %v", e.Path, e.Modified, testTime)
+		}
+	}
+}
+
+func TestWalkRar(t *testing.T) {
+	path := writeTestRar(t, t.TempDir(), "a.rar", rarTestEntries)
+	var got []string
+	err := Walk(path, FormatRar, func(e *Entry, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		if e.Encrypted {
+			if !errors.Is(err, errRarEncrypted) {
+				t.Errorf("%s: err = %v, want %v", e.Path, err, errRarEncrypted)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		got = append(got, e.Path+"="+string(data)+"->"+e.Linkname)
+		if e.Path == "dir/a.txt" && (!e.Solid || e.Block != 0) {
+			t.Errorf("%s: Solid = %v, Block = %d", e.Path, e.Solid, e.Block)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"dir/=->", "dir/a.txt=aの内容->", "dir/b.txt=bの内容->", "dir/link=->a.txt", "c.txt=cの内容->", "d.txt=dの内容->"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("エントリ = %q, want %q", got, want)
+	}
+
+	checkEntryData(t, path, FormatRar, map[string]string{"dir/b.txt": "bの内容", "d.txt": "dの内容"})
+	if _, err := OpenEntry(path, FormatRar, "secret.txt"); !errors.Is(err, errRarEncrypted) {
+		t.Errorf("暗号化されたエントリ: err = %v, want %v", err, errRarEncrypted)
+	}
+	if _, err := OpenEntry(path, FormatRar, "missing.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("存在しないエントリ: err = %v, want ErrNotExist", err)
+	}
+}
+
+// データが壊れたRARアーカイブは、展開時のCRCの検査でエラーになる
+func TestWalkRarCorrupted(t *testing.T) {
+	path := writeTestRar(t, t.TempDir(), "a.rar", []rarTestEntry{{name: "a.txt", data: "aの内容"}})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := strings.Index(string(data), "aの内容")
+	data[i] ^= 0xFF
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err = Walk(path, FormatRar, func(e *Entry, r io.Reader) error {
+		_, err := io.ReadAll(r)
+		return err
+	})
+	if err == nil {
+		t.Error("壊れたデータを読み取れてしまいました")
+	}
+}
+
+// ファイル名まで暗号化されたRARアーカイブは、一覧を読み込めない
+func TestReadRarEncryptedHeaders(t *testing.T) {
+	var buf []byte
+	buf = append(buf, "Rar!\x1a\x07\x01\x00"...)
+	// 暗号化ヘッダー: バージョン0・フラグなし・反復回数・ソルト
+	body := []byte{0, 0, 15}
+	body = append(body, make([]byte, 16)...)
+	buf = append(buf, rarBlock(4, 0, nil, 0, body)...)
+	path := filepath.Join(t.TempDir(), "a.rar")
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ReadEntries(path, FormatRar)
+	if err == nil || !strings.Contains(err.Error(), "ファイル名が暗号化された") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+// writeTestRar は dir にエントリを無圧縮で格納したRAR5アーカイブを作成し、そのパスを返します
+func writeTestRar(t *testing.T, dir, name string, entries []rarTestEntry) string {
+	t.Helper()
+	var buf []byte
+	buf = append(buf, "Rar!\x1a\x07\x01\x00"...)
+	// メインヘッダー: アーカイブのフラグなし
+	buf = append(buf, rarBlock(1, 0, nil, 0, []byte{0})...)
+	for _, e := range entries {
+		data := []byte(e.data)
+		var extra []byte
+		if e.encrypted {
+			// 暗号化のレコード: バージョン0・フラグなし・反復回数・ソルト・IV（データはAESのブロック単位）
+			record := []byte{1, 0, 0, 15}
+			record = append(record, make([]byte, 32)...)
+			extra = append(rarVint(uint64(len(record))), record...)
+			data = append(data, make([]byte, 16-len(data)%16)...)
+		}
+
+		fileFlags := uint64(0x2 | 0x4) // 更新日時とCRC32あり
+		if e.dir {
+			fileFlags |= 0x1
+		}
+		mode := e.mode
+		if mode == 0 {
+			mode = 0o100644
+		}
+		var body []byte
+		body = append(body, rarVint(fileFlags)...)
+		body = append(body, rarVint(uint64(len(e.data)))...)
+		body = append(body, rarVint(mode)...)
+		body = binary.LittleEndian.AppendUint32(body, uint32(testTime.Unix()))
+		body = binary.LittleEndian.AppendUint32(body, crc32.ChecksumIEEE([]byte(e.data)))
+		var comp uint64 // 無圧縮
+		if e.solid {
+			comp |= 0x40
+		}
+		body = append(body, rarVint(comp)...)
+		body = append(body, 1) // Unix
+		body = append(body, rarVint(uint64(len(e.name)))...)
+		body = append(body, e.name...)
+
+		buf = append(buf, rarBlock(2, 0x2, extra, len(data), body)...)
+		buf = append(buf, data...)
+	}
+	// 終端ヘッダー
+	buf = append(buf, rarBlock(5, 0, nil, 0, []byte{0})...)
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// rarBlock はRAR5のヘッダーブロック（CRC32・サイズ・種類・フラグ・追加領域とデータのサイズ・本体・追加領域）を作成します
+func rarBlock(typ, flags uint64, extra []byte, dataSize int, body []byte) []byte {
+	if len(extra) > 0 {
+		flags |= 0x1
+	}
+	h := rarVint(typ)
+	h = append(h, rarVint(flags)...)
+	if len(extra) > 0 {
+		h = append(h, rarVint(uint64(len(extra)))...)
+	}
+	if flags&0x2 != 0 {
+		h = append(h, rarVint(uint64(dataSize))...)
+	}
+	h = append(h, body...)
+	h = append(h, extra...)
+	h = append(rarVint(uint64(len(h))), h...)
+	return append(binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(h)), h...)
+}
+
+// rarVint はRAR5の可変長整数（下位7ビットずつ、上位ビットが継続のフラグ）を作成します
+func rarVint(v uint64) []byte {
+	var b []byte
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
@@ -0,0 +1,246 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"runtime"
+	"strings"
+	"sync"
+
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// ErrSearchCanceled は内容の検索が中止されたことを示すエラーです
+var ErrSearchCanceled = errors.New("検索を中止しました")
+
+// errEncryptedEntry はパスワードがないため暗号化されたファイルの内容を読み取れないことを示すエラーです
+var errEncryptedEntry = errors.New("暗号化されているため内容を読み取れません")
+
+// SearchOptions はアーカイブ内のファイルの内容を検索する際のオプションです
+type SearchOptions struct {
+	Matcher    *common.ContentMatcher
+	SkipBinary bool                   // バイナリファイルを検索しない
+	Workers    int                    // 同時に展開・検索するファイルの数（0以下の場合はCPUの数）
+	Include    func(path string) bool // 検索するファイル（nilの場合はすべて）
+	// OpenEncrypted は暗号化されたZIPのエントリを開く関数です（nilの場合、暗号化されたエントリは検索せずに記録します）
+	// 複数のファイルを同時に検索するため、並行して呼び出されます
+	OpenEncrypted func(f *zip.File) (io.ReadCloser, error)
+	// Progress は検索したファイルの数（ZIP以外の形式では total は0）を通知する関数です（nilの場合は通知しない）
+	Progress func(done, total int)
+	// Cancel を閉じると検索を中止します（nilの場合は中止しない）
+	Cancel <-chan struct{}
+}
+
+// SearchHit は検索に一致したファイルです
+type SearchHit struct {
+	Path string // UTF-8に変換して正規化したパス（Entry.Path と同じ）
+	*common.TextMatches
+}
+
+// SearchSkip は検索できなかったファイルとその理由です
+type SearchSkip struct {
+	Path   string
+	Reason string
+}
+
+// SearchResult はアーカイブ内のファイルの内容の検索結果です
+type SearchResult struct {
+	Hits     []SearchHit  // 一致したファイル（アーカイブ内の順）
+	Searched int          // 検索したファイルの数
+	Binary   int          // バイナリファイルのため検索しなかったファイルの数
+	Skipped  []SearchSkip // 読み取れなかったファイル（暗号化されたものなど）
+}
+
+// searchJob は検索するファイルひとつです
+// ZIPは各ワーカーが open で開いて展開し、ZIP以外の形式は先頭から順に読み取った data を渡します
+type searchJob struct {
+	index int
+	path  string
+	open  func() (io.ReadCloser, error)
+	data  []byte
+	err   error // 読み取りに失敗した場合のエラー
+}
+
+// searchOutcome は検索したファイルひとつの結果です
+type searchOutcome struct {
+	path    string
+	matches *common.TextMatches
+	err     error
+}
+
+// SearchContent はアーカイブ内のファイルを展開しながら内容を検索します
+// ZIPは複数のファイルを並行して展開・検索します。ZIP以外の形式は先頭から順に読み取り、検索だけを並行して行います
+// 中止された場合は、それまでの結果とともに ErrSearchCanceled を返します
+func SearchContent(filePath string, format Format, opts SearchOptions) (*SearchResult, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	jobs := make(chan searchJob, workers)
+	var outcomes []searchOutcome
+	var mu sync.Mutex
+	done := 0
+	total := 0
+
+	// ワーカーは jobs のファイルを検索し、結果を outcomes の同じ位置に記録する
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				out := searchOutcome{path: job.path}
+				if !canceled(opts.Cancel) {
+					out.matches, out.err = searchEntry(job, opts)
+				}
+				mu.Lock()
+				for len(outcomes) <= job.index {
+					outcomes = append(outcomes, searchOutcome{})
+				}
+				outcomes[job.index] = out
+				done++
+				if opts.Progress != nil {
+					opts.Progress(done, total)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var err error
+	if format == FormatZip {
+		// ワーカーがエントリを展開し終えるまでZIPファイルを閉じない
+		var reader *zipfmt.ReadCloser
+		if reader, err = zipfmt.OpenReader(filePath); err == nil {
+			defer reader.Close()
+			produceZipJobs(reader, opts, jobs, func(n int) {
+				mu.Lock()
+				total = n
+				mu.Unlock()
+			})
+		}
+	} else {
+		err = produceArchiveJobs(filePath, format, opts, jobs)
+	}
+	close(jobs)
+	wg.Wait()
+
+	result := &SearchResult{}
+	for _, out := range outcomes {
+		switch {
+		case out.path == "":
+		case out.err != nil:
+			result.Skipped = append(result.Skipped, SearchSkip{Path: out.path, Reason: out.err.Error()})
+		case out.matches == nil:
+		case out.matches.Binary && opts.SkipBinary:
+			result.Binary++
+		default:
+			result.Searched++
+			if len(out.matches.Matches) > 0 {
+				result.Hits = append(result.Hits, SearchHit{Path: out.path, TextMatches: out.matches})
+			}
+		}
+	}
+	if err == nil && canceled(opts.Cancel) {
+		err = ErrSearchCanceled
+	}
+	return result, err
+}
+
+// searchEntry はファイルひとつを検索します
+func searchEntry(job searchJob, opts SearchOptions) (*common.TextMatches, error) {
+	if job.err != nil {
+		return nil, job.err
+	}
+	if job.open == nil {
+		return opts.Matcher.SearchReader(bytes.NewReader(job.data), opts.SkipBinary)
+	}
+	rc, err := job.open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return opts.Matcher.SearchReader(rc, opts.SkipBinary)
+}
+
+// produceZipJobs はZIPファイルの検索するエントリを jobs に渡します
+func produceZipJobs(reader *zipfmt.ReadCloser, opts SearchOptions, jobs chan<- searchJob, setTotal func(n int)) {
+	var files []*zip.File
+	var paths []string
+	for _, f := range reader.File {
+		p := CleanPath(f.Name, strings.HasSuffix(f.Name, "/"))
+		if p == "" || strings.HasSuffix(p, "/") || f.Mode()&fs.ModeSymlink != 0 {
+			continue
+		}
+		if opts.Include != nil && !opts.Include(p) {
+			continue
+		}
+		files = append(files, f)
+		paths = append(paths, p)
+	}
+	setTotal(len(files))
+
+	for i, f := range files {
+		if canceled(opts.Cancel) {
+			break
+		}
+		job := searchJob{index: i, path: paths[i]}
+		if f.Flags&zipfmt.FlagEncrypted != 0 {
+			if opts.OpenEncrypted == nil {
+				job.err = errEncryptedEntry
+			} else {
+				job.open = func() (io.ReadCloser, error) { return opts.OpenEncrypted(f) }
+			}
+		} else {
+			job.open = func() (io.ReadCloser, error) { return zipfmt.OpenFile(f) }
+		}
+		jobs <- job
+	}
+}
+
+// produceArchiveJobs はZIP以外の形式のアーカイブのファイルを先頭から順に読み取り、jobs に渡します
+func produceArchiveJobs(filePath string, format Format, opts SearchOptions, jobs chan<- searchJob) error {
+	index := 0
+	err := Walk(filePath, format, func(e *Entry, r io.Reader) error {
+		if canceled(opts.Cancel) {
+			return ErrSearchCanceled
+		}
+		if e.IsDir() || e.Mode&fs.ModeSymlink != 0 || e.Hardlink {
+			return nil
+		}
+		if opts.Include != nil && !opts.Include(e.Path) {
+			return nil
+		}
+		job := searchJob{index: index, path: e.Path}
+		index++
+		if e.Encrypted {
+			job.err = errEncryptedEntry
+		} else {
+			job.data, job.err = io.ReadAll(r)
+		}
+		jobs <- job
+		return nil
+	})
+	if errors.Is(err, ErrSearchCanceled) {
+		return nil
+	}
+	return err
+}
+
+// canceled は検索が中止されたかどうかを返します
+func canceled(cancel <-chan struct{}) bool {
+	if cancel == nil {
+		return false
+	}
+	select {
+	case <-cancel:
+		return true
+	default:
+		return false
+	}
+}
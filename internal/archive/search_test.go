@@ -0,0 +1,175 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// searchTestFiles は内容の検索に使うファイルです
+var searchTestFiles = []testFile{
+	{name: "docs/", mode: fs.ModeDir | 0o755},
+	{name: "docs/a.txt", data: "1行目\n検索する文字列\n3行目\n", method: zip.Deflate},
+	{name: "docs/b.md", data: "一致しない\n"},
+	{name: "docs/link", data: "a.txt", mode: fs.ModeSymlink | 0o777},
+	{name: "bin/data.bin", data: "\x00\x01検索する文字列\n"},
+	{name: "c.txt", data: strings.Repeat("行\n", 100) + "ここでも検索\n", method: zip.Deflate},
+}
+
+func TestSearchContent(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := writeTestZip(t, dir, "a.zip", searchTestFiles)
+	var tarEntries []tarTestEntry
+	for _, f := range searchTestFiles {
+		hdr := tar.Header{Name: f.name, Typeflag: tar.TypeReg, Mode: 0o644}
+		switch {
+		case f.mode.IsDir():
+			hdr.Typeflag = tar.TypeDir
+		case f.mode&fs.ModeSymlink != 0:
+			hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, f.data
+			f.data = ""
+		}
+		tarEntries = append(tarEntries, tarTestEntry{hdr: hdr, data: f.data})
+	}
+	tarEntries = append(tarEntries, tarTestEntry{hdr: tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "docs/a.txt"}})
+	tarPath := writeTarEntries(t, dir, "a.tar.gz", CompressionGzip, tarEntries)
+
+	tests := []struct {
+		name       string
+		skipBinary bool
+		include    func(path string) bool
+		hits       string // 一致したファイルと行番号
+		searched   int
+		binary     int
+	}{
+		{name: "すべて", hits: "docs/a.txt:2,bin/data.bin:1,c.txt:101", searched: 4},
+		{name: "バイナリを除外", skipBinary: true, hits: "docs/a.txt:2,c.txt:101", searched: 3, binary: 1},
+		{name: "対象を絞り込む", include: func(p string) bool { return strings.HasPrefix(p, "docs/") }, hits: "docs/a.txt:2", searched: 2},
+	}
+	for _, file := range []struct {
+		path   string
+		format Format
+	}{{zipPath, FormatZip}, {tarPath, FormatTar}} {
+		for _, tt := range tests {
+			for _, workers := range []int{1, 4} {
+				t.Run(file.format.String()+"/"+tt.name, func(t *testing.T) {
+					matcher, err := common.CompileContentSearch(common.ContentSearchOptions{Pattern: "検索"})
+					if err != nil {
+						t.Fatal(err)
+					}
+					var mu sync.Mutex
+					progress := 0
+					result, err := SearchContent(file.path, file.format, SearchOptions{
+						Matcher:    matcher,
+						SkipBinary: tt.skipBinary,
+						Workers:    workers,
+						Include:    tt.include,
+						Progress: func(done, total int) {
+							mu.Lock()
+							progress = max(progress, done)
+							mu.Unlock()
+						},
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+					var hits []string
+					for _, h := range result.Hits {
+						for _, m := range h.Matches {
+							hits = append(hits, h.Path+":"+strconv.Itoa(m.Line))
+						}
+					}
+					if strings.Join(hits, ",") != tt.hits || result.Searched != tt.searched || result.Binary != tt.binary || len(result.Skipped) != 0 {
+						t.Errorf("一致 %q 検索 %d バイナリ %d 読み取れない %v, want %q 検索 %d バイナリ %d", hits, result.Searched, result.Binary, result.Skipped, tt.hits, tt.searched, tt.binary)
+					}
+					if progress != tt.searched+tt.binary {
+						t.Errorf("進捗 = %d, want %d", progress, tt.searched+tt.binary)
+					}
+				})
+			}
+		}
+	}
+}
+
+// 暗号化されたエントリは、開く関数がなければ読み取れなかったファイルとして記録する
+func TestSearchContentEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.zip")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	w, err := zw.CreateRaw(&zip.FileHeader{Name: "secret.txt", Flags: zipfmt.FlagEncrypted, CompressedSize64: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(make([]byte, 12)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	matcher, err := common.CompileContentSearch(common.ContentSearchOptions{Pattern: "秘密"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := SearchContent(path, FormatZip, SearchOptions{Matcher: matcher})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].Path != "secret.txt" || result.Skipped[0].Reason != errEncryptedEntry.Error() {
+		t.Errorf("読み取れなかったファイル = %+v", result.Skipped)
+	}
+
+	result, err = SearchContent(path, FormatZip, SearchOptions{
+		Matcher: matcher,
+		OpenEncrypted: func(f *zip.File) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("秘密の内容")), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Hits) != 1 || result.Searched != 1 || len(result.Skipped) != 0 {
+		t.Errorf("開く関数を指定した場合 = %+v", result)
+	}
+}
+
+// 中止した場合は ErrSearchCanceled を返す
+func TestSearchContentCanceled(t *testing.T) {
+	dir := t.TempDir()
+	cancel := make(chan struct{})
+	close(cancel)
+	matcher, err := common.CompileContentSearch(common.ContentSearchOptions{Pattern: "検索"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		path   string
+		format Format
+	}{
+		{writeTestZip(t, dir, "a.zip", searchTestFiles), FormatZip},
+		{writeTestTar(t, dir, "a.tar", []testFile{{name: "a.txt", data: "検索"}}), FormatTar},
+	} {
+		result, err := SearchContent(tt.path, tt.format, SearchOptions{Matcher: matcher, Cancel: cancel})
+		if !errors.Is(err, ErrSearchCanceled) {
+			t.Errorf("%s: err = %v, want %v", tt.format, err, ErrSearchCanceled)
+		}
+		if result == nil || len(result.Hits) != 0 {
+			t.Errorf("%s: 結果 = %+v", tt.format, result)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+)
+
+// errSevenZipEncrypted は暗号化された7zアーカイブを読み取ろうとした場合のエラーです
+var errSevenZipEncrypted = errors.New("暗号化された7zアーカイブの展開には対応していません")
+
+// sevenZipError は暗号化による7zの読み取りエラーを日本語のメッセージに置き換えます
+func sevenZipError(err error) error {
+	var readErr *sevenzip.ReadError
+	if errors.As(err, &readErr) && readErr.Encrypted {
+		return errSevenZipEncrypted
+	}
+	return err
+}
+
+// entriesFromSevenZip は7zのファイル一覧からエントリの情報を作成します
+// 同じストリーム（フォルダ）に複数のファイルが格納されている場合は、ソリッド圧縮として扱います
+func entriesFromSevenZip(files []*sevenzip.File) []*Entry {
+	filesPerStream := make(map[int]int)
+	for _, f := range files {
+		if hasSevenZipStream(f) {
+			filesPerStream[f.Stream]++
+		}
+	}
+
+	entries := make([]*Entry, len(files))
+	for i, f := range files {
+		mode := f.Mode()
+		e := &Entry{
+			Path:     CleanPath(f.Name, mode.IsDir()),
+			Size:     int64(f.UncompressedSize),
+			Modified: f.Modified,
+			Mode:     mode,
+		}
+		if hasSevenZipStream(f) && filesPerStream[f.Stream] > 1 {
+			e.Solid = true
+			e.Block = f.Stream
+		}
+		if e.Path != "" {
+			entries[i] = e
+		}
+	}
+	return entries
+}
+
+// hasSevenZipStream はファイルが圧縮されたデータを持つかどうかを返します
+// ディレクトリと空のファイルはデータを持たず、Stream は意味を持ちません
+func hasSevenZipStream(f *sevenzip.File) bool {
+	return !f.Mode().IsDir() && f.UncompressedSize > 0
+}
+
+// readSevenZipEntries は7zアーカイブのエントリ一覧を読み込みます
+func readSevenZipEntries(filePath string) ([]*Entry, error) {
+	reader, err := sevenzip.OpenReader(filePath)
+	if err != nil {
+		return nil, sevenZipError(err)
+	}
+	defer reader.Close()
+
+	var entries []*Entry
+	for _, e := range entriesFromSevenZip(reader.File) {
+		if e != nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// walkSevenZip は7zアーカイブのエントリを格納順に fn に渡します
+// ソリッドブロックは格納順に読み進めることで、ブロックの先頭から展開し直さずに済みます
+func walkSevenZip(filePath string, fn func(e *Entry, r io.Reader) error) error {
+	reader, err := sevenzip.OpenReader(filePath)
+	if err != nil {
+		return sevenZipError(err)
+	}
+	defer reader.Close()
+
+	for i, e := range entriesFromSevenZip(reader.File) {
+		if e == nil {
+			continue
+		}
+		if err := walkSevenZipEntry(reader.File[i], e, fn); err != nil {
+			return fmt.Errorf("%s: %w", e.Path, err)
+		}
+	}
+	return nil
+}
+
+// walkSevenZipEntry は7zのエントリをひとつ開いて fn に渡します
+func walkSevenZipEntry(f *sevenzip.File, e *Entry, fn func(e *Entry, r io.Reader) error) error {
+	if e.IsDir() {
+		return fn(e, strings.NewReader(""))
+	}
+
+	f7, err := f.Open()
+	if err != nil {
+		return sevenZipError(err)
+	}
+	defer f7.Close()
+	rc := sevenZipReader{f7}
+
+	// シンボリックリンクはデータに参照先が格納されている
+	if e.Mode&fs.ModeSymlink != 0 {
+		target, err := io.ReadAll(io.LimitReader(rc, maxSymlinkTarget))
+		if err != nil {
+			return err
+		}
+		e.Linkname = string(target)
+		e.Size = 0
+		return fn(e, strings.NewReader(""))
+	}
+	return fn(e, rc)
+}
+
+// openSevenZipEntry は7zアーカイブ内のエントリを読み取るリーダーを返します
+func openSevenZipEntry(filePath, entryPath string) (io.ReadCloser, error) {
+	reader, err := sevenzip.OpenReader(filePath)
+	if err != nil {
+		return nil, sevenZipError(err)
+	}
+	for i, e := range entriesFromSevenZip(reader.File) {
+		if e == nil || e.Path != entryPath {
+			continue
+		}
+		rc, err := reader.File[i].Open()
+		if err != nil {
+			reader.Close()
+			return nil, sevenZipError(err)
+		}
+		return sevenZipEntryReader{Reader: sevenZipReader{rc}, file: rc, reader: reader}, nil
+	}
+	reader.Close()
+	return nil, os.ErrNotExist
+}
+
+// sevenZipEntryReader は7zアーカイブ内のひとつのエントリを読み取り、閉じるとアーカイブも閉じるリーダーです
+type sevenZipEntryReader struct {
+	io.Reader
+	file   io.Closer
+	reader *sevenzip.ReadCloser
+}
+
+func (r sevenZipEntryReader) Close() error {
+	r.file.Close()
+	return r.reader.Close()
+}
+
+// sevenZipReader は7zのエントリの読み取りエラーを日本語のメッセージに置き換えるリーダーです
+type sevenZipReader struct {
+	r io.Reader
+}
+
+func (r sevenZipReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = sevenZipError(err)
+	}
+	return n, err
+}
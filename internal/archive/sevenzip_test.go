@@ -0,0 +1,134 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testdata の7zファイルは github.com/bodgit/sevenzip のテストデータです（testdata/README.md を参照）
+
+func TestReadSevenZipEntries(t *testing.T) {
+	solidNames := make([]string, 10)
+	for i := range solidNames {
+		solidNames[i] = fmt.Sprintf("%02d", i+1)
+	}
+	tests := []struct {
+		file  string
+		paths []string
+		dirs  int  // 先頭から何件がディレクトリか
+		solid bool // データを持つエントリがソリッド圧縮か
+	}{
+		{file: "nonsolid.7z", paths: []string{"bar", "foo"}},
+		{file: "solid.7z", paths: solidNames, solid: true},
+		{file: "empty.7z", paths: []string{"01/", "02/", "03/", "04/", "05/", "06", "07", "08", "09", "10"}, dirs: 5},
+		// ヘッダーが暗号化されていなければ、データが暗号化されていても一覧は読み込める
+		{file: "encrypted.7z", paths: []string{"bar", "foo"}, solid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			path := filepath.Join("testdata", tt.file)
+			if format, comp, err := Detect(path); err != nil || format != FormatSevenZip || comp != CompressionNone {
+				t.Errorf("Detect = %v, %v, %v, want 7z", format, comp, err)
+			}
+			entries, err := ReadEntries(path, FormatSevenZip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var paths []string
+			for i, e := range entries {
+				paths = append(paths, e.Path)
+				if e.IsDir() != (i < tt.dirs) {
+					t.Errorf("%s: IsDir = %v", e.Path, e.IsDir())
+				}
+				if e.Solid != (tt.solid && e.Size > 0) || e.Block != 0 {
+					t.Errorf("%s: Solid = %v, Block = %d", e.Path, e.Solid, e.Block)
+				}
+				if e.Modified.IsZero() {
+					t.Errorf("%s: 更新日時がありません", e.Path)
+				}
+			}
+			if strings.Join(paths, ",") != strings.Join(tt.paths, ",") {
+				t.Errorf("エントリ = %q, want %q", paths, tt.paths)
+			}
+		})
+	}
+}
+
+// 格納順に読み進めた内容と、エントリをひとつずつ開いた内容が一致する
+func TestWalkSevenZip(t *testing.T) {
+	for _, file := range []string{"nonsolid.7z", "solid.7z", "empty.7z"} {
+		t.Run(file, func(t *testing.T) {
+			path := filepath.Join("testdata", file)
+			walked := make(map[string]string)
+			err := Walk(path, FormatSevenZip, func(e *Entry, r io.Reader) error {
+				data, err := io.ReadAll(r)
+				if err != nil {
+					return err
+				}
+				if int64(len(data)) != e.Size {
+					t.Errorf("%s: %d バイト, want %d", e.Path, len(data), e.Size)
+				}
+				walked[e.Path] = string(data)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, data := range walked {
+				if strings.HasSuffix(name, "/") {
+					continue
+				}
+				checkEntryData(t, path, FormatSevenZip, map[string]string{name: data})
+			}
+		})
+	}
+	checkEntryData(t, filepath.Join("testdata", "nonsolid.7z"), FormatSevenZip, map[string]string{"bar": "bar\n", "foo": "foo\n"})
+	if _, err := OpenEntry(filepath.Join("testdata", "nonsolid.7z"), FormatSevenZip, "missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("存在しないエントリ: err = %v, want ErrNotExist", err)
+	}
+}
+
+// 暗号化された7zアーカイブは、ライブラリの英語のエラーではなく説明を添えたエラーになる
+func TestSevenZipEncrypted(t *testing.T) {
+	path := filepath.Join("testdata", "encrypted.7z")
+	err := Walk(path, FormatSevenZip, func(e *Entry, r io.Reader) error {
+		_, err := io.ReadAll(r)
+		return err
+	})
+	if !errors.Is(err, errSevenZipEncrypted) {
+		t.Errorf("Walk: err = %v, want %v", err, errSevenZipEncrypted)
+	}
+	if rc, err := OpenEntry(path, FormatSevenZip, "foo"); err == nil {
+		_, err = io.ReadAll(rc)
+		rc.Close()
+		if !errors.Is(err, errSevenZipEncrypted) {
+			t.Errorf("OpenEntry: err = %v, want %v", err, errSevenZipEncrypted)
+		}
+	} else if !errors.Is(err, errSevenZipEncrypted) {
+		t.Errorf("OpenEntry: err = %v, want %v", err, errSevenZipEncrypted)
+	}
+
+	if _, err := ReadEntries(filepath.Join("testdata", "encrypted-header.7z"), FormatSevenZip); !errors.Is(err, errSevenZipEncrypted) {
+		t.Errorf("ヘッダーが暗号化されたアーカイブ: err = %v, want %v", err, errSevenZipEncrypted)
+	}
+}
+
+// 途中で切れた7zアーカイブは読み込めない
+func TestReadSevenZipTruncated(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "solid.7z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "a.7z")
+	if err := os.WriteFile(path, data[:len(data)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadEntries(path, FormatSevenZip); err == nil {
+		t.Error("途中で切れたアーカイブを読み込めてしまいました")
+	}
+}
@@ -0,0 +1,351 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	dsbzip2 "github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// tarBlockSize はtarのヘッダー・データのブロックサイズです
+const tarBlockSize = 512
+
+// maxLinkDepth はエントリを開く際にたどるリンクの深さの上限です
+const maxLinkDepth = 8
+
+// ストリームの圧縮方式を示す先頭のバイト列（マジックナンバー）
+var compressionMagics = []struct {
+	magic []byte
+	comp  Compression
+}{
+	{[]byte{0x1F, 0x8B}, CompressionGzip},
+	{[]byte("BZh"), CompressionBzip2},
+	{[]byte{0xFD, '7', 'z', 'X', 'Z', 0x00}, CompressionXZ},
+	{[]byte{0x28, 0xB5, 0x2F, 0xFD}, CompressionZstd},
+}
+
+// detectCompression は先頭のバイト列からストリームの圧縮方式を判定します
+func detectCompression(head []byte) Compression {
+	for _, m := range compressionMagics {
+		if bytes.HasPrefix(head, m.magic) {
+			return m.comp
+		}
+	}
+	return CompressionNone
+}
+
+// isTarHeader はブロックがtarのヘッダーかどうかをチェックサムで判定します
+func isTarHeader(block []byte) bool {
+	if len(block) < tarBlockSize {
+		return false
+	}
+	field := strings.Trim(string(block[148:156]), " \x00")
+	stored, err := strconv.ParseUint(field, 8, 32)
+	if err != nil {
+		return false
+	}
+
+	// チェックサムの欄は空白とみなして合計する（古い実装の符号付きの合計も許容する）
+	var unsigned, signed int64
+	for i, b := range block[:tarBlockSize] {
+		if i >= 148 && i < 156 {
+			b = ' '
+		}
+		unsigned += int64(b)
+		signed += int64(int8(b))
+	}
+	return int64(stored) == unsigned || int64(stored) == signed
+}
+
+// newDecompressor は圧縮方式に対応する展開リーダーを返します
+func newDecompressor(r io.Reader, comp Compression) (io.ReadCloser, error) {
+	switch comp {
+	case CompressionNone:
+		return io.NopCloser(r), nil
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionBzip2:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	case CompressionXZ:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("圧縮方式 %s には対応していません", comp)
+}
+
+// newCompressor は圧縮方式に対応する圧縮ライターを返します
+// Close は圧縮データの終端を書き込みますが、w は閉じません
+func newCompressor(w io.Writer, comp Compression) (io.WriteCloser, error) {
+	switch comp {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	case CompressionBzip2:
+		return dsbzip2.NewWriter(w, &dsbzip2.WriterConfig{Level: dsbzip2.DefaultCompression})
+	case CompressionXZ:
+		return xz.NewWriter(w)
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("圧縮方式 %s には対応していません", comp)
+}
+
+// nopWriteCloser は何もしない Close を持つライターです
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// tarStream は開いているtarアーカイブのストリームです
+type tarStream struct {
+	*tar.Reader
+	file *os.File
+	dec  io.ReadCloser
+	comp Compression
+}
+
+// openTar はtarアーカイブを開き、圧縮されている場合は展開しながら読み取るストリームを返します
+func openTar(filePath string) (*tarStream, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	head, _ := br.Peek(8)
+	comp := detectCompression(head)
+	dec, err := newDecompressor(br, comp)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &tarStream{Reader: tar.NewReader(dec), file: f, dec: dec, comp: comp}, nil
+}
+
+// Close はストリームと元のファイルを閉じます
+func (s *tarStream) Close() error {
+	s.dec.Close()
+	return s.file.Close()
+}
+
+// entryFromHeader はtarのヘッダーからエントリの情報を作成します
+// pax形式のグローバルヘッダーなど、ファイルを表さないヘッダーの場合はnilを返します
+func entryFromHeader(hdr *tar.Header) *Entry {
+	switch hdr.Typeflag {
+	case tar.TypeXGlobalHeader, tar.TypeGNULongName, tar.TypeGNULongLink, 'V':
+		return nil
+	}
+	e := &Entry{
+		Path:     CleanPath(hdr.Name, hdr.Typeflag == tar.TypeDir),
+		Size:     hdr.Size,
+		Modified: hdr.ModTime,
+		Mode:     hdr.FileInfo().Mode(),
+		Uid:      hdr.Uid,
+		Gid:      hdr.Gid,
+		Uname:    hdr.Uname,
+		Gname:    hdr.Gname,
+		header:   hdr,
+	}
+	switch hdr.Typeflag {
+	case tar.TypeSymlink:
+		e.Linkname = hdr.Linkname
+		e.Size = 0
+	case tar.TypeLink:
+		// ハードリンクの参照先はアーカイブ内のパスなので同じように正規化する
+		e.Linkname = CleanPath(hdr.Linkname, false)
+		e.Hardlink = true
+		e.Size = 0
+	}
+	if e.Path == "" {
+		return nil
+	}
+	return e
+}
+
+// walkTar はtarアーカイブのエントリを先頭から順に fn に渡します
+func walkTar(filePath string, fn func(e *Entry, r io.Reader) error) error {
+	stream, err := openTar(filePath)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	for {
+		hdr, err := stream.Next()
+		if err == io.EOF {
+			// 圧縮の終端（gzipのCRCなど）まで読み取り、ストリームが壊れていないことを確認する
+			_, err = io.Copy(io.Discard, stream.dec)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		e := entryFromHeader(hdr)
+		if e == nil {
+			continue
+		}
+		if err := fn(e, stream); err != nil {
+			return err
+		}
+	}
+}
+
+// readTarEntries はtarアーカイブのエントリ一覧を読み込みます
+func readTarEntries(filePath string) ([]*Entry, error) {
+	var entries []*Entry
+	err := walkTar(filePath, func(e *Entry, r io.Reader) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// openTarEntry はtarアーカイブ内のエントリを読み取るリーダーを返します
+// tarはエントリの位置を持たないため、先頭から順に探します
+// リンクの場合は、アーカイブ内の参照先のエントリを開きます
+func openTarEntry(filePath, entryPath string) (io.ReadCloser, error) {
+	for range maxLinkDepth {
+		stream, err := openTar(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		var found *Entry
+		for found == nil {
+			hdr, err := stream.Next()
+			if err == io.EOF {
+				stream.Close()
+				return nil, os.ErrNotExist
+			}
+			if err != nil {
+				stream.Close()
+				return nil, err
+			}
+			if e := entryFromHeader(hdr); e != nil && e.Path == entryPath {
+				found = e
+			}
+		}
+
+		switch {
+		case found.Hardlink:
+			entryPath = found.Linkname
+		case found.Linkname != "":
+			entryPath = CleanPath(path.Join(path.Dir(entryPath), found.Linkname), false)
+		case found.IsDir():
+			stream.Close()
+			return nil, fmt.Errorf("%s はディレクトリです", entryPath)
+		default:
+			return tarEntryReader{Reader: stream, stream: stream}, nil
+		}
+		stream.Close()
+	}
+	return nil, fmt.Errorf("%s: リンクが多すぎます", entryPath)
+}
+
+// tarEntryReader はtarアーカイブ内のひとつのエントリを読み取り、閉じるとアーカイブも閉じるリーダーです
+type tarEntryReader struct {
+	io.Reader
+	stream *tarStream
+}
+
+func (r tarEntryReader) Close() error {
+	return r.stream.Close()
+}
+
+// RewriteTar はtarアーカイブのエントリを選んで、元と同じ圧縮方式で w に書き直します
+// keep がfalseを返したエントリは書き込みません。ヘッダーは元のものを引き継ぐため、
+// PAX・GNU形式の長い名前、リンク、所有者、パーミッションなどはそのまま保たれます
+func RewriteTar(filePath string, w io.Writer, keep func(e *Entry) bool) error {
+	stream, err := openTar(filePath)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	cw, err := newCompressor(w, stream.comp)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(cw)
+
+	removed := make(map[string]bool)
+	for {
+		hdr, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if e := entryFromHeader(hdr); e != nil {
+			if !keep(e) {
+				removed[e.Path] = true
+				continue
+			}
+			// 参照先が削除されたハードリンクは展開できなくなるため保存しない
+			if e.Hardlink && removed[e.Linkname] {
+				return fmt.Errorf("%s: ハードリンクの参照先 %s を削除することはできません", e.Path, e.Linkname)
+			}
+		}
+
+		if err := writeTarHeader(tw, hdr); err != nil {
+			return fmt.Errorf("%s: %w", CleanPath(hdr.Name, false), err)
+		}
+		if _, err := io.Copy(tw, stream); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// writeTarHeader は読み込んだヘッダーを書き込みます
+// スパースファイルは展開した内容で通常のファイルとして書き込みます
+// 元の形式で表現できない場合は、表現できる形式を自動で選びます
+func writeTarHeader(tw *tar.Writer, hdr *tar.Header) error {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		hdr.Typeflag = tar.TypeReg
+	}
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			delete(hdr.PAXRecords, key)
+		}
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		if hdr.Format == tar.FormatUnknown {
+			return err
+		}
+		hdr.Format = tar.FormatUnknown
+		return tw.WriteHeader(hdr)
+	}
+	return nil
+}
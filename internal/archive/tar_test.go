@@ -0,0 +1,348 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tarTestEntry はテスト用のtarアーカイブに格納するエントリ（ヘッダーと内容）です
+type tarTestEntry struct {
+	hdr  tar.Header
+	data string
+}
+
+// longName はtarのヘッダーの名前の欄（100バイト）に収まらない長いパスです
+var longName = strings.Repeat("長い名前のフォルダ/", 8) + "file.txt"
+
+// tarTestEntries はディレクトリ・リンク・長い名前・所有者を含むエントリです
+var tarTestEntries = []tarTestEntry{
+	{hdr: tar.Header{Name: "./dir/", Typeflag: tar.TypeDir, Mode: 0o755}},
+	{hdr: tar.Header{Name: "./dir/a.txt", Typeflag: tar.TypeReg, Mode: 0o640, Uid: 1000, Gid: 100, Uname: "alice", Gname: "users"}, data: "aの内容"},
+	{hdr: tar.Header{Name: "dir/run.sh", Typeflag: tar.TypeReg, Mode: 0o755}, data: "#!/bin/sh\necho run\n"},
+	{hdr: tar.Header{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "a.txt", Mode: 0o777}},
+	{hdr: tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "./dir/a.txt", Mode: 0o640}},
+	{hdr: tar.Header{Name: longName, Typeflag: tar.TypeReg, Mode: 0o644}, data: "長い名前"},
+	{hdr: tar.Header{Name: "empty.txt", Typeflag: tar.TypeReg, Mode: 0o644}},
+}
+
+// tarCompressions はテストするストリームの圧縮方式と拡張子です
+var tarCompressions = []struct {
+	comp Compression
+	ext  string
+}{
+	{CompressionNone, ".tar"},
+	{CompressionGzip, ".tar.gz"},
+	{CompressionBzip2, ".tar.bz2"},
+	{CompressionXZ, ".tar.xz"},
+	{CompressionZstd, ".tar.zst"},
+}
+
+func TestReadTarEntries(t *testing.T) {
+	for _, c := range tarCompressions {
+		t.Run(c.comp.String(), func(t *testing.T) {
+			path := writeTarEntries(t, t.TempDir(), "a"+c.ext, c.comp, tarTestEntries)
+			format, comp, err := Detect(path)
+			if err != nil || format != FormatTar || comp != c.comp {
+				t.Fatalf("Detect = %v, %v, %v, want tar, %v", format, comp, err, c.comp)
+			}
+
+			entries, err := ReadEntries(path, FormatTar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []struct {
+				path     string
+				mode     fs.FileMode
+				size     int64
+				linkname string
+				hardlink bool
+				owner    string
+			}{
+				{path: "dir/", mode: fs.ModeDir | 0o755, owner: "0/0"},
+				{path: "dir/a.txt", mode: 0o640, size: int64(len("aの内容")), owner: "alice/users"},
+				{path: "dir/run.sh", mode: 0o755, size: 19, owner: "0/0"},
+				{path: "dir/link", mode: fs.ModeSymlink | 0o777, linkname: "a.txt", owner: "0/0"},
+				{path: "hard", linkname: "dir/a.txt", hardlink: true, owner: "0/0"},
+				{path: longName, mode: 0o644, size: int64(len("長い名前")), owner: "0/0"},
+				{path: "empty.txt", mode: 0o644, owner: "0/0"},
+			}
+			if len(entries) != len(want) {
+				t.Fatalf("エントリ数 = %d, want %d", len(entries), len(want))
+			}
+			for i, e := range entries {
+				w := want[i]
+				if e.Path != w.path || e.Size != w.size || e.Linkname != w.linkname || e.Hardlink != w.hardlink || e.Owner() != w.owner {
+					t.Errorf("%d: %s サイズ %d 参照先 %q ハードリンク %v 所有者 %s, want %+v", i, e.Path, e.Size, e.Linkname, e.Hardlink, e.Owner(), w)
+				}
+				if !w.hardlink && e.Mode != w.mode {
+					t.Errorf("%s: Mode = %v, want %v", e.Path, e.Mode, w.mode)
+				}
+				if !e.Modified.Equal(testTime) {
+					t.Errorf("%s: 更新日時 = %v, want %v", e.Path, e.Modified, testTime)
+				}
+			}
+
+			// リンクは参照先の内容を読み取る
+			for _, tt := range []struct{ path, want string }{
+				{"dir/a.txt", "aの内容"},
+				{"dir/link", "aの内容"},
+				{"hard", "aの内容"},
+				{longName, "長い名前"},
+				{"empty.txt", ""},
+			} {
+				rc, err := OpenEntry(path, FormatTar, tt.path)
+				if err != nil {
+					t.Errorf("OpenEntry(%s): %v", tt.path, err)
+					continue
+				}
+				got, err := io.ReadAll(rc)
+				rc.Close()
+				if err != nil || string(got) != tt.want {
+					t.Errorf("OpenEntry(%s) = %q, %v, want %q", tt.path, got, err, tt.want)
+				}
+			}
+			if _, err := OpenEntry(path, FormatTar, "dir/"); err == nil {
+				t.Error("ディレクトリを開けてしまいました")
+			}
+			if _, err := OpenEntry(path, FormatTar, "missing.txt"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("存在しないエントリ: err = %v, want ErrNotExist", err)
+			}
+		})
+	}
+}
+
+// 循環するシンボリックリンクは、たどる深さの上限でエラーになる
+func TestOpenTarEntryLinkLoop(t *testing.T) {
+	path := writeTarEntries(t, t.TempDir(), "loop.tar", CompressionNone, []tarTestEntry{
+		{hdr: tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "b"}},
+		{hdr: tar.Header{Name: "b", Typeflag: tar.TypeSymlink, Linkname: "a"}},
+	})
+	if rc, err := OpenEntry(path, FormatTar, "a"); err == nil {
+		rc.Close()
+		t.Error("循環するリンクを開けてしまいました")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	dir := t.TempDir()
+	tarData, err := os.ReadFile(writeTarEntries(t, dir, "plain.tar", CompressionNone, tarTestEntries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipData, err := os.ReadFile(writeTestZip(t, dir, "plain.zip", []testFile{{name: "a.txt", data: "a"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		data     []byte
+		want     Format
+		wantComp Compression
+		wantErr  bool
+	}{
+		{name: "ZIP", data: zipData, want: FormatZip},
+		{name: "先頭に実行ファイルが付いたZIP", data: append([]byte("MZ\x90\x00"), zipData...), want: FormatZip},
+		{name: "tar", data: tarData, want: FormatTar},
+		{name: "tar.gz", data: compress(t, CompressionGzip, tarData), want: FormatTar, wantComp: CompressionGzip},
+		{name: "tar.zst", data: compress(t, CompressionZstd, tarData), want: FormatTar, wantComp: CompressionZstd},
+		{name: "7z", data: []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C, 0, 4}, want: FormatSevenZip},
+		{name: "RAR5", data: []byte("Rar!\x1a\x07\x01\x00"), want: FormatRar},
+		{name: "RAR4", data: []byte("Rar!\x1a\x07\x00"), want: FormatRar},
+		// 中身がtarでない圧縮ファイルは開けない
+		{name: "gzipで圧縮したテキスト", data: compress(t, CompressionGzip, bytes.Repeat([]byte("text "), 200)), wantComp: CompressionGzip, wantErr: true},
+		// チェックサムが一致しないブロックはtarのヘッダーとみなさない
+		{name: "壊れたtarのヘッダー", data: append([]byte("x"), tarData[1:]...), want: FormatZip},
+		{name: "空のファイル", data: nil, want: FormatZip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "detect")
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			format, comp, err := Detect(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Detect: err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (format != tt.want || comp != tt.wantComp) {
+				t.Errorf("Detect = %v, %v, want %v, %v", format, comp, tt.want, tt.wantComp)
+			}
+		})
+	}
+}
+
+func TestFormatFromName(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		comp     Compression
+		ok       bool
+		trimmed  string
+		writable bool
+	}{
+		{name: "a.zip", format: FormatZip, ok: true, trimmed: "a", writable: true},
+		{name: "a.tar", format: FormatTar, ok: true, trimmed: "a", writable: true},
+		{name: "A.TAR.GZ", format: FormatTar, comp: CompressionGzip, ok: true, trimmed: "A", writable: true},
+		{name: "a.tgz", format: FormatTar, comp: CompressionGzip, ok: true, trimmed: "a", writable: true},
+		{name: "a.b.tar.bz2", format: FormatTar, comp: CompressionBzip2, ok: true, trimmed: "a.b", writable: true},
+		{name: "a.tbz2", format: FormatTar, comp: CompressionBzip2, ok: true, trimmed: "a", writable: true},
+		{name: "a.txz", format: FormatTar, comp: CompressionXZ, ok: true, trimmed: "a", writable: true},
+		{name: "a.tar.zst", format: FormatTar, comp: CompressionZstd, ok: true, trimmed: "a", writable: true},
+		{name: "a.7z", format: FormatSevenZip, ok: true, trimmed: "a"},
+		{name: "a.rar", format: FormatRar, ok: true, trimmed: "a"},
+		{name: "a.gz", format: FormatZip, trimmed: "a.gz", writable: true},
+		{name: ".tar", format: FormatTar, ok: true, trimmed: ".tar", writable: true},
+	}
+	for _, tt := range tests {
+		format, comp, ok := FormatFromName(tt.name)
+		if format != tt.format || comp != tt.comp || ok != tt.ok {
+			t.Errorf("FormatFromName(%q) = %v, %v, %v, want %v, %v, %v", tt.name, format, comp, ok, tt.format, tt.comp, tt.ok)
+		}
+		if got := TrimExt(tt.name); got != tt.trimmed {
+			t.Errorf("TrimExt(%q) = %q, want %q", tt.name, got, tt.trimmed)
+		}
+		if format.Writable() != tt.writable {
+			t.Errorf("%v.Writable() = %v", format, format.Writable())
+		}
+	}
+}
+
+// RewriteTar は選んだエントリだけを、元と同じ圧縮方式とヘッダーのまま書き直す
+func TestRewriteTar(t *testing.T) {
+	for _, c := range tarCompressions {
+		t.Run(c.comp.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			src := writeTarEntries(t, dir, "a"+c.ext, c.comp, tarTestEntries)
+			dst := filepath.Join(dir, "b"+c.ext)
+			out, err := os.Create(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = RewriteTar(src, out, func(e *Entry) bool { return e.Path != "dir/run.sh" && e.Path != longName })
+			out.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, comp, err := Detect(dst); err != nil || comp != c.comp {
+				t.Errorf("書き直したファイルの圧縮方式 = %v, %v, want %v", comp, err, c.comp)
+			}
+			before, err := ReadEntries(src, FormatTar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after, err := ReadEntries(dst, FormatTar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []*Entry
+			for _, e := range before {
+				if e.Path != "dir/run.sh" && e.Path != longName {
+					want = append(want, e)
+				}
+			}
+			if len(after) != len(want) {
+				t.Fatalf("エントリ数 = %d, want %d", len(after), len(want))
+			}
+			for i, e := range after {
+				w := want[i]
+				if e.Path != w.Path || e.Mode != w.Mode || e.Owner() != w.Owner() || e.Linkname != w.Linkname || !e.Modified.Equal(w.Modified) {
+					t.Errorf("%s: %+v, want %+v", e.Path, e, w)
+				}
+			}
+			rc, err := OpenEntry(dst, FormatTar, "hard")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			if got, err := io.ReadAll(rc); err != nil || string(got) != "aの内容" {
+				t.Errorf("ハードリンク = %q, %v", got, err)
+			}
+		})
+	}
+}
+
+// ハードリンクの参照先だけを削除することはできない
+func TestRewriteTarKeepsHardlinkTarget(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTarEntries(t, dir, "a.tar", CompressionNone, tarTestEntries)
+	var buf bytes.Buffer
+	if err := RewriteTar(src, &buf, func(e *Entry) bool { return e.Path != "dir/a.txt" }); err == nil {
+		t.Error("ハードリンクの参照先を削除できてしまいました")
+	}
+	// ハードリンクも一緒に削除する場合は書き直せる
+	buf.Reset()
+	if err := RewriteTar(src, &buf, func(e *Entry) bool { return e.Path != "dir/a.txt" && e.Path != "hard" }); err != nil {
+		t.Error(err)
+	}
+}
+
+// 途中で切れた圧縮ストリームは、エントリ一覧の読み込みでエラーになる
+func TestReadTarEntriesTruncated(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range tarCompressions[1:] {
+		path := writeTarEntries(t, dir, "a"+c.ext, c.comp, tarTestEntries)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data[:len(data)-8], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadEntries(path, FormatTar); err == nil {
+			t.Errorf("%s: 途中で切れたファイルを読み込めてしまいました", c.comp)
+		}
+	}
+}
+
+// writeTarEntries は dir にエントリを格納したtarアーカイブを comp で圧縮して作成し、そのパスを返します
+func writeTarEntries(t *testing.T, dir, name string, comp Compression, entries []tarTestEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.data))
+		if hdr.ModTime.IsZero() {
+			hdr.ModTime = testTime
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, compress(t, comp, buf.Bytes()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// compress は data をストリームの圧縮方式 comp で圧縮します
+func compress(t *testing.T, comp Compression, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	cw, err := newCompressor(&buf, comp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
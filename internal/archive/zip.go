@@ -0,0 +1,127 @@
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// maxSymlinkTarget はZIPのシンボリックリンクのエントリから読み込む参照先の最大長です
+const maxSymlinkTarget = 4096
+
+// entryFromZip はZIPのエントリからエントリの情報を作成します
+func entryFromZip(f *zip.File) *Entry {
+	e := &Entry{
+		Path:      CleanPath(f.Name, strings.HasSuffix(f.Name, "/")),
+		Size:      int64(f.UncompressedSize64),
+		Modified:  f.Modified,
+		Mode:      f.Mode(),
+		Comment:   common.AutoDetectEncoding(f.Comment),
+		Encrypted: f.Flags&zipfmt.FlagEncrypted != 0,
+	}
+	if uid, gid, ok := zipfmt.ParseUnixOwner(f.Extra); ok {
+		e.Uid, e.Gid = uid, gid
+	}
+	if e.Path == "" {
+		return nil
+	}
+	return e
+}
+
+// walkZip はZIPファイルのエントリを順に fn に渡します
+// 暗号化されたエントリの r は、読み取ると zipfmt.ErrUnsupportedEncryption を返します
+func walkZip(filePath string, fn func(e *Entry, r io.Reader) error) error {
+	reader, err := zipfmt.OpenReader(filePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, f := range reader.File {
+		e := entryFromZip(f)
+		if e == nil {
+			continue
+		}
+		if err := walkZipEntry(f, e, fn); err != nil {
+			return fmt.Errorf("%s: %w", e.Path, err)
+		}
+	}
+	return nil
+}
+
+// walkZipEntry はZIPのエントリをひとつ開いて fn に渡します
+func walkZipEntry(f *zip.File, e *Entry, fn func(e *Entry, r io.Reader) error) error {
+	if e.IsDir() {
+		return fn(e, strings.NewReader(""))
+	}
+	if e.Encrypted {
+		return fn(e, errReader{zipfmt.ErrUnsupportedEncryption})
+	}
+
+	rc, err := zipfmt.OpenFile(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// シンボリックリンクはデータに参照先が格納されている
+	if e.Mode&fs.ModeSymlink != 0 {
+		target, err := io.ReadAll(io.LimitReader(rc, maxSymlinkTarget))
+		if err != nil {
+			return err
+		}
+		e.Linkname = common.AutoDetectEncoding(string(target))
+		e.Size = 0
+		return fn(e, strings.NewReader(""))
+	}
+	return fn(e, rc)
+}
+
+// openZipEntry はZIPファイル内のエントリを読み取るリーダーを返します
+func openZipEntry(filePath, entryPath string) (io.ReadCloser, error) {
+	reader, err := zipfmt.OpenReader(filePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range reader.File {
+		if CleanPath(f.Name, false) != entryPath {
+			continue
+		}
+		if f.Flags&zipfmt.FlagEncrypted != 0 {
+			reader.Close()
+			return nil, zipfmt.ErrUnsupportedEncryption
+		}
+		rc, err := zipfmt.OpenFile(f)
+		if err != nil {
+			reader.Close()
+			return nil, err
+		}
+		return zipEntryReader{ReadCloser: rc, reader: reader}, nil
+	}
+	reader.Close()
+	return nil, os.ErrNotExist
+}
+
+// zipEntryReader はZIPファイル内のひとつのエントリを読み取り、閉じるとZIPファイルも閉じるリーダーです
+type zipEntryReader struct {
+	io.ReadCloser
+	reader *zipfmt.ReadCloser
+}
+
+func (r zipEntryReader) Close() error {
+	r.ReadCloser.Close()
+	return r.reader.Close()
+}
+
+// errReader は常にエラーを返すリーダーです
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
@@ -0,0 +1,174 @@
+package common
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CleanProfile は不要なファイルを削除するための、名前付きのパターンの一覧です
+type CleanProfile struct {
+	Name     string   // プロファイルの名前（コマンドラインで指定する）
+	Desc     string   // 説明
+	Patterns []string // パターン（書式は CompilePatterns を参照）
+}
+
+// BuiltinCleanProfiles は組み込みのプロファイルの一覧です
+var BuiltinCleanProfiles = []CleanProfile{
+	{
+		Name:     "macos",
+		Desc:     "macOSが作成するファイル",
+		Patterns: []string{"__MACOSX/", "._*", ".DS_Store", ".AppleDouble/", ".LSOverride", ".Spotlight-V100/", ".Trashes/", ".fseventsd/", ".TemporaryItems/"},
+	},
+	{
+		Name:     "windows",
+		Desc:     "Windowsが作成するファイル",
+		Patterns: []string{"[Tt]humbs.db", "[Ee]hthumbs.db", "[Dd]esktop.ini", "$RECYCLE.BIN/", "System Volume Information/"},
+	},
+	{
+		Name:     "vcs",
+		Desc:     "バージョン管理システムのメタデータ",
+		Patterns: []string{".git", ".svn/", ".hg/", ".bzr/", "CVS/", "_darcs/"},
+	},
+	{
+		Name:     "build",
+		Desc:     "ビルドの生成物・依存パッケージ",
+		Patterns: []string{"node_modules/", "__pycache__/", "*.py[co]", ".pytest_cache/", ".tox/", ".gradle/", "*.o", "*.obj"},
+	},
+	{
+		Name:     "editor",
+		Desc:     "エディタの一時ファイル・スワップファイル",
+		Patterns: []string{"*.sw[op]", "*~", ".#*", `\#*#`, "*.bak"},
+	},
+}
+
+// CleanProfilesPath はユーザー定義のプロファイルを書く設定ファイルのパスを返します
+func CleanProfilesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "zip-editor", "clean-profiles.txt"), nil
+}
+
+// LoadCleanProfiles は組み込みのプロファイルに、設定ファイルのプロファイルを加えた一覧を返します
+// 既にある名前のプロファイルには、設定ファイルのパターンを後ろに加えます（"!" で始まるパターンで組み込みのパターンの一致を除外できる）
+// 設定ファイルがない場合は組み込みのプロファイルだけを返します
+func LoadCleanProfiles() ([]CleanProfile, error) {
+	profiles := make([]CleanProfile, len(BuiltinCleanProfiles))
+	for i, p := range BuiltinCleanProfiles {
+		p.Patterns = append([]string(nil), p.Patterns...)
+		profiles[i] = p
+	}
+
+	path, err := CleanProfilesPath()
+	if err != nil {
+		return profiles, nil
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return profiles, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	custom, err := ParseCleanProfiles(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, p := range custom {
+		if i := indexCleanProfile(profiles, p.Name); i >= 0 {
+			profiles[i].Patterns = append(profiles[i].Patterns, p.Patterns...)
+			if p.Desc != "" {
+				profiles[i].Desc = p.Desc
+			}
+		} else {
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles, nil
+}
+
+// ParseCleanProfiles はプロファイルの設定を解釈します。書式は次のとおりです
+//
+//	# コメント
+//	[名前] 説明
+//	パターン
+//	パターン
+//
+// "[名前]" の行から次の "[名前]" の行までが、ひとつのプロファイルのパターンです
+func ParseCleanProfiles(r io.Reader) ([]CleanProfile, error) {
+	var profiles []CleanProfile
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			name, desc, ok := strings.Cut(line[1:], "]")
+			name = strings.TrimSpace(name)
+			if !ok || name == "" || strings.ContainsAny(name, ", ") {
+				return nil, fmt.Errorf("%d行目: プロファイルの名前が正しくありません: %s", lineNo, line)
+			}
+			profiles = append(profiles, CleanProfile{Name: name, Desc: strings.TrimSpace(desc)})
+			continue
+		}
+		if len(profiles) == 0 {
+			return nil, fmt.Errorf("%d行目: パターンより前に [名前] の行が必要です", lineNo)
+		}
+		profiles[len(profiles)-1].Patterns = append(profiles[len(profiles)-1].Patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, p := range profiles {
+		if _, err := CompilePatterns(p.Patterns); err != nil {
+			return nil, fmt.Errorf("プロファイル %s: %w", p.Name, err)
+		}
+	}
+	return profiles, nil
+}
+
+// CleanProfileMatcher は指定した名前のプロファイルのパターンをまとめたものを返します
+// names に "all" を指定した場合はすべてのプロファイルを使います（前後の空白と空の名前は無視します）
+func CleanProfileMatcher(profiles []CleanProfile, names []string) (*PathMatcher, error) {
+	var patterns []string
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		} else if name == "all" {
+			for _, p := range profiles {
+				patterns = append(patterns, p.Patterns...)
+			}
+			continue
+		}
+		i := indexCleanProfile(profiles, name)
+		if i < 0 {
+			return nil, fmt.Errorf("プロファイル %s がありません", name)
+		}
+		patterns = append(patterns, profiles[i].Patterns...)
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("プロファイルを指定してください")
+	}
+	return CompilePatterns(patterns)
+}
+
+// indexCleanProfile は名前が一致するプロファイルの位置を返します（ない場合は -1）
+func indexCleanProfile(profiles []CleanProfile, name string) int {
+	for i, p := range profiles {
+		if p.Name == name {
+			return i
+		}
+	}
+	return -1
+}
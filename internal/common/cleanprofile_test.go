@@ -0,0 +1,180 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCleanProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []CleanProfile
+		wantErr bool
+	}{
+		{name: "空", text: "", want: nil},
+		{
+			name: "コメントと空行",
+			text: "# コメント\n\n[logs] ログファイル\n*.log\n  # 字下げしたコメント\n  tmp/  \n[empty]\n",
+			want: []CleanProfile{
+				{Name: "logs", Desc: "ログファイル", Patterns: []string{"*.log", "tmp/"}},
+				{Name: "empty"},
+			},
+		},
+		{name: "[名前] の行より前のパターン", text: "*.log\n[logs]\n", wantErr: true},
+		{name: "空の名前", text: "[ ] 説明\n*.log\n", wantErr: true},
+		{name: "閉じていない名前", text: "[logs 説明\n", wantErr: true},
+		{name: "空白を含む名前", text: "[my logs]\n*.log\n", wantErr: true},
+		{name: "カンマを含む名前", text: "[a,b]\n*.log\n", wantErr: true},
+		{name: "正しくない正規表現", text: "[logs]\nre:(\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCleanProfiles(strings.NewReader(tt.text))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want エラー %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCleanProfiles = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 設定ファイルのプロファイルは組み込みのものに加え、同じ名前のものはパターンを後ろに加える
+func TestLoadCleanProfiles(t *testing.T) {
+	builtinNames := make([]string, len(BuiltinCleanProfiles))
+	for i, p := range BuiltinCleanProfiles {
+		builtinNames[i] = p.Name
+	}
+	editor := BuiltinCleanProfiles[indexCleanProfile(BuiltinCleanProfiles, "editor")]
+	tests := []struct {
+		name      string
+		config    *string // nilの場合は設定ファイルを作成しない
+		wantNames []string
+		check     func(t *testing.T, profiles []CleanProfile)
+		wantErr   bool
+	}{
+		{name: "設定ファイルがない", wantNames: builtinNames},
+		{
+			name:      "プロファイルを追加する",
+			config:    ptr("[logs] ログファイル\n*.log\n[editor] エディタのファイル\n!keep.bak\n"),
+			wantNames: append(append([]string(nil), builtinNames...), "logs"),
+			check: func(t *testing.T, profiles []CleanProfile) {
+				got := profiles[indexCleanProfile(profiles, "editor")]
+				want := append(append([]string(nil), editor.Patterns...), "!keep.bak")
+				if !reflect.DeepEqual(got.Patterns, want) || got.Desc != "エディタのファイル" {
+					t.Errorf("editor = %+v, want パターン %v", got, want)
+				}
+			},
+		},
+		{name: "正しくない設定ファイル", config: ptr("*.log\n"), wantErr: true},
+		{name: "正しくないパターン", config: ptr("[logs]\n[*\n"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := setTestConfigDir(t)
+			if tt.config != nil {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(*tt.config), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			profiles, err := LoadCleanProfiles()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want エラー %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				// どの設定ファイルが正しくないのかを示す
+				if !strings.Contains(err.Error(), path) {
+					t.Errorf("エラーに設定ファイルのパスがありません: %v", err)
+				}
+				return
+			}
+			var names []string
+			for _, p := range profiles {
+				names = append(names, p.Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("プロファイル = %v, want %v", names, tt.wantNames)
+			}
+			if tt.check != nil {
+				tt.check(t, profiles)
+			}
+			// 組み込みのプロファイルは変更しない
+			builtin := BuiltinCleanProfiles[indexCleanProfile(BuiltinCleanProfiles, "editor")]
+			if !reflect.DeepEqual(builtin, editor) {
+				t.Errorf("組み込みのプロファイルが変更されています: %+v", builtin)
+			}
+		})
+	}
+}
+
+func TestCleanProfileMatcher(t *testing.T) {
+	profiles := append(append([]CleanProfile(nil), BuiltinCleanProfiles...),
+		CleanProfile{Name: "logs", Patterns: []string{"*.log", "!keep.log"}})
+	tests := []struct {
+		names   []string
+		path    string
+		want    bool
+		wantErr bool
+	}{
+		{names: []string{"macos"}, path: "__MACOSX/._a.txt", want: true},
+		{names: []string{"macos"}, path: "photos/.DS_Store", want: true},
+		{names: []string{"macos"}, path: "photos/Thumbs.db", want: false},
+		{names: []string{"macos", " windows "}, path: "photos/Thumbs.db", want: true},
+		{names: []string{"vcs"}, path: "src/.git/config", want: true},
+		{names: []string{"build"}, path: "app/__pycache__/a.cpython-312.pyc", want: true},
+		{names: []string{"build"}, path: "main.py", want: false},
+		{names: []string{"editor"}, path: "notes.txt~", want: true},
+		{names: []string{"logs"}, path: "var/app.log", want: true},
+		{names: []string{"logs"}, path: "var/keep.log", want: false},
+		{names: []string{"all"}, path: "a.swp", want: true},
+		{names: []string{"all"}, path: "var/app.log", want: true},
+		{names: []string{"all"}, path: "README.md", want: false},
+		{names: []string{"", "logs"}, path: "app.log", want: true},
+		{names: []string{"unknown"}, wantErr: true},
+		{names: []string{" ", ""}, wantErr: true},
+		{names: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		m, err := CleanProfileMatcher(profiles, tt.names)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CleanProfileMatcher(%q): err = %v, want エラー %v", tt.names, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := m.Match(tt.path); got != tt.want {
+			t.Errorf("CleanProfileMatcher(%q).Match(%q) = %v, want %v", tt.names, tt.path, got, tt.want)
+		}
+	}
+}
+
+// setTestConfigDir はテストの間だけユーザーの設定フォルダを一時フォルダにし、プロファイルの設定ファイルのパスを返します
+func setTestConfigDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	// os.UserConfigDir が参照する環境変数はOSによって異なる
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("AppData", dir)
+	t.Setenv("HOME", dir)
+	path, err := CleanProfilesPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(path, dir) {
+		t.Skipf("設定フォルダ %s を一時フォルダに変更できません", path)
+	}
+	return path
+}
+
+// ptr は文字列へのポインタを返します
+func ptr(s string) *string { return &s }
@@ -1,6 +1,8 @@
 package common
 
 import (
+	"fmt"
+	"strings"
 	"unicode/utf8"
 
 	"golang.org/x/text/encoding"
@@ -20,30 +22,8 @@ func AutoDetectEncoding(input string) string {
 		return input
 	}
 
-	// 試すエンコーディングのリスト
-	encodings := []encoding.Encoding{
-		japanese.ShiftJIS,       // 日本語 Shift-JIS
-		japanese.EUCJP,          // 日本語 EUC-JP
-		japanese.ISO2022JP,      // 日本語 ISO-2022-JP
-		korean.EUCKR,            // 韓国語 EUC-KR
-		simplifiedchinese.GBK,   // 簡体字中国語 GBK
-		traditionalchinese.Big5, // 繁体字中国語 Big5
-		charmap.Windows1252,     // Windows-1252（西ヨーロッパ）
-		unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),    // UTF-16BE
-		unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), // UTF-16LE
-	}
-
-	// 各エンコーディングを試す
-	for _, enc := range encodings {
-		decoder := enc.NewDecoder()
-		output, _, err := transform.String(decoder, input)
-		if err == nil && utf8.ValidString(output) {
-			// 出力に有効な文字が含まれているかチェック
-			// これは誤検出をフィルタリングするのに役立ちます
-			if !containsControlCharacters(output) {
-				return output
-			}
-		}
+	if _, output, ok := detectEncoding(input); ok {
+		return output
 	}
 
 	// すべてのエンコーディングが失敗した場合、フォールバックとしてShift-JISを試す（後方互換性のため）
@@ -57,6 +37,42 @@ func AutoDetectEncoding(input string) string {
 	return input
 }
 
+// namedEncoding は自動検出で試すエンコーディングとその表示名です
+type namedEncoding struct {
+	name string
+	enc  encoding.Encoding
+}
+
+// detectEncodings は自動検出で試すエンコーディングのリスト（試す順）です
+var detectEncodings = []namedEncoding{
+	{"Shift-JIS", japanese.ShiftJIS},                                     // 日本語 Shift-JIS
+	{"EUC-JP", japanese.EUCJP},                                           // 日本語 EUC-JP
+	{"ISO-2022-JP", japanese.ISO2022JP},                                  // 日本語 ISO-2022-JP
+	{"EUC-KR", korean.EUCKR},                                             // 韓国語 EUC-KR
+	{"GBK", simplifiedchinese.GBK},                                       // 簡体字中国語 GBK
+	{"Big5", traditionalchinese.Big5},                                    // 繁体字中国語 Big5
+	{"Windows-1252", charmap.Windows1252},                                // Windows-1252（西ヨーロッパ）
+	{"UTF-16BE", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)},    // UTF-16BE
+	{"UTF-16LE", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)}, // UTF-16LE
+}
+
+// detectEncoding はUTF-8でない input を変換できるエンコーディングを探し、変換した文字列とともに返します
+func detectEncoding(input string) (namedEncoding, string, bool) {
+	// 各エンコーディングを試す
+	for _, ne := range detectEncodings {
+		decoder := ne.enc.NewDecoder()
+		output, _, err := transform.String(decoder, input)
+		if err == nil && utf8.ValidString(output) {
+			// 出力に有効な文字が含まれているかチェック
+			// これは誤検出をフィルタリングするのに役立ちます
+			if !containsControlCharacters(output) {
+				return ne, output, true
+			}
+		}
+	}
+	return namedEncoding{}, "", false
+}
+
 // containsControlCharacters は文字列に制御文字が含まれているかをチェックするヘルパー関数です
 // これは不正なエンコーディング検出を示す可能性があります
 func containsControlCharacters(s string) bool {
@@ -67,4 +83,52 @@ func containsControlCharacters(s string) bool {
 		}
 	}
 	return false
-}
\ No newline at end of file
+}
+
+// TextEncoding はアーカイブに書き込む文字列（コメントなど）のエンコーディングです
+type TextEncoding int
+
+const (
+	EncodingUTF8     TextEncoding = iota // UTF-8（ZIPでは言語エンコーディングフラグを立てる）
+	EncodingShiftJIS                     // Shift-JIS（日本語版Windowsの標準）
+)
+
+// TextEncodings は選択できるエンコーディングの一覧です
+var TextEncodings = []TextEncoding{EncodingUTF8, EncodingShiftJIS}
+
+// String はエンコーディングの表示名を返します
+func (e TextEncoding) String() string {
+	switch e {
+	case EncodingUTF8:
+		return "UTF-8"
+	case EncodingShiftJIS:
+		return "Shift-JIS"
+	}
+	return "不明"
+}
+
+// ParseTextEncoding はエンコーディングの名前（大文字・小文字と"-"・"_"の有無を区別しない）を解釈します
+func ParseTextEncoding(name string) (TextEncoding, bool) {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(name))
+	switch normalized {
+	case "utf8":
+		return EncodingUTF8, true
+	case "shiftjis", "sjis", "cp932":
+		return EncodingShiftJIS, true
+	}
+	return EncodingUTF8, false
+}
+
+// EncodeText はUTF-8の文字列を指定したエンコーディングのバイト列に変換します
+// 変換先のエンコーディングで表現できない文字が含まれている場合はエラーを返します
+func EncodeText(s string, enc TextEncoding) (string, error) {
+	switch enc {
+	case EncodingShiftJIS:
+		encoded, _, err := transform.String(japanese.ShiftJIS.NewEncoder(), s)
+		if err != nil {
+			return "", fmt.Errorf("%sで表現できない文字が含まれています", enc)
+		}
+		return encoded, nil
+	}
+	return s, nil
+}
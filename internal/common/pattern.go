@@ -0,0 +1,143 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RegexpPrefix はパターンを正規表現として扱うことを示す接頭辞です
+const RegexpPrefix = "re:"
+
+// PathMatcher はアーカイブ内のパスに対する、グロブ・正規表現のパターンの一覧です
+// パターンは先頭から順に評価し、最後に一致したパターンで結果が決まります（"!" で始まるパターンは一致したものを除外する）
+type PathMatcher struct {
+	rules []pathRule
+}
+
+// pathRule はパターンひとつを正規表現に変換したものです
+type pathRule struct {
+	re     *regexp.Regexp
+	negate bool
+}
+
+// CompilePatterns はパターンの一覧を解釈します。書式は次のとおりです
+//   - "*.log"            : "/" を含まないグロブは、どの階層のファイル・フォルダの名前にも一致する
+//   - "docs/**/*.tmp"    : "/" を含むグロブはアーカイブのルートからのパスに一致し、"**" は任意の階層に一致する
+//   - "__MACOSX/"        : 末尾が "/" のグロブはフォルダとその中のエントリだけに一致する
+//   - "re:\.bak$"        : "re:" で始まるパターンは、パス全体に対するGoの正規表現として扱う
+//   - "!keep.log"        : "!" で始まるパターンは、それより前のパターンに一致したものを除外する
+//
+// フォルダに一致したグロブは、その中のエントリにも一致します
+func CompilePatterns(patterns []string) (*PathMatcher, error) {
+	m := &PathMatcher{}
+	for _, p := range patterns {
+		rule := pathRule{}
+		if rest, ok := strings.CutPrefix(p, "!"); ok {
+			rule.negate, p = true, rest
+		}
+
+		var expr string
+		if rest, ok := strings.CutPrefix(p, RegexpPrefix); ok {
+			expr = rest
+		} else {
+			var err error
+			if expr, err = globToRegexp(p); err != nil {
+				return nil, err
+			}
+		}
+		if expr == "" {
+			return nil, fmt.Errorf("パターンが空です: %q", p)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("パターン %q が正しくありません: %w", p, err)
+		}
+		rule.re = re
+		m.rules = append(m.rules, rule)
+	}
+	return m, nil
+}
+
+// Match はパスがパターンに一致するかどうかを返します
+// フォルダのパスは末尾を "/" にして渡します
+func (m *PathMatcher) Match(path string) bool {
+	matched := false
+	for _, rule := range m.rules {
+		if rule.negate == matched && rule.re.MatchString(path) {
+			matched = !rule.negate
+		}
+	}
+	return matched
+}
+
+// ParsePatternList は1行にひとつずつ書いたパターンの一覧を解釈します
+// 前後の空白を取り除き、空の行と "#" で始まる行は無視します
+func ParsePatternList(text string) []string {
+	var patterns []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// globToRegexp はグロブのパターンを、パス全体に一致する正規表現に変換します
+func globToRegexp(glob string) (string, error) {
+	if glob == "" || glob == "/" {
+		return "", nil
+	}
+
+	dirOnly := strings.HasSuffix(glob, "/")
+	glob = strings.TrimSuffix(glob, "/")
+	anchored := strings.HasPrefix(glob, "/") || strings.Contains(glob, "/")
+	glob = strings.TrimPrefix(glob, "/")
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	if !anchored {
+		// 名前だけのパターンはどの階層にも一致させる
+		sb.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("パターン %q の [ が閉じられていません", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	if dirOnly {
+		// フォルダ自体（末尾が "/"）とその中のエントリに一致する
+		sb.WriteString("/.*$")
+	} else {
+		sb.WriteString("(?:/.*)?$")
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathMatcher(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		want     bool
+	}{
+		// "/" を含まないグロブはどの階層の名前にも一致する
+		{[]string{"*.log"}, "a.log", true},
+		{[]string{"*.log"}, "dir/sub/a.log", true},
+		{[]string{"*.log"}, "a.log.txt", false},
+		{[]string{"*.log"}, "logs/", false},
+		{[]string{"Thumbs.db"}, "photos/Thumbs.db", true},
+		{[]string{"?.txt"}, "a.txt", true},
+		{[]string{"?.txt"}, "ab.txt", false},
+		// フォルダに一致したグロブは、その中のエントリにも一致する
+		{[]string{"build"}, "src/build/out.o", true},
+		{[]string{"__MACOSX/"}, "__MACOSX/", true},
+		{[]string{"__MACOSX/"}, "__MACOSX/._a.txt", true},
+		{[]string{"__MACOSX/"}, "__MACOSX", false},
+		// "/" を含むグロブはルートからのパスに一致する
+		{[]string{"docs/*.tmp"}, "docs/a.tmp", true},
+		{[]string{"docs/*.tmp"}, "x/docs/a.tmp", false},
+		{[]string{"docs/*.tmp"}, "docs/sub/a.tmp", false},
+		{[]string{"/a.txt"}, "a.txt", true},
+		{[]string{"/a.txt"}, "dir/a.txt", false},
+		{[]string{"docs/**/*.tmp"}, "docs/a.tmp", true},
+		{[]string{"docs/**/*.tmp"}, "docs/x/y/a.tmp", true},
+		{[]string{"docs/**"}, "docs/x/y", true},
+		// 文字クラスとエスケープ
+		{[]string{"[ab].txt"}, "b.txt", true},
+		{[]string{"[!ab].txt"}, "b.txt", false},
+		{[]string{"[!ab].txt"}, "c.txt", true},
+		{[]string{`\*.txt`}, "*.txt", true},
+		{[]string{`\*.txt`}, "a.txt", false},
+		{[]string{"a+b(1).txt"}, "a+b(1).txt", true},
+		// 日本語のパス
+		{[]string{"*.バックアップ"}, "フォルダ/データ.バックアップ", true},
+		// 正規表現
+		{[]string{`re:\.bak$`}, "dir/a.bak", true},
+		{[]string{`re:^src/.*\.go$`}, "vendor/src/a.go", false},
+		// "!" は前のパターンに一致したものを除外し、最後に一致したパターンで決まる
+		{[]string{"*.log", "!keep.log"}, "keep.log", false},
+		{[]string{"*.log", "!keep.log"}, "drop.log", true},
+		{[]string{"*.log", "!keep.log", "dir/keep.log"}, "dir/keep.log", true},
+		{[]string{"!*.log"}, "a.log", false},
+		{nil, "a.txt", false},
+	}
+	for _, tt := range tests {
+		m, err := CompilePatterns(tt.patterns)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.patterns, err)
+		}
+		if got := m.Match(tt.path); got != tt.want {
+			t.Errorf("%q.Match(%q) = %v, want %v", tt.patterns, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCompilePatternsErrors(t *testing.T) {
+	for _, p := range []string{"", "/", "!", "re:", "re:(", "[abc"} {
+		if _, err := CompilePatterns([]string{p}); err == nil {
+			t.Errorf("CompilePatterns(%q) がエラーになりません", p)
+		}
+	}
+}
+
+func TestParsePatternList(t *testing.T) {
+	got := ParsePatternList("# コメント\n*.log\n\n  __MACOSX/  \r\n!keep.log\n")
+	want := []string{"*.log", "__MACOSX/", "!keep.log"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParsePatternList = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,508 @@
+package common
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// QueryEntry は検索式で調べるエントリの情報です
+type QueryEntry struct {
+	Path       string      // パス（UTF-8に変換したもの、フォルダは末尾が "/"）
+	Size       int64       // 展開後のサイズ
+	Modified   time.Time   // 更新日時（記録されていない場合はゼロ値）
+	Method     string      // 圧縮方式の表示名（"Store"、"Deflate" など）
+	Encryption string      // 暗号化方式の表示名（暗号化されていない場合は空）
+	Mode       fs.FileMode // 種類とパーミッション
+	Owner      string      // 所有者（"ユーザー/グループ"）
+	Comment    string      // エントリのコメント
+	// MIME は内容から判定したMIMEタイプを返す関数です。検索式で mime を使う場合だけ呼び出します（nil の場合は拡張子から判定できないものとして扱う）
+	MIME func() string
+}
+
+// Query は解釈済みの検索式です
+type Query struct {
+	root   queryNode
+	fields map[string]bool // 検索式で使われているフィールド
+}
+
+// queryNode は検索式の構文木のノードです
+type queryNode func(e *QueryEntry) bool
+
+// fieldKind はフィールドの値の種類です
+type fieldKind int
+
+const (
+	fieldString fieldKind = iota
+	fieldSize
+	fieldTime
+	fieldBool
+)
+
+// queryField は検索式で使えるフィールドの定義です
+type queryField struct {
+	kind fieldKind
+	fold bool // 比較の際に大文字・小文字を区別しない
+	str  func(e *QueryEntry) string
+	num  func(e *QueryEntry) int64
+	tm   func(e *QueryEntry) time.Time
+	flag func(e *QueryEntry) bool
+}
+
+// queryFields は検索式で使えるフィールドの一覧です
+var queryFields = map[string]queryField{
+	"name":       {kind: fieldString, str: func(e *QueryEntry) string { return path.Base(strings.TrimSuffix(e.Path, "/")) }},
+	"path":       {kind: fieldString, str: func(e *QueryEntry) string { return e.Path }},
+	"ext":        {kind: fieldString, fold: true, str: entryExt},
+	"size":       {kind: fieldSize, num: func(e *QueryEntry) int64 { return e.Size }},
+	"date":       {kind: fieldTime, tm: func(e *QueryEntry) time.Time { return e.Modified }},
+	"modified":   {kind: fieldTime, tm: func(e *QueryEntry) time.Time { return e.Modified }},
+	"method":     {kind: fieldString, fold: true, str: func(e *QueryEntry) string { return e.Method }},
+	"encryption": {kind: fieldString, fold: true, str: func(e *QueryEntry) string { return e.Encryption }},
+	"mime":       {kind: fieldString, fold: true, str: entryMIME},
+	"owner":      {kind: fieldString, str: func(e *QueryEntry) string { return e.Owner }},
+	"comment":    {kind: fieldString, str: func(e *QueryEntry) string { return e.Comment }},
+	"encrypted":  {kind: fieldBool, flag: func(e *QueryEntry) bool { return e.Encryption != "" }},
+	"dir":        {kind: fieldBool, flag: func(e *QueryEntry) bool { return strings.HasSuffix(e.Path, "/") }},
+	"file":       {kind: fieldBool, flag: func(e *QueryEntry) bool { return !strings.HasSuffix(e.Path, "/") }},
+	"symlink":    {kind: fieldBool, flag: func(e *QueryEntry) bool { return e.Mode&fs.ModeSymlink != 0 }},
+}
+
+// entryExt は拡張子（小文字、"." を含まない）を返します
+func entryExt(e *QueryEntry) string {
+	if strings.HasSuffix(e.Path, "/") {
+		return ""
+	}
+	return strings.ToLower(strings.TrimPrefix(path.Ext(e.Path), "."))
+}
+
+// entryMIME はMIMEタイプ（"; charset=..." などの引数を除いたもの）を返します
+func entryMIME(e *QueryEntry) string {
+	if e.MIME == nil || strings.HasSuffix(e.Path, "/") {
+		return ""
+	}
+	return e.MIME()
+}
+
+// ParseQuery は検索式を解釈します。書式は次のとおりです
+//   - "size > 50MB"            : サイズの比較（単位はK・M・G・T、1024の累乗）
+//   - "date < 2020"            : 日時の比較（"2020"、"2020-06"、"2020-06-01"、"2020-06-01T12:30" の期間の前後・範囲内）
+//   - "method = store"         : 文字列の比較（method・encryption・ext・mime は大文字・小文字を区別しない）
+//   - "mime ~ image/*"         : "~" と "!~" はグロブ（"re:" で始まる場合は正規表現）での比較
+//   - "encrypted"、"dir"、"file"、"symlink" : 条件を満たすかどうか
+//   - "*.log"                  : フィールド名でない語は、パスのパターン（CompilePatterns の書式）として扱う
+//
+// 条件は and（&&）・or（||）・not（!）と括弧で組み合わせられ、and は省略できます
+// 空白や記号を含む値は "..." で囲みます
+func ParseQuery(text string) (*Query, error) {
+	tokens, err := tokenizeQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens, fields: make(map[string]bool)}
+	if p.peek().kind == tokenEOF {
+		return nil, fmt.Errorf("検索式が空です")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "%q は解釈できません", t.text)
+	}
+	return &Query{root: root, fields: p.fields}, nil
+}
+
+// Match はエントリが検索式の条件を満たすかどうかを返します
+func (q *Query) Match(e *QueryEntry) bool {
+	return q.root(e)
+}
+
+// UsesField は検索式でフィールドが使われているかどうかを返します
+// mime のように値を求めるのに時間がかかるフィールドを、必要なときだけ準備するために使います
+func (q *Query) UsesField(name string) bool {
+	return q.fields[name]
+}
+
+// tokenKind は検索式の字句の種類です
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString // 引用符で囲んだ文字列
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+// queryToken は検索式の字句です
+type queryToken struct {
+	kind tokenKind
+	text string
+	pos  int // 検索式の先頭からの文字数（1から）
+}
+
+// queryOps は演算子の一覧です（長いものを先に並べる）
+var queryOps = []string{"==", "!=", "<=", ">=", "!~", "&&", "||", "=", "<", ">", "~", "!"}
+
+// tokenizeQuery は検索式を字句に分割します
+func tokenizeQuery(text string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: tokenLParen, text: "(", pos: i + 1})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{kind: tokenRParen, text: ")", pos: i + 1})
+			i++
+		case c == '"' || c == '\'':
+			start := i
+			var sb strings.Builder
+			for i++; i < len(runes) && runes[i] != c; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == c || runes[i+1] == '\\') {
+					i++
+				}
+				sb.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("検索式の %d 文字目: 引用符が閉じられていません", start+1)
+			}
+			tokens = append(tokens, queryToken{kind: tokenString, text: sb.String(), pos: start + 1})
+			i++
+		default:
+			if op := matchQueryOp(runes[i:]); op != "" {
+				tokens = append(tokens, queryToken{kind: tokenOp, text: op, pos: i + 1})
+				i += len([]rune(op))
+				continue
+			}
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("()\"'=!<>~&|", runes[i]) {
+				i++
+			}
+			if i == start {
+				return nil, fmt.Errorf("検索式の %d 文字目: %q は使えません", start+1, string(c))
+			}
+			tokens = append(tokens, queryToken{kind: tokenWord, text: string(runes[start:i]), pos: start + 1})
+		}
+	}
+	return append(tokens, queryToken{kind: tokenEOF, pos: len(runes) + 1}), nil
+}
+
+// matchQueryOp は先頭にある演算子を返します（ない場合は空文字列）
+func matchQueryOp(runes []rune) string {
+	for _, op := range queryOps {
+		if strings.HasPrefix(string(runes[:min(len(runes), 2)]), op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// queryParser は検索式の字句を構文木に変換します
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	fields map[string]bool
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) errorf(t queryToken, format string, args ...any) error {
+	return fmt.Errorf("検索式の %d 文字目: %s", t.pos, fmt.Sprintf(format, args...))
+}
+
+// isKeyword は字句が指定したキーワード（大文字・小文字を区別しない）または演算子かどうかを返します
+func isKeyword(t queryToken, word, op string) bool {
+	return (t.kind == tokenWord && strings.EqualFold(t.text, word)) || (t.kind == tokenOp && t.text == op)
+}
+
+// parseOr は or でつないだ条件を解釈します
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for isKeyword(p.peek(), "or", "||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *QueryEntry) bool { return l(e) || right(e) }
+	}
+	return left, nil
+}
+
+// parseAnd は and でつないだ（または並べた）条件を解釈します
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if isKeyword(t, "and", "&&") {
+			p.next()
+		} else if isKeyword(t, "or", "||") || (t.kind != tokenWord && t.kind != tokenString && t.kind != tokenLParen && !isKeyword(t, "not", "!")) {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *QueryEntry) bool { return l(e) && right(e) }
+	}
+}
+
+// parseUnary は not と括弧を解釈します
+func (p *queryParser) parseUnary() (queryNode, error) {
+	t := p.peek()
+	switch {
+	case isKeyword(t, "not", "!"):
+		p.next()
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e *QueryEntry) bool { return !inner(e) }, nil
+	case t.kind == tokenLParen:
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.errorf(closing, "括弧が閉じられていません")
+		}
+		return inner, nil
+	}
+	return p.parseTerm()
+}
+
+// parseTerm はフィールドの比較、またはパスのパターンを解釈します
+func (p *queryParser) parseTerm() (queryNode, error) {
+	t := p.next()
+	if t.kind != tokenWord && t.kind != tokenString {
+		if t.kind == tokenEOF {
+			return nil, p.errorf(t, "条件がありません")
+		}
+		return nil, p.errorf(t, "%q の位置に条件が必要です", t.text)
+	}
+
+	name := strings.ToLower(t.text)
+	field, ok := queryFields[name]
+	if t.kind == tokenString || !ok {
+		// フィールド名でない語はパスのパターンとして扱う
+		matcher, err := CompilePatterns([]string{t.text})
+		if err != nil {
+			return nil, p.errorf(t, "%v", err)
+		}
+		p.fields["path"] = true
+		return func(e *QueryEntry) bool { return matcher.Match(e.Path) }, nil
+	}
+	p.fields[name] = true
+
+	op := p.peek()
+	if op.kind != tokenOp || op.text == "!" || op.text == "&&" || op.text == "||" {
+		if field.kind != fieldBool {
+			return nil, p.errorf(op, "%s の後に比較の演算子（=、!=、<、> など）が必要です", name)
+		}
+		return field.flag, nil
+	}
+	p.next()
+	value := p.next()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, p.errorf(value, "%s %s の後に値が必要です", name, op.text)
+	}
+
+	node, err := compileComparison(field, op.text, value.text)
+	if err != nil {
+		return nil, p.errorf(value, "%s: %v", name, err)
+	}
+	return node, nil
+}
+
+// compileComparison はフィールドと値の比較を作成します
+func compileComparison(field queryField, op, value string) (queryNode, error) {
+	if op == "==" {
+		op = "="
+	}
+	switch field.kind {
+	case fieldBool:
+		want, err := parseQueryBool(value)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "=":
+			return func(e *QueryEntry) bool { return field.flag(e) == want }, nil
+		case "!=":
+			return func(e *QueryEntry) bool { return field.flag(e) != want }, nil
+		}
+
+	case fieldSize:
+		n, err := ParseQuerySize(value)
+		if err != nil {
+			return nil, err
+		}
+		if cmp := compareOp(op); cmp != nil {
+			return func(e *QueryEntry) bool { return cmp(compareInt(field.num(e), n)) }, nil
+		}
+
+	case fieldTime:
+		start, end, err := ParseQueryTime(value)
+		if err != nil {
+			return nil, err
+		}
+		// 期間 [start, end) との前後関係で比較する（"date < 2020" は2020年より前、"date > 2020" は2020年より後）
+		var in func(t time.Time) bool
+		switch op {
+		case "=":
+			in = func(t time.Time) bool { return !t.Before(start) && t.Before(end) }
+		case "!=":
+			in = func(t time.Time) bool { return t.Before(start) || !t.Before(end) }
+		case "<":
+			in = func(t time.Time) bool { return t.Before(start) }
+		case "<=":
+			in = func(t time.Time) bool { return t.Before(end) }
+		case ">":
+			in = func(t time.Time) bool { return !t.Before(end) }
+		case ">=":
+			in = func(t time.Time) bool { return !t.Before(start) }
+		}
+		if in != nil {
+			// 日時が記録されていないエントリ（仮想的なフォルダなど）はどの比較にも一致させない
+			return func(e *QueryEntry) bool { t := field.tm(e); return !t.IsZero() && in(t) }, nil
+		}
+
+	case fieldString:
+		norm := func(s string) string { return s }
+		if field.fold {
+			norm = strings.ToLower
+		}
+		switch op {
+		case "=", "!=":
+			want := norm(value)
+			negate := op == "!="
+			return func(e *QueryEntry) bool { return (norm(field.str(e)) == want) != negate }, nil
+		case "~", "!~":
+			matcher, err := CompilePatterns([]string{norm(value)})
+			if err != nil {
+				return nil, err
+			}
+			negate := op == "!~"
+			return func(e *QueryEntry) bool { return matcher.Match(norm(field.str(e))) != negate }, nil
+		}
+	}
+	return nil, fmt.Errorf("演算子 %s は使えません", op)
+}
+
+// compareOp は比較の演算子を、比較結果（-1、0、1）の判定に変換します
+func compareOp(op string) func(c int) bool {
+	switch op {
+	case "=":
+		return func(c int) bool { return c == 0 }
+	case "!=":
+		return func(c int) bool { return c != 0 }
+	case "<":
+		return func(c int) bool { return c < 0 }
+	case "<=":
+		return func(c int) bool { return c <= 0 }
+	case ">":
+		return func(c int) bool { return c > 0 }
+	case ">=":
+		return func(c int) bool { return c >= 0 }
+	}
+	return nil
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// parseQueryBool は真偽値（true・false・yes・no・1・0）を解釈します
+func parseQueryBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "1":
+		return true, nil
+	case "false", "no", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("真偽値（true または false）を指定してください: %s", s)
+}
+
+// ParseQuerySize はサイズの指定（"50MB"、"1.5G"、"100k"、"0" など）をバイト数に変換します
+// 単位はK・M・G・T（1024の累乗）で、大文字・小文字と末尾の "B"・"iB" は区別しません
+func ParseQuerySize(s string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(s))
+	text = strings.TrimSuffix(strings.TrimSuffix(text, "B"), "I")
+	unit := 1.0
+	for _, u := range []struct {
+		suffix string
+		size   float64
+	}{{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40}} {
+		if strings.HasSuffix(text, u.suffix) {
+			text, unit = strings.TrimSuffix(text, u.suffix), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("サイズを解釈できません: %s", s)
+	}
+	return int64(n * unit), nil
+}
+
+// queryTimeLayouts は検索式で使える日時の書式と、その書式が表す期間の長さです
+var queryTimeLayouts = []struct {
+	layout string
+	next   func(t time.Time) time.Time
+}{
+	{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{"2006-01-02T15:04", func(t time.Time) time.Time { return t.Add(time.Minute) }},
+	{"2006-01-02 15:04", func(t time.Time) time.Time { return t.Add(time.Minute) }},
+	{"2006-01-02T15:04:05", func(t time.Time) time.Time { return t.Add(time.Second) }},
+	{"2006-01-02 15:04:05", func(t time.Time) time.Time { return t.Add(time.Second) }},
+}
+
+// ParseQueryTime は日時の指定（ローカル時刻、"/" 区切りも可）を、それが表す期間 [start, end) に変換します
+// 例えば "2020" は2020年1月1日から2021年1月1日の前まで、"2020-06-01" はその日の0時から翌日の0時の前までです
+func ParseQueryTime(s string) (start, end time.Time, err error) {
+	text := strings.ReplaceAll(strings.TrimSpace(s), "/", "-")
+	for _, l := range queryTimeLayouts {
+		if t, err := time.ParseInLocation(l.layout, text, time.Local); err == nil {
+			return t, l.next(t), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("日時を解釈できません: %s（例: 2020、2020-06、2020-06-01、2020-06-01T12:30）", s)
+}
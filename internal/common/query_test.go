@@ -0,0 +1,128 @@
+package common
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQuery(t *testing.T) {
+	local := func(y int, m time.Month, d, h int) time.Time { return time.Date(y, m, d, h, 0, 0, 0, time.Local) }
+	entries := []*QueryEntry{
+		{Path: "docs/", Mode: fs.ModeDir},
+		{Path: "docs/readme.TXT", Size: 1200, Modified: local(2019, 12, 31, 23), Method: "Deflate"},
+		{Path: "images/photo.png", Size: 60 << 20, Modified: local(2020, 6, 1, 12), Method: "Store", MIME: func() string { return "image/png" }},
+		{Path: "secret.bin", Size: 10, Modified: local(2021, 1, 1, 0), Method: "Deflate", Encryption: "AES-256", Comment: "重要なファイル"},
+		{Path: "logs/app.log", Size: 0, Modified: local(2020, 1, 1, 0), Method: "Store", Owner: "root/wheel"},
+		{Path: "link", Mode: fs.ModeSymlink | 0777, Modified: local(2020, 6, 15, 0)},
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"size > 50MB", []string{"images/photo.png"}},
+		{"size >= 1k and size < 2KiB", []string{"docs/readme.TXT"}},
+		{"size = 0 and file", []string{"logs/app.log", "link"}},
+		{"date < 2020", []string{"docs/readme.TXT"}},
+		{"date = 2020", []string{"images/photo.png", "logs/app.log", "link"}},
+		{"date > 2020-06", []string{"secret.bin"}},
+		{"date <= 2020-06-01", []string{"docs/readme.TXT", "images/photo.png", "logs/app.log"}},
+		{"date = 2020/06/01T12:00", []string{"images/photo.png"}},
+		{"method = STORE", []string{"images/photo.png", "logs/app.log"}},
+		{"encrypted", []string{"secret.bin"}},
+		{"encrypted = false and dir", []string{"docs/"}},
+		{"encryption ~ aes-*", []string{"secret.bin"}},
+		{"mime ~ image/*", []string{"images/photo.png"}},
+		{"ext = txt", []string{"docs/readme.TXT"}},
+		{"name = app.log", []string{"logs/app.log"}},
+		{"path ~ 're:^docs/'", []string{"docs/", "docs/readme.TXT"}},
+		{"owner = root/wheel", []string{"logs/app.log"}},
+		{`comment ~ "*重要*"`, []string{"secret.bin"}},
+		{"symlink", []string{"link"}},
+		// パスのパターン
+		{"*.log", []string{"logs/app.log"}},
+		{`"images/*.png"`, []string{"images/photo.png"}},
+		// and の省略・or・not・括弧
+		{"*.log size = 0", []string{"logs/app.log"}},
+		{"*.log || *.png", []string{"images/photo.png", "logs/app.log"}},
+		{"not file", []string{"docs/"}},
+		{"!(dir or symlink) && method != deflate", []string{"images/photo.png", "logs/app.log"}},
+		{"(encrypted or size > 1M) and date >= 2021", []string{"secret.bin"}},
+		{"size > 1M or encrypted and date < 2021", []string{"images/photo.png"}},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		var got []string
+		for _, e := range entries {
+			if q.Match(e) {
+				got = append(got, e.Path)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"size >",
+		"size 10",
+		"size > ten",
+		"date < yesterday",
+		"encrypted = maybe",
+		"size ~ 10",
+		"(size > 1",
+		"name = 'unterminated",
+		"*.log )",
+		"[abc",
+	} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("ParseQuery(%q) がエラーになりません", query)
+		}
+	}
+}
+
+func TestQueryUsesField(t *testing.T) {
+	q, err := ParseQuery("mime ~ image/* or *.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"mime": true, "path": true, "size": false} {
+		if got := q.UsesField(name); got != want {
+			t.Errorf("UsesField(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestParseQuerySize(t *testing.T) {
+	tests := []struct {
+		text string
+		want int64
+	}{
+		{"0", 0},
+		{"100", 100},
+		{"100k", 100 << 10},
+		{"50MB", 50 << 20},
+		{"1.5G", 3 << 29},
+		{"2TiB", 2 << 40},
+		{" 10kb ", 10 << 10},
+	}
+	for _, tt := range tests {
+		got, err := ParseQuerySize(tt.text)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseQuerySize(%q) = %d, %v, want %d", tt.text, got, err, tt.want)
+		}
+	}
+	for _, text := range []string{"", "-1", "MB", "1X"} {
+		if _, err := ParseQuerySize(text); err == nil {
+			t.Errorf("ParseQuerySize(%q) がエラーになりません", text)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// newFileMode は ReplaceFile で新しく作成するファイルのパーミッションです
+const newFileMode = 0o644
+
+// ReplaceFile は dst と同じディレクトリの一時ファイルに write で書き込み、成功した場合に名前を変更して dst を置き換えます
+// 一時ファイルは所有者だけが読み書きできるパーミッションで作成されるため、dst がすでにある場合はそのパーミッションを、
+// ない場合は 0644 を設定してから置き換えます。失敗した場合は一時ファイルを削除し、dst は変更しません
+// dst を読み取りながら書き込む場合は、write から戻る前に dst を閉じてください（Windowsでは開いているファイルを置き換えられないため）
+func ReplaceFile(dst string, write func(f *os.File) error) error {
+	mode, err := ReplaceMode(dst)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".zip-editor-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := write(tmp); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// ReplaceMode は dst を置き換えるファイルに設定するパーミッションを返します
+// dst がすでにある場合はそのパーミッション、ない場合は 0644 です
+func ReplaceMode(dst string) (fs.FileMode, error) {
+	fi, err := os.Stat(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return newFileMode, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return fi.Mode().Perm(), nil
+}
@@ -0,0 +1,66 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestReplaceFile(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "a.zip")
+	if err := os.WriteFile(dst, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dst, 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	err := ReplaceFile(dst, func(f *os.File) error {
+		_, err := f.WriteString("new")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "new" {
+		t.Errorf("内容 = %q, want %q", data, "new")
+	}
+	fi, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0o640 {
+		t.Errorf("パーミッション = %v, want 0640", fi.Mode().Perm())
+	}
+
+	// 失敗した場合は元のファイルを変更せず、一時ファイルも残さない
+	errWrite := errors.New("書き込みに失敗")
+	err = ReplaceFile(dst, func(f *os.File) error {
+		f.WriteString("broken")
+		return errWrite
+	})
+	if !errors.Is(err, errWrite) {
+		t.Errorf("ReplaceFile = %v, want %v", err, errWrite)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "new" {
+		t.Errorf("失敗した後の内容 = %q, want %q", data, "new")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("一時ファイルが残っています: %v", entries)
+	}
+
+	// 新しく作成するファイルは 0644 にする
+	created := filepath.Join(dir, "b.zip")
+	if err := ReplaceFile(created, func(f *os.File) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(created); err != nil {
+		t.Fatal(err)
+	} else if runtime.GOOS != "windows" && fi.Mode().Perm() != newFileMode {
+		t.Errorf("新しいファイルのパーミッション = %v, want %v", fi.Mode().Perm(), os.FileMode(newFileMode))
+	}
+}
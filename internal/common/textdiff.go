@@ -0,0 +1,192 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/transform"
+)
+
+// maxDiffEdits は行の差分を求める際の、追加・削除した行の数の上限です（超えた場合は差分を求めません）
+const maxDiffEdits = 5000
+
+// DecodeText はファイルの内容のエンコーディングを判定し（SearchReader と同じ方法）、UTF-8のテキストに変換します
+// テキストと判定できない場合（NULを含むなど）は ok がfalseになります
+func DecodeText(data []byte) (text, encodingName string, ok bool) {
+	head := data
+	if len(head) > textSniffLen {
+		head = head[:textSniffLen]
+	}
+	name, enc, binary := detectTextEncoding(head, len(data) <= textSniffLen)
+	if binary {
+		return "", "", false
+	}
+	if enc == nil {
+		if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+			return "", "", false
+		}
+		return string(data), name, true
+	}
+	out, _, err := transform.Bytes(enc.NewDecoder(), data)
+	if err != nil {
+		return "", "", false
+	}
+	return string(out), name, true
+}
+
+// SplitLines はテキストを行に分けます（改行はCRLF・LFのどちらでもよく、行には含めません）
+// 末尾が改行で終わる場合、その後ろに空の行は作りません
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
+// diffOp は差分の1行です（kind は ' ' が共通、'-' が削除、'+' が追加）
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// UnifiedDiff は2つのテキストの行の差分を unified 形式（diff -u と同じ）の文字列にします
+// context は変更の前後に表示する共通の行数です。差分がない場合は空文字列を返します
+// 変更が多すぎる場合は差分を求めずに ok がfalseになります
+func UnifiedDiff(oldName, newName string, a, b []string, context int) (diff string, ok bool) {
+	ops, ok := diffLines(a, b)
+	if !ok {
+		return "", false
+	}
+	var changes []int
+	for i, op := range ops {
+		if op.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return "", true
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	for first := 0; first < len(changes); {
+		// 共通の行が 2*context 以下しか離れていない変更はひとつのハンクにまとめる
+		last := first
+		for last+1 < len(changes) && changes[last+1]-changes[last]-1 <= 2*context {
+			last++
+		}
+		start := max(changes[first]-context, 0)
+		end := min(changes[last]+context+1, len(ops))
+
+		aStart, bStart := 0, 0
+		for _, op := range ops[:start] {
+			if op.kind != '+' {
+				aStart++
+			}
+			if op.kind != '-' {
+				bStart++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.text)
+			sb.WriteByte('\n')
+		}
+		first = last + 1
+	}
+	return sb.String(), true
+}
+
+// hunkRange はハンクの開始行（0から数えた、ハンクより前の行数）と行数を "開始,行数" の形式にします
+// 行数が0の場合は、diff -u と同じく直前の行の番号を開始行とします
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// diffLines は a から b への行の最短の編集手順を求めます（Myersの差分アルゴリズム）
+func diffLines(a, b []string) ([]diffOp, bool) {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxDiffEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	// trace[d] は d 回目の探索を始める前の v[-d-1 .. d+1] です
+	var trace [][]int
+	found := false
+	for d := 0; d <= limit && !found; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return nil, false
+	}
+
+	// 終点から逆にたどって編集手順を作る
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		snap := trace[d]
+		at := func(k int) int { return snap[k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{'+', b[y-1]})
+			} else {
+				ops = append(ops, diffOp{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops, true
+}
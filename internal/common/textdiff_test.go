@@ -0,0 +1,158 @@
+package common
+
+import (
+	"math/rand"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    []string
+		context int
+		want    string
+	}{
+		{
+			name: "同じ内容",
+			a:    []string{"a", "b"},
+			b:    []string{"a", "b"},
+			want: "",
+		},
+		{
+			name:    "離れた変更は別のハンク",
+			a:       strings.Fields("a b c d e f g h"),
+			b:       strings.Fields("a b X d e f g h Y"),
+			context: 1,
+			want: "--- old\n+++ new\n" +
+				"@@ -2,3 +2,3 @@\n b\n-c\n+X\n d\n" +
+				"@@ -8,1 +8,2 @@\n h\n+Y\n",
+		},
+		{
+			name:    "近い変更はひとつのハンク",
+			a:       strings.Fields("a b c d e f g h"),
+			b:       strings.Fields("a b X d e Y g h"),
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -2,6 +2,6 @@\n b\n-c\n+X\n d\n e\n-f\n+Y\n g\n",
+		},
+		{
+			name: "空のファイルへの追加",
+			b:    []string{"新しい行"},
+			want: "--- old\n+++ new\n@@ -0,0 +1,1 @@\n+新しい行\n",
+		},
+		{
+			name:    "すべて削除",
+			a:       []string{"x", "y"},
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -1,2 +0,0 @@\n-x\n-y\n",
+		},
+	}
+	for _, tt := range tests {
+		got, ok := UnifiedDiff("old", "new", tt.a, tt.b, tt.context)
+		if !ok {
+			t.Errorf("%s: 差分を求められません", tt.name)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// 差分の編集手順から、元の2つのテキストを復元できることを確認する
+func TestDiffLinesReconstruct(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 200; i++ {
+		a, b := randomLines(), randomLines()
+		ops, ok := diffLines(a, b)
+		if !ok {
+			t.Fatal("差分を求められません")
+		}
+		var gotA, gotB []string
+		edits := 0
+		for _, op := range ops {
+			if op.kind != '+' {
+				gotA = append(gotA, op.text)
+			}
+			if op.kind != '-' {
+				gotB = append(gotB, op.text)
+			}
+			if op.kind != ' ' {
+				edits++
+			}
+		}
+		if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+			t.Fatalf("%q → %q: 編集手順から復元できません", a, b)
+		}
+		if edits > len(a)+len(b) {
+			t.Fatalf("%q → %q: 編集数 %d が多すぎます", a, b, edits)
+		}
+	}
+}
+
+func TestUnifiedDiffTooManyEdits(t *testing.T) {
+	a := make([]string, maxDiffEdits)
+	b := make([]string, maxDiffEdits)
+	for i := range a {
+		a[i] = "old"
+		b[i] = "new"
+	}
+	if _, ok := UnifiedDiff("old", "new", a, b, 3); ok {
+		t.Error("変更が多すぎる場合に ok がfalseになりません")
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{"a\n", []string{"a"}},
+		{"a\r\nb\r\n", []string{"a", "b"}},
+		{"a\n\nb", []string{"a", "", "b"}},
+	}
+	for _, tt := range tests {
+		if got := SplitLines(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitLines(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	sjis, _ := japanese.ShiftJIS.NewEncoder().String("日本語のテキスト\r\n")
+	utf16, _ := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String("UTF-16のテキスト")
+	tests := []struct {
+		name     string
+		data     []byte
+		wantText string
+		wantEnc  string
+		wantOK   bool
+	}{
+		{name: "UTF-8", data: []byte("テキスト\n"), wantText: "テキスト\n", wantEnc: "UTF-8", wantOK: true},
+		{name: "BOM付きUTF-8", data: []byte("\xEF\xBB\xBFテキスト"), wantText: "テキスト", wantEnc: "UTF-8（BOM付き）", wantOK: true},
+		{name: "Shift-JIS", data: []byte(sjis), wantText: "日本語のテキスト\r\n", wantEnc: "Shift-JIS", wantOK: true},
+		{name: "UTF-16LE", data: []byte(utf16), wantText: "UTF-16のテキスト", wantEnc: "UTF-16LE", wantOK: true},
+		{name: "NULを含む", data: []byte("PK\x03\x04\x00\x00"), wantOK: false},
+		{name: "空", data: nil, wantText: "", wantEnc: "UTF-8", wantOK: true},
+	}
+	for _, tt := range tests {
+		text, enc, ok := DecodeText(tt.data)
+		if ok != tt.wantOK || text != tt.wantText || enc != tt.wantEnc {
+			t.Errorf("%s: DecodeText = %q, %q, %v, want %q, %q, %v", tt.name, text, enc, ok, tt.wantText, tt.wantEnc, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+const (
+	// textSniffLen はエンコーディングとバイナリの判定に使う先頭のバイト数です
+	textSniffLen = 8192
+	// maxTextLineLen は内容の検索で読み取る1行の最大のバイト数です
+	maxTextLineLen = 16 << 20
+	// maxMatchText は一致した行・前後の行として記録する最大の文字数です
+	maxMatchText = 500
+	// MaxContentMatches はひとつのファイルで記録する一致した行の最大数です
+	MaxContentMatches = 1000
+)
+
+// ContentSearchOptions は内容の検索の条件です
+type ContentSearchOptions struct {
+	Pattern    string // 検索する文字列
+	Regexp     bool   // Pattern をGoの正規表現として扱う
+	IgnoreCase bool   // 大文字・小文字を区別しない
+	Context    int    // 一致した行の前後に記録する行数
+}
+
+// ContentMatcher は内容の検索の条件を解釈したものです
+type ContentMatcher struct {
+	re      *regexp.Regexp
+	context int
+}
+
+// ContentLine はファイルの1行です
+type ContentLine struct {
+	Line int    // 行番号（1から）
+	Text string // 行の内容（UTF-8に変換し、長い場合は途中で切ったもの）
+}
+
+// ContentMatch は検索に一致した行と、その前後の行です
+type ContentMatch struct {
+	ContentLine
+	Before []ContentLine // 一致した行の前の行（前の一致で記録した行は含まない）
+	After  []ContentLine // 一致した行の後の行（次の一致した行は含まない）
+}
+
+// TextMatches はひとつのファイルの検索結果です
+type TextMatches struct {
+	Encoding  string // 判定したエンコーディング（バイナリの場合は空）
+	Binary    bool   // バイナリファイルと判定したかどうか（一致した場合も行の内容は記録しない）
+	Matches   []ContentMatch
+	Truncated bool // 一致した行が多いため、MaxContentMatches 件で記録をやめたかどうか
+}
+
+// CompileContentSearch は内容の検索の条件を解釈します
+func CompileContentSearch(opts ContentSearchOptions) (*ContentMatcher, error) {
+	if opts.Pattern == "" {
+		return nil, fmt.Errorf("検索する文字列を指定してください")
+	}
+	expr := opts.Pattern
+	if !opts.Regexp {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if opts.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("正規表現 %q が正しくありません: %w", opts.Pattern, err)
+	}
+	return &ContentMatcher{re: re, context: max(opts.Context, 0)}, nil
+}
+
+// SearchReader は r の内容を1行ずつ読み取り、一致した行を探します
+// エンコーディングは先頭から判定し（BOM、UTF-8、AutoDetectEncoding と同じ候補の順）、UTF-8に変換してから比較します
+// バイナリファイル（先頭にNULを含むなど）は、skipBinary の場合は読み取らずに Binary だけを設定して返し、
+// そうでない場合は最初に一致した行の行番号だけを記録します
+func (m *ContentMatcher) SearchReader(r io.Reader, skipBinary bool) (*TextMatches, error) {
+	head := make([]byte, textSniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	result := &TextMatches{}
+	name, enc, binary := detectTextEncoding(head, n < textSniffLen)
+	if binary {
+		result.Binary = true
+		if skipBinary {
+			return result, nil
+		}
+	} else {
+		result.Encoding = name
+	}
+
+	var src io.Reader = io.MultiReader(bytes.NewReader(head), r)
+	if enc != nil {
+		src = transform.NewReader(src, enc.NewDecoder())
+	}
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 64*1024), maxTextLineLen)
+
+	lineNo := 0
+	shown := 0               // 一致した行・前後の行として記録した最後の行番号
+	var recent []ContentLine // 直前の行（最大で context 行）
+	var last *ContentMatch   // 後の行を記録している一致
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if m.re.MatchString(line) {
+			if binary {
+				result.Matches = append(result.Matches, ContentMatch{ContentLine: ContentLine{Line: lineNo}})
+				return result, nil
+			}
+			if len(result.Matches) >= MaxContentMatches {
+				result.Truncated = true
+				break
+			}
+			match := ContentMatch{ContentLine: ContentLine{Line: lineNo, Text: truncateText(line)}}
+			for _, l := range recent {
+				if l.Line > shown {
+					match.Before = append(match.Before, l)
+				}
+			}
+			result.Matches = append(result.Matches, match)
+			last = &result.Matches[len(result.Matches)-1]
+			shown = lineNo
+			recent = recent[:0]
+			continue
+		}
+
+		if m.context == 0 {
+			continue
+		}
+		if last != nil && len(last.After) < m.context && lineNo == shown+1 {
+			last.After = append(last.After, ContentLine{Line: lineNo, Text: truncateText(line)})
+			shown = lineNo
+			continue
+		}
+		if len(recent) == m.context {
+			recent = append(recent[:0], recent[1:]...)
+		}
+		recent = append(recent, ContentLine{Line: lineNo, Text: truncateText(line)})
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// detectTextEncoding はファイルの先頭からエンコーディングを判定します
+// UTF-8の場合は enc が nil になります。テキストと判定できない場合は binary がtrueになります
+// complete は head がファイル全体かどうかで、falseの場合は末尾の途中で切れた文字を判定から除きます
+func detectTextEncoding(head []byte, complete bool) (name string, enc encoding.Encoding, binary bool) {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		return "UTF-8（BOM付き）", unicode.UTF8BOM, false
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return "UTF-16LE", unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), false
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return "UTF-16BE", unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), false
+	case bytes.IndexByte(head, 0) >= 0:
+		return "", nil, true
+	}
+
+	sample := head
+	if !complete {
+		// 途中で切れた行（と文字）を除いて判定する
+		if i := bytes.LastIndexByte(sample, '\n'); i >= 0 {
+			sample = sample[:i+1]
+		}
+	}
+	if utf8.Valid(sample) || (!complete && validUTF8Prefix(sample)) {
+		return "UTF-8", nil, false
+	}
+	if ne, _, ok := detectEncoding(string(sample)); ok {
+		return ne.name, ne.enc, false
+	}
+	return "", nil, true
+}
+
+// validUTF8Prefix は末尾の途中で切れた文字を除いて、有効なUTF-8かどうかを返します
+func validUTF8Prefix(b []byte) bool {
+	for i := 0; i < utf8.UTFMax && len(b) > 0; i++ {
+		if utf8.Valid(b) {
+			return true
+		}
+		b = b[:len(b)-1]
+	}
+	return utf8.Valid(b)
+}
+
+// truncateText は長い行を maxMatchText 文字で切ります
+func truncateText(s string) string {
+	if utf8.RuneCountInString(s) <= maxMatchText {
+		return s
+	}
+	return string([]rune(s)[:maxMatchText]) + "…"
+}
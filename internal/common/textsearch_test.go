@@ -0,0 +1,200 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+func TestCompileContentSearch(t *testing.T) {
+	tests := []struct {
+		opts      ContentSearchOptions
+		line      string
+		want      bool
+		wantError bool
+	}{
+		{opts: ContentSearchOptions{Pattern: "a.b"}, line: "xa.by", want: true},
+		// 正規表現でない場合は記号をそのまま探す
+		{opts: ContentSearchOptions{Pattern: "a.b"}, line: "axb", want: false},
+		{opts: ContentSearchOptions{Pattern: "a.b", Regexp: true}, line: "axb", want: true},
+		{opts: ContentSearchOptions{Pattern: "ZIP"}, line: "zip", want: false},
+		{opts: ContentSearchOptions{Pattern: "ZIP", IgnoreCase: true}, line: "zip", want: true},
+		{opts: ContentSearchOptions{Pattern: `^\d+年$`, Regexp: true, IgnoreCase: true}, line: "2024年", want: true},
+		{opts: ContentSearchOptions{Pattern: ""}, wantError: true},
+		{opts: ContentSearchOptions{Pattern: "a(", Regexp: true}, wantError: true},
+	}
+	for _, tt := range tests {
+		m, err := CompileContentSearch(tt.opts)
+		if (err != nil) != tt.wantError {
+			t.Errorf("CompileContentSearch(%+v): err = %v, wantError %v", tt.opts, err, tt.wantError)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		result, err := m.SearchReader(strings.NewReader(tt.line), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(result.Matches) > 0; got != tt.want {
+			t.Errorf("%+v で %q を検索 = %v, want %v", tt.opts, tt.line, got, tt.want)
+		}
+	}
+}
+
+// 前後の行は、前の一致で記録した行と次の一致した行を重複して記録しない
+func TestSearchReaderContext(t *testing.T) {
+	text := "a\nb\n一致 1\nc\nd\ne\n一致 2\n一致 3\nf\n"
+	lines := func(nums ...int) []ContentLine {
+		names := map[int]string{1: "a", 2: "b", 4: "c", 5: "d", 6: "e", 9: "f"}
+		var l []ContentLine
+		for _, n := range nums {
+			l = append(l, ContentLine{Line: n, Text: names[n]})
+		}
+		return l
+	}
+	match := func(line int, before, after []ContentLine) ContentMatch {
+		return ContentMatch{ContentLine: ContentLine{Line: line, Text: fmt.Sprintf("一致 %d", map[int]int{3: 1, 7: 2, 8: 3}[line])}, Before: before, After: after}
+	}
+	tests := []struct {
+		context int
+		want    []ContentMatch
+	}{
+		{context: 0, want: []ContentMatch{match(3, nil, nil), match(7, nil, nil), match(8, nil, nil)}},
+		{context: 1, want: []ContentMatch{match(3, lines(2), lines(4)), match(7, lines(6), nil), match(8, nil, lines(9))}},
+		{context: 2, want: []ContentMatch{match(3, lines(1, 2), lines(4, 5)), match(7, lines(6), nil), match(8, nil, lines(9))}},
+		{context: -1, want: []ContentMatch{match(3, nil, nil), match(7, nil, nil), match(8, nil, nil)}},
+	}
+	for _, tt := range tests {
+		m, err := CompileContentSearch(ContentSearchOptions{Pattern: "一致", Context: tt.context})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := m.SearchReader(strings.NewReader(text), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result.Matches, tt.want) {
+			t.Errorf("前後%d行: %+v\nwant %+v", tt.context, result.Matches, tt.want)
+		}
+	}
+}
+
+func TestSearchReaderEncoding(t *testing.T) {
+	text := "1行目\r\nZIP Editor の検索\r\n3行目\r\n"
+	encode := func(tr transform.Transformer) []byte {
+		b, _, err := transform.Bytes(tr, []byte(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "UTF-8", data: []byte(text), want: "UTF-8"},
+		{name: "UTF-8（BOM付き）", data: append([]byte{0xEF, 0xBB, 0xBF}, text...), want: "UTF-8（BOM付き）"},
+		{name: "Shift-JIS", data: encode(japanese.ShiftJIS.NewEncoder()), want: "Shift-JIS"},
+		{name: "UTF-16LE", data: encode(unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder()), want: "UTF-16LE"},
+		{name: "UTF-16BE", data: encode(unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewEncoder()), want: "UTF-16BE"},
+	}
+	m, err := CompileContentSearch(ContentSearchOptions{Pattern: "検索"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		result, err := m.SearchReader(bytes.NewReader(tt.data), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Encoding != tt.want || result.Binary {
+			t.Errorf("%s: エンコーディング = %q, バイナリ %v", tt.name, result.Encoding, result.Binary)
+		}
+		// 行末の CR は取り除く
+		want := []ContentMatch{{ContentLine: ContentLine{Line: 2, Text: "ZIP Editor の検索"}}}
+		if !reflect.DeepEqual(result.Matches, want) {
+			t.Errorf("%s: %+v, want %+v", tt.name, result.Matches, want)
+		}
+	}
+}
+
+// 先頭の判定に使う範囲の末尾で途切れた文字は、UTF-8の判定の妨げにならない
+func TestSearchReaderSniffBoundary(t *testing.T) {
+	var buf bytes.Buffer
+	for buf.Len() < textSniffLen*2 {
+		buf.WriteString("あいうえお")
+	}
+	buf.WriteString("\n検索\n")
+	m, err := CompileContentSearch(ContentSearchOptions{Pattern: "検索"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := m.SearchReader(&buf, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Encoding != "UTF-8" || len(result.Matches) != 1 || result.Matches[0].Line != 2 {
+		t.Errorf("結果 = %+v", result)
+	}
+}
+
+func TestSearchReaderBinary(t *testing.T) {
+	data := []byte("\x00\x01ヘッダー\n検索\n検索\n")
+	m, err := CompileContentSearch(ContentSearchOptions{Pattern: "検索"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// バイナリを除外する場合は読み取らない
+	result, err := m.SearchReader(bytes.NewReader(data), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Binary || result.Encoding != "" || len(result.Matches) != 0 {
+		t.Errorf("除外する場合 = %+v", result)
+	}
+	// 除外しない場合は最初に一致した行の行番号だけを記録する
+	result, err = m.SearchReader(bytes.NewReader(data), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ContentMatch{{ContentLine: ContentLine{Line: 2}}}
+	if !result.Binary || !reflect.DeepEqual(result.Matches, want) {
+		t.Errorf("除外しない場合 = %+v", result)
+	}
+}
+
+func TestSearchReaderLimits(t *testing.T) {
+	m, err := CompileContentSearch(ContentSearchOptions{Pattern: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 一致した行が多い場合は MaxContentMatches 件で記録をやめる
+	result, err := m.SearchReader(strings.NewReader(strings.Repeat("x\n", MaxContentMatches+10)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Truncated || len(result.Matches) != MaxContentMatches {
+		t.Errorf("一致した行 = %d件, Truncated = %v", len(result.Matches), result.Truncated)
+	}
+
+	// 長い行は maxMatchText 文字で切る
+	result, err = m.SearchReader(strings.NewReader("x"+strings.Repeat("あ", maxMatchText)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Matches) != 1 {
+		t.Fatalf("一致した行 = %d件", len(result.Matches))
+	}
+	if text := result.Matches[0].Text; text != "x"+strings.Repeat("あ", maxMatchText-1)+"…" {
+		t.Errorf("長い行 = %d文字", len([]rune(text)))
+	}
+}
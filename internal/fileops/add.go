@@ -0,0 +1,157 @@
+package fileops
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"zip-editor/internal/common"
+	"zip-editor/internal/model"
+	"zip-editor/internal/zipfmt"
+)
+
+// AddOptions はZIPファイルにファイルを追加する際のオプションです
+type AddOptions struct {
+	// Method は追加するファイルの圧縮方式です（zipfmt.WritableMethods のいずれか）
+	Method uint16
+	// Level は圧縮レベルです（zipfmt.LevelDefault で各方式の標準）
+	Level int
+}
+
+// AddFiles はファイルやフォルダをZIPファイル内のフォルダ dirPath に追加します
+// dirPath はツリーのフォルダのパス（ルートは空文字列、それ以外は末尾が"/"）です
+// 同じパスのエントリがすでにある場合は置き換えます
+func AddFiles(zipPath, dirPath string, paths []string, opts AddOptions) error {
+	if strings.Contains(dirPath, model.NestedSeparator) {
+		return ErrNestedReadOnly
+	}
+	if err := requireZip(zipPath); err != nil {
+		return err
+	}
+	if zipfmt.Compressor(opts.Method) == nil {
+		return fmt.Errorf("圧縮方式 %s での圧縮には対応していません", zipfmt.MethodName(opts.Method))
+	}
+
+	// 追加するファイルを、いったん一時ZIPファイルに指定の圧縮方式で圧縮する
+	tempDir, err := os.MkdirTemp("", "zip-editor-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	addedZipPath := filepath.Join(tempDir, "added.zip")
+	if err := compressFiles(addedZipPath, dirPath, paths, opts); err != nil {
+		return err
+	}
+	added, err := zipfmt.OpenReader(addedZipPath)
+	if err != nil {
+		return err
+	}
+	defer added.Close()
+
+	replaced := make(map[string]bool, len(added.File))
+	for _, file := range added.File {
+		replaced[file.Name] = true
+	}
+
+	return rewriteZipFile(zipPath, SaveOptions{}, func(zipWriter *zip.Writer, reader *zipfmt.ReadCloser) error {
+		// 既存のエントリは、追加するファイルで置き換えるものを除いてそのままコピー
+		for _, file := range reader.File {
+			if replaced[common.AutoDetectEncoding(file.Name)] {
+				continue
+			}
+			if err := zipfmt.CopyRaw(zipWriter, file, nil); err != nil {
+				return err
+			}
+		}
+
+		// 圧縮済みのデータをコピー
+		// zip.Writer.CreateHeader は展開に必要なバージョンを常に2.0にするため、ここで圧縮方式に合わせる
+		for _, file := range added.File {
+			header := file.FileHeader
+			header.ReaderVersion = zipfmt.RequiredVersion(header.Method)
+			if err := zipfmt.CopyRaw(zipWriter, file, &header); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// compressFiles はファイルやフォルダを圧縮して新しいZIPファイルに書き込みます
+// フォルダは中のファイルを含めて再帰的に追加します
+func compressFiles(dstPath, dirPath string, paths []string, opts AddOptions) error {
+	out, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zipWriter := zip.NewWriter(out)
+	defer zipWriter.Close()
+	zipWriter.RegisterCompressor(opts.Method, zipfmt.CompressorLevel(opts.Method, opts.Level))
+
+	for _, path := range paths {
+		base := filepath.Dir(path)
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(base, p)
+			if err != nil {
+				return err
+			}
+			return addFileEntry(zipWriter, p, dirPath+filepath.ToSlash(rel), d, opts.Method)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// addFileEntry はひとつのファイル（またはフォルダ）をエントリとして書き込みます
+func addFileEntry(zipWriter *zip.Writer, srcPath, name string, d fs.DirEntry, method uint16) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+
+	if d.IsDir() {
+		// フォルダはデータを持たないため圧縮しない
+		header.Name += "/"
+		header.Method = zip.Store
+		_, err := zipWriter.CreateHeader(header)
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		// シンボリックリンクなどの特殊なファイルは追加しない
+		return nil
+	}
+
+	zipfmt.SetMethod(header, method)
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	_, err = io.Copy(writer, src)
+	return err
+}
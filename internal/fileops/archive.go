@@ -0,0 +1,89 @@
+package fileops
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"zip-editor/internal/archive"
+)
+
+// archiveFormat はファイルのアーカイブの形式を判定します
+func archiveFormat(zipPath string) (archive.Format, error) {
+	format, _, err := archive.Detect(zipPath)
+	return format, err
+}
+
+// requireZip はZIP形式でないアーカイブに対して、ZIP専用の操作を行おうとした場合にエラーを返します
+func requireZip(zipPath string) error {
+	format, err := archiveFormat(zipPath)
+	if err != nil {
+		return err
+	}
+	if format != archive.FormatZip {
+		return archive.ErrUnsupportedFormat
+	}
+	return nil
+}
+
+// saveArchiveFile は削除フラグを反映して、ZIP以外の形式のアーカイブを元と同じ形式・圧縮方式で書き直します
+// 7z・RARは読み取り専用のため書き直せません
+func saveArchiveFile(zipPath string, format archive.Format) error {
+	if !format.Writable() {
+		return fmt.Errorf("%s形式のアーカイブは読み取り専用です（「名前を付けて保存」でZIPなどに変換できます）", format)
+	}
+	flags := snapshotDeleteFlags(zipPath)
+	return rewriteFile(zipPath, func(out io.Writer) error {
+		return archive.RewriteTar(zipPath, out, func(e *archive.Entry) bool {
+			return !flags.deleted(zipPath, e.Path)
+		})
+	})
+}
+
+// rewriteFile は一時ファイルに新しい内容を書き込み、成功した場合に元のファイルを置き換えます
+func rewriteFile(filePath string, write func(out io.Writer) error) error {
+	tempDir, err := os.MkdirTemp("", "zip-editor-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	tempPath := filepath.Join(tempDir, "temp"+filepath.Ext(filePath))
+	out, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := write(out); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return replaceWithCopy(tempPath, filePath)
+}
+
+// verifyArchive はZIP以外の形式のアーカイブの全エントリを読み取り、壊れていないことを確認します
+// 圧縮されたストリームが壊れている場合はそれ以降を読み取れないため、その時点のエントリをエラーとして報告します
+func verifyArchive(zipPath string, format archive.Format) *VerifyResult {
+	result := &VerifyResult{}
+	current := ""
+	err := archive.Walk(zipPath, format, func(e *archive.Entry, r io.Reader) error {
+		if e.IsDir() {
+			return nil
+		}
+		current = e.Path
+		result.Total++
+		n, err := io.Copy(io.Discard, r)
+		result.Bytes += n
+		return err
+	})
+	if err != nil {
+		result.Failures = append(result.Failures, VerifyFailure{
+			Path:   current,
+			Reason: err.Error() + "（以降のエントリは読み取れません）",
+		})
+	}
+	return result
+}
@@ -0,0 +1,84 @@
+package fileops
+
+import (
+	"archive/zip"
+	"fmt"
+	"strings"
+	"zip-editor/internal/common"
+	"zip-editor/internal/model"
+	"zip-editor/internal/zipfmt"
+)
+
+// AttrOptions はエントリの属性（Unixのパーミッション・MS-DOSの属性・作成したOS）を変更する際のオプションです
+type AttrOptions struct {
+	Edit zipfmt.AttrEdit
+	// Items は対象のファイル・フォルダです（フォルダは中のエントリを含む、nilの場合はZIPファイル全体）
+	Items []*model.ZipTreeItem
+}
+
+// AttrResult は属性の変更結果です
+type AttrResult struct {
+	Changed int // 属性を変更したエントリ数
+	Scripts int // ScriptsOnly の場合に、"#!" で始まるファイルとして実行権限を変更したエントリ数
+}
+
+// SetAttributes はエントリの属性を変更してZIPファイルを書き直します
+// 外部属性と作成したOSだけを書き換え、圧縮データはそのままコピーします
+func SetAttributes(zipPath string, opts AttrOptions) (*AttrResult, error) {
+	if err := requireZip(zipPath); err != nil {
+		return nil, err
+	}
+
+	var match func(name string) bool
+	if opts.Items != nil {
+		paths := make([]string, len(opts.Items))
+		for i, item := range opts.Items {
+			if item.IsNested() || item.IsArchive() {
+				return nil, ErrNestedReadOnly
+			}
+			paths[i] = item.GetPath()
+		}
+		match = zipfmt.SubtreeMatcher(paths)
+	}
+
+	result := &AttrResult{}
+	err := rewriteZipFile(zipPath, SaveOptions{}, func(zipWriter *zip.Writer, reader *zipfmt.ReadCloser) error {
+		for _, file := range reader.File {
+			if match != nil && !match(common.AutoDetectEncoding(file.Name)) {
+				if err := zipfmt.CopyRaw(zipWriter, file, nil); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// 実行権限をスクリプトだけに付ける場合は、内容の先頭を確認する
+			script := opts.Edit.NeedsScript() && zipfmt.IsScript(file)
+			header := file.FileHeader
+			if zipfmt.ApplyAttrEdit(&header, opts.Edit, script) {
+				result.Changed++
+				if script {
+					result.Scripts++
+				}
+			}
+			if err := zipfmt.CopyRaw(zipWriter, file, &header); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FormatAttrReport は属性の変更結果を表示用の文字列にまとめます
+func FormatAttrReport(result *AttrResult, edit zipfmt.AttrEdit) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "属性を変更したエントリ: %d件\n", result.Changed)
+	if edit.NeedsScript() {
+		fmt.Fprintf(&sb, "実行権限を変更したスクリプト: %d件\n", result.Scripts)
+	}
+	return sb.String()
+}
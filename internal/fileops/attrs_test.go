@@ -0,0 +1,65 @@
+package fileops
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"zip-editor/internal/zipfmt"
+)
+
+// 属性の変更は外部属性と作成したOSだけを書き換え、圧縮データはそのまま残す
+func TestSetAttributes(t *testing.T) {
+	script := []byte("#!/bin/sh\n" + string(testText(10<<10)))
+	dir := t.TempDir()
+	path := writeTestZip(t, dir, "a.zip", []testEntry{
+		{name: "bin/", data: nil},
+		{name: "bin/run.sh", data: script, method: zip.Deflate},
+		{name: "readme.txt", data: testText(10 << 10), method: zip.Deflate},
+	})
+	before := openTestZip(t, path).File
+
+	perm, err := zipfmt.ParsePermEdit("+x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit := zipfmt.AttrEdit{Perm: perm, ScriptsOnly: true}
+	result, err := SetAttributes(path, AttrOptions{Edit: edit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Changed != 1 || result.Scripts != 1 {
+		t.Errorf("結果 = %+v, want 変更1件 スクリプト1件", result)
+	}
+	if got, want := FormatAttrReport(result, edit), "属性を変更したエントリ: 1件\n実行権限を変更したスクリプト: 1件\n"; got != want {
+		t.Errorf("FormatAttrReport = %q, want %q", got, want)
+	}
+
+	after := openTestZip(t, path).File
+	if len(after) != len(before) {
+		t.Fatalf("エントリ数 = %d, want %d", len(after), len(before))
+	}
+	wantMode := map[string]string{"bin/": "drw-rw-rw-", "bin/run.sh": "-rwxr-xr-x", "readme.txt": "-rw-rw-rw-"}
+	for i, f := range after {
+		if f.Name != before[i].Name || f.CompressedSize64 != before[i].CompressedSize64 || f.CRC32 != before[i].CRC32 {
+			t.Errorf("%s: 圧縮データが変わりました", f.Name)
+		}
+		if got := f.Mode().String(); got != wantMode[f.Name] {
+			t.Errorf("%s: Mode = %s, want %s", f.Name, got, wantMode[f.Name])
+		}
+	}
+	if !bytes.Equal(readEntry(t, after[1]), script) {
+		t.Error("スクリプトの内容が変わりました")
+	}
+	if !zipfmt.IsUnixHost(&after[1].FileHeader) || zipfmt.IsUnixHost(&after[2].FileHeader) {
+		t.Errorf("作成したOS = %s, %s", zipfmt.HostName(&after[1].FileHeader), zipfmt.HostName(&after[2].FileHeader))
+	}
+
+	// 同じ変更をもう一度行っても、変更されるエントリはない
+	result, err = SetAttributes(path, AttrOptions{Edit: edit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Changed != 0 || result.Scripts != 0 {
+		t.Errorf("2回目の結果 = %+v, want 変更なし", result)
+	}
+}
@@ -0,0 +1,144 @@
+package fileops
+
+import (
+	"archive/zip"
+	"strings"
+	"sync"
+
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// commentEdit は保存時に反映するコメントの変更です
+type commentEdit struct {
+	text     string
+	encoding common.TextEncoding
+}
+
+// commentEdits はエントリのコメントの変更を保持するマップ
+// キーは削除フラグと同じZIPファイルパスとファイルパスの組み合わせ
+// archiveCommentEdits はアーカイブ全体のコメントの変更を保持するマップ（キーはZIPファイルパス）
+// 保存は別のゴルーチンで行われるため、どちらも commentEditsMu で保護します
+var (
+	commentEdits        = make(map[string]commentEdit)
+	archiveCommentEdits = make(map[string]commentEdit)
+	commentEditsMu      sync.Mutex
+)
+
+// commentSnapshot は保存を始めた時点のコメントの変更です
+// 保存中に行われた変更は反映せず、保存後も破棄しないように、保存ではこの写しだけを使います
+type commentSnapshot struct {
+	entries map[string]commentEdit // キーは commentEdits と同じ
+	archive *commentEdit           // アーカイブ全体のコメント（変更されていない場合はnil）
+}
+
+// SetEntryComment はエントリのコメントを変更します。変更は保存時にZIPファイルに反映されます
+// 空文字列を指定した場合はコメントを削除します
+func SetEntryComment(zipPath, filePath, comment string, enc common.TextEncoding) error {
+	if _, err := zipfmt.EncodeComment(comment, enc); err != nil {
+		return err
+	}
+	commentEditsMu.Lock()
+	defer commentEditsMu.Unlock()
+	commentEdits[getDeleteFlagKey(zipPath, filePath)] = commentEdit{text: comment, encoding: enc}
+	return nil
+}
+
+// SetArchiveComment はアーカイブ全体のコメントを変更します。変更は保存時にZIPファイルに反映されます
+func SetArchiveComment(zipPath, comment string, enc common.TextEncoding) error {
+	if _, err := zipfmt.EncodeComment(comment, enc); err != nil {
+		return err
+	}
+	commentEditsMu.Lock()
+	defer commentEditsMu.Unlock()
+	archiveCommentEdits[zipPath] = commentEdit{text: comment, encoding: enc}
+	return nil
+}
+
+// HasCommentEdits は保存していないコメントの変更があるかどうかを返します
+func HasCommentEdits(zipPath string) bool {
+	commentEditsMu.Lock()
+	defer commentEditsMu.Unlock()
+	if _, ok := archiveCommentEdits[zipPath]; ok {
+		return true
+	}
+	prefix := getDeleteFlagKey(zipPath, "")
+	for key := range commentEdits {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotCommentEdits は指定したZIPファイルのコメントの変更の写しを返します
+func snapshotCommentEdits(zipPath string) *commentSnapshot {
+	commentEditsMu.Lock()
+	defer commentEditsMu.Unlock()
+	snapshot := &commentSnapshot{entries: make(map[string]commentEdit)}
+	if edit, ok := archiveCommentEdits[zipPath]; ok {
+		snapshot.archive = &edit
+	}
+	prefix := getDeleteFlagKey(zipPath, "")
+	for key, edit := range commentEdits {
+		if strings.HasPrefix(key, prefix) {
+			snapshot.entries[key] = edit
+		}
+	}
+	return snapshot
+}
+
+// clearCommentEdits は保存によって反映したコメントの変更を破棄します
+// 保存中にさらに変更されたコメントは、次の保存で反映するために残します
+func clearCommentEdits(zipPath string, applied *commentSnapshot) {
+	commentEditsMu.Lock()
+	defer commentEditsMu.Unlock()
+	if applied.archive != nil && archiveCommentEdits[zipPath] == *applied.archive {
+		delete(archiveCommentEdits, zipPath)
+	}
+	for key, edit := range applied.entries {
+		if current, ok := commentEdits[key]; ok && current == edit {
+			delete(commentEdits, key)
+		}
+	}
+}
+
+// editedHeader はエントリのコメントが変更されている場合に、変更を反映したヘッダーを返します
+// 変更されていない場合（s がnilの場合を含む）はnilを返します
+func (s *commentSnapshot) editedHeader(zipPath, path string, file *zip.File) (*zip.FileHeader, error) {
+	if s == nil {
+		return nil, nil
+	}
+	edit, ok := s.entries[getDeleteFlagKey(zipPath, path)]
+	if !ok {
+		return nil, nil
+	}
+	header := file.FileHeader
+	if err := zipfmt.SetEntryComment(&header, edit.text, edit.encoding); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+// archiveComment は新しいZIPファイルに書き込むアーカイブ全体のコメントを返します
+// 変更されていない場合は元のコメントをそのまま引き継ぎます
+func (s *commentSnapshot) archiveComment(reader *zipfmt.ReadCloser) (string, error) {
+	comment, err := s.editedArchiveComment()
+	if err != nil || comment == nil {
+		return reader.Comment, err
+	}
+	return *comment, nil
+}
+
+// editedArchiveComment はアーカイブ全体のコメントが変更されている場合に、新しいZIPファイルに書き込むコメントを返します
+// 変更されていない場合（s がnilの場合を含む）はnilを返します
+func (s *commentSnapshot) editedArchiveComment() (*string, error) {
+	if s == nil || s.archive == nil {
+		return nil, nil
+	}
+	comment, err := zipfmt.EncodeComment(s.archive.text, s.archive.encoding)
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
@@ -0,0 +1,83 @@
+package fileops
+
+import (
+	"archive/zip"
+	"strings"
+	"testing"
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// 保存するとコメントの変更を指定したエンコーディングで反映し、フラグが切り替わるエントリは名前も同じエンコーディングで書き込む
+func TestSaveCommentEdits(t *testing.T) {
+	path := writeTestZip(t, t.TempDir(), "a.zip", []testEntry{
+		{name: "日本語.txt", data: []byte("a"), method: zip.Deflate},
+		{name: "b.txt", data: []byte("b"), method: zip.Deflate},
+	})
+	if err := SetEntryComment(path, "日本語.txt", "シフトJISのコメント", common.EncodingShiftJIS); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetEntryComment(path, "b.txt", "UTF-8のコメント", common.EncodingUTF8); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetArchiveComment(path, "アーカイブのコメント", common.EncodingShiftJIS); err != nil {
+		t.Fatal(err)
+	}
+	if !HasCommentEdits(path) {
+		t.Fatal("コメントの変更が記録されていません")
+	}
+	if err := SaveZipFile(path, SaveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if HasCommentEdits(path) {
+		t.Error("反映したコメントの変更が残っています")
+	}
+
+	sjis := func(s string) string {
+		encoded, err := common.EncodeText(s, common.EncodingShiftJIS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+	r := openTestZip(t, path)
+	if r.Comment != sjis("アーカイブのコメント") {
+		t.Errorf("アーカイブのコメント = %q", r.Comment)
+	}
+	tests := []struct {
+		name     string
+		comment  string
+		wantUTF8 bool
+	}{
+		{name: sjis("日本語.txt"), comment: sjis("シフトJISのコメント"), wantUTF8: false},
+		{name: "b.txt", comment: "UTF-8のコメント", wantUTF8: true},
+	}
+	for i, tt := range tests {
+		f := r.File[i]
+		if f.Name != tt.name || f.Comment != tt.comment || (f.Flags&zipfmt.FlagUTF8 != 0) != tt.wantUTF8 {
+			t.Errorf("%d番目のエントリ = %q %q フラグ %v, want %q %q フラグ %v",
+				i, f.Name, f.Comment, f.Flags&zipfmt.FlagUTF8 != 0, tt.name, tt.comment, tt.wantUTF8)
+		}
+		// 名前は変換したエンコーディングから元の名前に戻せる
+		if i == 0 && common.AutoDetectEncoding(f.Name) != "日本語.txt" {
+			t.Errorf("名前 = %q, want 日本語.txt", common.AutoDetectEncoding(f.Name))
+		}
+	}
+}
+
+// 長すぎるコメントや、エンコーディングで表現できないコメントは変更として記録しない
+func TestSetCommentErrors(t *testing.T) {
+	path := writeTestZip(t, t.TempDir(), "a.zip", []testEntry{{name: "a.txt", data: []byte("a")}})
+	if err := SetEntryComment(path, "a.txt", strings.Repeat("a", 65536), common.EncodingUTF8); err == nil {
+		t.Error("65535バイトを超えるエントリのコメントを設定できてしまいました")
+	}
+	if err := SetArchiveComment(path, strings.Repeat("あ", 32768), common.EncodingShiftJIS); err == nil {
+		t.Error("65535バイトを超えるアーカイブのコメントを設定できてしまいました")
+	}
+	if err := SetEntryComment(path, "a.txt", "😀", common.EncodingShiftJIS); err == nil {
+		t.Error("Shift-JISで表現できないコメントを設定できてしまいました")
+	}
+	if HasCommentEdits(path) {
+		t.Error("失敗したコメントの変更が記録されています")
+	}
+}
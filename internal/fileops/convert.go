@@ -0,0 +1,52 @@
+package fileops
+
+import (
+	"archive/zip"
+	"errors"
+	"path/filepath"
+	"strings"
+	"zip-editor/internal/archive"
+	"zip-editor/internal/model"
+	"zip-editor/internal/zipfmt"
+)
+
+// SaveArchiveAs は削除フラグを反映したアーカイブを、別名・別の形式で保存します
+// ZIPからZIPへの保存では圧縮データをそのままコピーし、暗号化や入れ子のアーカイブの編集も引き継ぎます
+// それ以外の組み合わせでは形式を変換し、表現できなかった情報を結果に記録します（ZIP同士の場合はnil）
+func SaveArchiveAs(zipPath, dstPath string, opts archive.ConvertOptions) (*archive.ConvertResult, error) {
+	if absSrc, err := filepath.Abs(zipPath); err == nil {
+		if absDst, err := filepath.Abs(dstPath); err == nil && strings.EqualFold(absSrc, absDst) {
+			return nil, errors.New("保存先に元のファイルと同じファイルは指定できません")
+		}
+	}
+	format, err := archiveFormat(zipPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == archive.FormatZip && opts.Format == archive.FormatZip {
+		reader, err := zipfmt.OpenReader(zipPath)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		comments := snapshotCommentEdits(zipPath)
+		return nil, writeZipFile(dstPath, func(zipWriter *zip.Writer) error {
+			comment, err := comments.archiveComment(reader)
+			if err != nil {
+				return err
+			}
+			if err := zipWriter.SetComment(comment); err != nil {
+				return err
+			}
+			return saveEntries(zipPath, "", zipWriter, reader.Reader, SaveOptions{comments: comments})
+		})
+	}
+
+	// 削除フラグが付いたエントリ（入れ子のアーカイブはディレクトリとして削除されたものを含む）は書き込まない
+	flags := snapshotDeleteFlags(zipPath)
+	opts.Keep = func(e *archive.Entry) bool {
+		return !flags.deleted(zipPath, e.Path) && !flags.deleted(zipPath, e.Path+model.NestedSeparator)
+	}
+	return archive.Convert(zipPath, dstPath, opts)
+}
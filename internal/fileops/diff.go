@@ -0,0 +1,17 @@
+package fileops
+
+import (
+	"archive/zip"
+	"io"
+
+	"zip-editor/internal/archive"
+)
+
+// DiffArchives は2つのアーカイブのファイルを比較します（比較の方法は archive.DiffArchives を参照）
+// 暗号化されたエントリは prompt でパスワードの入力を求めます（nilの場合はキャッシュ済みのパスワードのみ使用）
+func DiffArchives(oldPath, newPath string, opts archive.DiffOptions, prompt PasswordFunc) (*archive.DiffResult, error) {
+	opts.OpenEncrypted = func(archivePath string, f *zip.File) (io.ReadCloser, error) {
+		return openEntry(archivePath, f, prompt)
+	}
+	return archive.DiffArchives(oldPath, newPath, opts)
+}
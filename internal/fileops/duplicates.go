@@ -0,0 +1,100 @@
+package fileops
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"zip-editor/internal/archive"
+	"zip-editor/internal/model"
+)
+
+// FindDuplicates はアーカイブ内・アーカイブの間で同じ内容のファイルを探します（探し方は archive.FindDuplicates を参照）
+// 暗号化されたエントリは prompt でパスワードの入力を求めます（nilの場合はキャッシュ済みのパスワードのみ使用）
+func FindDuplicates(archives []string, opts archive.DuplicateOptions, prompt PasswordFunc) (*archive.DuplicateResult, error) {
+	var mu sync.Mutex
+	opts.OpenEncrypted = func(archivePath string, f *zip.File) (io.ReadCloser, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return openEntry(archivePath, f, prompt)
+	}
+	return archive.FindDuplicates(archives, opts)
+}
+
+// FlagDuplicates は同じ内容のファイルのうち、残すもの以外に削除フラグを付けます（残すものの選び方は archive.DuplicateGroup.Redundant を参照）
+// 削除フラグを反映できない形式（7z・RAR）のアーカイブには付けません。削除フラグを付けたファイルのパスをアーカイブごとに返します
+func FlagDuplicates(result *archive.DuplicateResult, keep archive.DuplicateKeep, perArchive bool) map[string][]string {
+	flagged := make(map[string][]string)
+	for archivePath, paths := range result.Redundant(keep, perArchive) {
+		if format, err := archiveFormat(archivePath); err != nil || !format.Writable() {
+			continue
+		}
+		for _, p := range paths {
+			setDeleteFlag(archivePath, p, true)
+		}
+		flagged[archivePath] = paths
+	}
+	return flagged
+}
+
+// ApplyDeleteFlags は読み込んだツリーのアイテムに、記録している削除フラグを反映します
+// ほかのアーカイブを表示している間に付けた削除フラグ（重複したファイルなど）を、読み込み直した際に表示するために使います
+// 入れ子のアーカイブは展開されたときに開くため、開いたときにも中のアイテムに反映します
+func ApplyDeleteFlags(zipPath string, m *model.ZipTreeModel) {
+	m.FilterItems(func(item *model.ZipTreeItem) bool {
+		item.DeleteFlag = GetDeleteFlag(zipPath, item.GetPath())
+		return false
+	})
+	m.SetNestedLoaded(func(item *model.ZipTreeItem) {
+		// 削除フラグが付いたフォルダの中で開いた場合は、中のアイテムにも付ける
+		if item.DeleteFlag {
+			UpdateDeleteFlagRecursively(zipPath, item)
+			return
+		}
+		applyDeleteFlagsRecursively(zipPath, item)
+	})
+}
+
+// applyDeleteFlagsRecursively はフォルダの中のアイテムに、記録している削除フラグを反映します
+func applyDeleteFlagsRecursively(zipPath string, item *model.ZipTreeItem) {
+	for _, file := range item.GetFiles() {
+		file.DeleteFlag = GetDeleteFlag(zipPath, file.GetPath())
+	}
+	for _, child := range item.GetChildren() {
+		child.DeleteFlag = GetDeleteFlag(zipPath, child.GetPath())
+		applyDeleteFlagsRecursively(zipPath, child)
+	}
+}
+
+// FormatDuplicateReport は同じ内容のファイルを探した結果の概要を表示用の文字列にまとめます
+func FormatDuplicateReport(result *archive.DuplicateResult) string {
+	var sb strings.Builder
+	files := 0
+	cross := 0
+	for i := range result.Groups {
+		files += len(result.Groups[i].Files)
+		if result.Groups[i].CrossArchive() {
+			cross++
+		}
+	}
+	fmt.Fprintf(&sb, "同じ内容のファイル: %d組（%d件）／削除すると減らせるサイズ: %d バイト／調べたファイル: %d件",
+		len(result.Groups), files, result.Wasted(), result.Scanned)
+	if cross > 0 {
+		fmt.Fprintf(&sb, "／複数のアーカイブにまたがる組: %d組", cross)
+	}
+	if len(result.Skipped) > 0 {
+		fmt.Fprintf(&sb, "／読み取れなかったファイル: %d件", len(result.Skipped))
+	}
+	return sb.String()
+}
+
+// DuplicateSkipText は読み取れなかったアーカイブ・ファイルを表示用の文字列にします
+func DuplicateSkipText(skip archive.DuplicateSkip) string {
+	if skip.Path == "" {
+		return filepath.Base(skip.Archive) + ": " + skip.Reason
+	}
+	return filepath.Base(skip.Archive) + " の " + skip.Path + ": " + skip.Reason
+}
@@ -0,0 +1,51 @@
+package fileops
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"zip-editor/internal/archive"
+)
+
+// 削除フラグは書き込める形式のアーカイブのファイルにだけ付ける
+func TestFlagDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := writeTestZip(t, dir, "a.zip", []testEntry{
+		{name: "a.txt", data: testText(100)},
+		{name: "copy/a.txt", data: testText(100)},
+	})
+	// 7zは署名だけで形式を判定する
+	sevenZip := filepath.Join(dir, "b.7z")
+	if err := os.WriteFile(sevenZip, []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C, 0, 4}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result := &archive.DuplicateResult{
+		Groups: []archive.DuplicateGroup{{
+			Size:  100,
+			Files: []archive.DuplicateFile{{Archive: sevenZip, Path: "a.txt"}, {Archive: zipPath, Path: "a.txt"}, {Archive: zipPath, Path: "copy/a.txt"}},
+		}},
+		Scanned: 3,
+		Skipped: []archive.DuplicateSkip{{Archive: sevenZip, Path: "secret.txt", Reason: "暗号化されています"}},
+	}
+	t.Cleanup(func() {
+		setDeleteFlag(zipPath, "a.txt", false)
+		setDeleteFlag(zipPath, "copy/a.txt", false)
+	})
+
+	flagged := FlagDuplicates(result, archive.KeepFirst, false)
+	if want := map[string][]string{zipPath: {"a.txt", "copy/a.txt"}}; !reflect.DeepEqual(flagged, want) {
+		t.Errorf("FlagDuplicates = %v, want %v", flagged, want)
+	}
+	if !GetDeleteFlag(zipPath, "a.txt") || !GetDeleteFlag(zipPath, "copy/a.txt") || GetDeleteFlag(sevenZip, "a.txt") {
+		t.Error("削除フラグが正しく付いていません")
+	}
+
+	want := "同じ内容のファイル: 1組（3件）／削除すると減らせるサイズ: 200 バイト／調べたファイル: 3件／複数のアーカイブにまたがる組: 1組／読み取れなかったファイル: 1件"
+	if got := FormatDuplicateReport(result); got != want {
+		t.Errorf("FormatDuplicateReport = %q\nwant %q", got, want)
+	}
+	if got := DuplicateSkipText(result.Skipped[0]); got != "b.7z の secret.txt: 暗号化されています" {
+		t.Errorf("DuplicateSkipText = %q", got)
+	}
+}
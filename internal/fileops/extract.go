@@ -0,0 +1,404 @@
+package fileops
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"zip-editor/internal/archive"
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// ExtractSkip は展開しなかったエントリとその理由です
+type ExtractSkip struct {
+	Path   string
+	Reason string
+}
+
+// ExtractResult はフォルダの展開結果です
+type ExtractResult struct {
+	Files   int           // 展開したファイル数
+	Bytes   int64         // 展開したファイルの合計サイズ
+	Skipped []ExtractSkip // 展開しなかったエントリ
+}
+
+// SymlinkPolicy はシンボリックリンクの展開方法です
+type SymlinkPolicy int
+
+const (
+	SymlinkSkip   SymlinkPolicy = iota // 展開しない
+	SymlinkCreate                      // シンボリックリンクとして作成する
+	SymlinkCopy                        // 参照先のファイル・フォルダをコピーする
+)
+
+// ExtractFolder はアーカイブ内のフォルダ dirPath 以下を dstDir に展開します
+// dirPath はツリーのフォルダのパス（末尾が"/"、ルートの場合は空文字列）で、フォルダ自体も dstDir の中に作成します
+// 展開先の外を指すパスのエントリは、安全のため展開せずに結果に記録します
+// シンボリックリンクは symlinks に従って、ほかのエントリをすべて展開した後に作成します
+// 参照先が絶対パスのもの、展開するフォルダの外を指すもの、途中でほかのシンボリックリンクを経由するものは展開しません
+func ExtractFolder(zipPath, dirPath, dstDir string, symlinks SymlinkPolicy, prompt PasswordFunc) (*ExtractResult, error) {
+	format, err := archiveFormat(zipPath)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &extractor{
+		dstDir:    dstDir,
+		dir:       dirPath,
+		base:      path.Dir(strings.TrimSuffix(dirPath, "/")) + "/",
+		symlinks:  symlinks,
+		linkPaths: make(map[string]bool),
+		result:    &ExtractResult{},
+	}
+	if x.base == "./" {
+		x.base = ""
+	}
+	// ルートを展開する場合はアーカイブ名のフォルダを作成する
+	if dirPath == "" {
+		x.dstDir = filepath.Join(dstDir, archive.TrimExt(filepath.Base(zipPath)))
+	}
+
+	if format == archive.FormatZip {
+		err = x.extractZip(zipPath, prompt)
+	} else {
+		err = archive.Walk(zipPath, format, x.extractEntry)
+	}
+	if err != nil {
+		return x.result, err
+	}
+	x.extractHardlinks()
+	x.extractSymlinks()
+	return x.result, nil
+}
+
+// ExtractFiles はアーカイブ内のファイル paths を、アーカイブ内のフォルダの構成を保って dstDir に展開します
+// paths は Entry.Path と同じ正規化したパスで、シンボリックリンクは展開しません
+// 展開先の外を指すパスのエントリは、安全のため展開せずに結果に記録します
+func ExtractFiles(zipPath string, paths []string, dstDir string, prompt PasswordFunc) (*ExtractResult, error) {
+	format, err := archiveFormat(zipPath)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &extractor{
+		dstDir:    dstDir,
+		only:      make(map[string]bool, len(paths)),
+		symlinks:  SymlinkSkip,
+		linkPaths: make(map[string]bool),
+		result:    &ExtractResult{},
+	}
+	for _, p := range paths {
+		x.only[p] = true
+	}
+
+	if format == archive.FormatZip {
+		err = x.extractZip(zipPath, prompt)
+	} else {
+		err = archive.Walk(zipPath, format, x.extractEntry)
+	}
+	if err != nil {
+		return x.result, err
+	}
+	x.extractHardlinks()
+	return x.result, nil
+}
+
+// extractor はフォルダの展開の状態を保持します
+type extractor struct {
+	dstDir    string           // 展開先のフォルダ
+	dir       string           // 展開するアーカイブ内のフォルダ
+	only      map[string]bool  // 展開するファイルのパス（nilの場合は dir 以下のすべて）
+	base      string           // 展開先のフォルダに対応するアーカイブ内のフォルダ（dir の親）
+	hardlinks []*archive.Entry // 参照先の展開後にコピーするハードリンク
+	symlinks  SymlinkPolicy    // シンボリックリンクの展開方法
+	links     []*archive.Entry // ほかのエントリの展開後に作成するシンボリックリンク
+	linkPaths map[string]bool  // 展開するシンボリックリンクのアーカイブ内のパス
+	result    *ExtractResult
+}
+
+// skip は展開しなかったエントリを結果に記録します
+func (x *extractor) skip(entryPath, reason string) {
+	x.result.Skipped = append(x.result.Skipped, ExtractSkip{Path: entryPath, Reason: reason})
+}
+
+// includes はエントリが展開の対象かどうかを返します
+func (x *extractor) includes(entryPath string) bool {
+	if x.only != nil {
+		return x.only[entryPath]
+	}
+	return strings.HasPrefix(entryPath, x.dir)
+}
+
+// target はエントリの展開先のパスを返します
+// 展開先のフォルダの外を指す場合は ok がfalseになります
+func (x *extractor) target(entryPath string) (string, bool) {
+	rel := filepath.FromSlash(strings.TrimPrefix(entryPath, x.base))
+	target := filepath.Join(x.dstDir, rel)
+	r, err := filepath.Rel(x.dstDir, target)
+	if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return target, true
+}
+
+// extractZip はZIPファイルのエントリを展開します（暗号化されたエントリはパスワードを求めて復号します）
+func (x *extractor) extractZip(zipPath string, prompt PasswordFunc) error {
+	reader, err := zipfmt.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		e := &archive.Entry{
+			Path:     archive.CleanPath(file.Name, strings.HasSuffix(file.Name, "/")),
+			Modified: file.Modified,
+			Mode:     file.Mode(),
+		}
+		if e.Path == "" || !x.includes(e.Path) {
+			continue
+		}
+		// シンボリックリンクはデータに参照先が格納されている
+		if e.Mode&fs.ModeSymlink != 0 {
+			target, err := zipfmt.ReadSymlink(file)
+			if err != nil {
+				x.skip(e.Path, err.Error())
+				continue
+			}
+			e.Linkname = common.AutoDetectEncoding(target)
+		}
+		if e.IsDir() || e.Mode&fs.ModeSymlink != 0 {
+			if err := x.extractEntry(e, strings.NewReader("")); err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := openEntry(zipPath, file, prompt)
+		if err != nil {
+			x.skip(e.Path, err.Error())
+			continue
+		}
+		err = x.extractEntry(e, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractEntry はエントリをひとつ展開します
+// 読み取りに失敗したエントリは結果に記録して続行し、書き込みに失敗した場合はエラーを返します
+func (x *extractor) extractEntry(e *archive.Entry, r io.Reader) error {
+	if !x.includes(e.Path) {
+		return nil
+	}
+	target, ok := x.target(e.Path)
+	if !ok {
+		x.skip(e.Path, "展開先のフォルダの外を指すパスのため展開しません")
+		return nil
+	}
+
+	switch {
+	case e.IsDir():
+		return os.MkdirAll(target, 0755)
+	case e.Hardlink:
+		x.hardlinks = append(x.hardlinks, e)
+		return nil
+	case e.Mode&fs.ModeSymlink != 0:
+		if x.symlinks == SymlinkSkip {
+			x.skip(e.Path, "シンボリックリンクは展開しません（参照先: "+e.Linkname+"）")
+			return nil
+		}
+		x.links = append(x.links, e)
+		x.linkPaths[e.Path] = true
+		return nil
+	case e.Mode&(fs.ModeDevice|fs.ModeCharDevice|fs.ModeNamedPipe|fs.ModeSocket) != 0:
+		x.skip(e.Path, "デバイスファイル・名前付きパイプは展開しません")
+		return nil
+	case e.Encrypted:
+		x.skip(e.Path, "暗号化されているため展開できません")
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, r)
+	out.Close()
+	if err != nil {
+		// 途中まで書き込んだファイルは残さない
+		os.Remove(target)
+		x.skip(e.Path, err.Error())
+		return nil
+	}
+	if !e.Modified.IsZero() {
+		os.Chtimes(target, e.Modified, e.Modified)
+	}
+	x.result.Files++
+	x.result.Bytes += n
+	return nil
+}
+
+// extractHardlinks はハードリンクを、展開済みの参照先のファイルをコピーして作成します
+func (x *extractor) extractHardlinks() {
+	for _, e := range x.hardlinks {
+		target, _ := x.target(e.Path)
+		src, ok := x.target(e.Linkname)
+		if !ok || !strings.HasPrefix(e.Linkname, x.dir) {
+			x.skip(e.Path, "ハードリンクの参照先 "+e.Linkname+" が展開するフォルダの外にあるため展開しません")
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			x.skip(e.Path, err.Error())
+			continue
+		}
+		if err := copyFile(src, target); err != nil {
+			x.skip(e.Path, "ハードリンクの参照先 "+e.Linkname+" をコピーできません: "+err.Error())
+			continue
+		}
+		x.result.Files++
+	}
+}
+
+// extractSymlinks はシンボリックリンクを、展開方法に従ってリンクまたは参照先のコピーとして作成します
+func (x *extractor) extractSymlinks() {
+	for _, e := range x.links {
+		target, _ := x.target(e.Path)
+		resolved, ok := x.resolveLink(e)
+		if !ok {
+			x.skip(e.Path, "シンボリックリンクの参照先 "+e.Linkname+" が展開するフォルダの外を指すか、ほかのシンボリックリンクを経由するため展開しません")
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			x.skip(e.Path, err.Error())
+			continue
+		}
+
+		var err error
+		switch x.symlinks {
+		case SymlinkCreate:
+			err = os.Symlink(filepath.FromSlash(e.Linkname), target)
+		case SymlinkCopy:
+			src, _ := x.target(resolved)
+			err = copyLinkTarget(src, target)
+		}
+		if err != nil {
+			x.skip(e.Path, "シンボリックリンク（参照先: "+e.Linkname+"）を作成できません: "+err.Error())
+			continue
+		}
+		x.result.Files++
+	}
+}
+
+// resolveLink はシンボリックリンクの参照先を、アーカイブ内のパスとして求めます
+// 参照先が絶対パスのもの、展開するフォルダの外を指すもの、リンク自身の場所や参照先（途中を含む）がほかのシンボリックリンクのものは ok がfalseになります
+// （経由するリンクの実際の参照先によっては、パスの上では中に見えても展開先の外を指すため）
+func (x *extractor) resolveLink(e *archive.Entry) (string, bool) {
+	link := e.Linkname
+	if link == "" || path.IsAbs(link) || strings.Contains(link, "\\") || filepath.VolumeName(link) != "" {
+		return "", false
+	}
+
+	cur := parentPath(e.Path)
+	for p := cur; p != ""; p = parentPath(p) {
+		if x.linkPaths[p] {
+			return "", false
+		}
+	}
+	for _, elem := range strings.Split(link, "/") {
+		if x.linkPaths[cur] {
+			return "", false
+		}
+		switch elem {
+		case "", ".":
+		case "..":
+			if cur == "" {
+				return "", false
+			}
+			cur = parentPath(cur)
+		default:
+			cur = path.Join(cur, elem)
+		}
+	}
+	// 参照先そのものがシンボリックリンクの場合も、そのリンクの参照先が確かめられないため展開しない
+	if x.linkPaths[cur] || !strings.HasPrefix(cur+"/", x.dir) {
+		return "", false
+	}
+	return cur, true
+}
+
+// parentPath はアーカイブ内のパスの親フォルダのパスを返します（ルートの場合は空文字列）
+func parentPath(p string) string {
+	dir := path.Dir(p)
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
+
+// copyLinkTarget はシンボリックリンクの参照先のファイル・フォルダを、リンクの場所にコピーします
+// フォルダの中のシンボリックリンクはコピーしません
+func copyLinkTarget(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode().IsRegular():
+		return copyFile(src, dst)
+	case !info.IsDir():
+		return fmt.Errorf("参照先 %s は通常のファイルでもフォルダでもありません", src)
+	}
+
+	// リンク自身を含むフォルダをコピーすると終わらなくなるため除く
+	if rel, err := filepath.Rel(src, dst); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return errors.New("参照先がリンク自身を含むフォルダのためコピーできません")
+	}
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		out := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(out, 0755)
+		case d.Type().IsRegular():
+			return copyFile(p, out)
+		}
+		return nil
+	})
+}
+
+// FormatExtractReport は展開結果を表示用の文字列にまとめます
+func FormatExtractReport(result *ExtractResult) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "展開したファイル: %d件（合計 %d バイト）\n", result.Files, result.Bytes)
+	if len(result.Skipped) == 0 {
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "展開しなかったエントリ: %d件\n", len(result.Skipped))
+	for i, s := range result.Skipped {
+		if i >= maxReportLines {
+			fmt.Fprintf(&sb, "…ほか%d件\n", len(result.Skipped)-maxReportLines)
+			break
+		}
+		fmt.Fprintf(&sb, "- %s: %s\n", s.Path, s.Reason)
+	}
+	return sb.String()
+}
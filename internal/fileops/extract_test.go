@@ -0,0 +1,240 @@
+package fileops
+
+import (
+	"archive/zip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// symlinkTestEntry はテスト用のZIPファイルに格納するエントリです（link が空でない場合はシンボリックリンク）
+type symlinkTestEntry struct {
+	name string
+	data string
+	link string
+}
+
+// symlinkTestEntries は展開先の中を指すリンクと、外を指す・ほかのリンクを経由するリンクを含むエントリです
+var symlinkTestEntries = []symlinkTestEntry{
+	{name: "a/file.txt", data: "file"},
+	{name: "a/dir/inner.txt", data: "inner"},
+	{name: "b/x.txt", data: "x"},
+	{name: "a/ok", link: "file.txt"},
+	{name: "a/okdir", link: "dir"},
+	{name: "a/sibling", link: "../b/x.txt"},
+	{name: "a/abs", link: "/etc/passwd"},
+	{name: "a/winabs", link: `C:\Windows\win.ini`},
+	{name: "a/backslash", link: `..\..\outside.txt`},
+	{name: "a/escape", link: "../../outside.txt"},
+	{name: "a/deep", link: "dir/../../../outside.txt"},
+	{name: "a/empty", link: ""},
+	{name: "a/via", link: "okdir/inner.txt"},          // 参照先の途中でほかのリンクを経由する
+	{name: "a/okdir/evil", link: "../../outside.txt"}, // リンク自身の場所がほかのリンクを経由する
+	{name: "a/chain", link: "escape"},                 // 参照先そのものがほかのリンク
+	{name: "../evil.txt", data: "evil"},               // 展開先のフォルダの直下に展開される
+}
+
+func TestExtractFolderSymlinks(t *testing.T) {
+	tests := []struct {
+		name   string
+		dir    string // 展開するアーカイブ内のフォルダ
+		policy SymlinkPolicy
+		// 展開先に作成されるべきリンクと、その内容（フォルダの場合は "dir"）
+		want map[string]string
+	}{
+		{name: "展開しない", dir: "", policy: SymlinkSkip, want: map[string]string{}},
+		{name: "リンクを作成", dir: "", policy: SymlinkCreate, want: map[string]string{"a/ok": "file", "a/okdir": "dir", "a/sibling": "x"}},
+		{name: "参照先をコピー", dir: "", policy: SymlinkCopy, want: map[string]string{"a/ok": "file", "a/okdir": "dir", "a/sibling": "x"}},
+		// a/ を展開する場合、b/ は展開するフォルダの外になる
+		{name: "フォルダを展開してリンクを作成", dir: "a/", policy: SymlinkCreate, want: map[string]string{"a/ok": "file", "a/okdir": "dir"}},
+		{name: "フォルダを展開して参照先をコピー", dir: "a/", policy: SymlinkCopy, want: map[string]string{"a/ok": "file", "a/okdir": "dir"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.policy == SymlinkCreate {
+				requireSymlink(t)
+			}
+			root := t.TempDir()
+			zipPath := writeSymlinkZip(t, filepath.Join(root, "links.zip"), symlinkTestEntries)
+			outside := filepath.Join(root, "outside.txt")
+			if err := os.WriteFile(outside, []byte("outside"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			dstDir := filepath.Join(root, "dst")
+			if err := os.Mkdir(dstDir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := ExtractFolder(zipPath, tt.dir, dstDir, tt.policy, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// ルートを展開する場合はアーカイブ名のフォルダの中に展開される
+			base := dstDir
+			if tt.dir == "" {
+				base = filepath.Join(dstDir, "links")
+			}
+
+			checkNothingOutside(t, root, dstDir, outside)
+
+			// 展開したリンクは、作成したリンクまたはコピーとして中身を読める
+			for name, content := range tt.want {
+				p := filepath.Join(base, filepath.FromSlash(name))
+				info, err := os.Lstat(p)
+				if err != nil {
+					t.Errorf("%s が展開されていません: %v", name, err)
+					continue
+				}
+				isLink := info.Mode()&fs.ModeSymlink != 0
+				if isLink != (tt.policy == SymlinkCreate) {
+					t.Errorf("%s: シンボリックリンクかどうか = %v", name, isLink)
+				}
+				if content == "dir" {
+					if data, err := os.ReadFile(filepath.Join(p, "inner.txt")); err != nil || string(data) != "inner" {
+						t.Errorf("%s/inner.txt = %q, %v", name, data, err)
+					}
+					continue
+				}
+				if data, err := os.ReadFile(p); err != nil || string(data) != content {
+					t.Errorf("%s = %q, %v, want %q", name, data, err, content)
+				}
+			}
+
+			// それ以外のリンクは作成せず、理由を記録する
+			skipped := make(map[string]bool)
+			for _, s := range result.Skipped {
+				skipped[s.Path] = true
+			}
+			for _, e := range symlinkTestEntries {
+				if e.data != "" || !strings.HasPrefix(e.name, tt.dir) {
+					continue
+				}
+				if _, ok := tt.want[e.name]; ok {
+					continue
+				}
+				if !skipped[e.name] {
+					t.Errorf("%s（参照先: %s）が展開しなかったエントリに記録されていません", e.name, e.link)
+				}
+				if _, err := os.Lstat(filepath.Join(base, filepath.FromSlash(e.name))); !os.IsNotExist(err) {
+					t.Errorf("%s（参照先: %s）が作成されています", e.name, e.link)
+				}
+			}
+		})
+	}
+}
+
+// ファイルを指定して展開する場合、"../" で始まるパスは展開先の中に展開し、シンボリックリンクは作成しない
+func TestExtractFilesSkipsOutsidePaths(t *testing.T) {
+	root := t.TempDir()
+	zipPath := writeSymlinkZip(t, filepath.Join(root, "links.zip"), symlinkTestEntries)
+	outside := filepath.Join(root, "outside.txt")
+	if err := os.WriteFile(outside, []byte("outside"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dstDir := filepath.Join(root, "dst")
+
+	result, err := ExtractFiles(zipPath, []string{"a/file.txt", "a/escape", "a/ok", "evil.txt"}, dstDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != 2 {
+		t.Errorf("展開したファイル = %d件, want 2件", result.Files)
+	}
+	if data, err := os.ReadFile(filepath.Join(dstDir, "evil.txt")); err != nil || string(data) != "evil" {
+		t.Errorf("../evil.txt は展開先の直下に展開されるべきです: %q, %v", data, err)
+	}
+	checkNothingOutside(t, root, dstDir, outside)
+	if _, err := os.Lstat(filepath.Join(dstDir, "a", "escape")); !os.IsNotExist(err) {
+		t.Error("ファイルを指定して展開した場合にシンボリックリンクが作成されています")
+	}
+}
+
+// requireSymlink はシンボリックリンクを作成できない環境（管理者権限・開発者モードでないWindowsなど）でテストを省略します
+func requireSymlink(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Symlink("target", filepath.Join(dir, "link")); err != nil {
+		t.Skipf("シンボリックリンクを作成できません: %v", err)
+	}
+}
+
+// writeSymlinkZip はシンボリックリンクを含むZIPファイルを作成します
+func writeSymlinkZip(t *testing.T, path string, entries []symlinkTestEntry) string {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		fh := &zip.FileHeader{Name: e.name, Method: zip.Store}
+		data := e.data
+		if e.link != "" || e.data == "" {
+			fh.SetMode(fs.ModeSymlink | 0o777)
+			data = e.link
+		} else {
+			fh.SetMode(0o644)
+		}
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// checkNothingOutside は root の中に、展開先 dstDir と元からあるファイル以外が作成されていないことと、
+// 展開先に作成されたリンクがすべて展開先の中を指していることを確認します
+func checkNothingOutside(t *testing.T, root, dstDir, outside string) {
+	t.Helper()
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "dst,links.zip,outside.txt" {
+		t.Errorf("展開先の外に作成されたものがあります: %v", names)
+	}
+	if data, err := os.ReadFile(outside); err != nil || string(data) != "outside" {
+		t.Errorf("展開先の外のファイルが変更されています: %q, %v", data, err)
+	}
+
+	realDst, err := filepath.EvalSymlinks(dstDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = filepath.WalkDir(dstDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return err
+		}
+		resolved, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			t.Errorf("%s: 参照先を解決できません: %v", p, err)
+			return nil
+		}
+		if rel, err := filepath.Rel(realDst, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			t.Errorf("%s が展開先の外 %s を指しています", p, resolved)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
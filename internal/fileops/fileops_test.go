@@ -0,0 +1,92 @@
+package fileops
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testEntry はテスト用のZIPファイルに格納するエントリです
+// raw がtrueの場合は data を圧縮済みのデータとして、method のまま書き込みます
+type testEntry struct {
+	name   string
+	data   []byte
+	method uint16
+	raw    bool
+}
+
+// testTime はテスト用のエントリの更新日時です
+var testTime = time.Date(2024, 5, 6, 7, 8, 10, 0, time.UTC)
+
+// testText は圧縮が効く程度に繰り返しのあるテスト用の内容を返します
+func testText(n int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < n; i++ {
+		buf.WriteString("ZIP Editor のテストデータ ")
+		buf.WriteByte(byte('a' + i%26))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()[:n]
+}
+
+// writeTestZip はエントリを格納したZIPファイルを dir に作成し、そのパスを返します
+func writeTestZip(t *testing.T, dir, name string, entries []testEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		fh := &zip.FileHeader{Name: e.name, Method: e.method, Modified: testTime}
+		var w io.Writer
+		var err error
+		if e.raw {
+			fh.CompressedSize64 = uint64(len(e.data))
+			w, err = zw.CreateRaw(fh)
+		} else {
+			w, err = zw.CreateHeader(fh)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// openTestZip はZIPファイルを開き、テストの終了時に閉じます
+func openTestZip(t *testing.T, path string) *zip.ReadCloser {
+	t.Helper()
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// readEntry はエントリを展開した内容を返します
+func readEntry(t *testing.T, f *zip.File) []byte {
+	t.Helper()
+	rc, err := f.Open()
+	if err != nil {
+		t.Fatalf("%s: %v", f.Name, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("%s: %v", f.Name, err)
+	}
+	return data
+}
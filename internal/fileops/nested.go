@@ -0,0 +1,169 @@
+package fileops
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"zip-editor/internal/common"
+	"zip-editor/internal/model"
+	"zip-editor/internal/zipfmt"
+)
+
+// ErrNestedReadOnly は入れ子のアーカイブの中に対して対応していない操作を行おうとした場合のエラーです
+var ErrNestedReadOnly = errors.New("入れ子のアーカイブの中に対しては、この操作を行えません")
+
+// findEntry はZIP内のエントリをUTF-8に変換したパスで探します
+func findEntry(reader *zip.Reader, utf8Path string) *zip.File {
+	for _, f := range reader.File {
+		if common.AutoDetectEncoding(f.Name) == utf8Path {
+			return f
+		}
+	}
+	return nil
+}
+
+// openNested はパスに含まれる入れ子のアーカイブを外側から順に開き、
+// 最も内側のアーカイブのリーダーと、その中でのパスを返します
+func openNested(reader *zip.Reader, entryPath string) (*zip.Reader, string, error) {
+	for {
+		idx := strings.Index(entryPath, model.NestedSeparator)
+		if idx < 0 {
+			return reader, entryPath, nil
+		}
+
+		archive := findEntry(reader, entryPath[:idx])
+		if archive == nil {
+			return nil, "", os.ErrNotExist
+		}
+		readerAt, size, err := zipfmt.OpenReaderAt(archive)
+		if err != nil {
+			return nil, "", err
+		}
+		reader, err = zip.NewReader(readerAt, size)
+		if err != nil {
+			return nil, "", err
+		}
+		entryPath = entryPath[idx+len(model.NestedSeparator):]
+	}
+}
+
+// hasNestedEdits は入れ子のアーカイブの中に削除フラグが付いたファイルがあるかどうかを返します
+// archivePath は入れ子のアーカイブのパス（区切り文字を含む）です
+func (s deleteFlagSnapshot) hasNestedEdits(zipPath, archivePath string) bool {
+	prefix := getDeleteFlagKey(zipPath, archivePath)
+	for key := range s {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// rebuildNested は入れ子のアーカイブを、中の削除フラグを反映して作り直します
+// 作り直したアーカイブは元のエントリと同じヘッダー・圧縮方式で一時ZIPファイルに格納し、そのエントリを返します
+// 返されたエントリは、使い終わったら cleanup で一時ファイルごと破棄してください
+func rebuildNested(zipPath string, file *zip.File, archivePath string, flags deleteFlagSnapshot, comments *commentSnapshot) (rebuilt *zip.File, cleanup func(), err error) {
+	inner, err := zipfmt.OpenNested(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer inner.Close()
+
+	tempDir, err := os.MkdirTemp("", "zip-editor-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup = func() { os.RemoveAll(tempDir) }
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+
+	// 削除フラグを反映したアーカイブを作成（さらに入れ子になっている場合は再帰的に作り直す）
+	// アーカイブ全体のコメントと先頭に付加されたデータは、保存と同じく元のアーカイブから引き継ぐ
+	innerPath := filepath.Join(tempDir, "inner.zip")
+	if err := writeRewrittenZip(innerPath, inner, func(innerWriter *zip.Writer) error {
+		return saveEntries(zipPath, archivePath, innerWriter, inner.Reader, SaveOptions{comments: comments, flags: flags})
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	// ヘッダーは元のエントリから引き継ぎ、サイズとCRCは書き込み時に計算させる
+	header := file.FileHeader
+	header.Extra = zipfmt.RemoveExtra(header.Extra, zipfmt.Zip64ExtraID)
+	header.CompressedSize64 = 0
+	header.UncompressedSize64 = 0
+	header.CRC32 = 0
+	if zipfmt.Compressor(header.Method) == nil {
+		// 圧縮に対応していない方式（Deflate64など）で格納されていた場合はDeflateで格納し直す
+		zipfmt.SetMethod(&header, zip.Deflate)
+	}
+
+	outerPath := filepath.Join(tempDir, "outer.zip")
+	if err := writeZipFile(outerPath, func(outerWriter *zip.Writer) error {
+		src, err := os.Open(innerPath)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		writer, err := outerWriter.CreateHeader(&header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(writer, src)
+		return err
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := zipfmt.OpenReader(outerPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(reader.File) != 1 {
+		reader.Close()
+		return nil, nil, zip.ErrFormat
+	}
+	removeTemp := cleanup
+	cleanup = func() {
+		reader.Close()
+		removeTemp()
+	}
+	return reader.File[0], cleanup, nil
+}
+
+// writeRewrittenZip は新しいZIPファイルを作成し、reader を RewriteArchive で書き直した内容を書き込みます
+func writeRewrittenZip(path string, reader *zipfmt.ReadCloser, write func(zipWriter *zip.Writer) error) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := zipfmt.RewriteArchive(out, reader, zipfmt.RewriteOptions{}, write); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// writeZipFile は新しいZIPファイルを作成し、write で内容を書き込みます
+func writeZipFile(path string, write func(zipWriter *zip.Writer) error) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zipWriter := zip.NewWriter(out)
+	if err := write(zipWriter); err != nil {
+		return err
+	}
+	if err := zipWriter.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
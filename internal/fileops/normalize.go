@@ -0,0 +1,65 @@
+package fileops
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"strings"
+	"zip-editor/internal/common"
+	"zip-editor/internal/model"
+	"zip-editor/internal/zipfmt"
+)
+
+// NormalizeResult はアーカイブの正規化の結果です
+type NormalizeResult struct {
+	Entries int    // 正規化して書き込んだエントリ数
+	SHA256  string // 正規化したZIPファイルのSHA-256（16進数）
+}
+
+// NormalizeZipFile は削除フラグを反映し、エントリを正規化してZIPファイルを書き直します
+// 元のファイルを2回それぞれ一時ファイルに正規化し、同じバイト列になった場合にだけ元のファイルを置き換えます
+func NormalizeZipFile(zipPath string, opts zipfmt.NormalizeOptions) (*NormalizeResult, error) {
+	if err := requireZip(zipPath); err != nil {
+		return nil, err
+	}
+
+	// 正規化ではコメントを取り除くため、正規化を始めた時点のコメントの変更を破棄する
+	comments := snapshotCommentEdits(zipPath)
+	flags := snapshotDeleteFlags(zipPath)
+	sum, entries, err := zipfmt.NormalizeFile(zipPath, opts, func(files []*zip.File) ([]*zip.File, error) {
+		return normalizeFiles(zipPath, files, flags)
+	})
+	if err != nil {
+		return nil, err
+	}
+	clearCommentEdits(zipPath, comments)
+	return &NormalizeResult{Entries: entries, SHA256: sum}, nil
+}
+
+// normalizeFiles は削除フラグが付いていない、正規化して書き込むエントリを返します
+func normalizeFiles(zipPath string, files []*zip.File, flags deleteFlagSnapshot) ([]*zip.File, error) {
+	var selected []*zip.File
+	for _, file := range files {
+		path := common.AutoDetectEncoding(file.Name)
+		archivePath := path + model.NestedSeparator
+		if flags.deleted(zipPath, path) || flags.deleted(zipPath, archivePath) {
+			continue
+		}
+		// 入れ子のアーカイブの中の削除は、作り直したアーカイブの内容が一定にならないため先に保存してもらう
+		if zipfmt.IsArchiveName(path) && flags.hasNestedEdits(zipPath, archivePath) {
+			return nil, errors.New(path + ": 入れ子のアーカイブの中に削除フラグが付いたファイルがあります（先に削除を反映してから正規化してください）")
+		}
+		selected = append(selected, file)
+	}
+	return selected, nil
+}
+
+// FormatNormalizeReport は正規化の結果を表示用の文字列にまとめます
+func FormatNormalizeReport(result *NormalizeResult) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "正規化したエントリ: %d件\n", result.Entries)
+	fmt.Fprintf(&sb, "SHA-256: %s\n", result.SHA256)
+	sb.WriteString("2回正規化して同じ内容になることを確認しました\n")
+	return sb.String()
+}
@@ -0,0 +1,38 @@
+package fileops
+
+import (
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// EntryInfo はZIPファイルのエントリの、並べ替えの画面に表示する情報です
+type EntryInfo struct {
+	Path string // UTF-8に変換したパス
+	Size uint64 // 展開後のサイズ
+}
+
+// ListEntries はZIPファイルのエントリを、格納されている順に返します
+func ListEntries(zipPath string) ([]EntryInfo, error) {
+	if err := requireZip(zipPath); err != nil {
+		return nil, err
+	}
+	reader, err := zipfmt.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	entries := make([]EntryInfo, len(reader.File))
+	for i, file := range reader.File {
+		entries[i] = EntryInfo{Path: common.AutoDetectEncoding(file.Name), Size: file.UncompressedSize64}
+	}
+	return entries, nil
+}
+
+// ReorderZipFile は削除フラグを反映し、エントリを指定した順序に並べ替えてZIPファイルを書き直します
+func ReorderZipFile(zipPath string, order zipfmt.EntryOrder, prompt PasswordFunc) error {
+	if err := requireZip(zipPath); err != nil {
+		return err
+	}
+	return SaveZipFile(zipPath, SaveOptions{Order: &order, Prompt: prompt})
+}
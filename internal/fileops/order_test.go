@@ -0,0 +1,57 @@
+package fileops
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"zip-editor/internal/zipfmt"
+)
+
+// 並べ替えでは削除フラグを反映し、エントリの内容はそのままコピーする
+func TestReorderZipFile(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestZip(t, dir, "a.epub", []testEntry{
+		{name: "OEBPS/", data: nil},
+		{name: "OEBPS/large.xhtml", data: testText(3000), method: zip.Deflate},
+		{name: "OEBPS/small.xhtml", data: testText(100), method: zip.Deflate},
+		{name: "deleted.txt", data: []byte("削除する")},
+		{name: "mimetype", data: []byte("application/epub+zip")},
+	})
+	entries, err := ListEntries(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 || entries[1] != (EntryInfo{Path: "OEBPS/large.xhtml", Size: 3000}) {
+		t.Errorf("ListEntries = %+v", entries)
+	}
+
+	setDeleteFlag(path, "deleted.txt", true)
+	t.Cleanup(func() { setDeleteFlag(path, "deleted.txt", false) })
+	order := zipfmt.EntryOrder{Mode: zipfmt.OrderBySize, Descending: true, First: zipfmt.OrderPresets[0].First}
+	if err := ReorderZipFile(path, order, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		name string
+		data []byte
+	}{
+		{"mimetype", []byte("application/epub+zip")},
+		{"OEBPS/large.xhtml", testText(3000)},
+		{"OEBPS/small.xhtml", testText(100)},
+		{"OEBPS/", nil},
+	}
+	files := openTestZip(t, path).File
+	if len(files) != len(want) {
+		t.Fatalf("エントリ数 = %d, want %d", len(files), len(want))
+	}
+	for i, f := range files {
+		if f.Name != want[i].name {
+			t.Errorf("%d: %s, want %s", i, f.Name, want[i].name)
+			continue
+		}
+		if !bytes.Equal(readEntry(t, f), want[i].data) {
+			t.Errorf("%s: 内容が変わりました", f.Name)
+		}
+	}
+}
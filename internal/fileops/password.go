@@ -0,0 +1,170 @@
+package fileops
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"sync"
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// PasswordFunc は暗号化されたエントリのパスワード入力を求めるコールバックです
+// retry は直前に入力されたパスワードが正しくなかったかどうかを示します
+// ok がfalseの場合は入力が取り消されたものとして扱います
+type PasswordFunc func(zipPath, entryPath string, retry bool) (password string, ok bool)
+
+// ErrPasswordRequired はパスワードが必要だが入力手段がない、または入力が取り消された場合のエラーです
+var ErrPasswordRequired = errors.New("暗号化されたファイルを開くにはパスワードが必要です")
+
+// passwordCache は正しかったパスワードをZIPファイルごとに保持するマップ
+// キーはZIPファイルパス、値はそのZIPで使用できたパスワードの一覧
+// passwordRejected は照合値が偶然一致しただけの誤ったパスワードを取り除いたZIPファイルで、次の入力を retry として求めます
+var (
+	passwordCache    = make(map[string][]string)
+	passwordRejected = make(map[string]bool)
+	passwordCacheMu  sync.Mutex
+)
+
+// cachedPasswords は指定したZIPファイルでこれまでに使用できたパスワードを返します
+func cachedPasswords(zipPath string) []string {
+	passwordCacheMu.Lock()
+	defer passwordCacheMu.Unlock()
+	return append([]string(nil), passwordCache[zipPath]...)
+}
+
+// cachePassword はパスワードをキャッシュに追加します
+func cachePassword(zipPath, password string) {
+	passwordCacheMu.Lock()
+	defer passwordCacheMu.Unlock()
+	for _, p := range passwordCache[zipPath] {
+		if p == password {
+			return
+		}
+	}
+	passwordCache[zipPath] = append(passwordCache[zipPath], password)
+}
+
+// rejectPassword は読み終えた時点のCRC・認証コードの照合で誤りとわかったパスワードをキャッシュから取り除きます
+// 次にパスワードの入力を求める際は、直前のパスワードが正しくなかったものとして retry をtrueにします
+func rejectPassword(zipPath, password string) {
+	passwordCacheMu.Lock()
+	defer passwordCacheMu.Unlock()
+	passwords := passwordCache[zipPath][:0:0]
+	for _, p := range passwordCache[zipPath] {
+		if p != password {
+			passwords = append(passwords, p)
+		}
+	}
+	passwordCache[zipPath] = passwords
+	passwordRejected[zipPath] = true
+}
+
+// takePasswordRejected はパスワードが取り除かれていたかどうかを返し、その記録を消します
+func takePasswordRejected(zipPath string) bool {
+	passwordCacheMu.Lock()
+	defer passwordCacheMu.Unlock()
+	rejected := passwordRejected[zipPath]
+	delete(passwordRejected, zipPath)
+	return rejected
+}
+
+// ClearPasswordCache は指定したZIPファイルのパスワードキャッシュを破棄します
+func ClearPasswordCache(zipPath string) {
+	passwordCacheMu.Lock()
+	defer passwordCacheMu.Unlock()
+	delete(passwordCache, zipPath)
+	delete(passwordRejected, zipPath)
+}
+
+// entryPassword は暗号化されたエントリに使用できるパスワードを返します
+// キャッシュ済みのパスワードを試したあと、prompt で入力を求めます
+// パスワードは暗号化ヘッダの照合値で確認するため（zipfmt.CheckPassword）、エントリのデータは読み取りません
+// 照合値が偶然一致した誤ったパスワードは、読み終えた時点のCRC・認証コードの照合でエラーになり、
+// rejectPassword でキャッシュから取り除かれます（次の入力は retry として求めます）
+func entryPassword(zipPath string, file *zip.File, prompt PasswordFunc) (string, error) {
+	// キャッシュ済みのパスワードを順に試す
+	for _, password := range cachedPasswords(zipPath) {
+		err := zipfmt.CheckPassword(file, password)
+		if err == nil {
+			return password, nil
+		}
+		if !errors.Is(err, zipfmt.ErrPassword) {
+			return "", err
+		}
+	}
+
+	if prompt == nil {
+		return "", ErrPasswordRequired
+	}
+
+	// 正しいパスワードが入力されるか、取り消されるまで繰り返す
+	entryPath := common.AutoDetectEncoding(file.Name)
+	retry := takePasswordRejected(zipPath)
+	for {
+		password, ok := prompt(zipPath, entryPath, retry)
+		if !ok {
+			return "", ErrPasswordRequired
+		}
+		err := zipfmt.CheckPassword(file, password)
+		if err == nil {
+			cachePassword(zipPath, password)
+			return password, nil
+		}
+		if !errors.Is(err, zipfmt.ErrPassword) {
+			return "", err
+		}
+		retry = true
+	}
+}
+
+// openEntry はエントリを展開して読み取るリーダーを返します
+// 暗号化されている場合（ZipCrypto・AES）は、パスワードを求めて復号します
+// 読み終えた時点の照合でパスワードの誤りとわかった場合は、そのパスワードをキャッシュから取り除きます
+func openEntry(zipPath string, file *zip.File, prompt PasswordFunc) (io.ReadCloser, error) {
+	if file.Flags&zipfmt.FlagEncrypted == 0 {
+		return zipfmt.OpenFile(file)
+	}
+
+	password, err := entryPassword(zipPath, file, prompt)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := zipfmt.OpenEncrypted(file, password)
+	if err != nil {
+		return nil, err
+	}
+	return &passwordCheckReader{ReadCloser: rc, zipPath: zipPath, password: password}, nil
+}
+
+// passwordCheckReader は復号したエントリを読み取り、パスワードの誤りがわかった時点でキャッシュから取り除くリーダーです
+type passwordCheckReader struct {
+	io.ReadCloser
+	zipPath  string
+	password string
+}
+
+func (r *passwordCheckReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	if errors.Is(err, zipfmt.ErrPassword) {
+		rejectPassword(r.zipPath, r.password)
+	}
+	return n, err
+}
+
+// readEntryData はエントリを openEntry で開いて read に渡します
+// 照合値が偶然一致した誤ったパスワードで復号していた場合は、パスワードを入力し直して read をやり直します
+// （read は最初から書き直せるようにしてください）。prompt がnilの場合はやり直さずにエラーを返します
+func readEntryData(zipPath string, file *zip.File, prompt PasswordFunc, read func(r io.Reader) error) error {
+	for {
+		rc, err := openEntry(zipPath, file, prompt)
+		if err != nil {
+			return err
+		}
+		err = read(rc)
+		rc.Close()
+		if !errors.Is(err, zipfmt.ErrPassword) || prompt == nil || file.Flags&zipfmt.FlagEncrypted == 0 {
+			return err
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package fileops
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"zip-editor/internal/zipfmt"
+)
+
+// 暗号化ヘッダの照合値が偶然一致した誤ったパスワードは、読み終えた時点の照合でキャッシュから取り除き、retry として入力し直してもらう
+func TestWrongPasswordPassingCheck(t *testing.T) {
+	content := testText(5000)
+	path := writeTestZip(t, t.TempDir(), "a.zip", []testEntry{{name: "a.txt", data: content, method: zip.Deflate}})
+	if err := SaveZipFile(path, SaveOptions{Password: "secret", Encryption: zipfmt.EncryptionZipCrypto}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ClearPasswordCache(path) })
+
+	// ZipCryptoの照合値は1バイトのため、256個に1個程度は誤ったパスワードでも一致する
+	f := openTestZip(t, path).File[0]
+	wrong := ""
+	for i := 0; i < 100000 && wrong == ""; i++ {
+		candidate := fmt.Sprintf("wrong%d", i)
+		if zipfmt.CheckPassword(f, candidate) == nil {
+			wrong = candidate
+		}
+	}
+	if wrong == "" {
+		t.Fatal("照合値が一致する誤ったパスワードが見つかりません")
+	}
+
+	// 入力を求められない場合は、誤ったパスワードを取り除いてエラーにする
+	ClearPasswordCache(path)
+	cachePassword(path, wrong)
+	result, err := VerifyZipFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Failures) != 1 {
+		t.Errorf("失敗したエントリ = %v, want 1件", result.Failures)
+	}
+	if len(cachedPasswords(path)) != 0 {
+		t.Errorf("キャッシュ = %v, want なし", cachedPasswords(path))
+	}
+
+	tests := []struct {
+		name string
+		run  func(prompt PasswordFunc) error
+	}{
+		{name: "テスト", run: func(prompt PasswordFunc) error {
+			result, err := VerifyZipFile(path, prompt)
+			if err == nil && len(result.Failures) > 0 {
+				err = fmt.Errorf("%s: %s", result.Failures[0].Path, result.Failures[0].Reason)
+			}
+			return err
+		}},
+		{name: "一時フォルダに展開", run: func(prompt PasswordFunc) error {
+			out, err := ExtractFileToTemp(path, "a.txt", prompt)
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(out)
+			data, err := os.ReadFile(out)
+			if err == nil && string(data) != string(content) {
+				err = fmt.Errorf("展開した内容が一致しません")
+			}
+			return err
+		}},
+		// 保存し直したアーカイブは "secret" で開けなくなるため最後に行う
+		{name: "AES-256で暗号化し直す", run: func(prompt PasswordFunc) error {
+			return SaveZipFile(path, SaveOptions{Password: "new-secret", Encryption: zipfmt.EncryptionAES256, Prompt: prompt})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ClearPasswordCache(path)
+			cachePassword(path, wrong)
+			var retries []bool
+			prompt := func(zipPath, entryPath string, retry bool) (string, bool) {
+				retries = append(retries, retry)
+				return "secret", len(retries) < 5
+			}
+			if err := tt.run(prompt); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(retries, []bool{true}) {
+				t.Errorf("パスワードの入力（retry）= %v, want [true]", retries)
+			}
+			if slices.Contains(cachedPasswords(path), wrong) {
+				t.Error("誤ったパスワードがキャッシュに残っています")
+			}
+		})
+	}
+}
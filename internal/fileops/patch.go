@@ -0,0 +1,44 @@
+package fileops
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"zip-editor/internal/zipfmt"
+)
+
+// CreatePatch は古いアーカイブを新しいアーカイブに更新するパッチを patchPath に作成し、結果の報告を返します
+func CreatePatch(oldPath, newPath, patchPath string) (string, error) {
+	info, err := zipfmt.CreatePatchFile(oldPath, newPath, patchPath)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.WriteString(FormatPatchReport(info))
+	if fi, err := os.Stat(patchPath); err == nil {
+		fmt.Fprintf(&sb, "\nパッチ: %s（%d バイト）\n", filepath.Base(patchPath), fi.Size())
+	}
+	return sb.String(), nil
+}
+
+// ApplyPatch は古いアーカイブにパッチを適用して outPath に新しいアーカイブを作成し、結果の報告を返します
+// outPath に古いアーカイブを指定した場合は置き換えます（SHA-256を確かめられなかった場合は何も変更しません）
+func ApplyPatch(oldPath, patchPath, outPath string) (string, error) {
+	info, err := zipfmt.ApplyPatchFile(oldPath, patchPath, outPath)
+	if err != nil {
+		return "", err
+	}
+	return "パッチを適用し、" + filepath.Base(outPath) + " を作成しました（SHA-256が一致することを確認しました）。\n\n" + FormatPatchReport(info), nil
+}
+
+// FormatPatchReport はパッチの内容の概要を表示用の文字列にします
+func FormatPatchReport(info *zipfmt.PatchInfo) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "古い版: %d バイト\nSHA-256: %s\n", info.OldSize, hex.EncodeToString(info.OldSHA256[:]))
+	fmt.Fprintf(&sb, "新しい版: %d バイト\nSHA-256: %s\n", info.NewSize, hex.EncodeToString(info.NewSHA256[:]))
+	fmt.Fprintf(&sb, "古い版からコピー: %d バイト\nパッチに含めた部分: %d バイト（圧縮前）\n", info.Copied, info.Inserted)
+	return sb.String()
+}
@@ -0,0 +1,390 @@
+package fileops
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"zip-editor/internal/common"
+	"zip-editor/internal/model"
+	"zip-editor/internal/zipfmt"
+)
+
+// RecompressOptions は再圧縮のオプションです
+type RecompressOptions struct {
+	Method uint16 // 再圧縮に使用する圧縮方式（zipfmt.WritableMethods のいずれか）
+	Level  int    // 圧縮レベル（zipfmt.LevelDefault で各方式の標準）
+	// Rules はファイルごとに Method・Level の代わりに使う圧縮方式の規則です
+	// 先頭から順に照合し、最初に一致した規則を使います（どれにも一致しない場合は Method・Level を使います）
+	Rules []RecompressRule
+	// Items が空でない場合は、指定したファイルとフォルダ（配下のファイルを含む）だけを再圧縮します
+	Items []*model.ZipTreeItem
+}
+
+// RecompressRule はパスのパターンと展開後のサイズで選んだファイルに使う圧縮方式です
+type RecompressRule struct {
+	Patterns []string // パターン（書式は common.CompilePatterns を参照、空の場合はすべてのファイルに一致する）
+	MinSize  int64    // 展開後のサイズがこれ以上のファイルにだけ一致する（0の場合は制限なし）
+	Method   uint16
+	Level    int
+	Keep     bool // trueの場合、一致したファイルは再圧縮せずにそのまま残す
+}
+
+// recompressPolicy は再圧縮のオプションから、ファイルごとの圧縮方式を選ぶ規則を解釈したものです
+type recompressPolicy struct {
+	rules    []RecompressRule
+	matchers []*common.PathMatcher // rules と同じ順序（パターンが空の場合はnil）
+	method   uint16
+	level    int
+}
+
+// newRecompressPolicy は規則のパターンを解釈し、圧縮方式が圧縮に対応しているかを確認します
+func newRecompressPolicy(opts RecompressOptions) (*recompressPolicy, error) {
+	policy := &recompressPolicy{rules: opts.Rules, method: opts.Method, level: opts.Level}
+	methods := []uint16{opts.Method}
+	for _, rule := range opts.Rules {
+		var matcher *common.PathMatcher
+		if len(rule.Patterns) > 0 {
+			var err error
+			if matcher, err = common.CompilePatterns(rule.Patterns); err != nil {
+				return nil, err
+			}
+		}
+		policy.matchers = append(policy.matchers, matcher)
+		if !rule.Keep {
+			methods = append(methods, rule.Method)
+		}
+	}
+	for _, method := range methods {
+		if zipfmt.Compressor(method) == nil {
+			return nil, fmt.Errorf("圧縮方式 %s での圧縮には対応していません", zipfmt.MethodName(method))
+		}
+	}
+	return policy, nil
+}
+
+// choose はファイルに使う圧縮方式と圧縮レベルを返します。keep がtrueの場合は再圧縮しません
+func (p *recompressPolicy) choose(path string, size uint64) (method uint16, level int, keep bool) {
+	for i, rule := range p.rules {
+		if rule.MinSize > 0 && size < uint64(rule.MinSize) {
+			continue
+		}
+		if p.matchers[i] != nil && !p.matchers[i].Match(path) {
+			continue
+		}
+		return rule.Method, rule.Level, rule.Keep
+	}
+	return p.method, p.level, false
+}
+
+// RecompressResult は再圧縮の結果です
+type RecompressResult struct {
+	Total        int   // 対象にしたファイル数
+	Recompressed int   // 再圧縮して小さくなったファイル数
+	Skipped      int   // 圧縮済みの形式のため再圧縮しなかったファイル数
+	Kept         int   // 規則で再圧縮しないとしたファイル数
+	Unsupported  int   // 暗号化や未対応の圧縮方式のため再圧縮しなかったファイル数
+	Before       int64 // 対象ファイルの再圧縮前の圧縮サイズの合計
+	After        int64 // 対象ファイルの再圧縮後の圧縮サイズの合計
+}
+
+// Saved は再圧縮によって削減できたバイト数を返します
+func (r *RecompressResult) Saved() int64 {
+	return r.Before - r.After
+}
+
+// errNotSmaller は再圧縮しても元の圧縮サイズより小さくならなかったことを示します
+var errNotSmaller = errors.New("再圧縮しても小さくなりません")
+
+// recompressJob はひとつのエントリの再圧縮の結果です
+// 再圧縮したデータは一時ファイルに書き込み、元の順序でZIPファイルに書き込むまで保持します
+type recompressJob struct {
+	file     *zip.File
+	tempPath string
+	method   uint16
+	level    int
+	done     chan struct{}
+
+	size    int64 // 再圧縮後のサイズ（小さくならなかった場合は0）
+	skipped bool  // 圧縮済みの形式のため再圧縮しなかった
+	err     error
+}
+
+// RecompressZipFile はZIPファイルのエントリを、ファイルごとに規則で選んだ圧縮方式で再圧縮します
+// 圧縮済みの形式（画像・動画・アーカイブなど）は内容から判定して対象から外し、
+// 元より小さくなったエントリだけを置き換えます。再圧縮はCPUのコア数に合わせて並列に行います
+// コメントの変更は、再圧縮を始めた時点のものを反映して破棄します
+func RecompressZipFile(zipPath string, opts RecompressOptions) (*RecompressResult, error) {
+	policy, err := newRecompressPolicy(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireZip(zipPath); err != nil {
+		return nil, err
+	}
+
+	tempDir, err := os.MkdirTemp("", "zip-editor-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, item := range opts.Items {
+		if item.IsNested() || item.IsArchive() {
+			return nil, ErrNestedReadOnly
+		}
+	}
+	targets := recompressTargets(opts.Items)
+	result := &RecompressResult{}
+
+	comments := snapshotCommentEdits(zipPath)
+	err = rewriteZipFile(zipPath, SaveOptions{comments: comments}, func(zipWriter *zip.Writer, reader *zipfmt.ReadCloser) error {
+		// 対象のエントリを選ぶ
+		jobs := make(map[*zip.File]*recompressJob)
+		var queue []*recompressJob
+		for i, file := range reader.File {
+			// シンボリックリンクは参照先をそのまま残すため、ディレクトリと同じく対象外にする
+			if strings.HasSuffix(file.Name, "/") || zipfmt.IsSymlink(&file.FileHeader) {
+				continue
+			}
+			path := common.AutoDetectEncoding(file.Name)
+			if targets != nil && !targets[path] {
+				continue
+			}
+			result.Total++
+			if file.Flags&zipfmt.FlagEncrypted != 0 || zipfmt.Decompressor(file.Method) == nil {
+				result.Unsupported++
+				continue
+			}
+			method, level, keep := policy.choose(path, file.UncompressedSize64)
+			if keep {
+				result.Kept++
+				continue
+			}
+			job := &recompressJob{
+				file:     file,
+				tempPath: filepath.Join(tempDir, strconv.Itoa(i)),
+				method:   method,
+				level:    level,
+				done:     make(chan struct{}),
+			}
+			jobs[file] = job
+			queue = append(queue, job)
+		}
+
+		// ワーカーを起動する
+		// 一時ファイルが増えすぎないよう、書き込みを待っている結果の数を制限する
+		workers := runtime.NumCPU()
+		pending := make(chan struct{}, workers*2)
+		quit := make(chan struct{})
+		defer close(quit)
+		work := make(chan *recompressJob)
+		go func() {
+			defer close(work)
+			for _, job := range queue {
+				select {
+				case pending <- struct{}{}:
+				case <-quit:
+					return
+				}
+				select {
+				case work <- job:
+				case <-quit:
+					return
+				}
+			}
+		}()
+		for range workers {
+			go func() {
+				for job := range work {
+					job.size, job.skipped, job.err = recompressEntry(job.file, job.tempPath, job.method, job.level)
+					close(job.done)
+				}
+			}()
+		}
+
+		// 元の順序でエントリを書き込む（コメントが変更されている場合は、変更を反映したヘッダーで書き込む）
+		for _, file := range reader.File {
+			header, err := comments.editedHeader(zipPath, common.AutoDetectEncoding(file.Name), file)
+			if err != nil {
+				return err
+			}
+			job, ok := jobs[file]
+			if !ok {
+				if err := zipfmt.CopyRaw(zipWriter, file, header); err != nil {
+					return err
+				}
+				continue
+			}
+
+			<-job.done
+			<-pending
+			if job.err != nil {
+				return fmt.Errorf("%s: %w", common.AutoDetectEncoding(file.Name), job.err)
+			}
+
+			result.Before += int64(file.CompressedSize64)
+			switch {
+			case job.skipped:
+				result.Skipped++
+			case job.size > 0:
+				result.Recompressed++
+				result.After += job.size
+				if err := writeRecompressed(zipWriter, file, header, job.tempPath, job.size, job.method); err != nil {
+					return err
+				}
+				os.Remove(job.tempPath)
+				continue
+			}
+			result.After += int64(file.CompressedSize64)
+			if err := zipfmt.CopyRaw(zipWriter, file, header); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	clearCommentEdits(zipPath, comments)
+	return result, nil
+}
+
+// recompressTargets は選択されたアイテムに含まれるファイルのパスを返します
+// アイテムが指定されていない場合はすべてのファイルを対象とするためnilを返します
+func recompressTargets(items []*model.ZipTreeItem) map[string]bool {
+	if len(items) == 0 {
+		return nil
+	}
+	targets := make(map[string]bool)
+	var collect func(item *model.ZipTreeItem)
+	collect = func(item *model.ZipTreeItem) {
+		if !item.IsDir() {
+			targets[item.GetPath()] = true
+			return
+		}
+		for _, file := range item.GetFiles() {
+			collect(file)
+		}
+		for _, child := range item.GetChildren() {
+			collect(child)
+		}
+	}
+	for _, item := range items {
+		collect(item)
+	}
+	return targets
+}
+
+// recompressEntry はエントリを展開して再圧縮し、結果を一時ファイルに書き込みます
+// 元の圧縮サイズより小さくならない場合は size が0になります
+func recompressEntry(file *zip.File, tempPath string, method uint16, level int) (size int64, skipped bool, err error) {
+	rc, err := zipfmt.OpenFile(file)
+	if err != nil {
+		return 0, false, err
+	}
+	defer rc.Close()
+
+	// 先頭のバイト列から圧縮済みの形式かどうかを判定
+	head := make([]byte, zipfmt.SniffLen)
+	n, err := io.ReadFull(rc, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, false, err
+	}
+	if zipfmt.IsCompressedData(head[:n]) {
+		return 0, true, nil
+	}
+
+	out, err := os.Create(tempPath)
+	if err != nil {
+		return 0, false, err
+	}
+	defer out.Close()
+
+	// 元の圧縮サイズに達した時点で打ち切る
+	limited := &limitWriter{w: out, remaining: int64(file.CompressedSize64)}
+	comp, err := zipfmt.CompressorLevel(method, level)(limited)
+	if err != nil {
+		return 0, false, err
+	}
+	_, err = io.Copy(comp, io.MultiReader(bytes.NewReader(head[:n]), rc))
+	if err == nil {
+		err = comp.Close()
+	}
+	// 圧縮ライターによっては書き込みのエラーを返さないため、制限を超えたかどうかも確認する
+	if errors.Is(err, errNotSmaller) || limited.exceeded {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return int64(file.CompressedSize64) - limited.remaining, false, out.Close()
+}
+
+// writeRecompressed は再圧縮したデータを、元のエントリのヘッダーを引き継いで書き込みます
+// fh がnilでない場合は、元のヘッダーの代わりに引き継ぎます
+func writeRecompressed(zipWriter *zip.Writer, file *zip.File, fh *zip.FileHeader, tempPath string, size int64, method uint16) error {
+	header := file.FileHeader
+	if fh != nil {
+		header = *fh
+	}
+	zipfmt.SetMethod(&header, method)
+	header.ReaderVersion = zipfmt.RequiredVersion(method)
+	header.CompressedSize64 = uint64(size)
+	header.Extra = zipfmt.RemoveExtra(header.Extra, zipfmt.Zip64ExtraID)
+
+	src, err := os.Open(tempPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	writer, err := zipWriter.CreateRaw(&header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, src)
+	return err
+}
+
+// limitWriter は書き込めるバイト数を制限し、超えた場合に errNotSmaller を返すライターです
+type limitWriter struct {
+	w         io.Writer
+	remaining int64
+	exceeded  bool
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.exceeded || int64(len(p)) >= l.remaining {
+		l.exceeded = true
+		return 0, errNotSmaller
+	}
+	n, err := l.w.Write(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// FormatRecompressReport は再圧縮の結果を表示用の文字列にまとめます
+func FormatRecompressReport(result *RecompressResult) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "対象のファイル: %d件\n", result.Total)
+	fmt.Fprintf(&sb, "再圧縮したファイル: %d件\n", result.Recompressed)
+	if result.Skipped > 0 {
+		fmt.Fprintf(&sb, "圧縮済みの形式のため対象外: %d件\n", result.Skipped)
+	}
+	if result.Kept > 0 {
+		fmt.Fprintf(&sb, "規則により対象外: %d件\n", result.Kept)
+	}
+	if result.Unsupported > 0 {
+		fmt.Fprintf(&sb, "暗号化や未対応の圧縮方式のため対象外: %d件\n", result.Unsupported)
+	}
+	fmt.Fprintf(&sb, "圧縮サイズ: %d バイト → %d バイト（%d バイト削減）\n", result.Before, result.After, result.Saved())
+	return sb.String()
+}
@@ -0,0 +1,194 @@
+package fileops
+
+import (
+	"archive/zip"
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// 再圧縮は小さくなるエントリだけを置き換え、圧縮済みの形式・小さくならないもの・展開できないものはそのまま残す
+func TestRecompressZipFile(t *testing.T) {
+	random := make([]byte, 20<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	// 先頭はPNGだが、後ろは圧縮が効く内容
+	png := append([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), testText(20<<10)...)
+	entries := []testEntry{
+		{name: "dir/", data: nil},
+		{name: "dir/text.txt", data: testText(50 << 10), method: zip.Store},
+		{name: "image.png", data: png, method: zip.Store},
+		{name: "random.bin", data: random, method: zip.Store},
+		{name: "deflated.txt", data: testText(30 << 10), method: zip.Deflate},
+		{name: "ppmd.bin", data: []byte("PPMdで圧縮されたデータ"), method: 98, raw: true},
+	}
+
+	for _, method := range []uint16{zip.Deflate, zipfmt.MethodXZ} {
+		t.Run(zipfmt.MethodName(method), func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeTestZip(t, dir, "a.zip", entries)
+			result, err := RecompressZipFile(path, RecompressOptions{Method: method, Level: zipfmt.LevelBest})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Total != 5 || result.Skipped != 1 || result.Unsupported != 1 {
+				t.Errorf("結果 = %+v, want 対象5件 圧縮済み1件 未対応1件", result)
+			}
+			// Deflateで圧縮済みのものは、同じDeflateでは小さくならない場合がある
+			if result.Recompressed < 1 || result.Recompressed > 2 {
+				t.Errorf("再圧縮したファイル = %d件", result.Recompressed)
+			}
+			if result.Saved() <= 0 || result.After >= result.Before {
+				t.Errorf("圧縮サイズ %d → %d で小さくなっていません", result.Before, result.After)
+			}
+			report := FormatRecompressReport(result)
+			if !strings.Contains(report, "圧縮済みの形式のため対象外: 1件") {
+				t.Errorf("レポートに圧縮済みの件数がありません:\n%s", report)
+			}
+
+			r := openTestZip(t, path)
+			if len(r.File) != len(entries) {
+				t.Fatalf("エントリ数 = %d, want %d", len(r.File), len(entries))
+			}
+			wantMethods := map[string]uint16{
+				"dir/text.txt": method,
+				"image.png":    zip.Store,
+				"random.bin":   zip.Store,
+				"ppmd.bin":     98,
+			}
+			for i, f := range r.File {
+				e := entries[i]
+				if f.Name != e.name {
+					t.Errorf("%d番目のエントリ = %s, want %s（順序が変わっています）", i, f.Name, e.name)
+					continue
+				}
+				if want, ok := wantMethods[f.Name]; ok && f.Method != want {
+					t.Errorf("%s: 圧縮方式 = %s, want %s", f.Name, zipfmt.MethodName(f.Method), zipfmt.MethodName(want))
+				}
+				if e.raw {
+					continue
+				}
+				if !f.Modified.Equal(testTime) {
+					t.Errorf("%s: 更新日時 = %v, want %v", f.Name, f.Modified, testTime)
+				}
+				if got := readEntry(t, f); !bytes.Equal(got, e.data) {
+					t.Errorf("%s: 内容が元の内容と一致しません", f.Name)
+				}
+			}
+		})
+	}
+}
+
+// 圧縮に対応していない方式を指定した場合は、ZIPファイルを変更しない
+func TestRecompressZipFileUnsupportedMethod(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestZip(t, dir, "a.zip", []testEntry{{name: "a.txt", data: testText(1000), method: zip.Store}})
+	if _, err := RecompressZipFile(path, RecompressOptions{Method: zipfmt.MethodDeflate64}); err == nil {
+		t.Error("Deflate64で再圧縮できてしまいました")
+	}
+	r := openTestZip(t, path)
+	if r.File[0].Method != zip.Store {
+		t.Errorf("圧縮方式 = %s, want Store", zipfmt.MethodName(r.File[0].Method))
+	}
+}
+
+// 規則に一致したファイルはその圧縮方式で再圧縮し、Keep の規則に一致したものと圧縮済みの形式はそのまま残す
+func TestRecompressZipFileRules(t *testing.T) {
+	// 先頭はJPEG・ZIPだが、後ろは圧縮が効く内容
+	jpeg := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, testText(20<<10)...)
+	inner := append([]byte("PK\x03\x04"), testText(20<<10)...)
+	entries := []testEntry{
+		{name: "big.txt", data: testText(50 << 10), method: zip.Store},
+		{name: "small.txt", data: testText(5 << 10), method: zip.Store},
+		{name: "logs/app.log", data: testText(30 << 10), method: zip.Store},
+		{name: "big.jpg", data: jpeg, method: zip.Store},
+		{name: "lib/inner.zip", data: inner, method: zip.Store},
+	}
+	path := writeTestZip(t, t.TempDir(), "a.zip", entries)
+	result, err := RecompressZipFile(path, RecompressOptions{
+		Method: zip.Deflate,
+		Level:  zipfmt.LevelDefault,
+		Rules: []RecompressRule{
+			{Patterns: []string{"*.log"}, Keep: true},
+			{MinSize: 20 << 10, Method: zipfmt.MethodXZ, Level: zipfmt.LevelBest},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 5 || result.Recompressed != 2 || result.Skipped != 2 || result.Kept != 1 {
+		t.Errorf("結果 = %+v, want 対象5件 再圧縮2件 圧縮済み2件 規則で対象外1件", result)
+	}
+	if report := FormatRecompressReport(result); !strings.Contains(report, "規則により対象外: 1件") {
+		t.Errorf("レポートに規則で対象外にした件数がありません:\n%s", report)
+	}
+
+	wantMethods := map[string]uint16{
+		"big.txt":       zipfmt.MethodXZ,
+		"small.txt":     zip.Deflate,
+		"logs/app.log":  zip.Store,
+		"big.jpg":       zip.Store,
+		"lib/inner.zip": zip.Store,
+	}
+	r := openTestZip(t, path)
+	for i, f := range r.File {
+		if f.Method != wantMethods[f.Name] {
+			t.Errorf("%s: 圧縮方式 = %s, want %s", f.Name, zipfmt.MethodName(f.Method), zipfmt.MethodName(wantMethods[f.Name]))
+		}
+		if got := readEntry(t, f); !bytes.Equal(got, entries[i].data) {
+			t.Errorf("%s: 内容が元の内容と一致しません", f.Name)
+		}
+	}
+
+	// 規則の圧縮方式も圧縮に対応している必要がある
+	_, err = RecompressZipFile(path, RecompressOptions{
+		Method: zip.Deflate,
+		Rules:  []RecompressRule{{Patterns: []string{"*.txt"}, Method: zipfmt.MethodDeflate64}},
+	})
+	if err == nil {
+		t.Error("規則でDeflate64を指定して再圧縮できてしまいました")
+	}
+}
+
+// 再圧縮では、保存していないコメントの変更を反映して破棄する
+func TestRecompressZipFileComments(t *testing.T) {
+	path := writeTestZip(t, t.TempDir(), "a.zip", []testEntry{
+		{name: "a.txt", data: testText(10 << 10), method: zip.Store},
+		{name: "b.txt", data: testText(10 << 10), method: zip.Store},
+	})
+	if err := SetEntryComment(path, "a.txt", "再圧縮したファイル", common.EncodingUTF8); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetArchiveComment(path, "アーカイブのコメント", common.EncodingUTF8); err != nil {
+		t.Fatal(err)
+	}
+	// b.txt は対象にしないが、コメントの変更は反映する
+	if err := SetEntryComment(path, "b.txt", "そのままのファイル", common.EncodingUTF8); err != nil {
+		t.Fatal(err)
+	}
+	result, err := RecompressZipFile(path, RecompressOptions{
+		Method: zip.Deflate,
+		Rules:  []RecompressRule{{Patterns: []string{"b.txt"}, Keep: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Recompressed != 1 {
+		t.Errorf("再圧縮したファイル = %d件, want 1件", result.Recompressed)
+	}
+
+	r := openTestZip(t, path)
+	if r.Comment != "アーカイブのコメント" {
+		t.Errorf("アーカイブのコメント = %q", r.Comment)
+	}
+	for i, want := range []string{"再圧縮したファイル", "そのままのファイル"} {
+		if r.File[i].Comment != want {
+			t.Errorf("%s: コメント = %q, want %q", r.File[i].Name, r.File[i].Comment, want)
+		}
+	}
+	if HasCommentEdits(path) {
+		t.Error("反映したコメントの変更が残っています")
+	}
+}
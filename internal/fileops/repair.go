@@ -0,0 +1,110 @@
+package fileops
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// maxReportLines は修復レポートに列挙する失われたエントリの最大件数です
+const maxReportLines = 20
+
+// RepairZipFile は中央ディレクトリが壊れた・欠けたZIPファイルを
+// ローカルファイルヘッダの走査結果から再構築し、dstPathへ保存します
+// 戻り値の走査結果には、回収できたエントリと失われたエントリが含まれます
+func RepairZipFile(srcPath, dstPath string) (*zipfmt.RecoveryResult, error) {
+	// 元ファイルを上書きすると回収前のデータが失われるため禁止する
+	if absSrc, err := filepath.Abs(srcPath); err == nil {
+		if absDst, err := filepath.Abs(dstPath); err == nil && strings.EqualFold(absSrc, absDst) {
+			return nil, errors.New("修復結果を元のファイルに上書きすることはできません")
+		}
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// ローカルファイルヘッダを走査して健全なエントリを回収
+	result := zipfmt.ScanLocalHeaders(src, fi.Size())
+	if len(result.Entries) == 0 {
+		return result, errors.New("回収できるエントリが見つかりませんでした")
+	}
+
+	out, err := os.Create(dstPath)
+	if err != nil {
+		return result, err
+	}
+	defer out.Close()
+
+	zipWriter := zip.NewWriter(out)
+	for _, entry := range result.Entries {
+		// ZIP64情報はライターが必要に応じて付け直すため取り除く
+		header := entry.FileHeader
+		header.Extra = zipfmt.RemoveExtra(header.Extra, zipfmt.Zip64ExtraID)
+
+		writer, err := zipWriter.CreateRaw(&header)
+		if err != nil {
+			return result, err
+		}
+
+		// 圧縮データはそのままコピー
+		data := io.NewSectionReader(src, entry.DataOffset, int64(entry.CompressedSize64))
+		if _, err := io.Copy(writer, data); err != nil {
+			return result, err
+		}
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return result, err
+	}
+	if err := out.Sync(); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// FormatRepairReport は修復結果を表示用の文字列にまとめます
+func FormatRepairReport(result *zipfmt.RecoveryResult) string {
+	var sb strings.Builder
+
+	unverified := 0
+	for _, entry := range result.Entries {
+		if !entry.Verified {
+			unverified++
+		}
+	}
+
+	fmt.Fprintf(&sb, "回収したエントリ: %d件\n", len(result.Entries))
+	if unverified > 0 {
+		fmt.Fprintf(&sb, "（うちCRCを検証できなかったエントリ: %d件）\n", unverified)
+	}
+	fmt.Fprintf(&sb, "失われたエントリ: %d件\n", len(result.Lost))
+
+	for i, lost := range result.Lost {
+		if i >= maxReportLines {
+			fmt.Fprintf(&sb, "…ほか%d件\n", len(result.Lost)-maxReportLines)
+			break
+		}
+		name := common.AutoDetectEncoding(lost.Name)
+		if name == "" {
+			name = "（名前不明）"
+		}
+		fmt.Fprintf(&sb, "- %s（位置 %d）: %s\n", name, lost.Offset, lost.Reason)
+	}
+
+	return sb.String()
+}
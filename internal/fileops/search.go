@@ -0,0 +1,46 @@
+package fileops
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"zip-editor/internal/archive"
+)
+
+// SearchContent はアーカイブ内のファイルの内容を検索します（検索の方法は archive.SearchContent を参照）
+// 暗号化されたエントリは prompt でパスワードの入力を求めます（nilの場合はキャッシュ済みのパスワードのみ使用）
+func SearchContent(zipPath string, opts archive.SearchOptions, prompt PasswordFunc) (*archive.SearchResult, error) {
+	format, err := archiveFormat(zipPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// パスワードの入力を一度にひとつだけ求めるため、暗号化されたエントリは順に開く
+	var mu sync.Mutex
+	opts.OpenEncrypted = func(f *zip.File) (io.ReadCloser, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return openEntry(zipPath, f, prompt)
+	}
+	return archive.SearchContent(zipPath, format, opts)
+}
+
+// FormatSearchReport は内容の検索結果の概要を表示用の文字列にまとめます
+func FormatSearchReport(result *archive.SearchResult) string {
+	var sb strings.Builder
+	lines := 0
+	for _, hit := range result.Hits {
+		lines += len(hit.Matches)
+	}
+	fmt.Fprintf(&sb, "一致したファイル: %d件（%d行）／検索したファイル: %d件", len(result.Hits), lines, result.Searched)
+	if result.Binary > 0 {
+		fmt.Fprintf(&sb, "／バイナリのため除外: %d件", result.Binary)
+	}
+	if len(result.Skipped) > 0 {
+		fmt.Fprintf(&sb, "／読み取れなかったファイル: %d件", len(result.Skipped))
+	}
+	return sb.String()
+}
@@ -0,0 +1,95 @@
+package fileops
+
+import (
+	"archive/zip"
+	"fmt"
+	"strings"
+	"zip-editor/internal/common"
+	"zip-editor/internal/model"
+	"zip-editor/internal/zipfmt"
+)
+
+// TimestampOptions はエントリの更新日時を変更する際のオプションです
+type TimestampOptions struct {
+	Edit zipfmt.TimeEdit
+	// Items は対象のファイル・フォルダです（フォルダは中のエントリを含む、nilの場合はZIPファイル全体）
+	Items []*model.ZipTreeItem
+}
+
+// TimestampResult は更新日時の変更結果です
+type TimestampResult struct {
+	Changed int           // 日時を変更したエントリ数
+	Skipped []ExtractSkip // 日時を変更できなかったエントリ
+}
+
+// SetTimestamps はエントリの更新日時を変更してZIPファイルを書き直します
+// MS-DOS形式の日時、拡張タイムスタンプ、NTFSのタイムスタンプを揃えて書き換え、圧縮データはそのままコピーします
+func SetTimestamps(zipPath string, opts TimestampOptions) (*TimestampResult, error) {
+	if err := requireZip(zipPath); err != nil {
+		return nil, err
+	}
+
+	var match func(name string) bool
+	if opts.Items != nil {
+		paths := make([]string, len(opts.Items))
+		for i, item := range opts.Items {
+			if item.IsNested() || item.IsArchive() {
+				return nil, ErrNestedReadOnly
+			}
+			paths[i] = item.GetPath()
+		}
+		match = zipfmt.SubtreeMatcher(paths)
+	}
+
+	result := &TimestampResult{}
+	err := rewriteZipFile(zipPath, SaveOptions{}, func(zipWriter *zip.Writer, reader *zipfmt.ReadCloser) error {
+		planned := zipfmt.PlanModTimes(reader.File, match, opts.Edit)
+		for _, file := range reader.File {
+			t, ok := planned[file]
+			if !ok {
+				if err := zipfmt.CopyRaw(zipWriter, file, nil); err != nil {
+					return err
+				}
+				continue
+			}
+
+			header := file.FileHeader
+			if err := zipfmt.SetModTime(&header, t); err != nil {
+				result.Skipped = append(result.Skipped, ExtractSkip{Path: common.AutoDetectEncoding(file.Name), Reason: err.Error()})
+				if err := zipfmt.CopyRaw(zipWriter, file, nil); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := zipfmt.CopyRaw(zipWriter, file, &header); err != nil {
+				return err
+			}
+			result.Changed++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FormatTimestampReport は更新日時の変更結果を表示用の文字列にまとめます
+func FormatTimestampReport(result *TimestampResult) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "日時を変更したエントリ: %d件\n", result.Changed)
+	if len(result.Skipped) == 0 {
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "変更できなかったエントリ: %d件\n", len(result.Skipped))
+	for i, s := range result.Skipped {
+		if i >= maxReportLines {
+			fmt.Fprintf(&sb, "…ほか%d件\n", len(result.Skipped)-maxReportLines)
+			break
+		}
+		fmt.Fprintf(&sb, "- %s: %s\n", s.Path, s.Reason)
+	}
+	return sb.String()
+}
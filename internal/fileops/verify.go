@@ -0,0 +1,125 @@
+package fileops
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"zip-editor/internal/archive"
+	"zip-editor/internal/common"
+	"zip-editor/internal/zipfmt"
+)
+
+// VerifyFailure は整合性テストで問題が見つかったエントリです
+type VerifyFailure struct {
+	Path   string // UTF-8に変換したパス
+	Reason string
+}
+
+// VerifyResult はZIPファイルの整合性テストの結果です
+type VerifyResult struct {
+	Total   int   // テストしたエントリ数
+	Bytes   int64 // 展開後の合計サイズ
+	Zip64   bool  // ZIP64終端レコードを持つかどうか
+	Volumes int   // 分割アーカイブのボリューム数（分割されていない場合は0）
+	// Prefix は先頭に付加されたデータ（自己解凍スタブなど）とAPK署名ブロックの情報です（ZIPのみ）
+	Prefix   *zipfmt.Prefix
+	Failures []VerifyFailure
+}
+
+// VerifyZipFile はZIPファイルの全エントリを展開してCRCとサイズを検証します
+// 展開したデータは破棄され、ディスクには書き込みません
+// 暗号化されたエントリは prompt でパスワードの入力を求めます（nilの場合はキャッシュ済みのパスワードのみ使用）
+func VerifyZipFile(zipPath string, prompt PasswordFunc) (*VerifyResult, error) {
+	// ZIP以外の形式（tar系）は全エントリを読み取って確認する
+	format, err := archiveFormat(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	if format != archive.FormatZip {
+		return verifyArchive(zipPath, format), nil
+	}
+
+	reader, err := zipfmt.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	result := &VerifyResult{Volumes: len(reader.Volumes)}
+	result.Prefix, _ = reader.Prefix()
+
+	// ZIP64終端レコードの有無を確認
+	if f, err := os.Open(zipPath); err == nil {
+		if fi, err := f.Stat(); err == nil {
+			result.Zip64, _ = zipfmt.HasZip64End(f, fi.Size())
+		}
+		f.Close()
+	}
+
+	for _, file := range reader.File {
+		if strings.HasSuffix(file.Name, "/") {
+			continue
+		}
+		result.Total++
+		result.Bytes += int64(file.UncompressedSize64)
+
+		if err := verifyEntry(zipPath, file, prompt); err != nil {
+			result.Failures = append(result.Failures, VerifyFailure{
+				Path:   common.AutoDetectEncoding(file.Name),
+				Reason: err.Error(),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// verifyEntry はエントリを最後まで展開し、CRCとサイズを検証します
+func verifyEntry(zipPath string, file *zip.File, prompt PasswordFunc) error {
+	if file.Flags&zipfmt.FlagEncrypted == 0 {
+		return zipfmt.VerifyFile(file)
+	}
+
+	// 最後まで読み終えた時点でCRCとサイズが照合される
+	return readEntryData(zipPath, file, prompt, func(r io.Reader) error {
+		_, err := io.Copy(io.Discard, r)
+		return err
+	})
+}
+
+// FormatVerifyReport はテスト結果を表示用の文字列にまとめます
+func FormatVerifyReport(result *VerifyResult) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "テストしたファイル: %d件（合計 %d バイト）\n", result.Total, result.Bytes)
+	if result.Zip64 {
+		sb.WriteString("形式: ZIP64\n")
+	}
+	if result.Volumes > 0 {
+		fmt.Fprintf(&sb, "分割アーカイブ: %dボリューム\n", result.Volumes)
+	}
+	if p := result.Prefix; p != nil {
+		if p.Size > 0 {
+			fmt.Fprintf(&sb, "先頭のデータ: %d バイト（%s）\n", p.Size, p.Kind)
+		}
+		if p.SigningBlockSize > 0 {
+			fmt.Fprintf(&sb, "APK署名ブロック: %d バイト（保存すると削除されます）\n", p.SigningBlockSize)
+		}
+	}
+	if len(result.Failures) == 0 {
+		sb.WriteString("エラーは見つかりませんでした。\n")
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "エラー: %d件\n", len(result.Failures))
+	for i, failure := range result.Failures {
+		if i >= maxReportLines {
+			fmt.Fprintf(&sb, "…ほか%d件\n", len(result.Failures)-maxReportLines)
+			break
+		}
+		fmt.Fprintf(&sb, "- %s: %s\n", failure.Path, failure.Reason)
+	}
+	return sb.String()
+}
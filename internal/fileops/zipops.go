@@ -2,19 +2,29 @@ package fileops
 
 import (
 	"archive/zip"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"zip-editor/internal/archive"
 	"zip-editor/internal/common"
 	"zip-editor/internal/model"
-
-	"github.com/lxn/walk"
+	"zip-editor/internal/zipfmt"
 )
 
 // deleteFlags は削除フラグの状態を保持するマップ
 // キーはZIPファイルパスとファイルパスの組み合わせ
-var deleteFlags = make(map[string]bool)
+// 保存は別のゴルーチンで行われるため、deleteFlagsMu で保護します
+var (
+	deleteFlags   = make(map[string]bool)
+	deleteFlagsMu sync.Mutex
+)
+
+// deleteFlagSnapshot は保存を始めた時点の削除フラグです（キーは deleteFlags と同じで、フラグが付いたものだけを含みます）
+// 保存中に付け外しされたフラグは反映しないように、保存ではこの写しだけを使います
+type deleteFlagSnapshot map[string]bool
 
 // getDeleteFlagKey はマップのキーを生成します
 func getDeleteFlagKey(zipPath, filePath string) string {
@@ -24,15 +34,46 @@ func getDeleteFlagKey(zipPath, filePath string) string {
 // GetDeleteFlag は指定されたファイルの削除フラグを取得します
 func GetDeleteFlag(zipPath, filePath string) bool {
 	key := getDeleteFlagKey(zipPath, filePath)
+	deleteFlagsMu.Lock()
+	defer deleteFlagsMu.Unlock()
 	return deleteFlags[key]
 }
 
 // SetDeleteFlag は指定されたファイルの削除フラグを設定します
 func setDeleteFlag(zipPath, filePath string, flag bool) {
 	key := getDeleteFlagKey(zipPath, filePath)
+	deleteFlagsMu.Lock()
+	defer deleteFlagsMu.Unlock()
 	deleteFlags[key] = flag
 }
 
+// snapshotDeleteFlags は指定したZIPファイルの削除フラグの写しを返します
+func snapshotDeleteFlags(zipPath string) deleteFlagSnapshot {
+	deleteFlagsMu.Lock()
+	defer deleteFlagsMu.Unlock()
+	snapshot := make(deleteFlagSnapshot)
+	prefix := getDeleteFlagKey(zipPath, "")
+	for key, flag := range deleteFlags {
+		if flag && strings.HasPrefix(key, prefix) {
+			snapshot[key] = true
+		}
+	}
+	return snapshot
+}
+
+// deleted は保存を始めた時点でファイルに削除フラグが付いていたかどうかを返します
+func (s deleteFlagSnapshot) deleted(zipPath, filePath string) bool {
+	return s[getDeleteFlagKey(zipPath, filePath)]
+}
+
+// SetDeleteFlags は指定したアイテムそれぞれの削除フラグを設定します（フォルダの中のアイテムには広げません）
+func SetDeleteFlags(zipPath string, items []*model.ZipTreeItem, flag bool) {
+	for _, item := range items {
+		item.DeleteFlag = flag
+		setDeleteFlag(zipPath, item.GetPath(), flag)
+	}
+}
+
 func UpdateDeleteFlagRecursively(currentZipPath string, item *model.ZipTreeItem) {
 	// 自分の削除フラグ設定
 	setDeleteFlag(currentZipPath, item.GetPath(), item.DeleteFlag)
@@ -50,101 +91,211 @@ func UpdateDeleteFlagRecursively(currentZipPath string, item *model.ZipTreeItem)
 	}
 }
 
+// SaveOptions はZIPファイルを書き直して保存する際のオプションです
+type SaveOptions struct {
+	// Password が空でない場合、Encryption で指定した方式でエントリを暗号化して保存します
+	// ZipCryptoの場合、すでに暗号化されているエントリはそのままコピーします
+	// AES-256の場合、すでに暗号化されているエントリも復号してから暗号化し直します
+	Password   string
+	Encryption zipfmt.Encryption
+	// Prompt は既存のエントリを復号するためにパスワードが必要な場合に入力を求めるコールバックです
+	Prompt PasswordFunc
+	// VolumeSize が正の場合、そのサイズのボリューム（.z01, .z02 …, .zip）に分割して保存します
+	// 0の場合は元の構成を維持し（分割アーカイブは最初のボリュームと同じサイズで分割し直す）、
+	// 負の場合は分割アーカイブもひとつのファイルにまとめて保存します
+	VolumeSize int64
+	// 先頭に付加されたデータ（自己解凍スタブなど）は、エントリの位置を調整して引き継ぎます
+	// StubPath が空でない場合はそのファイルの内容で置き換え、StripStub がtrueの場合は取り除いて保存します
+	StubPath  string
+	StripStub bool
+	// Order がnilでない場合、エントリをその順序に並べ替えて保存します（nilの場合は元の順序を保ちます）
+	Order *zipfmt.EntryOrder
+
+	// comments は保存を始めた時点のコメントの変更です（nilの場合は rewriteZipFile が取得します）
+	comments *commentSnapshot
+	// flags は保存を始めた時点の削除フラグです（nilの場合は saveEntries が取得します）
+	flags deleteFlagSnapshot
+}
+
 // DeleteFlaggedFiles は削除フラグが付いたファイルをZIPファイルから削除します
 func DeleteFlaggedFiles(zipPath string) error {
-	// 一時ディレクトリを作成
-	tempDir, err := os.MkdirTemp("", "zip-editor-")
+	return SaveZipFile(zipPath, SaveOptions{})
+}
+
+// SaveZipFile は削除フラグを反映し、オプションに従ってZIPファイルを書き直します
+// ZIP以外の形式（tar系）のアーカイブは、削除フラグだけを反映して元と同じ形式で書き直します（7z・RARは読み取り専用）
+func SaveZipFile(zipPath string, opts SaveOptions) error {
+	format, err := archiveFormat(zipPath)
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(tempDir) // 関数終了時に一時ディレクトリを削除
-
-	// 一時ZIPファイルのパスを生成
-	tempZipPath := filepath.Join(tempDir, "temp.zip")
+	if format != archive.FormatZip {
+		if opts.Password != "" {
+			return archive.ErrUnsupportedFormat
+		}
+		return saveArchiveFile(zipPath, format)
+	}
 
-	// 元のZIPファイルを開く
-	reader, err := zip.OpenReader(zipPath)
+	// 保存中にコメントや削除フラグが変更されても、保存を始めた時点の変更だけを反映する（コメントは反映したものを破棄する）
+	opts.comments = snapshotCommentEdits(zipPath)
+	opts.flags = snapshotDeleteFlags(zipPath)
+	for {
+		err = rewriteZipFile(zipPath, opts, func(zipWriter *zip.Writer, reader *zipfmt.ReadCloser) error {
+			return saveEntries(zipPath, "", zipWriter, reader.Reader, opts)
+		})
+		// 照合値が偶然一致した誤ったパスワードで復号していた場合は、パスワードを入力し直して保存し直す
+		if !errors.Is(err, zipfmt.ErrPassword) || opts.Prompt == nil {
+			break
+		}
+	}
 	if err != nil {
 		return err
 	}
+	clearCommentEdits(zipPath, opts.comments)
 
-	// 新しいZIPファイルを作成
-	newZipFile, err := os.Create(tempZipPath)
-	if err != nil {
-		return err
+	// 暗号化したパスワードは、続けてファイルを開けるようにキャッシュしておく
+	// AES-256ではすべてのエントリを暗号化し直すため、以前のパスワードは破棄する
+	if opts.Password != "" {
+		if opts.Encryption == zipfmt.EncryptionAES256 {
+			ClearPasswordCache(zipPath)
+		}
+		cachePassword(zipPath, opts.Password)
 	}
-	defer newZipFile.Close()
 
-	// 新しいZIPライターを作成
-	zipWriter := zip.NewWriter(newZipFile)
-	defer zipWriter.Close()
+	return nil
+}
+
+// saveEntries は削除フラグを反映しながら、ZIPの各エントリを新しいZIPに書き込みます
+// prefix は入れ子のアーカイブの中を処理する場合のアーカイブのパス（最も外側では空文字列）です
+func saveEntries(zipPath, prefix string, zipWriter *zip.Writer, reader *zip.Reader, opts SaveOptions) error {
+	if opts.flags == nil {
+		opts.flags = snapshotDeleteFlags(zipPath)
+	}
+	files := reader.File
+	if opts.Order != nil {
+		files = zipfmt.OrderFiles(files, *opts.Order)
+	}
 
 	// 元のZIPファイルの各ファイルを処理
-	for _, file := range reader.File {
+	for _, file := range files {
 		// ファイルパスをUTF-8に変換
-		path := common.AutoDetectEncoding(file.Name)
+		path := prefix + common.AutoDetectEncoding(file.Name)
 
-		// 削除フラグをチェック
-		if GetDeleteFlag(zipPath, path) {
+		// 削除フラグをチェック（入れ子のアーカイブはディレクトリとして削除された場合も含む）
+		archivePath := path + model.NestedSeparator
+		if opts.flags.deleted(zipPath, path) || opts.flags.deleted(zipPath, archivePath) {
 			continue // 削除フラグが付いているファイルはスキップ
 		}
 
-		// 元のファイルを開く
-		fileReader, err := file.Open()
-		if err != nil {
-			return err
+		// 中に削除フラグが付いたファイルがある入れ子のアーカイブは、作り直したものを書き込む
+		if zipfmt.IsArchiveName(path) && opts.flags.hasNestedEdits(zipPath, archivePath) {
+			rebuilt, cleanup, err := rebuildNested(zipPath, file, archivePath, opts.flags, opts.comments)
+			if err != nil {
+				return err
+			}
+			header, err := opts.comments.editedHeader(zipPath, path, rebuilt)
+			if err == nil {
+				err = saveEntry(zipPath, zipWriter, rebuilt, header, opts)
+			}
+			cleanup()
+			if err != nil {
+				return err
+			}
+			continue
 		}
 
-		// 新しいZIPファイルにファイルを追加
-		header := &zip.FileHeader{
-			Name:   file.Name,
-			Method: file.Method,
-		}
-		header.SetModTime(file.Modified)
-
-		writer, err := zipWriter.CreateHeader(header)
+		// コメントが変更されている場合は、変更を反映したヘッダーで書き込む
+		header, err := opts.comments.editedHeader(zipPath, path, file)
 		if err != nil {
-			fileReader.Close()
 			return err
 		}
-
-		// ファイルの内容をコピー
-		_, err = io.Copy(writer, fileReader)
-		fileReader.Close()
-		if err != nil {
+		if err := saveEntry(zipPath, zipWriter, file, header, opts); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	// ZIPライターを閉じる
-	err = zipWriter.Close()
-	if err != nil {
-		return err
+// saveEntry はエントリを、オプションに従って必要なら暗号化しながら書き込みます
+// header がnilでない場合は、元のヘッダーの代わりに使用します
+func saveEntry(zipPath string, zipWriter *zip.Writer, file *zip.File, header *zip.FileHeader, opts SaveOptions) error {
+	// 圧縮データを展開せずにそのままコピー
+	// ZIP64形式のレコードは、サイズやオフセットが必要とする場合にだけ出力される
+	switch {
+	case opts.Password == "":
+		return zipfmt.CopyRaw(zipWriter, file, header)
+	case opts.Encryption == zipfmt.EncryptionAES256:
+		return copyEntryAES(zipPath, zipWriter, file, header, opts)
+	default:
+		return zipfmt.CopyRawEncrypted(zipWriter, file, header, opts.Password)
 	}
+}
 
-	// 新しいZIPファイルを閉じる
-	err = newZipFile.Close()
+// rewriteZipFile は新しいZIPファイルを書き込み、成功した場合に元のファイルを置き換えます
+// write には元のZIPファイルのリーダーと、新しいZIPファイルのライターが渡されます
+// opts のうち、ボリュームのサイズと先頭に付加するデータの指定だけを使用します
+func rewriteZipFile(zipPath string, opts SaveOptions, write func(zipWriter *zip.Writer, reader *zipfmt.ReadCloser) error) error {
+	rewriteOpts, err := fileRewriteOptions(zipPath, opts)
 	if err != nil {
 		return err
 	}
+	// コマンドラインツールと同じ処理で、先頭のデータとコメントを引き継ぎ、分割アーカイブは分割し直す
+	return zipfmt.RewriteFile(zipPath, rewriteOpts, write)
+}
 
-	// 元のZIPファイルを閉じる
-	reader.Close()
+// fileRewriteOptions は保存のオプションから、書き直す際の先頭に付加するデータ・コメント・ボリュームの分割の指定を作成します
+func fileRewriteOptions(zipPath string, opts SaveOptions) (zipfmt.RewriteFileOptions, error) {
+	rewriteOpts := zipfmt.RewriteFileOptions{
+		RewriteOptions: zipfmt.RewriteOptions{StripStub: opts.StripStub},
+		StubPath:       opts.StubPath,
+		VolumeSize:     opts.VolumeSize,
+	}
 
-	// 一時ZIPファイルを元の場所にコピー
-	err = copyFile(tempZipPath, zipPath)
+	// アーカイブ全体のコメントは、変更されていなければ元のものを引き継ぐ
+	if opts.comments == nil {
+		opts.comments = snapshotCommentEdits(zipPath)
+	}
+	comment, err := opts.comments.editedArchiveComment()
 	if err != nil {
-		return err
+		return rewriteOpts, err
 	}
+	rewriteOpts.Comment = comment
+	return rewriteOpts, nil
+}
 
-	// コピー元の一時ファイルを削除
-	err = os.Remove(tempZipPath)
-	if err != nil {
-		// コピーは成功しているので、一時ファイルの削除に失敗しても処理は続行
-		// ただし、ログに記録するなどの対応が望ましい
+// copyEntryAES はエントリをAES-256で暗号化し直して書き込みます
+// 既存の暗号化エントリは、キャッシュ済みまたは入力されたパスワードで復号します
+// 書き込みながらの照合でパスワードの誤りとわかった場合は、そのパスワードをキャッシュから取り除きます
+func copyEntryAES(zipPath string, zipWriter *zip.Writer, file *zip.File, header *zip.FileHeader, opts SaveOptions) error {
+	oldPassword := ""
+	if file.Flags&zipfmt.FlagEncrypted != 0 {
+		var err error
+		oldPassword, err = entryPassword(zipPath, file, opts.Prompt)
+		if err != nil {
+			return err
+		}
+	}
+	err := zipfmt.CopyRawAES(zipWriter, file, header, oldPassword, opts.Password, zipfmt.AES256)
+	if errors.Is(err, zipfmt.ErrPassword) {
+		rejectPassword(zipPath, oldPassword)
 	}
+	return err
+}
 
-	return nil
+// replaceWithCopy は src の内容で dst を置き換えます
+// dst と同じディレクトリの一時ファイルにコピーしてから名前を変更するため、途中で失敗しても dst は壊れず、パーミッションも引き継ぎます
+func replaceWithCopy(src, dst string) error {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+	return common.ReplaceFile(dst, func(f *os.File) error {
+		if _, err := io.Copy(f, sourceFile); err != nil {
+			return err
+		}
+		return f.Sync()
+	})
 }
 
 // copyFile はファイルをソースからデスティネーションにコピーします
@@ -178,51 +329,64 @@ func copyFile(src, dst string) error {
 	return nil
 }
 
-// UpdateFileList は指定されたディレクトリ内のファイル一覧を更新します
-func UpdateFileList(tv *walk.TableView, treeItem *model.ZipTreeItem) error {
-
-	// TableViewのモデルを設定
-	fileModel := new(model.FileItemModel)
-
-	// ポインタのスライスをそのまま使用
-	fileModel.Items = treeItem.GetFiles()
-	tv.SetModel(fileModel)
-
-	return nil
-}
-
 // ExtractFileToTemp は指定したZIP内の単一ファイルを一時ディレクトリに展開し、そのパスを返します
 // エンコーディングは自動検出し、UTF-8のパス（model側と同一ロジック）でマッチングします
-func ExtractFileToTemp(zipPath, entryUTF8Path string) (string, error) {
+// 暗号化されている場合は prompt でパスワードの入力を求めます
+func ExtractFileToTemp(zipPath, entryUTF8Path string, prompt PasswordFunc) (string, error) {
 	// 一時ディレクトリを作成（規約に従いプレフィックスを使用）
 	tempDir, err := os.MkdirTemp("", "zip-editor-")
 	if err != nil {
 		return "", err
 	}
 
+	// ZIP以外の形式（tar系・7z・RAR）は形式に依存しない読み取り処理で展開する
+	format, err := archiveFormat(zipPath)
+	if err != nil {
+		return "", err
+	}
+	if format != archive.FormatZip {
+		rc, err := archive.OpenEntry(zipPath, format, entryUTF8Path)
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+		return writeTempFile(tempDir, entryUTF8Path, rc)
+	}
+
 	// ZIPを開く
-	reader, err := zip.OpenReader(zipPath)
+	reader, err := zipfmt.OpenReader(zipPath)
 	if err != nil {
 		return "", err
 	}
 	defer reader.Close()
 
-	// エントリを探索
-	var target *zip.File
-	for _, f := range reader.File {
-		// ZIP内パスのエンコーディングをUTF-8へ
-		utf8Path := common.AutoDetectEncoding(f.Name)
-		if utf8Path == entryUTF8Path {
-			target = f
-			break
-		}
+	// 入れ子のアーカイブの中のファイルは、外側から順にアーカイブを開いて探す
+	innerReader, innerPath, err := openNested(reader.Reader, entryUTF8Path)
+	if err != nil {
+		return "", err
 	}
+
+	// エントリを探索（ZIP内パスのエンコーディングをUTF-8に変換して比較）
+	target := findEntry(innerReader, innerPath)
 	if target == nil {
 		return "", os.ErrNotExist
 	}
 
+	// ファイルを展開（暗号化されている場合は復号）
+	var outPath string
+	err = readEntryData(zipPath, target, prompt, func(r io.Reader) error {
+		path, err := writeTempFile(tempDir, innerPath, r)
+		outPath = path
+		return err
+	})
+	return outPath, err
+}
+
+// writeTempFile は展開したデータを一時ディレクトリに書き込み、そのパスを返します
+// 出力先はアーカイブ内のサブディレクトリ構造を維持します
+func writeTempFile(tempDir, entryPath string, rc io.Reader) (string, error) {
 	// 出力先フルパス（Zip内のサブディレクトリ構造を維持）
-	rel := filepath.FromSlash(entryUTF8Path)
+	rel := filepath.FromSlash(entryPath)
 	// 先頭にスラッシュがあれば削除
 	rel = strings.TrimLeft(rel, "\\/")
 	outPath := filepath.Join(tempDir, rel)
@@ -232,13 +396,6 @@ func ExtractFileToTemp(zipPath, entryUTF8Path string) (string, error) {
 		return "", err
 	}
 
-	// ファイルを展開
-	rc, err := target.Open()
-	if err != nil {
-		return "", err
-	}
-	defer rc.Close()
-
 	outFile, err := os.Create(outPath)
 	if err != nil {
 		return "", err
@@ -0,0 +1,151 @@
+package fileops
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+	"zip-editor/internal/model"
+	"zip-editor/internal/zipfmt"
+)
+
+// 保存は別のゴルーチンで行われるため、保存中に削除フラグを付け外ししても保存を始めた時点のフラグで保存する
+// （go test -race で、削除フラグのマップへの同時アクセスがないことも確認する）
+func TestSaveZipFileWhileFlagging(t *testing.T) {
+	var inner bytes.Buffer
+	zw := zip.NewWriter(&inner)
+	for _, name := range []string{"keep.txt", "drop.txt"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(testText(100))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := writeTestZip(t, t.TempDir(), "a.zip", []testEntry{
+		{name: "a.txt", data: testText(100)},
+		{name: "lib/inner.zip", data: inner.Bytes()},
+	})
+	dropped := "lib/inner.zip" + model.NestedSeparator + "drop.txt"
+	setDeleteFlag(path, dropped, true)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	t.Cleanup(func() {
+		setDeleteFlag(path, dropped, false)
+		for i := 0; i < 100; i++ {
+			setDeleteFlag(path, "other"+strconv.Itoa(i), false)
+		}
+	})
+	go func() {
+		defer close(stopped)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			setDeleteFlag(path, "other"+strconv.Itoa(i%100), i%2 == 0)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if err := SaveZipFile(path, SaveOptions{}); err != nil {
+			close(done)
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	<-stopped
+
+	files := openTestZip(t, path).File
+	if len(files) != 2 || files[0].Name != "a.txt" || files[1].Name != "lib/inner.zip" {
+		t.Fatalf("エントリ = %d件", len(files))
+	}
+	data := readEntry(t, files[1])
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.File) != 1 || r.File[0].Name != "keep.txt" {
+		t.Errorf("入れ子のアーカイブのエントリ = %d件", len(r.File))
+	}
+}
+
+// 削除フラグを反映して保存しても、ZIP64形式はエントリ数が従来形式の上限を超える場合にだけ出力する
+func TestDeleteFlaggedFilesZip64(t *testing.T) {
+	const count = 70000
+	entries := make([]testEntry, count)
+	for i := range entries {
+		entries[i] = testEntry{name: fmt.Sprintf("d%03d/f%06d.txt", i/1000, i), data: []byte(strconv.Itoa(i))}
+	}
+	path := writeTestZip(t, t.TempDir(), "many.zip", entries)
+	t.Cleanup(func() {
+		for _, e := range entries {
+			setDeleteFlag(path, e.name, false)
+		}
+	})
+
+	tests := []struct {
+		name      string
+		delete    int // 先頭から削除するエントリ数（それまでのものを含む）
+		wantZip64 bool
+	}{
+		{name: "65535件を超えたまま", delete: 1000, wantZip64: true},
+		{name: "65535件未満になる", delete: count - 65534, wantZip64: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, e := range entries[:tt.delete] {
+				setDeleteFlag(path, e.name, true)
+			}
+			if err := DeleteFlaggedFiles(path); err != nil {
+				t.Fatal(err)
+			}
+
+			files := openTestZip(t, path).File
+			if len(files) != count-tt.delete {
+				t.Fatalf("エントリ数 = %d, want %d", len(files), count-tt.delete)
+			}
+			for i, f := range []*zip.File{files[0], files[len(files)-1]} {
+				want := entries[tt.delete]
+				if i == 1 {
+					want = entries[count-1]
+				}
+				if f.Name != want.name || string(readEntry(t, f)) != string(want.data) {
+					t.Errorf("%s: エントリが一致しません（want %s）", f.Name, want.name)
+				}
+			}
+
+			dir := readTestDirectory(t, path)
+			if dir.Zip64 != tt.wantZip64 {
+				t.Errorf("ZIP64終端レコードの有無 = %v, want %v", dir.Zip64, tt.wantZip64)
+			}
+			if zipfmt.NeedsZip64(dir) != dir.Zip64 {
+				t.Error("ZIP64形式が必要な場合にだけ出力されていません")
+			}
+		})
+	}
+}
+
+// readTestDirectory はZIPファイルの中央ディレクトリと終端レコードを読み取ります
+func readTestDirectory(t *testing.T, path string) *zipfmt.Directory {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := zipfmt.ReadDirectory(f, fi.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
@@ -0,0 +1,133 @@
+package gui
+
+import (
+	"strings"
+
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+
+	"zip-editor/internal/zipfmt"
+)
+
+// hostChoices は作成したOSの変更方法の選択肢です（表示名と変更方法の対応）
+var hostChoices = []struct {
+	name   string
+	change zipfmt.HostChange
+}{
+	{"変更しない", zipfmt.HostKeep},
+	{"Unix", zipfmt.HostToUnix},
+	{"MS-DOS（FAT）", zipfmt.HostToFAT},
+}
+
+// dosAttrChoices はダイアログに表示するMS-DOSの属性です
+var dosAttrChoices = []struct {
+	name string
+	bit  uint8
+}{
+	{"読み取り専用", zipfmt.DOSReadOnly},
+	{"隠しファイル", zipfmt.DOSHidden},
+	{"システム", zipfmt.DOSSystem},
+	{"アーカイブ", zipfmt.DOSArchive},
+}
+
+// promptAttributes はエントリの属性の変更内容を入力するダイアログを表示します
+// MS-DOSの属性のチェックボックスは3状態で、中間の状態は「変更しない」を表します
+// 取り消された場合は ok がfalseになります
+func promptAttributes(owner walk.Form, title, message, current string) (edit zipfmt.AttrEdit, ok bool) {
+	var dlg *walk.Dialog
+	var permLE *walk.LineEdit
+	var scriptsCB, hostCB *walk.ComboBox
+	var acceptPB, cancelPB *walk.PushButton
+	dosCBs := make([]*walk.CheckBox, len(dosAttrChoices))
+
+	hostNames := make([]string, len(hostChoices))
+	for i, c := range hostChoices {
+		hostNames[i] = c.name
+	}
+	dosWidgets := make([]Widget, len(dosAttrChoices))
+	for i, c := range dosAttrChoices {
+		dosWidgets[i] = CheckBox{
+			AssignTo:   &dosCBs[i],
+			Text:       c.name,
+			Tristate:   true,
+			CheckState: walk.CheckIndeterminate,
+		}
+	}
+
+	if _, err := (Dialog{
+		AssignTo:      &dlg,
+		Title:         title,
+		DefaultButton: &acceptPB,
+		CancelButton:  &cancelPB,
+		MinSize:       Size{Width: 440, Height: 320},
+		Layout:        VBox{},
+		Children: []Widget{
+			Label{Text: message},
+			Label{Text: "現在の属性: " + current},
+			Label{Text: "Unixのパーミッション（例: 755、+x、go-w、a+rX、空欄の場合は変更しない）:"},
+			LineEdit{AssignTo: &permLE},
+			ComboBox{
+				AssignTo:     &scriptsCB,
+				Model:        []string{"すべてのエントリに適用する", "\"#!\" で始まるファイル（スクリプト）だけに適用する"},
+				CurrentIndex: 0,
+			},
+			GroupBox{
+				Title:    "MS-DOSの属性（中間の状態は変更しない）",
+				Layout:   HBox{},
+				Children: dosWidgets,
+			},
+			Label{Text: "作成したOS:"},
+			ComboBox{AssignTo: &hostCB, Model: hostNames, CurrentIndex: 0},
+			Label{Text: "※ Unix以外で作成されたエントリのパーミッションを変更すると、作成したOSはUnixになります。"},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo: &acceptPB,
+						Text:     "OK",
+						OnClicked: func() {
+							edit = zipfmt.AttrEdit{}
+							if text := strings.TrimSpace(permLE.Text()); text != "" {
+								perm, err := zipfmt.ParsePermEdit(text)
+								if err != nil {
+									walk.MsgBox(dlg, "エラー", err.Error(), walk.MsgBoxIconError)
+									return
+								}
+								edit.Perm = perm
+								edit.ScriptsOnly = scriptsCB.CurrentIndex() == 1
+							}
+							for i, c := range dosAttrChoices {
+								switch dosCBs[i].CheckState() {
+								case walk.CheckChecked:
+									edit.DOSSet |= c.bit
+								case walk.CheckUnchecked:
+									edit.DOSClear |= c.bit
+								}
+							}
+							edit.Host = hostChoices[max(hostCB.CurrentIndex(), 0)].change
+							if edit.IsEmpty() {
+								walk.MsgBox(dlg, "情報", "変更する内容を指定してください。", walk.MsgBoxIconInformation)
+								return
+							}
+							dlg.Accept()
+						},
+					},
+					PushButton{
+						AssignTo:  &cancelPB,
+						Text:      "キャンセル",
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}).Run(owner); err != nil {
+		walk.MsgBox(owner, "エラー", "ダイアログの表示に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		return zipfmt.AttrEdit{}, false
+	}
+
+	if dlg.Result() != walk.DlgCmdOK {
+		return zipfmt.AttrEdit{}, false
+	}
+	return edit, true
+}
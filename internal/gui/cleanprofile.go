@@ -0,0 +1,175 @@
+package gui
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+
+	"zip-editor/internal/common"
+	"zip-editor/internal/model"
+)
+
+// cleanProfilesTemplate は設定ファイルがない場合に作成する、書き方の例です
+const cleanProfilesTemplate = `# ZIP Editor の不要なファイルのプロファイル
+# "[名前] 説明" の行に続けて、パターンを1行にひとつずつ書きます（書式は「パターンで選択」と同じ）
+# 組み込みのプロファイル（macos、windows、vcs、build、editor）と同じ名前の場合は、パターンを後ろに加えます
+#
+# [office] Officeの一時ファイル
+# ~$*
+#
+# [macos]
+# !keep/.DS_Store
+`
+
+// promptCleanProfiles は不要なファイル（macOS・Windowsが作成するファイルなど）のプロファイルを選び、
+// 一致するアイテムに削除フラグを付けるダイアログを表示します
+// 選んだプロファイルに一致するアイテムを返します。取り消された場合は ok がfalseになります
+func promptCleanProfiles(owner walk.Form, title string, zipModel *model.ZipTreeModel) (items []*model.ZipTreeItem, ok bool) {
+	profiles, err := common.LoadCleanProfiles()
+	if err != nil {
+		walk.MsgBox(owner, "エラー", "プロファイルの読み込みに失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		profiles = common.BuiltinCleanProfiles
+	}
+	// ツリーで展開していない入れ子のアーカイブの中も対象にする
+	zipModel.LoadAllNested()
+
+	var dlg *walk.Dialog
+	var countLabel *walk.Label
+	var previewLB *walk.ListBox
+	var acceptPB, cancelPB *walk.PushButton
+	checks := make([]*walk.CheckBox, len(profiles))
+
+	// find は選んだプロファイルに一致するアイテムを探します
+	find := func() ([]*model.ZipTreeItem, error) {
+		var names []string
+		for i, cb := range checks {
+			if cb.Checked() {
+				names = append(names, profiles[i].Name)
+			}
+		}
+		if len(names) == 0 {
+			return nil, nil
+		}
+		matcher, err := common.CleanProfileMatcher(profiles, names)
+		if err != nil {
+			return nil, err
+		}
+		return zipModel.FindItems(matcher.Match), nil
+	}
+	updatePreview := func() {
+		if previewLB == nil {
+			// ダイアログの作成中（チェックボックスの初期化）は何もしない
+			return
+		}
+		found, err := find()
+		if err != nil {
+			countLabel.SetText("プロファイルの誤り: " + err.Error())
+			previewLB.SetModel([]string{})
+			return
+		}
+		paths := make([]string, 0, min(len(found), maxPatternPreview))
+		for _, item := range found[:min(len(found), maxPatternPreview)] {
+			paths = append(paths, item.GetPath())
+		}
+		text := fmt.Sprintf("一致したファイル・フォルダ: %d件", len(found))
+		if len(found) > maxPatternPreview {
+			text += fmt.Sprintf("（先頭の%d件を表示）", maxPatternPreview)
+		}
+		countLabel.SetText(text)
+		previewLB.SetModel(paths)
+	}
+
+	checkWidgets := make([]Widget, len(profiles))
+	for i, p := range profiles {
+		checkWidgets[i] = CheckBox{
+			AssignTo:         &checks[i],
+			Text:             fmt.Sprintf("%s（%s）", p.Desc, p.Name),
+			Checked:          p.Name == "macos" || p.Name == "windows",
+			OnCheckedChanged: func() { updatePreview() },
+		}
+	}
+
+	if err := (Dialog{
+		AssignTo:      &dlg,
+		Title:         title,
+		DefaultButton: &acceptPB,
+		CancelButton:  &cancelPB,
+		MinSize:       Size{Width: 520, Height: 480},
+		Layout:        VBox{},
+		Children: []Widget{
+			Label{Text: "削除フラグを付ける不要なファイルの種類を選んでください。"},
+			Composite{Layout: VBox{MarginsZero: true}, Children: checkWidgets},
+			Label{AssignTo: &countLabel, Text: "一致したファイル・フォルダ: 0件"},
+			ListBox{AssignTo: &previewLB, StretchFactor: 1},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					PushButton{
+						Text: "設定ファイルを開く...",
+						OnClicked: func() {
+							if err := openCleanProfilesFile(); err != nil {
+								walk.MsgBox(dlg, "エラー", "設定ファイルを開けませんでした: "+err.Error(), walk.MsgBoxIconError)
+							}
+						},
+					},
+					HSpacer{},
+					PushButton{
+						AssignTo: &acceptPB,
+						Text:     "OK",
+						OnClicked: func() {
+							found, err := find()
+							if err != nil {
+								walk.MsgBox(dlg, "エラー", err.Error(), walk.MsgBoxIconError)
+								return
+							}
+							items = found
+							dlg.Accept()
+						},
+					},
+					PushButton{
+						AssignTo:  &cancelPB,
+						Text:      "キャンセル",
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}).Create(owner); err != nil {
+		walk.MsgBox(owner, "エラー", "ダイアログの表示に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		return nil, false
+	}
+
+	// 初期状態でチェックされているプロファイルの一致を表示する
+	updatePreview()
+	if dlg.Run() != walk.DlgCmdOK {
+		return nil, false
+	}
+	return items, true
+}
+
+// openCleanProfilesFile はプロファイルの設定ファイルを既定のアプリケーションで開きます
+// 設定ファイルがない場合は、書き方の例を書いたファイルを作成します
+// 変更した内容は、次にダイアログを開いたときに反映されます
+func openCleanProfilesFile() error {
+	path, err := common.CleanProfilesPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(cleanProfilesTemplate), 0644); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	return exec.Command("cmd", "/C", "start", "", path).Start()
+}
@@ -0,0 +1,76 @@
+package gui
+
+import (
+	"strings"
+
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+
+	"zip-editor/internal/common"
+)
+
+// promptComment はコメントを編集するダイアログを表示します
+// 保存時のエンコーディングも選択でき、取り消された場合は ok がfalseになります
+func promptComment(owner walk.Form, title, message, comment string) (text string, enc common.TextEncoding, ok bool) {
+	var dlg *walk.Dialog
+	var commentTE *walk.TextEdit
+	var encodingCB *walk.ComboBox
+	var acceptPB, cancelPB *walk.PushButton
+
+	names := make([]string, len(common.TextEncodings))
+	for i, e := range common.TextEncodings {
+		names[i] = e.String()
+	}
+	// テキストボックスの改行はCRLFで表示する
+	comment = strings.ReplaceAll(strings.ReplaceAll(comment, "\r\n", "\n"), "\n", "\r\n")
+
+	if _, err := (Dialog{
+		AssignTo:      &dlg,
+		Title:         title,
+		DefaultButton: &acceptPB,
+		CancelButton:  &cancelPB,
+		MinSize:       Size{Width: 460, Height: 320},
+		Layout:        VBox{},
+		Children: []Widget{
+			Label{Text: message},
+			TextEdit{AssignTo: &commentTE, Text: comment, VScroll: true, MinSize: Size{Height: 160}},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					Label{Text: "保存時のエンコーディング:"},
+					ComboBox{AssignTo: &encodingCB, Model: names, CurrentIndex: 0},
+					HSpacer{},
+				},
+			},
+			Label{Text: "※ 変更は「削除」ボタンなどでZIPファイルを保存したときに反映されます。"},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo:  &acceptPB,
+						Text:      "OK",
+						OnClicked: func() { dlg.Accept() },
+					},
+					PushButton{
+						AssignTo:  &cancelPB,
+						Text:      "キャンセル",
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}).Run(owner); err != nil {
+		walk.MsgBox(owner, "エラー", "ダイアログの表示に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		return "", common.EncodingUTF8, false
+	}
+
+	if dlg.Result() != walk.DlgCmdOK {
+		return "", common.EncodingUTF8, false
+	}
+	idx := encodingCB.CurrentIndex()
+	if idx < 0 || idx >= len(common.TextEncodings) {
+		idx = 0
+	}
+	return commentTE.Text(), common.TextEncodings[idx], true
+}
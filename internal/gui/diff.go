@@ -0,0 +1,233 @@
+package gui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+
+	"zip-editor/internal/archive"
+	"zip-editor/internal/fileops"
+)
+
+// promptArchiveDiff は表示中のアーカイブをほかのアーカイブと比較するダイアログを表示します
+// 比較する相手は others（左の一覧のほかのアーカイブ）から選ぶか、ファイルを指定します
+// 変化したファイルを選ぶと、変わった項目とテキストの差分を表示します
+// 比較した後は、古い版を新しい版に更新するパッチを作成できます
+func promptArchiveDiff(owner walk.Form, title, current string, others []string, prompt fileops.PasswordFunc) {
+	var dlg *walk.Dialog
+	var otherCB *walk.ComboBox
+	var currentIsNewCB *walk.CheckBox
+	var comparePB *walk.PushButton
+	var patchPB *walk.PushButton
+	var statusLabel *walk.Label
+	var changesLB *walk.ListBox
+	var detailTE *walk.TextEdit
+
+	var result *archive.DiffResult
+	var patchOld, patchNew string // 最後に比較した古い版と新しい版
+	running := false
+	choices := append([]string(nil), others...)
+	names := make([]string, len(choices))
+	for i, p := range choices {
+		names[i] = filepath.Base(p)
+	}
+
+	// browse は比較するアーカイブをファイルから選び、一覧に加えます
+	browse := func() {
+		fd := &walk.FileDialog{
+			Title:  "比較するアーカイブ",
+			Filter: "アーカイブ (*.zip;*.tar;*.tar.gz;*.tgz;*.7z;*.rar)|*.zip;*.tar;*.tar.gz;*.tgz;*.7z;*.rar|すべてのファイル (*.*)|*.*",
+		}
+		if ok, err := fd.ShowOpen(dlg); err != nil || !ok {
+			return
+		}
+		choices = append(choices, fd.FilePath)
+		names = append(names, filepath.Base(fd.FilePath))
+		otherCB.SetModel(names)
+		otherCB.SetCurrentIndex(len(names) - 1)
+	}
+
+	// showDetail は選んだファイルの変わった項目とテキストの差分を表示します
+	showDetail := func() {
+		i := changesLB.CurrentIndex()
+		if result == nil || i < 0 || i >= len(result.Changes) {
+			detailTE.SetText("")
+			return
+		}
+		detailTE.SetText(strings.ReplaceAll(formatDiffChange(result.Changes[i]), "\n", "\r\n"))
+	}
+
+	// compare は選んだアーカイブと比較します（別のゴルーチンで比較し、結果をダイアログに表示します）
+	compare := func() {
+		if running {
+			return
+		}
+		i := otherCB.CurrentIndex()
+		if i < 0 || i >= len(choices) {
+			walk.MsgBox(dlg, "情報", "比較するアーカイブを選んでください。", walk.MsgBoxIconInformation)
+			return
+		}
+		oldPath, newPath := choices[i], current
+		if !currentIsNewCB.Checked() {
+			oldPath, newPath = newPath, oldPath
+		}
+
+		running = true
+		comparePB.SetEnabled(false)
+		patchPB.SetEnabled(false)
+		statusLabel.SetText("比較しています...")
+		changesLB.SetModel([]string{})
+		detailTE.SetText("")
+		go func() {
+			res, err := fileops.DiffArchives(oldPath, newPath, archive.DiffOptions{TextDiff: true, Context: 3}, prompt)
+			dlg.Synchronize(func() {
+				running = false
+				if dlg.IsDisposed() {
+					return
+				}
+				comparePB.SetEnabled(true)
+				if err != nil {
+					statusLabel.SetText("")
+					walk.MsgBox(dlg, "エラー", "アーカイブを比較できませんでした: "+err.Error(), walk.MsgBoxIconError)
+					return
+				}
+				result = res
+				patchOld, patchNew = oldPath, newPath
+				patchPB.SetEnabled(true)
+				statusLabel.SetText(fmt.Sprintf("%s → %s: %s", filepath.Base(oldPath), filepath.Base(newPath), res.Summary()))
+				items := make([]string, len(res.Changes))
+				for i, c := range res.Changes {
+					items[i] = diffChangeText(c)
+				}
+				changesLB.SetModel(items)
+			})
+		}()
+	}
+
+	// createPatch は最後に比較した古い版を新しい版に更新するパッチを作成します
+	createPatch := func() {
+		if running || patchOld == "" {
+			return
+		}
+		fd := &walk.FileDialog{
+			Title:    "パッチの保存先",
+			Filter:   "パッチ (*.zpatch)|*.zpatch|すべてのファイル (*.*)|*.*",
+			FilePath: strings.TrimSuffix(patchNew, filepath.Ext(patchNew)) + ".zpatch",
+		}
+		if ok, err := fd.ShowSave(dlg); err != nil || !ok {
+			return
+		}
+		patchPath := fd.FilePath
+		if strings.EqualFold(patchPath, patchOld) || strings.EqualFold(patchPath, patchNew) {
+			walk.MsgBox(dlg, "エラー", "パッチの保存先に比較したアーカイブは指定できません。", walk.MsgBoxIconError)
+			return
+		}
+
+		running = true
+		comparePB.SetEnabled(false)
+		patchPB.SetEnabled(false)
+		statusLabel.SetText("パッチを作成しています...")
+		oldPath, newPath := patchOld, patchNew
+		go func() {
+			report, err := fileops.CreatePatch(oldPath, newPath, patchPath)
+			dlg.Synchronize(func() {
+				running = false
+				if dlg.IsDisposed() {
+					return
+				}
+				comparePB.SetEnabled(true)
+				patchPB.SetEnabled(true)
+				statusLabel.SetText(fmt.Sprintf("%s → %s: %s", filepath.Base(oldPath), filepath.Base(newPath), result.Summary()))
+				if err != nil {
+					walk.MsgBox(dlg, "エラー", "パッチを作成できませんでした: "+err.Error(), walk.MsgBoxIconError)
+					return
+				}
+				walk.MsgBox(dlg, "パッチを作成しました", report, walk.MsgBoxIconInformation)
+			})
+		}()
+	}
+
+	if err := (Dialog{
+		AssignTo: &dlg,
+		Title:    title,
+		MinSize:  Size{Width: 800, Height: 560},
+		Layout:   VBox{},
+		Children: []Widget{
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					Label{Text: "比較するアーカイブ:"},
+					ComboBox{AssignTo: &otherCB, Model: names, CurrentIndex: 0, StretchFactor: 1},
+					PushButton{Text: "参照...", OnClicked: func() { browse() }},
+					PushButton{AssignTo: &comparePB, Text: "比較", OnClicked: func() { compare() }},
+				},
+			},
+			CheckBox{
+				AssignTo: &currentIsNewCB,
+				Text:     filepath.Base(current) + " を新しい版として比較する（外すと古い版として比較します）",
+				Checked:  true,
+			},
+			Label{AssignTo: &statusLabel},
+			HSplitter{
+				StretchFactor: 1,
+				Children: []Widget{
+					ListBox{
+						AssignTo:              &changesLB,
+						OnCurrentIndexChanged: func() { showDetail() },
+					},
+					TextEdit{AssignTo: &detailTE, ReadOnly: true, VScroll: true, HScroll: true},
+				},
+			},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					PushButton{
+						AssignTo:  &patchPB,
+						Text:      "パッチを作成...",
+						Enabled:   false,
+						OnClicked: func() { createPatch() },
+					},
+					HSpacer{},
+					PushButton{Text: "閉じる", OnClicked: func() { dlg.Cancel() }},
+				},
+			},
+		},
+	}).Create(owner); err != nil {
+		walk.MsgBox(owner, "エラー", "ダイアログの表示に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		return
+	}
+	dlg.Run()
+}
+
+// diffChangeText は変化したファイルを一覧に表示する文字列にします
+func diffChangeText(c archive.DiffChange) string {
+	if c.Kind == archive.DiffRenamed {
+		return fmt.Sprintf("［%s］%s → %s", c.Kind, c.OldPath, c.Path)
+	}
+	return fmt.Sprintf("［%s］%s", c.Kind, c.Path)
+}
+
+// formatDiffChange は変化したファイルの変わった項目とテキストの差分を表示用の文字列にします
+func formatDiffChange(c archive.DiffChange) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s\n", diffChangeText(c))
+	switch c.Kind {
+	case archive.DiffAdded:
+		fmt.Fprintf(&sb, "サイズ: %d バイト\n", c.NewSize)
+	case archive.DiffRemoved:
+		fmt.Fprintf(&sb, "サイズ: %d バイト\n", c.OldSize)
+	}
+	for _, d := range c.Details {
+		fmt.Fprintf(&sb, "%s\n", d)
+	}
+	if c.Note != "" {
+		fmt.Fprintf(&sb, "（%s）\n", c.Note)
+	}
+	if c.TextDiff != "" {
+		fmt.Fprintf(&sb, "\n%s", c.TextDiff)
+	}
+	return sb.String()
+}
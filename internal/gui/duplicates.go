@@ -0,0 +1,256 @@
+package gui
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+
+	"zip-editor/internal/archive"
+	"zip-editor/internal/common"
+	"zip-editor/internal/fileops"
+)
+
+// duplicateChoice は同じ内容のファイルを探すダイアログで選んだ、削除フラグの付け方です
+type duplicateChoice struct {
+	result     *archive.DuplicateResult
+	keep       archive.DuplicateKeep
+	perArchive bool
+}
+
+// promptDuplicates は同じ内容のファイルを探すダイアログを表示します
+// current は表示中のアーカイブ、all は左の一覧のすべてのアーカイブで、「左の一覧のすべてのアーカイブ」を選んだ場合は all の間でも探します
+// 「残すもの以外に削除フラグを付ける」を押した場合は結果と残すものの選び方を返し、閉じられた場合は ok がfalseになります
+func promptDuplicates(owner walk.Form, title, current string, all []string, prompt fileops.PasswordFunc) (choice duplicateChoice, ok bool) {
+	var dlg *walk.Dialog
+	var allCB, perArchiveCB *walk.CheckBox
+	var minSizeLE, includeLE *walk.LineEdit
+	var keepCB *walk.ComboBox
+	var searchPB, flagPB *walk.PushButton
+	var statusLabel *walk.Label
+	var groupsLB *walk.ListBox
+	var detailTE *walk.TextEdit
+
+	var result *archive.DuplicateResult
+	var cancel chan struct{}
+	running := false
+
+	keep := func() archive.DuplicateKeep {
+		if keepCB.CurrentIndex() == 1 {
+			return archive.KeepShortestPath
+		}
+		return archive.KeepFirst
+	}
+
+	// showDetail は選んだ組のファイルを、残すものと削除フラグを付けるものに分けて表示します
+	showDetail := func() {
+		// ダイアログの作成中にも呼び出されるため、作成前のコントロールには触れない
+		if groupsLB == nil || detailTE == nil || keepCB == nil || perArchiveCB == nil {
+			return
+		}
+		i := groupsLB.CurrentIndex()
+		if result == nil || i < 0 || i >= len(result.Groups) {
+			detailTE.SetText("")
+			return
+		}
+		detailTE.SetText(strings.ReplaceAll(formatDuplicateGroup(&result.Groups[i], keep(), perArchiveCB.Checked()), "\n", "\r\n"))
+	}
+
+	// search は入力した条件で探し始めます（別のゴルーチンで探し、結果をダイアログに表示します）
+	search := func() {
+		if running {
+			if cancel != nil {
+				close(cancel)
+				cancel = nil
+			}
+			return
+		}
+		opts := archive.DuplicateOptions{}
+		if text := strings.TrimSpace(minSizeLE.Text()); text != "" {
+			size, err := common.ParseQuerySize(text)
+			if err != nil {
+				walk.MsgBox(dlg, "エラー", err.Error(), walk.MsgBoxIconError)
+				return
+			}
+			opts.MinSize = size
+		}
+		if include := strings.Fields(includeLE.Text()); len(include) > 0 {
+			m, err := common.CompilePatterns(include)
+			if err != nil {
+				walk.MsgBox(dlg, "エラー", err.Error(), walk.MsgBoxIconError)
+				return
+			}
+			opts.Include = m.Match
+		}
+		archives := []string{current}
+		if allCB.Checked() {
+			archives = all
+		}
+		cancel = make(chan struct{})
+		opts.Cancel = cancel
+
+		running = true
+		result = nil
+		searchPB.SetText("中止")
+		flagPB.SetEnabled(false)
+		statusLabel.SetText(fmt.Sprintf("%d個のアーカイブを調べています...", len(archives)))
+		groupsLB.SetModel([]string{})
+		detailTE.SetText("")
+		go func() {
+			res, err := fileops.FindDuplicates(archives, opts, prompt)
+			dlg.Synchronize(func() {
+				running = false
+				cancel = nil
+				if dlg.IsDisposed() {
+					return
+				}
+				searchPB.SetText("検索")
+				if errors.Is(err, archive.ErrSearchCanceled) {
+					statusLabel.SetText(err.Error())
+					return
+				}
+				if err != nil {
+					statusLabel.SetText("")
+					walk.MsgBox(dlg, "エラー", "同じ内容のファイルを探せませんでした: "+err.Error(), walk.MsgBoxIconError)
+					return
+				}
+				result = res
+				statusLabel.SetText(fileops.FormatDuplicateReport(res))
+				items := make([]string, len(res.Groups))
+				for i := range res.Groups {
+					items[i] = duplicateGroupText(&res.Groups[i])
+				}
+				for _, skip := range res.Skipped {
+					items = append(items, "（読み取れません）"+fileops.DuplicateSkipText(skip))
+				}
+				groupsLB.SetModel(items)
+				flagPB.SetEnabled(len(res.Groups) > 0)
+			})
+		}()
+	}
+
+	if err := (Dialog{
+		AssignTo: &dlg,
+		Title:    title,
+		MinSize:  Size{Width: 760, Height: 560},
+		Layout:   VBox{},
+		Children: []Widget{
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					CheckBox{
+						AssignTo: &allCB,
+						Text:     fmt.Sprintf("左の一覧のすべてのアーカイブ（%d個）の間でも探す", len(all)),
+						Enabled:  len(all) > 1,
+					},
+					HSpacer{},
+					PushButton{AssignTo: &searchPB, Text: "検索", OnClicked: func() { search() }},
+				},
+			},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					Label{Text: "最小サイズ:"},
+					LineEdit{AssignTo: &minSizeLE, Text: "1", MaxSize: Size{Width: 80}, ToolTipText: "これより小さいファイルは調べません（例: 1K、10MB）"},
+					Label{Text: "対象のファイル:"},
+					LineEdit{AssignTo: &includeLE, ToolTipText: "空白で区切ったパターン（例: *.png *.jpg assets/）。空の場合はすべてのファイル"},
+				},
+			},
+			Label{AssignTo: &statusLabel},
+			HSplitter{
+				StretchFactor: 1,
+				Children: []Widget{
+					ListBox{
+						AssignTo:              &groupsLB,
+						OnCurrentIndexChanged: func() { showDetail() },
+					},
+					TextEdit{AssignTo: &detailTE, ReadOnly: true, VScroll: true, HScroll: true},
+				},
+			},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					Label{Text: "残すもの:"},
+					ComboBox{
+						AssignTo:              &keepCB,
+						Model:                 []string{"先にあるもの", "パスが最も短いもの"},
+						CurrentIndex:          0,
+						OnCurrentIndexChanged: func() { showDetail() },
+					},
+					CheckBox{
+						AssignTo:         &perArchiveCB,
+						Text:             "アーカイブごとにひとつ残す",
+						ToolTipText:      "複数のアーカイブにまたがる組でも、ほかのアーカイブにあるファイルには削除フラグを付けません",
+						OnCheckedChanged: func() { showDetail() },
+					},
+				},
+			},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					PushButton{
+						AssignTo: &flagPB,
+						Text:     "残すもの以外に削除フラグを付ける",
+						Enabled:  false,
+						OnClicked: func() {
+							if result == nil || len(result.Groups) == 0 {
+								return
+							}
+							choice = duplicateChoice{result: result, keep: keep(), perArchive: perArchiveCB.Checked()}
+							dlg.Accept()
+						},
+					},
+					HSpacer{},
+					PushButton{Text: "閉じる", OnClicked: func() { dlg.Cancel() }},
+				},
+			},
+		},
+	}).Create(owner); err != nil {
+		walk.MsgBox(owner, "エラー", "ダイアログの表示に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		return duplicateChoice{}, false
+	}
+	// 閉じる際は実行中の検索を中止する
+	dlg.Closing().Attach(func(canceled *bool, reason walk.CloseReason) {
+		if running && cancel != nil {
+			close(cancel)
+			cancel = nil
+		}
+	})
+
+	if dlg.Run() != walk.DlgCmdOK {
+		return duplicateChoice{}, false
+	}
+	return choice, true
+}
+
+// duplicateGroupText は同じ内容のファイルの組を一覧に表示する文字列にします
+func duplicateGroupText(g *archive.DuplicateGroup) string {
+	text := fmt.Sprintf("%s（%d件 × %d バイト、減らせるサイズ: %d バイト）", g.Files[0].Path, len(g.Files), g.Size, g.Wasted())
+	if g.CrossArchive() {
+		text += "［複数のアーカイブ］"
+	}
+	return text
+}
+
+// formatDuplicateGroup は組のファイルを、残すものと削除フラグを付けるものに分けて表示用の文字列にします
+func formatDuplicateGroup(g *archive.DuplicateGroup, keep archive.DuplicateKeep, perArchive bool) string {
+	redundant := make(map[archive.DuplicateFile]bool)
+	for _, f := range g.Redundant(keep, perArchive) {
+		redundant[f] = true
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "SHA-256: %s\n", hex.EncodeToString(g.SHA256[:]))
+	fmt.Fprintf(&sb, "サイズ: %d バイト\n\n", g.Size)
+	for _, f := range g.Files {
+		mark := "［残す］"
+		if redundant[f] {
+			mark = "［削除］"
+		}
+		fmt.Fprintf(&sb, "%s %s: %s\n", mark, filepath.Base(f.Archive), f.Path)
+	}
+	return sb.String()
+}
@@ -0,0 +1,23 @@
+package gui
+
+import (
+	"github.com/lxn/walk"
+
+	"zip-editor/internal/model"
+)
+
+// updateFileList は指定されたディレクトリ内のファイル一覧を更新します
+func updateFileList(tv *walk.TableView, treeItem *model.ZipTreeItem) error {
+
+	// TableViewのモデルを設定
+	fileModel := new(model.FileItemModel)
+
+	// まだ開いていない入れ子のアーカイブは、選択されたときに開く
+	treeItem.LoadNested()
+
+	// ポインタのスライスをそのまま使用
+	fileModel.Items = treeItem.GetFiles()
+	tv.SetModel(fileModel)
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package gui
+
+import (
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+
+	"zip-editor/internal/zipfmt"
+)
+
+// levelChoices は圧縮レベルの選択肢です（表示名とレベルの対応）
+var levelChoices = []struct {
+	name  string
+	level int
+}{
+	{"標準", zipfmt.LevelDefault},
+	{"高速", zipfmt.LevelFastest},
+	{"高圧縮", 7},
+	{"最高圧縮（低速）", zipfmt.LevelBest},
+}
+
+// promptCompression は圧縮方式と圧縮レベルを選択するダイアログを表示します
+// 取り消された場合は ok がfalseになります
+func promptCompression(owner walk.Form, title, message string) (method uint16, level int, ok bool) {
+	var dlg *walk.Dialog
+	var methodCB, levelCB *walk.ComboBox
+	var acceptPB, cancelPB *walk.PushButton
+
+	names := make([]string, len(zipfmt.WritableMethods))
+	for i, m := range zipfmt.WritableMethods {
+		names[i] = zipfmt.MethodName(m)
+	}
+	levelNames := make([]string, len(levelChoices))
+	for i, c := range levelChoices {
+		levelNames[i] = c.name
+	}
+
+	if _, err := (Dialog{
+		AssignTo:      &dlg,
+		Title:         title,
+		DefaultButton: &acceptPB,
+		CancelButton:  &cancelPB,
+		MinSize:       Size{Width: 360, Height: 180},
+		Layout:        VBox{},
+		Children: []Widget{
+			Label{Text: message},
+			Label{Text: "圧縮方式:"},
+			ComboBox{AssignTo: &methodCB, Model: names, CurrentIndex: 0},
+			Label{Text: "圧縮レベル:"},
+			ComboBox{AssignTo: &levelCB, Model: levelNames, CurrentIndex: 0},
+			Label{Text: "※ Deflate以外の方式は、対応していない展開ソフトがあります。"},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo:  &acceptPB,
+						Text:      "OK",
+						OnClicked: func() { dlg.Accept() },
+					},
+					PushButton{
+						AssignTo:  &cancelPB,
+						Text:      "キャンセル",
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}).Run(owner); err != nil {
+		walk.MsgBox(owner, "エラー", "ダイアログの表示に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		return 0, 0, false
+	}
+
+	if dlg.Result() != walk.DlgCmdOK {
+		return 0, 0, false
+	}
+	idx := methodCB.CurrentIndex()
+	if idx < 0 || idx >= len(zipfmt.WritableMethods) {
+		idx = 0
+	}
+	levelIdx := levelCB.CurrentIndex()
+	if levelIdx < 0 || levelIdx >= len(levelChoices) {
+		levelIdx = 0
+	}
+	return zipfmt.WritableMethods[idx], levelChoices[levelIdx].level, true
+}
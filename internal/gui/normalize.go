@@ -0,0 +1,80 @@
+package gui
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+
+	"zip-editor/internal/zipfmt"
+)
+
+// promptNormalize は正規化に使う日時と圧縮レベルを入力するダイアログを表示します
+// 日時はUTCとして入力します（初期値は環境変数 SOURCE_DATE_EPOCH、設定されていない場合は1980-01-01 00:00:00）
+// 取り消された場合は ok がfalseになります
+func promptNormalize(owner walk.Form, title, message string) (opts zipfmt.NormalizeOptions, ok bool) {
+	var dlg *walk.Dialog
+	var dateDE *walk.DateEdit
+	var levelCB *walk.ComboBox
+	var acceptPB, cancelPB *walk.PushButton
+
+	epoch, err := zipfmt.SourceDateEpoch()
+	if err != nil {
+		walk.MsgBox(owner, "エラー", err.Error(), walk.MsgBoxIconError)
+		return zipfmt.NormalizeOptions{}, false
+	}
+	// DateEdit はローカルの日時を扱うため、UTCの日時を同じ表記のローカルの日時にして表示する
+	epoch = time.Date(epoch.Year(), epoch.Month(), epoch.Day(), epoch.Hour(), epoch.Minute(), epoch.Second(), 0, time.Local)
+
+	levels := make([]string, 9)
+	for i := range levels {
+		levels[i] = strconv.Itoa(i + 1)
+	}
+
+	if _, err := (Dialog{
+		AssignTo:      &dlg,
+		Title:         title,
+		DefaultButton: &acceptPB,
+		CancelButton:  &cancelPB,
+		MinSize:       Size{Width: 400, Height: 220},
+		Layout:        VBox{},
+		Children: []Widget{
+			Label{Text: message},
+			Label{Text: "すべてのエントリに設定する日時（UTC）:"},
+			DateEdit{AssignTo: &dateDE, Format: "yyyy/MM/dd HH:mm:ss", Date: epoch},
+			Label{Text: "Deflateの圧縮レベル:"},
+			ComboBox{AssignTo: &levelCB, Model: levels, CurrentIndex: zipfmt.DefaultNormalizeLevel - 1},
+			Label{Text: "※ エントリを並べ替え、パーミッションを0644・0755に揃え、拡張フィールドとコメントを取り除きます。"},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo: &acceptPB,
+						Text:     "OK",
+						OnClicked: func() {
+							d := dateDE.Date()
+							opts.Time = time.Date(d.Year(), d.Month(), d.Day(), d.Hour(), d.Minute(), d.Second(), 0, time.UTC)
+							opts.Level = max(levelCB.CurrentIndex(), 0) + 1
+							dlg.Accept()
+						},
+					},
+					PushButton{
+						AssignTo:  &cancelPB,
+						Text:      "キャンセル",
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}).Run(owner); err != nil {
+		walk.MsgBox(owner, "エラー", "ダイアログの表示に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		return zipfmt.NormalizeOptions{}, false
+	}
+
+	if dlg.Result() != walk.DlgCmdOK {
+		return zipfmt.NormalizeOptions{}, false
+	}
+	return opts, true
+}
@@ -0,0 +1,150 @@
+package gui
+
+import (
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+
+	"zip-editor/internal/fileops"
+	"zip-editor/internal/zipfmt"
+)
+
+// promptEntryOrder はZIPファイルのエントリの順序を編集するダイアログを表示します
+// パス・サイズの順に並べ替えたり、形式ごとの決まり（EPUB・JAR）に合わせたりした後、個別に上下へ移動できます
+// 編集後の順序に並べたパスの一覧を返します。取り消された場合は ok がfalseになります
+func promptEntryOrder(owner walk.Form, title, message string, entries []fileops.EntryInfo) (paths []string, ok bool) {
+	var dlg *walk.Dialog
+	var entryLB *walk.ListBox
+	var presetCB *walk.ComboBox
+	var acceptPB, cancelPB *walk.PushButton
+
+	// current は表示している順序で、entries の位置を並べたものです
+	current := make([]int, len(entries))
+	for i := range current {
+		current[i] = i
+	}
+	names := func() []string {
+		list := make([]string, len(current))
+		for i, j := range current {
+			list[i] = entries[j].Path
+		}
+		return list
+	}
+	refresh := func(selected int) {
+		entryLB.SetModel(names())
+		if selected >= 0 && selected < len(current) {
+			entryLB.SetCurrentIndex(selected)
+		}
+	}
+
+	// sortBy は表示している順序を指定した並べ方で並べ替えます
+	sortBy := func(order zipfmt.EntryOrder) {
+		index := zipfmt.OrderNames(names(), func(i int) uint64 { return entries[current[i]].Size }, order)
+		sorted := make([]int, len(current))
+		for i, j := range index {
+			sorted[i] = current[j]
+		}
+		current = sorted
+		refresh(0)
+	}
+
+	// move は選択しているエントリを to の位置へ移動します
+	move := func(to func(from int) int) {
+		from := entryLB.CurrentIndex()
+		if from < 0 || from >= len(current) {
+			return
+		}
+		dst := min(max(to(from), 0), len(current)-1)
+		moved := current[from]
+		current = append(current[:from], current[from+1:]...)
+		current = append(current[:dst], append([]int{moved}, current[dst:]...)...)
+		refresh(dst)
+	}
+
+	presetNames := make([]string, len(zipfmt.OrderPresets))
+	for i, p := range zipfmt.OrderPresets {
+		presetNames[i] = p.Name
+	}
+
+	if _, err := (Dialog{
+		AssignTo:      &dlg,
+		Title:         title,
+		DefaultButton: &acceptPB,
+		CancelButton:  &cancelPB,
+		MinSize:       Size{Width: 560, Height: 460},
+		Layout:        VBox{},
+		Children: []Widget{
+			Label{Text: message},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					ListBox{AssignTo: &entryLB, Model: names(), StretchFactor: 3},
+					Composite{
+						Layout: VBox{MarginsZero: true},
+						Children: []Widget{
+							PushButton{Text: "先頭へ", OnClicked: func() { move(func(int) int { return 0 }) }},
+							PushButton{Text: "上へ", OnClicked: func() { move(func(i int) int { return i - 1 }) }},
+							PushButton{Text: "下へ", OnClicked: func() { move(func(i int) int { return i + 1 }) }},
+							PushButton{Text: "末尾へ", OnClicked: func() { move(func(int) int { return len(current) - 1 }) }},
+							VSpacer{Size: 10},
+							PushButton{Text: "パスの順", OnClicked: func() { sortBy(zipfmt.EntryOrder{Mode: zipfmt.OrderByPath}) }},
+							PushButton{Text: "サイズの順", OnClicked: func() { sortBy(zipfmt.EntryOrder{Mode: zipfmt.OrderBySize}) }},
+							PushButton{Text: "サイズの大きい順", OnClicked: func() { sortBy(zipfmt.EntryOrder{Mode: zipfmt.OrderBySize, Descending: true}) }},
+							PushButton{
+								Text: "元の順序",
+								OnClicked: func() {
+									for i := range current {
+										current[i] = i
+									}
+									refresh(0)
+								},
+							},
+							VSpacer{},
+						},
+					},
+				},
+			},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					Label{Text: "形式の決まりに合わせる:"},
+					ComboBox{AssignTo: &presetCB, Model: presetNames, CurrentIndex: 0},
+					PushButton{
+						Text: "適用",
+						OnClicked: func() {
+							preset := zipfmt.OrderPresets[max(presetCB.CurrentIndex(), 0)]
+							sortBy(zipfmt.EntryOrder{First: preset.First})
+						},
+					},
+					HSpacer{},
+				},
+			},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo: &acceptPB,
+						Text:     "OK",
+						OnClicked: func() {
+							paths = names()
+							dlg.Accept()
+						},
+					},
+					PushButton{
+						AssignTo:  &cancelPB,
+						Text:      "キャンセル",
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}).Run(owner); err != nil {
+		walk.MsgBox(owner, "エラー", "ダイアログの表示に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		return nil, false
+	}
+
+	if dlg.Result() != walk.DlgCmdOK {
+		return nil, false
+	}
+	return paths, true
+}
@@ -0,0 +1,132 @@
+package gui
+
+import (
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+
+	"zip-editor/internal/zipfmt"
+)
+
+// promptPassword はパスワード入力ダイアログを表示し、入力されたパスワードを返します
+// 取り消された場合は ok がfalseになります
+func promptPassword(owner walk.Form, title, message string) (password string, ok bool) {
+	var dlg *walk.Dialog
+	var passwordEdit *walk.LineEdit
+	var acceptPB, cancelPB *walk.PushButton
+
+	if _, err := (Dialog{
+		AssignTo:      &dlg,
+		Title:         title,
+		DefaultButton: &acceptPB,
+		CancelButton:  &cancelPB,
+		MinSize:       Size{Width: 360, Height: 120},
+		Layout:        VBox{},
+		Children: []Widget{
+			Label{Text: message},
+			LineEdit{AssignTo: &passwordEdit, PasswordMode: true},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo:  &acceptPB,
+						Text:      "OK",
+						OnClicked: func() { dlg.Accept() },
+					},
+					PushButton{
+						AssignTo:  &cancelPB,
+						Text:      "キャンセル",
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}).Run(owner); err != nil {
+		walk.MsgBox(owner, "エラー", "ダイアログの表示に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		return "", false
+	}
+
+	if dlg.Result() != walk.DlgCmdOK {
+		return "", false
+	}
+	return passwordEdit.Text(), true
+}
+
+// encryptionChoices は暗号化方式の選択肢です（表示名と方式の対応）
+var encryptionChoices = []struct {
+	name       string
+	encryption zipfmt.Encryption
+}{
+	{"AES-256（推奨）", zipfmt.EncryptionAES256},
+	{"ZipCrypto（互換性重視・脆弱）", zipfmt.EncryptionZipCrypto},
+}
+
+// promptEncryption は暗号化方式とパスワードを入力するダイアログを表示します
+// 取り消された場合は ok がfalseになります
+func promptEncryption(owner walk.Form, title, message string) (password string, encryption zipfmt.Encryption, ok bool) {
+	var dlg *walk.Dialog
+	var methodCB *walk.ComboBox
+	var passwordEdit, confirmEdit *walk.LineEdit
+	var acceptPB, cancelPB *walk.PushButton
+
+	names := make([]string, len(encryptionChoices))
+	for i, c := range encryptionChoices {
+		names[i] = c.name
+	}
+
+	if _, err := (Dialog{
+		AssignTo:      &dlg,
+		Title:         title,
+		DefaultButton: &acceptPB,
+		CancelButton:  &cancelPB,
+		MinSize:       Size{Width: 360, Height: 180},
+		Layout:        VBox{},
+		Children: []Widget{
+			Label{Text: message},
+			Label{Text: "暗号化方式:"},
+			ComboBox{AssignTo: &methodCB, Model: names, CurrentIndex: 0},
+			Label{Text: "パスワード:"},
+			LineEdit{AssignTo: &passwordEdit, PasswordMode: true},
+			Label{Text: "確認のため、もう一度入力してください:"},
+			LineEdit{AssignTo: &confirmEdit, PasswordMode: true},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo: &acceptPB,
+						Text:     "OK",
+						OnClicked: func() {
+							if passwordEdit.Text() == "" {
+								walk.MsgBox(dlg, "情報", "パスワードを入力してください。", walk.MsgBoxIconInformation)
+								return
+							}
+							if passwordEdit.Text() != confirmEdit.Text() {
+								walk.MsgBox(dlg, "情報", "パスワードが一致しません。", walk.MsgBoxIconInformation)
+								return
+							}
+							dlg.Accept()
+						},
+					},
+					PushButton{
+						AssignTo:  &cancelPB,
+						Text:      "キャンセル",
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}).Run(owner); err != nil {
+		walk.MsgBox(owner, "エラー", "ダイアログの表示に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		return "", 0, false
+	}
+
+	if dlg.Result() != walk.DlgCmdOK {
+		return "", 0, false
+	}
+	idx := methodCB.CurrentIndex()
+	if idx < 0 || idx >= len(encryptionChoices) {
+		idx = 0
+	}
+	return passwordEdit.Text(), encryptionChoices[idx].encryption, true
+}
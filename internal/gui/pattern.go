@@ -0,0 +1,116 @@
+package gui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+
+	"zip-editor/internal/common"
+	"zip-editor/internal/model"
+)
+
+// maxPatternPreview はパターンに一致したアイテムの一覧に表示する最大数です
+const maxPatternPreview = 500
+
+// promptPatternSelect はグロブ・正規表現のパターンで、削除フラグを付ける（外す）アイテムを選ぶダイアログを表示します
+// 入力中のパターンに一致するアイテムの数と一覧を、確定する前に表示します
+// 一致したアイテムと、削除フラグを付けるか（true）外すか（false）を返します。取り消された場合は ok がfalseになります
+func promptPatternSelect(owner walk.Form, title string, zipModel *model.ZipTreeModel) (items []*model.ZipTreeItem, flag bool, ok bool) {
+	// ツリーで展開していない入れ子のアーカイブの中も対象にする
+	zipModel.LoadAllNested()
+
+	var dlg *walk.Dialog
+	var patternTE *walk.TextEdit
+	var actionCB *walk.ComboBox
+	var countLabel *walk.Label
+	var previewLB *walk.ListBox
+	var acceptPB, cancelPB *walk.PushButton
+
+	// find は入力中のパターンに一致するアイテムを探します
+	find := func() ([]*model.ZipTreeItem, error) {
+		matcher, err := common.CompilePatterns(common.ParsePatternList(strings.ReplaceAll(patternTE.Text(), "\r", "")))
+		if err != nil {
+			return nil, err
+		}
+		return zipModel.FindItems(matcher.Match), nil
+	}
+	updatePreview := func() {
+		found, err := find()
+		if err != nil {
+			countLabel.SetText("パターンの誤り: " + err.Error())
+			previewLB.SetModel([]string{})
+			return
+		}
+		paths := make([]string, 0, min(len(found), maxPatternPreview))
+		for _, item := range found[:min(len(found), maxPatternPreview)] {
+			paths = append(paths, item.GetPath())
+		}
+		text := fmt.Sprintf("一致したファイル・フォルダ: %d件", len(found))
+		if len(found) > maxPatternPreview {
+			text += fmt.Sprintf("（先頭の%d件を表示）", maxPatternPreview)
+		}
+		countLabel.SetText(text)
+		previewLB.SetModel(paths)
+	}
+
+	if _, err := (Dialog{
+		AssignTo:      &dlg,
+		Title:         title,
+		DefaultButton: &acceptPB,
+		CancelButton:  &cancelPB,
+		MinSize:       Size{Width: 520, Height: 480},
+		Layout:        VBox{},
+		Children: []Widget{
+			Label{Text: "パターンを1行にひとつずつ入力してください（後の行ほど優先されます）。"},
+			Label{Text: "例: *.log、__MACOSX/、.DS_Store、docs/**/*.tmp、re:\\.bak$、!keep.log（除外）"},
+			TextEdit{
+				AssignTo:      &patternTE,
+				VScroll:       true,
+				MinSize:       Size{Height: 80},
+				OnTextChanged: func() { updatePreview() },
+			},
+			ComboBox{
+				AssignTo:     &actionCB,
+				Model:        []string{"一致したものに削除フラグを付ける", "一致したものの削除フラグを外す"},
+				CurrentIndex: 0,
+			},
+			Label{AssignTo: &countLabel, Text: "一致したファイル・フォルダ: 0件"},
+			ListBox{AssignTo: &previewLB, StretchFactor: 1},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo: &acceptPB,
+						Text:     "OK",
+						OnClicked: func() {
+							found, err := find()
+							if err != nil {
+								walk.MsgBox(dlg, "エラー", err.Error(), walk.MsgBoxIconError)
+								return
+							}
+							items = found
+							flag = actionCB.CurrentIndex() == 0
+							dlg.Accept()
+						},
+					},
+					PushButton{
+						AssignTo:  &cancelPB,
+						Text:      "キャンセル",
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}).Run(owner); err != nil {
+		walk.MsgBox(owner, "エラー", "ダイアログの表示に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		return nil, false, false
+	}
+
+	if dlg.Result() != walk.DlgCmdOK {
+		return nil, false, false
+	}
+	return items, flag, true
+}
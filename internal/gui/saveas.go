@@ -0,0 +1,54 @@
+package gui
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/lxn/walk"
+
+	"zip-editor/internal/archive"
+)
+
+// saveAsFormats は「名前を付けて保存」で選択できる形式です（表示名と拡張子の対応）
+var saveAsFormats = []struct {
+	name string
+	ext  string
+}{
+	{"ZIPファイル", ".zip"},
+	{"tarファイル", ".tar"},
+	{"tar.gzファイル", ".tar.gz"},
+	{"tar.bz2ファイル", ".tar.bz2"},
+	{"tar.xzファイル", ".tar.xz"},
+	{"tar.zstファイル", ".tar.zst"},
+}
+
+// promptSaveAs は「名前を付けて保存」の保存先を選択するダイアログを表示します
+// 拡張子が入力されなかった場合は、選択されたファイルの種類の拡張子を付けます
+func promptSaveAs(owner walk.Form, srcPath string) (string, bool) {
+	filters := make([]string, len(saveAsFormats))
+	for i, f := range saveAsFormats {
+		filters[i] = f.name + " (*" + f.ext + ")|*" + f.ext
+	}
+
+	// 元のファイル名から拡張子（.tar.gz などを含む）を除いたものを初期値にする
+	base := archive.TrimExt(filepath.Base(srcPath))
+
+	dlg := &walk.FileDialog{
+		Title:    "名前を付けて保存",
+		Filter:   strings.Join(filters, "|"),
+		FilePath: filepath.Join(filepath.Dir(srcPath), base),
+	}
+	if ok, err := dlg.ShowSave(owner); err != nil || !ok {
+		return "", false
+	}
+
+	dstPath := dlg.FilePath
+	if _, _, ok := archive.FormatFromName(dstPath); !ok {
+		idx := dlg.FilterIndex - 1
+		if idx < 0 || idx >= len(saveAsFormats) {
+			idx = 0
+		}
+		dstPath += saveAsFormats[idx].ext
+	}
+	return dstPath, true
+}
@@ -0,0 +1,286 @@
+package gui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+
+	"zip-editor/internal/archive"
+	"zip-editor/internal/common"
+	"zip-editor/internal/fileops"
+)
+
+// contentSearchAction は内容の検索結果に対して行う操作です
+type contentSearchAction int
+
+const (
+	searchActionShow    contentSearchAction = iota // 右側の一覧に表示する
+	searchActionFlag                               // 削除フラグを付ける
+	searchActionExtract                            // フォルダに展開する
+	searchActionOpen                               // 既定のアプリケーションで開く
+)
+
+// promptContentSearch はアーカイブ内のファイルの内容を検索するダイアログを表示します
+// 一致したファイルと行（前後の行を含む）を表示し、選んだファイル（選んでいない場合は一致したすべてのファイル）と操作を返します
+// 閉じられた場合は ok がfalseになります
+func promptContentSearch(owner walk.Form, title, zipPath string, prompt fileops.PasswordFunc) (paths []string, action contentSearchAction, ok bool) {
+	var dlg *walk.Dialog
+	var patternLE, includeLE *walk.LineEdit
+	var regexpCB, caseCB, binaryCB *walk.CheckBox
+	var contextNE *walk.NumberEdit
+	var searchPB *walk.PushButton
+	var statusLabel *walk.Label
+	var hitsLB *walk.ListBox
+	var detailTE *walk.TextEdit
+
+	var result *archive.SearchResult
+	var cancel chan struct{}
+	running := false
+
+	// stop は実行中の検索を中止します
+	stop := func() {
+		if running && cancel != nil {
+			close(cancel)
+			cancel = nil
+		}
+	}
+
+	// showDetail は選んだファイルの一致した行と前後の行を表示します
+	showDetail := func() {
+		i := hitsLB.CurrentIndex()
+		if result == nil || i < 0 || i >= len(result.Hits) {
+			detailTE.SetText("")
+			return
+		}
+		detailTE.SetText(strings.ReplaceAll(formatSearchHit(result.Hits[i]), "\n", "\r\n"))
+	}
+
+	// selected は選んだファイル（選んでいない場合は一致したすべてのファイル）のパスを返します
+	selected := func() []string {
+		if result == nil {
+			return nil
+		}
+		indexes := hitsLB.SelectedIndexes()
+		if len(indexes) == 0 {
+			for i := range result.Hits {
+				indexes = append(indexes, i)
+			}
+		}
+		var list []string
+		for _, i := range indexes {
+			if i >= 0 && i < len(result.Hits) {
+				list = append(list, result.Hits[i].Path)
+			}
+		}
+		return list
+	}
+
+	finish := func(chosen contentSearchAction) {
+		if paths = selected(); len(paths) == 0 {
+			return
+		}
+		if chosen == searchActionOpen {
+			i := hitsLB.CurrentIndex()
+			if i < 0 || i >= len(result.Hits) {
+				return
+			}
+			paths = []string{result.Hits[i].Path}
+		}
+		action = chosen
+		dlg.Accept()
+	}
+
+	// search は入力した条件で検索を始めます（検索は別のゴルーチンで行い、結果をダイアログに表示します）
+	search := func() {
+		if running {
+			stop()
+			return
+		}
+		matcher, err := common.CompileContentSearch(common.ContentSearchOptions{
+			Pattern:    patternLE.Text(),
+			Regexp:     regexpCB.Checked(),
+			IgnoreCase: !caseCB.Checked(),
+			Context:    int(contextNE.Value()),
+		})
+		if err != nil {
+			walk.MsgBox(dlg, "エラー", err.Error(), walk.MsgBoxIconError)
+			return
+		}
+		opts := archive.SearchOptions{Matcher: matcher, SkipBinary: binaryCB.Checked()}
+		if include := strings.Fields(includeLE.Text()); len(include) > 0 {
+			m, err := common.CompilePatterns(include)
+			if err != nil {
+				walk.MsgBox(dlg, "エラー", err.Error(), walk.MsgBoxIconError)
+				return
+			}
+			opts.Include = m.Match
+		}
+
+		// 進捗は表示が追いつくように間引いて通知する
+		var mu sync.Mutex
+		var last time.Time
+		opts.Progress = func(done, total int) {
+			mu.Lock()
+			defer mu.Unlock()
+			if time.Since(last) < 200*time.Millisecond {
+				return
+			}
+			last = time.Now()
+			dlg.Synchronize(func() {
+				if running && !dlg.IsDisposed() {
+					statusLabel.SetText(fmt.Sprintf("検索中... %d / %d件", done, total))
+				}
+			})
+		}
+		cancel = make(chan struct{})
+		opts.Cancel = cancel
+
+		running = true
+		searchPB.SetText("中止")
+		statusLabel.SetText("検索中...")
+		hitsLB.SetModel([]string{})
+		detailTE.SetText("")
+		go func() {
+			res, err := fileops.SearchContent(zipPath, opts, prompt)
+			dlg.Synchronize(func() {
+				running = false
+				cancel = nil
+				if dlg.IsDisposed() {
+					return
+				}
+				searchPB.SetText("検索")
+				if err != nil && !errors.Is(err, archive.ErrSearchCanceled) {
+					statusLabel.SetText("")
+					walk.MsgBox(dlg, "エラー", "検索できませんでした: "+err.Error(), walk.MsgBoxIconError)
+					return
+				}
+				result = res
+				status := fileops.FormatSearchReport(res)
+				if err != nil {
+					status = err.Error() + "／" + status
+				}
+				statusLabel.SetText(status)
+				items := make([]string, len(res.Hits))
+				for i, hit := range res.Hits {
+					items[i] = fmt.Sprintf("%s（%d行、%s）", hit.Path, len(hit.Matches), hitEncodingText(hit))
+				}
+				hitsLB.SetModel(items)
+			})
+		}()
+	}
+
+	if err := (Dialog{
+		AssignTo: &dlg,
+		Title:    title,
+		MinSize:  Size{Width: 760, Height: 560},
+		Layout:   VBox{},
+		Children: []Widget{
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					Label{Text: "検索する文字列:"},
+					LineEdit{
+						AssignTo: &patternLE,
+						OnKeyDown: func(key walk.Key) {
+							if key == walk.KeyReturn && !running {
+								search()
+							}
+						},
+					},
+					PushButton{AssignTo: &searchPB, Text: "検索", OnClicked: func() { search() }},
+				},
+			},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					CheckBox{AssignTo: &regexpCB, Text: "正規表現"},
+					CheckBox{AssignTo: &caseCB, Text: "大文字・小文字を区別する"},
+					CheckBox{AssignTo: &binaryCB, Text: "バイナリファイルを除く", Checked: true},
+					Label{Text: "前後の行数:"},
+					NumberEdit{AssignTo: &contextNE, Value: 2.0, MinValue: 0, MaxValue: 20, Decimals: 0, MaxSize: Size{Width: 50}},
+					Label{Text: "対象のファイル:"},
+					LineEdit{AssignTo: &includeLE, ToolTipText: "空白で区切ったパターン（例: *.txt *.csv src/）。空の場合はすべてのファイル"},
+				},
+			},
+			Label{AssignTo: &statusLabel},
+			HSplitter{
+				StretchFactor: 1,
+				Children: []Widget{
+					ListBox{
+						AssignTo:              &hitsLB,
+						MultiSelection:        true,
+						OnCurrentIndexChanged: func() { showDetail() },
+						OnItemActivated:       func() { finish(searchActionOpen) },
+					},
+					TextEdit{AssignTo: &detailTE, ReadOnly: true, VScroll: true, HScroll: true},
+				},
+			},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					PushButton{Text: "一覧に表示", OnClicked: func() { finish(searchActionShow) }},
+					PushButton{Text: "削除フラグを付ける", OnClicked: func() { finish(searchActionFlag) }},
+					PushButton{Text: "展開...", OnClicked: func() { finish(searchActionExtract) }},
+					PushButton{Text: "開く", OnClicked: func() { finish(searchActionOpen) }},
+					HSpacer{},
+					PushButton{Text: "閉じる", OnClicked: func() { dlg.Cancel() }},
+				},
+			},
+		},
+	}).Create(owner); err != nil {
+		walk.MsgBox(owner, "エラー", "ダイアログの表示に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		return nil, 0, false
+	}
+	// 閉じる際は実行中の検索を中止する
+	dlg.Closing().Attach(func(canceled *bool, reason walk.CloseReason) { stop() })
+
+	if dlg.Run() != walk.DlgCmdOK {
+		return nil, 0, false
+	}
+	return paths, action, true
+}
+
+// hitEncodingText は一致したファイルの一覧に表示するエンコーディングを返します
+func hitEncodingText(hit archive.SearchHit) string {
+	if hit.Binary {
+		return "バイナリ"
+	}
+	return hit.Encoding
+}
+
+// formatSearchHit は一致した行を行番号付きで表示用の文字列にします
+// 一致した行は "行番号:"、前後の行は "行番号-" で始め、離れた一致の間は "--" で区切ります（grep と同じ）
+func formatSearchHit(hit archive.SearchHit) string {
+	if hit.Binary {
+		return fmt.Sprintf("バイナリファイルの %d 行目が一致しました\n", hit.Matches[0].Line)
+	}
+	var sb strings.Builder
+	prev := 0
+	for _, m := range hit.Matches {
+		first := m.Line
+		if len(m.Before) > 0 {
+			first = m.Before[0].Line
+		}
+		if prev > 0 && first > prev+1 {
+			sb.WriteString("--\n")
+		}
+		for _, l := range m.Before {
+			fmt.Fprintf(&sb, "%6d- %s\n", l.Line, l.Text)
+		}
+		fmt.Fprintf(&sb, "%6d: %s\n", m.Line, m.Text)
+		prev = m.Line
+		for _, l := range m.After {
+			fmt.Fprintf(&sb, "%6d- %s\n", l.Line, l.Text)
+			prev = l.Line
+		}
+	}
+	if hit.Truncated {
+		fmt.Fprintf(&sb, "（一致した行が多いため、先頭の%d件だけを表示しています）\n", common.MaxContentMatches)
+	}
+	return sb.String()
+}
@@ -0,0 +1,83 @@
+package gui
+
+import (
+	"strings"
+
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+
+	"zip-editor/internal/zipfmt"
+)
+
+// volumeSizeChoices はボリュームのサイズの選択肢です（任意のサイズも入力できます）
+var volumeSizeChoices = []string{
+	"分割しない",
+	"10M",
+	"100M",
+	"650M（CD-R）",
+	"700M（CD-R）",
+	"4G（FAT32）",
+}
+
+// promptVolumeSize は分割して保存する際のボリュームのサイズを入力するダイアログを表示します
+// 「分割しない」が選択された場合は負の値を返します。取り消された場合は ok がfalseになります
+func promptVolumeSize(owner walk.Form, title, message string) (size int64, ok bool) {
+	var dlg *walk.Dialog
+	var sizeCB *walk.ComboBox
+	var acceptPB, cancelPB *walk.PushButton
+
+	if _, err := (Dialog{
+		AssignTo:      &dlg,
+		Title:         title,
+		DefaultButton: &acceptPB,
+		CancelButton:  &cancelPB,
+		MinSize:       Size{Width: 360, Height: 150},
+		Layout:        VBox{},
+		Children: []Widget{
+			Label{Text: message},
+			Label{Text: "ボリュームのサイズ（例: 100M、1.5G）:"},
+			ComboBox{AssignTo: &sizeCB, Model: volumeSizeChoices, Editable: true, CurrentIndex: 2},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo: &acceptPB,
+						Text:     "OK",
+						OnClicked: func() {
+							text := sizeCB.Text()
+							if text == volumeSizeChoices[0] {
+								size = -1
+								dlg.Accept()
+								return
+							}
+							// 選択肢の補足（"（CD-R）"など）は取り除く
+							if i := strings.Index(text, "（"); i >= 0 {
+								text = text[:i]
+							}
+							var err error
+							if size, err = zipfmt.ParseVolumeSize(text); err != nil {
+								walk.MsgBox(dlg, "エラー", err.Error(), walk.MsgBoxIconError)
+								return
+							}
+							dlg.Accept()
+						},
+					},
+					PushButton{
+						AssignTo:  &cancelPB,
+						Text:      "キャンセル",
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}).Run(owner); err != nil {
+		walk.MsgBox(owner, "エラー", "ダイアログの表示に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		return 0, false
+	}
+
+	if dlg.Result() != walk.DlgCmdOK {
+		return 0, false
+	}
+	return size, true
+}
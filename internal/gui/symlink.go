@@ -0,0 +1,73 @@
+package gui
+
+import (
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+
+	"zip-editor/internal/fileops"
+)
+
+// symlinkChoices はシンボリックリンクの展開方法の選択肢です（表示名と展開方法の対応）
+var symlinkChoices = []struct {
+	name   string
+	policy fileops.SymlinkPolicy
+}{
+	{"展開しない", fileops.SymlinkSkip},
+	{"シンボリックリンクとして作成する", fileops.SymlinkCreate},
+	{"参照先のファイル・フォルダをコピーする", fileops.SymlinkCopy},
+}
+
+// promptSymlinkPolicy はシンボリックリンクの展開方法を選択するダイアログを表示します
+// 取り消された場合は ok がfalseになります
+func promptSymlinkPolicy(owner walk.Form, title, message string) (policy fileops.SymlinkPolicy, ok bool) {
+	var dlg *walk.Dialog
+	var policyCB *walk.ComboBox
+	var acceptPB, cancelPB *walk.PushButton
+
+	names := make([]string, len(symlinkChoices))
+	for i, c := range symlinkChoices {
+		names[i] = c.name
+	}
+
+	if _, err := (Dialog{
+		AssignTo:      &dlg,
+		Title:         title,
+		DefaultButton: &acceptPB,
+		CancelButton:  &cancelPB,
+		MinSize:       Size{Width: 400, Height: 170},
+		Layout:        VBox{},
+		Children: []Widget{
+			Label{Text: message},
+			ComboBox{AssignTo: &policyCB, Model: names, CurrentIndex: 0},
+			Label{Text: "※ 展開先のフォルダの外を指すリンクは、どの方法でも展開しません。"},
+			Label{Text: "※ Windowsでシンボリックリンクを作成するには、管理者権限か開発者モードが必要です。"},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo: &acceptPB,
+						Text:     "OK",
+						OnClicked: func() {
+							policy = symlinkChoices[max(policyCB.CurrentIndex(), 0)].policy
+							dlg.Accept()
+						},
+					},
+					PushButton{
+						AssignTo:  &cancelPB,
+						Text:      "キャンセル",
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}).Run(owner); err != nil {
+		walk.MsgBox(owner, "エラー", "ダイアログの表示に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		return fileops.SymlinkSkip, false
+	}
+
+	if dlg.Result() != walk.DlgCmdOK {
+		return fileops.SymlinkSkip, false
+	}
+	return policy, true
+}
@@ -0,0 +1,107 @@
+package gui
+
+import (
+	"time"
+
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+
+	"zip-editor/internal/zipfmt"
+)
+
+// timeModeChoices は日時の変更方法の選択肢です（表示名と変更方法の対応）
+var timeModeChoices = []struct {
+	name string
+	mode zipfmt.TimeMode
+}{
+	{"指定した日時にする", zipfmt.TimeFixed},
+	{"現在の日時にする", zipfmt.TimeNow},
+	{"指定した時間だけずらす", zipfmt.TimeShift},
+	{"フォルダを中の最も新しいファイルの日時にする", zipfmt.TimeNewestChild},
+}
+
+// promptTimestamp は更新日時の変更方法を選択するダイアログを表示します
+// 取り消された場合は ok がfalseになります
+func promptTimestamp(owner walk.Form, title, message string, initial time.Time) (edit zipfmt.TimeEdit, ok bool) {
+	var dlg *walk.Dialog
+	var modeCB *walk.ComboBox
+	var dateDE *walk.DateEdit
+	var offsetLE *walk.LineEdit
+	var acceptPB, cancelPB *walk.PushButton
+
+	names := make([]string, len(timeModeChoices))
+	for i, c := range timeModeChoices {
+		names[i] = c.name
+	}
+	if initial.IsZero() {
+		initial = time.Now()
+	}
+
+	// 選択した変更方法で使う入力欄だけを有効にする
+	updateEnabled := func() {
+		mode := timeModeChoices[max(modeCB.CurrentIndex(), 0)].mode
+		dateDE.SetEnabled(mode == zipfmt.TimeFixed)
+		offsetLE.SetEnabled(mode == zipfmt.TimeShift)
+	}
+
+	if _, err := (Dialog{
+		AssignTo:      &dlg,
+		Title:         title,
+		DefaultButton: &acceptPB,
+		CancelButton:  &cancelPB,
+		MinSize:       Size{Width: 400, Height: 220},
+		Layout:        VBox{},
+		Children: []Widget{
+			Label{Text: message},
+			ComboBox{
+				AssignTo:              &modeCB,
+				Model:                 names,
+				CurrentIndex:          0,
+				OnCurrentIndexChanged: func() { updateEnabled() },
+			},
+			Label{Text: "日時:"},
+			DateEdit{AssignTo: &dateDE, Format: "yyyy/MM/dd HH:mm:ss", Date: initial},
+			Label{Text: "ずらす時間（例: +9h、-1d、30m）:"},
+			LineEdit{AssignTo: &offsetLE, Text: "+0h", Enabled: false},
+			Label{Text: "※ MS-DOS形式の日時と、拡張タイムスタンプ・NTFSのタイムスタンプをまとめて変更します。"},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo: &acceptPB,
+						Text:     "OK",
+						OnClicked: func() {
+							edit.Mode = timeModeChoices[max(modeCB.CurrentIndex(), 0)].mode
+							switch edit.Mode {
+							case zipfmt.TimeFixed:
+								edit.Time = dateDE.Date()
+							case zipfmt.TimeShift:
+								offset, err := zipfmt.ParseTimeOffset(offsetLE.Text())
+								if err != nil {
+									walk.MsgBox(dlg, "エラー", err.Error(), walk.MsgBoxIconError)
+									return
+								}
+								edit.Offset = offset
+							}
+							dlg.Accept()
+						},
+					},
+					PushButton{
+						AssignTo:  &cancelPB,
+						Text:      "キャンセル",
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}).Run(owner); err != nil {
+		walk.MsgBox(owner, "エラー", "ダイアログの表示に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+		return zipfmt.TimeEdit{}, false
+	}
+
+	if dlg.Result() != walk.DlgCmdOK {
+		return zipfmt.TimeEdit{}, false
+	}
+	return edit, true
+}
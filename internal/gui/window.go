@@ -1,15 +1,21 @@
 package gui
 
 import (
+	"archive/zip"
+	"fmt"
 	"log"
 	"os/exec"
 	"path/filepath"
+	"strings"
 
 	"github.com/lxn/walk"
 	. "github.com/lxn/walk/declarative"
 
+	"zip-editor/internal/archive"
+	"zip-editor/internal/common"
 	"zip-editor/internal/fileops"
 	"zip-editor/internal/model"
+	"zip-editor/internal/zipfmt"
 )
 
 // CreateMainWindow はメインウィンドウを作成し、表示します
@@ -42,7 +48,7 @@ func CreateMainWindow() {
 			fileops.UpdateDeleteFlagRecursively(currentZipPath, zipItem)
 
 			// 現在表示中のファイル一覧を更新
-			fileops.UpdateFileList(tableView, zipItem)
+			updateFileList(tableView, zipItem)
 		}
 	})
 	treeContextMenu.Actions().Add(deleteAction)
@@ -59,11 +65,51 @@ func CreateMainWindow() {
 			fileops.UpdateDeleteFlagRecursively(currentZipPath, zipItem)
 
 			// 現在表示中のファイル一覧を更新
-			fileops.UpdateFileList(tableView, zipItem)
+			updateFileList(tableView, zipItem)
 		}
 	})
 	treeContextMenu.Actions().Add(clearAction)
 
+	// パターン選択メニュー項目を追加
+	patternAction := walk.NewAction()
+	patternAction.SetText("パターンで選択...")
+	patternAction.Triggered().Attach(func() {
+		if zipModel == nil || currentZipPath == "" {
+			return
+		}
+		items, flag, ok := promptPatternSelect(mw, "パターンで選択", zipModel)
+		if !ok {
+			return
+		}
+		fileops.SetDeleteFlags(currentZipPath, items, flag)
+
+		// 現在表示中のファイル一覧を更新
+		if zipItem, ok := tv.CurrentItem().(*model.ZipTreeItem); ok {
+			updateFileList(tableView, zipItem)
+		}
+	})
+	treeContextMenu.Actions().Add(patternAction)
+
+	// 不要なファイル（macOS・Windowsが作成するファイルなど）を選択するメニュー項目を追加
+	cleanAction := walk.NewAction()
+	cleanAction.SetText("不要なファイルを選択...")
+	cleanAction.Triggered().Attach(func() {
+		if zipModel == nil || currentZipPath == "" {
+			return
+		}
+		items, ok := promptCleanProfiles(mw, "不要なファイルを選択", zipModel)
+		if !ok {
+			return
+		}
+		fileops.SetDeleteFlags(currentZipPath, items, true)
+
+		// 現在表示中のファイル一覧を更新
+		if zipItem, ok := tv.CurrentItem().(*model.ZipTreeItem); ok {
+			updateFileList(tableView, zipItem)
+		}
+	})
+	treeContextMenu.Actions().Add(cleanAction)
+
 	// 左ペインのモデル（ZIPファイル一覧）
 	fileListModel := model.NewFileListModel()
 	// 左ペインの前回選択インデックス
@@ -81,15 +127,641 @@ func CreateMainWindow() {
          expandRec = func(item *model.ZipTreeItem) {
              // 該当ノードを展開
              _ = tv.SetExpanded(item, true)
-             // 子ディレクトリを再帰的に展開
+             // 子ディレクトリを再帰的に展開（入れ子のアーカイブはすべてを開くと遅いため展開しない）
              for _, ch := range item.GetChildren() {
-                 expandRec(ch)
+                 if !ch.IsArchive() {
+                     expandRec(ch)
+                 }
              }
          }
          expandRec(rootItem)
      }
  }
 
+	// 破損したZIPファイルを修復し、保存先を左ペインに追加するヘルパー関数
+	repairZipFile := func(path string) {
+		dlg := &walk.FileDialog{
+			Title:    "修復したZIPファイルの保存先",
+			Filter:   "ZIPファイル (*.zip)|*.zip",
+			FilePath: strings.TrimSuffix(path, filepath.Ext(path)) + "_repaired.zip",
+		}
+		if ok, err := dlg.ShowSave(mw); err != nil || !ok {
+			return
+		}
+
+		result, err := fileops.RepairZipFile(path, dlg.FilePath)
+		if err != nil {
+			msg := "ZIPファイルの修復に失敗しました: " + err.Error()
+			if result != nil {
+				msg += "\n\n" + fileops.FormatRepairReport(result)
+			}
+			walk.MsgBox(mw, "エラー", msg, walk.MsgBoxIconError)
+			return
+		}
+
+		walk.MsgBox(mw, "修復結果", fileops.FormatRepairReport(result), walk.MsgBoxIconInformation)
+		fileListModel.AddPath(dlg.FilePath)
+	}
+
+	// ZIPファイルを非同期で書き直し、完了後に再読み込みするヘルパー関数
+	// save には実際の書き直し処理を渡します（戻り値の文字列が空でなければ完了時に表示します）
+	saveZipAsync := func(targetZip, failMessage string, save func() (string, error)) {
+		// 左ペインに削除中を表示
+		fileListModel.SetDeleting(targetZip, true)
+		// 非同期処理開始（並列可）
+		go func() {
+			report, err := save()
+			// UIスレッドで更新
+			mw.Synchronize(func() {
+				// 状態解除
+				fileListModel.SetDeleting(targetZip, false)
+				if err != nil {
+					walk.MsgBox(mw, "エラー", failMessage+err.Error(), walk.MsgBoxIconError)
+					return
+				}
+				// 成功時は結果の報告がある場合だけダイアログを表示する
+				if report != "" {
+					walk.MsgBox(mw, "完了 - "+filepath.Base(targetZip), report, walk.MsgBoxIconInformation)
+				}
+				// 現在選択中が対象ZIPなら再読み込み
+				if currentZipPath == targetZip {
+					var loadErr error
+					zipModel, loadErr = model.LoadArchive(targetZip)
+					if loadErr != nil {
+						walk.MsgBox(mw, "エラー", "ZIPファイルの再読み込みに失敗しました: "+loadErr.Error(), walk.MsgBoxIconError)
+						return
+					}
+					tv.SetModel(zipModel)
+					// ZIP 再読み込み時もツリーを全展開
+					expandAllTree()
+				}
+			})
+		}()
+	}
+
+	// 暗号化されたファイルのパスワード入力を求めるコールバック（UIスレッドから呼び出す）
+	passwordPrompt := func(zipPath, entryPath string, retry bool) (string, bool) {
+		msg := entryPath + " のパスワードを入力してください:"
+		if retry {
+			msg = "パスワードが正しくありません。\n" + msg
+		}
+		return promptPassword(mw, "パスワード - "+filepath.Base(zipPath), msg)
+	}
+
+	// 非同期処理から呼び出すパスワード入力コールバック（UIスレッドで入力を求め、結果を待つ）
+	asyncPasswordPrompt := func(zipPath, entryPath string, retry bool) (string, bool) {
+		type answer struct {
+			password string
+			ok       bool
+		}
+		ch := make(chan answer, 1)
+		mw.Synchronize(func() {
+			password, ok := passwordPrompt(zipPath, entryPath, retry)
+			ch <- answer{password, ok}
+		})
+		a := <-ch
+		return a.password, a.ok
+	}
+
+	// ZIPファイル内のファイルを一時フォルダに展開し、既定のアプリケーションで開くヘルパー関数
+	openEntryFile := func(entryPath string) {
+		// 一時フォルダに展開
+		extractedPath, err := fileops.ExtractFileToTemp(currentZipPath, entryPath, passwordPrompt)
+		if err != nil {
+			walk.MsgBox(mw, "エラー", "ファイルの展開に失敗しました: "+err.Error(), walk.MsgBoxIconError)
+			return
+		}
+
+		// 既定のアプリケーションで開く（Windowsの関連付け）
+		// cmd /C start "" <path>
+		cmd := exec.Command("cmd", "/C", "start", "", extractedPath)
+		if err := cmd.Start(); err != nil {
+			walk.MsgBox(mw, "エラー", "ファイルを開けませんでした: "+err.Error(), walk.MsgBoxIconError)
+			return
+		}
+	}
+
+	// エントリの更新日時を変更するヘルパー関数
+	// target は操作の対象として表示するアイテム、items は変更するアイテム（nilの場合はZIPファイル全体）です
+	setTimestamps := func(target *model.ZipTreeItem, items []*model.ZipTreeItem) {
+		// 入れ子のアーカイブの中は削除のみ対応
+		if target.IsNested() || target.IsArchive() {
+			walk.MsgBox(mw, "情報", "入れ子のアーカイブの中に対しては、この操作を行えません。", walk.MsgBoxIconInformation)
+			return
+		}
+		if zipModel.GetFormat() != archive.FormatZip {
+			walk.MsgBox(mw, "情報", "日時を変更できるのはZIPファイルだけです。", walk.MsgBoxIconInformation)
+			return
+		}
+		// すでに削除中なら実行しない
+		if fileListModel.IsDeleting(currentZipPath) {
+			walk.MsgBox(mw, "情報", "現在選択中のZIPは削除処理中です。完了までお待ちください。", walk.MsgBoxIconInformation)
+			return
+		}
+		edit, ok := promptTimestamp(mw, "日時を変更", target.GetName()+" の更新日時を変更します。", target.GetDate())
+		if !ok {
+			return
+		}
+		opts := fileops.TimestampOptions{Edit: edit, Items: items}
+		targetZip := currentZipPath
+		saveZipAsync(targetZip, "日時の変更に失敗しました: ", func() (string, error) {
+			result, err := fileops.SetTimestamps(targetZip, opts)
+			if err != nil {
+				return "", err
+			}
+			return fileops.FormatTimestampReport(result), nil
+		})
+	}
+
+	// エントリの属性を変更するヘルパー関数
+	// target は操作の対象として表示するアイテム、items は変更するアイテム（nilの場合はZIPファイル全体）です
+	setAttributes := func(target *model.ZipTreeItem, items []*model.ZipTreeItem) {
+		// 入れ子のアーカイブの中は削除のみ対応
+		if target.IsNested() || target.IsArchive() {
+			walk.MsgBox(mw, "情報", "入れ子のアーカイブの中に対しては、この操作を行えません。", walk.MsgBoxIconInformation)
+			return
+		}
+		if zipModel.GetFormat() != archive.FormatZip {
+			walk.MsgBox(mw, "情報", "属性を変更できるのはZIPファイルだけです。", walk.MsgBoxIconInformation)
+			return
+		}
+		// すでに削除中なら実行しない
+		if fileListModel.IsDeleting(currentZipPath) {
+			walk.MsgBox(mw, "情報", "現在選択中のZIPは削除処理中です。完了までお待ちください。", walk.MsgBoxIconInformation)
+			return
+		}
+		message := target.GetName() + " の属性を変更します。"
+		if target.IsDir() {
+			message = target.GetName() + " の中のすべてのエントリの属性を変更します。"
+		}
+		edit, ok := promptAttributes(mw, "属性を変更", message, target.AttributeText())
+		if !ok {
+			return
+		}
+		opts := fileops.AttrOptions{Edit: edit, Items: items}
+		targetZip := currentZipPath
+		saveZipAsync(targetZip, "属性の変更に失敗しました: ", func() (string, error) {
+			result, err := fileops.SetAttributes(targetZip, opts)
+			if err != nil {
+				return "", err
+			}
+			return fileops.FormatAttrReport(result, edit), nil
+		})
+	}
+
+	// ファイル追加メニュー項目を追加
+	addAction := walk.NewAction()
+	addAction.SetText("ファイルを追加...")
+	addAction.Triggered().Attach(func() {
+		// 現在選択されているフォルダに追加する
+		zipItem, ok := tv.CurrentItem().(*model.ZipTreeItem)
+		if !ok || !zipItem.IsDir() || currentZipPath == "" {
+			return
+		}
+		// 入れ子のアーカイブの中は削除のみ対応
+		if zipItem.IsNested() || zipItem.IsArchive() {
+			walk.MsgBox(mw, "情報", "入れ子のアーカイブの中に対しては、この操作を行えません。", walk.MsgBoxIconInformation)
+			return
+		}
+		// すでに削除中なら実行しない
+		if fileListModel.IsDeleting(currentZipPath) {
+			walk.MsgBox(mw, "情報", "現在選択中のZIPは削除処理中です。完了までお待ちください。", walk.MsgBoxIconInformation)
+			return
+		}
+		dlg := &walk.FileDialog{Title: "追加するファイル"}
+		if ok, err := dlg.ShowOpenMultiple(mw); err != nil || !ok {
+			return
+		}
+		method, level, ok := promptCompression(mw, "ファイルを追加", "追加するファイルの圧縮方式を選択してください。")
+		if !ok {
+			return
+		}
+		targetZip := currentZipPath
+		dirPath := zipItem.GetPath()
+		paths := dlg.FilePaths
+		saveZipAsync(targetZip, "ファイルの追加に失敗しました: ", func() (string, error) {
+			return "", fileops.AddFiles(targetZip, dirPath, paths, fileops.AddOptions{Method: method, Level: level})
+		})
+	})
+	treeContextMenu.Actions().Add(addAction)
+
+	// 再圧縮メニュー項目を追加
+	recompressAction := walk.NewAction()
+	recompressAction.SetText("再圧縮...")
+	recompressAction.Triggered().Attach(func() {
+		// 選択されているフォルダ以下を再圧縮する（ルートの場合はZIPファイル全体）
+		zipItem, ok := tv.CurrentItem().(*model.ZipTreeItem)
+		if !ok || !zipItem.IsDir() || currentZipPath == "" {
+			return
+		}
+		// 入れ子のアーカイブの中は削除のみ対応
+		if zipItem.IsNested() || zipItem.IsArchive() {
+			walk.MsgBox(mw, "情報", "入れ子のアーカイブの中に対しては、この操作を行えません。", walk.MsgBoxIconInformation)
+			return
+		}
+		// すでに削除中なら実行しない
+		if fileListModel.IsDeleting(currentZipPath) {
+			walk.MsgBox(mw, "情報", "現在選択中のZIPは削除処理中です。完了までお待ちください。", walk.MsgBoxIconInformation)
+			return
+		}
+		method, level, ok := promptCompression(mw, "再圧縮", zipItem.GetName()+" 以下のファイルを再圧縮します。\n（元より小さくなったファイルだけを置き換えます）")
+		if !ok {
+			return
+		}
+		opts := fileops.RecompressOptions{Method: method, Level: level}
+		if zipItem.GetPath() != "" {
+			opts.Items = []*model.ZipTreeItem{zipItem}
+		}
+		targetZip := currentZipPath
+		saveZipAsync(targetZip, "再圧縮に失敗しました: ", func() (string, error) {
+			result, err := fileops.RecompressZipFile(targetZip, opts)
+			if err != nil {
+				return "", err
+			}
+			return fileops.FormatRecompressReport(result), nil
+		})
+	})
+	treeContextMenu.Actions().Add(recompressAction)
+
+	// 日時変更メニュー項目を追加
+	timestampAction := walk.NewAction()
+	timestampAction.SetText("日時を変更...")
+	timestampAction.Triggered().Attach(func() {
+		// 選択されているフォルダ以下の日時を変更する（ルートの場合はZIPファイル全体）
+		zipItem, ok := tv.CurrentItem().(*model.ZipTreeItem)
+		if !ok || !zipItem.IsDir() || currentZipPath == "" {
+			return
+		}
+		var items []*model.ZipTreeItem
+		if zipItem.GetPath() != "" {
+			items = []*model.ZipTreeItem{zipItem}
+		}
+		setTimestamps(zipItem, items)
+	})
+	treeContextMenu.Actions().Add(timestampAction)
+
+	// 属性変更メニュー項目を追加
+	attrAction := walk.NewAction()
+	attrAction.SetText("属性を変更...")
+	attrAction.Triggered().Attach(func() {
+		// 選択されているフォルダ以下の属性をまとめて変更する（ルートの場合はZIPファイル全体）
+		zipItem, ok := tv.CurrentItem().(*model.ZipTreeItem)
+		if !ok || !zipItem.IsDir() || currentZipPath == "" {
+			return
+		}
+		var items []*model.ZipTreeItem
+		if zipItem.GetPath() != "" {
+			items = []*model.ZipTreeItem{zipItem}
+		}
+		setAttributes(zipItem, items)
+	})
+	treeContextMenu.Actions().Add(attrAction)
+
+	// フォルダ展開メニュー項目を追加
+	extractAction := walk.NewAction()
+	extractAction.SetText("フォルダを展開...")
+	extractAction.Triggered().Attach(func() {
+		// 選択されているフォルダ以下を展開する（ルートの場合はアーカイブ全体）
+		zipItem, ok := tv.CurrentItem().(*model.ZipTreeItem)
+		if !ok || !zipItem.IsDir() || currentZipPath == "" {
+			return
+		}
+		// 入れ子のアーカイブの中は削除のみ対応
+		if zipItem.IsNested() || zipItem.IsArchive() {
+			walk.MsgBox(mw, "情報", "入れ子のアーカイブの中に対しては、この操作を行えません。", walk.MsgBoxIconInformation)
+			return
+		}
+		dlg := &walk.FileDialog{Title: zipItem.GetName() + " の展開先のフォルダ"}
+		if ok, err := dlg.ShowBrowseFolder(mw); err != nil || !ok {
+			return
+		}
+		// シンボリックリンクがある場合は展開方法を選ぶ
+		symlinks := fileops.SymlinkSkip
+		if zipItem.HasSymlinks() {
+			policy, ok := promptSymlinkPolicy(mw, "シンボリックリンクの展開", zipItem.GetName()+" にはシンボリックリンクが含まれています。展開方法を選択してください。")
+			if !ok {
+				return
+			}
+			symlinks = policy
+		}
+		// 展開は時間がかかる場合があるため非同期で行う（7z・RARのソリッド圧縮は先頭から順に展開する）
+		targetZip := currentZipPath
+		dirPath := zipItem.GetPath()
+		dstDir := dlg.FilePath
+		go func() {
+			result, err := fileops.ExtractFolder(targetZip, dirPath, dstDir, symlinks, asyncPasswordPrompt)
+			mw.Synchronize(func() {
+				if err != nil {
+					msg := "フォルダの展開に失敗しました: " + err.Error()
+					if result != nil {
+						msg += "\n\n" + fileops.FormatExtractReport(result)
+					}
+					walk.MsgBox(mw, "エラー", msg, walk.MsgBoxIconError)
+					return
+				}
+				icon := walk.MsgBoxIconInformation
+				if len(result.Skipped) > 0 {
+					icon = walk.MsgBoxIconWarning
+				}
+				walk.MsgBox(mw, "展開結果 - "+filepath.Base(targetZip), fileops.FormatExtractReport(result), icon)
+			})
+		}()
+	})
+	treeContextMenu.Actions().Add(extractAction)
+
+	// ファイル一覧用のコンテキストメニューを作成
+	fileContextMenu, err := walk.NewMenu()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// コメント編集メニュー項目を追加
+	commentAction := walk.NewAction()
+	commentAction.SetText("コメントを編集...")
+	commentAction.Triggered().Attach(func() {
+		itemModel, ok := tableView.Model().(*model.FileItemModel)
+		row := tableView.CurrentIndex()
+		if !ok || row < 0 || row >= len(itemModel.Items) || currentZipPath == "" {
+			return
+		}
+		fileItem := itemModel.Items[row]
+		if zipModel.GetFormat() != archive.FormatZip {
+			walk.MsgBox(mw, "情報", "コメントを編集できるのはZIPファイルだけです。", walk.MsgBoxIconInformation)
+			return
+		}
+		// 入れ子のアーカイブの中は削除のみ対応
+		if fileItem.IsNested() {
+			walk.MsgBox(mw, "情報", "入れ子のアーカイブの中に対しては、この操作を行えません。", walk.MsgBoxIconInformation)
+			return
+		}
+		text, enc, ok := promptComment(mw, "コメント - "+fileItem.GetName(), fileItem.GetPath()+" のコメント:", fileItem.GetComment())
+		if !ok {
+			return
+		}
+		if err := fileops.SetEntryComment(currentZipPath, fileItem.GetPath(), text, enc); err != nil {
+			walk.MsgBox(mw, "エラー", "コメントを変更できません: "+err.Error(), walk.MsgBoxIconError)
+			return
+		}
+		fileItem.SetComment(text)
+		tableView.SetModel(itemModel)
+	})
+	fileContextMenu.Actions().Add(commentAction)
+
+	// ファイルの日時変更メニュー項目を追加
+	fileTimestampAction := walk.NewAction()
+	fileTimestampAction.SetText("日時を変更...")
+	fileTimestampAction.Triggered().Attach(func() {
+		itemModel, ok := tableView.Model().(*model.FileItemModel)
+		row := tableView.CurrentIndex()
+		if !ok || row < 0 || row >= len(itemModel.Items) || currentZipPath == "" {
+			return
+		}
+		fileItem := itemModel.Items[row]
+		setTimestamps(fileItem, []*model.ZipTreeItem{fileItem})
+	})
+	fileContextMenu.Actions().Add(fileTimestampAction)
+
+	// ファイルの属性変更メニュー項目を追加
+	fileAttrAction := walk.NewAction()
+	fileAttrAction.SetText("属性を変更...")
+	fileAttrAction.Triggered().Attach(func() {
+		itemModel, ok := tableView.Model().(*model.FileItemModel)
+		row := tableView.CurrentIndex()
+		if !ok || row < 0 || row >= len(itemModel.Items) || currentZipPath == "" {
+			return
+		}
+		fileItem := itemModel.Items[row]
+		setAttributes(fileItem, []*model.ZipTreeItem{fileItem})
+	})
+	fileContextMenu.Actions().Add(fileAttrAction)
+
+	// 検索ボックスと、検索式に一致したアイテムの件数の表示
+	var searchLE *walk.LineEdit
+	var searchLabel *walk.Label
+	// 検索式に一致したアイテム（右側の一覧に表示中のもの）
+	var searchResults []*model.ZipTreeItem
+	// 内容から判定したMIMEタイプ（検索式で mime を使った場合に、読み込んだZIPファイルごとに一度だけ判定する）
+	var mimeTypes map[string]string
+	var mimeModel *model.ZipTreeModel
+
+	// 検索式に一致するファイル・フォルダを探し、右側の一覧に表示するヘルパー関数
+	// 検索式が空の場合は、ツリーで選択しているフォルダの一覧に戻します。一致したアイテムを表示した場合は true を返します
+	runSearch := func() bool {
+		if zipModel == nil || currentZipPath == "" {
+			return false
+		}
+		text := strings.TrimSpace(searchLE.Text())
+		if text == "" {
+			searchResults = nil
+			searchLabel.SetText("")
+			if zipItem, ok := tv.CurrentItem().(*model.ZipTreeItem); ok {
+				updateFileList(tableView, zipItem)
+			}
+			return false
+		}
+		query, err := common.ParseQuery(text)
+		if err != nil {
+			walk.MsgBox(mw, "エラー", err.Error(), walk.MsgBoxIconError)
+			return false
+		}
+		if query.UsesField("mime") && mimeModel != zipModel {
+			types, err := archive.ReadMIMETypes(currentZipPath, zipModel.GetFormat())
+			if err != nil {
+				walk.MsgBox(mw, "エラー", "MIMEタイプを判定できません: "+err.Error(), walk.MsgBoxIconError)
+				return false
+			}
+			mimeTypes, mimeModel = types, zipModel
+		}
+
+		// ツリーで展開していない入れ子のアーカイブの中も検索する
+		zipModel.LoadAllNested()
+		searchResults = zipModel.FilterItems(func(item *model.ZipTreeItem) bool {
+			var mime func() string
+			if t, ok := mimeTypes[item.GetPath()]; ok && mimeModel == zipModel {
+				mime = func() string { return t }
+			}
+			return query.Match(item.QueryEntry(mime))
+		})
+		tableView.SetModel(&model.FileItemModel{Items: searchResults, ShowPath: true})
+		searchLabel.SetText(fmt.Sprintf("%d件", len(searchResults)))
+		return true
+	}
+
+	// 検索式に一致したアイテムの削除フラグを変更するヘルパー関数
+	flagSearchResults := func(flag bool) {
+		if !runSearch() {
+			return
+		}
+		fileops.SetDeleteFlags(currentZipPath, searchResults, flag)
+		tableView.SetModel(&model.FileItemModel{Items: searchResults, ShowPath: true})
+	}
+
+	// ファイルの内容を検索するメニュー項目を追加
+	contentSearchAction := walk.NewAction()
+	contentSearchAction.SetText("内容を検索...")
+	contentSearchAction.Triggered().Attach(func() {
+		if zipModel == nil || currentZipPath == "" {
+			return
+		}
+		targetZip := currentZipPath
+		paths, action, ok := promptContentSearch(mw, "内容を検索 - "+filepath.Base(targetZip), targetZip, asyncPasswordPrompt)
+		if !ok || targetZip != currentZipPath {
+			return
+		}
+		found := make(map[string]bool, len(paths))
+		for _, p := range paths {
+			found[p] = true
+		}
+		zipModel.LoadNestedPaths(paths)
+		items := zipModel.FindItems(func(path string) bool { return found[path] })
+
+		switch action {
+		case searchActionShow, searchActionFlag:
+			if action == searchActionFlag {
+				fileops.SetDeleteFlags(targetZip, items, true)
+			}
+			searchResults = items
+			tableView.SetModel(&model.FileItemModel{Items: items, ShowPath: true})
+			searchLabel.SetText(fmt.Sprintf("内容の検索: %d件", len(items)))
+		case searchActionOpen:
+			openEntryFile(paths[0])
+		case searchActionExtract:
+			dlg := &walk.FileDialog{Title: "一致したファイルの展開先のフォルダ"}
+			if ok, err := dlg.ShowBrowseFolder(mw); err != nil || !ok {
+				return
+			}
+			dstDir := dlg.FilePath
+			go func() {
+				result, err := fileops.ExtractFiles(targetZip, paths, dstDir, asyncPasswordPrompt)
+				mw.Synchronize(func() {
+					if err != nil {
+						msg := "ファイルの展開に失敗しました: " + err.Error()
+						if result != nil {
+							msg += "\n\n" + fileops.FormatExtractReport(result)
+						}
+						walk.MsgBox(mw, "エラー", msg, walk.MsgBoxIconError)
+						return
+					}
+					icon := walk.MsgBoxIconInformation
+					if len(result.Skipped) > 0 {
+						icon = walk.MsgBoxIconWarning
+					}
+					walk.MsgBox(mw, "展開結果 - "+filepath.Base(targetZip), fileops.FormatExtractReport(result), icon)
+				})
+			}()
+		}
+	})
+	treeContextMenu.Actions().Add(contentSearchAction)
+
+	// 同じ内容のファイルを探し、残すもの以外に削除フラグを付けるメニュー項目を追加
+	duplicatesAction := walk.NewAction()
+	duplicatesAction.SetText("同じ内容のファイルを探す...")
+	duplicatesAction.Triggered().Attach(func() {
+		if zipModel == nil || currentZipPath == "" {
+			return
+		}
+		targetZip := currentZipPath
+		choice, ok := promptDuplicates(mw, "同じ内容のファイル - "+filepath.Base(targetZip), targetZip, fileListModel.Paths(), asyncPasswordPrompt)
+		if !ok {
+			return
+		}
+		// 削除中のアーカイブには削除フラグを付けない
+		for archivePath := range choice.result.Redundant(choice.keep, choice.perArchive) {
+			if fileListModel.IsDeleting(archivePath) {
+				walk.MsgBox(mw, "情報", filepath.Base(archivePath)+" は削除処理中です。完了までお待ちください。", walk.MsgBoxIconInformation)
+				return
+			}
+		}
+		flagged := fileops.FlagDuplicates(choice.result, choice.keep, choice.perArchive)
+
+		// 表示中のアーカイブで削除フラグを付けたファイルを右側の一覧に表示
+		if paths, ok := flagged[currentZipPath]; ok && targetZip == currentZipPath {
+			found := make(map[string]bool, len(paths))
+			for _, p := range paths {
+				found[p] = true
+			}
+			fileops.ApplyDeleteFlags(currentZipPath, zipModel)
+			zipModel.LoadNestedPaths(paths)
+			searchResults = zipModel.FindItems(func(path string) bool { return found[path] })
+			tableView.SetModel(&model.FileItemModel{Items: searchResults, ShowPath: true})
+			searchLabel.SetText(fmt.Sprintf("重複: %d件", len(searchResults)))
+		}
+
+		var sb strings.Builder
+		sb.WriteString("次のファイルに削除フラグを付けました。アーカイブを選んで「削除」ボタンを押すと反映されます。\n")
+		for _, archivePath := range fileListModel.Paths() {
+			if paths, ok := flagged[archivePath]; ok {
+				fmt.Fprintf(&sb, "\n%s: %d件", filepath.Base(archivePath), len(paths))
+			}
+		}
+		if len(flagged) == 0 {
+			sb.Reset()
+			sb.WriteString("削除フラグを付けられるファイルはありませんでした（7z・RARのアーカイブは変更できません）。")
+		}
+		walk.MsgBox(mw, "同じ内容のファイル", sb.String(), walk.MsgBoxIconInformation)
+	})
+	treeContextMenu.Actions().Add(duplicatesAction)
+
+	// 表示中のアーカイブをほかのアーカイブと比較するメニュー項目を追加
+	diffAction := walk.NewAction()
+	diffAction.SetText("ほかのアーカイブと比較...")
+	diffAction.Triggered().Attach(func() {
+		if zipModel == nil || currentZipPath == "" {
+			return
+		}
+		var others []string
+		for _, p := range fileListModel.Paths() {
+			if p != currentZipPath {
+				others = append(others, p)
+			}
+		}
+		promptArchiveDiff(mw, "アーカイブの比較 - "+filepath.Base(currentZipPath), currentZipPath, others, asyncPasswordPrompt)
+	})
+	treeContextMenu.Actions().Add(diffAction)
+
+	// 表示中のアーカイブにパッチを適用するメニュー項目を追加
+	applyPatchAction := walk.NewAction()
+	applyPatchAction.SetText("パッチを適用...")
+	applyPatchAction.Triggered().Attach(func() {
+		if zipModel == nil || currentZipPath == "" {
+			return
+		}
+		// すでに削除中なら実行しない
+		if fileListModel.IsDeleting(currentZipPath) {
+			walk.MsgBox(mw, "情報", "現在選択中のZIPは削除処理中です。完了までお待ちください。", walk.MsgBoxIconInformation)
+			return
+		}
+		patchDlg := &walk.FileDialog{
+			Title:  "適用するパッチ",
+			Filter: "パッチ (*.zpatch)|*.zpatch|すべてのファイル (*.*)|*.*",
+		}
+		if ok, err := patchDlg.ShowOpen(mw); err != nil || !ok {
+			return
+		}
+		// 保存先に表示中のアーカイブを指定した場合は置き換える
+		outDlg := &walk.FileDialog{
+			Title:    "新しい版の保存先",
+			Filter:   "すべてのファイル (*.*)|*.*",
+			FilePath: currentZipPath,
+		}
+		if ok, err := outDlg.ShowSave(mw); err != nil || !ok {
+			return
+		}
+		targetZip, patchPath, outPath := currentZipPath, patchDlg.FilePath, outDlg.FilePath
+		saveZipAsync(targetZip, "パッチを適用できませんでした: ", func() (string, error) {
+			report, err := fileops.ApplyPatch(targetZip, patchPath, outPath)
+			if err != nil {
+				return "", err
+			}
+			if !strings.EqualFold(outPath, targetZip) {
+				// 作成したアーカイブを左ペインに追加する
+				mw.Synchronize(func() { fileListModel.AddPath(outPath) })
+			}
+			return report, nil
+		})
+	})
+	treeContextMenu.Actions().Add(applyPatchAction)
+
  // メインウィンドウを設定
  if err := (MainWindow{
      AssignTo: &mw,
@@ -97,6 +769,26 @@ func CreateMainWindow() {
      MinSize:  Size{Width: 700, Height: 400},
      Layout:   VBox{},
 		Children: []Widget{
+			// 検索ボックス
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					Label{Text: "検索:"},
+					LineEdit{
+						AssignTo:    &searchLE,
+						ToolTipText: "例: size > 50MB and date < 2020、method = store、encrypted、mime ~ image/*、*.log",
+						OnKeyDown: func(key walk.Key) {
+							if key == walk.KeyReturn {
+								runSearch()
+							}
+						},
+					},
+					PushButton{Text: "検索", OnClicked: func() { runSearch() }},
+					PushButton{Text: "一致したものに削除フラグ", OnClicked: func() { flagSearchResults(true) }},
+					PushButton{Text: "削除フラグを外す", OnClicked: func() { flagSearchResults(false) }},
+					Label{AssignTo: &searchLabel, MinSize: Size{Width: 60}},
+				},
+			},
 			// 水平分割レイアウト
 			HSplitter{
 				StretchFactor: 10,
@@ -132,6 +824,11 @@ func CreateMainWindow() {
 							{Title: "ファイル名"},
 							{Title: "サイズ"},
 							{Title: "日付"},
+							{Title: "圧縮方式"},
+							{Title: "属性"},
+							{Title: "コメント"},
+							{Title: "日時の記録"},
+							{Title: "格納順"},
 						},
 						OnMouseDown: func(x, y int, button walk.MouseButton) {
 							// マウスクリックの位置からアイテムを特定
@@ -168,6 +865,202 @@ func CreateMainWindow() {
 				Layout: HBox{MarginsZero: true},
 				Children: []Widget{
 					HSpacer{}, // 右寄せのためのスペーサー
+					PushButton{
+						Text: "テスト",
+						OnClicked: func() {
+							if currentZipPath == "" {
+								return
+							}
+							// 全エントリを展開してCRCを検証（大きなZIPでは時間がかかるため非同期）
+							targetZip := currentZipPath
+							go func() {
+								result, err := fileops.VerifyZipFile(targetZip, asyncPasswordPrompt)
+								mw.Synchronize(func() {
+									if err != nil {
+										walk.MsgBox(mw, "エラー", "ZIPファイルのテストに失敗しました: "+err.Error(), walk.MsgBoxIconError)
+										return
+									}
+									icon := walk.MsgBoxIconInformation
+									if len(result.Failures) > 0 {
+										icon = walk.MsgBoxIconWarning
+									}
+									walk.MsgBox(mw, "テスト結果 - "+filepath.Base(targetZip), fileops.FormatVerifyReport(result), icon)
+								})
+							}()
+						},
+					},
+					PushButton{
+						Text: "コメント...",
+						OnClicked: func() {
+							if currentZipPath == "" || zipModel == nil {
+								return
+							}
+							if zipModel.GetFormat() != archive.FormatZip {
+								walk.MsgBox(mw, "情報", "コメントを編集できるのはZIPファイルだけです。", walk.MsgBoxIconInformation)
+								return
+							}
+							text, enc, ok := promptComment(mw, "コメント - "+filepath.Base(currentZipPath), "アーカイブ全体のコメント:", zipModel.GetComment())
+							if !ok {
+								return
+							}
+							if err := fileops.SetArchiveComment(currentZipPath, text, enc); err != nil {
+								walk.MsgBox(mw, "エラー", "コメントを変更できません: "+err.Error(), walk.MsgBoxIconError)
+								return
+							}
+							zipModel.SetComment(text)
+						},
+					},
+					PushButton{
+						Text: "名前を付けて保存...",
+						OnClicked: func() {
+							if currentZipPath == "" {
+								return
+							}
+							// すでに削除中なら実行しない
+							if fileListModel.IsDeleting(currentZipPath) {
+								walk.MsgBox(mw, "情報", "現在選択中のZIPは削除処理中です。完了までお待ちください。", walk.MsgBoxIconInformation)
+								return
+							}
+							dstPath, ok := promptSaveAs(mw, currentZipPath)
+							if !ok {
+								return
+							}
+							format, comp, _ := archive.FormatFromName(dstPath)
+							opts := archive.ConvertOptions{Format: format, Compression: comp, Method: zip.Deflate}
+							// ZIP以外の形式からZIPに変換する場合は圧縮方式を選択する
+							if format == archive.FormatZip && zipModel.GetFormat() != archive.FormatZip {
+								method, level, ok := promptCompression(mw, "名前を付けて保存", "ZIPファイルに格納する際の圧縮方式を選択してください。")
+								if !ok {
+									return
+								}
+								opts.Method, opts.Level = method, level
+							}
+							targetZip := currentZipPath
+							saveZipAsync(targetZip, "名前を付けて保存できませんでした: ", func() (string, error) {
+								result, err := fileops.SaveArchiveAs(targetZip, dstPath, opts)
+								if err != nil {
+									return "", err
+								}
+								// 保存したアーカイブを左ペインに追加する
+								mw.Synchronize(func() { fileListModel.AddPath(dstPath) })
+								if result == nil {
+									return "", nil
+								}
+								return archive.FormatConvertReport(result), nil
+							})
+						},
+					},
+					PushButton{
+						Text: "分割して保存...",
+						OnClicked: func() {
+							if currentZipPath == "" {
+								return
+							}
+							// すでに削除中なら実行しない
+							if fileListModel.IsDeleting(currentZipPath) {
+								walk.MsgBox(mw, "情報", "現在選択中のZIPは削除処理中です。完了までお待ちください。", walk.MsgBoxIconInformation)
+								return
+							}
+							if zipModel.GetFormat() != archive.FormatZip {
+								walk.MsgBox(mw, "情報", "分割して保存できるのはZIPファイルだけです。", walk.MsgBoxIconInformation)
+								return
+							}
+							volumeSize, ok := promptVolumeSize(mw, "分割して保存", "指定したサイズのボリューム（.z01, .z02 …, .zip）に分割して保存します。\n（削除フラグが付いたファイルは削除されます）")
+							if !ok {
+								return
+							}
+							targetZip := currentZipPath
+							saveZipAsync(targetZip, "分割して保存できませんでした: ", func() (string, error) {
+								return "", fileops.SaveZipFile(targetZip, fileops.SaveOptions{VolumeSize: volumeSize, Prompt: asyncPasswordPrompt})
+							})
+						},
+					},
+					PushButton{
+						Text: "並べ替えて保存...",
+						OnClicked: func() {
+							if currentZipPath == "" {
+								return
+							}
+							// すでに削除中なら実行しない
+							if fileListModel.IsDeleting(currentZipPath) {
+								walk.MsgBox(mw, "情報", "現在選択中のZIPは削除処理中です。完了までお待ちください。", walk.MsgBoxIconInformation)
+								return
+							}
+							if zipModel.GetFormat() != archive.FormatZip {
+								walk.MsgBox(mw, "情報", "エントリを並べ替えられるのはZIPファイルだけです。", walk.MsgBoxIconInformation)
+								return
+							}
+							entries, err := fileops.ListEntries(currentZipPath)
+							if err != nil {
+								walk.MsgBox(mw, "エラー", "エントリの一覧を読み込めません: "+err.Error(), walk.MsgBoxIconError)
+								return
+							}
+							paths, ok := promptEntryOrder(mw, "並べ替えて保存", "ZIPファイルに格納するエントリの順序を指定してください。\n（削除フラグが付いたファイルは削除されます）", entries)
+							if !ok {
+								return
+							}
+							targetZip := currentZipPath
+							saveZipAsync(targetZip, "並べ替えて保存できませんでした: ", func() (string, error) {
+								return "", fileops.ReorderZipFile(targetZip, zipfmt.EntryOrder{First: paths}, asyncPasswordPrompt)
+							})
+						},
+					},
+					PushButton{
+						Text: "正規化して保存...",
+						OnClicked: func() {
+							if currentZipPath == "" {
+								return
+							}
+							// すでに削除中なら実行しない
+							if fileListModel.IsDeleting(currentZipPath) {
+								walk.MsgBox(mw, "情報", "現在選択中のZIPは削除処理中です。完了までお待ちください。", walk.MsgBoxIconInformation)
+								return
+							}
+							if zipModel.GetFormat() != archive.FormatZip {
+								walk.MsgBox(mw, "情報", "正規化できるのはZIPファイルだけです。", walk.MsgBoxIconInformation)
+								return
+							}
+							opts, ok := promptNormalize(mw, "正規化して保存", "同じ内容から常に同じバイト列になるように、ZIPファイルを書き直します。\n（削除フラグが付いたファイルは削除されます）")
+							if !ok {
+								return
+							}
+							targetZip := currentZipPath
+							saveZipAsync(targetZip, "正規化できませんでした: ", func() (string, error) {
+								result, err := fileops.NormalizeZipFile(targetZip, opts)
+								if err != nil {
+									return "", err
+								}
+								return fileops.FormatNormalizeReport(result), nil
+							})
+						},
+					},
+					PushButton{
+						Text: "暗号化して保存",
+						OnClicked: func() {
+							if currentZipPath == "" {
+								return
+							}
+							// すでに削除中なら実行しない
+							if fileListModel.IsDeleting(currentZipPath) {
+								walk.MsgBox(mw, "情報", "現在選択中のZIPは削除処理中です。完了までお待ちください。", walk.MsgBoxIconInformation)
+								return
+							}
+							password, encryption, ok := promptEncryption(mw, "暗号化して保存", "すべてのファイルを暗号化して保存します。\n（削除フラグが付いたファイルは削除されます）")
+							if !ok {
+								return
+							}
+							targetZip := currentZipPath
+							opts := fileops.SaveOptions{
+								Password:   password,
+								Encryption: encryption,
+								// 暗号化済みのファイルを暗号化し直す場合は元のパスワードが必要
+								Prompt: asyncPasswordPrompt,
+							}
+							saveZipAsync(targetZip, "ZIPファイルの暗号化に失敗しました: ", func() (string, error) {
+								return "", fileops.SaveZipFile(targetZip, opts)
+							})
+						},
+					},
 					PushButton{
 						Text: "削除",
 						OnClicked: func() {
@@ -180,41 +1073,20 @@ func CreateMainWindow() {
 								return
 							}
 							// 確認
-							if walk.MsgBox(mw, "確認", "削除フラグが付いたファイルを削除しますか？", walk.MsgBoxIconQuestion|walk.MsgBoxYesNo) != walk.DlgCmdYes {
+							question := "削除フラグが付いたファイルを削除しますか？"
+							if fileops.HasCommentEdits(currentZipPath) {
+								question = "削除フラグが付いたファイルを削除し、コメントの変更を保存しますか？"
+							}
+							if walk.MsgBox(mw, "確認", question, walk.MsgBoxIconQuestion|walk.MsgBoxYesNo) != walk.DlgCmdYes {
 								return
 							}
 							// 削除対象のパスをキャプチャ
 							targetZip := currentZipPath
-							// 左ペインに削除中を表示
-							fileListModel.SetDeleting(targetZip, true)
-							// 非同期処理開始（並列可）
-							go func() {
-								err := fileops.DeleteFlaggedFiles(targetZip)
-								// UIスレッドで更新
-								mw.Synchronize(func() {
-									// 状態解除
-									fileListModel.SetDeleting(targetZip, false)
-									if err != nil {
-										walk.MsgBox(mw, "エラー", "ファイルの削除に失敗しました: "+err.Error(), walk.MsgBoxIconError)
-										return
-									}
-									// 成功時はダイアログを表示しない
-									// 現在選択中が対象ZIPなら再読み込み
-									if currentZipPath == targetZip {
-										var loadErr error
-										zipModel, loadErr = model.LoadZipFile(targetZip)
-										if loadErr != nil {
-											walk.MsgBox(mw, "エラー", "ZIPファイルの再読み込みに失敗しました: "+loadErr.Error(), walk.MsgBoxIconError)
-											return
-										}
-                                        tv.SetModel(zipModel)
-                                        // ZIP 再読み込み時もツリーを全展開
-                                        expandAllTree()
-                                    }
-                                })
-                            }()
-                        },
-                    },
+							saveZipAsync(targetZip, "ファイルの削除に失敗しました: ", func() (string, error) {
+								return "", fileops.DeleteFlaggedFiles(targetZip)
+							})
+						},
+					},
 				},
 			},
 		},
@@ -224,14 +1096,16 @@ func CreateMainWindow() {
 
 	// ツリービューにコンテキストメニューを設定
 	tv.SetContextMenu(treeContextMenu)
+	// ファイル一覧にコンテキストメニューを設定
+	tableView.SetContextMenu(fileContextMenu)
 
 	// 左ペインのモデルを設定
 	fileListView.SetModel(fileListModel)
 
-	// ドロップイベントを処理（D&DされたZIPを左の一覧に追加）
+	// ドロップイベントを処理（D&DされたZIP・tarなどのアーカイブを左の一覧に追加）
 	mw.DropFiles().Attach(func(files []string) {
 		for _, file := range files {
-			if filepath.Ext(file) == ".zip" {
+			if archive.IsSupportedName(file) {
 				fileListModel.AddPath(file)
 			}
 		}
@@ -259,11 +1133,22 @@ func CreateMainWindow() {
 		// 正常読み込み
 		var err error
 		currentZipPath = path
-        zipModel, err = model.LoadZipFile(path)
+        zipModel, err = model.LoadArchive(path)
         if err != nil {
-            walk.MsgBox(mw, "エラー", "ZIPファイルの読み込みに失敗しました: "+err.Error(), walk.MsgBoxIconError)
+            // ZIP以外の形式は修復に対応していない
+            if format, _, _ := archive.Detect(path); format != archive.FormatZip {
+                walk.MsgBox(mw, "エラー", "アーカイブの読み込みに失敗しました: "+err.Error(), walk.MsgBoxIconError)
+                return
+            }
+            // 中央ディレクトリが壊れている可能性があるため修復を提案
+            msg := "ZIPファイルの読み込みに失敗しました: " + err.Error() + "\n\n破損したZIPファイルの修復を試みますか？"
+            if walk.MsgBox(mw, "エラー", msg, walk.MsgBoxIconError|walk.MsgBoxYesNo) == walk.DlgCmdYes {
+                repairZipFile(path)
+            }
             return
         }
+        // ほかのアーカイブを表示している間に付けた削除フラグ（重複したファイルなど）を反映
+        fileops.ApplyDeleteFlags(path, zipModel)
         tv.SetModel(zipModel)
         // ZIPを開いた直後にツリーを全展開
         expandAllTree()
@@ -277,12 +1162,15 @@ func CreateMainWindow() {
 			return
 		}
 
+		// フォルダを選択した場合は検索結果の表示をやめる
+		searchLabel.SetText("")
+
 		// 現在選択されているアイテムを取得
 		item := tv.CurrentItem()
 		if zipItem, ok := item.(*model.ZipTreeItem); ok {
 			// ディレクトリしかない
 			if zipItem.IsDir() {
-				err := fileops.UpdateFileList(tableView, zipItem)
+				err := updateFileList(tableView, zipItem)
 				if err != nil {
 					walk.MsgBox(mw, "エラー", "ファイル一覧の更新に失敗しました: "+err.Error(), walk.MsgBoxIconError)
 				}
@@ -305,22 +1193,7 @@ func CreateMainWindow() {
 		if !ok || row < 0 || row >= len(m.Items) {
 			return
 		}
-		fileItem := m.Items[row]
-
-		// 一時フォルダに展開
-		extractedPath, err := fileops.ExtractFileToTemp(currentZipPath, fileItem.GetPath())
-		if err != nil {
-			walk.MsgBox(mw, "エラー", "ファイルの展開に失敗しました: "+err.Error(), walk.MsgBoxIconError)
-			return
-		}
-
-		// 既定のアプリケーションで開く（Windowsの関連付け）
-		// cmd /C start "" <path>
-		cmd := exec.Command("cmd", "/C", "start", "", extractedPath)
-		if err := cmd.Start(); err != nil {
-			walk.MsgBox(mw, "エラー", "ファイルを開けませんでした: "+err.Error(), walk.MsgBoxIconError)
-			return
-		}
+		openEntryFile(m.Items[row].GetPath())
 	})
 
 	// ウィンドウを表示してメッセージループを開始
@@ -59,6 +59,11 @@ func (m *FileListModel) PathAt(row int) string {
     return m.paths[row]
 }
 
+// Paths は一覧のすべてのフルパスを表示順に返します。
+func (m *FileListModel) Paths() []string {
+    return append([]string(nil), m.paths...)
+}
+
 // AddPath はパスを一覧に追加します（重複は無視）。
 func (m *FileListModel) AddPath(p string) {
     for _, ex := range m.paths {
@@ -2,13 +2,15 @@ package model
 
 import (
 	"fmt"
+
 	"github.com/lxn/walk"
 )
 
 // FileItemModel はTableView用のモデルを表します
 type FileItemModel struct {
 	walk.TableModelBase
-	Items []*ZipTreeItem
+	Items    []*ZipTreeItem
+	ShowPath bool // ファイル名の欄にパスを表示する（検索結果など、複数のフォルダのアイテムを並べる場合）
 }
 
 // SetValue は指定された行と列の値を設定します
@@ -45,6 +47,9 @@ func (m *FileItemModel) Value(row, col int) interface{} {
 	case 0:
 		return item.DeleteFlag
 	case 1:
+		if m.ShowPath {
+			return item.GetPath()
+		}
 		return item.GetName()
 	case 2:
 		// サイズをKBに変換し、カンマ区切りで表示
@@ -55,6 +60,19 @@ func (m *FileItemModel) Value(row, col int) interface{} {
 		return formatWithCommas(sizeKB) + " KB"
 	case 3:
 		return item.GetDate().Format("2006/01/02 15:04:05")
+	case 4:
+		return item.MethodText()
+	case 5:
+		return item.AttributeText()
+	case 6:
+		return item.CommentText()
+	case 7:
+		return item.TimeSourceText()
+	case 8:
+		if item.GetIndex() == 0 {
+			return ""
+		}
+		return item.GetIndex()
 	}
 
 	return nil
@@ -62,7 +80,7 @@ func (m *FileItemModel) Value(row, col int) interface{} {
 
 // ColumnCount はカラム数を返します
 func (m *FileItemModel) ColumnCount() int {
-	return 4
+	return 9
 }
 
 // ColumnName は指定された列の名前を返します
@@ -76,6 +94,16 @@ func (m *FileItemModel) ColumnName(col int) string {
 		return "サイズ"
 	case 3:
 		return "日付"
+	case 4:
+		return "圧縮方式"
+	case 5:
+		return "属性"
+	case 6:
+		return "コメント"
+	case 7:
+		return "日時の記録"
+	case 8:
+		return "格納順"
 	}
 	return ""
 }
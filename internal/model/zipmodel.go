@@ -2,13 +2,17 @@ package model
 
 import (
     "archive/zip"
+    "fmt"
+    "io/fs"
     "os"
+    "path"
     "path/filepath"
+    "slices"
     "strings"
     "time"
+    "zip-editor/internal/archive"
     "zip-editor/internal/common"
-
-	"github.com/lxn/walk"
+    "zip-editor/internal/zipfmt"
 )
 
 // ZipTreeItem はZIPファイルツリー内のアイテムを表します
@@ -21,9 +25,38 @@ type ZipTreeItem struct {
 	files      []*ZipTreeItem
 	parent     *ZipTreeItem
 	isDir      bool
+	method     uint16 // 実際の圧縮方式（AES暗号化の場合も暗号化前の方式）
+	encryption string // 暗号化方式の表示名（暗号化されていない場合は空）
+	archive    bool   // 入れ子のアーカイブを展開した仮想的なディレクトリかどうか
+	methodText string // ZIP以外の形式で圧縮方式の欄に表示する文字列
+	mode       fs.FileMode
+	owner      string // 所有者（"ユーザー/グループ"、記録されていない場合は空）
+	linkname   string // シンボリックリンク・ハードリンクの参照先
+	hardlink   bool
+	comment    string // エントリのコメント（UTF-8に変換したもの）
+	timeSource string // 更新日時が記録されている場所（"DOS・拡張・NTFS" など、ZIPのみ）
+	attrs      string // MS-DOSの属性と作成したOS（"RH (FAT)" など、ZIPのみ）
+	index      int    // アーカイブ内での格納順（1から、フォルダのツリーの並びとは無関係）
+	// nested はまだ開いていない入れ子のアーカイブの場所です（開いた後はnil）
+	nested     *nestedSource
 	DeleteFlag bool
 }
 
+// nestedSource は入れ子のアーカイブを、ツリーで展開されたときに開くための情報です
+type nestedSource struct {
+	model   *ZipTreeModel
+	zipPath string    // 最も外側のZIPファイルのパス
+	modTime time.Time // 読み込んだときの最も外側のZIPファイルの更新日時
+	names   []string  // 外側から順に、入れ子のアーカイブのエントリ名（変換前のもの）
+}
+
+// NestedSeparator は入れ子のアーカイブのパスと、その中のパスを区切る文字列です
+// 例: "lib/inner.zip!/dir/file.txt"
+const NestedSeparator = "!/"
+
+// maxNestedDepth は入れ子のアーカイブを展開する深さの上限です
+const maxNestedDepth = 8
+
 // GetName は名前を返します
 func (item *ZipTreeItem) GetName() string {
 	return item.name
@@ -39,6 +72,139 @@ func (item *ZipTreeItem) GetDate() time.Time {
 	return item.date
 }
 
+// GetMethod は実際の圧縮方式を返します
+func (item *ZipTreeItem) GetMethod() uint16 {
+	return item.method
+}
+
+// GetEncryption は暗号化方式の表示名を返します（暗号化されていない場合は空文字列）
+func (item *ZipTreeItem) GetEncryption() string {
+	return item.encryption
+}
+
+// GetMode は種類とパーミッションを返します
+func (item *ZipTreeItem) GetMode() fs.FileMode {
+	return item.mode
+}
+
+// GetOwner は所有者を返します（記録されていない場合は空文字列）
+func (item *ZipTreeItem) GetOwner() string {
+	return item.owner
+}
+
+// GetLinkname はシンボリックリンク・ハードリンクの参照先を返します（リンクでない場合は空文字列）
+func (item *ZipTreeItem) GetLinkname() string {
+	return item.linkname
+}
+
+// IsSymlink はシンボリックリンクかどうかを返します
+func (item *ZipTreeItem) IsSymlink() bool {
+	return item.mode&fs.ModeSymlink != 0
+}
+
+// HasSymlinks はアイテム（フォルダの場合は中のアイテムを含む）にシンボリックリンクがあるかどうかを返します
+func (item *ZipTreeItem) HasSymlinks() bool {
+	if item.IsSymlink() {
+		return true
+	}
+	for _, file := range item.files {
+		if file.IsSymlink() {
+			return true
+		}
+	}
+	for _, child := range item.children {
+		if !child.archive && child.HasSymlinks() {
+			return true
+		}
+	}
+	return false
+}
+
+// IsHardlink はハードリンクかどうかを返します
+func (item *ZipTreeItem) IsHardlink() bool {
+	return item.hardlink
+}
+
+// GetComment はエントリのコメントを返します（コメントがない場合は空文字列）
+func (item *ZipTreeItem) GetComment() string {
+	return item.comment
+}
+
+// SetComment は表示するエントリのコメントを変更します
+// ZIPファイルへの反映は fileops.SetEntryComment で行います
+func (item *ZipTreeItem) SetComment(comment string) {
+	item.comment = comment
+}
+
+// CommentText は一覧のコメントの欄に表示する文字列（改行を空白に置き換えたもの）を返します
+func (item *ZipTreeItem) CommentText() string {
+	return strings.Join(strings.Fields(item.comment), " ")
+}
+
+// GetIndex はアーカイブ内での格納順（1から）を返します（仮想的なフォルダなど、エントリがない場合は0）
+func (item *ZipTreeItem) GetIndex() int {
+	return item.index
+}
+
+// QueryEntry は検索式（common.ParseQuery）で調べる情報を返します
+// mime は内容から判定したMIMEタイプを返す関数で、nil の場合は拡張子から判定します
+func (item *ZipTreeItem) QueryEntry(mime func() string) *common.QueryEntry {
+	e := &common.QueryEntry{
+		Path:       item.path,
+		Size:       item.size,
+		Modified:   item.date,
+		Method:     item.methodText,
+		Encryption: item.encryption,
+		Mode:       item.mode,
+		Owner:      item.owner,
+		Comment:    item.comment,
+		MIME:       mime,
+	}
+	if item.methodText == "" && !item.isDir {
+		e.Method = zipfmt.MethodName(item.method)
+	}
+	if mime == nil {
+		e.MIME = func() string { return archive.DetectMIMEType(item.name, nil) }
+	}
+	return e
+}
+
+// TimeSourceText は一覧の日時の記録の欄に表示する、更新日時が記録されている場所を返します
+func (item *ZipTreeItem) TimeSourceText() string {
+	return item.timeSource
+}
+
+// MethodText は一覧の圧縮方式の欄に表示する文字列を返します
+// 暗号化されている場合は暗号化方式も併記します
+func (item *ZipTreeItem) MethodText() string {
+	if item.methodText != "" {
+		return item.methodText
+	}
+	method := zipfmt.MethodName(item.method)
+	if item.encryption != "" {
+		return method + "（" + item.encryption + "）"
+	}
+	return method
+}
+
+// AttributeText は一覧の属性の欄に表示する文字列（パーミッション、MS-DOSの属性と作成したOS、所有者、リンクの参照先）を返します
+func (item *ZipTreeItem) AttributeText() string {
+	text := item.mode.String()
+	if item.attrs != "" {
+		text += " " + item.attrs
+	}
+	if item.owner != "" {
+		text += " " + item.owner
+	}
+	switch {
+	case item.hardlink:
+		text += " ⇒ " + item.linkname
+	case item.linkname != "":
+		text += " → " + item.linkname
+	}
+	return text
+}
+
 // GetPath はパスを返します
 func (item *ZipTreeItem) GetPath() string {
 	return item.path
@@ -59,6 +225,16 @@ func (item *ZipTreeItem) IsDir() bool {
 	return item.isDir
 }
 
+// IsArchive は入れ子のアーカイブを展開した仮想的なディレクトリかどうかを返します
+func (item *ZipTreeItem) IsArchive() bool {
+	return item.archive
+}
+
+// IsNested は入れ子のアーカイブの中にあるアイテムかどうかを返します
+func (item *ZipTreeItem) IsNested() bool {
+	return strings.Contains(item.path, NestedSeparator)
+}
+
 // Text は表示テキストを返します
 func (item *ZipTreeItem) Text() string {
 	if item.DeleteFlag {
@@ -67,22 +243,63 @@ func (item *ZipTreeItem) Text() string {
 	return "□" + item.name
 }
 
-// Parent は親アイテムを返します
-func (item *ZipTreeItem) Parent() walk.TreeItem {
-	if item.parent == nil {
-		return nil
-	}
-	return item.parent
+// HasChild は展開できるかどうかを返します
+// まだ開いていない入れ子のアーカイブは、中身を読まずに展開できるものとして扱います
+func (item *ZipTreeItem) HasChild() bool {
+	return item.nested != nil || len(item.children) > 0
 }
 
-// ChildCount は子の数を返します
+// ChildCount は子の数を返します（まだ開いていない入れ子のアーカイブはここで開きます）
 func (item *ZipTreeItem) ChildCount() int {
+	item.LoadNested()
 	return len(item.children)
 }
 
-// ChildAt は指定されたインデックスの子を返します
-func (item *ZipTreeItem) ChildAt(index int) walk.TreeItem {
-	return item.children[index]
+// LoadNested はまだ開いていない入れ子のアーカイブを開き、中身をツリーに追加します
+// 読み込んだ後にZIPファイルが変更された場合や、開けない場合（ZIP形式でないなど）は空のフォルダになります
+func (item *ZipTreeItem) LoadNested() {
+	src := item.nested
+	if src == nil {
+		return
+	}
+	item.nested = nil
+
+	fi, err := os.Stat(src.zipPath)
+	if err != nil || !fi.ModTime().Equal(src.modTime) {
+		return
+	}
+	outer, err := zipfmt.OpenReader(src.zipPath)
+	if err != nil {
+		return
+	}
+	defer outer.Close()
+
+	reader := outer.Reader
+	for _, name := range src.names {
+		file := findFile(reader, name)
+		if file == nil {
+			return
+		}
+		inner, err := zipfmt.OpenNested(file)
+		if err != nil {
+			return
+		}
+		reader = inner.Reader
+	}
+	addZipEntries(reader, item, src)
+	if src.model.nestedLoaded != nil {
+		src.model.nestedLoaded(item)
+	}
+}
+
+// findFile はZIP内のエントリを変換前の名前で探します
+func findFile(reader *zip.Reader, name string) *zip.File {
+	for _, f := range reader.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
 }
 
 // Image はアイテムの画像インデックスを返します
@@ -95,28 +312,27 @@ func (item *ZipTreeItem) Image() interface{} {
 
 // ZipTreeModel はZIPファイルのツリーモデルを表します
 type ZipTreeModel struct {
-    walk.TreeModelBase
+    treeModelBase
     rootItem *ZipTreeItem
     // 元ZIPファイルのパス
     zipPath string
     // 元ZIPファイルの最終更新時刻
     zipModTime time.Time
+    // アーカイブの形式
+    format archive.Format
+    // アーカイブ全体のコメント（UTF-8に変換したもの）
+    comment string
+    // 入れ子のアーカイブを開いたときに呼ぶ関数（SetNestedLoaded で設定）
+    nestedLoaded func(item *ZipTreeItem)
 }
 
 // zipModelCache は読み込んだZIPファイルのツリーモデルをキャッシュします（連想配列）
 // キー: ZIPファイルのパス、値: ZipTreeModel（ファイルの更新日時を保持）
 var zipModelCache = make(map[string]*ZipTreeModel)
 
-// PublishItemChanged はアイテムが変更されたことを通知します
-// 注意: この実装は簡略化されており、実際のイベント通知は行われません
-func (m *ZipTreeModel) PublishItemChanged(item walk.TreeItem) {
-	// 実際のアプリケーションでは、ここでUIに変更を通知する必要があります
-	// 現在の実装では、この機能は使用されていません
-}
-
-// LazyPopulation はツリーを即時に展開するためfalseを返します
+// LazyPopulation は入れ子のアーカイブを展開されたときに開くため、trueを返します
 func (m *ZipTreeModel) LazyPopulation() bool {
-	return false
+	return true
 }
 
 // RootCount はルートアイテムの数を返します
@@ -124,9 +340,172 @@ func (m *ZipTreeModel) RootCount() int {
 	return 1
 }
 
-// RootAt は指定されたインデックスのルートアイテムを返します
-func (m *ZipTreeModel) RootAt(index int) walk.TreeItem {
-	return m.rootItem
+// GetFormat はアーカイブの形式を返します
+func (m *ZipTreeModel) GetFormat() archive.Format {
+	return m.format
+}
+
+// GetComment はアーカイブ全体のコメントを返します（コメントがない場合は空文字列）
+func (m *ZipTreeModel) GetComment() string {
+	return m.comment
+}
+
+// SetComment は表示するアーカイブ全体のコメントを変更します
+// ZIPファイルへの反映は fileops.SetArchiveComment で行います
+func (m *ZipTreeModel) SetComment(comment string) {
+	m.comment = comment
+}
+
+// FindItems はパスが match に一致するファイル・フォルダを、ツリーのすべての階層（開いた入れ子のアーカイブの中を含む）から探します
+// フォルダのパスは末尾が "/" のものとして match に渡します。ルートは対象外です
+func (m *ZipTreeModel) FindItems(match func(path string) bool) []*ZipTreeItem {
+	return m.FilterItems(func(item *ZipTreeItem) bool { return match(item.path) })
+}
+
+// FilterItems は match を満たすファイル・フォルダを、ツリーのすべての階層（開いた入れ子のアーカイブの中を含む）から探します。ルートは対象外です
+// まだ開いていない入れ子のアーカイブの中も探す場合は、先に LoadAllNested で開いておきます
+func (m *ZipTreeModel) FilterItems(match func(item *ZipTreeItem) bool) []*ZipTreeItem {
+	var found []*ZipTreeItem
+	var visit func(item *ZipTreeItem)
+	visit = func(item *ZipTreeItem) {
+		for _, child := range item.children {
+			if match(child) {
+				found = append(found, child)
+			}
+			visit(child)
+		}
+		for _, file := range item.files {
+			if match(file) {
+				found = append(found, file)
+			}
+		}
+	}
+	visit(m.rootItem)
+	return found
+}
+
+// SetNestedLoaded は入れ子のアーカイブを開いて中身をツリーに追加したときに呼ぶ関数を設定します
+// 開いたアーカイブの仮想的なディレクトリを引数に呼びます（削除フラグの反映などに使います）
+func (m *ZipTreeModel) SetNestedLoaded(fn func(item *ZipTreeItem)) {
+	m.nestedLoaded = fn
+}
+
+// LoadAllNested はまだ開いていない入れ子のアーカイブを、その中にある入れ子のアーカイブも含めてすべて開きます
+// パターンや検索式で選択する際に、ツリーで展開していない入れ子のアーカイブの中のエントリを見落とさないようにします
+func (m *ZipTreeModel) LoadAllNested() {
+	var visit func(item *ZipTreeItem)
+	visit = func(item *ZipTreeItem) {
+		item.LoadNested()
+		for _, child := range item.children {
+			visit(child)
+		}
+	}
+	visit(m.rootItem)
+}
+
+// LoadNestedPaths は paths（入れ子のアーカイブの中のパスを含む）の途中にある入れ子のアーカイブを開きます
+// 内容の検索などで見つかったファイルを、まだ開いていない入れ子のアーカイブの中にあっても FindItems で探せるようにします
+func (m *ZipTreeModel) LoadNestedPaths(paths []string) {
+	for _, p := range paths {
+		for end := strings.Index(p, NestedSeparator); end >= 0; {
+			archivePath := p[:end+len(NestedSeparator)]
+			for _, item := range m.FindItems(func(path string) bool { return path == archivePath }) {
+				item.LoadNested()
+			}
+			next := strings.Index(p[len(archivePath):], NestedSeparator)
+			if next < 0 {
+				break
+			}
+			end = len(archivePath) + next
+		}
+	}
+}
+
+// LoadArchive はアーカイブの形式を判定して読み込み、ツリーモデルを作成します
+// ZIPファイルは LoadZipFile で読み込み、それ以外の形式（tar系）は形式に依存しないエントリの一覧から作成します
+func LoadArchive(filePath string) (*ZipTreeModel, error) {
+	format, comp, err := archive.Detect(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if format == archive.FormatZip {
+		return LoadZipFile(filePath)
+	}
+
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	modTime := fi.ModTime()
+	if cached, ok := zipModelCache[filePath]; ok {
+		if cached.zipModTime.Equal(modTime) {
+			return cached, nil
+		}
+	}
+
+	entries, err := archive.ReadEntries(filePath, format)
+	if err != nil {
+		return nil, err
+	}
+
+	rootItem := &ZipTreeItem{
+		name:  filepath.Base(filePath),
+		path:  "",
+		isDir: true,
+	}
+	methodText := format.String()
+	if comp != archive.CompressionNone {
+		methodText += "（" + comp.String() + "）"
+	}
+	addArchiveEntries(entries, rootItem, methodText)
+
+	model := &ZipTreeModel{
+		rootItem:   rootItem,
+		zipPath:    filePath,
+		zipModTime: modTime,
+		format:     format,
+	}
+	zipModelCache[filePath] = model
+	return model, nil
+}
+
+// addArchiveEntries はZIP以外の形式のエントリをツリーに追加します
+func addArchiveEntries(entries []*archive.Entry, rootItem *ZipTreeItem, methodText string) {
+	dirMap := make(map[string]*ZipTreeItem)
+	dirMap[""] = rootItem
+
+	for i, entry := range entries {
+		if entry.IsDir() {
+			createDirectoryPath(strings.TrimSuffix(entry.Path, "/"), rootItem, dirMap)
+			continue
+		}
+
+		dir := path.Dir(entry.Path)
+		fileName := path.Base(entry.Path)
+		parentItem := createDirectoryPath(dir, rootItem, dirMap)
+
+		// 7z・RARのソリッド圧縮されたファイルは、どのブロックに含まれるかを表示する
+		text := methodText
+		if entry.Solid {
+			text += fmt.Sprintf("（ソリッドブロック %d）", entry.Block+1)
+		}
+
+		fileItem := &ZipTreeItem{
+			name:       fileName,
+			size:       entry.Size,
+			date:       entry.Modified,
+			path:       parentItem.path + fileName,
+			parent:     parentItem,
+			methodText: text,
+			mode:       entry.Mode,
+			owner:      entry.Owner(),
+			linkname:   entry.Linkname,
+			hardlink:   entry.Hardlink,
+			comment:    entry.Comment,
+			index:      i + 1,
+		}
+		parentItem.files = append(parentItem.files, fileItem)
+	}
 }
 
 // LoadZipFile はZIPファイルを読み込み、ツリーモデルを作成します。
@@ -147,7 +526,7 @@ func LoadZipFile(filePath string) (*ZipTreeModel, error) {
         }
     }
 
-    reader, err := zip.OpenReader(filePath)
+    reader, err := zipfmt.OpenReader(filePath)
     if err != nil {
         return nil, err
     }
@@ -160,12 +539,31 @@ func LoadZipFile(filePath string) (*ZipTreeModel, error) {
 		isDir: true,
 	}
 
+    model := &ZipTreeModel{
+        rootItem:   rootItem,
+        zipPath:    filePath,
+        zipModTime: modTime,
+        comment:    common.AutoDetectEncoding(reader.Comment),
+    }
+
+	// ZIPの各ファイルを処理（入れ子のアーカイブは、ツリーで展開されたときに開く仮想的なディレクトリとして追加）
+	addZipEntries(reader.Reader, rootItem, &nestedSource{model: model, zipPath: filePath, modTime: modTime})
+
+    // キャッシュへ保存
+    zipModelCache[filePath] = model
+
+    return model, nil
+}
+
+// addZipEntries はZIPの各エントリをツリーに追加します
+// 入れ子になったアーカイブ（.zip・.jar など）は、中身を開かずに仮想的なディレクトリとして追加します
+// src は reader のアーカイブ自身の場所です（最も外側のZIPファイルの場合は names が空）
+func addZipEntries(reader *zip.Reader, rootItem *ZipTreeItem, src *nestedSource) {
 	// ディレクトリアイテムを素早く検索するためのマップ
 	dirMap := make(map[string]*ZipTreeItem)
 	dirMap[""] = rootItem
 
-	// ZIPの各ファイルを処理
-	for _, file := range reader.File {
+	for i, file := range reader.File {
 		// ディレクトリの場合は明示的に作成
 		if strings.HasSuffix(file.Name, "/") {
 			// パスをコンポーネントに分割し、エンコーディングを自動検出
@@ -189,25 +587,59 @@ func LoadZipFile(filePath string) (*ZipTreeModel, error) {
 		parentItem := createDirectoryPath(dir, rootItem, dirMap)
 
 		// ファイルアイテムを親ディレクトリに追加
+		// サイズはZIP64形式の場合も含めて64ビット値を使用する
 		fileItem := &ZipTreeItem{
 			name:   fileName,
+			size:   int64(file.UncompressedSize64),
+			date:   file.Modified,
 			path:   parentItem.path + fileName,
 			parent: parentItem,
 			isDir:  false,
+			// AES暗号化の場合は拡張フィールドから実際の圧縮方式を取得する
+			method:     zipfmt.ActualMethod(&file.FileHeader),
+			encryption: zipfmt.EncryptionName(&file.FileHeader),
+			mode:       file.Mode(),
+			comment:    common.AutoDetectEncoding(file.Comment),
+			// MS-DOS形式の日時のほかに拡張フィールドにも記録されているかどうかを表示する
+			timeSource: strings.Join(zipfmt.TimeSources(&file.FileHeader), "・"),
+			attrs:      zipfmt.AttrText(&file.FileHeader),
+			index:      i + 1,
+		}
+		// シンボリックリンクはデータに参照先が格納されている（暗号化されている場合などは表示しない）
+		if zipfmt.IsSymlink(&file.FileHeader) {
+			if target, err := zipfmt.ReadSymlink(file); err == nil {
+				fileItem.linkname = common.AutoDetectEncoding(target)
+			}
 		}
 		parentItem.files = append(parentItem.files, fileItem)
-	}
-
-    model := &ZipTreeModel{
-        rootItem:   rootItem,
-        zipPath:    filePath,
-        zipModTime: modTime,
-    }
 
-    // キャッシュへ保存
-    zipModelCache[filePath] = model
+		// 入れ子のアーカイブはディレクトリとしても表示する
+		if zipfmt.IsArchiveName(fileName) && len(src.names) < maxNestedDepth && zipfmt.CanOpenNested(file) {
+			addNestedArchive(file, fileItem, src)
+		}
+	}
+}
 
-    return model, nil
+// addNestedArchive は入れ子のアーカイブを、まだ開いていない仮想的なディレクトリとして親ディレクトリに追加します
+// 中身は LoadNested でツリーで展開されたときに読み込みます（読み込みのたびにすべてを展開しないため）
+func addNestedArchive(file *zip.File, fileItem *ZipTreeItem, src *nestedSource) {
+	parentItem := fileItem.parent
+	archiveItem := &ZipTreeItem{
+		name:    fileItem.name,
+		size:    fileItem.size,
+		date:    fileItem.date,
+		path:    fileItem.path + NestedSeparator,
+		parent:  parentItem,
+		isDir:   true,
+		archive: true,
+		nested: &nestedSource{
+			model:   src.model,
+			zipPath: src.zipPath,
+			modTime: src.modTime,
+			names:   append(slices.Clip(src.names), file.Name),
+		},
+	}
+	parentItem.children = append(parentItem.children, archiveItem)
 }
 
 // createDirectoryPath はパスに基づいてディレクトリ構造を作成し、最後のディレクトリアイテムを返します
@@ -218,7 +650,8 @@ func createDirectoryPath(dirPath string, rootItem *ZipTreeItem, dirMap map[strin
 	}
 
 	// すべての親ディレクトリが存在することを確認
-	parentPath := ""
+	// 入れ子のアーカイブでは、アーカイブのパスを先頭に付ける
+	parentPath := rootItem.path
 	parentItem := rootItem
 
 	for _, part := range strings.Split(dirPath, "/") {
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package model
+
+// treeModelBase はWindows以外では TreeView に表示しないため、何も通知しません
+// fileops などの画面に依存しない処理は、Windows以外でもビルド・テストできます
+type treeModelBase struct{}
@@ -0,0 +1,32 @@
+package model
+
+import "github.com/lxn/walk"
+
+// treeModelBase はツリーモデルの変更を TreeView に通知する walk の実装です
+type treeModelBase = walk.TreeModelBase
+
+// Parent は親アイテムを返します
+func (item *ZipTreeItem) Parent() walk.TreeItem {
+	if item.parent == nil {
+		return nil
+	}
+	return item.parent
+}
+
+// ChildAt は指定されたインデックスの子を返します
+func (item *ZipTreeItem) ChildAt(index int) walk.TreeItem {
+	item.LoadNested()
+	return item.children[index]
+}
+
+// PublishItemChanged はアイテムが変更されたことを通知します
+// 注意: この実装は簡略化されており、実際のイベント通知は行われません
+func (m *ZipTreeModel) PublishItemChanged(item walk.TreeItem) {
+	// 実際のアプリケーションでは、ここでUIに変更を通知する必要があります
+	// 現在の実装では、この機能は使用されていません
+}
+
+// RootAt は指定されたインデックスのルートアイテムを返します
+func (m *ZipTreeModel) RootAt(index int) walk.TreeItem {
+	return m.rootItem
+}
@@ -0,0 +1,260 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+)
+
+// WinZip AES暗号化（拡張フィールド 0x9901）の定数
+const (
+	AESExtraID = 0x9901
+
+	aesVersionAE1     = 1  // CRCを記録する形式
+	aesVersionAE2     = 2  // CRCを記録しない形式
+	aesVerifierLen    = 2  // パスワード検証値の長さ
+	aesAuthCodeLen    = 10 // 認証コード（HMAC-SHA1の先頭10バイト）の長さ
+	aesIterations     = 1000
+	aesExtraDataLen   = 7
+	aesSmallFileLimit = 20 // これより小さいファイルはCRCから内容が推測されないようAE-2で保存する
+)
+
+// ErrAuthentication は暗号化データの認証コードが一致しない場合のエラーです
+var ErrAuthentication = errors.New("暗号化データの認証に失敗しました（データが改ざんまたは破損しています）")
+
+// AESStrength はAES暗号化の鍵長を示す値です（拡張フィールドに記録される値）
+type AESStrength byte
+
+const (
+	AES128 AESStrength = 1
+	AES192 AESStrength = 2
+	AES256 AESStrength = 3
+)
+
+// keyLen は鍵長（バイト）を返します
+func (s AESStrength) keyLen() int {
+	return 8 + int(s)*8
+}
+
+// saltLen はソルトの長さ（バイト）を返します
+func (s AESStrength) saltLen() int {
+	return 4 + int(s)*4
+}
+
+// String は表示用の名前を返します
+func (s AESStrength) String() string {
+	switch s {
+	case AES128:
+		return "AES-128"
+	case AES192:
+		return "AES-192"
+	case AES256:
+		return "AES-256"
+	}
+	return "AES"
+}
+
+// AESInfo はAES暗号化エントリの拡張フィールドの内容です
+type AESInfo struct {
+	Version  uint16      // 1: AE-1, 2: AE-2
+	Strength AESStrength // 鍵長
+	Method   uint16      // 暗号化前の実際の圧縮方式
+}
+
+// ParseAESExtra はAES暗号化の拡張フィールドを解析します
+func ParseAESExtra(fh *zip.FileHeader) (AESInfo, bool) {
+	if fh.Method != methodAES {
+		return AESInfo{}, false
+	}
+	data, ok := FindExtra(fh.Extra, AESExtraID)
+	if !ok || len(data) < aesExtraDataLen || data[2] != 'A' || data[3] != 'E' {
+		return AESInfo{}, false
+	}
+	info := AESInfo{
+		Version:  binary.LittleEndian.Uint16(data[0:2]),
+		Strength: AESStrength(data[4]),
+		Method:   binary.LittleEndian.Uint16(data[5:7]),
+	}
+	if info.Strength < AES128 || info.Strength > AES256 {
+		return AESInfo{}, false
+	}
+	return info, true
+}
+
+// buildAESExtra はAES暗号化の拡張フィールドを作成します
+func buildAESExtra(info AESInfo) ExtraField {
+	data := make([]byte, aesExtraDataLen)
+	binary.LittleEndian.PutUint16(data[0:2], info.Version)
+	data[2], data[3] = 'A', 'E'
+	data[4] = byte(info.Strength)
+	binary.LittleEndian.PutUint16(data[5:7], info.Method)
+	return ExtraField{ID: AESExtraID, Data: data}
+}
+
+// aesOverhead は暗号化によって増えるバイト数を返します
+func aesOverhead(s AESStrength) int64 {
+	return int64(s.saltLen() + aesVerifierLen + aesAuthCodeLen)
+}
+
+// deriveAESKeys はパスワードとソルトから暗号鍵・認証鍵・パスワード検証値を導出します
+func deriveAESKeys(password, salt []byte, s AESStrength) (encKey, macKey, verifier []byte, err error) {
+	keyLen := s.keyLen()
+	derived, err := pbkdf2.Key(sha1.New, string(password), salt, aesIterations, 2*keyLen+aesVerifierLen)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return derived[:keyLen], derived[keyLen : 2*keyLen], derived[2*keyLen:], nil
+}
+
+// aesCTR はWinZip形式のCTRモード（リトルエンディアンのカウンタを1から開始）です
+// 標準の cipher.NewCTR はビッグエンディアンでカウンタを進めるため使用できません
+type aesCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	pos     int
+}
+
+func newAESCTR(key []byte) (*aesCTR, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &aesCTR{block: block, pos: aes.BlockSize}, nil
+}
+
+func (c *aesCTR) XORKeyStream(b []byte) {
+	for i := range b {
+		if c.pos == aes.BlockSize {
+			// カウンタをリトルエンディアンで1つ進めて鍵ストリームを生成
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.pos = 0
+		}
+		b[i] ^= c.stream[c.pos]
+		c.pos++
+	}
+}
+
+// aesReader は暗号化データを復号しながら読み取り、最後に認証コードを照合するリーダーです
+type aesReader struct {
+	r        io.Reader
+	ctr      *aesCTR
+	mac      hash.Hash
+	authCode io.Reader
+}
+
+func (a *aesReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	a.mac.Write(p[:n])
+	a.ctr.XORKeyStream(p[:n])
+	if err == io.EOF {
+		var want [aesAuthCodeLen]byte
+		if _, rerr := io.ReadFull(a.authCode, want[:]); rerr != nil {
+			return n, errTruncated
+		}
+		if subtle.ConstantTimeCompare(a.mac.Sum(nil)[:aesAuthCodeLen], want[:]) != 1 {
+			return n, ErrAuthentication
+		}
+	}
+	return n, err
+}
+
+// newAESReader はパスワードを照合し、復号した圧縮データを読み取るリーダーを返します
+func newAESReader(raw io.ReaderAt, size int64, info AESInfo, password string) (io.Reader, error) {
+	saltLen := int64(info.Strength.saltLen())
+	if size < aesOverhead(info.Strength) {
+		return nil, errTruncated
+	}
+
+	head := make([]byte, saltLen+aesVerifierLen)
+	if _, err := raw.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+	salt, verifier := head[:saltLen], head[saltLen:]
+
+	for _, pw := range passwordCandidates(password) {
+		encKey, macKey, wantVerifier, err := deriveAESKeys(pw, salt, info.Strength)
+		if err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare(verifier, wantVerifier) != 1 {
+			continue
+		}
+
+		ctr, err := newAESCTR(encKey)
+		if err != nil {
+			return nil, err
+		}
+		dataOff := saltLen + aesVerifierLen
+		dataLen := size - dataOff - aesAuthCodeLen
+		return &aesReader{
+			r:        io.NewSectionReader(raw, dataOff, dataLen),
+			ctr:      ctr,
+			mac:      hmac.New(sha1.New, macKey),
+			authCode: io.NewSectionReader(raw, dataOff+dataLen, aesAuthCodeLen),
+		}, nil
+	}
+	return nil, ErrPassword
+}
+
+// aesWriter はデータを暗号化しながら書き込み、Closeで認証コードを書き込むライターです
+type aesWriter struct {
+	w   io.Writer
+	ctr *aesCTR
+	mac hash.Hash
+	buf []byte
+}
+
+func (a *aesWriter) Write(p []byte) (int, error) {
+	a.buf = append(a.buf[:0], p...)
+	a.ctr.XORKeyStream(a.buf)
+	a.mac.Write(a.buf)
+	if _, err := a.w.Write(a.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (a *aesWriter) Close() error {
+	_, err := a.w.Write(a.mac.Sum(nil)[:aesAuthCodeLen])
+	return err
+}
+
+// newAESWriter はソルトとパスワード検証値を書き込み、暗号化ライターを返します
+func newAESWriter(w io.Writer, password string, s AESStrength) (io.WriteCloser, error) {
+	salt := make([]byte, s.saltLen())
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	encKey, macKey, verifier, err := deriveAESKeys([]byte(password), salt, s)
+	if err != nil {
+		return nil, err
+	}
+	ctr, err := newAESCTR(encKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(verifier); err != nil {
+		return nil, err
+	}
+	return &aesWriter{w: w, ctr: ctr, mac: hmac.New(sha1.New, macKey)}, nil
+}
@@ -0,0 +1,350 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// 作成したOS（「作成したバージョン」の上位バイト）の値
+const (
+	HostFAT   = 0  // MS-DOS・Windows（FAT）
+	HostUnix  = 3  // Unix
+	HostNTFS  = 10 // Windows（NTFS）
+	HostVFAT  = 14 // Windows（VFAT）
+	HostMacOS = 19 // macOS
+)
+
+// MS-DOSの属性（外部属性の下位バイト）
+const (
+	DOSReadOnly = 0x01 // 読み取り専用
+	DOSHidden   = 0x02 // 隠しファイル
+	DOSSystem   = 0x04 // システムファイル
+	DOSDir      = 0x10 // ディレクトリ
+	DOSArchive  = 0x20 // アーカイブ
+)
+
+// Unixのファイルの種類（外部属性の上位16ビット）
+const (
+	unixTypeMask = 0xf000
+	unixRegular  = 0x8000
+	unixDir      = 0x4000
+	unixSetuid   = 0x800
+	unixSetgid   = 0x400
+	unixSticky   = 0x200
+)
+
+// dosAttrLetters は表示・指定に使うMS-DOSの属性の文字です
+var dosAttrLetters = []struct {
+	letter byte
+	bit    uint8
+}{
+	{'R', DOSReadOnly},
+	{'H', DOSHidden},
+	{'S', DOSSystem},
+	{'A', DOSArchive},
+}
+
+// HostName はエントリを作成したOSの表示名を返します
+func HostName(fh *zip.FileHeader) string {
+	switch host := fh.CreatorVersion >> 8; host {
+	case HostFAT:
+		return "FAT"
+	case HostUnix:
+		return "Unix"
+	case HostNTFS:
+		return "NTFS"
+	case HostVFAT:
+		return "VFAT"
+	case HostMacOS:
+		return "macOS"
+	default:
+		return fmt.Sprintf("OS %d", host)
+	}
+}
+
+// IsUnixHost はUnixのパーミッションが外部属性に記録されているかどうかを返します
+func IsUnixHost(fh *zip.FileHeader) bool {
+	host := fh.CreatorVersion >> 8
+	return host == HostUnix || host == HostMacOS
+}
+
+// DOSAttrs はエントリのMS-DOSの属性（読み取り専用・隠し・システム・アーカイブ）を返します
+func DOSAttrs(fh *zip.FileHeader) uint8 {
+	return uint8(fh.ExternalAttrs) & (DOSReadOnly | DOSHidden | DOSSystem | DOSArchive)
+}
+
+// DOSAttrText はMS-DOSの属性を "RHSA" のような文字列で返します（属性がない場合は空文字列）
+func DOSAttrText(attrs uint8) string {
+	var sb strings.Builder
+	for _, a := range dosAttrLetters {
+		if attrs&a.bit != 0 {
+			sb.WriteByte(a.letter)
+		}
+	}
+	return sb.String()
+}
+
+// AttrText は一覧に表示する、MS-DOSの属性と作成したOSをまとめた文字列を返します
+// 例: "RH (FAT)"、"(Unix)"
+func AttrText(fh *zip.FileHeader) string {
+	host := "(" + HostName(fh) + ")"
+	if dos := DOSAttrText(DOSAttrs(fh)); dos != "" {
+		return dos + " " + host
+	}
+	return host
+}
+
+// HostChange は作成したOSの変更方法です
+type HostChange int
+
+const (
+	HostKeep   HostChange = iota // 変更しない
+	HostToUnix                   // Unixにする（パーミッションがない場合はMS-DOSの属性から作る）
+	HostToFAT                    // MS-DOS（FAT）にする
+)
+
+// AttrEdit はエントリの属性の変更内容です
+type AttrEdit struct {
+	Perm        PermEdit   // Unixのパーミッションの変更（nilの場合は変更しない）
+	ScriptsOnly bool       // Perm を "#!" で始まるファイルだけに適用する
+	DOSSet      uint8      // 付けるMS-DOSの属性
+	DOSClear    uint8      // 外すMS-DOSの属性
+	Host        HostChange // 作成したOSの変更
+}
+
+// IsEmpty は変更内容が何も指定されていないかどうかを返します
+func (e AttrEdit) IsEmpty() bool {
+	return len(e.Perm) == 0 && e.DOSSet == 0 && e.DOSClear == 0 && e.Host == HostKeep
+}
+
+// NeedsScript は変更の適用にエントリの内容（"#!" で始まるかどうか）の確認が必要かどうかを返します
+func (e AttrEdit) NeedsScript() bool {
+	return e.ScriptsOnly && len(e.Perm) > 0
+}
+
+// ApplyAttrEdit はエントリのヘッダーに属性の変更を適用し、変更があったかどうかを返します
+// script はエントリが "#!" で始まるファイルかどうかで、ScriptsOnly の場合にだけ使われます
+// パーミッションを変更する場合、Unix以外で作成されたエントリはMS-DOSの属性からパーミッションを作り、作成したOSをUnixにします
+func ApplyAttrEdit(fh *zip.FileHeader, edit AttrEdit, script bool) bool {
+	oldVersion, oldAttrs := fh.CreatorVersion, fh.ExternalAttrs
+	isDir := isDirName(fh.Name)
+
+	switch edit.Host {
+	case HostToUnix:
+		toUnixHost(fh, isDir)
+	case HostToFAT:
+		// シンボリックリンクはUnixの外部属性でしか表せないため、作成したOSを変更しない
+		if !IsSymlink(fh) {
+			fh.CreatorVersion = fh.CreatorVersion&0xff | HostFAT<<8
+		}
+	}
+
+	if len(edit.Perm) > 0 && (!edit.ScriptsOnly || (script && !isDir)) {
+		toUnixHost(fh, isDir)
+		mode := fh.ExternalAttrs >> 16
+		perm := edit.Perm.Apply(unixPermToFileMode(mode), isDir || mode&unixTypeMask == unixDir)
+		mode = mode&unixTypeMask | fileModeToUnixPerm(perm)
+		fh.ExternalAttrs = fh.ExternalAttrs&0xffff | mode<<16
+	}
+
+	attrs := uint8(fh.ExternalAttrs)&^edit.DOSClear | edit.DOSSet
+	fh.ExternalAttrs = fh.ExternalAttrs&^0xff | uint32(attrs)
+
+	return fh.CreatorVersion != oldVersion || fh.ExternalAttrs != oldAttrs
+}
+
+// toUnixHost は作成したOSをUnixにします
+// Unixのパーミッションが記録されていない場合は、MS-DOSの属性から作ります（ディレクトリは755、ファイルは644、読み取り専用は書き込み権限なし）
+func toUnixHost(fh *zip.FileHeader, isDir bool) {
+	if IsUnixHost(fh) && fh.ExternalAttrs>>16 != 0 {
+		return
+	}
+	var mode uint32 = unixRegular | 0644
+	if isDir || fh.ExternalAttrs&DOSDir != 0 {
+		mode = unixDir | 0755
+	}
+	if fh.ExternalAttrs&DOSReadOnly != 0 {
+		mode &^= 0222
+	}
+	fh.CreatorVersion = fh.CreatorVersion&0xff | HostUnix<<8
+	fh.ExternalAttrs = fh.ExternalAttrs&0xffff | mode<<16
+}
+
+// unixPermToFileMode はUnixのモードのうち、パーミッションと特殊ビットを fs.FileMode に変換します
+func unixPermToFileMode(m uint32) fs.FileMode {
+	mode := fs.FileMode(m & 0777)
+	if m&unixSetuid != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if m&unixSetgid != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if m&unixSticky != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
+
+// fileModeToUnixPerm は fs.FileMode のパーミッションと特殊ビットをUnixのモードに変換します
+func fileModeToUnixPerm(mode fs.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		m |= unixSetuid
+	}
+	if mode&fs.ModeSetgid != 0 {
+		m |= unixSetgid
+	}
+	if mode&fs.ModeSticky != 0 {
+		m |= unixSticky
+	}
+	return m
+}
+
+// permClause はパーミッションの変更指定の1項目です（chmod の "u+x" や "755" に相当）
+type permClause struct {
+	who  fs.FileMode // 対象のビット（u・g・o）
+	op   byte        // '+'、'-'、'='
+	bits fs.FileMode // 変更するビット（who で絞り込む前）
+	dirX bool        // 'X'：ディレクトリか、いずれかの実行権限があるファイルだけに実行権限を付ける
+}
+
+// PermEdit はchmodと同じ形式で指定したパーミッションの変更です
+type PermEdit []permClause
+
+// ParsePermEdit はchmodと同じ形式のパーミッションの指定を解釈します
+// 8進数（"755"）か、カンマ区切りの記号（"+x"、"u+x,go-w"、"a=rX"）を指定できます
+func ParsePermEdit(s string) (PermEdit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("パーミッションが指定されていません")
+	}
+	if s[0] >= '0' && s[0] <= '7' {
+		v, err := strconv.ParseUint(s, 8, 32)
+		if err != nil || v > 07777 {
+			return nil, fmt.Errorf("パーミッションの値が正しくありません: %s", s)
+		}
+		mode := unixPermToFileMode(uint32(v))
+		const all = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+		return PermEdit{{who: all, op: '=', bits: mode}}, nil
+	}
+
+	var edit PermEdit
+	for _, part := range strings.Split(s, ",") {
+		var who fs.FileMode
+		i := 0
+		for ; i < len(part) && strings.IndexByte("ugoa", part[i]) >= 0; i++ {
+			switch part[i] {
+			case 'u':
+				who |= 0700 | fs.ModeSetuid
+			case 'g':
+				who |= 0070 | fs.ModeSetgid
+			case 'o':
+				who |= 0007 | fs.ModeSticky
+			case 'a':
+				who |= fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+			}
+		}
+		if who == 0 {
+			who = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+		}
+		if i >= len(part) || strings.IndexByte("+-=", part[i]) < 0 {
+			return nil, fmt.Errorf("パーミッションの指定が正しくありません: %s", part)
+		}
+		clause := permClause{who: who, op: part[i]}
+		for _, c := range part[i+1:] {
+			switch c {
+			case 'r':
+				clause.bits |= 0444
+			case 'w':
+				clause.bits |= 0222
+			case 'x':
+				clause.bits |= 0111
+			case 'X':
+				clause.dirX = true
+			case 's':
+				clause.bits |= fs.ModeSetuid | fs.ModeSetgid
+			case 't':
+				clause.bits |= fs.ModeSticky
+			default:
+				return nil, fmt.Errorf("パーミッションの指定が正しくありません: %s", part)
+			}
+		}
+		edit = append(edit, clause)
+	}
+	return edit, nil
+}
+
+// Apply はパーミッションに変更を適用した結果を返します
+func (e PermEdit) Apply(mode fs.FileMode, isDir bool) fs.FileMode {
+	for _, c := range e {
+		bits := c.bits
+		if c.dirX && (isDir || mode&0111 != 0) {
+			bits |= 0111
+		}
+		bits &= c.who
+		switch c.op {
+		case '+':
+			mode |= bits
+		case '-':
+			mode &^= bits
+		case '=':
+			mode = mode&^c.who | bits
+		}
+	}
+	return mode
+}
+
+// ParseDOSEdit は "+R"、"-HS"、"+A-R" のような形式のMS-DOSの属性の指定を解釈し、付ける属性と外す属性を返します
+func ParseDOSEdit(s string) (set, clear uint8, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, 0, errors.New("属性が指定されていません")
+	}
+	op := byte(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '+' || c == '-' {
+			op = c
+			continue
+		}
+		var bit uint8
+		for _, a := range dosAttrLetters {
+			if a.letter == c || a.letter+'a'-'A' == c {
+				bit = a.bit
+			}
+		}
+		if bit == 0 || op == 0 {
+			return 0, 0, fmt.Errorf("属性の指定が正しくありません: %s（+R、-HS のように指定してください）", s)
+		}
+		if op == '+' {
+			set, clear = set|bit, clear&^bit
+		} else {
+			clear, set = clear|bit, set&^bit
+		}
+	}
+	return set, clear, nil
+}
+
+// IsScript はエントリの内容が "#!" で始まるかどうかを返します
+// 暗号化されているなど、内容を読めない場合は false を返します
+func IsScript(f *zip.File) bool {
+	if f.Flags&FlagEncrypted != 0 || isDirName(f.Name) {
+		return false
+	}
+	rc, err := OpenFile(f)
+	if err != nil {
+		return false
+	}
+	defer rc.Close()
+
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(rc, head); err != nil {
+		return false
+	}
+	return string(head) == "#!"
+}
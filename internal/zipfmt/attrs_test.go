@@ -0,0 +1,214 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"io/fs"
+	"testing"
+)
+
+func TestParsePermEdit(t *testing.T) {
+	tests := []struct {
+		spec  string
+		mode  fs.FileMode
+		isDir bool
+		want  fs.FileMode
+	}{
+		{spec: "755", mode: 0o600, want: 0o755},
+		{spec: "0644", mode: 0o777 | fs.ModeSetuid, want: 0o644},
+		{spec: "4755", mode: 0, want: 0o755 | fs.ModeSetuid},
+		{spec: "+x", mode: 0o644, want: 0o755},
+		{spec: "-w", mode: 0o666, want: 0o444},
+		{spec: "u+x,go-w", mode: 0o666, want: 0o744},
+		{spec: "u=rw,go=", mode: 0o777, want: 0o600},
+		{spec: "g+s", mode: 0o755, want: 0o755 | fs.ModeSetgid},
+		{spec: "o+t", mode: 0o777, isDir: true, want: 0o777 | fs.ModeSticky},
+		// X はディレクトリか、いずれかの実行権限があるファイルだけに実行権限を付ける
+		{spec: "a=rX", mode: 0o644, want: 0o444},
+		{spec: "a=rX", mode: 0o744, want: 0o555},
+		{spec: "a=rX", mode: 0o700, isDir: true, want: 0o555},
+		{spec: " ug+rw ", mode: 0o400, want: 0o660},
+	}
+	for _, tt := range tests {
+		edit, err := ParsePermEdit(tt.spec)
+		if err != nil {
+			t.Errorf("ParsePermEdit(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := edit.Apply(tt.mode, tt.isDir); got != tt.want {
+			t.Errorf("%q を %v に適用 = %v, want %v", tt.spec, tt.mode, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"", " ", "8", "77777", "u+q", "ux", "u+x,", "+x,z-w"} {
+		if _, err := ParsePermEdit(spec); err == nil {
+			t.Errorf("ParsePermEdit(%q): エラーになりませんでした", spec)
+		}
+	}
+}
+
+func TestParseDOSEdit(t *testing.T) {
+	tests := []struct {
+		spec      string
+		set       uint8
+		clear     uint8
+		wantError bool
+	}{
+		{spec: "+R", set: DOSReadOnly},
+		{spec: "-HS", clear: DOSHidden | DOSSystem},
+		{spec: "+A-R", set: DOSArchive, clear: DOSReadOnly},
+		{spec: "+rh", set: DOSReadOnly | DOSHidden},
+		// 後から指定したものが優先される
+		{spec: "+R-R", clear: DOSReadOnly},
+		{spec: "", wantError: true},
+		{spec: "R", wantError: true},
+		{spec: "+Z", wantError: true},
+		{spec: "+D", wantError: true},
+	}
+	for _, tt := range tests {
+		set, clear, err := ParseDOSEdit(tt.spec)
+		if (err != nil) != tt.wantError {
+			t.Errorf("ParseDOSEdit(%q): err = %v, wantError %v", tt.spec, err, tt.wantError)
+			continue
+		}
+		if set != tt.set || clear != tt.clear {
+			t.Errorf("ParseDOSEdit(%q) = %#x, %#x, want %#x, %#x", tt.spec, set, clear, tt.set, tt.clear)
+		}
+	}
+}
+
+func TestApplyAttrEdit(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		host        uint16
+		attrs       uint32
+		edit        string // パーミッションの変更（空の場合は変更しない）
+		scriptsOnly bool
+		script      bool
+		dosSet      uint8
+		dosClear    uint8
+		hostChange  HostChange
+		wantHost    uint16
+		wantAttrs   uint32
+		wantChanged bool
+	}{
+		{
+			name: "FATのファイルに実行権限を付ける", file: "a.txt", host: HostFAT, attrs: DOSReadOnly | DOSArchive, edit: "+x",
+			// 読み取り専用の属性から書き込み権限のないパーミッションを作り、MS-DOSの属性は残す
+			wantHost: HostUnix, wantAttrs: (unixRegular|0o555)<<16 | DOSReadOnly | DOSArchive, wantChanged: true,
+		},
+		{
+			name: "FATのディレクトリ", file: "d/", host: HostNTFS, attrs: DOSDir, edit: "a=rX",
+			wantHost: HostUnix, wantAttrs: (unixDir|0o555)<<16 | DOSDir, wantChanged: true,
+		},
+		{
+			name: "Unixのファイルに8進数で指定", file: "a", host: HostUnix, attrs: (unixRegular | 0o644) << 16, edit: "4750",
+			wantHost: HostUnix, wantAttrs: (unixRegular | unixSetuid | 0o750) << 16, wantChanged: true,
+		},
+		{
+			name: "変更のない指定", file: "a", host: HostMacOS, attrs: (unixRegular | 0o644) << 16, edit: "644",
+			wantHost: HostMacOS, wantAttrs: (unixRegular | 0o644) << 16,
+		},
+		{
+			name: "スクリプトだけに適用（スクリプト）", file: "run.sh", host: HostUnix, attrs: (unixRegular | 0o644) << 16, edit: "+x", scriptsOnly: true, script: true,
+			wantHost: HostUnix, wantAttrs: (unixRegular | 0o755) << 16, wantChanged: true,
+		},
+		{
+			name: "スクリプトだけに適用（スクリプトでない）", file: "a.txt", host: HostUnix, attrs: (unixRegular | 0o644) << 16, edit: "+x", scriptsOnly: true,
+			wantHost: HostUnix, wantAttrs: (unixRegular | 0o644) << 16,
+		},
+		{
+			name: "スクリプトだけに適用（ディレクトリ）", file: "d/", host: HostUnix, attrs: (unixDir|0o700)<<16 | DOSDir, edit: "+x", scriptsOnly: true, script: true,
+			wantHost: HostUnix, wantAttrs: (unixDir|0o700)<<16 | DOSDir,
+		},
+		{
+			name: "MS-DOSの属性", file: "a", host: HostUnix, attrs: (unixRegular|0o644)<<16 | DOSArchive | DOSSystem, dosSet: DOSHidden, dosClear: DOSArchive,
+			wantHost: HostUnix, wantAttrs: (unixRegular|0o644)<<16 | DOSHidden | DOSSystem, wantChanged: true,
+		},
+		{
+			name: "Unixにする", file: "a", host: HostFAT, attrs: DOSReadOnly, hostChange: HostToUnix,
+			wantHost: HostUnix, wantAttrs: (unixRegular|0o444)<<16 | DOSReadOnly, wantChanged: true,
+		},
+		{
+			name: "パーミッションのあるエントリをUnixにする", file: "a", host: HostMacOS, attrs: (unixRegular | 0o600) << 16, hostChange: HostToUnix,
+			wantHost: HostMacOS, wantAttrs: (unixRegular | 0o600) << 16,
+		},
+		{
+			name: "FATにする", file: "a", host: HostUnix, attrs: (unixRegular | 0o755) << 16, hostChange: HostToFAT,
+			wantHost: HostFAT, wantAttrs: (unixRegular | 0o755) << 16, wantChanged: true,
+		},
+		{
+			name: "シンボリックリンクはFATにしない", file: "link", host: HostUnix, attrs: (0o120000 | 0o777) << 16, hostChange: HostToFAT,
+			wantHost: HostUnix, wantAttrs: (0o120000 | 0o777) << 16,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edit := AttrEdit{ScriptsOnly: tt.scriptsOnly, DOSSet: tt.dosSet, DOSClear: tt.dosClear, Host: tt.hostChange}
+			if tt.edit != "" {
+				var err error
+				if edit.Perm, err = ParsePermEdit(tt.edit); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if edit.IsEmpty() {
+				t.Fatal("変更内容が空と判定されました")
+			}
+			fh := &zip.FileHeader{Name: tt.file, CreatorVersion: tt.host<<8 | 20, ExternalAttrs: tt.attrs}
+			changed := ApplyAttrEdit(fh, edit, tt.script)
+			if changed != tt.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if host := fh.CreatorVersion >> 8; host != tt.wantHost || fh.CreatorVersion&0xff != 20 {
+				t.Errorf("作成したバージョン = %#x, want 作成したOS %d", fh.CreatorVersion, tt.wantHost)
+			}
+			if fh.ExternalAttrs != tt.wantAttrs {
+				t.Errorf("外部属性 = %#o, want %#o", fh.ExternalAttrs, tt.wantAttrs)
+			}
+		})
+	}
+
+	if !(AttrEdit{}).IsEmpty() {
+		t.Error("空の変更内容が空と判定されませんでした")
+	}
+	perm, _ := ParsePermEdit("+x")
+	if (AttrEdit{Perm: perm}).NeedsScript() || !(AttrEdit{Perm: perm, ScriptsOnly: true}).NeedsScript() || (AttrEdit{ScriptsOnly: true}).NeedsScript() {
+		t.Error("NeedsScript の結果が正しくありません")
+	}
+}
+
+func TestAttrText(t *testing.T) {
+	tests := []struct {
+		host  uint16
+		attrs uint32
+		want  string
+	}{
+		{host: HostFAT, attrs: DOSReadOnly | DOSHidden | DOSDir, want: "RH (FAT)"},
+		{host: HostNTFS, attrs: DOSArchive | DOSSystem, want: "SA (NTFS)"},
+		{host: HostUnix, attrs: (unixRegular | 0o644) << 16, want: "(Unix)"},
+		{host: HostMacOS, attrs: (unixRegular|0o644)<<16 | DOSHidden, want: "H (macOS)"},
+		{host: 7, want: "(OS 7)"},
+	}
+	for _, tt := range tests {
+		fh := &zip.FileHeader{CreatorVersion: tt.host<<8 | 20, ExternalAttrs: tt.attrs}
+		if got := AttrText(fh); got != tt.want {
+			t.Errorf("AttrText(%d, %#x) = %q, want %q", tt.host, tt.attrs, got, tt.want)
+		}
+	}
+}
+
+func TestIsScript(t *testing.T) {
+	data := buildZip(t, []testEntry{
+		{name: "run.sh", data: []byte("#!/bin/sh\necho run\n"), method: zip.Deflate},
+		{name: "a.txt", data: []byte("# コメント\n")},
+		{name: "short", data: []byte("#")},
+		{name: "empty", data: nil},
+		{name: "d/", data: nil},
+	})
+	want := map[string]bool{"run.sh": true}
+	for _, f := range openZip(t, data).File {
+		if got := IsScript(f); got != want[f.Name] {
+			t.Errorf("IsScript(%s) = %v, want %v", f.Name, got, want[f.Name])
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"fmt"
+
+	"zip-editor/internal/common"
+)
+
+// EncodeComment はコメントを指定したエンコーディングのバイト列に変換し、長さの上限を確認します
+func EncodeComment(comment string, enc common.TextEncoding) (string, error) {
+	encoded, err := common.EncodeText(comment, enc)
+	if err != nil {
+		return "", err
+	}
+	if len(encoded) > maxCommentLen {
+		return "", fmt.Errorf("コメントが長すぎます（%d バイト、最大 %d バイト）", len(encoded), maxCommentLen)
+	}
+	return encoded, nil
+}
+
+// SetEntryComment はエントリのコメントを指定したエンコーディングで設定します
+// ZIPの言語エンコーディングフラグは名前とコメントの両方に適用されるため、
+// フラグと名前のエンコーディングが一致しない場合は、名前もコメントと同じエンコーディングに変換します
+func SetEntryComment(fh *zip.FileHeader, comment string, enc common.TextEncoding) error {
+	encoded, err := EncodeComment(comment, enc)
+	if err != nil {
+		return err
+	}
+
+	utf8Flag := fh.Flags&FlagUTF8 != 0
+	if (enc == common.EncodingUTF8) != utf8Flag && !isASCII(fh.Name) {
+		name := fh.Name
+		if !utf8Flag {
+			name = common.AutoDetectEncoding(name)
+		}
+		if name, err = common.EncodeText(name, enc); err != nil {
+			return fmt.Errorf("名前を%sに変換できません: %w", enc, err)
+		}
+		fh.Name = name
+	}
+	if enc == common.EncodingUTF8 {
+		fh.Flags |= FlagUTF8
+	} else {
+		fh.Flags &^= FlagUTF8
+	}
+	fh.NonUTF8 = fh.Flags&FlagUTF8 == 0
+	fh.Comment = encoded
+	return nil
+}
+
+// isASCII は文字列がASCII文字だけからなるかどうかを返します
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
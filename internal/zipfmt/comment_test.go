@@ -0,0 +1,117 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"zip-editor/internal/common"
+)
+
+// コメントは指定したエンコーディングで設定し、言語エンコーディングフラグが切り替わる場合は名前も同じエンコーディングに変換する
+func TestSetEntryComment(t *testing.T) {
+	sjis := func(s string) string {
+		encoded, err := common.EncodeText(s, common.EncodingShiftJIS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+	tests := []struct {
+		name     string
+		header   zip.FileHeader
+		comment  string
+		enc      common.TextEncoding
+		wantName string
+		wantFlag bool // 言語エンコーディングフラグ（UTF-8）
+		wantText string
+	}{
+		{name: "ASCIIの名前・UTF-8", header: zip.FileHeader{Name: "a.txt"}, comment: "コメント", enc: common.EncodingUTF8,
+			wantName: "a.txt", wantFlag: true, wantText: "コメント"},
+		{name: "ASCIIの名前・Shift-JIS", header: zip.FileHeader{Name: "a.txt", Flags: FlagUTF8}, comment: "コメント", enc: common.EncodingShiftJIS,
+			wantName: "a.txt", wantFlag: false, wantText: sjis("コメント")},
+		{name: "UTF-8の名前をShift-JISに変換する", header: zip.FileHeader{Name: "日本語.txt", Flags: FlagUTF8}, comment: "コメント", enc: common.EncodingShiftJIS,
+			wantName: sjis("日本語.txt"), wantFlag: false, wantText: sjis("コメント")},
+		{name: "Shift-JISの名前をUTF-8に変換する", header: zip.FileHeader{Name: sjis("日本語.txt")}, comment: "コメント", enc: common.EncodingUTF8,
+			wantName: "日本語.txt", wantFlag: true, wantText: "コメント"},
+		{name: "Shift-JISの名前のまま", header: zip.FileHeader{Name: sjis("日本語.txt")}, comment: "コメント", enc: common.EncodingShiftJIS,
+			wantName: sjis("日本語.txt"), wantFlag: false, wantText: sjis("コメント")},
+		{name: "コメントを削除する", header: zip.FileHeader{Name: "日本語.txt", Flags: FlagUTF8, Comment: "以前のコメント"}, comment: "", enc: common.EncodingUTF8,
+			wantName: "日本語.txt", wantFlag: true, wantText: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fh := tt.header
+			if err := SetEntryComment(&fh, tt.comment, tt.enc); err != nil {
+				t.Fatal(err)
+			}
+			if fh.Name != tt.wantName {
+				t.Errorf("名前 = %q, want %q", fh.Name, tt.wantName)
+			}
+			if got := fh.Flags&FlagUTF8 != 0; got != tt.wantFlag || fh.NonUTF8 == tt.wantFlag {
+				t.Errorf("言語エンコーディングフラグ = %v (NonUTF8 = %v), want %v", got, fh.NonUTF8, tt.wantFlag)
+			}
+			if fh.Comment != tt.wantText {
+				t.Errorf("コメント = %q, want %q", fh.Comment, tt.wantText)
+			}
+
+			// 書き込んだものを読み取っても、名前とコメントが変わらない
+			var buf bytes.Buffer
+			zw := zip.NewWriter(&buf)
+			if _, err := zw.CreateHeader(&fh); err != nil {
+				t.Fatal(err)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			f := openZip(t, buf.Bytes()).File[0]
+			if f.Name != tt.wantName || f.Comment != tt.wantText || (f.Flags&FlagUTF8 != 0) != tt.wantFlag {
+				t.Errorf("読み取ったエントリ = %q %q フラグ %v", f.Name, f.Comment, f.Flags&FlagUTF8 != 0)
+			}
+		})
+	}
+}
+
+// 指定したエンコーディングで表現できないコメントと、65535バイトを超えるコメントは設定しない
+func TestSetEntryCommentErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		comment string
+		enc     common.TextEncoding
+		wantErr bool
+	}{
+		{name: "65535バイト", comment: strings.Repeat("a", 65535), enc: common.EncodingUTF8},
+		{name: "65536バイト", comment: strings.Repeat("a", 65536), enc: common.EncodingUTF8, wantErr: true},
+		// UTF-8では3バイト、Shift-JISでは2バイトの文字
+		{name: "Shift-JISで65534バイト", comment: strings.Repeat("あ", 32767), enc: common.EncodingShiftJIS},
+		{name: "Shift-JISで65536バイト", comment: strings.Repeat("あ", 32768), enc: common.EncodingShiftJIS, wantErr: true},
+		{name: "UTF-8で65535バイトを超える", comment: strings.Repeat("あ", 21846), enc: common.EncodingUTF8, wantErr: true},
+		{name: "Shift-JISで表現できない文字", comment: "絵文字 😀", enc: common.EncodingShiftJIS, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fh := zip.FileHeader{Name: "日本語.txt", Flags: FlagUTF8, Comment: "以前のコメント"}
+			err := SetEntryComment(&fh, tt.comment, tt.enc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want エラー %v", err, tt.wantErr)
+			}
+			if _, encErr := EncodeComment(tt.comment, tt.enc); (encErr != nil) != tt.wantErr {
+				t.Errorf("EncodeComment: err = %v, want エラー %v", encErr, tt.wantErr)
+			}
+			// 失敗した場合はヘッダーを変更しない
+			if err != nil && (fh.Name != "日本語.txt" || fh.Flags != FlagUTF8 || fh.Comment != "以前のコメント") {
+				t.Errorf("失敗したのにヘッダーが変更されています: %q %q フラグ %x", fh.Name, fh.Comment, fh.Flags)
+			}
+		})
+	}
+
+	// 名前をコメントと同じエンコーディングに変換できない場合も設定しない
+	fh := zip.FileHeader{Name: "😀.txt", Flags: FlagUTF8}
+	if err := SetEntryComment(&fh, "コメント", common.EncodingShiftJIS); err == nil {
+		t.Error("Shift-JISで表現できない名前のエントリに、Shift-JISのコメントを設定できてしまいました")
+	}
+	if fh.Name != "😀.txt" || fh.Flags != FlagUTF8 || fh.Comment != "" {
+		t.Errorf("失敗したのにヘッダーが変更されています: %q %q フラグ %x", fh.Name, fh.Comment, fh.Flags)
+	}
+}
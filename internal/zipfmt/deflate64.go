@@ -0,0 +1,430 @@
+package zipfmt
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// Deflate64（Enhanced Deflate）の展開処理
+// Deflateとの違いは、参照できる距離が64KBに広がっていること（距離符号30・31を使用）と、
+// 長さ符号285が「長さ258」ではなく「3＋16ビットの追加値」を表すことの2点です
+
+const (
+	deflate64Window   = 1 << 16
+	deflate64MaxBits  = 15
+	deflate64OutChunk = 1 << 15 // 一度に展開してバッファに貯める目安のバイト数
+)
+
+var errDeflate64Data = errors.New("Deflate64のデータが不正です")
+
+// 長さ符号（257〜285）の基本値と追加ビット数
+var deflate64LengthBase = [29]uint16{
+	3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+	35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 3,
+}
+var deflate64LengthExtra = [29]uint8{
+	0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+	3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 16,
+}
+
+// 距離符号（0〜31）の基本値と追加ビット数
+var deflate64DistBase = [32]uint32{
+	1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193,
+	257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577, 32769, 49153,
+}
+var deflate64DistExtra = [32]uint8{
+	0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6,
+	7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13, 14, 14,
+}
+
+// 符号長を送る順序
+var deflate64CodeLenOrder = [19]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+// huffman は符号長ごとの符号数と、符号順に並べたシンボルによる正規ハフマン符号の表です
+type huffman struct {
+	count  [deflate64MaxBits + 1]uint16
+	symbol []uint16
+}
+
+// build は各シンボルの符号長から表を作成します
+func (h *huffman) build(lengths []uint8) error {
+	h.count = [deflate64MaxBits + 1]uint16{}
+	for _, l := range lengths {
+		h.count[l]++
+	}
+	if int(h.count[0]) == len(lengths) {
+		// 符号がひとつもない（距離符号を使わないブロックなど）
+		h.symbol = h.symbol[:0]
+		return nil
+	}
+
+	// 符号が多すぎないか確認（不足は許容する）
+	left := 1
+	for l := 1; l <= deflate64MaxBits; l++ {
+		left = left<<1 - int(h.count[l])
+		if left < 0 {
+			return errDeflate64Data
+		}
+	}
+
+	var offs [deflate64MaxBits + 2]uint16
+	for l := 1; l <= deflate64MaxBits; l++ {
+		offs[l+1] = offs[l] + h.count[l]
+	}
+	h.symbol = make([]uint16, len(lengths))
+	for sym, l := range lengths {
+		if l != 0 {
+			h.symbol[offs[l]] = uint16(sym)
+			offs[l]++
+		}
+	}
+	return nil
+}
+
+// deflate64Reader はDeflate64形式のデータを展開するリーダーです
+type deflate64Reader struct {
+	r     io.ByteReader
+	bits  uint32
+	nbits uint
+
+	window [deflate64Window]byte
+	wpos   int
+	out    []byte
+
+	final   bool // 最後のブロックを読み始めたか
+	inBlock bool
+	stored  int // 非圧縮ブロックの残りバイト数（-1は圧縮ブロック）
+	lit     huffman
+	dist    huffman
+
+	// 長さ・距離の組で、まだ出力しきっていない残り
+	copyLen  int
+	copyDist int
+
+	err error
+}
+
+// newDeflate64Reader はDeflate64形式のデータを展開するリーダーを返します
+func newDeflate64Reader(r io.Reader) io.ReadCloser {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &deflate64Reader{r: br}
+}
+
+func (d *deflate64Reader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.step()
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+func (d *deflate64Reader) Close() error {
+	return nil
+}
+
+// needBits は n ビットをビットバッファに読み込みます
+func (d *deflate64Reader) needBits(n uint) error {
+	for d.nbits < n {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		d.bits |= uint32(b) << d.nbits
+		d.nbits += 8
+	}
+	return nil
+}
+
+// readBits は下位ビットから n ビットを読み取ります
+func (d *deflate64Reader) readBits(n uint) (int, error) {
+	if err := d.needBits(n); err != nil {
+		return 0, err
+	}
+	v := int(d.bits & (1<<n - 1))
+	d.bits >>= n
+	d.nbits -= n
+	return v, nil
+}
+
+// decode はハフマン符号をひとつ読み取り、シンボルを返します
+func (d *deflate64Reader) decode(h *huffman) (int, error) {
+	code, first, index := 0, 0, 0
+	for l := 1; l <= deflate64MaxBits; l++ {
+		bit, err := d.readBits(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= bit
+		count := int(h.count[l])
+		if code-count < first {
+			return int(h.symbol[index+code-first]), nil
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return 0, errDeflate64Data
+}
+
+// emit は1バイトを出力し、スライド窓に記録します
+func (d *deflate64Reader) emit(b byte) {
+	d.window[d.wpos] = b
+	d.wpos = (d.wpos + 1) & (deflate64Window - 1)
+	d.out = append(d.out, b)
+}
+
+// step はブロックの一部を展開して出力バッファに追加します
+// 最後のブロックを読み終えた場合は io.EOF を返します
+func (d *deflate64Reader) step() error {
+	d.out = d.out[:0]
+
+	if !d.inBlock {
+		if d.final {
+			return io.EOF
+		}
+		if err := d.readBlockHeader(); err != nil {
+			return err
+		}
+	}
+
+	if d.stored >= 0 {
+		for d.stored > 0 && len(d.out) < deflate64OutChunk {
+			b, err := d.r.ReadByte()
+			if err != nil {
+				if err == io.EOF {
+					return io.ErrUnexpectedEOF
+				}
+				return err
+			}
+			d.emit(b)
+			d.stored--
+		}
+		if d.stored == 0 {
+			d.inBlock = false
+		}
+		return nil
+	}
+
+	for len(d.out) < deflate64OutChunk {
+		if d.copyLen > 0 {
+			d.emit(d.window[(d.wpos-d.copyDist)&(deflate64Window-1)])
+			d.copyLen--
+			continue
+		}
+
+		sym, err := d.decode(&d.lit)
+		if err != nil {
+			return err
+		}
+		switch {
+		case sym < 256:
+			d.emit(byte(sym))
+		case sym == 256:
+			d.inBlock = false
+			return nil
+		default:
+			if err := d.readMatch(sym - 257); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readMatch は長さ符号に続く追加ビットと距離を読み取ります
+func (d *deflate64Reader) readMatch(lenCode int) error {
+	if lenCode >= len(deflate64LengthBase) {
+		return errDeflate64Data
+	}
+	extra, err := d.readBits(uint(deflate64LengthExtra[lenCode]))
+	if err != nil {
+		return err
+	}
+	length := int(deflate64LengthBase[lenCode]) + extra
+
+	distCode, err := d.decode(&d.dist)
+	if err != nil {
+		return err
+	}
+	if distCode >= len(deflate64DistBase) {
+		return errDeflate64Data
+	}
+	extra, err = d.readBits(uint(deflate64DistExtra[distCode]))
+	if err != nil {
+		return err
+	}
+	d.copyLen = length
+	d.copyDist = int(deflate64DistBase[distCode]) + extra
+	return nil
+}
+
+// readBlockHeader はブロックの種類を読み取り、必要な符号表を準備します
+func (d *deflate64Reader) readBlockHeader() error {
+	final, err := d.readBits(1)
+	if err != nil {
+		return err
+	}
+	d.final = final == 1
+	typ, err := d.readBits(2)
+	if err != nil {
+		return err
+	}
+
+	d.inBlock = true
+	d.stored = -1
+	switch typ {
+	case 0:
+		return d.readStoredHeader()
+	case 1:
+		return d.fixedTables()
+	case 2:
+		return d.dynamicTables()
+	}
+	return errDeflate64Data
+}
+
+// readStoredHeader は非圧縮ブロックの長さを読み取ります
+func (d *deflate64Reader) readStoredHeader() error {
+	// バイト境界までの残りビットを捨てる
+	d.bits >>= d.nbits % 8
+	d.nbits -= d.nbits % 8
+
+	var v [4]int
+	for i := range v {
+		b, err := d.readBits(8)
+		if err != nil {
+			return err
+		}
+		v[i] = b
+	}
+	length := v[0] | v[1]<<8
+	if length != ^(v[2]|v[3]<<8)&0xffff {
+		return errDeflate64Data
+	}
+	d.stored = length
+	if length == 0 {
+		d.inBlock = false
+	}
+	return nil
+}
+
+// fixedTables は固定ハフマン符号の表を準備します
+func (d *deflate64Reader) fixedTables() error {
+	var lengths [288 + 32]uint8
+	for i := range 288 {
+		switch {
+		case i < 144:
+			lengths[i] = 8
+		case i < 256:
+			lengths[i] = 9
+		case i < 280:
+			lengths[i] = 7
+		default:
+			lengths[i] = 8
+		}
+	}
+	for i := 288; i < len(lengths); i++ {
+		lengths[i] = 5
+	}
+	if err := d.lit.build(lengths[:288]); err != nil {
+		return err
+	}
+	return d.dist.build(lengths[288:])
+}
+
+// dynamicTables はブロックの先頭に記録された符号長から符号表を作成します
+func (d *deflate64Reader) dynamicTables() error {
+	nlen, err := d.readBits(5)
+	if err != nil {
+		return err
+	}
+	ndist, err := d.readBits(5)
+	if err != nil {
+		return err
+	}
+	ncode, err := d.readBits(4)
+	if err != nil {
+		return err
+	}
+	nlen += 257
+	ndist++
+	ncode += 4
+	if nlen > 288 {
+		return errDeflate64Data
+	}
+
+	// 符号長を符号化するための符号表
+	var codeLens [19]uint8
+	for i := range ncode {
+		v, err := d.readBits(3)
+		if err != nil {
+			return err
+		}
+		codeLens[deflate64CodeLenOrder[i]] = uint8(v)
+	}
+	var lencode huffman
+	if err := lencode.build(codeLens[:]); err != nil {
+		return err
+	}
+
+	lengths := make([]uint8, nlen+ndist)
+	for i := 0; i < len(lengths); {
+		sym, err := d.decode(&lencode)
+		if err != nil {
+			return err
+		}
+		if sym < 16 {
+			lengths[i] = uint8(sym)
+			i++
+			continue
+		}
+
+		var prev uint8
+		var repeat int
+		switch sym {
+		case 16:
+			if i == 0 {
+				return errDeflate64Data
+			}
+			prev = lengths[i-1]
+			repeat, err = d.readBits(2)
+			repeat += 3
+		case 17:
+			repeat, err = d.readBits(3)
+			repeat += 3
+		default:
+			repeat, err = d.readBits(7)
+			repeat += 11
+		}
+		if err != nil {
+			return err
+		}
+		if i+repeat > len(lengths) {
+			return errDeflate64Data
+		}
+		for ; repeat > 0; repeat-- {
+			lengths[i] = prev
+			i++
+		}
+	}
+
+	if lengths[256] == 0 {
+		// ブロックの終端符号がない
+		return errDeflate64Data
+	}
+	if err := d.lit.build(lengths[:nlen]); err != nil {
+		return err
+	}
+	return d.dist.build(lengths[nlen:])
+}
@@ -0,0 +1,205 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// deflate64Op はテスト用のDeflate64のデータを作る操作です（length が0の場合はリテラル）
+type deflate64Op struct {
+	literal  []byte
+	length   int
+	distance int
+}
+
+func TestDeflate64(t *testing.T) {
+	random := make([]byte, 50000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	tests := []struct {
+		name string
+		ops  []deflate64Op
+	}{
+		{name: "リテラルのみ", ops: []deflate64Op{{literal: []byte("ZIP Editor")}}},
+		{name: "短い一致", ops: []deflate64Op{{literal: []byte("abc")}, {length: 10, distance: 3}}},
+		// Deflateにはない距離符号30・31（32KBを超える距離）
+		{name: "32KBを超える距離", ops: []deflate64Op{{literal: random}, {length: 100, distance: 45000}, {length: 5, distance: 65536 - 50100}}},
+		// 長さ符号285は「長さ258」ではなく「3＋16ビットの追加値」
+		{name: "長さ符号285", ops: []deflate64Op{{literal: []byte("xy")}, {length: 3 + 0xffff, distance: 2}, {length: 258, distance: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed, want := encodeFixedDeflate64(tt.ops)
+			got, err := io.ReadAll(newDeflate64Reader(bytes.NewReader(compressed)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("展開した内容が一致しません（%d バイト, want %d バイト）", len(got), len(want))
+			}
+		})
+	}
+}
+
+// 長さ258の一致を含まないDeflateのデータは、Deflate64としても同じ内容に展開できる
+// （非圧縮ブロック・動的ハフマン符号の読み取りを確認する）
+func TestDeflate64ReadsDeflate(t *testing.T) {
+	words := strings.Fields("zip editor deflate64 圧縮 展開 アーカイブ entry header crc")
+	rng := rand.New(rand.NewSource(2))
+	var text bytes.Buffer
+	for text.Len() < 200000 {
+		text.WriteString(words[rng.Intn(len(words))])
+		text.WriteByte(" \n"[rng.Intn(2)])
+	}
+	for _, level := range []int{flate.NoCompression, flate.BestSpeed, flate.BestCompression} {
+		var compressed bytes.Buffer
+		fw, _ := flate.NewWriter(&compressed, level)
+		fw.Write(text.Bytes())
+		fw.Close()
+
+		got, err := io.ReadAll(newDeflate64Reader(&compressed))
+		if err != nil {
+			t.Fatalf("レベル %d: %v", level, err)
+		}
+		if !bytes.Equal(got, text.Bytes()) {
+			t.Errorf("レベル %d: 展開した内容が一致しません", level)
+		}
+	}
+}
+
+// ZIPのエントリとして格納されたDeflate64のデータを、通常のエントリと同じように読み取れる
+func TestDeflate64Entry(t *testing.T) {
+	compressed, want := encodeFixedDeflate64([]deflate64Op{{literal: []byte("Deflate64 ")}, {length: 1000, distance: 10}})
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "a.txt",
+		Method:             MethodDeflate64,
+		CRC32:              crc32.ChecksumIEEE(want),
+		CompressedSize64:   uint64(len(compressed)),
+		UncompressedSize64: uint64(len(want)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(compressed)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := openZip(t, buf.Bytes())
+	got, err := readAll(OpenFile(r.File[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("展開した内容が一致しません")
+	}
+	if err := VerifyFile(r.File[0]); err != nil {
+		t.Errorf("VerifyFile = %v", err)
+	}
+}
+
+func TestDeflate64Errors(t *testing.T) {
+	compressed, _ := encodeFixedDeflate64([]deflate64Op{{literal: testText(1000)}})
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "途中で終わっている", data: compressed[:len(compressed)/2], want: io.ErrUnexpectedEOF},
+		{name: "不正なブロックの種類", data: []byte{0x07}, want: errDeflate64Data},
+		{name: "非圧縮ブロックの長さが不正", data: []byte{0x01, 0x05, 0x00, 0x00, 0x00}, want: errDeflate64Data},
+	}
+	for _, tt := range tests {
+		if _, err := io.ReadAll(newDeflate64Reader(bytes.NewReader(tt.data))); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// encodeFixedDeflate64 は固定ハフマン符号のブロックひとつからなるDeflate64のデータと、展開した内容を返します
+func encodeFixedDeflate64(ops []deflate64Op) (compressed, plain []byte) {
+	var bw bitWriter
+	bw.writeBits(1, 1) // 最後のブロック
+	bw.writeBits(1, 2) // 固定ハフマン符号
+	for _, op := range ops {
+		if op.length == 0 {
+			for _, b := range op.literal {
+				bw.writeFixedLiteral(int(b))
+			}
+			plain = append(plain, op.literal...)
+			continue
+		}
+
+		code := len(deflate64LengthBase) - 1 // 258を超える長さは長さ符号285
+		if op.length <= 258 {
+			for code = 0; code+2 < len(deflate64LengthBase) && int(deflate64LengthBase[code+1]) <= op.length; code++ {
+			}
+		}
+		bw.writeFixedLiteral(257 + code)
+		bw.writeBits(op.length-int(deflate64LengthBase[code]), uint(deflate64LengthExtra[code]))
+
+		dist := 0
+		for dist+1 < len(deflate64DistBase) && int(deflate64DistBase[dist+1]) <= op.distance {
+			dist++
+		}
+		bw.writeCode(dist, 5)
+		bw.writeBits(op.distance-int(deflate64DistBase[dist]), uint(deflate64DistExtra[dist]))
+
+		for range op.length {
+			plain = append(plain, plain[len(plain)-op.distance])
+		}
+	}
+	bw.writeFixedLiteral(256)
+	return bw.bytes(), plain
+}
+
+// bitWriter はDeflateのビット列（下位ビットから詰める）を作ります
+type bitWriter struct {
+	buf   []byte
+	nbits uint
+}
+
+// writeBits は値を下位ビットから n ビット書き込みます（追加ビットなど）
+func (w *bitWriter) writeBits(v int, n uint) {
+	for i := uint(0); i < n; i++ {
+		if w.nbits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		w.buf[len(w.buf)-1] |= byte(v>>i&1) << (w.nbits % 8)
+		w.nbits++
+	}
+}
+
+// writeCode はハフマン符号を上位ビットから n ビット書き込みます
+func (w *bitWriter) writeCode(code int, n uint) {
+	for i := n; i > 0; i-- {
+		w.writeBits(code>>(i-1)&1, 1)
+	}
+}
+
+// writeFixedLiteral はリテラル・長さのシンボルを固定ハフマン符号で書き込みます
+func (w *bitWriter) writeFixedLiteral(sym int) {
+	switch {
+	case sym < 144:
+		w.writeCode(0x30+sym, 8)
+	case sym < 256:
+		w.writeCode(0x190+sym-144, 9)
+	case sym < 280:
+		w.writeCode(sym-256, 7)
+	default:
+		w.writeCode(0xc0+sym-280, 8)
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	return w.buf
+}
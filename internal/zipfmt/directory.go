@@ -0,0 +1,260 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	endLen        = 22 // 中央ディレクトリ終端レコードの固定長部分
+	end64Len      = 56 // ZIP64終端レコードの固定長部分
+	end64LocLen   = 20 // ZIP64終端ロケーターの長さ
+	centralLen    = 46 // 中央ディレクトリヘッダの固定長部分
+	maxCommentLen = 65535
+	uint16max     = 0xffff
+)
+
+var (
+	errNoEndRecord      = errors.New("中央ディレクトリ終端レコードが見つかりません")
+	errBadCentralHeader = errors.New("中央ディレクトリヘッダが壊れています")
+)
+
+// DirEntry は中央ディレクトリに記録された1エントリです
+// FileHeader.Name と Comment はデコード前の生のバイト列です
+type DirEntry struct {
+	zip.FileHeader
+	HeaderOffset  int64  // ローカルファイルヘッダの位置（記録値。ZIP64拡張情報を反映済み）
+	Disk          uint32 // ローカルファイルヘッダがあるディスク番号
+	InternalAttrs uint16
+}
+
+// Directory は中央ディレクトリ全体の情報です
+type Directory struct {
+	Entries   []*DirEntry
+	Comment   []byte
+	Offset    int64  // 中央ディレクトリの開始位置（記録値）
+	Size      int64  // 中央ディレクトリのサイズ
+	EndOffset int64  // 中央ディレクトリ終端レコードの実際の位置
+	Disk      uint32 // 終端レコードがあるディスク番号
+	StartDisk uint32 // 中央ディレクトリが始まるディスク番号
+	Zip64     bool   // ZIP64終端レコードが存在するかどうか
+	// BaseOffset は記録値と実際の位置のずれです
+	// 先頭に自己解凍スタブなどが付加されている場合に正の値になります
+	BaseOffset int64
+
+	end64Offset int64 // ZIP64終端レコードの実際の位置
+}
+
+// ReadDirectory はアーカイブ末尾から終端レコードを探し、中央ディレクトリを解析します
+// 分割アーカイブの場合は、最後のボリュームに中央ディレクトリ全体が含まれている必要があります
+func ReadDirectory(r io.ReaderAt, size int64) (*Directory, error) {
+	dir, records, err := readEndRecords(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	// 実際の中央ディレクトリの位置から、先頭に付加されたデータの長さを求める
+	cdEnd := dir.EndOffset
+	if dir.Zip64 {
+		cdEnd = dir.end64Offset
+	}
+	dir.BaseOffset = cdEnd - dir.Size - dir.Offset
+	if dir.Disk != 0 {
+		// 分割アーカイブでは最後のボリューム内の相対位置として扱う
+		dir.BaseOffset = 0
+	}
+	cdStart := dir.BaseOffset + dir.Offset
+	if cdStart < 0 || cdStart+dir.Size > size {
+		return nil, errBadCentralHeader
+	}
+	if err := readCentral(r, dir, cdStart, records); err != nil {
+		return nil, err
+	}
+	return dir, nil
+}
+
+// readEndRecords は中央ディレクトリ終端レコード（とZIP64終端レコード）を読み取ります
+// 中央ディレクトリのエントリ数の記録値も返します
+func readEndRecords(r io.ReaderAt, size int64) (*Directory, uint64, error) {
+	endOff, err := FindEndRecord(r, size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var buf [endLen]byte
+	if _, err := r.ReadAt(buf[:], endOff); err != nil {
+		return nil, 0, err
+	}
+	b := buf[4:]
+	dir := &Directory{
+		EndOffset: endOff,
+		Disk:      uint32(binary.LittleEndian.Uint16(b[0:2])),
+		StartDisk: uint32(binary.LittleEndian.Uint16(b[2:4])),
+		Size:      int64(binary.LittleEndian.Uint32(b[8:12])),
+		Offset:    int64(binary.LittleEndian.Uint32(b[12:16])),
+	}
+	records := uint64(binary.LittleEndian.Uint16(b[6:8]))
+	commentLen := int64(binary.LittleEndian.Uint16(b[16:18]))
+	dir.Comment = make([]byte, commentLen)
+	if _, err := r.ReadAt(dir.Comment, endOff+endLen); err != nil && !errors.Is(err, io.EOF) {
+		return nil, 0, err
+	}
+
+	// ZIP64終端ロケーターがあればZIP64終端レコードの値で置き換える
+	if endOff >= end64LocLen {
+		var loc [end64LocLen]byte
+		if _, err := r.ReadAt(loc[:], endOff-end64LocLen); err == nil &&
+			binary.LittleEndian.Uint32(loc[:]) == End64LocatorSignature {
+			if err := readEnd64(r, dir, endOff-end64LocLen, &records); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	return dir, records, nil
+}
+
+// readCentral は cdStart から中央ディレクトリを読み取り、エントリを dir に追加します
+func readCentral(r io.ReaderAt, dir *Directory, cdStart int64, records uint64) error {
+	cd := make([]byte, dir.Size)
+	if _, err := r.ReadAt(cd, cdStart); err != nil {
+		return err
+	}
+	for len(cd) > 0 {
+		entry, n, err := parseCentralHeader(cd)
+		if err != nil {
+			return err
+		}
+		dir.Entries = append(dir.Entries, entry)
+		cd = cd[n:]
+	}
+	if uint64(len(dir.Entries))&uint16max != records&uint16max {
+		return errBadCentralHeader
+	}
+	return nil
+}
+
+// readEnd64 はZIP64終端ロケーターとZIP64終端レコードを読み取ります
+func readEnd64(r io.ReaderAt, dir *Directory, locOff int64, records *uint64) error {
+	var loc [end64LocLen]byte
+	if _, err := r.ReadAt(loc[:], locOff); err != nil {
+		return err
+	}
+	end64Off := int64(binary.LittleEndian.Uint64(loc[8:16]))
+
+	// 先頭にデータが付加されている場合は記録値がずれるため、ロケーターの直前も確認する
+	var buf [end64Len]byte
+	candidates := []int64{end64Off, locOff - end64Len}
+	found := false
+	for _, off := range candidates {
+		if off < 0 {
+			continue
+		}
+		if _, err := r.ReadAt(buf[:], off); err != nil {
+			continue
+		}
+		if binary.LittleEndian.Uint32(buf[:]) == End64Signature {
+			dir.end64Offset = off
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errNoEndRecord
+	}
+
+	b := buf[16:]
+	dir.Disk = binary.LittleEndian.Uint32(b[0:4])
+	dir.StartDisk = binary.LittleEndian.Uint32(b[4:8])
+	*records = binary.LittleEndian.Uint64(b[16:24])
+	dir.Size = int64(binary.LittleEndian.Uint64(b[24:32]))
+	dir.Offset = int64(binary.LittleEndian.Uint64(b[32:40]))
+	dir.Zip64 = true
+	return nil
+}
+
+// parseCentralHeader は中央ディレクトリヘッダを1件解析し、消費したバイト数を返します
+func parseCentralHeader(b []byte) (*DirEntry, int, error) {
+	if len(b) < centralLen || binary.LittleEndian.Uint32(b) != CentralHeaderSignature {
+		return nil, 0, errBadCentralHeader
+	}
+	nameLen := int(binary.LittleEndian.Uint16(b[28:30]))
+	extraLen := int(binary.LittleEndian.Uint16(b[30:32]))
+	commentLen := int(binary.LittleEndian.Uint16(b[32:34]))
+	total := centralLen + nameLen + extraLen + commentLen
+	if len(b) < total {
+		return nil, 0, errBadCentralHeader
+	}
+
+	entry := &DirEntry{
+		FileHeader: zip.FileHeader{
+			CreatorVersion:     binary.LittleEndian.Uint16(b[4:6]),
+			ReaderVersion:      binary.LittleEndian.Uint16(b[6:8]),
+			Flags:              binary.LittleEndian.Uint16(b[8:10]),
+			Method:             binary.LittleEndian.Uint16(b[10:12]),
+			ModifiedTime:       binary.LittleEndian.Uint16(b[12:14]),
+			ModifiedDate:       binary.LittleEndian.Uint16(b[14:16]),
+			CRC32:              binary.LittleEndian.Uint32(b[16:20]),
+			CompressedSize64:   uint64(binary.LittleEndian.Uint32(b[20:24])),
+			UncompressedSize64: uint64(binary.LittleEndian.Uint32(b[24:28])),
+			ExternalAttrs:      binary.LittleEndian.Uint32(b[38:42]),
+		},
+		Disk:          uint32(binary.LittleEndian.Uint16(b[34:36])),
+		InternalAttrs: binary.LittleEndian.Uint16(b[36:38]),
+		HeaderOffset:  int64(binary.LittleEndian.Uint32(b[42:46])),
+	}
+	entry.Name = string(b[centralLen : centralLen+nameLen])
+	entry.Extra = append([]byte(nil), b[centralLen+nameLen:centralLen+nameLen+extraLen]...)
+	entry.Comment = string(b[centralLen+nameLen+extraLen : total])
+	entry.NonUTF8 = entry.Flags&FlagUTF8 == 0
+
+	// ZIP64拡張情報には、32ビットに収まらなかった項目だけが順に記録される
+	if data, ok := FindExtra(entry.Extra, Zip64ExtraID); ok {
+		if entry.UncompressedSize64 == uint32max && len(data) >= 8 {
+			entry.UncompressedSize64 = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		}
+		if entry.CompressedSize64 == uint32max && len(data) >= 8 {
+			entry.CompressedSize64 = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		}
+		if entry.HeaderOffset == uint32max && len(data) >= 8 {
+			entry.HeaderOffset = int64(binary.LittleEndian.Uint64(data))
+			data = data[8:]
+		}
+		if entry.Disk == uint16max && len(data) >= 4 {
+			entry.Disk = binary.LittleEndian.Uint32(data)
+		}
+	}
+	entry.CompressedSize = uint32(min(entry.CompressedSize64, uint32max))
+	entry.UncompressedSize = uint32(min(entry.UncompressedSize64, uint32max))
+
+	return entry, total, nil
+}
+
+// FindEndRecord は中央ディレクトリ終端レコードの位置を末尾から探します
+func FindEndRecord(r io.ReaderAt, size int64) (int64, error) {
+	// コメントの最大長を考慮して末尾から読み込む
+	readLen := int64(endLen + maxCommentLen)
+	if readLen > size {
+		readLen = size
+	}
+	buf := make([]byte, readLen)
+	if _, err := r.ReadAt(buf, size-readLen); err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+
+	for i := len(buf) - endLen; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(buf[i:]) != EndSignature {
+			continue
+		}
+		// コメント長がファイル末尾と整合するものだけを採用する
+		commentLen := int(binary.LittleEndian.Uint16(buf[i+20:]))
+		if i+endLen+commentLen <= len(buf) {
+			return size - readLen + int64(i), nil
+		}
+	}
+	return 0, errNoEndRecord
+}
@@ -0,0 +1,248 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// Encryption は保存時にエントリを暗号化する方式です
+type Encryption int
+
+const (
+	EncryptionZipCrypto Encryption = iota // 従来のPKWARE暗号（互換性は高いが脆弱）
+	EncryptionAES256                      // WinZip AES-256
+)
+
+// 圧縮方式の表示名
+var methodNames = map[uint16]string{
+	zip.Store:   "Store",
+	zip.Deflate: "Deflate",
+	9:           "Deflate64",
+	12:          "BZIP2",
+	14:          "LZMA",
+	93:          "Zstandard",
+	95:          "XZ",
+	98:          "PPMd",
+	methodAES:   "AES",
+}
+
+// MethodName は圧縮方式の表示名を返します
+func MethodName(method uint16) string {
+	if name, ok := methodNames[method]; ok {
+		return name
+	}
+	return fmt.Sprintf("方式%d", method)
+}
+
+// ActualMethod はエントリの実際の圧縮方式を返します
+// AES暗号化されている場合は、拡張フィールドに記録された暗号化前の圧縮方式を返します
+func ActualMethod(fh *zip.FileHeader) uint16 {
+	if info, ok := ParseAESExtra(fh); ok {
+		return info.Method
+	}
+	return fh.Method
+}
+
+// EncryptionName はエントリの暗号化方式の表示名を返します
+// 暗号化されていない場合は空文字列を返します
+func EncryptionName(fh *zip.FileHeader) string {
+	if fh.Flags&FlagEncrypted == 0 {
+		return ""
+	}
+	if info, ok := ParseAESExtra(fh); ok {
+		return info.Strength.String()
+	}
+	if IsZipCrypto(fh) {
+		return "ZipCrypto"
+	}
+	return "不明な暗号化"
+}
+
+// openRawAt はエントリの圧縮データ（暗号化されている場合は暗号化されたまま）をランダムアクセス可能な形で開きます
+func openRawAt(f *zip.File) (io.ReaderAt, error) {
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	rawAt, ok := raw.(io.ReaderAt)
+	if !ok {
+		return nil, ErrUnsupportedEncryption
+	}
+	return rawAt, nil
+}
+
+// openDecryptedRaw は暗号化を解除した圧縮データを読み取るリーダーと、そのサイズを返します
+// 暗号化されていないエントリの場合は圧縮データをそのまま返します
+func openDecryptedRaw(f *zip.File, password string) (io.Reader, int64, error) {
+	size := int64(f.CompressedSize64)
+	if f.Flags&FlagEncrypted == 0 {
+		raw, err := f.OpenRaw()
+		return raw, size, err
+	}
+
+	rawAt, err := openRawAt(f)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if info, ok := ParseAESExtra(&f.FileHeader); ok {
+		r, err := newAESReader(rawAt, size, info, password)
+		return r, size - aesOverhead(info.Strength), err
+	}
+	if IsZipCrypto(&f.FileHeader) {
+		r, err := newZipCryptoReader(rawAt, size, &f.FileHeader, password)
+		return r, size - zipCryptoHeaderLen, err
+	}
+	return nil, 0, ErrUnsupportedEncryption
+}
+
+// CheckPassword はパスワードが暗号化されたエントリに対して正しいかを、暗号化ヘッダの照合値で確認します
+// エントリのデータは読み取らないため、大きなエントリでもすぐに確認できます
+// ZipCryptoの照合は1バイト、AESは2バイトのため、まれに誤ったパスワードでも成功することがあります
+// その場合は OpenEncrypted で読み終えた時点のCRC・サイズ（AESの場合は認証コード）の照合で ErrPassword になります
+func CheckPassword(f *zip.File, password string) error {
+	_, _, err := openDecryptedRaw(f, password)
+	return err
+}
+
+// passwordReader は復号したデータを読み取り、展開や照合に失敗した場合はパスワードの誤りとして返すリーダーです
+type passwordReader struct {
+	io.Reader
+}
+
+func (p passwordReader) Read(b []byte) (int, error) {
+	n, err := p.Reader.Read(b)
+	return n, passwordError(err)
+}
+
+// passwordError は復号したデータの展開・照合に失敗したエラーを ErrPassword に変換します
+// 照合値が偶然一致した誤ったパスワードと、データの破損は区別できないため、どちらの可能性もあるエラーにします
+// ファイルの読み取り自体に失敗した場合と io.EOF はそのまま返します
+func passwordError(err error) error {
+	var pathErr *fs.PathError
+	if err == nil || err == io.EOF || errors.As(err, &pathErr) || errors.Is(err, ErrPassword) {
+		return err
+	}
+	return fmt.Errorf("%w（または、データが破損しています）", ErrPassword)
+}
+
+// OpenEncrypted は暗号化されたエントリを復号・展開して読み取るリーダーを返します
+// パスワードは照合値で確認し（CheckPassword）、読み終えた時点でCRCとサイズ（AESの場合は認証コードも）を照合します
+// 展開や照合に失敗した場合は、読み取りのエラーとして ErrPassword を返します
+func OpenEncrypted(f *zip.File, password string) (io.ReadCloser, error) {
+	if f.Flags&FlagEncrypted == 0 {
+		return nil, ErrUnsupportedEncryption
+	}
+
+	plain, _, err := openDecryptedRaw(f, password)
+	if err != nil {
+		return nil, err
+	}
+
+	dcomp := entryDecompressor(&f.FileHeader)
+	if dcomp == nil {
+		return nil, ErrUnsupportedMethod
+	}
+
+	// AE-2形式はCRCを記録しないため、認証コードの照合のみで完全性を確認する
+	checkCRC := true
+	if info, ok := ParseAESExtra(&f.FileHeader); ok && info.Version == aesVersionAE2 {
+		checkCRC = false
+	}
+	cr := newChecksumReader(dcomp(plain), f.CRC32, f.UncompressedSize64, checkCRC)
+	return struct {
+		io.Reader
+		io.Closer
+	}{passwordReader{cr}, cr}, nil
+}
+
+// copyVerified は復号した圧縮データ src を w に書き込みながら並行して展開し、読み終えた時点で f のCRCとサイズを照合します
+// 暗号化し直す前にエントリ全体を読み取って照合すると、大きなエントリを二度復号することになるため、書き込みと同時に照合します
+// 照合に失敗した場合は ErrPassword を返します（書き込んだデータは破棄する必要があります）
+func copyVerified(w io.Writer, src io.Reader, f *zip.File) error {
+	dcomp := entryDecompressor(&f.FileHeader)
+	if dcomp == nil {
+		return ErrUnsupportedMethod
+	}
+	checkCRC := true
+	if info, ok := ParseAESExtra(&f.FileHeader); ok && info.Version == aesVersionAE2 {
+		checkCRC = false
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		cr := newChecksumReader(dcomp(pr), f.CRC32, f.UncompressedSize64, checkCRC)
+		_, err := io.Copy(io.Discard, cr)
+		cr.Close()
+		if err == nil {
+			// 圧縮データの終端より後ろが残っていても書き込みを止めないように読み捨てる
+			_, err = io.Copy(io.Discard, pr)
+		}
+		err = passwordError(err)
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	_, err := io.Copy(w, io.TeeReader(passwordReader{src}, pw))
+	pw.CloseWithError(err)
+	if verifyErr := <-done; verifyErr != nil {
+		return verifyErr
+	}
+	return err
+}
+
+// CopyRawAES はエントリの圧縮データをAESで暗号化して書き込みます
+// すでに暗号化されているエントリは oldPassword で復号してから、password で暗号化し直します
+// 再圧縮は行わないため、圧縮率は元のエントリと同じです
+// 暗号化されたエントリは書き込みながら展開してCRCとサイズを照合し、誤ったパスワードで復号した場合は ErrPassword を返します
+func CopyRawAES(zw *zip.Writer, f *zip.File, fh *zip.FileHeader, oldPassword, password string, strength AESStrength) error {
+	header := f.FileHeader
+	if fh != nil {
+		header = *fh
+	}
+	// ディレクトリはデータを持たないため、シンボリックリンクは参照先をそのまま残すため暗号化しない
+	if isDirName(header.Name) || IsSymlink(&header) {
+		return CopyRaw(zw, f, &header)
+	}
+
+	src, plainSize, err := openDecryptedRaw(f, oldPassword)
+	if err != nil {
+		return err
+	}
+
+	// 小さなファイルやCRCが記録されていないエントリはAE-2形式で保存する
+	info := AESInfo{Version: aesVersionAE1, Strength: strength, Method: ActualMethod(&f.FileHeader)}
+	if old, ok := ParseAESExtra(&f.FileHeader); (ok && old.Version == aesVersionAE2) || header.UncompressedSize64 < aesSmallFileLimit {
+		info.Version = aesVersionAE2
+		header.CRC32 = 0
+	}
+
+	header.Method = methodAES
+	header.Flags |= FlagEncrypted
+	header.ReaderVersion = max(header.ReaderVersion, 51)
+	header.Extra = RemoveExtra(header.Extra, Zip64ExtraID, AESExtraID)
+	header.Extra = append(header.Extra, BuildExtra([]ExtraField{buildAESExtra(info)})...)
+	header.CompressedSize64 = uint64(plainSize + aesOverhead(strength))
+
+	writer, err := zw.CreateRaw(&header)
+	if err != nil {
+		return err
+	}
+	aw, err := newAESWriter(writer, password, strength)
+	if err != nil {
+		return err
+	}
+	if f.Flags&FlagEncrypted != 0 {
+		err = copyVerified(aw, src, f)
+	} else {
+		_, err = io.Copy(aw, src)
+	}
+	if err != nil {
+		return err
+	}
+	return aw.Close()
+}
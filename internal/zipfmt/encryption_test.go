@@ -0,0 +1,183 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	content := testText(5000)
+	tests := []struct {
+		name     string
+		method   uint16
+		data     []byte
+		encrypt  func(zw *zip.Writer, f *zip.File) error
+		wantAES  bool
+		wantName string
+	}{
+		{
+			name:     "ZipCrypto/Deflate",
+			method:   zip.Deflate,
+			data:     content,
+			encrypt:  func(zw *zip.Writer, f *zip.File) error { return CopyRawEncrypted(zw, f, nil, "secret") },
+			wantName: "ZipCrypto",
+		},
+		{
+			name:     "ZipCrypto/Store",
+			method:   zip.Store,
+			data:     content,
+			encrypt:  func(zw *zip.Writer, f *zip.File) error { return CopyRawEncrypted(zw, f, nil, "secret") },
+			wantName: "ZipCrypto",
+		},
+		{
+			name:     "AES-256/AE-1",
+			method:   zip.Deflate,
+			data:     content,
+			encrypt:  func(zw *zip.Writer, f *zip.File) error { return CopyRawAES(zw, f, nil, "", "secret", AES256) },
+			wantAES:  true,
+			wantName: "AES-256",
+		},
+		{
+			name:     "AES-128/AE-2",
+			method:   zip.Store,
+			data:     []byte("short"),
+			encrypt:  func(zw *zip.Writer, f *zip.File) error { return CopyRawAES(zw, f, nil, "", "secret", AES128) },
+			wantAES:  true,
+			wantName: "AES-128",
+		},
+		{
+			name:     "日本語のパスワード",
+			method:   zip.Deflate,
+			data:     content,
+			encrypt:  func(zw *zip.Writer, f *zip.File) error { return CopyRawAES(zw, f, nil, "", "ひみつ", AES256) },
+			wantAES:  true,
+			wantName: "AES-256",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := buildZip(t, []testEntry{{name: "a.txt", data: tt.data, method: tt.method}})
+			encrypted := rewriteZip(t, plain, tt.encrypt)
+			f := openZip(t, encrypted).File[0]
+
+			if got := EncryptionName(&f.FileHeader); got != tt.wantName {
+				t.Errorf("EncryptionName = %q, want %q", got, tt.wantName)
+			}
+			if got := ActualMethod(&f.FileHeader); got != tt.method {
+				t.Errorf("ActualMethod = %d, want %d", got, tt.method)
+			}
+			if _, ok := ParseAESExtra(&f.FileHeader); ok != tt.wantAES {
+				t.Errorf("ParseAESExtra ok = %v, want %v", ok, tt.wantAES)
+			}
+
+			password := "secret"
+			if tt.name == "日本語のパスワード" {
+				password = "ひみつ"
+			}
+			got, err := readAll(OpenEncrypted(f, password))
+			if err != nil {
+				t.Fatalf("OpenEncrypted: %v", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Fatal("復号した内容が元の内容と一致しません")
+			}
+			if err := CheckPassword(f, password); err != nil {
+				t.Errorf("CheckPassword(正しいパスワード) = %v", err)
+			}
+			if _, err := readAll(OpenEncrypted(f, "wrong")); !errors.Is(err, ErrPassword) {
+				t.Errorf("OpenEncrypted(誤ったパスワード) = %v, want ErrPassword", err)
+			}
+
+			// 別のパスワードでAESに暗号化し直しても内容が変わらない
+			reencrypted := rewriteZip(t, encrypted, func(zw *zip.Writer, f *zip.File) error {
+				return CopyRawAES(zw, f, nil, password, "new-secret", AES256)
+			})
+			got, err = readAll(OpenEncrypted(openZip(t, reencrypted).File[0], "new-secret"))
+			if err != nil {
+				t.Fatalf("暗号化し直したエントリ: %v", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Fatal("暗号化し直した内容が元の内容と一致しません")
+			}
+		})
+	}
+}
+
+// ZipCryptoのパスワードの照合は1バイトのため、誤ったパスワードでも約1/256の確率で CheckPassword を通過する
+// その場合も、読み終えた時点の照合と、暗号化し直しながらの照合（CopyRawAES）で失敗しなければならない
+func TestZipCryptoWeakCheck(t *testing.T) {
+	plain := buildZip(t, []testEntry{{name: "a.txt", data: testText(5000), method: zip.Deflate}})
+	encrypted := rewriteZip(t, plain, func(zw *zip.Writer, f *zip.File) error {
+		return CopyRawEncrypted(zw, f, nil, "secret")
+	})
+	f := openZip(t, encrypted).File[0]
+
+	wrong := ""
+	for i := 0; i < 100000 && wrong == ""; i++ {
+		candidate := fmt.Sprintf("wrong%d", i)
+		if CheckPassword(f, candidate) == nil {
+			wrong = candidate
+		}
+	}
+	if wrong == "" {
+		t.Fatal("照合値が一致する誤ったパスワードが見つかりません")
+	}
+
+	if _, err := readAll(OpenEncrypted(f, wrong)); !errors.Is(err, ErrPassword) {
+		t.Errorf("OpenEncrypted(%q) = %v, want ErrPassword", wrong, err)
+	}
+	r := openZip(t, encrypted)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if err := CopyRawAES(zw, r.File[0], nil, wrong, "new-secret", AES256); !errors.Is(err, ErrPassword) {
+		t.Errorf("CopyRawAES(%q) = %v, want ErrPassword", wrong, err)
+	}
+}
+
+// CheckPassword は暗号化ヘッダの照合値だけを確認し、データの破損は読み終えた時点の照合で検出する
+func TestCheckPasswordDoesNotReadData(t *testing.T) {
+	plain := buildZip(t, []testEntry{{name: "a.txt", data: testText(50 << 10), method: zip.Deflate}})
+	tests := []struct {
+		name    string
+		encrypt func(zw *zip.Writer, f *zip.File) error
+	}{
+		{name: "ZipCrypto", encrypt: func(zw *zip.Writer, f *zip.File) error { return CopyRawEncrypted(zw, f, nil, "secret") }},
+		{name: "AES-256", encrypt: func(zw *zip.Writer, f *zip.File) error { return CopyRawAES(zw, f, nil, "", "secret", AES256) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted := rewriteZip(t, plain, tt.encrypt)
+			f := openZip(t, encrypted).File[0]
+			off, err := f.DataOffset()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 暗号化ヘッダより後ろのデータを壊す
+			damaged := append([]byte(nil), encrypted...)
+			damaged[off+int64(f.CompressedSize64)/2] ^= 0xff
+			f = openZip(t, damaged).File[0]
+
+			if err := CheckPassword(f, "secret"); err != nil {
+				t.Errorf("CheckPassword = %v", err)
+			}
+			if _, err := readAll(OpenEncrypted(f, "secret")); !errors.Is(err, ErrPassword) {
+				t.Errorf("OpenEncrypted = %v, want ErrPassword", err)
+			}
+			var buf bytes.Buffer
+			zw := zip.NewWriter(&buf)
+			if err := CopyRawAES(zw, f, nil, "secret", "new-secret", AES256); !errors.Is(err, ErrPassword) {
+				t.Errorf("CopyRawAES = %v, want ErrPassword", err)
+			}
+		})
+	}
+}
+
+func TestOpenEncryptedRejectsPlainEntry(t *testing.T) {
+	f := openZip(t, buildZip(t, []testEntry{{name: "a.txt", data: []byte("abc")}})).File[0]
+	if _, err := OpenEncrypted(f, "secret"); !errors.Is(err, ErrUnsupportedEncryption) {
+		t.Errorf("OpenEncrypted = %v, want ErrUnsupportedEncryption", err)
+	}
+}
@@ -0,0 +1,339 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	dsbzip2 "github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// archive/zip が標準で対応していない圧縮方式
+const (
+	MethodDeflate64 uint16 = 9
+	MethodBZIP2     uint16 = 12
+	MethodLZMA      uint16 = 14
+	MethodZstd      uint16 = 93
+	MethodXZ        uint16 = 95
+)
+
+// FlagLZMAEOS はLZMAのデータが終端マーカーで終わっていることを示すフラグです
+const FlagLZMAEOS = 0x2
+
+// LZMA形式のエントリの先頭に置かれるヘッダー（LZMA SDKのバージョン2バイト、プロパティ長2バイト、プロパティ5バイト）
+const (
+	lzmaHeaderLen     = 4
+	lzmaPropsLen      = 5
+	lzmaSDKVersionHi  = 9
+	lzmaSDKVersionLo  = 20
+	lzmaUnknownSize   = -1
+	lzmaDefaultDict   = 1 << 23
+	zipVersionDefault = 20
+)
+
+// 圧縮レベル（1〜9、数字が大きいほど圧縮率を優先します）
+const (
+	LevelDefault = 0 // 各圧縮方式の標準のレベル
+	LevelFastest = 1
+	LevelBest    = 9
+)
+
+var errLZMAHeader = errors.New("LZMAのヘッダーが不正です")
+
+// WritableMethods は書き込みに使用できる圧縮方式の一覧です
+// Deflate64はPKWAREの独自方式で、公開された圧縮の実装がないため展開のみ対応します
+var WritableMethods = []uint16{zip.Deflate, zip.Store, MethodBZIP2, MethodLZMA, MethodZstd, MethodXZ}
+
+// 展開に必要なバージョン（APPNOTE 4.4.3.2）
+var methodVersions = map[uint16]uint16{
+	MethodDeflate64: 21,
+	MethodBZIP2:     46,
+	MethodLZMA:      63,
+	MethodZstd:      63,
+	MethodXZ:        63,
+}
+
+func init() {
+	// archive/zip の File.Open からも展開できるように登録する
+	zip.RegisterDecompressor(MethodDeflate64, newDeflate64Reader)
+	zip.RegisterDecompressor(MethodBZIP2, decompressBZIP2)
+	zip.RegisterDecompressor(MethodLZMA, decompressLZMA)
+	zip.RegisterDecompressor(MethodZstd, decompressZstd)
+	zip.RegisterDecompressor(MethodXZ, decompressXZ)
+
+	zip.RegisterCompressor(MethodBZIP2, Compressor(MethodBZIP2))
+	zip.RegisterCompressor(MethodLZMA, Compressor(MethodLZMA))
+	zip.RegisterCompressor(MethodZstd, Compressor(MethodZstd))
+	zip.RegisterCompressor(MethodXZ, Compressor(MethodXZ))
+}
+
+// Decompressor は圧縮方式に対応する展開関数を返します
+// 対応していない圧縮方式の場合はnilを返します
+func Decompressor(method uint16) zip.Decompressor {
+	switch method {
+	case zip.Store:
+		return io.NopCloser
+	case zip.Deflate:
+		return flate.NewReader
+	case MethodDeflate64:
+		return newDeflate64Reader
+	case MethodBZIP2:
+		return decompressBZIP2
+	case MethodLZMA:
+		return decompressLZMA
+	case MethodZstd:
+		return decompressZstd
+	case MethodXZ:
+		return decompressXZ
+	}
+	return nil
+}
+
+// Compressor は圧縮方式に対応する、標準のレベルの圧縮関数を返します
+// 圧縮に対応していない圧縮方式の場合はnilを返します
+func Compressor(method uint16) zip.Compressor {
+	return CompressorLevel(method, LevelDefault)
+}
+
+// CompressorLevel は圧縮方式とレベルに対応する圧縮関数を返します
+// レベルに意味のない圧縮方式（Store）ではレベルを無視します
+func CompressorLevel(method uint16, level int) zip.Compressor {
+	if level < LevelDefault || level > LevelBest {
+		level = LevelDefault
+	}
+	switch method {
+	case zip.Store:
+		return func(w io.Writer) (io.WriteCloser, error) { return nopWriteCloser{w}, nil }
+	case zip.Deflate:
+		if level == LevelDefault {
+			level = flate.DefaultCompression
+		}
+		return func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, level) }
+	case MethodBZIP2:
+		return lazyCompressor(func(w io.Writer) (io.WriteCloser, error) {
+			return dsbzip2.NewWriter(w, &dsbzip2.WriterConfig{Level: level})
+		})
+	case MethodLZMA:
+		return lazyCompressor(func(w io.Writer) (io.WriteCloser, error) {
+			return compressLZMA(w, lzmaDictSize(level))
+		})
+	case MethodZstd:
+		return lazyCompressor(func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstdLevel(level)))
+		})
+	case MethodXZ:
+		return lazyCompressor(func(w io.Writer) (io.WriteCloser, error) {
+			cfg := xz.WriterConfig{DictCap: lzmaDictSize(level)}
+			return cfg.NewWriter(w)
+		})
+	}
+	return nil
+}
+
+// lzmaDictSize はレベルに対応するLZMA・XZの辞書サイズを返します（レベル1で64KB、レベル9で16MB）
+func lzmaDictSize(level int) int {
+	if level == LevelDefault {
+		return lzmaDefaultDict
+	}
+	return 1 << (15 + level)
+}
+
+// zstdLevel はレベルをZstandardのエンコーダーのレベルに対応させます
+func zstdLevel(level int) zstd.EncoderLevel {
+	switch {
+	case level == LevelDefault:
+		return zstd.SpeedDefault
+	case level <= 2:
+		return zstd.SpeedFastest
+	case level <= 5:
+		return zstd.SpeedDefault
+	case level <= 8:
+		return zstd.SpeedBetterCompression
+	}
+	return zstd.SpeedBestCompression
+}
+
+// lazyCompressor は最初の書き込みまで圧縮ライターの作成を遅らせる圧縮関数を返します
+// zip.Writer はローカルヘッダーを書き込む前に圧縮関数を呼び出すため、
+// 作成時にヘッダーを書き込むライター（XZ・LZMA）をそのまま渡すとデータの位置がずれてしまいます
+func lazyCompressor(comp zip.Compressor) zip.Compressor {
+	return func(w io.Writer) (io.WriteCloser, error) {
+		return &lazyWriteCloser{w: w, comp: comp}, nil
+	}
+}
+
+// lazyWriteCloser は最初の書き込みで圧縮ライターを作成するライターです
+type lazyWriteCloser struct {
+	w    io.Writer
+	comp zip.Compressor
+	wc   io.WriteCloser
+}
+
+func (l *lazyWriteCloser) init() error {
+	if l.wc != nil {
+		return nil
+	}
+	wc, err := l.comp(l.w)
+	if err != nil {
+		return err
+	}
+	l.wc = wc
+	return nil
+}
+
+func (l *lazyWriteCloser) Write(p []byte) (int, error) {
+	if err := l.init(); err != nil {
+		return 0, err
+	}
+	return l.wc.Write(p)
+}
+
+func (l *lazyWriteCloser) Close() error {
+	if err := l.init(); err != nil {
+		return err
+	}
+	return l.wc.Close()
+}
+
+// SetMethod はヘッダーに圧縮方式と、その方式に必要なフラグを設定します
+func SetMethod(fh *zip.FileHeader, method uint16) {
+	fh.Method = method
+	fh.Flags &^= FlagLZMAEOS
+	if method == MethodLZMA {
+		// 書き込むLZMAデータは常に終端マーカーを持つ
+		fh.Flags |= FlagLZMAEOS
+	}
+}
+
+// RequiredVersion は圧縮方式の展開に必要なバージョンを返します
+func RequiredVersion(method uint16) uint16 {
+	if v, ok := methodVersions[method]; ok {
+		return v
+	}
+	return zipVersionDefault
+}
+
+// entryDecompressor はエントリのヘッダーに合わせた展開関数を返します
+// 終端マーカーのないLZMAデータは、展開後のサイズを指定しないと終わりを判定できないため個別に扱います
+func entryDecompressor(fh *zip.FileHeader) zip.Decompressor {
+	method := ActualMethod(fh)
+	if method == MethodLZMA && fh.Flags&FlagLZMAEOS == 0 {
+		size := int64(fh.UncompressedSize64)
+		return func(r io.Reader) io.ReadCloser { return newLZMAReader(r, size) }
+	}
+	return Decompressor(method)
+}
+
+// OpenFile は暗号化されていないエントリを展開して読み取るリーダーを返します
+// archive/zip の File.Open と同じく、読み終えた時点でCRCとサイズを照合します
+func OpenFile(f *zip.File) (io.ReadCloser, error) {
+	if ActualMethod(&f.FileHeader) != MethodLZMA || f.Flags&FlagLZMAEOS != 0 {
+		return f.Open()
+	}
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	return newChecksumReader(entryDecompressor(&f.FileHeader)(raw), f.CRC32, f.UncompressedSize64, true), nil
+}
+
+// errReadCloser は展開の準備で発生したエラーを読み取り時に返すリーダーです
+type errReadCloser struct{ err error }
+
+func (e errReadCloser) Read([]byte) (int, error) { return 0, e.err }
+func (e errReadCloser) Close() error             { return nil }
+
+// nopWriteCloser は Close で何もしないライターです
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func decompressBZIP2(r io.Reader) io.ReadCloser {
+	return io.NopCloser(bzip2.NewReader(r))
+}
+
+func decompressZstd(r io.Reader) io.ReadCloser {
+	// エントリごとにデコーダーを作成するため、並列展開用のゴルーチンは使用しない
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return errReadCloser{err}
+	}
+	return d.IOReadCloser()
+}
+
+func decompressXZ(r io.Reader) io.ReadCloser {
+	xr, err := xz.NewReader(r)
+	if err != nil {
+		return errReadCloser{err}
+	}
+	return io.NopCloser(xr)
+}
+
+func decompressLZMA(r io.Reader) io.ReadCloser {
+	return newLZMAReader(r, lzmaUnknownSize)
+}
+
+// newLZMAReader はZIP形式のLZMAデータを展開するリーダーを返します
+// size が負の場合は終端マーカーまで展開します
+func newLZMAReader(r io.Reader, size int64) io.ReadCloser {
+	var head [lzmaHeaderLen + lzmaPropsLen]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return errReadCloser{errLZMAHeader}
+	}
+	if binary.LittleEndian.Uint16(head[2:4]) != lzmaPropsLen {
+		return errReadCloser{errLZMAHeader}
+	}
+
+	// 単体の.lzma形式のヘッダー（プロパティ5バイト＋展開後サイズ8バイト）に組み替えて渡す
+	var alone [lzma.HeaderLen]byte
+	copy(alone[:lzmaPropsLen], head[lzmaHeaderLen:])
+	binary.LittleEndian.PutUint64(alone[lzmaPropsLen:], uint64(size))
+
+	lr, err := lzma.NewReader(io.MultiReader(bytes.NewReader(alone[:]), r))
+	if err != nil {
+		return errReadCloser{err}
+	}
+	return io.NopCloser(lr)
+}
+
+// compressLZMA はZIP形式のLZMAデータを書き込むライターを返します
+func compressLZMA(w io.Writer, dictSize int) (io.WriteCloser, error) {
+	// ZIP形式のLZMAヘッダーを書き込む
+	head := []byte{lzmaSDKVersionHi, lzmaSDKVersionLo, lzmaPropsLen, 0}
+	if _, err := w.Write(head); err != nil {
+		return nil, err
+	}
+	// lzmaパッケージが書き込む.lzma形式のヘッダーから、展開後サイズの8バイトを取り除く
+	hw := &lzmaHeaderWriter{w: w}
+	cfg := lzma.WriterConfig{DictCap: dictSize, EOSMarker: true}
+	return cfg.NewWriter(hw)
+}
+
+// lzmaHeaderWriter は.lzma形式のヘッダーをZIP形式のプロパティに変換しながら書き込むライターです
+type lzmaHeaderWriter struct {
+	w    io.Writer
+	head []byte
+}
+
+func (h *lzmaHeaderWriter) Write(p []byte) (int, error) {
+	n := 0
+	if len(h.head) < lzma.HeaderLen {
+		n = min(len(p), lzma.HeaderLen-len(h.head))
+		h.head = append(h.head, p[:n]...)
+		if len(h.head) < lzma.HeaderLen {
+			return n, nil
+		}
+		if _, err := h.w.Write(h.head[:lzmaPropsLen]); err != nil {
+			return 0, err
+		}
+	}
+	m, err := h.w.Write(p[n:])
+	return n + m, err
+}
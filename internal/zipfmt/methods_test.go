@@ -0,0 +1,129 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// どの圧縮方式・レベルで圧縮しても、展開すると元の内容に戻る
+func TestCompressorLevel(t *testing.T) {
+	data := testText(200 << 10)
+	levels := []int{LevelDefault, LevelFastest, 5, LevelBest, -1, 10}
+	for _, method := range WritableMethods {
+		for _, level := range levels {
+			t.Run(fmt.Sprintf("%s/レベル%d", MethodName(method), level), func(t *testing.T) {
+				var buf bytes.Buffer
+				zw := zip.NewWriter(&buf)
+				zw.RegisterCompressor(method, CompressorLevel(method, level))
+				w, err := zw.CreateHeader(&zip.FileHeader{Name: "a.txt", Method: method})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := w.Write(data); err != nil {
+					t.Fatal(err)
+				}
+				if err := zw.Close(); err != nil {
+					t.Fatal(err)
+				}
+
+				f := openZip(t, buf.Bytes()).File[0]
+				got, err := readAll(OpenFile(f))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Error("展開した内容が元の内容と一致しません")
+				}
+				if method != zip.Store && f.CompressedSize64 >= f.UncompressedSize64 {
+					t.Errorf("圧縮後 %d バイトが元の %d バイトより小さくなっていません", f.CompressedSize64, f.UncompressedSize64)
+				}
+			})
+		}
+	}
+}
+
+// 高いレベルほど圧縮率を優先する（同じ内容であれば小さくなる）
+func TestCompressorLevelRatio(t *testing.T) {
+	random := make([]byte, 128<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := testText(300 << 10)
+	// LZMA・XZはレベルで辞書サイズが変わるため、レベル1の辞書（64KB）より離れた位置の繰り返しを含める
+	repeated := append(append([]byte(nil), random...), random...)
+	tests := []struct {
+		method uint16
+		data   []byte
+	}{
+		{method: zip.Deflate, data: text},
+		{method: MethodZstd, data: text},
+		{method: MethodXZ, data: repeated},
+		{method: MethodLZMA, data: repeated},
+	}
+	for _, tt := range tests {
+		fastest := compressedSize(t, tt.method, LevelFastest, tt.data)
+		best := compressedSize(t, tt.method, LevelBest, tt.data)
+		if best > fastest {
+			t.Errorf("%s: レベル%d = %d バイト, レベル%d = %d バイト", MethodName(tt.method), LevelBest, best, LevelFastest, fastest)
+		}
+	}
+	// 辞書に収まる繰り返しは、レベル9では圧縮できる
+	if best := compressedSize(t, MethodXZ, LevelBest, repeated); best > len(random)+len(random)/10 {
+		t.Errorf("XZ: レベル%d = %d バイト, 繰り返しを圧縮できていません", LevelBest, best)
+	}
+}
+
+func TestCompressorUnsupported(t *testing.T) {
+	for _, method := range []uint16{MethodDeflate64, methodAES, 1} {
+		if CompressorLevel(method, LevelBest) != nil {
+			t.Errorf("%s: 圧縮に対応していない方式の圧縮関数が返されました", MethodName(method))
+		}
+	}
+}
+
+func TestIsCompressedData(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want bool
+	}{
+		{name: "JPEG", head: []byte{0xFF, 0xD8, 0xFF, 0xE0, 0, 0x10, 'J', 'F', 'I', 'F'}, want: true},
+		{name: "PNG", head: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), want: true},
+		{name: "WebP", head: []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), want: true},
+		{name: "WAV", head: []byte("RIFF\x24\x00\x00\x00WAVEfmt "), want: false},
+		{name: "MP4", head: []byte("\x00\x00\x00\x20ftypisom"), want: true},
+		{name: "ZIP", head: []byte("PK\x03\x04\x14\x00"), want: true},
+		{name: "gzip", head: []byte{0x1F, 0x8B, 0x08, 0x00}, want: true},
+		{name: "7z", head: []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C, 0, 4}, want: true},
+		{name: "JPEG 2000", head: []byte{0x00, 0x00, 0x00, 0x0C, 'j', 'P', ' ', ' ', 0x0D, 0x0A}, want: true},
+		{name: "MP3のフレーム", head: []byte{0xFF, 0xFB, 0x90, 0x64}, want: true},
+		// UTF-16LEのBOMはMP3のフレーム同期と先頭が似ている
+		{name: "UTF-16LEのテキスト", head: []byte{0xFF, 0xFE, 'a', 0, 'b', 0}, want: false},
+		{name: "テキスト", head: []byte("ZIP Editor のテストデータ"), want: false},
+		{name: "先頭が短いPNG", head: []byte("\x89PNG"), want: false},
+		{name: "空", head: nil, want: false},
+	}
+	for _, tt := range tests {
+		if got := IsCompressedData(tt.head); got != tt.want {
+			t.Errorf("IsCompressedData(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// compressedSize は data を method とレベル level で圧縮したサイズを返します
+func compressedSize(t *testing.T, method uint16, level int, data []byte) int {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := CompressorLevel(method, level)(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Len()
+}
@@ -0,0 +1,95 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// MaxNestedSize はメモリに展開して開く入れ子のアーカイブの最大サイズです
+// 無圧縮で格納されているアーカイブは展開せずに直接読み取るため、この制限を受けません
+const MaxNestedSize = 256 << 20
+
+// ErrNestedTooLarge は入れ子のアーカイブが大きすぎてメモリに展開できない場合のエラーです
+var ErrNestedTooLarge = errors.New("入れ子のアーカイブが大きすぎるため開けません")
+
+// ZIP形式のアーカイブとして扱う拡張子
+var archiveExts = map[string]bool{
+	".zip": true,
+	".jar": true,
+	".war": true,
+	".ear": true,
+	".apk": true,
+}
+
+// IsArchiveName はエントリ名がZIP形式のアーカイブ（.zip・.jar など）を示すかどうかを返します
+func IsArchiveName(name string) bool {
+	return archiveExts[strings.ToLower(path.Ext(name))]
+}
+
+// OpenReaderAt はエントリの内容をランダムアクセス可能な形で開き、そのサイズとともに返します
+// 暗号化されていない無圧縮のエントリは元のファイルから直接読み取り、
+// それ以外は MaxNestedSize までメモリに展開します
+func OpenReaderAt(f *zip.File) (io.ReaderAt, int64, error) {
+	if f.Flags&FlagEncrypted != 0 {
+		return nil, 0, ErrUnsupportedEncryption
+	}
+	size := int64(f.UncompressedSize64)
+	if f.Method == zip.Store {
+		raw, err := f.OpenRaw()
+		if err != nil {
+			return nil, 0, err
+		}
+		if rawAt, ok := raw.(io.ReaderAt); ok {
+			return rawAt, size, nil
+		}
+	}
+
+	if size > MaxNestedSize {
+		return nil, 0, ErrNestedTooLarge
+	}
+	rc, err := OpenFile(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rc.Close()
+
+	data := make([]byte, 0, size)
+	buf := bytes.NewBuffer(data)
+	if _, err := io.Copy(buf, rc); err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil
+}
+
+// CanOpenNested はエントリを OpenNested で開ける見込みがあるかどうかを、内容を読まずに返します
+// 暗号化されているエントリと、メモリに展開するには大きすぎるエントリはfalseです
+func CanOpenNested(f *zip.File) bool {
+	if f.Flags&FlagEncrypted != 0 {
+		return false
+	}
+	return f.Method == zip.Store || f.UncompressedSize64 <= MaxNestedSize
+}
+
+// OpenNested は入れ子のアーカイブを OpenReaderAt で開き、ZIPのリーダーとして返します
+// 返されたリーダーは先頭に付加されたデータの取得や RewriteArchive での書き直しにも使えます
+// 閉じても外側のアーカイブは閉じません（外側のアーカイブを閉じた後は使えません）
+func OpenNested(f *zip.File) (*ReadCloser, error) {
+	ra, size, err := OpenReaderAt(f)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, err
+	}
+	return &ReadCloser{Reader: reader, ra: ra, size: size, closer: nopCloser{}}, nil
+}
+
+// nopCloser は閉じる必要のないリーダーの Close です
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,142 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestIsArchiveName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "lib/inner.zip", want: true},
+		{name: "app.JAR", want: true},
+		{name: "web.war", want: true},
+		{name: "app.ear", want: true},
+		{name: "app.apk", want: true},
+		{name: "archive.tar.gz", want: false},
+		{name: "zip", want: false},
+		{name: "dir.zip/", want: false},
+	}
+	for _, tt := range tests {
+		if got := IsArchiveName(tt.name); got != tt.want {
+			t.Errorf("IsArchiveName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// 無圧縮の入れ子のアーカイブは元のファイルから直接、圧縮されたものはメモリに展開して開く
+func TestOpenReaderAt(t *testing.T) {
+	inner := buildZip(t, []testEntry{{name: "a.txt", data: testText(1000), method: zip.Deflate}})
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		outer := openZip(t, buildZip(t, []testEntry{{name: "inner.zip", data: inner, method: method}}))
+		ra, size, err := OpenReaderAt(outer.File[0])
+		if err != nil {
+			t.Fatalf("方式 %d: %v", method, err)
+		}
+		if size != int64(len(inner)) {
+			t.Errorf("方式 %d: サイズ = %d, want %d", method, size, len(inner))
+		}
+		r, err := zip.NewReader(ra, size)
+		if err != nil {
+			t.Fatalf("方式 %d: %v", method, err)
+		}
+		data, err := readAll(r.File[0].Open())
+		if err != nil || !bytes.Equal(data, testText(1000)) {
+			t.Errorf("方式 %d: 内容が一致しません（%v）", method, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		header zip.FileHeader
+		want   error
+	}{
+		{name: "暗号化", header: zip.FileHeader{Method: zip.Store, Flags: FlagEncrypted}, want: ErrUnsupportedEncryption},
+		{name: "展開すると大きすぎる", header: zip.FileHeader{Method: zip.Deflate, UncompressedSize64: MaxNestedSize + 1}, want: ErrNestedTooLarge},
+	}
+	for _, tt := range tests {
+		if _, _, err := OpenReaderAt(&zip.File{FileHeader: tt.header}); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// 入れ子のアーカイブを開き、入れ子のアーカイブを作り直すときと同じく RewriteArchive で書き直しても
+// 先頭に付加されたデータとアーカイブ全体のコメントが引き継がれることを確認する
+func TestOpenNestedRewrite(t *testing.T) {
+	stub := []byte("#!/bin/sh\nexit 0\n")
+	var inner bytes.Buffer
+	inner.Write(stub)
+	zw := zip.NewWriter(&inner)
+	zw.SetOffset(int64(len(stub)))
+	for _, name := range []string{"keep.txt", "drop.txt"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(testText(1000))
+	}
+	if err := zw.SetComment("内側のコメント"); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		outer := openZip(t, buildZip(t, []testEntry{{name: "lib/inner.zip", data: inner.Bytes(), method: method}}))
+		file := outer.File[0]
+		if !CanOpenNested(file) {
+			t.Fatalf("方式 %d: CanOpenNested = false, want true", method)
+		}
+		reader, err := OpenNested(file)
+		if err != nil {
+			t.Fatalf("方式 %d: %v", method, err)
+		}
+
+		var rewritten bytes.Buffer
+		stubSize, err := RewriteArchive(&rewritten, reader, RewriteOptions{}, func(zw *zip.Writer) error {
+			return CopyRaw(zw, reader.File[0], nil)
+		})
+		reader.Close()
+		if err != nil {
+			t.Fatalf("方式 %d: %v", method, err)
+		}
+		if stubSize != int64(len(stub)) || !bytes.HasPrefix(rewritten.Bytes(), stub) {
+			t.Errorf("方式 %d: 先頭に付加されたデータが引き継がれていません（%d バイト）", method, stubSize)
+		}
+		got := openZip(t, rewritten.Bytes())
+		if got.Comment != "内側のコメント" {
+			t.Errorf("方式 %d: コメント = %q, want %q", method, got.Comment, "内側のコメント")
+		}
+		if len(got.File) != 1 || got.File[0].Name != "keep.txt" {
+			t.Fatalf("方式 %d: エントリが期待どおりではありません", method)
+		}
+		data, err := readAll(got.File[0].Open())
+		if err != nil || !bytes.Equal(data, testText(1000)) {
+			t.Errorf("方式 %d: 内容が一致しません（%v）", method, err)
+		}
+	}
+}
+
+func TestCanOpenNested(t *testing.T) {
+	tests := []struct {
+		name   string
+		header zip.FileHeader
+		want   bool
+	}{
+		{name: "無圧縮", header: zip.FileHeader{Method: zip.Store, UncompressedSize64: MaxNestedSize + 1}, want: true},
+		{name: "圧縮", header: zip.FileHeader{Method: zip.Deflate, UncompressedSize64: MaxNestedSize}, want: true},
+		{name: "展開すると大きすぎる", header: zip.FileHeader{Method: zip.Deflate, UncompressedSize64: MaxNestedSize + 1}, want: false},
+		{name: "暗号化", header: zip.FileHeader{Method: zip.Store, Flags: FlagEncrypted}, want: false},
+	}
+	for _, tt := range tests {
+		if got := CanOpenNested(&zip.File{FileHeader: tt.header}); got != tt.want {
+			t.Errorf("%s: CanOpenNested = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"zip-editor/internal/common"
+)
+
+// DefaultNormalizeLevel は正規化の際に使うDeflateの圧縮レベルの既定値です
+const DefaultNormalizeLevel = 9
+
+// NormalizeOptions はアーカイブを正規化（同じ内容から常に同じバイト列を作る）する際のオプションです
+type NormalizeOptions struct {
+	Time  time.Time // すべてのエントリに設定する更新日時（MS-DOS形式で記録できる範囲に丸める）
+	Level int       // Deflateの圧縮レベル（1〜9）
+	First []string  // パスの順より前に、指定した順に置くエントリ（EPUBの mimetype など）
+}
+
+// SourceDateEpoch は正規化に使う日時を返します
+// 環境変数 SOURCE_DATE_EPOCH（Unix時刻）が設定されている場合はその日時、設定されていない場合はMS-DOS形式の最小の日時（1980-01-01 00:00:00 UTC）です
+func SourceDateEpoch() (time.Time, error) {
+	text, ok := os.LookupEnv("SOURCE_DATE_EPOCH")
+	if !ok || text == "" {
+		return dosMinTime, nil
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("SOURCE_DATE_EPOCH の値が正しくありません: %s", text)
+	}
+	return time.Unix(n, 0).UTC(), nil
+}
+
+// WriteNormalized はエントリを正規化して書き込みます
+//   - エントリを opts.First に指定したもの、残りをパス（UTF-8に変換したもの）の順に並べ替える
+//   - 更新日時を opts.Time にし、MS-DOS形式の日時だけを記録する
+//   - パーミッションを、フォルダと実行権限のあるファイルは0755、ほかのファイルは0644にする
+//   - 拡張フィールドとエントリのコメントを取り除く
+//   - ファイルを指定した圧縮レベルのDeflateで圧縮し直す（空のファイルとシンボリックリンクは無圧縮）
+//
+// 暗号化されたエントリは内容を比較できないため、含まれている場合はエラーを返します
+// アーカイブ全体のコメントは呼び出し側で空にしてください
+func WriteNormalized(zw *zip.Writer, files []*zip.File, opts NormalizeOptions) error {
+	if opts.Level < 1 || opts.Level > 9 {
+		return fmt.Errorf("圧縮レベルは1〜9で指定してください: %d", opts.Level)
+	}
+	zw.RegisterCompressor(zip.Deflate, CompressorLevel(zip.Deflate, opts.Level))
+
+	type entry struct {
+		name string
+		file *zip.File
+	}
+	entries := make([]entry, 0, len(files))
+	for _, f := range OrderFiles(files, EntryOrder{Mode: OrderByPath, First: opts.First}) {
+		if f.Flags&FlagEncrypted != 0 {
+			return errors.New(common.AutoDetectEncoding(f.Name) + ": 暗号化されたエントリは正規化できません")
+		}
+		entries = append(entries, entry{name: common.AutoDetectEncoding(f.Name), file: f})
+	}
+
+	dosTime, dosDate := dosDateTime(opts.Time.UTC())
+	for _, e := range entries {
+		header := &zip.FileHeader{
+			Name:         e.name,
+			Method:       zip.Deflate,
+			ModifiedTime: dosTime,
+			ModifiedDate: dosDate,
+		}
+		mode := e.file.Mode()
+		switch {
+		case isDirName(e.name):
+			header.Method = zip.Store
+			header.SetMode(fs.ModeDir | 0755)
+		case mode&fs.ModeSymlink != 0:
+			header.Method = zip.Store
+			header.SetMode(fs.ModeSymlink | 0777)
+		case mode&0111 != 0 && IsUnixHost(&e.file.FileHeader):
+			header.SetMode(0755)
+		default:
+			header.SetMode(0644)
+		}
+		if e.file.UncompressedSize64 == 0 {
+			header.Method = zip.Store
+		}
+
+		if err := writeNormalizedEntry(zw, header, e.file); err != nil {
+			return fmt.Errorf("%s: %w", e.name, err)
+		}
+	}
+	return nil
+}
+
+// writeNormalizedEntry はエントリの内容を展開し、正規化したヘッダーで書き込みます
+func writeNormalizedEntry(zw *zip.Writer, header *zip.FileHeader, f *zip.File) error {
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if isDirName(header.Name) {
+		return nil
+	}
+
+	rc, err := OpenFile(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(w, rc)
+	return err
+}
+
+// ErrNotReproducible は同じ内容を2回正規化した結果が一致しなかったことを表すエラーです
+var ErrNotReproducible = errors.New("同じ内容を2回正規化した結果が一致しませんでした（元のファイルは変更していません）")
+
+// NormalizeFile は zipPath のZIPファイルを正規化して書き直し、書き直したファイルのSHA-256（16進数）とエントリ数を返します
+// 元のファイルから2つの一時ファイルにそれぞれ正規化し、ハッシュが一致した場合にだけ元のファイルを置き換えます
+// 先頭に付加されたデータは引き継ぎ、アーカイブ全体のコメントは取り除きます。分割アーカイブは正規化できません
+// selectFiles がnilでない場合は、正規化して書き込むエントリをその結果にします（削除するエントリを除くなど）
+func NormalizeFile(zipPath string, opts NormalizeOptions, selectFiles func(files []*zip.File) ([]*zip.File, error)) (sum string, entries int, err error) {
+	reader, err := OpenReader(zipPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer reader.Close()
+	if reader.Volumes != nil {
+		return "", 0, errors.New("分割アーカイブは正規化できません（ひとつのファイルにまとめてから正規化してください）")
+	}
+
+	files := reader.File
+	if selectFiles != nil {
+		if files, err = selectFiles(files); err != nil {
+			return "", 0, err
+		}
+	}
+
+	tempDir, err := os.MkdirTemp("", "zip-editor-")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	// 同じ元のファイルから2回正規化し、同じバイト列になることを確かめる
+	var sums [2]string
+	var paths [2]string
+	for i := range paths {
+		paths[i] = filepath.Join(tempDir, fmt.Sprintf("normalize%d.zip", i+1))
+		if sums[i], err = writeNormalizedFile(paths[i], reader, files, opts); err != nil {
+			return "", 0, err
+		}
+	}
+	if sums[0] != sums[1] {
+		return "", 0, ErrNotReproducible
+	}
+
+	// Windowsでは開いているファイルを置き換えられないため、元のファイルを閉じてから置き換える
+	if err := reader.Close(); err != nil {
+		return "", 0, err
+	}
+	normalized, err := os.Open(paths[0])
+	if err != nil {
+		return "", 0, err
+	}
+	defer normalized.Close()
+	err = common.ReplaceFile(zipPath, func(f *os.File) error {
+		if _, err := io.Copy(f, normalized); err != nil {
+			return err
+		}
+		return f.Sync()
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return sums[0], len(files), nil
+}
+
+// writeNormalizedFile はエントリを正規化したZIPファイルを path に書き込み、そのSHA-256（16進数）を返します
+func writeNormalizedFile(path string, reader *ReadCloser, files []*zip.File, opts NormalizeOptions) (string, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	comment := ""
+	_, err = RewriteArchive(io.MultiWriter(f, h), reader, RewriteOptions{Comment: &comment}, func(zw *zip.Writer) error {
+		return WriteNormalized(zw, files, opts)
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
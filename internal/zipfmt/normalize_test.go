@@ -0,0 +1,243 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+)
+
+// 格納順・日時・圧縮方式・パーミッション・コメントが違っても、内容が同じなら正規化した結果は同じバイト列になる
+func TestWriteNormalizedReproducible(t *testing.T) {
+	content := testText(20000)
+	a := buildZip(t, []testEntry{
+		{name: "mimetype", data: []byte("application/epub+zip")},
+		{name: "dir/", data: nil},
+		{name: "dir/b.txt", data: content, method: zip.Deflate},
+		{name: "a.txt", data: []byte("a")},
+		{name: "empty.txt", data: nil, method: zip.Deflate},
+	})
+	b := buildZipWith(t, func(zw *zip.Writer) {
+		for _, e := range []struct {
+			name   string
+			data   []byte
+			method uint16
+			mode   fs.FileMode
+		}{
+			{name: "a.txt", data: []byte("a"), method: zip.Deflate, mode: 0600},
+			{name: "dir/b.txt", data: content, method: zip.Store, mode: 0640},
+			{name: "empty.txt", method: zip.Store, mode: 0666},
+			{name: "mimetype", data: []byte("application/epub+zip"), method: zip.Deflate, mode: 0644},
+			{name: "dir/", mode: fs.ModeDir | 0700},
+		} {
+			fh := &zip.FileHeader{Name: e.name, Method: e.method, Modified: time.Now(), Comment: "コメント"}
+			fh.SetMode(e.mode)
+			fh.Extra = BuildExtra([]ExtraField{{ID: 0xcafe, Data: []byte{1, 2, 3}}})
+			w, err := zw.CreateHeader(fh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(e.data)
+		}
+		zw.SetComment("アーカイブのコメント")
+	})
+
+	opts := NormalizeOptions{Time: time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC), Level: DefaultNormalizeLevel, First: []string{"mimetype"}}
+	na := normalizeZip(t, a, opts)
+	nb := normalizeZip(t, b, opts)
+	if !bytes.Equal(na, nb) {
+		t.Fatal("内容が同じアーカイブを正規化した結果が一致しません")
+	}
+	// 正規化したものをもう一度正規化しても変わらない
+	if again := normalizeZip(t, na, opts); !bytes.Equal(again, na) {
+		t.Error("正規化したアーカイブを正規化し直すと変わります")
+	}
+
+	r := openZip(t, na)
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+		if !f.Modified.Equal(opts.Time) || len(f.Extra) != 0 || f.Comment != "" {
+			t.Errorf("%s: 日時・拡張フィールド・コメントが正規化されていません", f.Name)
+		}
+		wantMode := fs.FileMode(0644)
+		if f.Name == "dir/" {
+			wantMode = fs.ModeDir | 0755
+		}
+		if f.Mode() != wantMode {
+			t.Errorf("%s: パーミッション = %v, want %v", f.Name, f.Mode(), wantMode)
+		}
+	}
+	if want := []string{"mimetype", "a.txt", "dir/", "dir/b.txt", "empty.txt"}; !equalStrings(names, want) {
+		t.Errorf("格納順 = %v, want %v", names, want)
+	}
+	if got := r.File[len(r.File)-1].Method; got != zip.Store {
+		t.Errorf("空のファイルの圧縮方式 = %d, want %d", got, zip.Store)
+	}
+
+	// 日時が違えば結果も変わる
+	opts.Time = opts.Time.Add(time.Hour)
+	if bytes.Equal(normalizeZip(t, a, opts), na) {
+		t.Error("日時を変えても正規化した結果が変わりません")
+	}
+}
+
+func TestWriteNormalizedErrors(t *testing.T) {
+	plain := buildZip(t, []testEntry{{name: "a.txt", data: []byte("secret data")}})
+	encrypted := rewriteZip(t, plain, func(zw *zip.Writer, f *zip.File) error { return CopyRawEncrypted(zw, f, nil, "secret") })
+
+	tests := []struct {
+		name  string
+		data  []byte
+		level int
+	}{
+		{name: "暗号化されたエントリ", data: encrypted, level: DefaultNormalizeLevel},
+		{name: "圧縮レベルが範囲外", data: plain, level: 0},
+	}
+	for _, tt := range tests {
+		zw := zip.NewWriter(&bytes.Buffer{})
+		if err := WriteNormalized(zw, openZip(t, tt.data).File, NormalizeOptions{Time: dosMinTime, Level: tt.level}); err == nil {
+			t.Errorf("%s: エラーになりません", tt.name)
+		}
+	}
+}
+
+// NormalizeFile は先頭のデータを引き継いでコメントを取り除き、内容が同じ別々のファイルからも同じハッシュのファイルを作る
+func TestNormalizeFile(t *testing.T) {
+	dir := t.TempDir()
+	stub := []byte("#!/bin/sh\nexit 0\n")
+	a := buildZipWith(t, func(zw *zip.Writer) {
+		for _, name := range []string{"b.txt", "a.txt", "skip.log"} {
+			w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write([]byte(name))
+		}
+		zw.SetComment("コメント")
+	})
+	b := buildZip(t, []testEntry{
+		{name: "a.txt", data: []byte("a.txt"), method: zip.Deflate},
+		{name: "b.txt", data: []byte("b.txt")},
+	})
+	pathA := writeTestFile(t, dir, "a.zip", append(append([]byte(nil), stub...), a...))
+	pathB := writeTestFile(t, dir, "b.zip", append(append([]byte(nil), stub...), b...))
+
+	opts := NormalizeOptions{Time: dosMinTime, Level: DefaultNormalizeLevel}
+	skipLog := func(files []*zip.File) ([]*zip.File, error) {
+		var selected []*zip.File
+		for _, f := range files {
+			if f.Name != "skip.log" {
+				selected = append(selected, f)
+			}
+		}
+		return selected, nil
+	}
+	sumA, entries, err := NormalizeFile(pathA, opts, skipLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries != 2 {
+		t.Errorf("エントリ数 = %d, want 2", entries)
+	}
+	sumB, _, err := NormalizeFile(pathB, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sumA != sumB {
+		t.Error("内容が同じアーカイブを正規化した結果のハッシュが一致しません")
+	}
+
+	dataA, err := os.ReadFile(pathA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataB, err := os.ReadFile(pathB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dataA, dataB) {
+		t.Fatal("内容が同じアーカイブを正規化した結果が一致しません")
+	}
+	if sum := sha256.Sum256(dataA); hex.EncodeToString(sum[:]) != sumA {
+		t.Error("返されたハッシュが書き込んだファイルと一致しません")
+	}
+	if !bytes.HasPrefix(dataA, stub) {
+		t.Error("先頭に付加されたデータが引き継がれていません")
+	}
+	r := openZip(t, dataA[len(stub):])
+	if r.Comment != "" {
+		t.Errorf("コメント = %q, want 空", r.Comment)
+	}
+	if names := fileNames(r.File); len(names) != 2 || names[0] != "a.txt" || names[1] != "b.txt" {
+		t.Errorf("エントリ = %v", names)
+	}
+}
+
+// 正規化できない場合は元のファイルを変更しない
+func TestNormalizeFileKeepsOriginalOnError(t *testing.T) {
+	dir := t.TempDir()
+	plain := buildZip(t, []testEntry{{name: "a.txt", data: []byte("secret data")}})
+	encrypted := rewriteZip(t, plain, func(zw *zip.Writer, f *zip.File) error { return CopyRawEncrypted(zw, f, nil, "secret") })
+	path := writeTestFile(t, dir, "encrypted.zip", encrypted)
+
+	if _, _, err := NormalizeFile(path, NormalizeOptions{Time: dosMinTime, Level: DefaultNormalizeLevel}, nil); err == nil {
+		t.Fatal("暗号化されたエントリを含むアーカイブを正規化できてしまいました")
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, encrypted) {
+		t.Error("失敗したのに元のファイルが変更されています")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("一時ファイルが残っています: %v", entries)
+	}
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	tests := []struct {
+		env     string
+		want    time.Time
+		wantErr bool
+	}{
+		{env: "", want: dosMinTime},
+		{env: "1700000000", want: time.Unix(1700000000, 0).UTC()},
+		{env: " 1700000000\n", want: time.Unix(1700000000, 0).UTC()},
+		{env: "yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv("SOURCE_DATE_EPOCH", tt.env)
+		got, err := SourceDateEpoch()
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("SOURCE_DATE_EPOCH=%q: got = %v, %v, want %v", tt.env, got, err, tt.want)
+		}
+	}
+}
+
+// normalizeZip はZIPファイルのバイト列を正規化したバイト列を返します
+func normalizeZip(t *testing.T, data []byte, opts NormalizeOptions) []byte {
+	t.Helper()
+	return buildZipWith(t, func(zw *zip.Writer) {
+		if err := WriteNormalized(zw, openZip(t, data).File, opts); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// buildZipWith は write で書き込んだZIPファイルのバイト列を返します
+func buildZipWith(t *testing.T, write func(zw *zip.Writer)) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write(zw)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
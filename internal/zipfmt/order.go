@@ -0,0 +1,123 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"fmt"
+	"sort"
+	"strings"
+
+	"zip-editor/internal/common"
+)
+
+// OrderMode はエントリの並べ方です
+type OrderMode int
+
+const (
+	OrderOriginal OrderMode = iota // 元の順序のまま
+	OrderByPath                    // パスの順
+	OrderBySize                    // 展開後のサイズの順
+)
+
+// EntryOrder はZIPファイルのエントリの並べ方の指定です
+// First に指定したパスのエントリを指定した順に先頭に置き、残りを Mode に従って並べます
+// First にすべてのエントリを並べれば、任意の順序（手動の並べ替え）を指定できます
+type EntryOrder struct {
+	Mode       OrderMode
+	Descending bool     // Mode の順序を逆にする（元の順序のままの場合は無視する）
+	First      []string // 先頭に置くエントリのパス（UTF-8に変換したもの）
+}
+
+// OrderPresets は、特定の順序を求める形式のために先頭に置くエントリの一覧です
+var OrderPresets = []struct {
+	Name  string
+	First []string
+}{
+	{"EPUB（mimetype を先頭に置く）", []string{"mimetype"}},
+	{"JAR（META-INF/MANIFEST.MF を先頭に置く）", []string{"META-INF/", "META-INF/MANIFEST.MF"}},
+}
+
+// OrderFiles はエントリを指定した順序に並べ替えたスライスを返します（元のスライスは変更しません）
+// 同じ順位のエントリは元の順序を保ちます
+func OrderFiles(files []*zip.File, order EntryOrder) []*zip.File {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = common.AutoDetectEncoding(f.Name)
+	}
+	index := OrderNames(names, func(i int) uint64 { return files[i].UncompressedSize64 }, order)
+
+	ordered := make([]*zip.File, len(files))
+	for i, j := range index {
+		ordered[i] = files[j]
+	}
+	return ordered
+}
+
+// OrderNames はパスの一覧を指定した順序に並べたときの、元の位置の一覧を返します
+// size は元の位置のエントリの展開後のサイズを返す関数です
+func OrderNames(names []string, size func(i int) uint64, order EntryOrder) []int {
+	rank := make(map[string]int, len(order.First))
+	for i, name := range order.First {
+		if _, ok := rank[name]; !ok {
+			rank[name] = i
+		}
+	}
+
+	index := make([]int, len(names))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(a, b int) bool {
+		ia, ib := index[a], index[b]
+		ra, okA := rank[names[ia]]
+		rb, okB := rank[names[ib]]
+		switch {
+		case okA && okB:
+			return ra < rb
+		case okA != okB:
+			return okA
+		}
+
+		less := false
+		switch order.Mode {
+		case OrderByPath:
+			if names[ia] == names[ib] {
+				return false
+			}
+			less = names[ia] < names[ib]
+		case OrderBySize:
+			sa, sb := size(ia), size(ib)
+			if sa == sb {
+				return false
+			}
+			less = sa < sb
+		default:
+			return false
+		}
+		return less != order.Descending
+	})
+	return index
+}
+
+// ParseOrderList はカンマまたは改行で区切ったパスの一覧を解釈します（前後の空白と空の項目は取り除きます）
+func ParseOrderList(s string) []string {
+	var list []string
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+// ParseOrderMode はエントリの並べ方の名前（"original"、"path"、"size"）を解釈します
+func ParseOrderMode(name string) (OrderMode, error) {
+	switch strings.ToLower(name) {
+	case "", "original":
+		return OrderOriginal, nil
+	case "path", "name":
+		return OrderByPath, nil
+	case "size":
+		return OrderBySize, nil
+	}
+	return OrderOriginal, fmt.Errorf("並べ方の指定が正しくありません: %s（original、path、size のいずれか）", name)
+}
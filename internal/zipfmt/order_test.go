@@ -0,0 +1,165 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOrderNames(t *testing.T) {
+	names := []string{"b.txt", "META-INF/MANIFEST.MF", "a/", "mimetype", "a/z.txt", "META-INF/", "c.txt"}
+	sizes := []uint64{30, 10, 0, 20, 30, 0, 5}
+	tests := []struct {
+		name  string
+		order EntryOrder
+		want  string
+	}{
+		{
+			name:  "元の順序",
+			order: EntryOrder{Mode: OrderOriginal, Descending: true},
+			want:  "b.txt,META-INF/MANIFEST.MF,a/,mimetype,a/z.txt,META-INF/,c.txt",
+		},
+		{
+			name:  "パスの順",
+			order: EntryOrder{Mode: OrderByPath},
+			want:  "META-INF/,META-INF/MANIFEST.MF,a/,a/z.txt,b.txt,c.txt,mimetype",
+		},
+		{
+			name:  "パスの逆順",
+			order: EntryOrder{Mode: OrderByPath, Descending: true},
+			want:  "mimetype,c.txt,b.txt,a/z.txt,a/,META-INF/MANIFEST.MF,META-INF/",
+		},
+		{
+			// 同じサイズのエントリは元の順序を保つ
+			name:  "サイズの順",
+			order: EntryOrder{Mode: OrderBySize},
+			want:  "a/,META-INF/,c.txt,META-INF/MANIFEST.MF,mimetype,b.txt,a/z.txt",
+		},
+		{
+			name:  "サイズの逆順",
+			order: EntryOrder{Mode: OrderBySize, Descending: true},
+			want:  "b.txt,a/z.txt,mimetype,META-INF/MANIFEST.MF,c.txt,a/,META-INF/",
+		},
+		{
+			// 存在しないパスと重複したパスは無視する
+			name:  "先頭に置くエントリとパスの順",
+			order: EntryOrder{Mode: OrderByPath, First: []string{"c.txt", "missing", "a/z.txt", "c.txt"}},
+			want:  "c.txt,a/z.txt,META-INF/,META-INF/MANIFEST.MF,a/,b.txt,mimetype",
+		},
+		{
+			name:  "先頭に置くエントリと元の順序",
+			order: EntryOrder{First: []string{"mimetype"}},
+			want:  "mimetype,b.txt,META-INF/MANIFEST.MF,a/,a/z.txt,META-INF/,c.txt",
+		},
+		{
+			name:  "手動の並べ替え",
+			order: EntryOrder{Mode: OrderBySize, First: []string{"a/", "a/z.txt", "c.txt", "b.txt", "mimetype", "META-INF/", "META-INF/MANIFEST.MF"}},
+			want:  "a/,a/z.txt,c.txt,b.txt,mimetype,META-INF/,META-INF/MANIFEST.MF",
+		},
+		{
+			name:  "EPUBのプリセット",
+			order: EntryOrder{Mode: OrderByPath, First: OrderPresets[0].First},
+			want:  "mimetype,META-INF/,META-INF/MANIFEST.MF,a/,a/z.txt,b.txt,c.txt",
+		},
+		{
+			name:  "JARのプリセット",
+			order: EntryOrder{Mode: OrderBySize, First: OrderPresets[1].First},
+			want:  "META-INF/,META-INF/MANIFEST.MF,a/,c.txt,mimetype,b.txt,a/z.txt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := OrderNames(names, func(i int) uint64 { return sizes[i] }, tt.order)
+			got := make([]string, len(index))
+			for i, j := range index {
+				got[i] = names[j]
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("順序 = %s\nwant %s", strings.Join(got, ","), tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderFiles(t *testing.T) {
+	data := buildZip(t, []testEntry{
+		{name: "large.txt", data: testText(3000)},
+		{name: "small.txt", data: testText(10)},
+		{name: "mimetype", data: []byte("application/epub+zip")},
+	})
+	files := openZip(t, data).File
+	ordered := OrderFiles(files, EntryOrder{Mode: OrderBySize, First: []string{"mimetype"}})
+	var got []string
+	for _, f := range ordered {
+		got = append(got, f.Name)
+	}
+	if want := "mimetype,small.txt,large.txt"; strings.Join(got, ",") != want {
+		t.Errorf("順序 = %s, want %s", strings.Join(got, ","), want)
+	}
+	if files[0].Name != "large.txt" {
+		t.Error("元のスライスが変更されました")
+	}
+}
+
+// 正規化では First に指定したエントリをパスの順より前に置く
+func TestWriteNormalizedFirst(t *testing.T) {
+	data := buildZip(t, []testEntry{
+		{name: "OEBPS/content.opf", data: testText(100), method: zip.Deflate},
+		{name: "META-INF/container.xml", data: testText(50), method: zip.Deflate},
+		{name: "mimetype", data: []byte("application/epub+zip")},
+	})
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if err := WriteNormalized(zw, openZip(t, data).File, NormalizeOptions{Time: testTime, Level: DefaultNormalizeLevel, First: OrderPresets[0].First}); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range openZip(t, buf.Bytes()).File {
+		got = append(got, f.Name)
+	}
+	if want := "mimetype,META-INF/container.xml,OEBPS/content.opf"; strings.Join(got, ",") != want {
+		t.Errorf("順序 = %s, want %s", strings.Join(got, ","), want)
+	}
+}
+
+func TestParseOrderList(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{s: "mimetype", want: []string{"mimetype"}},
+		{s: " a.txt , b/c.txt,,", want: []string{"a.txt", "b/c.txt"}},
+		{s: "a.txt\r\n\r\nスペース を含む.txt\n", want: []string{"a.txt", "スペース を含む.txt"}},
+		{s: " , \n", want: nil},
+	}
+	for _, tt := range tests {
+		if got := ParseOrderList(tt.s); strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("ParseOrderList(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseOrderMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		want      OrderMode
+		wantError bool
+	}{
+		{name: "", want: OrderOriginal},
+		{name: "original", want: OrderOriginal},
+		{name: "Path", want: OrderByPath},
+		{name: "name", want: OrderByPath},
+		{name: "SIZE", want: OrderBySize},
+		{name: "date", wantError: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseOrderMode(tt.name)
+		if (err != nil) != tt.wantError || got != tt.want {
+			t.Errorf("ParseOrderMode(%q) = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,500 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"zip-editor/internal/common"
+)
+
+const (
+	// PatchManifestName はパッチ内の、操作の一覧を書いたエントリの名前です
+	PatchManifestName = "zip-editor-patch.txt"
+	// patchDataName はパッチ内の、古いファイルにないバイト列をまとめたエントリの名前です
+	patchDataName = "data"
+	// patchMagic はパッチの操作の一覧の1行目です（末尾の数字は形式の版）
+	patchMagic = "zip-editor-patch 1"
+)
+
+var (
+	// ErrPatchBaseMismatch はパッチを適用するファイルが、パッチを作成したときの古いファイルと一致しないことを示すエラーです
+	ErrPatchBaseMismatch = errors.New("パッチを作成したときの古いファイルと内容が一致しません")
+	// ErrPatchVerify はパッチを適用した結果が、新しいファイルと一致しなかったことを示すエラーです
+	ErrPatchVerify = errors.New("パッチを適用した結果が新しいファイルと一致しません（パッチが壊れている可能性があります）")
+	// ErrPatchCorrupt はパッチのファイル自体が壊れている（余分なデータが付加されているなど）ことを示すエラーです
+	ErrPatchCorrupt = errors.New("パッチのファイルが壊れています")
+)
+
+// PatchInfo はパッチの内容の概要です
+type PatchInfo struct {
+	OldSize   int64
+	OldSHA256 [sha256.Size]byte // 古いファイル全体のSHA-256
+	NewSize   int64
+	NewSHA256 [sha256.Size]byte // 新しいファイル全体のSHA-256
+	Copied    int64             // 古いファイルからコピーするバイト数
+	Inserted  int64             // パッチに含めたバイト数（圧縮前）
+	Ops       int               // 操作の数
+}
+
+// patchOp はパッチの操作ひとつです
+// copy の場合は古いファイルの offset から length バイトを、そうでない場合はパッチのデータから次の length バイトを書き込みます
+type patchOp struct {
+	copy   bool
+	offset int64
+	length int64
+}
+
+// patchRegion はファイルを区切った領域です
+// ZIPのエントリの領域はローカルファイルヘッダから次のエントリの直前までで、data はその中の圧縮データの開始位置です
+// それ以外の領域（先頭に付加されたデータ、中央ディレクトリなど）では data は off と同じです
+type patchRegion struct {
+	off  int64
+	size int64
+	data int64
+}
+
+// CreatePatch は古いファイルを新しいファイルに更新するパッチを作成し、w に書き込みます
+// ZIPファイルはエントリごとの領域（とその中の圧縮データ）に区切り、古いファイルに同じバイト列がある領域はコピー、
+// ない領域はパッチに含めます。ZIPとして読み取れないファイルは全体をひとつの領域として扱います
+// パッチはZIP形式で、操作の一覧（PatchManifestName）と、古いファイルにないバイト列を圧縮したエントリからなります
+func CreatePatch(oldPath, newPath string, w io.Writer) (*PatchInfo, error) {
+	oldFile, oldSize, err := openPatchInput(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	defer oldFile.Close()
+	newFile, newSize, err := openPatchInput(newPath)
+	if err != nil {
+		return nil, err
+	}
+	defer newFile.Close()
+
+	info := &PatchInfo{OldSize: oldSize, NewSize: newSize}
+
+	// 古いファイルの領域と圧縮データのSHA-256から位置を引けるようにする
+	index := make(map[[sha256.Size]byte]int64)
+	oldHash := sha256.New()
+	for _, region := range patchRegions(oldFile, oldSize) {
+		whole, data, err := hashRegion(oldFile, region, oldHash)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := index[whole]; !ok {
+			index[whole] = region.off
+		}
+		if region.data > region.off && region.data < region.off+region.size {
+			if _, ok := index[data]; !ok {
+				index[data] = region.data
+			}
+		}
+	}
+	oldHash.Sum(info.OldSHA256[:0])
+
+	zw := zip.NewWriter(w)
+	zw.RegisterCompressor(zip.Deflate, CompressorLevel(zip.Deflate, LevelBest))
+	dataWriter, err := zw.CreateHeader(&zip.FileHeader{Name: patchDataName, Method: zip.Deflate})
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []patchOp
+	add := func(op patchOp) {
+		if op.length == 0 {
+			return
+		}
+		if n := len(ops); n > 0 && ops[n-1].copy == op.copy && (!op.copy || ops[n-1].offset+ops[n-1].length == op.offset) {
+			ops[n-1].length += op.length
+			return
+		}
+		ops = append(ops, op)
+	}
+	insert := func(off, length int64) error {
+		if _, err := io.Copy(dataWriter, io.NewSectionReader(newFile, off, length)); err != nil {
+			return err
+		}
+		info.Inserted += length
+		add(patchOp{length: length})
+		return nil
+	}
+
+	newHash := sha256.New()
+	for _, region := range patchRegions(newFile, newSize) {
+		whole, data, err := hashRegion(newFile, region, newHash)
+		if err != nil {
+			return nil, err
+		}
+		if off, ok := index[whole]; ok {
+			info.Copied += region.size
+			add(patchOp{copy: true, offset: off, length: region.size})
+			continue
+		}
+		// ヘッダだけが変わったエントリ（日時・名前の変更など）は、圧縮データだけをコピーする
+		if region.data > region.off && region.data < region.off+region.size {
+			if off, ok := index[data]; ok {
+				if err := insert(region.off, region.data-region.off); err != nil {
+					return nil, err
+				}
+				length := region.off + region.size - region.data
+				info.Copied += length
+				add(patchOp{copy: true, offset: off, length: length})
+				continue
+			}
+		}
+		if err := insert(region.off, region.size); err != nil {
+			return nil, err
+		}
+	}
+	newHash.Sum(info.NewSHA256[:0])
+	info.Ops = len(ops)
+
+	manifest, err := zw.Create(PatchManifestName)
+	if err != nil {
+		return nil, err
+	}
+	if err := writePatchManifest(manifest, info, ops); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// CreatePatchFile は CreatePatch で作成したパッチを patchPath に保存します
+func CreatePatchFile(oldPath, newPath, patchPath string) (*PatchInfo, error) {
+	f, err := os.Create(patchPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := CreatePatch(oldPath, newPath, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(patchPath)
+		return nil, err
+	}
+	return info, nil
+}
+
+// ApplyPatch は古いファイルにパッチを適用し、新しいファイルの内容を w に書き込みます
+// 適用する前に古いファイル全体のSHA-256を、適用した後に書き込んだ内容全体のSHA-256を確かめます
+// 一致しない場合は ErrPatchBaseMismatch・ErrPatchVerify を返します（後者の場合、w には書き込み済みです）
+func ApplyPatch(oldPath, patchPath string, w io.Writer) (*PatchInfo, error) {
+	reader, err := OpenReader(patchPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	info, ops, dataFile, err := readPatch(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	oldFile, oldSize, err := openPatchInput(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	defer oldFile.Close()
+	oldHash := sha256.New()
+	if _, err := io.Copy(oldHash, io.NewSectionReader(oldFile, 0, oldSize)); err != nil {
+		return nil, err
+	}
+	var oldSum [sha256.Size]byte
+	oldHash.Sum(oldSum[:0])
+	if oldSize != info.OldSize || oldSum != info.OldSHA256 {
+		return nil, ErrPatchBaseMismatch
+	}
+
+	data, err := OpenFile(dataFile)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+
+	newHash := sha256.New()
+	out := io.MultiWriter(w, newHash)
+	var written int64
+	for _, op := range ops {
+		var src io.Reader = data
+		if op.copy {
+			if op.offset < 0 || op.offset+op.length > oldSize {
+				return nil, fmt.Errorf("パッチの操作が古いファイルの範囲を超えています: copy %d %d", op.offset, op.length)
+			}
+			src = io.NewSectionReader(oldFile, op.offset, op.length)
+		}
+		n, err := io.CopyN(out, src, op.length)
+		written += n
+		if errors.Is(err, io.EOF) {
+			return nil, ErrPatchVerify
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	// データのエントリに使われない余分なバイト列がないことと、CRCを最後まで読んで確かめる
+	if n, err := io.Copy(io.Discard, data); err != nil {
+		return nil, err
+	} else if n > 0 {
+		return nil, ErrPatchVerify
+	}
+	var newSum [sha256.Size]byte
+	newHash.Sum(newSum[:0])
+	if written != info.NewSize || newSum != info.NewSHA256 {
+		return nil, ErrPatchVerify
+	}
+	return info, nil
+}
+
+// ApplyPatchFile は古いファイルにパッチを適用し、新しいファイルを outPath に保存します
+// outPath と同じディレクトリの一時ファイルに書き込み、SHA-256を確かめてから名前を変更するため、
+// outPath に古いファイルを指定して置き換えることもできます（確かめられなかった場合は何も変更しません。パーミッションは引き継ぎます）
+func ApplyPatchFile(oldPath, patchPath, outPath string) (*PatchInfo, error) {
+	var info *PatchInfo
+	err := common.ReplaceFile(outPath, func(tmp *os.File) error {
+		var err error
+		info, err = ApplyPatch(oldPath, patchPath, tmp)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ReadPatchInfo はパッチの操作の一覧を読み取り、内容の概要を返します
+func ReadPatchInfo(patchPath string) (*PatchInfo, error) {
+	reader, err := OpenReader(patchPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	info, _, _, err := readPatch(reader)
+	return info, err
+}
+
+// openPatchInput はパッチの作成・適用に使うファイルを開きます（分割アーカイブには対応しない）
+func openPatchInput(name string) (*os.File, int64, error) {
+	if volumes, err := SplitVolumes(name); err != nil {
+		return nil, 0, err
+	} else if volumes != nil {
+		return nil, 0, errors.New("分割アーカイブのパッチは作成・適用できません（join で結合してから行ってください）")
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, fi.Size(), nil
+}
+
+// patchRegions はファイルを、ZIPのエントリごとの領域と、それ以外の領域に区切ります
+// 領域はファイル全体を先頭から隙間なく覆います。ZIPとして読み取れない場合はファイル全体をひとつの領域とします
+func patchRegions(r io.ReaderAt, size int64) []patchRegion {
+	whole := []patchRegion{{off: 0, size: size, data: 0}}
+	dir, err := ReadDirectory(r, size)
+	if err != nil || dir.Disk != 0 {
+		return whole
+	}
+
+	starts := make([]int64, 0, len(dir.Entries))
+	for _, e := range dir.Entries {
+		if e.Disk != 0 {
+			return whole
+		}
+		starts = append(starts, dir.BaseOffset+e.HeaderOffset)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	cdStart := dir.BaseOffset + dir.Offset
+
+	var regions []patchRegion
+	pos := int64(0)
+	addPlain := func(end int64) {
+		if end > pos {
+			regions = append(regions, patchRegion{off: pos, size: end - pos, data: pos})
+			pos = end
+		}
+	}
+	for i, start := range starts {
+		end := cdStart
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		if start < pos || end < start || end > cdStart {
+			return whole
+		}
+		if start == end {
+			continue
+		}
+		addPlain(start)
+		region := patchRegion{off: start, size: end - start, data: start}
+		var lh [localHeaderLen]byte
+		if _, err := r.ReadAt(lh[:], start); err == nil && binary.LittleEndian.Uint32(lh[0:4]) == LocalHeaderSignature {
+			data := start + localHeaderLen + int64(binary.LittleEndian.Uint16(lh[26:28])) + int64(binary.LittleEndian.Uint16(lh[28:30]))
+			if data <= end {
+				region.data = data
+			}
+		}
+		regions = append(regions, region)
+		pos = end
+	}
+	addPlain(size)
+	return regions
+}
+
+// hashRegion は領域全体と、その中の圧縮データのSHA-256を計算します
+// 読み取った領域全体は total にも書き込みます（ファイル全体のSHA-256の計算用）
+func hashRegion(r io.ReaderAt, region patchRegion, total io.Writer) (whole, data [sha256.Size]byte, err error) {
+	wh := sha256.New()
+	dh := sha256.New()
+	header := region.data - region.off
+	if _, err = io.Copy(io.MultiWriter(wh, total), io.NewSectionReader(r, region.off, header)); err != nil {
+		return
+	}
+	if _, err = io.Copy(io.MultiWriter(wh, dh, total), io.NewSectionReader(r, region.data, region.size-header)); err != nil {
+		return
+	}
+	wh.Sum(whole[:0])
+	dh.Sum(data[:0])
+	return
+}
+
+// writePatchManifest はパッチの操作の一覧を書き込みます
+//
+//	zip-editor-patch 1
+//	old <サイズ> <SHA-256>
+//	new <サイズ> <SHA-256>
+//	copy <古いファイルの位置> <長さ>
+//	insert <長さ>
+func writePatchManifest(w io.Writer, info *PatchInfo, ops []patchOp) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, patchMagic)
+	fmt.Fprintf(bw, "old %d %s\n", info.OldSize, hex.EncodeToString(info.OldSHA256[:]))
+	fmt.Fprintf(bw, "new %d %s\n", info.NewSize, hex.EncodeToString(info.NewSHA256[:]))
+	for _, op := range ops {
+		if op.copy {
+			fmt.Fprintf(bw, "copy %d %d\n", op.offset, op.length)
+		} else {
+			fmt.Fprintf(bw, "insert %d\n", op.length)
+		}
+	}
+	return bw.Flush()
+}
+
+// readPatch はパッチの操作の一覧を読み取り、データのエントリを返します
+// パッチのZIPの前後に余分なデータが付加されている場合は、壊れたパッチとして扱います
+func readPatch(reader *ReadCloser) (*PatchInfo, []patchOp, *zip.File, error) {
+	if err := checkPatchLayout(reader); err != nil {
+		return nil, nil, nil, err
+	}
+	var manifestFile, dataFile *zip.File
+	for _, f := range reader.File {
+		switch f.Name {
+		case PatchManifestName:
+			manifestFile = f
+		case patchDataName:
+			dataFile = f
+		}
+	}
+	if manifestFile == nil || dataFile == nil {
+		return nil, nil, nil, errors.New("パッチのファイルではありません")
+	}
+	rc, err := OpenFile(manifestFile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rc.Close()
+
+	info := &PatchInfo{}
+	var ops []patchOp
+	scanner := bufio.NewScanner(rc)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if lineNo == 1 {
+			if line != patchMagic {
+				return nil, nil, nil, errors.New("対応していない形式のパッチです")
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		bad := fmt.Errorf("パッチの操作の一覧の %d 行目が正しくありません: %s", lineNo, line)
+		switch {
+		case (fields[0] == "old" || fields[0] == "new") && len(fields) == 3:
+			size, err := strconv.ParseInt(fields[1], 10, 64)
+			sum, herr := hex.DecodeString(fields[2])
+			if err != nil || herr != nil || len(sum) != sha256.Size || size < 0 {
+				return nil, nil, nil, bad
+			}
+			if fields[0] == "old" {
+				info.OldSize = size
+				copy(info.OldSHA256[:], sum)
+			} else {
+				info.NewSize = size
+				copy(info.NewSHA256[:], sum)
+			}
+		case fields[0] == "copy" && len(fields) == 3:
+			offset, err1 := strconv.ParseInt(fields[1], 10, 64)
+			length, err2 := strconv.ParseInt(fields[2], 10, 64)
+			if err1 != nil || err2 != nil || offset < 0 || length < 0 {
+				return nil, nil, nil, bad
+			}
+			ops = append(ops, patchOp{copy: true, offset: offset, length: length})
+			info.Copied += length
+		case fields[0] == "insert" && len(fields) == 2:
+			length, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil || length < 0 {
+				return nil, nil, nil, bad
+			}
+			ops = append(ops, patchOp{length: length})
+			info.Inserted += length
+		default:
+			return nil, nil, nil, bad
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	if lineNo == 0 {
+		return nil, nil, nil, errors.New("対応していない形式のパッチです")
+	}
+	info.Ops = len(ops)
+	return info, ops, dataFile, nil
+}
+
+// checkPatchLayout はパッチのファイルが、前後に余分なデータのないZIPファイルであることを確かめます
+func checkPatchLayout(reader *ReadCloser) error {
+	dir, err := ReadDirectory(reader.ra, reader.size)
+	if err != nil {
+		return err
+	}
+	if dir.EndOffset+endLen+int64(len(dir.Comment)) != reader.size {
+		return fmt.Errorf("%w（ZIPの後ろに余分なデータがあります）", ErrPatchCorrupt)
+	}
+	prefix, err := ReadPrefix(reader.ra, reader.size)
+	if err != nil {
+		return err
+	}
+	if prefix.Size > 0 || prefix.SigningBlockSize > 0 {
+		return fmt.Errorf("%w（ZIPの前に余分なデータがあります）", ErrPatchCorrupt)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPatchRoundTrip(t *testing.T) {
+	oldZip := buildZip(t, []testEntry{
+		{name: "a.txt", data: testText(50000), method: zip.Deflate},
+		{name: "b.txt", data: testText(3000)},
+		{name: "c.bin", data: bytes.Repeat([]byte{1, 2, 3}, 1000)},
+	})
+	newZip := buildZip(t, []testEntry{
+		{name: "a.txt", data: testText(50000), method: zip.Deflate},
+		{name: "b.txt", data: testText(3500)},
+		{name: "d.txt", data: []byte("追加したファイル")},
+	})
+	tests := []struct {
+		name     string
+		old, new []byte
+	}{
+		{name: "ZIPファイル", old: oldZip, new: newZip},
+		{name: "同じ内容", old: oldZip, new: oldZip},
+		{name: "ZIP以外のファイル", old: []byte("古い内容\n"), new: []byte("新しい内容\n")},
+		{name: "空のファイル", old: nil, new: []byte("内容")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			oldPath := writeTestFile(t, dir, "old", tt.old)
+			newPath := writeTestFile(t, dir, "new", tt.new)
+			patchPath := filepath.Join(dir, "patch.zip")
+
+			created, err := CreatePatchFile(oldPath, newPath, patchPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created.OldSize != int64(len(tt.old)) || created.NewSize != int64(len(tt.new)) {
+				t.Errorf("サイズ = %d → %d, want %d → %d", created.OldSize, created.NewSize, len(tt.old), len(tt.new))
+			}
+			if created.Copied+created.Inserted != created.NewSize {
+				t.Errorf("コピー %d + 追加 %d が新しいファイルのサイズ %d と一致しません", created.Copied, created.Inserted, created.NewSize)
+			}
+
+			// 古いファイルを置き換えて適用する
+			if _, err := ApplyPatchFile(oldPath, patchPath, oldPath); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(oldPath); !bytes.Equal(got, tt.new) {
+				t.Error("パッチを適用した結果が新しいファイルと一致しません")
+			}
+		})
+	}
+}
+
+// 変更されていないエントリは古いファイルからコピーし、パッチに含めないことを確認する
+func TestPatchCopiesUnchangedEntries(t *testing.T) {
+	big := testText(200000)
+	oldZip := buildZip(t, []testEntry{{name: "big.txt", data: big}, {name: "small.txt", data: []byte("old")}})
+	newZip := buildZip(t, []testEntry{{name: "big.txt", data: big}, {name: "small.txt", data: []byte("new")}})
+	dir := t.TempDir()
+	info, err := CreatePatchFile(writeTestFile(t, dir, "old.zip", oldZip), writeTestFile(t, dir, "new.zip", newZip), filepath.Join(dir, "patch.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Copied < int64(len(big)) {
+		t.Errorf("コピーしたバイト数 = %d, want %d 以上", info.Copied, len(big))
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := writeTestFile(t, dir, "old.zip", buildZip(t, []testEntry{{name: "a.txt", data: testText(1000)}}))
+	newPath := writeTestFile(t, dir, "new.zip", buildZip(t, []testEntry{{name: "a.txt", data: testText(2000)}}))
+	patchPath := filepath.Join(dir, "patch.zip")
+	if _, err := CreatePatchFile(oldPath, newPath, patchPath); err != nil {
+		t.Fatal(err)
+	}
+	patch, err := os.ReadFile(patchPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		base  string
+		patch []byte
+		want  error
+	}{
+		{name: "古いファイルが違う", base: newPath, patch: patch, want: ErrPatchBaseMismatch},
+		{name: "後ろに余分なデータ", base: oldPath, patch: append(bytes.Clone(patch), "junk"...), want: ErrPatchCorrupt},
+		{name: "前に余分なデータ", base: oldPath, patch: append([]byte("junk"), patch...), want: ErrPatchCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := writeTestFile(t, t.TempDir(), "patch.zip", tt.patch)
+			out := filepath.Join(t.TempDir(), "out.zip")
+			if _, err := ApplyPatchFile(tt.base, p, out); !errors.Is(err, tt.want) {
+				t.Errorf("ApplyPatchFile = %v, want %v", err, tt.want)
+			}
+			if _, err := os.Stat(out); !errors.Is(err, os.ErrNotExist) {
+				t.Error("失敗したのに出力先のファイルが作成されています")
+			}
+			if _, err := ReadPatchInfo(p); tt.want == ErrPatchCorrupt && !errors.Is(err, ErrPatchCorrupt) {
+				t.Errorf("ReadPatchInfo = %v, want %v", err, ErrPatchCorrupt)
+			}
+		})
+	}
+}
+
+// writeTestFile はテスト用のファイルを作成し、そのパスを返します
+func writeTestFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,153 @@
+package zipfmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// PrefixKind はZIPのデータより前に付加されたデータの種類です
+type PrefixKind int
+
+const (
+	PrefixNone       PrefixKind = iota
+	PrefixData                  // 種類を判定できないデータ
+	PrefixWindowsExe            // Windowsの実行ファイル（自己解凍形式など）
+	PrefixELF                   // Linuxなどの実行ファイル
+	PrefixScript                // シェルスクリプトなど（"#!"で始まるもの）
+)
+
+// String は種類の表示名を返します
+func (k PrefixKind) String() string {
+	switch k {
+	case PrefixNone:
+		return "なし"
+	case PrefixWindowsExe:
+		return "Windows実行ファイル"
+	case PrefixELF:
+		return "ELF実行ファイル"
+	case PrefixScript:
+		return "スクリプト"
+	}
+	return "データ"
+}
+
+// apkSigBlockMagic はAPK署名ブロックの末尾に置かれる識別子です
+var apkSigBlockMagic = []byte("APK Sig Block 42")
+
+// Prefix はZIPのデータより前に付加されたデータ（自己解凍スタブなど）と、APK署名ブロックの情報です
+type Prefix struct {
+	Size int64 // 付加されたデータの長さ（ない場合は0）
+	Kind PrefixKind
+	// Adjusted は各エントリの位置の記録値が、付加されたデータを含むファイル先頭からの位置になっているかどうかです
+	// falseの場合はZIPのデータ先頭からの位置で記録されています（単純に連結した場合など）
+	Adjusted bool
+	// SigningBlockSize は中央ディレクトリの直前にあるAPK署名ブロックの長さです（ない場合は0）
+	// 署名はエントリの内容に対するものなので、書き直したZIPファイルには引き継ぎません
+	SigningBlockSize int64
+}
+
+// ReadPrefix は先頭に付加されたデータとAPK署名ブロックを調べます
+// 付加されたデータは、最初のローカルファイルヘッダ（エントリがない場合は中央ディレクトリ）より前の部分です
+func ReadPrefix(r io.ReaderAt, size int64) (*Prefix, error) {
+	dir, err := ReadDirectory(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	start := dir.Offset
+	for _, e := range dir.Entries {
+		if e.Disk == 0 && e.HeaderOffset < start {
+			start = e.HeaderOffset
+		}
+	}
+	p := &Prefix{Size: dir.BaseOffset + start}
+	if p.Size > 0 {
+		p.Adjusted = dir.BaseOffset == 0
+		head := make([]byte, min(p.Size, 4))
+		if _, err := r.ReadAt(head, 0); err != nil {
+			return nil, err
+		}
+		p.Kind = prefixKind(head)
+	}
+
+	// APK署名ブロックは「長さ（8バイト）・ペア・長さ（8バイト）・識別子（16バイト）」の形式で、
+	// 先頭の長さフィールドを除いた長さが記録されている
+	cdStart := dir.BaseOffset + dir.Offset
+	var tail [24]byte
+	if dir.Disk == 0 && cdStart-p.Size >= int64(len(tail)) {
+		if _, err := r.ReadAt(tail[:], cdStart-int64(len(tail))); err == nil && bytes.Equal(tail[8:], apkSigBlockMagic) {
+			n := int64(binary.LittleEndian.Uint64(tail[:8]))
+			if n > 0 && n+8 <= cdStart-p.Size {
+				p.SigningBlockSize = n + 8
+			}
+		}
+	}
+	return p, nil
+}
+
+// prefixKind は付加されたデータの先頭から種類を判定します
+func prefixKind(head []byte) PrefixKind {
+	switch {
+	case bytes.HasPrefix(head, []byte("MZ")):
+		return PrefixWindowsExe
+	case bytes.HasPrefix(head, []byte("\x7fELF")):
+		return PrefixELF
+	case bytes.HasPrefix(head, []byte("#!")):
+		return PrefixScript
+	}
+	return PrefixData
+}
+
+// Prefix は先頭に付加されたデータとAPK署名ブロックを調べます
+// 分割アーカイブの場合、付加されたデータは常にありません
+func (rc *ReadCloser) Prefix() (*Prefix, error) {
+	return ReadPrefix(rc.ra, rc.size)
+}
+
+// CopyPrefix は先頭に付加されたデータを w に書き込みます
+func (rc *ReadCloser) CopyPrefix(w io.Writer, p *Prefix) (int64, error) {
+	return io.Copy(w, io.NewSectionReader(rc.ra, 0, p.Size))
+}
+
+// WriteWithStub はZIPファイル（r）の先頭に付加されたデータを stub の内容で置き換えて w に書き込みます
+// stub がnilの場合は付加されたデータを取り除きます。エントリは展開せずにそのままコピーし、
+// 位置の記録値は新しい先頭のデータを含むファイル先頭からの位置に調整します
+// APK署名ブロックはファイル全体に対する署名で、置き換えると無効になるため書き込みません
+func WriteWithStub(w io.Writer, r io.ReaderAt, size int64, stub io.Reader) error {
+	dir, err := ReadDirectory(r, size)
+	if err != nil {
+		return err
+	}
+	if dir.Disk != 0 {
+		return errors.New("分割アーカイブの先頭のデータは変更できません")
+	}
+	prefix, err := ReadPrefix(r, size)
+	if err != nil {
+		return err
+	}
+
+	var stubSize int64
+	if stub != nil {
+		if stubSize, err = io.Copy(w, stub); err != nil {
+			return err
+		}
+	}
+
+	// ローカルファイルヘッダとデータは、隙間を含めてそのままコピーする
+	dataStart := prefix.Size
+	dataEnd := dir.BaseOffset + dir.Offset - prefix.SigningBlockSize
+	if _, err := io.Copy(w, io.NewSectionReader(r, dataStart, dataEnd-dataStart)); err != nil {
+		return err
+	}
+
+	entries := make([]*DirEntry, len(dir.Entries))
+	for i, e := range dir.Entries {
+		moved := *e
+		moved.HeaderOffset = stubSize + dir.BaseOffset + e.HeaderOffset - dataStart
+		entries[i] = &moved
+	}
+	_, err = w.Write(appendDirectory(nil, entries, stubSize+dataEnd-dataStart, dir.Comment, dir.Zip64))
+	return err
+}
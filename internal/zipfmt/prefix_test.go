@@ -0,0 +1,283 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+)
+
+var (
+	// sfxStub は自己解凍形式のスタブの代わりに使う、Windows実行ファイルのように始まるデータです
+	sfxStub = append([]byte("MZ\x90\x00"), bytes.Repeat([]byte{0xcc}, 1000)...)
+	// scriptStub はZIPファイルの先頭に付加するシェルスクリプトです
+	scriptStub = []byte("#!/bin/sh\nexec unzip -o \"$0\" -d /tmp/app\n")
+)
+
+// prefixTestEntries は先頭に付加されたデータのテストで使うエントリです
+var prefixTestEntries = []testEntry{
+	{name: "AndroidManifest.xml", data: testText(3000), method: zip.Deflate},
+	{name: "classes.dex", data: testText(10000), method: zip.Store},
+	{name: "res/", data: nil},
+	{name: "res/日本語.txt", data: []byte("リソース"), method: zip.Deflate},
+}
+
+func TestReadPrefix(t *testing.T) {
+	signing := apkSigningBlock()
+	tests := []struct {
+		name         string
+		stub         []byte
+		adjusted     bool
+		signing      []byte
+		entries      []testEntry
+		wantKind     PrefixKind
+		wantAdjusted bool
+	}{
+		{name: "付加されたデータなし", wantKind: PrefixNone},
+		{name: "自己解凍形式", stub: sfxStub, adjusted: true, wantKind: PrefixWindowsExe, wantAdjusted: true},
+		{name: "位置を調整せずに連結した自己解凍形式", stub: sfxStub, wantKind: PrefixWindowsExe},
+		{name: "シェルスクリプト", stub: scriptStub, adjusted: true, wantKind: PrefixScript, wantAdjusted: true},
+		{name: "ELF実行ファイル", stub: []byte("\x7fELF\x02\x01\x01"), adjusted: true, wantKind: PrefixELF, wantAdjusted: true},
+		{name: "種類を判定できないデータ", stub: []byte("xyz"), adjusted: true, wantKind: PrefixData, wantAdjusted: true},
+		{name: "APK署名ブロック", signing: signing, wantKind: PrefixNone},
+		{name: "シェルスクリプトとAPK署名ブロック", stub: scriptStub, adjusted: true, signing: signing, wantKind: PrefixScript, wantAdjusted: true},
+		// エントリがない場合は、中央ディレクトリより前が付加されたデータになる
+		{name: "エントリのない自己解凍形式", stub: sfxStub, adjusted: true, entries: []testEntry{}, wantKind: PrefixWindowsExe, wantAdjusted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := tt.entries
+			if entries == nil {
+				entries = prefixTestEntries
+			}
+			data := buildPrefixedZip(t, tt.stub, tt.adjusted, tt.signing, entries)
+			p, err := ReadPrefix(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Size != int64(len(tt.stub)) || p.Kind != tt.wantKind || p.Adjusted != tt.wantAdjusted {
+				t.Errorf("ReadPrefix = %+v, want Size %d Kind %v Adjusted %v", p, len(tt.stub), tt.wantKind, tt.wantAdjusted)
+			}
+			if p.SigningBlockSize != int64(len(tt.signing)) {
+				t.Errorf("SigningBlockSize = %d, want %d", p.SigningBlockSize, len(tt.signing))
+			}
+		})
+	}
+}
+
+// エントリの直後にたまたま識別子と同じバイト列があっても、長さが合わなければ署名ブロックとして扱わない
+func TestReadPrefixBrokenSigningBlock(t *testing.T) {
+	block := apkSigningBlock()
+	binary.LittleEndian.PutUint64(block[len(block)-24:], 1<<40)
+	data := buildPrefixedZip(t, nil, false, block, prefixTestEntries)
+	p, err := ReadPrefix(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SigningBlockSize != 0 {
+		t.Errorf("SigningBlockSize = %d, want 0", p.SigningBlockSize)
+	}
+}
+
+// WriteWithStub は先頭のデータを置き換え・削除し、APK署名ブロックを取り除いて、エントリの位置を新しいファイルに合わせる
+func TestWriteWithStub(t *testing.T) {
+	signing := apkSigningBlock()
+	sources := []struct {
+		name     string
+		stub     []byte
+		adjusted bool
+		signing  []byte
+	}{
+		{name: "付加されたデータなし"},
+		{name: "自己解凍形式", stub: sfxStub, adjusted: true},
+		{name: "位置を調整せずに連結した自己解凍形式", stub: sfxStub},
+		{name: "シェルスクリプト", stub: scriptStub, adjusted: true},
+		{name: "APK署名ブロック", signing: signing},
+		{name: "自己解凍形式とAPK署名ブロック", stub: sfxStub, adjusted: true, signing: signing},
+	}
+	stubs := []struct {
+		name string
+		stub []byte
+	}{
+		{name: "削除"},
+		{name: "シェルスクリプトに置き換え", stub: scriptStub},
+		{name: "自己解凍形式に置き換え", stub: sfxStub},
+	}
+	want := buildZip(t, prefixTestEntries)
+	for _, src := range sources {
+		for _, st := range stubs {
+			t.Run(src.name+"/"+st.name, func(t *testing.T) {
+				data := buildPrefixedZip(t, src.stub, src.adjusted, src.signing, prefixTestEntries)
+				var stub io.Reader
+				if st.stub != nil {
+					stub = bytes.NewReader(st.stub)
+				}
+				var buf bytes.Buffer
+				if err := WriteWithStub(&buf, bytes.NewReader(data), int64(len(data)), stub); err != nil {
+					t.Fatal(err)
+				}
+				got := buf.Bytes()
+				if !bytes.HasPrefix(got, st.stub) {
+					t.Error("先頭のデータが置き換えられていません")
+				}
+				checkRewrittenPrefix(t, got, int64(len(st.stub)))
+				compareZipContent(t, want, got)
+			})
+		}
+	}
+}
+
+// RewriteFile で書き直すと、先頭のデータは引き継ぎ、APK署名ブロックは取り除いて、エントリの位置を合わせる
+func TestRewriteFileDropsSigningBlock(t *testing.T) {
+	tests := []struct {
+		name     string
+		stub     []byte
+		adjusted bool
+		opts     RewriteFileOptions
+		wantStub []byte
+	}{
+		{name: "APK署名ブロックのみ"},
+		{name: "自己解凍形式", stub: sfxStub, adjusted: true, wantStub: sfxStub},
+		{name: "位置を調整せずに連結した自己解凍形式", stub: sfxStub, wantStub: sfxStub},
+		{name: "スタブを削除", stub: scriptStub, adjusted: true, opts: RewriteFileOptions{RewriteOptions: RewriteOptions{StripStub: true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeTestFile(t, dir, "app.apk", buildPrefixedZip(t, tt.stub, tt.adjusted, apkSigningBlock(), prefixTestEntries))
+			err := RewriteFile(path, tt.opts, func(zw *zip.Writer, reader *ReadCloser) error {
+				for _, f := range reader.File {
+					if err := CopyRaw(zw, f, nil); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(got, tt.wantStub) {
+				t.Error("先頭のデータが引き継がれていません")
+			}
+			checkRewrittenPrefix(t, got, int64(len(tt.wantStub)))
+			compareZipContent(t, buildZip(t, prefixTestEntries), got)
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("一時ファイルが残っています: %v", entries)
+			}
+		})
+	}
+}
+
+// buildPrefixedZip は先頭に stub を付加し、中央ディレクトリの直前に APK署名ブロック signing を挿入したZIPファイルを作成します
+// adjusted がtrueの場合は、エントリの位置の記録値を stub を含むファイル先頭からの位置にします
+func buildPrefixedZip(t *testing.T, stub []byte, adjusted bool, signing []byte, entries []testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if adjusted {
+		zw.SetOffset(int64(len(stub)))
+	}
+	for _, e := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: e.method, Modified: testTime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(e.data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	if len(signing) > 0 {
+		// 終端レコードに記録された中央ディレクトリの位置の前に挿入し、位置の記録値をずらす
+		eocd := data[len(data)-endLen:]
+		cdOffset := int64(binary.LittleEndian.Uint32(eocd[16:20]))
+		if adjusted {
+			cdOffset -= int64(len(stub))
+		}
+		binary.LittleEndian.PutUint32(eocd[16:20], binary.LittleEndian.Uint32(eocd[16:20])+uint32(len(signing)))
+		data = append(append(append([]byte(nil), data[:cdOffset]...), signing...), data[cdOffset:]...)
+	}
+	return append(append([]byte(nil), stub...), data...)
+}
+
+// apkSigningBlock はAPK署名ブロックの形式（長さ・IDと値のペア・長さ・識別子）のデータを作成します
+func apkSigningBlock() []byte {
+	value := bytes.Repeat([]byte("signature"), 30)
+	var pairs []byte
+	pairs = binary.LittleEndian.AppendUint64(pairs, uint64(4+len(value)))
+	pairs = binary.LittleEndian.AppendUint32(pairs, 0x7109871a)
+	pairs = append(pairs, value...)
+
+	n := uint64(len(pairs) + 8 + len(apkSigBlockMagic))
+	var block []byte
+	block = binary.LittleEndian.AppendUint64(block, n)
+	block = append(block, pairs...)
+	block = binary.LittleEndian.AppendUint64(block, n)
+	return append(block, apkSigBlockMagic...)
+}
+
+// checkRewrittenPrefix は書き直したZIPファイルの先頭のデータが stubSize バイトで、APK署名ブロックがなく、
+// 中央ディレクトリに記録されたエントリの位置がファイル先頭からの実際のローカルファイルヘッダの位置と一致することを確認します
+func checkRewrittenPrefix(t *testing.T, data []byte, stubSize int64) {
+	t.Helper()
+	if bytes.Contains(data, apkSigBlockMagic) {
+		t.Error("APK署名ブロックが残っています")
+	}
+	p, err := ReadPrefix(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Size != stubSize || p.SigningBlockSize != 0 || (stubSize > 0 && !p.Adjusted) {
+		t.Errorf("ReadPrefix = %+v, want Size %d Adjusted true", p, stubSize)
+	}
+
+	dir, err := ReadDirectory(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir.BaseOffset != 0 {
+		t.Errorf("位置の記録値が実際の位置と %d バイトずれています", dir.BaseOffset)
+	}
+	for _, e := range dir.Entries {
+		off := e.HeaderOffset
+		if off+localHeaderLen > int64(len(data)) || binary.LittleEndian.Uint32(data[off:]) != LocalHeaderSignature {
+			t.Errorf("%s: 位置 %d にローカルファイルヘッダがありません", e.Name, off)
+			continue
+		}
+		nameLen := int64(binary.LittleEndian.Uint16(data[off+26:]))
+		if name := string(data[off+localHeaderLen : off+localHeaderLen+nameLen]); name != e.Name {
+			t.Errorf("位置 %d のローカルファイルヘッダの名前 = %q, want %q", off, name, e.Name)
+		}
+	}
+}
+
+// compareZipContent は2つのZIPファイルのエントリの名前と内容が一致するかを確認します
+func compareZipContent(t *testing.T, want, got []byte) {
+	t.Helper()
+	rw := openZip(t, want)
+	rg := openZip(t, got)
+	if len(rg.File) != len(rw.File) {
+		t.Fatalf("エントリ = %v, want %v", fileNames(rg.File), fileNames(rw.File))
+	}
+	for i, f := range rg.File {
+		a, err := readAll(rw.File[i].Open())
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := readAll(f.Open())
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		if f.Name != rw.File[i].Name || !bytes.Equal(a, b) {
+			t.Errorf("%s: 内容が一致しません", f.Name)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// RecoveredEntry はローカルファイルヘッダの走査で回収できたエントリです
+type RecoveredEntry struct {
+	zip.FileHeader
+	HeaderOffset int64 // ローカルファイルヘッダの位置
+	DataOffset   int64 // 圧縮データの先頭位置
+	Verified     bool  // CRCを検証できたかどうか（暗号化や未対応の圧縮方式では検証できない）
+}
+
+// LostEntry は回収できなかったエントリです
+type LostEntry struct {
+	Name   string // ファイル名（ZIP内の生の名前）
+	Offset int64  // ローカルファイルヘッダの位置
+	Reason string // 回収できなかった理由
+}
+
+// RecoveryResult はローカルファイルヘッダの走査結果です
+type RecoveryResult struct {
+	Entries []*RecoveredEntry
+	Lost    []LostEntry
+	Size    int64 // 走査したファイルのサイズ
+}
+
+var (
+	errTruncated        = errors.New("データが途中で切れています")
+	errCRCMismatch      = errors.New("CRCが一致しません")
+	errSizeMismatch     = errors.New("サイズが一致しません")
+	errNoDataDescriptor = errors.New("データディスクリプタが見つかりません")
+	errNotHeader        = errors.New("ローカルファイルヘッダではありません")
+)
+
+// ScanLocalHeaders はファイルの先頭からローカルファイルヘッダを順に走査し、
+// 健全なエントリを回収します。中央ディレクトリは参照しないため、
+// 末尾が欠けたZIPや終端レコードが壊れたZIPにも使用できます。
+func ScanLocalHeaders(r io.ReaderAt, size int64) *RecoveryResult {
+	result := &RecoveryResult{Size: size}
+
+	pos := int64(0)
+	for pos < size {
+		off, ok := findSignature(r, pos, size, LocalHeaderSignature)
+		if !ok {
+			break
+		}
+
+		entry, next, err := readLocalEntry(r, off, size)
+		if err == errNotHeader {
+			// 圧縮データ中にたまたま現れたシグネチャなので読み飛ばす
+			pos = off + 4
+			continue
+		}
+		if err != nil {
+			name := ""
+			if entry != nil {
+				name = entry.Name
+			}
+			result.Lost = append(result.Lost, LostEntry{Name: name, Offset: off, Reason: err.Error()})
+			// データの終端が分かる場合は、データの中のヘッダ（無圧縮で格納された入れ子のZIPなど）を回収しないように読み飛ばす
+			pos = off + 4
+			if next > off {
+				pos = next
+			}
+			continue
+		}
+
+		result.Entries = append(result.Entries, entry)
+		pos = next
+	}
+
+	return result
+}
+
+// findSignature はstart以降で最初に現れるシグネチャの位置を探します
+func findSignature(r io.ReaderAt, start, size int64, signature uint32) (int64, bool) {
+	var sig [4]byte
+	binary.LittleEndian.PutUint32(sig[:], signature)
+
+	const chunkSize = 64 * 1024
+	buf := make([]byte, chunkSize)
+	for start < size {
+		n, err := r.ReadAt(buf, start)
+		if n < len(sig) {
+			return 0, false
+		}
+		if i := bytes.Index(buf[:n], sig[:]); i >= 0 {
+			return start + int64(i), true
+		}
+		if err != nil {
+			return 0, false
+		}
+		// チャンク境界をまたぐシグネチャを見逃さないように少し戻す
+		start += int64(n - len(sig) + 1)
+	}
+	return 0, false
+}
+
+// readLocalEntry はoffにあるローカルファイルヘッダを読み取り、データを検証します
+// 戻り値のnextは次のヘッダを探し始める位置です
+// 検証に失敗した場合も、記録されたサイズでデータの終端が分かるときはその後ろの位置を返します（分からない場合は0）
+func readLocalEntry(r io.ReaderAt, off, size int64) (*RecoveredEntry, int64, error) {
+	var buf [localHeaderLen]byte
+	if _, err := r.ReadAt(buf[:], off); err != nil {
+		return nil, 0, errTruncated
+	}
+
+	b := buf[4:]
+	readerVersion := binary.LittleEndian.Uint16(b[0:2])
+	flags := binary.LittleEndian.Uint16(b[2:4])
+	method := binary.LittleEndian.Uint16(b[4:6])
+	modTime := binary.LittleEndian.Uint16(b[6:8])
+	modDate := binary.LittleEndian.Uint16(b[8:10])
+	crc := binary.LittleEndian.Uint32(b[10:14])
+	csize := uint64(binary.LittleEndian.Uint32(b[14:18]))
+	usize := uint64(binary.LittleEndian.Uint32(b[18:22]))
+	nameLen := int64(binary.LittleEndian.Uint16(b[22:24]))
+	extraLen := int64(binary.LittleEndian.Uint16(b[24:26]))
+
+	// 明らかにヘッダとして不自然なものは除外する
+	if nameLen == 0 || readerVersion&0xff > 63 || flags&reservedFlags != 0 || !knownMethod(method) {
+		return nil, 0, errNotHeader
+	}
+
+	dataOff := off + localHeaderLen + nameLen + extraLen
+	if dataOff > size {
+		return nil, 0, errTruncated
+	}
+
+	nameAndExtra := make([]byte, nameLen+extraLen)
+	if _, err := r.ReadAt(nameAndExtra, off+localHeaderLen); err != nil {
+		return nil, 0, errTruncated
+	}
+	// 制御文字を含む名前は、データ中に現れたシグネチャの後ろの無関係なバイト列とみなす
+	if bytes.ContainsFunc(nameAndExtra[:nameLen], func(c rune) bool { return c < 0x20 || c == 0x7f }) {
+		return nil, 0, errNotHeader
+	}
+
+	entry := &RecoveredEntry{
+		FileHeader: zip.FileHeader{
+			Name:               string(nameAndExtra[:nameLen]),
+			CreatorVersion:     readerVersion,
+			ReaderVersion:      readerVersion,
+			Flags:              flags,
+			Method:             method,
+			ModifiedTime:       modTime,
+			ModifiedDate:       modDate,
+			CRC32:              crc,
+			CompressedSize64:   csize,
+			UncompressedSize64: usize,
+			Extra:              nameAndExtra[nameLen:],
+		},
+		HeaderOffset: off,
+		DataOffset:   dataOff,
+	}
+	if flags&FlagUTF8 == 0 {
+		entry.NonUTF8 = true
+	}
+	if strings.HasSuffix(entry.Name, "/") {
+		entry.ExternalAttrs = 0x10 // MS-DOSのディレクトリ属性
+	}
+
+	// ZIP64拡張情報があればサイズを置き換える
+	zip64 := false
+	if data, ok := FindExtra(entry.Extra, Zip64ExtraID); ok {
+		zip64 = true
+		if usize == uint32max && len(data) >= 8 {
+			entry.UncompressedSize64 = binary.LittleEndian.Uint64(data[0:8])
+			data = data[8:]
+		}
+		if csize == uint32max && len(data) >= 8 {
+			entry.CompressedSize64 = binary.LittleEndian.Uint64(data[0:8])
+		}
+	}
+
+	encrypted := flags&FlagEncrypted != 0
+	sizeUnknown := flags&FlagDataDescriptor != 0 && crc == 0 && csize == 0
+
+	var next int64
+	switch {
+	case sizeUnknown && method == zip.Deflate && !encrypted:
+		// Deflateは展開すればデータの終端が分かる
+		n, err := inflateEntry(r, entry, size)
+		if err != nil {
+			return entry, 0, err
+		}
+		next, err = checkDataDescriptor(r, entry, dataOff+n, zip64)
+		if err != nil {
+			return entry, 0, err
+		}
+		entry.Verified = true
+	case sizeUnknown:
+		// データディスクリプタを探してデータの終端を特定する
+		var err error
+		next, err = searchDataDescriptor(r, entry, size, zip64)
+		if err != nil {
+			return entry, 0, err
+		}
+		if err := verifyEntry(r, entry); err != nil {
+			return entry, 0, err
+		}
+	default:
+		end := dataOff + int64(entry.CompressedSize64)
+		if end > size || end < dataOff {
+			return entry, 0, errTruncated
+		}
+		next = end
+		if flags&FlagDataDescriptor != 0 {
+			next = skipDataDescriptor(r, end, size, zip64)
+		}
+		if err := verifyEntry(r, entry); err != nil {
+			return entry, next, err
+		}
+	}
+
+	return entry, next, nil
+}
+
+// reservedFlags は汎用フラグのうち、仕様で予約されていて使われないビットです
+const reservedFlags = 0x0780 | 0x1000 | 0xC000
+
+// knownMethod は圧縮方式がローカルファイルヘッダに記録されうるものかどうかを返します
+// PKWAREの仕様で定義された0〜20の方式と、このパッケージで名前の分かる方式（Zstandard・XZ・PPMd・AESなど）を認めます
+func knownMethod(method uint16) bool {
+	_, ok := methodNames[method]
+	return method <= 20 || ok
+}
+
+// verifyEntry は圧縮データを展開し、CRCとサイズを検証します
+// 暗号化されている場合や未対応の圧縮方式の場合は検証せずに成功とします
+func verifyEntry(r io.ReaderAt, entry *RecoveredEntry) error {
+	dcomp := Decompressor(entry.Method)
+	if entry.Flags&FlagEncrypted != 0 || dcomp == nil {
+		return nil
+	}
+
+	rc := dcomp(io.NewSectionReader(r, entry.DataOffset, int64(entry.CompressedSize64)))
+	defer rc.Close()
+
+	h := crc32.NewIEEE()
+	n, err := io.Copy(h, rc)
+	if err != nil {
+		return errTruncated
+	}
+	if uint64(n) != entry.UncompressedSize64 {
+		return errSizeMismatch
+	}
+	if h.Sum32() != entry.CRC32 {
+		return errCRCMismatch
+	}
+	entry.Verified = true
+	return nil
+}
+
+// countingReader は読み取ったバイト数を数えるリーダーです
+// flateがio.ByteReaderを優先して使うため、余分な先読みをせずに消費量を正確に測れます
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// inflateEntry はサイズが不明なDeflateデータを展開して、圧縮後サイズ・展開後サイズ・CRCを求めます
+func inflateEntry(r io.ReaderAt, entry *RecoveredEntry, size int64) (int64, error) {
+	cr := &countingReader{r: bufio.NewReader(io.NewSectionReader(r, entry.DataOffset, size-entry.DataOffset))}
+	fr := flate.NewReader(cr)
+	defer fr.Close()
+
+	h := crc32.NewIEEE()
+	n, err := io.Copy(h, fr)
+	if err != nil {
+		return 0, errTruncated
+	}
+
+	entry.CRC32 = h.Sum32()
+	entry.UncompressedSize64 = uint64(n)
+	entry.CompressedSize64 = uint64(cr.n)
+	return cr.n, nil
+}
+
+// dataDescriptor はデータディスクリプタに記録されたCRCとサイズです
+type dataDescriptor struct {
+	crc32            uint32
+	compressedSize   uint64
+	uncompressedSize uint64
+	length           int64 // シグネチャを除いた長さ
+}
+
+// parseDataDescriptor はシグネチャを除いたデータディスクリプタを読み取ります
+// zip64がtrueの場合はサイズを8バイトずつ記録したZIP64形式として読み取ります
+func parseDataDescriptor(b []byte, zip64 bool) (dataDescriptor, bool) {
+	if zip64 {
+		if len(b) < 20 {
+			return dataDescriptor{}, false
+		}
+		return dataDescriptor{
+			crc32:            binary.LittleEndian.Uint32(b[0:4]),
+			compressedSize:   binary.LittleEndian.Uint64(b[4:12]),
+			uncompressedSize: binary.LittleEndian.Uint64(b[12:20]),
+			length:           20,
+		}, true
+	}
+	if len(b) < 12 {
+		return dataDescriptor{}, false
+	}
+	return dataDescriptor{
+		crc32:            binary.LittleEndian.Uint32(b[0:4]),
+		compressedSize:   uint64(binary.LittleEndian.Uint32(b[4:8])),
+		uncompressedSize: uint64(binary.LittleEndian.Uint32(b[8:12])),
+		length:           12,
+	}, true
+}
+
+// checkDataDescriptor は展開して求めた値とデータディスクリプタの内容を照合し、次の位置を返します
+// CRCだけが偶然一致したものを採用しないように、圧縮後サイズと展開後サイズも照合します
+func checkDataDescriptor(r io.ReaderAt, entry *RecoveredEntry, off int64, zip64 bool) (int64, error) {
+	var buf [24]byte
+	n, _ := r.ReadAt(buf[:], off)
+	b := buf[:n]
+	if len(b) >= 4 && binary.LittleEndian.Uint32(b) == DataDescriptorSignature {
+		b = b[4:]
+		off += 4
+	}
+
+	desc, ok := parseDataDescriptor(b, zip64)
+	if !ok {
+		return 0, errTruncated
+	}
+	if desc.crc32 != entry.CRC32 {
+		return 0, errCRCMismatch
+	}
+	if desc.compressedSize != entry.CompressedSize64 || desc.uncompressedSize != entry.UncompressedSize64 {
+		return 0, errSizeMismatch
+	}
+	return off + desc.length, nil
+}
+
+// skipDataDescriptor はサイズが分かっているエントリのデータディスクリプタを読み飛ばします
+func skipDataDescriptor(r io.ReaderAt, off, size int64, zip64 bool) int64 {
+	var sig [4]byte
+	if _, err := r.ReadAt(sig[:], off); err == nil && binary.LittleEndian.Uint32(sig[:]) == DataDescriptorSignature {
+		off += 4
+	}
+	if zip64 {
+		off += 20
+	} else {
+		off += 12
+	}
+	if off > size {
+		return size
+	}
+	return off
+}
+
+// searchDataDescriptor はデータの後ろにあるデータディスクリプタを探し、サイズとCRCを確定します
+// 記録された圧縮後サイズが実際の位置と一致するものだけを採用します
+// 小さいエントリではZIP64形式の圧縮後サイズの下位4バイトも一致するため、
+// ローカルファイルヘッダにZIP64拡張情報がある場合はZIP64形式を先に試します
+func searchDataDescriptor(r io.ReaderAt, entry *RecoveredEntry, size int64, zip64 bool) (int64, error) {
+	forms := []bool{false, true}
+	if zip64 {
+		forms = []bool{true, false}
+	}
+
+	pos := entry.DataOffset
+	for {
+		off, ok := findSignature(r, pos, size, DataDescriptorSignature)
+		if !ok {
+			return 0, errNoDataDescriptor
+		}
+
+		var buf [24]byte
+		n, _ := r.ReadAt(buf[:], off+4)
+		csize := uint64(off - entry.DataOffset)
+		for _, form := range forms {
+			desc, ok := parseDataDescriptor(buf[:n], form)
+			if ok && desc.compressedSize == csize {
+				entry.CRC32 = desc.crc32
+				entry.CompressedSize64 = csize
+				entry.UncompressedSize64 = desc.uncompressedSize
+				return off + 4 + desc.length, nil
+			}
+		}
+
+		pos = off + 4
+	}
+}
@@ -0,0 +1,389 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"math/rand"
+	"testing"
+)
+
+// 末尾が欠けたものや終端レコードが壊れたものでも、ローカルファイルヘッダから健全なエントリを回収できる
+func TestScanLocalHeadersDamaged(t *testing.T) {
+	random := make([]byte, 20<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	data := buildZip(t, []testEntry{
+		{name: "dir/", data: nil},
+		{name: "dir/a.txt", data: testText(30 << 10), method: zip.Deflate},
+		{name: "stored.bin", data: random, method: zip.Store},
+		{name: "empty.txt", data: nil, method: zip.Deflate},
+		{name: "empty.bin", data: nil, method: zip.Store},
+		{name: "日本語.txt", data: []byte("回収するエントリ"), method: zip.Deflate},
+		{name: "last.txt", data: testText(10 << 10), method: zip.Deflate},
+	})
+	r := openZip(t, data)
+	files := r.File
+	last := files[len(files)-1]
+	lastOff, err := last.DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cdOff := int64(binary.LittleEndian.Uint32(data[len(data)-6:]))
+	storedOff, err := files[2].DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		damage   func(b []byte) []byte
+		wantLost string // 回収できないエントリ（空の場合はすべて回収できる）
+		reason   error
+	}{
+		{name: "壊れていない", damage: func(b []byte) []byte { return b }},
+		{name: "終端レコードがない", damage: func(b []byte) []byte { return b[:len(b)-22] }},
+		{name: "終端レコードのシグネチャが壊れている", damage: func(b []byte) []byte {
+			copy(b[len(b)-22:], "XXXX")
+			return b
+		}},
+		{name: "終端レコードの中央ディレクトリの位置が壊れている", damage: func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[len(b)-6:], 0x7fffffff)
+			return b
+		}},
+		{name: "中央ディレクトリの途中で切れている", damage: func(b []byte) []byte { return b[:cdOff+10] }},
+		{name: "最後のエントリの圧縮データの途中で切れている", damage: func(b []byte) []byte {
+			return b[:lastOff+int64(last.CompressedSize64)/2]
+		}, wantLost: last.Name, reason: errTruncated},
+		{name: "最後のエントリのデータディスクリプタの途中で切れている", damage: func(b []byte) []byte {
+			return b[:lastOff+int64(last.CompressedSize64)+8]
+		}, wantLost: last.Name, reason: errTruncated},
+		// 無圧縮でサイズが不明なエントリは、データディスクリプタが見つからなければ終端が分からない
+		{name: "無圧縮のエントリの途中で切れている", damage: func(b []byte) []byte {
+			return b[:storedOff+100]
+		}, wantLost: files[2].Name, reason: errNoDataDescriptor},
+		{name: "無圧縮のエントリの内容が壊れている", damage: func(b []byte) []byte {
+			b[storedOff+10] ^= 0xff
+			return b
+		}, wantLost: files[2].Name, reason: errCRCMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.damage(append([]byte(nil), data...))
+			result := ScanLocalHeaders(bytes.NewReader(b), int64(len(b)))
+			if result.Size != int64(len(b)) {
+				t.Errorf("Size = %d, want %d", result.Size, len(b))
+			}
+
+			var want []*zip.File
+			for _, f := range files {
+				// 切れた位置より後ろのエントリは、回収できなかったエントリにも記録されない
+				if off, _ := f.DataOffset(); off < int64(len(b)) && f.Name != tt.wantLost {
+					want = append(want, f)
+				}
+			}
+			if len(result.Entries) != len(want) {
+				t.Fatalf("回収したエントリ = %d件, want %d件 (失敗: %+v)", len(result.Entries), len(want), result.Lost)
+			}
+			for i, e := range result.Entries {
+				f := want[i]
+				if e.Name != f.Name || e.CRC32 != f.CRC32 || e.CompressedSize64 != f.CompressedSize64 || e.UncompressedSize64 != f.UncompressedSize64 {
+					t.Errorf("%s: CRC %08x サイズ %d/%d, want %s: CRC %08x サイズ %d/%d",
+						e.Name, e.CRC32, e.CompressedSize64, e.UncompressedSize64,
+						f.Name, f.CRC32, f.CompressedSize64, f.UncompressedSize64)
+				}
+				if !e.Verified {
+					t.Errorf("%s: CRCを検証していません", e.Name)
+				}
+				if off, _ := f.DataOffset(); e.DataOffset != off {
+					t.Errorf("%s: DataOffset = %d, want %d", e.Name, e.DataOffset, off)
+				}
+			}
+
+			if tt.wantLost == "" {
+				if len(result.Lost) != 0 {
+					t.Errorf("回収できなかったエントリ = %+v", result.Lost)
+				}
+				return
+			}
+			if len(result.Lost) != 1 || result.Lost[0].Name != tt.wantLost || result.Lost[0].Reason != tt.reason.Error() {
+				t.Errorf("回収できなかったエントリ = %+v, want %s（%v）", result.Lost, tt.wantLost, tt.reason)
+			}
+		})
+	}
+}
+
+// データディスクリプタを使うエントリは、32ビット形式とZIP64形式のどちらでもサイズとCRCを確定できる
+func TestScanLocalHeadersDataDescriptor(t *testing.T) {
+	text := testText(50 << 10)
+	// 無圧縮のデータ中に、圧縮後サイズが一致しないデータディスクリプタのシグネチャを含める
+	fake := append([]byte("偽物の PK\x07\x08 "), bytes.Repeat([]byte{0x12}, 40)...)
+
+	tests := []struct {
+		name   string
+		method uint16
+		data   []byte
+		zip64  bool
+	}{
+		{name: "Deflate・32ビット形式", method: zip.Deflate, data: text},
+		{name: "無圧縮・32ビット形式", method: zip.Store, data: text},
+		{name: "Deflate・ZIP64形式", method: zip.Deflate, data: text, zip64: true},
+		{name: "無圧縮・ZIP64形式", method: zip.Store, data: text, zip64: true},
+		{name: "空のファイル・ZIP64形式", method: zip.Store, data: nil, zip64: true},
+		{name: "データ中の偽のシグネチャ", method: zip.Store, data: fake},
+		{name: "データ中の偽のシグネチャ・ZIP64形式", method: zip.Store, data: fake, zip64: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := descriptorEntry(t, "a.bin", tt.method, tt.data, tt.zip64, nil)
+			second := descriptorEntry(t, "b.txt", zip.Deflate, []byte("次のエントリ"), tt.zip64, nil)
+			b := append(append([]byte(nil), first...), second...)
+
+			result := ScanLocalHeaders(bytes.NewReader(b), int64(len(b)))
+			if len(result.Lost) != 0 || len(result.Entries) != 2 {
+				t.Fatalf("回収したエントリ = %d件, 失敗 = %+v", len(result.Entries), result.Lost)
+			}
+			e := result.Entries[0]
+			if e.CRC32 != crc32.ChecksumIEEE(tt.data) || e.UncompressedSize64 != uint64(len(tt.data)) {
+				t.Errorf("CRC %08x サイズ %d, want CRC %08x サイズ %d", e.CRC32, e.UncompressedSize64, crc32.ChecksumIEEE(tt.data), len(tt.data))
+			}
+			if !e.Verified {
+				t.Error("CRCを検証していません")
+			}
+			// 次のエントリはデータディスクリプタの直後から始まる
+			if next := result.Entries[1]; next.Name != "b.txt" || next.HeaderOffset != int64(len(first)) {
+				t.Errorf("次のエントリ = %s (%d), want b.txt (%d)", next.Name, next.HeaderOffset, len(first))
+			}
+		})
+	}
+}
+
+// Deflateのエントリは、展開して求めたCRCとサイズがデータディスクリプタと一致する場合だけ回収する
+func TestScanLocalHeadersDescriptorMismatch(t *testing.T) {
+	data := testText(20 << 10)
+	tests := []struct {
+		name   string
+		zip64  bool
+		edit   func(d *dataDescriptor)
+		reason error
+	}{
+		{name: "CRCが違う", edit: func(d *dataDescriptor) { d.crc32++ }, reason: errCRCMismatch},
+		{name: "圧縮後サイズが違う", edit: func(d *dataDescriptor) { d.compressedSize += 100 }, reason: errSizeMismatch},
+		{name: "展開後サイズが違う", edit: func(d *dataDescriptor) { d.uncompressedSize-- }, reason: errSizeMismatch},
+		{name: "ZIP64形式で圧縮後サイズが違う", zip64: true, edit: func(d *dataDescriptor) { d.compressedSize = 1 }, reason: errSizeMismatch},
+		{name: "ZIP64形式で展開後サイズが違う", zip64: true, edit: func(d *dataDescriptor) { d.uncompressedSize += 1 << 32 }, reason: errSizeMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := descriptorEntry(t, "a.txt", zip.Deflate, data, tt.zip64, tt.edit)
+			result := ScanLocalHeaders(bytes.NewReader(b), int64(len(b)))
+			if len(result.Entries) != 0 {
+				t.Errorf("一致しないエントリを回収しました: %+v", result.Entries[0].FileHeader)
+			}
+			if len(result.Lost) != 1 || result.Lost[0].Name != "a.txt" || result.Lost[0].Reason != tt.reason.Error() {
+				t.Errorf("回収できなかったエントリ = %+v, want a.txt（%v）", result.Lost, tt.reason)
+			}
+		})
+	}
+}
+
+// 無圧縮で格納された入れ子のZIPが壊れている場合も、その中のヘッダを外側のエントリとして回収しない
+func TestScanLocalHeadersNestedZip(t *testing.T) {
+	inner := buildZip(t, []testEntry{
+		{name: "inner/a.txt", data: testText(10 << 10), method: zip.Store},
+		{name: "inner/b.txt", data: testText(5 << 10), method: zip.Deflate},
+	})
+	outer := []testEntry{
+		{name: "first.txt", data: testText(1000)},
+		{name: "lib/inner.zip", data: inner},
+		{name: "last.txt", data: testText(2000)},
+	}
+	// サイズをローカルファイルヘッダに記録する
+	data := buildZipWith(t, func(zw *zip.Writer) {
+		for _, e := range outer {
+			w, err := zw.CreateRaw(&zip.FileHeader{
+				Name:               e.name,
+				Method:             zip.Store,
+				CRC32:              crc32.ChecksumIEEE(e.data),
+				CompressedSize64:   uint64(len(e.data)),
+				UncompressedSize64: uint64(len(e.data)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(e.data)
+		}
+	})
+	innerOff, err := openZip(t, data).File[1].DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		damage   func(b []byte)
+		wantLost bool
+	}{
+		{name: "壊れていない", damage: func(b []byte) {}},
+		// 入れ子のZIPの最初のエントリの内容を壊す
+		{name: "入れ子のZIPの内容が壊れている", damage: func(b []byte) { b[innerOff+200] ^= 0xff }, wantLost: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := append([]byte(nil), data...)
+			tt.damage(b)
+			result := ScanLocalHeaders(bytes.NewReader(b), int64(len(b)))
+
+			var names []string
+			for _, e := range result.Entries {
+				names = append(names, e.Name)
+			}
+			want := []string{"first.txt", "lib/inner.zip", "last.txt"}
+			if tt.wantLost {
+				want = []string{"first.txt", "last.txt"}
+			}
+			if !equalStrings(names, want) {
+				t.Errorf("回収したエントリ = %v, want %v", names, want)
+			}
+			if !tt.wantLost {
+				if len(result.Lost) != 0 {
+					t.Errorf("回収できなかったエントリ = %+v", result.Lost)
+				}
+				return
+			}
+			if len(result.Lost) != 1 || result.Lost[0].Name != "lib/inner.zip" || result.Lost[0].Reason != errCRCMismatch.Error() {
+				t.Errorf("回収できなかったエントリ = %+v, want lib/inner.zip（%v）", result.Lost, errCRCMismatch)
+			}
+		})
+	}
+}
+
+// データ中に偶然現れたシグネチャのうち、ヘッダとして不自然なものは回収できなかったエントリとして記録しない
+func TestScanLocalHeadersFalseSignatures(t *testing.T) {
+	header := func(version, flags, method uint16, name string) []byte {
+		h := make([]byte, localHeaderLen)
+		binary.LittleEndian.PutUint32(h[0:4], LocalHeaderSignature)
+		binary.LittleEndian.PutUint16(h[4:6], version)
+		binary.LittleEndian.PutUint16(h[6:8], flags)
+		binary.LittleEndian.PutUint16(h[8:10], method)
+		binary.LittleEndian.PutUint32(h[18:22], 1000)
+		binary.LittleEndian.PutUint32(h[22:26], 1000)
+		binary.LittleEndian.PutUint16(h[26:28], uint16(len(name)))
+		return append(h, name...)
+	}
+	tests := []struct {
+		name      string
+		candidate []byte
+		wantLost  bool
+	}{
+		{name: "未知の圧縮方式", candidate: header(20, 0, 0x4b50, "a.txt")},
+		{name: "予約されたフラグ", candidate: header(20, 0x4000, zip.Deflate, "a.txt")},
+		{name: "名前に制御文字がある", candidate: header(20, 0, zip.Deflate, "a\x01\x1f")},
+		{name: "対応するバージョンが大きすぎる", candidate: header(99, 0, zip.Deflate, "a.txt")},
+		// ヘッダとして自然なものは、データが途中で切れていれば回収できなかったエントリとして記録する
+		{name: "ヘッダとして自然なもの", candidate: header(20, FlagUTF8, zip.Deflate, "日本語.txt"), wantLost: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := append(append([]byte("無関係なデータ"), tt.candidate...), "後ろに続くデータ"...)
+			result := ScanLocalHeaders(bytes.NewReader(b), int64(len(b)))
+			if len(result.Entries) != 0 {
+				t.Errorf("回収したエントリ = %+v", result.Entries[0].FileHeader)
+			}
+			if tt.wantLost != (len(result.Lost) == 1) || len(result.Lost) > 1 {
+				t.Errorf("回収できなかったエントリ = %+v, want %v", result.Lost, tt.wantLost)
+			}
+		})
+	}
+}
+
+// inflateEntry はDeflateデータの終端までを展開し、後ろに続くデータを圧縮後サイズに含めない
+func TestInflateEntry(t *testing.T) {
+	data := testText(40 << 10)
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	fw.Close()
+	n := compressed.Len()
+	b := append(append([]byte("header"), compressed.Bytes()...), "後ろに続くデータ"...)
+
+	entry := &RecoveredEntry{DataOffset: 6}
+	got, err := inflateEntry(bytes.NewReader(b), entry, int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != int64(n) || entry.CompressedSize64 != uint64(n) {
+		t.Errorf("圧縮後サイズ = %d, %d, want %d", got, entry.CompressedSize64, n)
+	}
+	if entry.UncompressedSize64 != uint64(len(data)) || entry.CRC32 != crc32.ChecksumIEEE(data) {
+		t.Errorf("展開後 CRC %08x サイズ %d", entry.CRC32, entry.UncompressedSize64)
+	}
+
+	// 途中で切れたデータ
+	b = b[:6+n/2]
+	if _, err := inflateEntry(bytes.NewReader(b), &RecoveredEntry{DataOffset: 6}, int64(len(b))); err != errTruncated {
+		t.Errorf("途中で切れたデータ: err = %v, want %v", err, errTruncated)
+	}
+}
+
+// descriptorEntry はサイズとCRCをデータディスクリプタに記録するエントリ（ローカルファイルヘッダ・データ・データディスクリプタ）を組み立てます
+// zip64がtrueの場合はZIP64拡張情報を付けてZIP64形式のデータディスクリプタを書き込み、edit でその内容を書き換えられます
+func descriptorEntry(t *testing.T, name string, method uint16, data []byte, zip64 bool, edit func(d *dataDescriptor)) []byte {
+	t.Helper()
+	compressed := data
+	if method == zip.Deflate {
+		var buf bytes.Buffer
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+		fw.Close()
+		compressed = buf.Bytes()
+	}
+
+	// サイズが不明なため、ZIP64拡張情報のサイズは0にする
+	var extra []byte
+	if zip64 {
+		extra = make([]byte, 4+16)
+		binary.LittleEndian.PutUint16(extra[0:2], Zip64ExtraID)
+		binary.LittleEndian.PutUint16(extra[2:4], 16)
+	}
+	header := make([]byte, localHeaderLen)
+	binary.LittleEndian.PutUint32(header[0:4], LocalHeaderSignature)
+	binary.LittleEndian.PutUint16(header[4:6], 45)
+	binary.LittleEndian.PutUint16(header[6:8], FlagDataDescriptor)
+	binary.LittleEndian.PutUint16(header[8:10], method)
+	binary.LittleEndian.PutUint16(header[26:28], uint16(len(name)))
+	binary.LittleEndian.PutUint16(header[28:30], uint16(len(extra)))
+
+	d := dataDescriptor{
+		crc32:            crc32.ChecksumIEEE(data),
+		compressedSize:   uint64(len(compressed)),
+		uncompressedSize: uint64(len(data)),
+	}
+	if edit != nil {
+		edit(&d)
+	}
+	desc := binary.LittleEndian.AppendUint32(nil, DataDescriptorSignature)
+	desc = binary.LittleEndian.AppendUint32(desc, d.crc32)
+	if zip64 {
+		desc = binary.LittleEndian.AppendUint64(desc, d.compressedSize)
+		desc = binary.LittleEndian.AppendUint64(desc, d.uncompressedSize)
+	} else {
+		desc = binary.LittleEndian.AppendUint32(desc, uint32(d.compressedSize))
+		desc = binary.LittleEndian.AppendUint32(desc, uint32(d.uncompressedSize))
+	}
+
+	var buf bytes.Buffer
+	buf.Write(header)
+	buf.WriteString(name)
+	buf.Write(extra)
+	buf.Write(compressed)
+	buf.Write(desc)
+	return buf.Bytes()
+}
@@ -0,0 +1,165 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+
+	"zip-editor/internal/common"
+)
+
+// RewriteOptions は RewriteArchive での先頭に付加されたデータとコメントの扱いです
+type RewriteOptions struct {
+	// Stub がnilでない場合は、元の先頭に付加されたデータの代わりに Stub の内容を書き込みます
+	// StripStub がtrueの場合は、先頭に付加されたデータを書き込みません
+	Stub      io.Reader
+	StripStub bool
+	// Comment がnilでない場合は、アーカイブ全体のコメントを *Comment にします（nilの場合は元のコメントを引き継ぐ）
+	Comment *string
+}
+
+// RewriteArchive は reader のZIPファイルを書き直した内容を w に書き込み、先頭に付加したデータの長さを返します
+// 先頭に付加されたデータ（自己解凍スタブなど）は、opts で置き換え・削除が指定されていなければ引き継ぎ、エントリの位置の記録値をその分ずらします
+// 付加されたデータを調べられない場合と、APK署名ブロックは引き継ぎません（エントリを書き直すと無効になるため）
+// エントリは write で書き込みます（CopyRaw などで圧縮データをそのままコピーします）
+func RewriteArchive(w io.Writer, reader *ReadCloser, opts RewriteOptions, write func(zw *zip.Writer) error) (int64, error) {
+	stubSize, err := writeRewriteStub(w, reader, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	zw := zip.NewWriter(w)
+	zw.SetOffset(stubSize)
+	comment := reader.Comment
+	if opts.Comment != nil {
+		comment = *opts.Comment
+	}
+	if err := zw.SetComment(comment); err != nil {
+		return 0, err
+	}
+	if err := write(zw); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	return stubSize, nil
+}
+
+// RewriteFileOptions は RewriteFile での先頭に付加されたデータ・コメント・ボリュームの分割の扱いです
+type RewriteFileOptions struct {
+	RewriteOptions
+	// StubPath が空でなく StripStub がfalseの場合は、先頭に付加されたデータをこのファイルの内容で置き換えます
+	StubPath string
+	// VolumeSize が正の場合、そのサイズのボリューム（.z01, .z02 …, .zip）に分割して保存します
+	// 0の場合は元の構成を維持し（分割アーカイブは最初のボリュームと同じサイズで分割し直す）、
+	// 負の場合は分割アーカイブもひとつのファイルにまとめて保存します
+	VolumeSize int64
+}
+
+// RewriteFile は zipPath のZIPファイルを RewriteArchive で書き直し、成功した場合に元のファイルを置き換えます
+// write には元のZIPファイルのリーダーと新しいZIPファイルのライターが渡され、エントリを書き込みます
+// 同じディレクトリの一時ファイルに書き込んでから名前を変更するため、失敗した場合は元のファイルを変更しません（パーミッションは引き継ぐ）
+func RewriteFile(zipPath string, opts RewriteFileOptions, write func(zw *zip.Writer, reader *ReadCloser) error) error {
+	reader, err := OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if opts.StubPath != "" && !opts.StripStub {
+		stub, err := os.Open(opts.StubPath)
+		if err != nil {
+			return err
+		}
+		defer stub.Close()
+		opts.Stub = stub
+	}
+
+	// 分割アーカイブは元と同じボリュームのサイズで分割し直す
+	volumes := reader.Volumes
+	volumeSize := opts.VolumeSize
+	if volumeSize == 0 && volumes != nil {
+		if fi, err := os.Stat(volumes[0]); err == nil {
+			volumeSize = fi.Size()
+		}
+	}
+	if volumeSize > 0 && HasRewriteStub(reader, opts.RewriteOptions) {
+		return errors.New("先頭にデータが付加されたアーカイブは分割して保存できません（先頭のデータを取り除いてから分割してください）")
+	}
+
+	rewrite := func(f *os.File) error {
+		_, err := RewriteArchive(f, reader, opts.RewriteOptions, func(zw *zip.Writer) error {
+			return write(zw, reader)
+		})
+		if err != nil {
+			return err
+		}
+		// Windowsでは開いているファイルを置き換えられないため、元のファイルを閉じておく
+		return reader.Close()
+	}
+
+	if volumeSize <= 0 {
+		err := common.ReplaceFile(zipPath, func(f *os.File) error {
+			if err := rewrite(f); err != nil {
+				return err
+			}
+			return f.Sync()
+		})
+		if err != nil {
+			return err
+		}
+		// 分割アーカイブをひとつにまとめた場合は、不要になったボリュームを削除する
+		if volumes != nil {
+			RemoveVolumes(zipPath, 0)
+		}
+		return nil
+	}
+
+	// 分割する場合は、ひとつのZIPファイルとして一時ファイルに書き込んでからボリュームに分ける
+	tmp, err := os.CreateTemp("", "zip-editor-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if err := rewrite(tmp); err != nil {
+		return err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = WriteSplit(tmp, size, zipPath, max(volumeSize, MinVolumeSize))
+	return err
+}
+
+// HasRewriteStub は RewriteArchive で書き直した場合に、先頭にデータが付加されるかどうかを返します
+func HasRewriteStub(reader *ReadCloser, opts RewriteOptions) bool {
+	switch {
+	case opts.StripStub:
+		return false
+	case opts.Stub != nil:
+		return true
+	}
+	prefix, err := reader.Prefix()
+	return err == nil && prefix.Size > 0
+}
+
+// writeRewriteStub は新しいZIPファイルの先頭に付加するデータを書き込み、その長さを返します
+func writeRewriteStub(w io.Writer, reader *ReadCloser, opts RewriteOptions) (int64, error) {
+	switch {
+	case opts.StripStub:
+		return 0, nil
+	case opts.Stub != nil:
+		return io.Copy(w, opts.Stub)
+	}
+
+	prefix, err := reader.Prefix()
+	if err != nil || prefix.Size == 0 {
+		// 付加されたデータを調べられない場合は、通常のZIPファイルとして書き直す
+		return 0, nil
+	}
+	return reader.CopyPrefix(w, prefix)
+}
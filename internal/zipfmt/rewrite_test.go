@@ -0,0 +1,179 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// RewriteFile は先頭に付加されたデータとコメントを引き継ぎ、元のファイルのパーミッションのまま置き換える
+func TestRewriteFile(t *testing.T) {
+	dir := t.TempDir()
+	stub := []byte("#!/bin/sh\nexec unzip \"$0\"\n")
+	var buf bytes.Buffer
+	buf.Write(stub)
+	zw := zip.NewWriter(&buf)
+	zw.SetOffset(int64(len(stub)))
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(name))
+	}
+	zw.SetComment("アーカイブのコメント")
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := writeTestFile(t, dir, "sfx.zip", buf.Bytes())
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := RewriteFile(path, RewriteFileOptions{}, func(zw *zip.Writer, reader *ReadCloser) error {
+		for _, f := range reader.File {
+			if f.Name == "b.txt" {
+				continue
+			}
+			if err := CopyRaw(zw, f, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, stub) {
+		t.Error("先頭に付加されたデータが引き継がれていません")
+	}
+	r := openZip(t, data)
+	if len(r.File) != 2 || r.File[0].Name != "a.txt" || r.File[1].Name != "c.txt" {
+		t.Errorf("エントリ = %v", fileNames(r.File))
+	}
+	for _, f := range r.File {
+		if got, err := readAll(f.Open()); err != nil || string(got) != f.Name {
+			t.Errorf("%s = %q, %v", f.Name, got, err)
+		}
+	}
+	if r.Comment != "アーカイブのコメント" {
+		t.Errorf("コメント = %q", r.Comment)
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Mode().Perm() != 0o600 && runtime.GOOS != "windows" {
+		t.Errorf("パーミッション = %v, want 0600", fi.Mode().Perm())
+	}
+}
+
+// 分割アーカイブは元と同じボリュームのサイズで分割し直し、負のサイズを指定した場合はひとつにまとめる
+func TestRewriteFileSplit(t *testing.T) {
+	dir := t.TempDir()
+	data := buildZip(t, []testEntry{
+		{name: "a.bin", data: testText(150 << 10)},
+		{name: "b.bin", data: testText(100 << 10)},
+	})
+	src := writeTestFile(t, dir, "src.zip", data)
+	splitPath := filepath.Join(dir, "split.zip")
+	volumes := writeSplitFile(t, src, splitPath, MinVolumeSize)
+
+	copyAll := func(zw *zip.Writer, reader *ReadCloser) error {
+		for _, f := range reader.File {
+			if err := CopyRaw(zw, f, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := RewriteFile(splitPath, RewriteFileOptions{}, copyAll); err != nil {
+		t.Fatal(err)
+	}
+	got, err := SplitVolumes(splitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(volumes) {
+		t.Errorf("ボリューム数 = %d, want %d", len(got), len(volumes))
+	}
+	compareArchives(t, src, splitPath)
+
+	if err := RewriteFile(splitPath, RewriteFileOptions{VolumeSize: -1}, copyAll); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := SplitVolumes(splitPath); err != nil || got != nil {
+		t.Errorf("ひとつにまとめた後の SplitVolumes = %v, %v", got, err)
+	}
+	if _, err := os.Stat(VolumePath(splitPath, 0, -1)); !os.IsNotExist(err) {
+		t.Error("不要になったボリュームが残っています")
+	}
+	compareArchives(t, src, splitPath)
+}
+
+// 書き込みに失敗した場合と、先頭にデータが付加されたアーカイブを分割しようとした場合は、元のファイルを変更しない
+func TestRewriteFileKeepsOriginalOnError(t *testing.T) {
+	dir := t.TempDir()
+	stub := []byte("MZ stub")
+	data := append(append([]byte(nil), stub...), buildZip(t, []testEntry{{name: "a.txt", data: []byte("a")}})...)
+	path := writeTestFile(t, dir, "a.zip", data)
+
+	errWrite := errors.New("書き込みの失敗")
+	err := RewriteFile(path, RewriteFileOptions{}, func(zw *zip.Writer, reader *ReadCloser) error {
+		return errWrite
+	})
+	if !errors.Is(err, errWrite) {
+		t.Errorf("err = %v, want %v", err, errWrite)
+	}
+	err = RewriteFile(path, RewriteFileOptions{VolumeSize: MinVolumeSize}, func(zw *zip.Writer, reader *ReadCloser) error {
+		return nil
+	})
+	if err == nil {
+		t.Error("先頭にデータが付加されたアーカイブを分割できてしまいました")
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("失敗したのに元のファイルが変更されています")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("一時ファイルが残っています: %v", entries)
+	}
+}
+
+// writeSplitFile は src のZIPファイルを volumeSize ごとのボリュームに分割して dst に書き込みます
+func writeSplitFile(t *testing.T, src, dst string, volumeSize int64) []string {
+	t.Helper()
+	f, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumes, err := WriteSplit(f, fi.Size(), dst, volumeSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return volumes
+}
+
+// fileNames はエントリの名前の一覧を返します
+func fileNames(files []*zip.File) []string {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.Name
+	}
+	return names
+}
@@ -0,0 +1,49 @@
+package zipfmt
+
+import "bytes"
+
+// SniffLen は IsCompressedData の判定に必要な先頭のバイト数です
+const SniffLen = 16
+
+// 圧縮済みの形式を示す先頭のバイト列（マジックナンバー）
+var compressedSignatures = []struct {
+	offset int
+	magic  []byte
+}{
+	{0, []byte{0xFF, 0xD8, 0xFF}},                           // JPEG
+	{0, []byte("\x89PNG\r\n\x1a\n")},                        // PNG
+	{0, []byte("GIF8")},                                     // GIF
+	{8, []byte("WEBP")},                                     // WebP（RIFFコンテナ）
+	{4, []byte("ftyp")},                                     // MP4・MOV・HEIC・M4A
+	{0, []byte{0x1A, 0x45, 0xDF, 0xA3}},                     // Matroska・WebM
+	{0, []byte("OggS")},                                     // Ogg
+	{0, []byte("fLaC")},                                     // FLAC
+	{0, []byte("ID3")},                                      // MP3（ID3タグ付き）
+	{0, []byte("PK\x03\x04")},                               // ZIP（docx・jar・apk などを含む）
+	{0, []byte{0x1F, 0x8B}},                                 // gzip
+	{0, []byte("BZh")},                                      // bzip2
+	{0, []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}},             // XZ
+	{0, []byte{0x28, 0xB5, 0x2F, 0xFD}},                     // Zstandard
+	{0, []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}},           // 7z
+	{0, []byte("Rar!\x1a\x07")},                             // RAR
+	{0, []byte("wOFF")},                                     // WOFF
+	{0, []byte("wOF2")},                                     // WOFF2
+	{0, []byte{0x00, 0x00, 0x00, 0x0C, 'j', 'P', ' ', ' '}}, // JPEG 2000
+}
+
+// IsCompressedData はデータの先頭から、すでに圧縮された形式（画像・動画・アーカイブなど）かどうかを判定します
+// このような形式は再圧縮してもほとんど小さくならないため、圧縮の対象から外す判断に使用します
+func IsCompressedData(head []byte) bool {
+	for _, sig := range compressedSignatures {
+		end := sig.offset + len(sig.magic)
+		if len(head) >= end && bytes.Equal(head[sig.offset:end], sig.magic) {
+			return true
+		}
+	}
+	// MP3（フレーム同期ビットとレイヤーIII）
+	// UTF-16のBOM（FF FE）と区別するため、レイヤーまで確認する
+	if len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0 && head[1]&0x06 == 0x02 {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,699 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"zip-editor/internal/common"
+)
+
+// 分割アーカイブの最初のボリュームの先頭に置かれるシグネチャ
+const (
+	SplitSignature = 0x08074b50 // 分割アーカイブ（データ記述子と同じ値）
+	spannedMarker  = 0x30304b50 // 分割する予定だったが1つのボリュームに収まったもの（"PK00"）
+)
+
+// MinVolumeSize は分割アーカイブのボリュームの最小サイズです
+// ローカルファイルヘッダや中央ディレクトリヘッダは、ボリュームをまたがないように書き込みます
+const MinVolumeSize = 64 << 10
+
+// VolumePath は分割アーカイブの disk 番目（0から）のボリュームのパスを返します
+// 最後のボリューム（lastDisk）は zipPath 自身で、それ以外は拡張子を .z01, .z02 … にしたものです
+func VolumePath(zipPath string, disk, lastDisk int) string {
+	if disk == lastDisk {
+		return zipPath
+	}
+	return strings.TrimSuffix(zipPath, filepath.Ext(zipPath)) + fmt.Sprintf(".z%02d", disk+1)
+}
+
+// SplitVolumes は zipPath が分割アーカイブの最後のボリューム（.zip）の場合、
+// 最初のボリュームから順にすべてのボリュームのパスを返します
+// 分割アーカイブでない場合や、終端レコードが見つからない場合はnilを返します
+func SplitVolumes(zipPath string) ([]string, error) {
+	f, err := os.Open(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	dir, _, err := readEndRecords(f, fi.Size())
+	if err != nil || dir.Disk == 0 {
+		return nil, nil
+	}
+
+	last := int(dir.Disk)
+	volumes := make([]string, last+1)
+	for i := range volumes {
+		volumes[i] = VolumePath(zipPath, i, last)
+		if _, err := os.Stat(volumes[i]); err != nil {
+			return nil, fmt.Errorf("分割アーカイブのボリューム %s が見つかりません", filepath.Base(volumes[i]))
+		}
+	}
+	return volumes, nil
+}
+
+// SplitReader は分割アーカイブのボリュームを、ひとつの論理的なZIPファイルとして読み取るリーダーです
+// 各ボリュームを先頭のシグネチャを除いて連結し、中央ディレクトリは連結後の位置に合わせて書き直したものを返します
+type SplitReader struct {
+	files    []*os.File
+	segments []volumeSegment
+	tail     []byte // 書き直した中央ディレクトリと終端レコード
+	tailOff  int64  // 論理ファイル上の tail の位置
+}
+
+// volumeSegment は論理ファイル上のボリュームの範囲です
+type volumeSegment struct {
+	f          *os.File
+	fileOff    int64 // ボリューム内の開始位置（最初のボリュームのシグネチャを除く）
+	logicalOff int64 // 論理ファイル上の開始位置
+	size       int64
+}
+
+// OpenSplit は分割アーカイブのボリュームを開きます
+// volumes は最初のボリュームから順に並べたパスで、最後が終端レコードを含むボリュームです
+func OpenSplit(volumes []string) (_ *SplitReader, err error) {
+	sr := &SplitReader{}
+	// 途中で失敗した場合は、それまでに開いたボリュームを閉じる
+	defer func() {
+		if err != nil {
+			sr.Close()
+		}
+	}()
+
+	// 各ボリュームのディスク上の位置0が、論理ファイル上のどこに当たるか
+	diskBase := make([]int64, len(volumes))
+	var logical int64
+	for i, name := range volumes {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		sr.files = append(sr.files, f)
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		seg := volumeSegment{f: f, logicalOff: logical, size: fi.Size()}
+		if i == 0 {
+			var sig [4]byte
+			if _, err := f.ReadAt(sig[:], 0); err == nil {
+				if s := binary.LittleEndian.Uint32(sig[:]); s == SplitSignature || s == spannedMarker {
+					seg.fileOff = 4
+					seg.size -= 4
+				}
+			}
+		}
+		diskBase[i] = logical - seg.fileOff
+		sr.segments = append(sr.segments, seg)
+		logical += seg.size
+	}
+
+	lastSeg := sr.segments[len(sr.segments)-1]
+	dir, records, err := readEndRecords(lastSeg.f, lastSeg.fileOff+lastSeg.size)
+	if err != nil {
+		return nil, err
+	}
+	if int(dir.Disk) != len(volumes)-1 || int(dir.StartDisk) >= len(volumes) {
+		return nil, fmt.Errorf("分割アーカイブのボリューム数が一致しません（%d個のうち%d個目が最後として記録されています）", len(volumes), dir.Disk+1)
+	}
+
+	// 中央ディレクトリは複数のボリュームにまたがる場合があるため、連結したボリュームから読み取る
+	cdStart := diskBase[dir.StartDisk] + dir.Offset
+	if err := readCentral(sr.segmentReader(), dir, cdStart, records); err != nil {
+		return nil, err
+	}
+	for _, e := range dir.Entries {
+		if int(e.Disk) >= len(volumes) {
+			return nil, errBadCentralHeader
+		}
+		e.HeaderOffset += diskBase[e.Disk]
+		e.Disk = 0
+	}
+
+	sr.tailOff = cdStart
+	sr.tail = appendDirectory(nil, dir.Entries, cdStart, dir.Comment, dir.Zip64)
+	return sr, nil
+}
+
+// Size は論理ファイルのサイズを返します
+func (sr *SplitReader) Size() int64 {
+	return sr.tailOff + int64(len(sr.tail))
+}
+
+// ReadAt は論理ファイルの off の位置から読み取ります
+func (sr *SplitReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	if off < sr.tailOff {
+		end := min(off+int64(len(p)), sr.tailOff)
+		m, err := sr.segmentReader().ReadAt(p[:end-off], off)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		off += int64(m)
+	}
+	if n == len(p) {
+		return n, nil
+	}
+	if off-sr.tailOff >= int64(len(sr.tail)) {
+		return n, io.EOF
+	}
+	m := copy(p[n:], sr.tail[off-sr.tailOff:])
+	n += m
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Close はすべてのボリュームを閉じます
+func (sr *SplitReader) Close() error {
+	var firstErr error
+	for _, f := range sr.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// segmentReader はボリュームを連結しただけの（中央ディレクトリを書き直していない）リーダーを返します
+func (sr *SplitReader) segmentReader() io.ReaderAt {
+	return segmentsReaderAt(sr.segments)
+}
+
+// segmentsReaderAt はボリュームの範囲を順に連結して読み取ります
+type segmentsReaderAt []volumeSegment
+
+func (s segmentsReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for _, seg := range s {
+		if n == len(p) {
+			break
+		}
+		if off >= seg.logicalOff+seg.size {
+			continue
+		}
+		rel := off - seg.logicalOff
+		want := min(int64(len(p)-n), seg.size-rel)
+		m, err := seg.f.ReadAt(p[n:n+int(want)], seg.fileOff+rel)
+		n += m
+		off += int64(m)
+		if err != nil && !(errors.Is(err, io.EOF) && int64(m) == want) {
+			return n, err
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// ReadCloser は分割アーカイブにも対応した、使い終わったら閉じる必要があるZIPのリーダーです
+type ReadCloser struct {
+	*zip.Reader
+	// Volumes は分割アーカイブの場合のボリュームのパスです（分割されていない場合はnil）
+	Volumes []string
+	ra      io.ReaderAt // 論理的なZIPファイル全体
+	size    int64
+	closer  io.Closer
+}
+
+// OpenReader はZIPファイルを開きます
+// 分割アーカイブの最後のボリューム（.zip）を指定した場合は、すべてのボリュームをひとつのZIPファイルとして開きます
+// エラーを返す場合、リーダーはnilで、開いたファイルはすべて閉じています
+func OpenReader(name string) (*ReadCloser, error) {
+	volumes, err := SplitVolumes(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var ra io.ReaderAt
+	var size int64
+	var closer io.Closer
+	if volumes == nil {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		ra, size, closer = f, fi.Size(), f
+	} else {
+		sr, err := OpenSplit(volumes)
+		if err != nil {
+			return nil, err
+		}
+		ra, size, closer = sr, sr.Size(), sr
+	}
+
+	// zip.ErrInsecurePath（GODEBUG=zipinsecurepath=0 の場合）もほかのエラーと同じく、ファイルを閉じて返す
+	reader, err := zip.NewReader(ra, size)
+	if err != nil {
+		closer.Close()
+		return nil, err
+	}
+	return &ReadCloser{Reader: reader, Volumes: volumes, ra: ra, size: size, closer: closer}, nil
+}
+
+// Close はZIPファイル（分割アーカイブの場合はすべてのボリューム）を閉じます
+func (rc *ReadCloser) Close() error {
+	return rc.closer.Close()
+}
+
+// JoinSplit は分割アーカイブをひとつのZIPファイルに結合して dstPath に書き込みます
+func JoinSplit(volumes []string, dstPath string) error {
+	sr, err := OpenSplit(volumes)
+	if err != nil {
+		return err
+	}
+	defer sr.Close()
+
+	out, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, io.NewSectionReader(sr, 0, sr.Size())); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// WriteSplit はひとつのZIPファイル（r）を volumeSize ごとのボリュームに分割し、dstZipPath を最後のボリュームとして書き込みます
+// ボリュームは .z01, .z02 …, .zip の順で、以前の分割で作られた余分なボリュームは削除します
+// 全体が volumeSize に収まる場合は分割せずに書き込みます。書き込んだボリュームのパスを返します
+func WriteSplit(r io.ReaderAt, size int64, dstZipPath string, volumeSize int64) (volumes []string, err error) {
+	if volumeSize < MinVolumeSize {
+		return nil, fmt.Errorf("ボリュームのサイズは %dKB 以上を指定してください", MinVolumeSize>>10)
+	}
+	dir, err := ReadDirectory(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if dir.Disk != 0 {
+		return nil, errors.New("分割アーカイブをさらに分割することはできません")
+	}
+
+	if size <= volumeSize {
+		if err := writeSingle(r, size, dstZipPath); err != nil {
+			return nil, err
+		}
+		RemoveVolumes(dstZipPath, 0)
+		return []string{dstZipPath}, nil
+	}
+
+	w := &volumeWriter{dst: dstZipPath, volumeSize: volumeSize}
+	defer func() {
+		if err != nil {
+			w.abort()
+		}
+	}()
+	if err := w.writeSplitSignature(); err != nil {
+		return nil, err
+	}
+
+	// ローカルファイルヘッダとデータを、記録されている位置の順に書き込む
+	// 先頭に付加されたデータ（自己解凍スタブなど）は分割アーカイブには含めない
+	entries := append([]*DirEntry(nil), dir.Entries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].HeaderOffset < entries[j].HeaderOffset })
+	for i, e := range entries {
+		end := dir.Offset
+		if i+1 < len(entries) {
+			end = entries[i+1].HeaderOffset
+		}
+		if err := w.copyEntry(r, dir.BaseOffset, e, end); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name, err)
+		}
+	}
+
+	// 中央ディレクトリはヘッダ単位でボリュームをまたがないように書き込む
+	var cdDisk uint32
+	var cdOffset, cdSize int64
+	var diskEntries uint64 // 現在のボリュームに書き込んだ中央ディレクトリヘッダの数
+	for i, e := range dir.Entries {
+		header := appendCentralHeader(nil, e)
+		prevDisk := w.disk()
+		if err := w.reserve(int64(len(header))); err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			cdDisk, cdOffset = w.disk(), w.pos
+		}
+		if i == 0 || w.disk() != prevDisk {
+			diskEntries = 0
+		}
+		diskEntries++
+		if _, err := w.Write(header); err != nil {
+			return nil, err
+		}
+		cdSize += int64(len(header))
+	}
+
+	// 終端レコード（ZIP64の場合はロケーターを含む）は最後のボリュームにまとめて書き込む
+	zip64 := dir.Zip64 || len(dir.Entries) >= uint16max || cdSize >= uint32max
+	endSize := int64(endLen + len(dir.Comment))
+	if zip64 {
+		endSize += end64Len + end64LocLen
+	}
+	startDisk := w.disk()
+	if err := w.reserve(endSize); err != nil {
+		return nil, err
+	}
+	if w.disk() != startDisk {
+		diskEntries = 0
+	}
+	end := endRecord{
+		disk:        w.disk(),
+		startDisk:   cdDisk,
+		diskEntries: diskEntries,
+		entries:     uint64(len(dir.Entries)),
+		cdSize:      cdSize,
+		cdOffset:    cdOffset,
+		end64Offset: w.pos,
+		totalDisks:  w.disk() + 1,
+		comment:     dir.Comment,
+		zip64:       zip64,
+	}
+	if len(dir.Entries) == 0 {
+		end.startDisk, end.cdOffset = w.disk(), w.pos
+	}
+	if _, err := w.Write(appendEndRecords(nil, end)); err != nil {
+		return nil, err
+	}
+	return w.finish()
+}
+
+// writeSingle はZIPファイルを分割せずにそのまま書き込みます
+func writeSingle(r io.ReaderAt, size int64, dstPath string) error {
+	out, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, io.NewSectionReader(r, 0, size)); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// RemoveVolumes は分割アーカイブの from 番目（0から）以降のボリューム（.z01 など）のうち、存在するものを削除します
+// ボリュームは連番のため、最初に見つからなかったところで終了します
+func RemoveVolumes(zipPath string, from int) {
+	for disk := from; ; disk++ {
+		path := VolumePath(zipPath, disk, -1)
+		if _, err := os.Stat(path); err != nil {
+			return
+		}
+		os.Remove(path)
+	}
+}
+
+// volumeWriter はボリュームの境界で次のファイルに切り替えながら書き込みます
+// ボリュームは一時ファイルに書き込み、すべて書き終えてから最終的な名前に変更します
+type volumeWriter struct {
+	dst        string
+	volumeSize int64
+	files      []*os.File
+	pos        int64 // 現在のボリューム内の位置
+}
+
+// disk は現在のボリュームの番号（0から）を返します
+func (w *volumeWriter) disk() uint32 {
+	return uint32(len(w.files) - 1)
+}
+
+// next は新しいボリュームを作成します
+func (w *volumeWriter) next() error {
+	f, err := os.CreateTemp(filepath.Dir(w.dst), filepath.Base(w.dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	w.files = append(w.files, f)
+	w.pos = 0
+	return nil
+}
+
+// writeSplitSignature は最初のボリュームを作成し、分割アーカイブのシグネチャを書き込みます
+func (w *volumeWriter) writeSplitSignature() error {
+	if err := w.next(); err != nil {
+		return err
+	}
+	_, err := w.Write(binary.LittleEndian.AppendUint32(nil, SplitSignature))
+	return err
+}
+
+// reserve は n バイトを現在のボリュームに収められない場合に、次のボリュームに切り替えます
+func (w *volumeWriter) reserve(n int64) error {
+	if n > w.volumeSize {
+		return errors.New("ヘッダがボリュームのサイズに収まりません")
+	}
+	if w.pos+n > w.volumeSize {
+		return w.next()
+	}
+	return nil
+}
+
+// Write はボリュームの境界をまたいで書き込みます
+func (w *volumeWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if w.pos == w.volumeSize {
+			if err := w.next(); err != nil {
+				return n, err
+			}
+		}
+		chunk := min(int64(len(p)), w.volumeSize-w.pos)
+		m, err := w.files[len(w.files)-1].Write(p[:chunk])
+		n += m
+		w.pos += int64(m)
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// copyEntry はローカルファイルヘッダを現在のボリュームに収めて書き込み、続くデータ（データ記述子を含む）をコピーします
+// エントリの書き込み先のボリュームと位置は e に記録します
+func (w *volumeWriter) copyEntry(r io.ReaderAt, base int64, e *DirEntry, end int64) error {
+	var lh [localHeaderLen]byte
+	if _, err := r.ReadAt(lh[:], base+e.HeaderOffset); err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(lh[:]) != LocalHeaderSignature {
+		return errors.New("ローカルファイルヘッダが見つかりません")
+	}
+	headerLen := int64(localHeaderLen) + int64(binary.LittleEndian.Uint16(lh[26:28])) + int64(binary.LittleEndian.Uint16(lh[28:30]))
+	if err := w.reserve(headerLen); err != nil {
+		return err
+	}
+
+	src := io.NewSectionReader(r, base+e.HeaderOffset, end-e.HeaderOffset)
+	e.Disk, e.HeaderOffset = w.disk(), w.pos
+	_, err := io.Copy(w, src)
+	return err
+}
+
+// finish はボリュームを閉じて最終的な名前に変更し、以前の分割で作られた余分なボリュームを削除します
+// 一時ファイルは所有者だけが読み書きできるパーミッションで作成されるため、置き換える前のボリュームのパーミッションを設定します
+// （以前はなかったボリュームは最後のボリューム（.zip）と同じ、新しく分割する場合は 0644）
+func (w *volumeWriter) finish() ([]string, error) {
+	mode, err := common.ReplaceMode(w.dst)
+	if err != nil {
+		w.abort()
+		return nil, err
+	}
+	last := len(w.files) - 1
+	volumes := make([]string, len(w.files))
+	for i, f := range w.files {
+		volumes[i] = VolumePath(w.dst, i, last)
+		perm := mode
+		if fi, err := os.Stat(volumes[i]); err == nil {
+			perm = fi.Mode().Perm()
+		}
+		if err := f.Chmod(perm); err != nil {
+			w.abort()
+			return nil, err
+		}
+		if err := f.Close(); err != nil {
+			w.abort()
+			return nil, err
+		}
+	}
+	for i, f := range w.files {
+		os.Remove(volumes[i])
+		if err := os.Rename(f.Name(), volumes[i]); err != nil {
+			w.abort()
+			return nil, err
+		}
+	}
+	RemoveVolumes(w.dst, last)
+	return volumes, nil
+}
+
+// abort は書き込み途中の一時ファイルを削除します
+func (w *volumeWriter) abort() {
+	for _, f := range w.files {
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
+
+// appendCentralHeader は中央ディレクトリヘッダを1件組み立てます
+// 32ビット（ディスク番号は16ビット）に収まらない値は、ZIP64拡張情報に記録します
+func appendCentralHeader(b []byte, e *DirEntry) []byte {
+	var zip64 []byte
+	usize, csize, offset, disk := uint32(e.UncompressedSize64), uint32(e.CompressedSize64), uint32(e.HeaderOffset), uint16(e.Disk)
+	if e.UncompressedSize64 >= uint32max {
+		zip64 = binary.LittleEndian.AppendUint64(zip64, e.UncompressedSize64)
+		usize = uint32max
+	}
+	if e.CompressedSize64 >= uint32max {
+		zip64 = binary.LittleEndian.AppendUint64(zip64, e.CompressedSize64)
+		csize = uint32max
+	}
+	if e.HeaderOffset >= uint32max {
+		zip64 = binary.LittleEndian.AppendUint64(zip64, uint64(e.HeaderOffset))
+		offset = uint32max
+	}
+	if e.Disk >= uint16max {
+		zip64 = binary.LittleEndian.AppendUint32(zip64, e.Disk)
+		disk = uint16max
+	}
+	extra := RemoveExtra(e.Extra, Zip64ExtraID)
+	if zip64 != nil {
+		extra = append(BuildExtra([]ExtraField{{ID: Zip64ExtraID, Data: zip64}}), extra...)
+	}
+
+	le := binary.LittleEndian
+	b = le.AppendUint32(b, CentralHeaderSignature)
+	b = le.AppendUint16(b, e.CreatorVersion)
+	b = le.AppendUint16(b, e.ReaderVersion)
+	b = le.AppendUint16(b, e.Flags)
+	b = le.AppendUint16(b, e.Method)
+	b = le.AppendUint16(b, e.ModifiedTime)
+	b = le.AppendUint16(b, e.ModifiedDate)
+	b = le.AppendUint32(b, e.CRC32)
+	b = le.AppendUint32(b, csize)
+	b = le.AppendUint32(b, usize)
+	b = le.AppendUint16(b, uint16(len(e.Name)))
+	b = le.AppendUint16(b, uint16(len(extra)))
+	b = le.AppendUint16(b, uint16(len(e.Comment)))
+	b = le.AppendUint16(b, disk)
+	b = le.AppendUint16(b, e.InternalAttrs)
+	b = le.AppendUint32(b, e.ExternalAttrs)
+	b = le.AppendUint32(b, offset)
+	b = append(b, e.Name...)
+	b = append(b, extra...)
+	b = append(b, e.Comment...)
+	return b
+}
+
+// endRecord は書き込む終端レコードの内容です
+type endRecord struct {
+	disk        uint32 // 終端レコードがあるディスク番号
+	startDisk   uint32 // 中央ディレクトリが始まるディスク番号
+	diskEntries uint64 // このディスクにある中央ディレクトリのエントリ数
+	entries     uint64 // 中央ディレクトリの全エントリ数
+	cdSize      int64
+	cdOffset    int64 // 中央ディレクトリの開始位置（startDisk 内の位置）
+	end64Offset int64 // ZIP64終端レコードの位置（disk 内の位置）
+	totalDisks  uint32
+	comment     []byte
+	zip64       bool
+}
+
+// appendEndRecords は終端レコード（ZIP64の場合はZIP64終端レコードとロケーターを含む）を組み立てます
+func appendEndRecords(b []byte, r endRecord) []byte {
+	le := binary.LittleEndian
+	if r.zip64 || r.entries >= uint16max || r.cdSize >= uint32max || r.cdOffset >= uint32max {
+		b = le.AppendUint32(b, End64Signature)
+		b = le.AppendUint64(b, end64Len-12) // このフィールドより後ろの長さ
+		b = le.AppendUint16(b, 45)
+		b = le.AppendUint16(b, 45)
+		b = le.AppendUint32(b, r.disk)
+		b = le.AppendUint32(b, r.startDisk)
+		b = le.AppendUint64(b, r.diskEntries)
+		b = le.AppendUint64(b, r.entries)
+		b = le.AppendUint64(b, uint64(r.cdSize))
+		b = le.AppendUint64(b, uint64(r.cdOffset))
+
+		b = le.AppendUint32(b, End64LocatorSignature)
+		b = le.AppendUint32(b, r.disk)
+		b = le.AppendUint64(b, uint64(r.end64Offset))
+		b = le.AppendUint32(b, r.totalDisks)
+	}
+
+	b = le.AppendUint32(b, EndSignature)
+	b = le.AppendUint16(b, uint16(min(r.disk, uint16max)))
+	b = le.AppendUint16(b, uint16(min(r.startDisk, uint16max)))
+	b = le.AppendUint16(b, uint16(min(r.diskEntries, uint16max)))
+	b = le.AppendUint16(b, uint16(min(r.entries, uint16max)))
+	b = le.AppendUint32(b, uint32(min(r.cdSize, uint32max)))
+	b = le.AppendUint32(b, uint32(min(r.cdOffset, uint32max)))
+	b = le.AppendUint16(b, uint16(len(r.comment)))
+	return append(b, r.comment...)
+}
+
+// appendDirectory はひとつのファイルとしての中央ディレクトリと終端レコードを組み立てます
+// cdOffset は中央ディレクトリを置く位置です
+func appendDirectory(b []byte, entries []*DirEntry, cdOffset int64, comment []byte, zip64 bool) []byte {
+	start := len(b)
+	for _, e := range entries {
+		b = appendCentralHeader(b, e)
+	}
+	cdSize := int64(len(b) - start)
+	return appendEndRecords(b, endRecord{
+		diskEntries: uint64(len(entries)),
+		entries:     uint64(len(entries)),
+		cdSize:      cdSize,
+		cdOffset:    cdOffset,
+		end64Offset: cdOffset + cdSize,
+		totalDisks:  1,
+		comment:     comment,
+		zip64:       zip64,
+	})
+}
+
+// ParseVolumeSize はボリュームのサイズの指定（"100M"、"1.5G"、"650MB"、"65536" など）をバイト数に変換します
+// 単位はK・M・G（1024の累乗）で、大文字・小文字と末尾の"B"は区別しません
+func ParseVolumeSize(s string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(s))
+	text = strings.TrimSuffix(text, "B")
+	unit := 1.0
+	for _, u := range []struct {
+		suffix string
+		size   float64
+	}{{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}} {
+		if strings.HasSuffix(text, u.suffix) {
+			text, unit = strings.TrimSuffix(text, u.suffix), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("ボリュームのサイズを解釈できません: %s", s)
+	}
+	size := int64(n * unit)
+	if size < MinVolumeSize {
+		return 0, fmt.Errorf("ボリュームのサイズは %dKB 以上を指定してください", MinVolumeSize>>10)
+	}
+	return size, nil
+}
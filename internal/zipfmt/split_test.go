@@ -0,0 +1,326 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// 分割して読み取り・結合しても、エントリとコメントが元のZIPファイルと一致する
+func TestSplitRoundTrip(t *testing.T) {
+	data := buildSplitTestZip(t)
+	tests := []struct {
+		name        string
+		volumeSize  int64
+		wantVolumes int // 0の場合は2個以上
+	}{
+		{name: "最小のボリューム", volumeSize: MinVolumeSize},
+		{name: "半端なサイズのボリューム", volumeSize: MinVolumeSize + 12345},
+		{name: "大きめのボリューム", volumeSize: 200 << 10},
+		{name: "全体が収まるボリューム", volumeSize: int64(len(data)), wantVolumes: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := writeTestFile(t, dir, "src.zip", data)
+			dst := filepath.Join(dir, "split.zip")
+			volumes := writeSplitFile(t, src, dst, tt.volumeSize)
+
+			if tt.wantVolumes != 0 && len(volumes) != tt.wantVolumes {
+				t.Fatalf("ボリューム数 = %d, want %d", len(volumes), tt.wantVolumes)
+			}
+			if tt.wantVolumes == 0 && len(volumes) < 2 {
+				t.Fatalf("ボリューム数 = %d, want 2個以上", len(volumes))
+			}
+			if volumes[len(volumes)-1] != dst {
+				t.Errorf("最後のボリューム = %s, want %s", volumes[len(volumes)-1], dst)
+			}
+			for _, v := range volumes {
+				fi, err := os.Stat(v)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fi.Size() > tt.volumeSize {
+					t.Errorf("%s: %d バイトがボリュームのサイズ %d を超えています", filepath.Base(v), fi.Size(), tt.volumeSize)
+				}
+			}
+
+			got, err := SplitVolumes(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(volumes) == 1 {
+				if got != nil {
+					t.Errorf("分割しなかった場合の SplitVolumes = %v, want nil", got)
+				}
+				compareArchives(t, src, dst)
+				return
+			}
+			if !equalStrings(got, volumes) {
+				t.Errorf("SplitVolumes = %v, want %v", got, volumes)
+			}
+			first, err := os.ReadFile(volumes[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if binary.LittleEndian.Uint32(first) != SplitSignature {
+				t.Error("最初のボリュームに分割アーカイブのシグネチャがありません")
+			}
+
+			// 分割したまま読み取る
+			checkSameContent(t, src, dst)
+
+			// 結合したものは通常のZIPファイルとして読み取れる
+			joined := filepath.Join(dir, "joined.zip")
+			if err := JoinSplit(volumes, joined); err != nil {
+				t.Fatal(err)
+			}
+			if v, err := SplitVolumes(joined); err != nil || v != nil {
+				t.Errorf("結合したファイルの SplitVolumes = %v, %v", v, err)
+			}
+			checkSameContent(t, src, joined)
+		})
+	}
+}
+
+// 以前より少ないボリュームに分割し直した場合は、余分なボリュームを削除する
+func TestWriteSplitRemovesStaleVolumes(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "src.zip", buildSplitTestZip(t))
+	dst := filepath.Join(dir, "split.zip")
+	many := writeSplitFile(t, src, dst, MinVolumeSize)
+	few := writeSplitFile(t, src, dst, 200<<10)
+	if len(few) >= len(many) {
+		t.Fatalf("ボリューム数 %d → %d で減っていません", len(many), len(few))
+	}
+	for _, v := range many[len(few)-1 : len(many)-1] {
+		if _, err := os.Stat(v); !os.IsNotExist(err) {
+			t.Errorf("%s が残っています", filepath.Base(v))
+		}
+	}
+	checkSameContent(t, src, dst)
+
+	writeSplitFile(t, src, dst, 1<<30)
+	if _, err := os.Stat(VolumePath(dst, 0, -1)); !os.IsNotExist(err) {
+		t.Error("分割しなかった場合に以前のボリュームが残っています")
+	}
+	checkSameContent(t, src, dst)
+}
+
+// ボリュームは置き換える前のボリュームのパーミッションを引き継ぎ、新しく分割した場合は 0644 にする
+func TestWriteSplitVolumeModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windowsではパーミッションを確認できません")
+	}
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "src.zip", buildSplitTestZip(t))
+	dst := filepath.Join(dir, "split.zip")
+	checkModes := func(name string, volumes []string, want func(i int) os.FileMode) {
+		t.Helper()
+		for i, v := range volumes {
+			fi, err := os.Stat(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode().Perm() != want(i) {
+				t.Errorf("%s: %s のパーミッション = %v, want %v", name, filepath.Base(v), fi.Mode().Perm(), want(i))
+			}
+		}
+	}
+
+	few := writeSplitFile(t, src, dst, 200<<10)
+	checkModes("新しく分割", few, func(int) os.FileMode { return 0o644 })
+
+	// 増えたボリュームは最後のボリューム（.zip）と同じパーミッションにする
+	for _, v := range few[:len(few)-1] {
+		if err := os.Chmod(v, 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(dst, 0o604); err != nil {
+		t.Fatal(err)
+	}
+	many := writeSplitFile(t, src, dst, MinVolumeSize)
+	if len(many) <= len(few) {
+		t.Fatalf("ボリューム数 %d → %d で増えていません", len(few), len(many))
+	}
+	want := func(i int) os.FileMode {
+		if i < len(few)-1 {
+			return 0o640
+		}
+		return 0o604
+	}
+	checkModes("分割し直す", many, want)
+
+	// 分割アーカイブをその場で書き直してもパーミッションは変わらない
+	err := RewriteFile(dst, RewriteFileOptions{}, func(zw *zip.Writer, reader *ReadCloser) error {
+		for _, f := range reader.File {
+			if err := CopyRaw(zw, f, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumes, err := SplitVolumes(dst)
+	if err != nil || len(volumes) != len(many) {
+		t.Fatalf("SplitVolumes = %d, %v, want %d", len(volumes), err, len(many))
+	}
+	checkModes("書き直す", volumes, want)
+	checkSameContent(t, src, dst)
+}
+
+func TestSplitErrors(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "src.zip", buildSplitTestZip(t))
+	dst := filepath.Join(dir, "split.zip")
+	volumes := writeSplitFile(t, src, dst, MinVolumeSize)
+
+	f, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := WriteSplit(f, 1<<20, filepath.Join(dir, "small.zip"), MinVolumeSize-1); err == nil {
+		t.Error("最小より小さいボリュームのサイズで分割できてしまいました")
+	}
+
+	// 最後のボリュームだけを読み取って分割し直すことはできない
+	last, err := os.Open(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer last.Close()
+	fi, _ := last.Stat()
+	if _, err := WriteSplit(last, fi.Size(), filepath.Join(dir, "again.zip"), MinVolumeSize); err == nil {
+		t.Error("分割アーカイブのボリュームを分割し直せてしまいました")
+	}
+
+	// ボリュームの数が終端レコードと一致しない
+	if _, err := OpenSplit(volumes[1:]); err == nil {
+		t.Error("ボリュームが足りないのに開けてしまいました")
+	}
+
+	// ボリュームが見つからない
+	if err := os.Rename(volumes[1], volumes[1]+".bak"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SplitVolumes(dst); err == nil {
+		t.Error("SplitVolumes: ボリュームが見つからないのにエラーになりません")
+	}
+	if r, err := OpenReader(dst); err == nil {
+		r.Close()
+		t.Error("OpenReader: ボリュームが見つからないのにエラーになりません")
+	}
+}
+
+// 安全でないパスのエントリでエラーを返す場合は、ファイルを閉じてリーダーを返さない
+func TestOpenReaderInsecurePath(t *testing.T) {
+	t.Setenv("GODEBUG", "zipinsecurepath=0")
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, "insecure.zip", buildZip(t, []testEntry{{name: "../evil.txt", data: []byte("x")}}))
+
+	r, err := OpenReader(path)
+	if !errors.Is(err, zip.ErrInsecurePath) {
+		t.Fatalf("err = %v, want %v", err, zip.ErrInsecurePath)
+	}
+	if r != nil {
+		t.Error("エラーと一緒にリーダーが返されました")
+	}
+	// Windowsでは開いたままのファイルを削除できない
+	if err := os.Remove(path); err != nil {
+		t.Errorf("ファイルが閉じられていません: %v", err)
+	}
+}
+
+func TestParseVolumeSize(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    int64
+		wantErr bool
+	}{
+		{text: "100M", want: 100 << 20},
+		{text: "650MB", want: 650 << 20},
+		{text: "1.5G", want: 3 << 29},
+		{text: " 64k ", want: 64 << 10},
+		{text: "65536", want: 65536},
+		{text: "2gb", want: 2 << 30},
+		{text: "", wantErr: true},
+		{text: "M", wantErr: true},
+		{text: "abc", wantErr: true},
+		{text: "0", wantErr: true},
+		{text: "-100M", wantErr: true},
+		{text: "10K", wantErr: true}, // 最小のサイズより小さい
+		{text: "65535", wantErr: true},
+		{text: "1T", wantErr: true},
+		{text: "NaN", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseVolumeSize(tt.text)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseVolumeSize(%q) = %d, %v, want %d", tt.text, got, err, tt.want)
+		}
+	}
+}
+
+// buildSplitTestZip は分割のテスト用に、圧縮したもの・無圧縮のもの・空のものなどを含むZIPファイルを作成します
+// 圧縮が効かない内容を含めて、全体が数百KBになるようにします
+func buildSplitTestZip(t *testing.T) []byte {
+	t.Helper()
+	random := make([]byte, 180<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	return buildZipWith(t, func(zw *zip.Writer) {
+		for _, e := range []testEntry{
+			{name: "dir/", data: nil},
+			{name: "dir/random.bin", data: random, method: zip.Deflate},
+			{name: "text.txt", data: testText(300 << 10), method: zip.Deflate},
+			{name: "stored.bin", data: random[:100<<10], method: zip.Store},
+			{name: "empty.txt", data: nil},
+			{name: "日本語の名前.txt", data: []byte("分割アーカイブ"), method: zip.Deflate},
+		} {
+			w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: e.method, Modified: testTime})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(e.data)
+		}
+		zw.SetComment("分割アーカイブのコメント")
+	})
+}
+
+// checkSameContent は2つのZIPファイル（分割アーカイブを含む）のエントリの内容とコメントが一致するかを確認します
+func checkSameContent(t *testing.T, want, got string) {
+	t.Helper()
+	compareArchives(t, want, got)
+	rw, err := OpenReader(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+	rg, err := OpenReader(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rg.Close()
+	for i, f := range rg.File {
+		a, err := readAll(rw.File[i].Open())
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := readAll(f.Open())
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		if !bytes.Equal(a, b) {
+			t.Errorf("%s: 内容が一致しません", f.Name)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// maxSymlinkTarget はシンボリックリンクのエントリから読み込む参照先の最大長です
+const maxSymlinkTarget = 4096
+
+// IsSymlink はエントリがシンボリックリンク（Unixで作成され、外部属性の種類が S_IFLNK のもの）かどうかを返します
+func IsSymlink(fh *zip.FileHeader) bool {
+	return fh.Mode()&fs.ModeSymlink != 0
+}
+
+// ReadSymlink はシンボリックリンクのエントリのデータに格納されている参照先を返します
+// 参照先はエントリ名と同じ文字コードのまま（変換せずに）返します
+func ReadSymlink(f *zip.File) (string, error) {
+	if !IsSymlink(&f.FileHeader) {
+		return "", fmt.Errorf("%s はシンボリックリンクではありません", f.Name)
+	}
+	rc, err := OpenFile(f)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	target, err := io.ReadAll(io.LimitReader(rc, maxSymlinkTarget+1))
+	if err != nil {
+		return "", err
+	}
+	if len(target) > maxSymlinkTarget {
+		return "", fmt.Errorf("%s のリンクの参照先が長すぎます", f.Name)
+	}
+	return string(target), nil
+}
@@ -0,0 +1,260 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"zip-editor/internal/common"
+)
+
+// 日時を記録する拡張フィールドのID
+const (
+	ExtTimeExtraID = 0x5455 // 拡張タイムスタンプ（Unix時刻、UTC）
+	NTFSExtraID    = 0x000a // NTFSのタイムスタンプ（100ナノ秒単位、UTC）
+)
+
+// 拡張タイムスタンプのフラグ
+const (
+	extTimeMod = 1 << iota // 更新日時
+	extTimeAcc             // アクセス日時
+	extTimeCre             // 作成日時
+)
+
+const (
+	ntfsTimeTag   = 0x0001             // NTFS拡張フィールドのタイムスタンプの属性タグ
+	ntfsTimeLen   = 24                 // 更新・アクセス・作成日時の3つ
+	ntfsEpochDiff = 116444736000000000 // 1601年から1970年までの100ナノ秒の数
+)
+
+var (
+	dosMinTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	dosMaxTime = time.Date(2107, 12, 31, 23, 59, 58, 0, time.UTC)
+)
+
+// TimeSources はエントリの更新日時が記録されている場所を、表示用の名前で返します
+// MS-DOS形式の日時は常に含まれ、拡張タイムスタンプ・NTFSのタイムスタンプは記録されている場合に追加されます
+func TimeSources(fh *zip.FileHeader) []string {
+	sources := []string{"DOS"}
+	if data, ok := FindExtra(fh.Extra, ExtTimeExtraID); ok && len(data) >= 5 && data[0]&extTimeMod != 0 {
+		sources = append(sources, "拡張")
+	}
+	if data, ok := FindExtra(fh.Extra, NTFSExtraID); ok {
+		if _, ok := findNTFSTimes(data); ok {
+			sources = append(sources, "NTFS")
+		}
+	}
+	return sources
+}
+
+// findNTFSTimes はNTFS拡張フィールドのデータからタイムスタンプの属性を探し、値の位置を返します
+func findNTFSTimes(data []byte) (offset int, ok bool) {
+	if len(data) < 4 {
+		return 0, false
+	}
+	// 先頭4バイトは予約領域で、その後に「タグ・長さ・値」の属性が続く
+	for off := 4; off+4 <= len(data); {
+		tag := binary.LittleEndian.Uint16(data[off:])
+		size := int(binary.LittleEndian.Uint16(data[off+2:]))
+		if off+4+size > len(data) {
+			break
+		}
+		if tag == ntfsTimeTag && size >= ntfsTimeLen {
+			return off + 4, true
+		}
+		off += 4 + size
+	}
+	return 0, false
+}
+
+// SetModTime はエントリの更新日時を変更します
+// MS-DOS形式の日時（t のタイムゾーンでの時刻）に加えて、記録されている拡張タイムスタンプとNTFSのタイムスタンプも同じ日時に揃えます
+// 拡張タイムスタンプがない場合は、タイムゾーンに依存しない日時として追加します
+func SetModTime(fh *zip.FileHeader, t time.Time) error {
+	if fh.Flags&FlagDataDescriptor != 0 && IsZipCrypto(fh) {
+		// データ記述子を使うZipCryptoでは、パスワードの確認に更新時刻の上位バイトを使用する
+		if dosTime, _ := dosDateTime(t); dosTime>>8 != fh.ModifiedTime>>8 {
+			return errors.New("ZipCryptoで暗号化されているため日時を変更できません")
+		}
+	}
+
+	fh.ModifiedTime, fh.ModifiedDate = dosDateTime(t)
+	fh.Modified = t
+
+	fields := ParseExtra(fh.Extra)
+	hasExtTime := false
+	for i, f := range fields {
+		switch f.ID {
+		case ExtTimeExtraID:
+			fields[i].Data = setExtModTime(f.Data, t)
+			hasExtTime = true
+		case NTFSExtraID:
+			fields[i].Data = setNTFSModTime(f.Data, t)
+		}
+	}
+	if !hasExtTime {
+		fields = append(fields, ExtraField{ID: ExtTimeExtraID, Data: setExtModTime([]byte{0}, t)})
+	}
+	fh.Extra = BuildExtra(fields)
+	return nil
+}
+
+// dosDateTime は日時をMS-DOS形式（2秒単位、1980〜2107年）の時刻と日付に変換します
+func dosDateTime(t time.Time) (dosTime, dosDate uint16) {
+	// 範囲外の日時は表現できる最小・最大の日時に丸める
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	if wall.Before(dosMinTime) {
+		wall = dosMinTime
+	} else if wall.After(dosMaxTime) {
+		wall = dosMaxTime
+	}
+	dosTime = uint16(wall.Hour()<<11 | wall.Minute()<<5 | wall.Second()>>1)
+	dosDate = uint16((wall.Year()-1980)<<9 | int(wall.Month())<<5 | wall.Day())
+	return dosTime, dosDate
+}
+
+// setExtModTime は拡張タイムスタンプの更新日時を書き換えたデータを返します
+// アクセス日時・作成日時が記録されている場合は、そのまま残します
+// 長さ0のフィールドや、更新日時のフラグがあるのに値が4バイトに満たないフィールドは、更新日時だけのフィールドとして作り直します
+func setExtModTime(data []byte, t time.Time) []byte {
+	if len(data) == 0 {
+		data = []byte{0}
+	}
+	unix := t.Unix()
+	unix = min(max(unix, -1<<31), 1<<31-1)
+	out := []byte{data[0] | extTimeMod}
+	out = binary.LittleEndian.AppendUint32(out, uint32(int32(unix)))
+	rest := data[1:]
+	if data[0]&extTimeMod != 0 {
+		if len(rest) < 4 {
+			out[0] = extTimeMod
+			return out
+		}
+		rest = rest[4:]
+	}
+	return append(out, rest...)
+}
+
+// setNTFSModTime はNTFSのタイムスタンプの更新日時を書き換えたデータを返します
+func setNTFSModTime(data []byte, t time.Time) []byte {
+	out := append([]byte(nil), data...)
+	if off, ok := findNTFSTimes(out); ok {
+		ft := uint64(t.UnixNano()/100 + ntfsEpochDiff)
+		binary.LittleEndian.PutUint64(out[off:], ft)
+	}
+	return out
+}
+
+// TimeMode は日時の変更方法です
+type TimeMode int
+
+const (
+	TimeFixed       TimeMode = iota // 指定した日時にする
+	TimeNow                         // 現在の日時にする
+	TimeShift                       // 指定した時間だけずらす
+	TimeNewestChild                 // フォルダを、中にある最も新しいファイルの日時にする
+)
+
+// TimeEdit は日時の変更内容です
+type TimeEdit struct {
+	Mode   TimeMode
+	Time   time.Time     // TimeFixed の場合の日時
+	Offset time.Duration // TimeShift の場合のずらす時間
+}
+
+// PlanModTimes は変更後の更新日時をエントリごとに求めます
+// match がnilでない場合は、UTF-8に変換したパスに対してtrueを返したエントリだけを変更します
+// TimeNewestChild では、フォルダのエントリだけを中のファイル（変更の対象外のものを含む）の最も新しい日時にします
+func PlanModTimes(files []*zip.File, match func(name string) bool, edit TimeEdit) map[*zip.File]time.Time {
+	now := time.Now()
+	planned := make(map[*zip.File]time.Time)
+
+	if edit.Mode == TimeNewestChild {
+		// フォルダごとに中のファイルの最も新しい日時を求める（フォルダ自身の日時は使わない）
+		newest := make(map[string]time.Time)
+		for _, f := range files {
+			name := common.AutoDetectEncoding(f.Name)
+			if strings.HasSuffix(name, "/") {
+				continue
+			}
+			for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+				if f.Modified.After(newest[dir]) {
+					newest[dir] = f.Modified
+				}
+			}
+		}
+		for _, f := range files {
+			name := common.AutoDetectEncoding(f.Name)
+			if !strings.HasSuffix(name, "/") || (match != nil && !match(name)) {
+				continue
+			}
+			if t, ok := newest[strings.TrimSuffix(name, "/")]; ok && !t.Equal(f.Modified) {
+				planned[f] = t
+			}
+		}
+		return planned
+	}
+
+	for _, f := range files {
+		if match != nil && !match(common.AutoDetectEncoding(f.Name)) {
+			continue
+		}
+		switch edit.Mode {
+		case TimeFixed:
+			planned[f] = edit.Time
+		case TimeNow:
+			planned[f] = now
+		case TimeShift:
+			planned[f] = f.Modified.Add(edit.Offset)
+		}
+	}
+	return planned
+}
+
+// SubtreeMatcher はパスの一覧のいずれか、またはその中（フォルダの場合）にあるエントリに一致する関数を返します
+// フォルダのパスは末尾が"/"のものとして扱い、空文字列はアーカイブ全体を示します
+func SubtreeMatcher(paths []string) func(name string) bool {
+	return func(name string) bool {
+		for _, p := range paths {
+			if p == "" || name == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(name, p)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ParseTimeOffset は日時をずらす時間の指定（"+9h"、"-1d12h"、"30m" など）を解釈します
+// 時間の単位は time.ParseDuration と同じで、先頭に限り日数（"d"）も指定できます
+func ParseTimeOffset(s string) (time.Duration, error) {
+	text := strings.TrimSpace(s)
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(text, "-"):
+		sign, text = -1, text[1:]
+	case strings.HasPrefix(text, "+"):
+		text = text[1:]
+	}
+
+	var days time.Duration
+	if i := strings.Index(text, "d"); i >= 0 {
+		n, err := strconv.Atoi(text[:i])
+		if err != nil {
+			return 0, fmt.Errorf("時間の指定が正しくありません: %s", s)
+		}
+		days, text = time.Duration(n)*24*time.Hour, text[i+1:]
+	}
+	var rest time.Duration
+	if text != "" {
+		var err error
+		if rest, err = time.ParseDuration(text); err != nil {
+			return 0, fmt.Errorf("時間の指定が正しくありません: %s", s)
+		}
+	}
+	return sign * (days + rest), nil
+}
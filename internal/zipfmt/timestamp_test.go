@@ -0,0 +1,171 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestSetExtModTime(t *testing.T) {
+	when := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	unix := binary.LittleEndian.AppendUint32(nil, uint32(when.Unix()))
+	old := binary.LittleEndian.AppendUint32(nil, 1000)
+	acc := binary.LittleEndian.AppendUint32(nil, 2000)
+
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+	}{
+		{"長さ0", []byte{}, append([]byte{extTimeMod}, unix...)},
+		{"フラグのみ", []byte{0}, append([]byte{extTimeMod}, unix...)},
+		{"更新日時", append([]byte{extTimeMod}, old...), append([]byte{extTimeMod}, unix...)},
+		{"更新日時が途中で切れている", []byte{extTimeMod | extTimeAcc, 1, 2}, append([]byte{extTimeMod}, unix...)},
+		{"アクセス日時を残す", append(append([]byte{extTimeMod | extTimeAcc}, old...), acc...), append(append([]byte{extTimeMod | extTimeAcc}, unix...), acc...)},
+		{"更新日時を追加", append([]byte{extTimeAcc}, acc...), append(append([]byte{extTimeMod | extTimeAcc}, unix...), acc...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := setExtModTime(tt.data, when); !bytes.Equal(got, tt.want) {
+				t.Errorf("setExtModTime = % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetModTime(t *testing.T) {
+	when := time.Date(2023, 1, 2, 3, 4, 6, 0, time.UTC)
+	ntfs := make([]byte, 4+4+ntfsTimeLen)
+	binary.LittleEndian.PutUint16(ntfs[4:], ntfsTimeTag)
+	binary.LittleEndian.PutUint16(ntfs[6:], ntfsTimeLen)
+
+	tests := []struct {
+		name        string
+		extra       []ExtraField
+		wantSources []string
+	}{
+		{"拡張フィールドなし", nil, []string{"DOS", "拡張"}},
+		{"長さ0の拡張タイムスタンプ", []ExtraField{{ID: ExtTimeExtraID}}, []string{"DOS", "拡張"}},
+		{"NTFS", []ExtraField{{ID: NTFSExtraID, Data: ntfs}}, []string{"DOS", "拡張", "NTFS"}},
+		{"ほかの拡張フィールドを残す", []ExtraField{{ID: 0x7875, Data: []byte{1, 4, 0, 0, 0, 0, 4, 0, 0, 0, 0}}}, []string{"DOS", "拡張"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fh := &zip.FileHeader{Name: "a.txt", Extra: BuildExtra(tt.extra)}
+			if err := SetModTime(fh, when); err != nil {
+				t.Fatal(err)
+			}
+			if !fh.Modified.Equal(when) {
+				t.Errorf("Modified = %v, want %v", fh.Modified, when)
+			}
+			if got := TimeSources(fh); !equalStrings(got, tt.wantSources) {
+				t.Errorf("TimeSources = %v, want %v", got, tt.wantSources)
+			}
+			for _, f := range tt.extra {
+				if _, ok := FindExtra(fh.Extra, f.ID); !ok {
+					t.Errorf("拡張フィールド 0x%04x が失われました", f.ID)
+				}
+			}
+
+			// 書き込んで読み直しても、archive/zip が同じ日時を読み取る
+			var buf bytes.Buffer
+			zw := zip.NewWriter(&buf)
+			if _, err := zw.CreateHeader(fh); err != nil {
+				t.Fatal(err)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			f := openZip(t, buf.Bytes()).File[0]
+			if !f.Modified.Equal(when) {
+				t.Errorf("読み直した日時 = %v, want %v", f.Modified, when)
+			}
+			if data, ok := FindExtra(f.Extra, NTFSExtraID); ok {
+				off, _ := findNTFSTimes(data)
+				ft := int64(binary.LittleEndian.Uint64(data[off:]))
+				if got := time.Unix(0, (ft-ntfsEpochDiff)*100); !got.Equal(when) {
+					t.Errorf("NTFSの更新日時 = %v, want %v", got, when)
+				}
+			}
+		})
+	}
+}
+
+func TestDOSDateTimeClamp(t *testing.T) {
+	tests := []struct {
+		in   time.Time
+		want time.Time
+	}{
+		{time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), dosMinTime},
+		{time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC), dosMaxTime},
+		{time.Date(2000, 2, 29, 12, 34, 57, 0, time.UTC), time.Date(2000, 2, 29, 12, 34, 56, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		dosTime, dosDate := dosDateTime(tt.in)
+		got := time.Date(int(dosDate>>9)+1980, time.Month(dosDate>>5&0xf), int(dosDate&0x1f),
+			int(dosTime>>11), int(dosTime>>5&0x3f), int(dosTime&0x1f)*2, 0, time.UTC)
+		if !got.Equal(tt.want) {
+			t.Errorf("dosDateTime(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExtraFields(t *testing.T) {
+	fields := []ExtraField{
+		{ID: 0x0001, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{ID: ExtTimeExtraID, Data: []byte{1, 0, 0, 0, 0}},
+		{ID: 0xcafe},
+	}
+	extra := BuildExtra(fields)
+	parsed := ParseExtra(extra)
+	if len(parsed) != len(fields) {
+		t.Fatalf("ParseExtra = %d件, want %d件", len(parsed), len(fields))
+	}
+	for i := range fields {
+		if parsed[i].ID != fields[i].ID || !bytes.Equal(parsed[i].Data, fields[i].Data) {
+			t.Errorf("ParseExtra[%d] = %+v, want %+v", i, parsed[i], fields[i])
+		}
+	}
+	if data, ok := FindExtra(extra, ExtTimeExtraID); !ok || !bytes.Equal(data, fields[1].Data) {
+		t.Errorf("FindExtra = % x, %v", data, ok)
+	}
+	removed := ParseExtra(RemoveExtra(extra, 0x0001, 0xcafe))
+	if len(removed) != 1 || removed[0].ID != ExtTimeExtraID {
+		t.Errorf("RemoveExtra = %+v", removed)
+	}
+}
+
+func TestParseTimeOffset(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"+9h", 9 * time.Hour, false},
+		{"-1h30m", -90 * time.Minute, false},
+		{"-1d12h", -36 * time.Hour, false},
+		{"30m", 30 * time.Minute, false},
+		{"abc", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimeOffset(tt.in)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("ParseTimeOffset(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
+
+// equalStrings は2つの文字列のスライスが等しいかどうかを返します
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
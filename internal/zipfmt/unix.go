@@ -0,0 +1,49 @@
+package zipfmt
+
+import (
+	"encoding/binary"
+)
+
+// UnixOwnerExtraID はInfo-ZIPのUnix所有者（UID・GID）の拡張フィールドのIDです
+const UnixOwnerExtraID = 0x7875
+
+// ParseUnixOwner は拡張フィールドからUnixのUID・GIDを取り出します
+// 拡張フィールドがない、または壊れている場合は ok がfalseになります
+func ParseUnixOwner(extra []byte) (uid, gid int, ok bool) {
+	data, found := FindExtra(extra, UnixOwnerExtraID)
+	if !found || len(data) < 2 || data[0] != 1 {
+		return 0, 0, false
+	}
+	data = data[1:]
+
+	ids := make([]int, 2)
+	for i := range ids {
+		if len(data) < 1 {
+			return 0, 0, false
+		}
+		size := int(data[0])
+		if len(data) < 1+size {
+			return 0, 0, false
+		}
+		if size > 4 {
+			return 0, 0, false
+		}
+		// 値はリトルエンディアンの可変長整数
+		var n uint32
+		for j := size - 1; j >= 0; j-- {
+			n = n<<8 | uint32(data[1+j])
+		}
+		ids[i] = int(n)
+		data = data[1+size:]
+	}
+	return ids[0], ids[1], true
+}
+
+// BuildUnixOwner はUnixのUID・GIDを記録する拡張フィールドを作成します
+func BuildUnixOwner(uid, gid int) ExtraField {
+	data := []byte{1, 4}
+	data = binary.LittleEndian.AppendUint32(data, uint32(uid))
+	data = append(data, 4)
+	data = binary.LittleEndian.AppendUint32(data, uint32(gid))
+	return ExtraField{ID: UnixOwnerExtraID, Data: data}
+}
@@ -0,0 +1,73 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"io"
+)
+
+// CopyRaw はエントリの圧縮データを展開・再圧縮せずにそのまま書き込みます
+// fh がnilの場合は元のヘッダを使用します。
+// 元の拡張フィールドに含まれるZIP64情報は取り除き、サイズやオフセットが
+// 32ビットに収まらない場合にだけライターが付け直すようにします。
+func CopyRaw(zw *zip.Writer, f *zip.File, fh *zip.FileHeader) error {
+	header := f.FileHeader
+	if fh != nil {
+		header = *fh
+	}
+	header.Extra = RemoveExtra(header.Extra, Zip64ExtraID)
+
+	rc, err := f.OpenRaw()
+	if err != nil {
+		return err
+	}
+
+	writer, err := zw.CreateRaw(&header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, rc)
+	return err
+}
+
+// VerifyFile はエントリを最後まで展開し、CRCとサイズを検証します
+func VerifyFile(f *zip.File) error {
+	rc, err := OpenFile(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// archive/zip は最後まで読み終えた時点でCRCを照合する
+	n, err := io.Copy(io.Discard, rc)
+	if err != nil {
+		return err
+	}
+	if uint64(n) != f.UncompressedSize64 {
+		return errSizeMismatch
+	}
+	return nil
+}
+
+// NeedsZip64 はエントリ数・サイズ・オフセットのいずれかが従来形式の上限に達し、
+// ZIP64形式のレコードが必要かどうかを返します
+func NeedsZip64(dir *Directory) bool {
+	if len(dir.Entries) >= uint16max || dir.Size >= uint32max || dir.Offset >= uint32max {
+		return true
+	}
+	for _, e := range dir.Entries {
+		if e.CompressedSize64 >= uint32max || e.UncompressedSize64 >= uint32max || e.HeaderOffset >= uint32max {
+			return true
+		}
+	}
+	return false
+}
+
+// HasZip64End はアーカイブ末尾にZIP64終端レコード（ロケーター）が存在するかを返します
+func HasZip64End(r io.ReaderAt, size int64) (bool, error) {
+	dir, err := ReadDirectory(r, size)
+	if err != nil {
+		return false, err
+	}
+	return dir.Zip64, nil
+}
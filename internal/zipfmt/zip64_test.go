@@ -0,0 +1,259 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ZIP64形式が必要な場合にだけ出力され、読み込み・CRCの検証・保存と同じ書き直しの往復で壊れないことを確認する
+// 4GBを超えるエントリはスパースファイルとして作成するため、大きなテストデータを用意しなくても実行できる（-short では省略）
+func TestZip64RoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		large     bool                       // 4GBを超えるエントリを含む（-short では省略する）
+		stub      []byte                     // 先頭に付加するデータ
+		wantZip64 bool                       // ZIP64形式になるべきかどうか
+		generate  func(zw *zip.Writer) error // エントリを書き込む関数
+	}{
+		{name: "従来形式", wantZip64: false, generate: generateClassic},
+		{name: "先頭にデータが付加された従来形式", stub: []byte("MZ self-extractor stub"), wantZip64: false, generate: generateClassic},
+		{name: "65535件を超えるエントリ", wantZip64: true, generate: generateManyEntries},
+		{name: "4GBを超えるエントリ", large: true, wantZip64: true, generate: generateLargeEntry},
+		{name: "先頭にデータが付加された4GBを超えるエントリ", large: true, stub: []byte("#!/bin/sh\nexit 0\n"), wantZip64: true, generate: generateLargeEntry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.large && testing.Short() {
+				t.Skip("-short では4GBを超えるエントリを含むアーカイブを作成しない")
+			}
+			dir := t.TempDir()
+			path := filepath.Join(dir, "corpus.zip")
+			if err := writeSparseZip(path, tt.stub, tt.generate); err != nil {
+				t.Fatalf("生成に失敗しました: %v", err)
+			}
+			checkZip64Archive(t, path, tt.wantZip64, int64(len(tt.stub)))
+
+			// 保存（SaveZipFile）と同じく、RewriteArchive と CopyRaw で圧縮データをそのままコピーして書き直す
+			rewritten := filepath.Join(dir, "rewritten.zip")
+			if err := rewriteSparse(path, rewritten); err != nil {
+				t.Fatalf("書き直しに失敗しました: %v", err)
+			}
+			checkZip64Archive(t, rewritten, tt.wantZip64, int64(len(tt.stub)))
+			compareArchives(t, path, rewritten)
+		})
+	}
+}
+
+// writeSparseZip はゼロが続く領域をシークで飛ばしながらZIPファイルを書き出します
+func writeSparseZip(path string, stub []byte, generate func(zw *zip.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(stub); err != nil {
+		return err
+	}
+	zw := zip.NewWriter(&sparseWriter{f: f})
+	zw.SetOffset(int64(len(stub)))
+	if err := generate(zw); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// rewriteSparse はすべてのエントリを保存と同じ処理で別のファイルへ書き直します
+func rewriteSparse(src, dst string) error {
+	reader, err := OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = RewriteArchive(&sparseWriter{f: f}, reader, RewriteOptions{}, func(zw *zip.Writer) error {
+		for _, file := range reader.File {
+			if err := CopyRaw(zw, file, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// checkZip64Archive は全エントリのCRCを検証し、ZIP64形式の有無と先頭に付加されたデータの長さが期待どおりかを確認します
+func checkZip64Archive(t *testing.T, path string, wantZip64 bool, wantPrefix int64) {
+	t.Helper()
+	reader, err := OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if err := VerifyFile(file); err != nil {
+			t.Fatalf("%s: %v", file.Name, err)
+		}
+	}
+
+	dir, err := ReadDirectory(reader.ra, reader.size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir.Zip64 != wantZip64 {
+		t.Errorf("ZIP64終端レコードの有無 = %v, want %v", dir.Zip64, wantZip64)
+	}
+	if NeedsZip64(dir) != dir.Zip64 {
+		t.Error("ZIP64形式が必要な場合にだけ出力されていません")
+	}
+	prefix, err := reader.Prefix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefix.Size != wantPrefix {
+		t.Errorf("先頭に付加されたデータ = %d バイト, want %d バイト", prefix.Size, wantPrefix)
+	}
+}
+
+// compareArchives は書き直す前後でエントリの名前・サイズ・CRCが一致するかを確認します
+func compareArchives(t *testing.T, a, b string) {
+	t.Helper()
+	ra, err := OpenReader(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ra.Close()
+	rb, err := OpenReader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rb.Close()
+
+	if len(ra.File) != len(rb.File) {
+		t.Fatalf("エントリ数が一致しません（%d と %d）", len(ra.File), len(rb.File))
+	}
+	for i := range ra.File {
+		fa, fb := ra.File[i], rb.File[i]
+		if fa.Name != fb.Name || fa.CRC32 != fb.CRC32 ||
+			fa.UncompressedSize64 != fb.UncompressedSize64 || fa.CompressedSize64 != fb.CompressedSize64 {
+			t.Fatalf("エントリが一致しません: %s", fa.Name)
+		}
+	}
+	if ra.Comment != rb.Comment {
+		t.Errorf("コメント = %q, want %q", rb.Comment, ra.Comment)
+	}
+}
+
+// generateClassic は従来形式に収まる小さなアーカイブを生成します
+func generateClassic(zw *zip.Writer) error {
+	for i := 0; i < 10; i++ {
+		w, err := zw.Create(fmt.Sprintf("dir/file%02d.txt", i))
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "classic entry %d\n", i); err != nil {
+			return err
+		}
+	}
+	return zw.SetComment("コメント")
+}
+
+// generateManyEntries はエントリ数が65,535件を超えるアーカイブを生成します
+func generateManyEntries(zw *zip.Writer) error {
+	const count = 70000
+	for i := 0; i < count; i++ {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf("d%03d/f%06d.txt", i/1000, i), Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%d", i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateLargeEntry は4GBを超える無圧縮エントリと、その後ろ（4GBを超える位置）に
+// 小さなエントリを持つアーカイブを生成します
+func generateLargeEntry(zw *zip.Writer) error {
+	const size = 1<<32 + 16
+
+	// ゼロだけのデータなので、CRCは書き込む前に計算できる
+	header := &zip.FileHeader{
+		Name:               "large.bin",
+		Method:             zip.Store,
+		CRC32:              zeroCRC(size),
+		CompressedSize64:   size,
+		UncompressedSize64: size,
+	}
+	w, err := zw.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, zeroReader{}, size); err != nil {
+		return err
+	}
+
+	w, err = zw.Create("after-large.txt")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "this entry starts beyond 4GB\n")
+	return err
+}
+
+// zeroCRC は指定したバイト数のゼロのCRC32を計算します
+func zeroCRC(size int64) uint32 {
+	buf := make([]byte, 1<<20)
+	crc := uint32(0)
+	for size > 0 {
+		n := min(int64(len(buf)), size)
+		crc = crc32.Update(crc, crc32.IEEETable, buf[:n])
+		size -= n
+	}
+	return crc
+}
+
+// zeroReader はゼロを無限に返すリーダーです
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// sparseWriter はゼロだけのブロックを書き込む代わりにシークし、スパースファイルを作成します
+type sparseWriter struct {
+	f *os.File
+}
+
+func (s *sparseWriter) Write(p []byte) (int, error) {
+	if len(bytes.Trim(p, "\x00")) > 0 {
+		return s.f.Write(p)
+	}
+	// 末尾がゼロで終わってもファイルサイズが正しくなるよう、最後に書き込まれる
+	// 中央ディレクトリが必ずゼロ以外を含むことを前提にシークする
+	if _, err := s.f.Seek(int64(len(p)), io.SeekCurrent); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
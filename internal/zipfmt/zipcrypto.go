@@ -0,0 +1,229 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// zipCryptoHeaderLen は従来のPKWARE暗号（ZipCrypto）の暗号化ヘッダの長さです
+const zipCryptoHeaderLen = 12
+
+var (
+	// ErrPassword はパスワードが正しくない場合のエラーです
+	ErrPassword = errors.New("パスワードが正しくありません")
+	// ErrUnsupportedEncryption は対応していない暗号化方式の場合のエラーです
+	ErrUnsupportedEncryption = errors.New("対応していない暗号化方式です")
+	// ErrUnsupportedMethod は対応していない圧縮方式の場合のエラーです
+	ErrUnsupportedMethod = errors.New("対応していない圧縮方式です")
+)
+
+// zipCryptoKeys はZipCryptoの内部状態（3つの鍵）です
+type zipCryptoKeys [3]uint32
+
+// newZipCryptoKeys はパスワードで鍵を初期化します
+func newZipCryptoKeys(password []byte) *zipCryptoKeys {
+	k := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+	for _, c := range password {
+		k.update(c)
+	}
+	return k
+}
+
+// crc32Byte はCRC32を1バイト分だけ進めます（前後の反転は行いません）
+func crc32Byte(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
+
+func (k *zipCryptoKeys) update(c byte) {
+	k[0] = crc32Byte(k[0], c)
+	k[1] = (k[1]+k[0]&0xff)*134775813 + 1
+	k[2] = crc32Byte(k[2], byte(k[1]>>24))
+}
+
+func (k *zipCryptoKeys) stream() byte {
+	t := k[2] | 2
+	return byte((t * (t ^ 1)) >> 8)
+}
+
+func (k *zipCryptoKeys) decrypt(b []byte) {
+	for i := range b {
+		b[i] ^= k.stream()
+		k.update(b[i])
+	}
+}
+
+func (k *zipCryptoKeys) encrypt(b []byte) {
+	for i := range b {
+		c := b[i]
+		b[i] ^= k.stream()
+		k.update(c)
+	}
+}
+
+// zipCryptoCheckByte はパスワードの照合に使う値を返します
+// データディスクリプタを使う場合は更新時刻の上位バイト、そうでない場合はCRCの上位バイトです
+func zipCryptoCheckByte(fh *zip.FileHeader) byte {
+	if fh.Flags&FlagDataDescriptor != 0 {
+		return byte(fh.ModifiedTime >> 8)
+	}
+	return byte(fh.CRC32 >> 24)
+}
+
+// IsZipCrypto はエントリが従来のPKWARE暗号で暗号化されているかどうかを返します
+// （強力な暗号化フラグが立っているものやAES暗号化は含みません）
+func IsZipCrypto(fh *zip.FileHeader) bool {
+	const flagStrongEncryption = 0x40
+	return fh.Flags&FlagEncrypted != 0 && fh.Flags&flagStrongEncryption == 0 && fh.Method != methodAES
+}
+
+// passwordCandidates はパスワードのバイト列の候補を返します
+// 日本語版Windowsで作成されたZIPはShift-JISでパスワードを扱うことがあるため、UTF-8と両方試します
+func passwordCandidates(password string) [][]byte {
+	candidates := [][]byte{[]byte(password)}
+	if sjis, err := japanese.ShiftJIS.NewEncoder().String(password); err == nil && sjis != password {
+		candidates = append(candidates, []byte(sjis))
+	}
+	return candidates
+}
+
+// zipCryptoReader は暗号化されたデータを復号しながら読み取るリーダーです
+type zipCryptoReader struct {
+	r    io.Reader
+	keys *zipCryptoKeys
+}
+
+func (z *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := z.r.Read(p)
+	z.keys.decrypt(p[:n])
+	return n, err
+}
+
+// newZipCryptoReader は暗号化ヘッダを読み取ってパスワードを照合し、復号リーダーを返します
+func newZipCryptoReader(raw io.ReaderAt, size int64, fh *zip.FileHeader, password string) (io.Reader, error) {
+	if size < zipCryptoHeaderLen {
+		return nil, errTruncated
+	}
+	var header [zipCryptoHeaderLen]byte
+	if _, err := raw.ReadAt(header[:], 0); err != nil {
+		return nil, err
+	}
+
+	check := zipCryptoCheckByte(fh)
+	for _, pw := range passwordCandidates(password) {
+		keys := newZipCryptoKeys(pw)
+		buf := header
+		keys.decrypt(buf[:])
+		if buf[zipCryptoHeaderLen-1] == check {
+			body := io.NewSectionReader(raw, zipCryptoHeaderLen, size-zipCryptoHeaderLen)
+			return &zipCryptoReader{r: body, keys: keys}, nil
+		}
+	}
+	return nil, ErrPassword
+}
+
+// zipCryptoWriter はデータを暗号化しながら書き込むライターです
+type zipCryptoWriter struct {
+	w    io.Writer
+	keys *zipCryptoKeys
+	buf  []byte
+}
+
+func (z *zipCryptoWriter) Write(p []byte) (int, error) {
+	z.buf = append(z.buf[:0], p...)
+	z.keys.encrypt(z.buf)
+	return z.w.Write(z.buf)
+}
+
+// newZipCryptoWriter は乱数と照合用の値からなる暗号化ヘッダを書き込み、暗号化ライターを返します
+func newZipCryptoWriter(w io.Writer, password string, check byte) (io.Writer, error) {
+	keys := newZipCryptoKeys([]byte(password))
+
+	var header [zipCryptoHeaderLen]byte
+	if _, err := rand.Read(header[:zipCryptoHeaderLen-1]); err != nil {
+		return nil, err
+	}
+	header[zipCryptoHeaderLen-1] = check
+	keys.encrypt(header[:])
+	if _, err := w.Write(header[:]); err != nil {
+		return nil, err
+	}
+	return &zipCryptoWriter{w: w, keys: keys}, nil
+}
+
+// CopyRawEncrypted は暗号化されていないエントリの圧縮データをZipCryptoで暗号化して書き込みます
+// 再圧縮は行わないため、圧縮後サイズは暗号化ヘッダの分だけ増えます
+func CopyRawEncrypted(zw *zip.Writer, f *zip.File, fh *zip.FileHeader, password string) error {
+	header := f.FileHeader
+	if fh != nil {
+		header = *fh
+	}
+	// 暗号化済みのエントリ、ディレクトリとシンボリックリンクはそのままコピーする
+	if header.Flags&FlagEncrypted != 0 || isDirName(header.Name) || IsSymlink(&header) {
+		return CopyRaw(zw, f, &header)
+	}
+
+	header.Extra = RemoveExtra(header.Extra, Zip64ExtraID)
+	header.Flags |= FlagEncrypted
+	header.CompressedSize64 += zipCryptoHeaderLen
+
+	rc, err := f.OpenRaw()
+	if err != nil {
+		return err
+	}
+
+	writer, err := zw.CreateRaw(&header)
+	if err != nil {
+		return err
+	}
+
+	ew, err := newZipCryptoWriter(writer, password, zipCryptoCheckByte(&header))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(ew, rc)
+	return err
+}
+
+// isDirName はZIP内の名前がディレクトリを表すかどうかを返します
+func isDirName(name string) bool {
+	return len(name) > 0 && name[len(name)-1] == '/'
+}
+
+// checksumReader は読み終えた時点でCRCとサイズを照合するリーダーです
+type checksumReader struct {
+	rc       io.ReadCloser
+	hash     hash.Hash32
+	n        uint64
+	crc      uint32
+	size     uint64
+	checkCRC bool // AE-2形式のようにCRCが記録されていない場合はfalse
+}
+
+func newChecksumReader(rc io.ReadCloser, crc uint32, size uint64, checkCRC bool) *checksumReader {
+	return &checksumReader{rc: rc, hash: crc32.NewIEEE(), crc: crc, size: size, checkCRC: checkCRC}
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.rc.Read(p)
+	c.hash.Write(p[:n])
+	c.n += uint64(n)
+	if err == io.EOF {
+		if c.n != c.size {
+			return n, io.ErrUnexpectedEOF
+		}
+		if c.checkCRC && c.hash.Sum32() != c.crc {
+			return n, zip.ErrChecksum
+		}
+	}
+	return n, err
+}
+
+func (c *checksumReader) Close() error {
+	return c.rc.Close()
+}
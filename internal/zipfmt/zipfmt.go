@@ -0,0 +1,102 @@
+// Package zipfmt はZIPファイルの構造（ヘッダ、拡張フィールド、圧縮方式）を
+// 低レベルで扱うための処理をまとめたパッケージです。
+// GUIに依存しないため、Windows以外の環境でもビルドできます。
+package zipfmt
+
+import (
+	"encoding/binary"
+)
+
+// ZIPファイルの各レコードのシグネチャ
+const (
+	LocalHeaderSignature    = 0x04034b50
+	CentralHeaderSignature  = 0x02014b50
+	DataDescriptorSignature = 0x08074b50
+	EndSignature            = 0x06054b50
+	End64Signature          = 0x06064b50
+	End64LocatorSignature   = 0x07064b50
+)
+
+// 汎用ビットフラグ
+const (
+	FlagEncrypted      = 0x0001 // 暗号化されている
+	FlagDataDescriptor = 0x0008 // サイズとCRCがデータの後ろに記録されている
+	FlagUTF8           = 0x0800 // ファイル名とコメントがUTF-8
+)
+
+// 拡張フィールドのID
+const (
+	Zip64ExtraID = 0x0001 // ZIP64拡張情報
+)
+
+// methodAES はWinZip AES暗号化を示す圧縮方式の値です
+const methodAES = 99
+
+const (
+	localHeaderLen = 30         // ローカルファイルヘッダの固定長部分
+	uint32max      = 0xffffffff // 32ビットフィールドの最大値（ZIP64への退避を示す）
+)
+
+// ExtraField は拡張フィールドの1ブロックを表します
+type ExtraField struct {
+	ID   uint16
+	Data []byte
+}
+
+// ParseExtra は拡張フィールドをブロックごとに分解します
+// 途中で壊れている場合は、読めたところまでを返します
+func ParseExtra(extra []byte) []ExtraField {
+	var fields []ExtraField
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if 4+size > len(extra) {
+			break
+		}
+		fields = append(fields, ExtraField{ID: id, Data: extra[4 : 4+size]})
+		extra = extra[4+size:]
+	}
+	return fields
+}
+
+// BuildExtra は拡張フィールドのブロックを連結してバイト列に戻します
+func BuildExtra(fields []ExtraField) []byte {
+	var out []byte
+	for _, f := range fields {
+		var head [4]byte
+		binary.LittleEndian.PutUint16(head[0:2], f.ID)
+		binary.LittleEndian.PutUint16(head[2:4], uint16(len(f.Data)))
+		out = append(out, head[:]...)
+		out = append(out, f.Data...)
+	}
+	return out
+}
+
+// FindExtra は指定したIDの拡張フィールドのデータを返します
+func FindExtra(extra []byte, id uint16) ([]byte, bool) {
+	for _, f := range ParseExtra(extra) {
+		if f.ID == id {
+			return f.Data, true
+		}
+	}
+	return nil, false
+}
+
+// RemoveExtra は指定したIDの拡張フィールドを取り除いたバイト列を返します
+// 元のスライスは変更しません
+func RemoveExtra(extra []byte, ids ...uint16) []byte {
+	var kept []ExtraField
+	for _, f := range ParseExtra(extra) {
+		remove := false
+		for _, id := range ids {
+			if f.ID == id {
+				remove = true
+				break
+			}
+		}
+		if !remove {
+			kept = append(kept, f)
+		}
+	}
+	return BuildExtra(kept)
+}
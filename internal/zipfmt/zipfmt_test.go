@@ -0,0 +1,91 @@
+package zipfmt
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// testEntry はテスト用のZIPファイルに格納するエントリです
+type testEntry struct {
+	name     string
+	data     []byte
+	method   uint16
+	modified time.Time
+}
+
+// testTime はテスト用のエントリの更新日時です
+var testTime = time.Date(2024, 5, 6, 7, 8, 10, 0, time.UTC)
+
+// testText は圧縮が効く程度に繰り返しのあるテスト用の内容を返します
+func testText(n int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < n; i++ {
+		buf.WriteString("ZIP Editor のテストデータ ")
+		buf.WriteByte(byte('a' + i%26))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()[:n]
+}
+
+// buildZip はエントリを格納したZIPファイルのバイト列を作成します
+func buildZip(t *testing.T, entries []testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		modified := e.modified
+		if modified.IsZero() {
+			modified = testTime
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: e.method, Modified: modified})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// openZip はZIPファイルのバイト列を読み取ります
+func openZip(t *testing.T, data []byte) *zip.Reader {
+	t.Helper()
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// rewriteZip はZIPファイルのエントリを copyEntry で書き直したZIPファイルのバイト列を返します
+func rewriteZip(t *testing.T, data []byte, copyEntry func(zw *zip.Writer, f *zip.File) error) []byte {
+	t.Helper()
+	r := openZip(t, data)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range r.File {
+		if err := copyEntry(zw, f); err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readAll はリーダーの内容を最後まで読み取ります（読み終えたときの照合のエラーも返します）
+func readAll(rc io.ReadCloser, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}